@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/msimon/nauts/provider"
+)
+
+// AccountPushResult is the outcome of pushing the JWT of a managed account.
+type AccountPushResult struct {
+	Account   string `json:"account"`
+	PublicKey string `json:"publicKey"`
+	// Created is true if the account resolver did not know the account.
+	Created bool `json:"created,omitempty"`
+	// Changed is true if the JWT differed from the one of the resolver and
+	// was (or, in a dry run, would be) pushed.
+	Changed bool   `json:"changed"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (r AccountPushResult) String() string {
+	switch {
+	case r.Error != "":
+		return fmt.Sprintf("account %s (%s): %s", r.Account, r.PublicKey, r.Error)
+	case r.Created:
+		return fmt.Sprintf("account %s (%s): created", r.Account, r.PublicKey)
+	case r.Changed:
+		return fmt.Sprintf("account %s (%s): updated", r.Account, r.PublicKey)
+	default:
+		return fmt.Sprintf("account %s (%s): up to date", r.Account, r.PublicKey)
+	}
+}
+
+// PushAccountJWTs generates the JWTs of the accounts managed by accounts and
+// pushes those that changed to the account resolver, on nc (a system account
+// connection). With dryRun, nothing is pushed. A failure of one account is
+// recorded in its result and does not stop the others; an error is returned
+// if accounts does not manage account JWTs.
+func PushAccountJWTs(ctx context.Context, nc *nats.Conn, accounts provider.AccountProvider, dryRun bool) ([]AccountPushResult, error) {
+	manager, ok := accounts.(provider.AccountManager)
+	if !ok {
+		return nil, errors.New("account provider does not manage account JWTs")
+	}
+
+	var results []AccountPushResult
+	for _, name := range manager.ManagedAccounts() {
+		result := AccountPushResult{Account: name}
+		if err := pushAccountJWT(ctx, nc, accounts, manager, &result, dryRun); err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func pushAccountJWT(ctx context.Context, nc *nats.Conn, accounts provider.AccountProvider, manager provider.AccountManager, result *AccountPushResult, dryRun bool) error {
+	ctx, cancel := context.WithTimeout(ctx, revocationPushTimeout)
+	defer cancel()
+
+	account, err := accounts.GetAccount(ctx, result.Account)
+	if err != nil {
+		return err
+	}
+	result.PublicKey = account.PublicKey()
+
+	current, err := lookupAccountJWT(ctx, nc, result.PublicKey)
+	if err != nil {
+		return err
+	}
+	token, changed, err := manager.EncodeAccountJWT(ctx, result.Account, current)
+	if err != nil {
+		return err
+	}
+	result.Created = current == ""
+	result.Changed = changed
+	if !changed || dryRun {
+		return nil
+	}
+	return updateAccountJWT(ctx, nc, token)
+}
+
+// PushAccountJWTsWithConfig pushes the managed account JWTs of the
+// configuration (account.operator.manage) with PushAccountJWTs, connecting
+// to NATS with the system credentials of the manage section.
+func PushAccountJWTsWithConfig(ctx context.Context, config *Config, dryRun bool) ([]AccountPushResult, error) {
+	if config.Account.Operator == nil || config.Account.Operator.Manage == nil {
+		return nil, errors.New("account.operator.manage is not configured")
+	}
+	accounts, err := newAccountProvider(config.Account)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := config.Account.Operator.Manage.SystemCredentials
+	nc, err := nats.Connect(serverNatsURL(config), nats.Name("nauts-account-push"), nats.UserCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("connecting to NATS as system user: %w", err)
+	}
+	defer nc.Close()
+
+	return PushAccountJWTs(ctx, nc, accounts, dryRun)
+}
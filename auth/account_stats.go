@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+)
+
+// DefaultMaxTrackedUsers is the default number of distinct user IDs an
+// AccountStats remembers per account for UniqueUsers.
+const DefaultMaxTrackedUsers = 10000
+
+// AccountStats counts authentications per account: successes, failures,
+// distinct users and the number of permissions granted. It is safe for
+// concurrent use.
+//
+// AccountStats implements expvar.Var, so embedders can publish it with
+// expvar.Publish.
+type AccountStats struct {
+	// MaxTrackedUsers caps the distinct user IDs remembered per account, so a
+	// flood of random identities cannot grow memory without bound. Once
+	// reached, UniqueUsers stops growing and UniqueUsersCapped is set.
+	MaxTrackedUsers int
+
+	mu       sync.Mutex
+	accounts map[string]*accountCounters
+}
+
+type accountCounters struct {
+	auths       uint64
+	failures    uint64
+	permissions uint64
+	users       map[string]struct{}
+	capped      bool
+}
+
+// AccountStatsSnapshot is a snapshot of the counters of one account.
+type AccountStatsSnapshot struct {
+	Account           string  `json:"account"`
+	Auths             uint64  `json:"auths"`
+	Failures          uint64  `json:"failures"`
+	UniqueUsers       int     `json:"unique_users"`
+	UniqueUsersCapped bool    `json:"unique_users_capped,omitempty"`
+	AvgPermissions    float64 `json:"avg_permissions"`
+}
+
+// NewAccountStats creates an empty AccountStats tracking up to
+// DefaultMaxTrackedUsers distinct users per account.
+func NewAccountStats() *AccountStats {
+	return &AccountStats{
+		MaxTrackedUsers: DefaultMaxTrackedUsers,
+		accounts:        make(map[string]*accountCounters),
+	}
+}
+
+// counters returns the counters of account, creating them if needed.
+// The caller must hold s.mu.
+func (s *AccountStats) counters(account string) *accountCounters {
+	c, ok := s.accounts[account]
+	if !ok {
+		c = &accountCounters{users: make(map[string]struct{})}
+		s.accounts[account] = c
+	}
+	return c
+}
+
+// RecordSuccess records a successful authentication of userID in account
+// that was granted permissions publish and subscribe permissions in total.
+func (s *AccountStats) RecordSuccess(account, userID string, permissions int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.counters(account)
+	c.auths++
+	c.permissions += uint64(permissions)
+	if _, seen := c.users[userID]; !seen {
+		if s.MaxTrackedUsers > 0 && len(c.users) >= s.MaxTrackedUsers {
+			c.capped = true
+		} else {
+			c.users[userID] = struct{}{}
+		}
+	}
+}
+
+// RecordFailure records a failed authentication for account.
+func (s *AccountStats) RecordFailure(account string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.counters(account).failures++
+}
+
+// Snapshot returns the current counters, sorted by account.
+func (s *AccountStats) Snapshot() []AccountStatsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]AccountStatsSnapshot, 0, len(s.accounts))
+	for account, c := range s.accounts {
+		snap := AccountStatsSnapshot{
+			Account:           account,
+			Auths:             c.auths,
+			Failures:          c.failures,
+			UniqueUsers:       len(c.users),
+			UniqueUsersCapped: c.capped,
+		}
+		if c.auths > 0 {
+			snap.AvgPermissions = float64(c.permissions) / float64(c.auths)
+		}
+		result = append(result, snap)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Account < result[j].Account
+	})
+	return result
+}
+
+// String returns the snapshot as JSON (implements expvar.Var).
+func (s *AccountStats) String() string {
+	data, err := json.Marshal(s.Snapshot())
+	if err != nil {
+		return "[]"
+	}
+	return string(data)
+}
+
+// recordAccountStats records the outcome of Authenticate. Failures are only
+// attributed to accounts known to the account provider, so requests naming
+// arbitrary accounts cannot grow the statistics without bound.
+func (c *AuthController) recordAccountStats(ctx context.Context, account string, result *AuthResult, err error) {
+	if err != nil {
+		if account == "" {
+			return
+		}
+		if _, err := c.accountProvider.GetAccount(ctx, account); err != nil {
+			return
+		}
+		c.accountStats.RecordFailure(account)
+		return
+	}
+	permissions := 0
+	if p := result.CompilationResult.Permissions; p != nil {
+		permissions = len(p.PubList()) + len(p.SubList())
+	}
+	c.accountStats.RecordSuccess(result.User.Account, result.User.ID, permissions)
+}
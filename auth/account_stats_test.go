@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+)
+
+func TestAccountStats_Record(t *testing.T) {
+	s := NewAccountStats()
+	s.MaxTrackedUsers = 2
+
+	s.RecordSuccess("B", "alice", 4)
+	s.RecordSuccess("A", "alice", 2)
+	s.RecordSuccess("A", "alice", 4)
+	s.RecordSuccess("A", "bob", 6)
+	s.RecordSuccess("A", "carol", 0)
+	s.RecordFailure("A")
+
+	snap := s.Snapshot()
+	if len(snap) != 2 || snap[0].Account != "A" || snap[1].Account != "B" {
+		t.Fatalf("snapshot = %+v, want accounts A and B", snap)
+	}
+	a := snap[0]
+	if a.Auths != 4 || a.Failures != 1 || a.AvgPermissions != 3 {
+		t.Errorf("A auths/failures/avg = %d/%d/%v, want 4/1/3", a.Auths, a.Failures, a.AvgPermissions)
+	}
+	if a.UniqueUsers != 2 || !a.UniqueUsersCapped {
+		t.Errorf("A unique users = %d capped %v, want 2 capped", a.UniqueUsers, a.UniqueUsersCapped)
+	}
+	if snap[1].UniqueUsers != 1 || snap[1].UniqueUsersCapped {
+		t.Errorf("B = %+v, want 1 unique user", snap[1])
+	}
+
+	var decoded []AccountStatsSnapshot
+	if err := json.Unmarshal([]byte(s.String()), &decoded); err != nil {
+		t.Fatalf("String() is not valid JSON: %v", err)
+	}
+}
+
+func TestAuthenticate_AccountStats(t *testing.T) {
+	ctrl := createTestController(t)
+	stats := NewAccountStats()
+	WithAccountStats(stats)(ctrl)
+
+	ctx := context.Background()
+	for _, token := range []string{
+		`{"account":"test-account","token":"alice:secret123"}`,
+		`{"account":"test-account","token":"alice:secret123"}`,
+		`{"account":"test-account","token":"alice:wrongpassword"}`,
+		`{"account":"unknown-account","token":"alice:secret123"}`,
+		`not json`,
+	} {
+		_, _ = ctrl.Authenticate(ctx, natsjwt.ConnectOptions{Token: token}, "", time.Hour)
+	}
+
+	snap := stats.Snapshot()
+	if len(snap) != 1 {
+		t.Fatalf("snapshot = %+v, want only test-account", snap)
+	}
+	if s := snap[0]; s.Account != "test-account" || s.Auths != 2 || s.Failures != 1 || s.UniqueUsers != 1 || s.AvgPermissions == 0 {
+		t.Errorf("test-account = %+v, want 2 auths, 1 failure, 1 user, permissions", s)
+	}
+}
@@ -0,0 +1,306 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// AdminHistorySubject is the NATS subject for reload history requests.
+	AdminHistorySubject = "nauts.admin.history"
+
+	// AdminRollbackSubject is the NATS subject for rollback requests.
+	AdminRollbackSubject = "nauts.admin.rollback"
+
+	// AdminStatsSubject is the NATS subject for per-account statistics requests.
+	AdminStatsSubject = "nauts.admin.stats"
+)
+
+// AdminService handles NATS requests that change the running service, such as
+// rolling back to a previous configuration or managing policies and bindings.
+// Access is controlled by NATS permissions on the admin subjects and, if
+// server.admin.tokenFile is set, by a token every request must carry.
+type AdminService struct {
+	reloader    *Reloader
+	config      ServerConfig
+	token       string
+	revocations *RevocationList
+	pending     *PendingBindings
+
+	nc     *nats.Conn
+	subs   []*nats.Subscription
+	logger Logger
+
+	done   chan struct{}
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	closed bool
+}
+
+// AdminOption configures an AdminService.
+type AdminOption func(*AdminService)
+
+// WithAdminLogger sets a custom logger for the admin service.
+func WithAdminLogger(l Logger) AdminOption {
+	return func(s *AdminService) {
+		s.logger = l
+	}
+}
+
+// NewAdminService creates a new AdminService operating on reloader.
+func NewAdminService(reloader *Reloader, config ServerConfig, opts ...AdminOption) (*AdminService, error) {
+	if reloader == nil {
+		return nil, errors.New("reloader is required")
+	}
+	hasCredentials := config.NatsCredentials != ""
+	hasNkey := config.NatsNkey != ""
+	if !hasCredentials && !hasNkey {
+		return nil, errors.New("NATS authentication required: set NatsCredentials or NatsNkey")
+	}
+	if hasCredentials && hasNkey {
+		return nil, errors.New("NatsCredentials and NatsNkey are mutually exclusive")
+	}
+	if config.NatsURL == "" {
+		config.NatsURL = nats.DefaultURL
+	}
+	if os.Getenv("NATS_URL") != "" {
+		config.NatsURL = os.Getenv("NATS_URL")
+	}
+
+	token, err := config.GetAdminToken()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &AdminService{
+		reloader: reloader,
+		config:   config,
+		token:    token,
+		logger:   &defaultLogger{},
+		done:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+// Start connects to NATS and begins handling admin requests.
+// This method blocks until Stop is called or the context is cancelled.
+func (s *AdminService) Start(ctx context.Context) error {
+	opts := []nats.Option{
+		nats.Name("nauts-admin"),
+	}
+	if s.config.NatsCredentials != "" {
+		opts = append(opts, nats.UserCredentials(s.config.NatsCredentials))
+	} else if s.config.NatsNkey != "" {
+		opt, err := nats.NkeyOptionFromSeed(s.config.NatsNkey)
+		if err != nil {
+			return fmt.Errorf("loading nkey from %s: %w", s.config.NatsNkey, err)
+		}
+		opts = append(opts, opt)
+	}
+
+	nc, err := nats.Connect(s.config.NatsURL, opts...)
+	if err != nil {
+		return fmt.Errorf("connecting to NATS: %w", err)
+	}
+	s.nc = nc
+
+	handlers := map[string]nats.MsgHandler{
+		AdminHistorySubject:  s.handleHistoryRequest,
+		AdminRollbackSubject: s.handleRollbackRequest,
+		AdminStatsSubject:    s.handleStatsRequest,
+	}
+	// Writes to the policy store require the admin token.
+	if s.token != "" {
+		handlers[AdminPolicySubjectPrefix+"*"] = s.handleStoreRequest
+		handlers[AdminBindingSubjectPrefix+"*"] = s.handleStoreRequest
+		handlers[AdminRevokeSubject] = s.handleRevokeRequest
+		handlers[AdminRevocationsSubject] = s.handleRevokeRequest
+		if s.pending != nil {
+			handlers[AdminPendingSubjectPrefix+"*"] = s.handlePendingRequest
+		}
+	}
+	for subject, handler := range handlers {
+		sub, err := nc.Subscribe(subject, handler)
+		if err != nil {
+			nc.Close()
+			return fmt.Errorf("subscribing to %s: %w", subject, err)
+		}
+		s.subs = append(s.subs, sub)
+	}
+
+	s.logger.Info("admin service started, listening on %s, %s and %s", AdminHistorySubject, AdminRollbackSubject, AdminStatsSubject)
+	if s.token != "" {
+		s.logger.Info("policy and binding management enabled on %s* and %s*", AdminPolicySubjectPrefix, AdminBindingSubjectPrefix)
+		if s.revocations != nil {
+			s.logger.Info("token revocation enabled on %s and %s", AdminRevokeSubject, AdminRevocationsSubject)
+		}
+		if s.pending != nil {
+			s.logger.Info("binding requests enabled on %s*", AdminPendingSubjectPrefix)
+		}
+	} else {
+		s.logger.Info("policy and binding management and token revocation disabled: server.admin.tokenFile is not set")
+	}
+
+	select {
+	case <-ctx.Done():
+		s.logger.Info("context cancelled, shutting down")
+	case <-s.done:
+		s.logger.Info("stop requested, shutting down")
+	}
+
+	return s.shutdown()
+}
+
+// Stop signals the service to shut down gracefully.
+func (s *AdminService) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	return nil
+}
+
+// shutdown performs graceful shutdown.
+func (s *AdminService) shutdown() error {
+	for _, sub := range s.subs {
+		if err := sub.Drain(); err != nil {
+			s.logger.Warn("error draining subscription: %v", err)
+		}
+	}
+
+	s.wg.Wait()
+
+	if s.nc != nil {
+		s.nc.Close()
+	}
+
+	s.logger.Info("admin service stopped")
+	return nil
+}
+
+// AdminResponse is the reply to admin requests.
+type AdminResponse struct {
+	// RolledBackTo is the generation now served after a rollback.
+	RolledBackTo *ReloadEntry `json:"rolled_back_to,omitempty"`
+	Status       ReloadStatus `json:"status"`
+	// Stats are the per-account statistics of the current controller, returned
+	// for stats requests.
+	Stats []AccountStatsSnapshot `json:"stats,omitempty"`
+	// Revoked is the revoked token, returned for revoke requests.
+	Revoked *RevokedToken `json:"revoked,omitempty"`
+	// Revocations are all revoked tokens, returned for revocations requests.
+	Revocations []RevokedToken `json:"revocations,omitempty"`
+	Error       *AdminError    `json:"error,omitempty"`
+}
+
+// AdminStatsRequest is the optional payload of a stats request.
+type AdminStatsRequest struct {
+	// Account limits the statistics to one account. Default: all accounts.
+	Account string `json:"account,omitempty"`
+}
+
+// AdminError describes a failed admin request.
+type AdminError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// handleHistoryRequest responds with the reload status.
+func (s *AdminService) handleHistoryRequest(msg *nats.Msg) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	if err := s.authorize(msg.Header); err != nil {
+		s.respond(msg, AdminResponse{Error: err})
+		return
+	}
+	s.respond(msg, AdminResponse{Status: s.reloader.Status()})
+}
+
+// handleRollbackRequest rolls back to the previous configuration.
+func (s *AdminService) handleRollbackRequest(msg *nats.Msg) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	if err := s.authorize(msg.Header); err != nil {
+		s.respond(msg, AdminResponse{Error: err})
+		return
+	}
+	resp := AdminResponse{}
+	entry, err := s.reloader.Rollback()
+	if err != nil {
+		resp.Error = &AdminError{Code: "rollback_failed", Message: err.Error()}
+	} else {
+		resp.RolledBackTo = &entry
+		s.logger.Info("rolled back to configuration generation %d loaded from %s at %s", entry.Generation, entry.Source, entry.LoadedAt)
+	}
+	resp.Status = s.reloader.Status()
+	s.respond(msg, resp)
+}
+
+// handleStatsRequest responds with the per-account statistics of the current
+// controller. They are carried over on reload, so they cover the process
+// lifetime.
+func (s *AdminService) handleStatsRequest(msg *nats.Msg) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	if err := s.authorize(msg.Header); err != nil {
+		s.respond(msg, AdminResponse{Error: err})
+		return
+	}
+	resp := AdminResponse{Status: s.reloader.Status()}
+	var req AdminStatsRequest
+	if len(msg.Data) > 0 {
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			resp.Error = &AdminError{Code: "invalid_request", Message: fmt.Sprintf("decoding stats request: %v", err)}
+			s.respond(msg, resp)
+			return
+		}
+	}
+	if stats := s.reloader.Current().AccountStats(); stats != nil {
+		for _, snap := range stats.Snapshot() {
+			if req.Account == "" || snap.Account == req.Account {
+				resp.Stats = append(resp.Stats, snap)
+			}
+		}
+	}
+	s.respond(msg, resp)
+}
+
+// authorize checks the admin token of a request. Without a configured token,
+// every request is accepted.
+func (s *AdminService) authorize(header nats.Header) *AdminError {
+	if s.token == "" {
+		return nil
+	}
+	if subtle.ConstantTimeCompare([]byte(header.Get(AdminTokenHeader)), []byte(s.token)) != 1 {
+		return &AdminError{Code: "unauthorized", Message: "missing or invalid " + AdminTokenHeader + " header"}
+	}
+	return nil
+}
+
+func (s *AdminService) respond(msg *nats.Msg, resp AdminResponse) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		s.logger.Warn("failed to encode admin response: %v", err)
+		return
+	}
+	if err := msg.Respond(data); err != nil {
+		s.logger.Warn("failed to send admin response: %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/provider"
+)
+
+// AdminPendingSubjectPrefix prefixes the binding request subjects:
+// nauts.admin.pending.{request,list,approve,reject}. Requests need no admin
+// token, so restrict nauts.admin.pending.request with NATS permissions to the
+// users allowed to ask for access; the other operations require the token.
+const AdminPendingSubjectPrefix = "nauts.admin.pending."
+
+// WithAdminPendingBindings enables the binding request subjects on pending.
+func WithAdminPendingBindings(pending *PendingBindings) AdminOption {
+	return func(s *AdminService) {
+		s.pending = pending
+	}
+}
+
+// handlePendingRequest serves the binding request subjects.
+func (s *AdminService) handlePendingRequest(msg *nats.Msg) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	resp := s.servePendingRequest(msg.Subject, msg.Header, msg.Data)
+	data, err := json.Marshal(resp)
+	if err != nil {
+		s.logger.Warn("failed to encode admin response: %v", err)
+		return
+	}
+	if err := msg.Respond(data); err != nil {
+		s.logger.Warn("failed to send admin response: %v", err)
+	}
+}
+
+// servePendingRequest authorizes and executes a binding request operation.
+func (s *AdminService) servePendingRequest(subject string, header nats.Header, data []byte) AdminStoreResponse {
+	if subject != AdminPendingSubjectPrefix+"request" {
+		if err := s.authorize(header); err != nil {
+			return AdminStoreResponse{Error: err}
+		}
+	}
+	if s.pending == nil {
+		return storeError("pending_bindings_disabled", errors.New("server.admin.pendingBindings is not configured"))
+	}
+
+	var req AdminStoreRequest
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &req); err != nil {
+			return storeError("invalid_request", fmt.Errorf("decoding request: %w", err))
+		}
+	}
+
+	var resp AdminStoreResponse
+	s.reloader.withCurrent(func(controller *AuthController) {
+		resp = s.pendingOperation(controller, subject, req)
+	})
+	return resp
+}
+
+// pendingOperation executes a decoded binding request operation.
+func (s *AdminService) pendingOperation(controller *AuthController, subject string, req AdminStoreRequest) AdminStoreResponse {
+	store, ok := controller.PolicyStore()
+	if !ok {
+		return storeError("store_unavailable", errors.New("the configured policy provider does not support writes"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), adminStoreTimeout)
+	defer cancel()
+
+	var resp AdminStoreResponse
+	var err error
+	switch subject {
+	case AdminPendingSubjectPrefix + "request":
+		if req.Binding == nil || req.RequestedBy == "" {
+			return storeError("invalid_request", errors.New("binding and requestedBy are required"))
+		}
+		if err := s.checkAccount(ctx, controller, req.Binding.Account); err != nil {
+			return storeError("invalid_request", err)
+		}
+		if err := checkBindingPolicies(ctx, store, req.Binding); err != nil {
+			return storeError("invalid_request", err)
+		}
+		var pending *PendingBinding
+		if pending, err = s.pending.Request(ctx, req.Binding, req.RequestedBy, req.Reason); err == nil {
+			resp.Pending = []*PendingBinding{pending}
+			s.logger.Info("admin: %s requested binding %s", req.RequestedBy, req.Binding.IdentityRole())
+		}
+	case AdminPendingSubjectPrefix + "list":
+		resp.Pending, err = s.pending.List(ctx, req.Account)
+	case AdminPendingSubjectPrefix + "approve":
+		if req.Account == "" || req.Role == "" {
+			return storeError("invalid_request", errors.New("account and role are required"))
+		}
+		role := identity.Role{Account: req.Account, Name: req.Role}
+		var pending *PendingBinding
+		if pending, err = s.pending.Get(ctx, role); err != nil {
+			break
+		}
+		// The account or policies may have changed since the request.
+		if err := s.checkAccount(ctx, controller, pending.Binding.Account); err != nil {
+			return storeError("invalid_request", err)
+		}
+		if err := checkBindingPolicies(ctx, store, pending.Binding); err != nil {
+			return storeError("invalid_request", err)
+		}
+		if err = store.PutBinding(ctx, pending.Binding); err != nil {
+			break
+		}
+		if err = s.pending.Remove(ctx, role); err == nil {
+			resp.Binding = pending.Binding
+			resp.Pending = []*PendingBinding{pending}
+			s.logger.Info("admin: approved binding %s requested by %s", role, pending.RequestedBy)
+		}
+	case AdminPendingSubjectPrefix + "reject":
+		if req.Account == "" || req.Role == "" {
+			return storeError("invalid_request", errors.New("account and role are required"))
+		}
+		role := identity.Role{Account: req.Account, Name: req.Role}
+		var pending *PendingBinding
+		if pending, err = s.pending.Get(ctx, role); err != nil {
+			break
+		}
+		if err = s.pending.Remove(ctx, role); err == nil {
+			resp.Pending = []*PendingBinding{pending}
+			s.logger.Info("admin: rejected binding %s requested by %s: %s", role, pending.RequestedBy, req.Reason)
+		}
+	default:
+		return storeError("invalid_request", fmt.Errorf("unknown operation %q", strings.TrimPrefix(subject, "nauts.admin.")))
+	}
+
+	switch {
+	case errors.Is(err, ErrPendingBindingNotFound):
+		return storeError("not_found", err)
+	case err != nil:
+		s.logger.Warn("admin: %s failed: %v", subject, err)
+		return storeError("store_error", err)
+	}
+	return resp
+}
+
+// checkBindingPolicies rejects bindings referencing policies that do not
+// exist, so that approvers see mistakes before granting access.
+func checkBindingPolicies(ctx context.Context, store provider.PolicyStore, b *provider.Binding) error {
+	if err := b.Validate(); err != nil {
+		return err
+	}
+	for _, id := range b.Policies {
+		_, err := store.GetPolicy(ctx, b.Account, strings.TrimSpace(id))
+		if errors.Is(err, provider.ErrPolicyNotFound) {
+			return fmt.Errorf("binding %s references unknown policy %q", b.IdentityRole(), id)
+		}
+		if err != nil {
+			return fmt.Errorf("getting policy %s: %w", id, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// AdminRevokeSubject is the NATS subject for token revocation requests.
+	AdminRevokeSubject = "nauts.admin.revoke"
+
+	// AdminRevocationsSubject is the NATS subject for listing revoked tokens.
+	AdminRevocationsSubject = "nauts.admin.revocations"
+)
+
+// AdminRevokeRequest is the payload of a revocation request.
+type AdminRevokeRequest struct {
+	// ID is the jti claim of the JWT to revoke, e.g. from the audit log.
+	ID     string `json:"jti"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// WithAdminRevocationList enables the revocation subjects on list.
+func WithAdminRevocationList(list *RevocationList) AdminOption {
+	return func(s *AdminService) {
+		s.revocations = list
+	}
+}
+
+// handleRevokeRequest serves the revoke and revocations subjects.
+func (s *AdminService) handleRevokeRequest(msg *nats.Msg) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	s.respond(msg, s.serveRevokeRequest(msg.Subject, msg.Header, msg.Data))
+}
+
+// serveRevokeRequest authorizes and executes a revocation request.
+func (s *AdminService) serveRevokeRequest(subject string, header nats.Header, data []byte) AdminResponse {
+	if err := s.authorize(header); err != nil {
+		return AdminResponse{Error: err}
+	}
+	if s.revocations == nil {
+		return AdminResponse{Error: &AdminError{Code: "revocation_disabled", Message: "server.revocation is not configured"}}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), adminStoreTimeout)
+	defer cancel()
+
+	var resp AdminResponse
+	switch subject {
+	case AdminRevokeSubject:
+		var req AdminRevokeRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			return AdminResponse{Error: &AdminError{Code: "invalid_request", Message: fmt.Sprintf("decoding revoke request: %v", err)}}
+		}
+		if req.ID == "" {
+			return AdminResponse{Error: &AdminError{Code: "invalid_request", Message: "jti is required"}}
+		}
+		revoked, err := s.revocations.Revoke(ctx, req.ID, req.Reason)
+		switch {
+		case errors.Is(err, ErrTokenNotTracked):
+			return AdminResponse{Error: &AdminError{Code: "not_found", Message: err.Error()}}
+		case err != nil:
+			s.logger.Warn("admin: revoking %s failed: %v", req.ID, err)
+			return AdminResponse{Error: &AdminError{Code: "revocation_error", Message: err.Error()}}
+		}
+		resp.Revoked = revoked
+		s.logger.Info("admin: revoked token %s of %s in account %s", revoked.ID, revoked.UserID, revoked.Account)
+	case AdminRevocationsSubject:
+		revoked, err := s.revocations.Revoked(ctx)
+		if err != nil {
+			return AdminResponse{Error: &AdminError{Code: "revocation_error", Message: err.Error()}}
+		}
+		resp.Revocations = revoked
+	default:
+		return AdminResponse{Error: &AdminError{Code: "invalid_request", Message: fmt.Sprintf("unknown subject %q", subject)}}
+	}
+	return resp
+}
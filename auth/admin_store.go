@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/policy"
+	"github.com/msimon/nauts/provider"
+)
+
+const (
+	// AdminPolicySubjectPrefix prefixes the policy management subjects:
+	// nauts.admin.policy.{list,get,put,delete}.
+	AdminPolicySubjectPrefix = "nauts.admin.policy."
+
+	// AdminBindingSubjectPrefix prefixes the binding management subjects:
+	// nauts.admin.binding.{list,get,put,delete}.
+	AdminBindingSubjectPrefix = "nauts.admin.binding."
+
+	// AdminTokenHeader is the header carrying the admin token (server.admin.tokenFile).
+	AdminTokenHeader = "Nauts-Admin-Token"
+
+	// adminStoreTimeout bounds a single policy store operation.
+	adminStoreTimeout = 10 * time.Second
+)
+
+// AdminStoreRequest is the payload of a policy or binding management request.
+type AdminStoreRequest struct {
+	// Account selects the account for list, get and delete. For policy list,
+	// an empty account lists the policies of all accounts; global policies
+	// use "*".
+	Account string `json:"account,omitempty"`
+	// ID is the policy ID for policy get and delete.
+	ID string `json:"id,omitempty"`
+	// Role is the role name for binding get and delete.
+	Role string `json:"role,omitempty"`
+	// Policy is the policy to create or replace (policy put).
+	Policy *policy.Policy `json:"policy,omitempty"`
+	// Binding is the binding to create or replace (binding put) or to
+	// request (pending request).
+	Binding *provider.Binding `json:"binding,omitempty"`
+	// RequestedBy identifies the requester of a pending binding.
+	RequestedBy string `json:"requestedBy,omitempty"`
+	// Reason explains a binding request or its rejection.
+	Reason string `json:"reason,omitempty"`
+}
+
+// AdminStoreResponse is the reply to a policy or binding management request.
+type AdminStoreResponse struct {
+	Policy   *policy.Policy      `json:"policy,omitempty"`
+	Policies []*policy.Policy    `json:"policies,omitempty"`
+	Binding  *provider.Binding   `json:"binding,omitempty"`
+	Bindings []*provider.Binding `json:"bindings,omitempty"`
+	Pending  []*PendingBinding   `json:"pending,omitempty"`
+	Error    *AdminError         `json:"error,omitempty"`
+}
+
+// handleStoreRequest serves the policy and binding management subjects.
+func (s *AdminService) handleStoreRequest(msg *nats.Msg) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	resp := s.serveStoreRequest(msg.Subject, msg.Header, msg.Data)
+	data, err := json.Marshal(resp)
+	if err != nil {
+		s.logger.Warn("failed to encode admin response: %v", err)
+		return
+	}
+	if err := msg.Respond(data); err != nil {
+		s.logger.Warn("failed to send admin response: %v", err)
+	}
+}
+
+// serveStoreRequest authorizes and executes a management request against the
+// policy store of the current controller.
+func (s *AdminService) serveStoreRequest(subject string, header nats.Header, data []byte) AdminStoreResponse {
+	if err := s.authorize(header); err != nil {
+		return AdminStoreResponse{Error: err}
+	}
+
+	var req AdminStoreRequest
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &req); err != nil {
+			return storeError("invalid_request", fmt.Errorf("decoding request: %w", err))
+		}
+	}
+
+	var resp AdminStoreResponse
+	s.reloader.withCurrent(func(controller *AuthController) {
+		resp = s.storeOperation(controller, subject, req)
+	})
+	return resp
+}
+
+// storeOperation executes a decoded management request.
+func (s *AdminService) storeOperation(controller *AuthController, subject string, req AdminStoreRequest) AdminStoreResponse {
+	store, ok := controller.PolicyStore()
+	if !ok {
+		return storeError("store_unavailable", errors.New("the configured policy provider does not support writes"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), adminStoreTimeout)
+	defer cancel()
+
+	var resp AdminStoreResponse
+	var err error
+	switch subject {
+	case AdminPolicySubjectPrefix + "list":
+		if req.Account == "" {
+			resp.Policies, err = store.ListPolicies(ctx)
+		} else {
+			resp.Policies, err = store.GetPolicies(ctx, req.Account)
+		}
+	case AdminPolicySubjectPrefix + "get":
+		if req.Account == "" || req.ID == "" {
+			return storeError("invalid_request", errors.New("account and id are required"))
+		}
+		resp.Policy, err = store.GetPolicy(ctx, req.Account, req.ID)
+	case AdminPolicySubjectPrefix + "put":
+		if req.Policy == nil {
+			return storeError("invalid_request", errors.New("policy is required"))
+		}
+		if err := s.checkAccount(ctx, controller, req.Policy.Account); err != nil {
+			return storeError("invalid_request", err)
+		}
+		if err := req.Policy.Validate(); err != nil {
+			return storeError("invalid_request", err)
+		}
+		if err = store.PutPolicy(ctx, req.Policy); err == nil {
+			resp.Policy = req.Policy
+			s.logger.Info("admin: put policy %s/%s", req.Policy.Account, req.Policy.ID)
+		}
+	case AdminPolicySubjectPrefix + "delete":
+		if req.Account == "" || req.ID == "" {
+			return storeError("invalid_request", errors.New("account and id are required"))
+		}
+		if err = store.DeletePolicy(ctx, req.Account, req.ID); err == nil {
+			s.logger.Info("admin: deleted policy %s/%s", req.Account, req.ID)
+		}
+	case AdminBindingSubjectPrefix + "list":
+		if req.Account == "" {
+			resp.Bindings, err = store.ListBindings(ctx)
+		} else {
+			resp.Bindings, err = store.GetBindings(ctx, req.Account)
+		}
+	case AdminBindingSubjectPrefix + "get":
+		if req.Account == "" || req.Role == "" {
+			return storeError("invalid_request", errors.New("account and role are required"))
+		}
+		resp.Binding, err = store.GetBinding(ctx, identity.Role{Account: req.Account, Name: req.Role})
+	case AdminBindingSubjectPrefix + "put":
+		if req.Binding == nil {
+			return storeError("invalid_request", errors.New("binding is required"))
+		}
+		if err := s.checkAccount(ctx, controller, req.Binding.Account); err != nil {
+			return storeError("invalid_request", err)
+		}
+		if err := req.Binding.Validate(); err != nil {
+			return storeError("invalid_request", err)
+		}
+		if err = store.PutBinding(ctx, req.Binding); err == nil {
+			resp.Binding = req.Binding
+			s.logger.Info("admin: put binding %s", req.Binding.IdentityRole())
+		}
+	case AdminBindingSubjectPrefix + "delete":
+		if req.Account == "" || req.Role == "" {
+			return storeError("invalid_request", errors.New("account and role are required"))
+		}
+		role := identity.Role{Account: req.Account, Name: req.Role}
+		if err = store.DeleteBinding(ctx, role); err == nil {
+			s.logger.Info("admin: deleted binding %s", role)
+		}
+	default:
+		return storeError("invalid_request", fmt.Errorf("unknown operation %q", strings.TrimPrefix(subject, "nauts.admin.")))
+	}
+
+	switch {
+	case errors.Is(err, provider.ErrPolicyNotFound), errors.Is(err, provider.ErrRoleNotFound):
+		return storeError("not_found", err)
+	case err != nil:
+		s.logger.Warn("admin: %s failed: %v", subject, err)
+		return storeError("store_error", err)
+	}
+	return resp
+}
+
+// checkAccount rejects writes for accounts the account provider does not
+// know. Global policies (account "*") are always accepted.
+func (s *AdminService) checkAccount(ctx context.Context, controller *AuthController, account string) error {
+	if account == "*" {
+		return nil
+	}
+	if _, err := controller.AccountProvider().GetAccount(ctx, account); err != nil {
+		return fmt.Errorf("unknown account %q", account)
+	}
+	return nil
+}
+
+func storeError(code string, err error) AdminStoreResponse {
+	return AdminStoreResponse{Error: &AdminError{Code: code, Message: err.Error()}}
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/msimon/nauts/policy"
+	"github.com/msimon/nauts/provider"
+)
+
+func newTestAdminService(t *testing.T) *AdminService {
+	t.Helper()
+	return &AdminService{
+		reloader: NewReloader(createTestController(t), "test", 0),
+		token:    "s3cret",
+		logger:   &testLogger{},
+		done:     make(chan struct{}),
+	}
+}
+
+func adminStoreRequest(t *testing.T, s *AdminService, op string, req AdminStoreRequest) AdminStoreResponse {
+	t.Helper()
+	data, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("encoding request: %v", err)
+	}
+	return s.serveStoreRequest(op, nats.Header{AdminTokenHeader: []string{"s3cret"}}, data)
+}
+
+func TestAdminService_StoreRequiresToken(t *testing.T) {
+	s := newTestAdminService(t)
+
+	tests := []struct {
+		name   string
+		header nats.Header
+	}{
+		{name: "missing header", header: nil},
+		{name: "wrong token", header: nats.Header{AdminTokenHeader: []string{"wrong"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := s.serveStoreRequest(AdminPolicySubjectPrefix+"list", tt.header, nil)
+			if resp.Error == nil || resp.Error.Code != "unauthorized" {
+				t.Fatalf("error = %+v, want unauthorized", resp.Error)
+			}
+		})
+	}
+}
+
+func TestAdminService_ManagePolicies(t *testing.T) {
+	s := newTestAdminService(t)
+
+	pol := &policy.Policy{
+		ID:      "allow-orders",
+		Account: "test-account",
+		Name:    "Orders",
+		Statements: []policy.Statement{{
+			Effect:    policy.EffectAllow,
+			Actions:   []policy.Action{"nats.sub"},
+			Resources: []string{"nats:orders.>"},
+		}},
+	}
+	resp := adminStoreRequest(t, s, AdminPolicySubjectPrefix+"put", AdminStoreRequest{Policy: pol})
+	if resp.Error != nil {
+		t.Fatalf("put: %+v", resp.Error)
+	}
+
+	resp = adminStoreRequest(t, s, AdminPolicySubjectPrefix+"get", AdminStoreRequest{Account: "test-account", ID: "allow-orders"})
+	if resp.Error != nil || resp.Policy == nil || resp.Policy.Name != "Orders" {
+		t.Fatalf("get = %+v", resp)
+	}
+
+	resp = adminStoreRequest(t, s, AdminPolicySubjectPrefix+"list", AdminStoreRequest{Account: "test-account"})
+	if resp.Error != nil || len(resp.Policies) != 2 {
+		t.Fatalf("list = %+v, want 2 policies", resp)
+	}
+
+	resp = adminStoreRequest(t, s, AdminPolicySubjectPrefix+"delete", AdminStoreRequest{Account: "test-account", ID: "allow-orders"})
+	if resp.Error != nil {
+		t.Fatalf("delete: %+v", resp.Error)
+	}
+
+	resp = adminStoreRequest(t, s, AdminPolicySubjectPrefix+"get", AdminStoreRequest{Account: "test-account", ID: "allow-orders"})
+	if resp.Error == nil || resp.Error.Code != "not_found" {
+		t.Fatalf("get after delete: error = %+v, want not_found", resp.Error)
+	}
+}
+
+func TestAdminService_ManageBindings(t *testing.T) {
+	s := newTestAdminService(t)
+
+	binding := &provider.Binding{Role: "readers", Account: "test-account", Policies: []string{"allow-basic"}}
+	resp := adminStoreRequest(t, s, AdminBindingSubjectPrefix+"put", AdminStoreRequest{Binding: binding})
+	if resp.Error != nil {
+		t.Fatalf("put: %+v", resp.Error)
+	}
+
+	resp = adminStoreRequest(t, s, AdminBindingSubjectPrefix+"get", AdminStoreRequest{Account: "test-account", Role: "readers"})
+	if resp.Error != nil || resp.Binding == nil || len(resp.Binding.Policies) != 1 {
+		t.Fatalf("get = %+v", resp)
+	}
+
+	resp = adminStoreRequest(t, s, AdminBindingSubjectPrefix+"list", AdminStoreRequest{})
+	if resp.Error != nil || len(resp.Bindings) != 3 {
+		t.Fatalf("list = %+v, want 3 bindings", resp)
+	}
+
+	resp = adminStoreRequest(t, s, AdminBindingSubjectPrefix+"delete", AdminStoreRequest{Account: "test-account", Role: "readers"})
+	if resp.Error != nil {
+		t.Fatalf("delete: %+v", resp.Error)
+	}
+}
+
+func TestAdminService_StoreInvalidRequests(t *testing.T) {
+	s := newTestAdminService(t)
+
+	tests := []struct {
+		name string
+		op   string
+		req  AdminStoreRequest
+		code string
+	}{
+		{
+			name: "unknown account",
+			op:   AdminBindingSubjectPrefix + "put",
+			req:  AdminStoreRequest{Binding: &provider.Binding{Role: "r", Account: "other", Policies: []string{"p"}}},
+			code: "invalid_request",
+		},
+		{
+			name: "missing policy",
+			op:   AdminPolicySubjectPrefix + "put",
+			code: "invalid_request",
+		},
+		{
+			name: "missing id",
+			op:   AdminPolicySubjectPrefix + "get",
+			req:  AdminStoreRequest{Account: "test-account"},
+			code: "invalid_request",
+		},
+		{
+			name: "unknown operation",
+			op:   AdminPolicySubjectPrefix + "rename",
+			code: "invalid_request",
+		},
+		{
+			name: "missing binding",
+			op:   AdminBindingSubjectPrefix + "get",
+			req:  AdminStoreRequest{Account: "test-account", Role: "nobody"},
+			code: "not_found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := adminStoreRequest(t, s, tt.op, tt.req)
+			if resp.Error == nil || resp.Error.Code != tt.code {
+				t.Fatalf("error = %+v, want %s", resp.Error, tt.code)
+			}
+		})
+	}
+}
+
+func TestAdminService_AuthorizeWithoutToken(t *testing.T) {
+	s := &AdminService{}
+	if err := s.authorize(nil); err != nil {
+		t.Errorf("authorize() without token = %+v, want nil", err)
+	}
+}
@@ -0,0 +1,403 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/policy"
+)
+
+// Audit event results.
+const (
+	AuditResultSuccess = "success"
+	AuditResultFailure = "failure"
+)
+
+// ErrAuditChainBroken is returned by VerifyAuditChain when records were
+// modified, removed, or reordered.
+var ErrAuditChainBroken = errors.New("audit chain broken")
+
+// AuditEvent is the audit record of one Authenticate call.
+//
+// Records form a hash chain: Hash is the SHA-256 of PrevHash and the record
+// encoded without Hash, so modifying, removing, or reordering records is
+// detected by VerifyAuditChain.
+type AuditEvent struct {
+	Seq    uint64    `json:"seq"`
+	Time   time.Time `json:"time"`
+	Result string    `json:"result"`
+	UserID string    `json:"user_id,omitempty"`
+	// RawUserID is the user ID returned by the provider, if UserIDNormalizer
+	// changed it.
+	RawUserID string `json:"raw_user_id,omitempty"`
+	Account   string `json:"account,omitempty"`
+	Provider  string `json:"provider,omitempty"`
+	// TokenID is the jti claim of the issued JWT, for revocation.
+	TokenID string `json:"jti,omitempty"`
+	// ProviderSelection explains why Provider was chosen, or why none was.
+	ProviderSelection *identity.ProviderSelection `json:"provider_selection,omitempty"`
+	Roles             []string                    `json:"roles,omitempty"`
+	// ExpiredBindings lists roles of the user skipped because their binding expired.
+	ExpiredBindings []string          `json:"expired_bindings,omitempty"`
+	Permissions     *AuditPermissions `json:"permissions,omitempty"`
+	// PermissionDiff lists the permissions that changed since the last token
+	// issued to the user. It is only set when a token tracker remembers
+	// issuances and the permissions changed.
+	PermissionDiff *AuditPermissionDiff `json:"permission_diff,omitempty"`
+	// Shadow is set for authentications in shadow mode, whose result was not
+	// returned to the client.
+	Shadow bool `json:"shadow,omitempty"`
+	// Phase is the step of the authentication flow that failed.
+	Phase    string `json:"phase,omitempty"`
+	Error    string `json:"error,omitempty"`
+	PrevHash string `json:"prev_hash"`
+	Hash     string `json:"hash"`
+}
+
+// AuditPermissions summarizes the permissions granted in the issued JWT.
+type AuditPermissions struct {
+	Pub            int  `json:"pub"`
+	Sub            int  `json:"sub"`
+	PubDeny        int  `json:"pub_deny,omitempty"`
+	SubDeny        int  `json:"sub_deny,omitempty"`
+	AllowResponses bool `json:"allow_responses,omitempty"`
+}
+
+func summarizePermissions(p *policy.NatsPermissions) *AuditPermissions {
+	if p == nil {
+		return nil
+	}
+	return &AuditPermissions{
+		Pub:            len(p.PubList()),
+		Sub:            len(p.SubList()),
+		PubDeny:        len(p.PubDenyList()),
+		SubDeny:        len(p.SubDenyList()),
+		AllowResponses: p.AllowResponses,
+	}
+}
+
+// AuditPermissionDiff lists the subjects added to and removed from the
+// permissions of a user since the previous token issued to them.
+type AuditPermissionDiff struct {
+	// PreviousTokenID is the jti of the previous token.
+	PreviousTokenID string   `json:"previous_jti"`
+	PubAdded        []string `json:"pub_added,omitempty"`
+	PubRemoved      []string `json:"pub_removed,omitempty"`
+	SubAdded        []string `json:"sub_added,omitempty"`
+	SubRemoved      []string `json:"sub_removed,omitempty"`
+	PubDenyAdded    []string `json:"pub_deny_added,omitempty"`
+	PubDenyRemoved  []string `json:"pub_deny_removed,omitempty"`
+	SubDenyAdded    []string `json:"sub_deny_added,omitempty"`
+	SubDenyRemoved  []string `json:"sub_deny_removed,omitempty"`
+	// AllowResponses is the new response permission if it changed.
+	AllowResponses *bool `json:"allow_responses,omitempty"`
+	// Escalated reports whether the user gained permissions: subjects were
+	// allowed, denials lifted, or responses allowed.
+	Escalated bool `json:"escalated"`
+}
+
+// diffIssuedPermissions returns the permission changes from previous to
+// current, or nil if previous is unknown or the permissions are equal.
+func diffIssuedPermissions(previous, current *IssuedToken) *AuditPermissionDiff {
+	if previous == nil || previous.Permissions == nil || current.Permissions == nil {
+		return nil
+	}
+	prev, cur := previous.Permissions, current.Permissions
+	d := &AuditPermissionDiff{PreviousTokenID: previous.ID}
+	d.PubAdded, d.PubRemoved = diffSubjects(prev.Pub.Allow, cur.Pub.Allow)
+	d.SubAdded, d.SubRemoved = diffSubjects(prev.Sub.Allow, cur.Sub.Allow)
+	d.PubDenyAdded, d.PubDenyRemoved = diffSubjects(prev.Pub.Deny, cur.Pub.Deny)
+	d.SubDenyAdded, d.SubDenyRemoved = diffSubjects(prev.Sub.Deny, cur.Sub.Deny)
+	if allow := cur.Resp != nil; allow != (prev.Resp != nil) {
+		d.AllowResponses = &allow
+	}
+	d.Escalated = len(d.PubAdded) > 0 || len(d.SubAdded) > 0 ||
+		len(d.PubDenyRemoved) > 0 || len(d.SubDenyRemoved) > 0 ||
+		(d.AllowResponses != nil && *d.AllowResponses)
+
+	if !d.Escalated && d.AllowResponses == nil &&
+		len(d.PubRemoved) == 0 && len(d.SubRemoved) == 0 &&
+		len(d.PubDenyAdded) == 0 && len(d.SubDenyAdded) == 0 {
+		return nil
+	}
+	return d
+}
+
+// diffSubjects returns the subjects only in b (added) and only in a (removed).
+func diffSubjects(a, b []string) (added, removed []string) {
+	inA := make(map[string]bool, len(a))
+	for _, s := range a {
+		inA[s] = true
+	}
+	inB := make(map[string]bool, len(b))
+	for _, s := range b {
+		inB[s] = true
+		if !inA[s] {
+			added = append(added, s)
+		}
+	}
+	for _, s := range a {
+		if !inB[s] {
+			removed = append(removed, s)
+		}
+	}
+	return added, removed
+}
+
+// recordAudit completes event with the outcome of Authenticate and records it.
+func (c *AuthController) recordAudit(event *AuditEvent, result *AuthResult, err error) {
+	if err != nil {
+		event.Result = AuditResultFailure
+		event.Error = err.Error()
+		var authErr *AuthError
+		if event.UserID == "" && errors.As(err, &authErr) {
+			event.UserID = authErr.UserID
+		}
+	} else {
+		event.Result = AuditResultSuccess
+		event.Phase = ""
+		event.Permissions = summarizePermissions(result.CompilationResult.Permissions)
+		for _, role := range result.CompilationResult.Roles {
+			event.Roles = append(event.Roles, role.String())
+		}
+	}
+	if err := c.auditLog.Record(event); err != nil {
+		c.logger.Warn("failed to record audit event: %v", err)
+	}
+}
+
+// AuditSink receives encoded audit records, one JSON object per call.
+// Records are written in chain order; sinks need not be safe for concurrent use.
+type AuditSink interface {
+	WriteAudit(record []byte) error
+}
+
+// AuditLog chains audit events and writes them to its sinks. It is safe for
+// concurrent use.
+type AuditLog struct {
+	mu       sync.Mutex
+	sinks    []AuditSink
+	seq      uint64
+	prevHash string
+	now      func() time.Time
+}
+
+// NewAuditLog creates an audit log writing to sinks.
+func NewAuditLog(sinks ...AuditSink) *AuditLog {
+	return &AuditLog{sinks: sinks, now: time.Now}
+}
+
+// Resume continues an existing chain whose last record has the given sequence
+// number and hash, e.g. after a restart.
+func (a *AuditLog) Resume(seq uint64, hash string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.seq = seq
+	a.prevHash = hash
+}
+
+// Record assigns the next sequence number, timestamp, and chain hashes to e and
+// writes it to every sink. Sink errors are joined; the event stays in the chain.
+func (a *AuditLog) Record(e *AuditEvent) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.seq++
+	e.Seq = a.seq
+	e.Time = a.now().UTC()
+	e.PrevHash = a.prevHash
+	hash, err := auditHash(e)
+	if err != nil {
+		return err
+	}
+	e.Hash = hash
+	a.prevHash = hash
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encoding audit event: %w", err)
+	}
+	var errs []error
+	for _, sink := range a.sinks {
+		if err := sink.WriteAudit(data); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes all sinks that implement io.Closer.
+func (a *AuditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var errs []error
+	for _, sink := range a.sinks {
+		if c, ok := sink.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// auditHash returns the chain hash of e, ignoring e.Hash.
+func auditHash(e *AuditEvent) (string, error) {
+	unhashed := *e
+	unhashed.Hash = ""
+	data, err := json.Marshal(&unhashed)
+	if err != nil {
+		return "", fmt.Errorf("encoding audit event: %w", err)
+	}
+	sum := sha256.Sum256(append([]byte(e.PrevHash), data...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// VerifyAuditChain reads newline-delimited audit records from r and checks
+// that every record's hash is intact and links to its predecessor. It returns
+// the number of verified records. The first record may continue an earlier
+// chain (e.g., after log rotation).
+func VerifyAuditChain(r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	n := 0
+	var prev *AuditEvent
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var e AuditEvent
+		if err := json.Unmarshal(line, &e); err != nil {
+			return n, fmt.Errorf("decoding audit record %d: %w", n+1, err)
+		}
+		if prev != nil && (e.Seq != prev.Seq+1 || e.PrevHash != prev.Hash) {
+			return n, fmt.Errorf("%w: record %d does not follow record %d", ErrAuditChainBroken, e.Seq, prev.Seq)
+		}
+		hash, err := auditHash(&e)
+		if err != nil {
+			return n, err
+		}
+		if hash != e.Hash {
+			return n, fmt.Errorf("%w: record %d was modified", ErrAuditChainBroken, e.Seq)
+		}
+		prev = &e
+		n++
+	}
+	if err := scanner.Err(); err != nil {
+		return n, fmt.Errorf("reading audit records: %w", err)
+	}
+	return n, nil
+}
+
+// WriterAuditSink writes newline-delimited JSON records to an io.Writer.
+type WriterAuditSink struct {
+	w io.Writer
+}
+
+// NewWriterAuditSink creates a sink writing JSON lines to w (e.g., os.Stdout).
+func NewWriterAuditSink(w io.Writer) *WriterAuditSink {
+	return &WriterAuditSink{w: w}
+}
+
+// WriteAudit implements AuditSink.
+func (s *WriterAuditSink) WriteAudit(record []byte) error {
+	if _, err := s.w.Write(append(record, '\n')); err != nil {
+		return fmt.Errorf("writing audit record: %w", err)
+	}
+	return nil
+}
+
+// FileAuditSink appends newline-delimited JSON records to a file.
+type FileAuditSink struct {
+	WriterAuditSink
+	f *os.File
+
+	headSeq  uint64
+	headHash string
+}
+
+// OpenFileAuditSink opens path for appending, creating it with mode 0600 if
+// needed. The last record of an existing file is available from Head, so the
+// chain can be resumed.
+func OpenFileAuditSink(path string) (*FileAuditSink, error) {
+	s := &FileAuditSink{}
+	if existing, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(existing)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			var e AuditEvent
+			if json.Unmarshal(scanner.Bytes(), &e) == nil && e.Hash != "" {
+				s.headSeq, s.headHash = e.Seq, e.Hash
+			}
+		}
+		err := scanner.Err()
+		existing.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading audit file: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("opening audit file: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit file: %w", err)
+	}
+	s.f = f
+	s.w = f
+	return s, nil
+}
+
+// Head returns the sequence number and hash of the last record in the file
+// when it was opened. Both are zero for a new file.
+func (s *FileAuditSink) Head() (uint64, string) {
+	return s.headSeq, s.headHash
+}
+
+// Close closes the file.
+func (s *FileAuditSink) Close() error {
+	return s.f.Close()
+}
+
+// NatsAuditSink publishes records to a NATS subject.
+type NatsAuditSink struct {
+	nc      *nats.Conn
+	subject string
+	owned   bool
+}
+
+// NewNatsAuditSink creates a sink publishing records to subject on nc. The
+// connection is not closed by Close.
+func NewNatsAuditSink(nc *nats.Conn, subject string) *NatsAuditSink {
+	return &NatsAuditSink{nc: nc, subject: subject}
+}
+
+// WriteAudit implements AuditSink.
+func (s *NatsAuditSink) WriteAudit(record []byte) error {
+	if err := s.nc.Publish(s.subject, record); err != nil {
+		return fmt.Errorf("publishing audit record to %s: %w", s.subject, err)
+	}
+	return nil
+}
+
+// Close flushes pending records and closes the connection if the sink opened it.
+func (s *NatsAuditSink) Close() error {
+	if !s.owned {
+		return nil
+	}
+	err := s.nc.Flush()
+	s.nc.Close()
+	return err
+}
@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+)
+
+func TestAuditLog_Chain(t *testing.T) {
+	var buf bytes.Buffer
+	log := NewAuditLog(NewWriterAuditSink(&buf))
+
+	for _, user := range []string{"alice", "bob", "carol"} {
+		if err := log.Record(&AuditEvent{Result: AuditResultSuccess, UserID: user}); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	n, err := VerifyAuditChain(bytes.NewReader(buf.Bytes()))
+	if err != nil || n != 3 {
+		t.Fatalf("VerifyAuditChain() = %d, %v, want 3 records", n, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	tests := []struct {
+		name  string
+		lines []string
+	}{
+		{"modified", []string{lines[0], strings.Replace(lines[1], `"bob"`, `"mallory"`, 1), lines[2]}},
+		{"removed", []string{lines[0], lines[2]}},
+		{"reordered", []string{lines[0], lines[2], lines[1]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := VerifyAuditChain(strings.NewReader(strings.Join(tt.lines, "\n")))
+			if !errors.Is(err, ErrAuditChainBroken) {
+				t.Errorf("VerifyAuditChain() error = %v, want ErrAuditChainBroken", err)
+			}
+		})
+	}
+}
+
+func TestFileAuditSink_Resume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	for i := 0; i < 2; i++ {
+		sink, err := OpenFileAuditSink(path)
+		if err != nil {
+			t.Fatalf("OpenFileAuditSink() error = %v", err)
+		}
+		log := NewAuditLog(sink)
+		log.Resume(sink.Head())
+		if err := log.Record(&AuditEvent{Result: AuditResultFailure}); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+		if err := log.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if n, err := VerifyAuditChain(f); err != nil || n != 2 {
+		t.Errorf("VerifyAuditChain() = %d, %v, want 2 chained records across reopen", n, err)
+	}
+}
+
+func TestAuthenticate_Audit(t *testing.T) {
+	ctrl := createTestController(t)
+	var buf bytes.Buffer
+	WithAuditLog(NewAuditLog(NewWriterAuditSink(&buf)))(ctrl)
+
+	ctx := context.Background()
+	if _, err := ctrl.Authenticate(ctx, natsjwt.ConnectOptions{
+		Token: `{"account":"test-account","token":"alice:secret123"}`,
+	}, "", time.Hour); err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if _, err := ctrl.Authenticate(ctx, natsjwt.ConnectOptions{
+		Token: `{"account":"test-account","token":"alice:wrongpassword"}`,
+	}, "", time.Hour); err == nil {
+		t.Fatal("Authenticate() with wrong password succeeded")
+	}
+
+	var events []AuditEvent
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var e AuditEvent
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("decoding audit record: %v", err)
+		}
+		events = append(events, e)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d audit records, want 2", len(events))
+	}
+
+	success := events[0]
+	if success.Result != AuditResultSuccess || success.UserID != "alice" || success.Account != "test-account" || success.Provider != "file" {
+		t.Errorf("success event = %+v", success)
+	}
+	if success.Phase != "" || success.Permissions == nil || len(success.Roles) == 0 {
+		t.Errorf("success event lacks roles or permissions: %+v", success)
+	}
+	if success.ProviderSelection == nil || success.ProviderSelection.Reason != "account_pattern" {
+		t.Errorf("success event provider selection = %+v", success.ProviderSelection)
+	}
+
+	failure := events[1]
+	if failure.Result != AuditResultFailure || failure.Phase != "verify" || failure.Error == "" {
+		t.Errorf("failure event = %+v, want failure in verify", failure)
+	}
+	if failure.PrevHash != success.Hash {
+		t.Error("failure event does not chain to the success event")
+	}
+}
+
+func TestAuthenticate_Shadow(t *testing.T) {
+	ctrl := createTestController(t)
+	var buf bytes.Buffer
+	WithAuditLog(NewAuditLog(NewWriterAuditSink(&buf)))(ctrl)
+	tracker := &recordingTracker{}
+	WithTokenTracker(tracker)(ctrl)
+
+	opts := natsjwt.ConnectOptions{Token: `{"account":"test-account","token":"alice:secret123"}`}
+	if _, err := ctrl.Authenticate(ContextWithShadow(context.Background()), opts, "", time.Hour); err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if _, err := ctrl.Authenticate(context.Background(), opts, "", time.Hour); err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+
+	var events []AuditEvent
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var e AuditEvent
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("decoding audit record: %v", err)
+		}
+		events = append(events, e)
+	}
+	if len(events) != 2 || !events[0].Shadow || events[1].Shadow {
+		t.Errorf("audit events = %+v, want only the first in shadow mode", events)
+	}
+	// The JWT issued in shadow mode is never used, so it is not tracked.
+	if len(tracker.tokens) != 1 || tracker.tokens[0].ID != events[1].TokenID {
+		t.Errorf("tracked tokens = %+v, want only %s", tracker.tokens, events[1].TokenID)
+	}
+}
+
+func TestAuthenticate_AuditPermissionDiff(t *testing.T) {
+	ctrl := createTestController(t)
+	var buf bytes.Buffer
+	WithAuditLog(NewAuditLog(NewWriterAuditSink(&buf)))(ctrl)
+	list := &RevocationList{kv: newMemKV(), now: time.Now}
+	WithTokenTracker(list)(ctrl)
+
+	authenticate := func() AuditEvent {
+		t.Helper()
+		buf.Reset()
+		if _, err := ctrl.Authenticate(context.Background(), natsjwt.ConnectOptions{
+			Token: `{"account":"test-account","token":"alice:secret123"}`,
+		}, "", time.Hour); err != nil {
+			t.Fatalf("Authenticate() error = %v", err)
+		}
+		var e AuditEvent
+		if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &e); err != nil {
+			t.Fatalf("decoding audit record: %v", err)
+		}
+		return e
+	}
+
+	if first := authenticate(); first.PermissionDiff != nil {
+		t.Errorf("first issuance has permission diff %+v", first.PermissionDiff)
+	}
+	if again := authenticate(); again.PermissionDiff != nil {
+		t.Errorf("unchanged reissue has permission diff %+v", again.PermissionDiff)
+	}
+
+	// Narrow the last issuance, as if a policy granted alice more since.
+	last, err := list.LastIssued(context.Background(), "test-account", "alice")
+	if err != nil || last == nil || last.Permissions == nil {
+		t.Fatalf("LastIssued() = %+v, %v", last, err)
+	}
+	granted := last.Permissions.Pub.Allow[0]
+	last.ID = "PREVIOUS"
+	last.Permissions.Pub.Allow = append([]string{"retired.>"}, last.Permissions.Pub.Allow[1:]...)
+	if err := list.Track(context.Background(), *last); err != nil {
+		t.Fatal(err)
+	}
+
+	diff := authenticate().PermissionDiff
+	if diff == nil {
+		t.Fatal("reissue with changed permissions has no permission diff")
+	}
+	if diff.PreviousTokenID != "PREVIOUS" || !diff.Escalated {
+		t.Errorf("diff = %+v, want escalation since PREVIOUS", diff)
+	}
+	if len(diff.PubAdded) != 1 || diff.PubAdded[0] != granted || len(diff.PubRemoved) != 1 || diff.PubRemoved[0] != "retired.>" {
+		t.Errorf("pub added %v, removed %v, want [%s], [retired.>]", diff.PubAdded, diff.PubRemoved, granted)
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/netip"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,11 +14,14 @@ import (
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nkeys"
 
+	"github.com/msimon/nauts/identity"
 	"github.com/msimon/nauts/jwt"
+	"github.com/msimon/nauts/provider"
+	"github.com/msimon/nauts/tracing"
 )
 
 const (
-	// AuthCalloutSubject is the NATS subject for auth callout requests.
+	// AuthCalloutSubject is the default NATS subject for auth callout requests.
 	AuthCalloutSubject = "$SYS.REQ.USER.AUTH"
 
 	// ServerXKeyHeader is the header containing the server's xkey public key.
@@ -42,18 +47,106 @@ type CalloutConfig struct {
 
 	// DefaultTTL is the default JWT time-to-live.
 	DefaultTTL time.Duration
+
+	// ResponseCacheTTL caches signed responses per (user nkey, server id, credentials)
+	// for this long, so that server retries get an identical response without
+	// re-authenticating. 0 disables the cache.
+	ResponseCacheTTL time.Duration
+
+	// Subjects are the subjects on which auth callout requests are received,
+	// for servers configured with non-default callout subjects or for test
+	// harnesses running side by side. Default: [AuthCalloutSubject].
+	Subjects []string
+
+	// DelegateSubject, if set, enables delegate mode: requests whose token is not
+	// a nauts auth request or whose account is unknown to the account provider
+	// are forwarded unchanged to this subject, and the response is relayed back.
+	// This allows taking over accounts from an existing auth service gradually.
+	// The delegate must sign responses with the same issuer and xkey.
+	DelegateSubject string
+
+	// DelegateTimeout bounds forwarded requests. Default: 2s.
+	DelegateTimeout time.Duration
+
+	// PendingMsgsLimit and PendingBytesLimit bound the requests buffered per
+	// callout subscription while the service is busy. Requests beyond the
+	// limits are dropped by the NATS client (slow consumer) and time out at
+	// the server, which retries them. 0 keeps the client defaults, -1 removes
+	// the limit.
+	PendingMsgsLimit  int
+	PendingBytesLimit int
+
+	// SlowConsumerLogInterval is the minimum time between slow consumer
+	// and overload warnings. Default: 10s.
+	SlowConsumerLogInterval time.Duration
+
+	// MaxConcurrentRequests, if positive, handles requests on this many
+	// workers instead of one at a time per subscription. Up to
+	// RequestQueueDepth requests wait for a worker; further requests are
+	// rejected with "too many requests" until the queue has room.
+	MaxConcurrentRequests int
+
+	// RequestQueueDepth bounds the requests waiting for a worker. Default:
+	// DefaultRequestQueueDepth.
+	RequestQueueDepth int
+
+	// AccountRateLimit and UserRateLimit bound the auth requests per account
+	// and per user ID within an account. Throttled requests are rejected with
+	// "too many requests". Zero values disable the limits.
+	AccountRateLimit RateLimit
+	UserRateLimit    RateLimit
+
+	// ErrorDetail appends the failed step and backend to error responses
+	// (e.g. "authentication failed: policy provider: nats: bucket not
+	// found"), so that clients of a development setup see why they were
+	// rejected without reading the service logs. The detail may reveal
+	// internal information and must not be enabled in production.
+	ErrorDetail bool
+
+	// Shadow enables shadow mode: requests are authenticated, logged, and
+	// audited, but clients get the response selected by the mode instead of
+	// the nauts result. ShadowPassthrough requires DelegateSubject. Requests
+	// delegated because nauts does not manage them are not authenticated.
+	Shadow ShadowMode
 }
 
+// ShadowMode selects the response to clients in shadow mode.
+type ShadowMode string
+
+const (
+	// ShadowOff disables shadow mode.
+	ShadowOff ShadowMode = ""
+	// ShadowPassthrough relays the response of the delegate.
+	ShadowPassthrough ShadowMode = "passthrough"
+	// ShadowDeny rejects every request.
+	ShadowDeny ShadowMode = "deny"
+)
+
+// DefaultSlowConsumerLogInterval is the default minimum time between slow
+// consumer warnings.
+const DefaultSlowConsumerLogInterval = 10 * time.Second
+
 // CalloutService handles NATS auth callout requests.
 type CalloutService struct {
-	controller *AuthController
-	config     CalloutConfig
+	controllers *controllerHolder
+	config      CalloutConfig
 
 	curveKeyPair nkeys.KeyPair
+	responses    *responseCache
+	limiter      *RateLimiter
 	nc           *nats.Conn
-	sub          *nats.Subscription
+	subs         []*nats.Subscription
 	logger       Logger
 
+	pusher  *RevocationPusher
+	onReady func()
+
+	statsMu         sync.Mutex
+	slowConsumers   map[string]uint64
+	lastSlowLog     time.Time
+	pool            *requestPool
+	lastOverloadLog time.Time
+
 	done   chan struct{}
 	wg     sync.WaitGroup
 	mu     sync.Mutex
@@ -70,6 +163,23 @@ func WithCalloutLogger(l Logger) CalloutOption {
 	}
 }
 
+// WithRevocationPusher pushes revocations to the servers while the service
+// runs. The pusher is not closed by the service.
+func WithRevocationPusher(p *RevocationPusher) CalloutOption {
+	return func(s *CalloutService) {
+		s.pusher = p
+	}
+}
+
+// WithReadyFunc calls f once the service is subscribed to the callout
+// subjects and the server has confirmed the subscriptions, e.g., to signal
+// readiness to a process manager.
+func WithReadyFunc(f func()) CalloutOption {
+	return func(s *CalloutService) {
+		s.onReady = f
+	}
+}
+
 // NewCalloutService creates a new CalloutService.
 func NewCalloutService(controller *AuthController, config CalloutConfig, opts ...CalloutOption) (*CalloutService, error) {
 	if controller == nil {
@@ -87,6 +197,55 @@ func NewCalloutService(controller *AuthController, config CalloutConfig, opts ..
 	if config.DefaultTTL == 0 {
 		config.DefaultTTL = time.Hour
 	}
+	if config.ResponseCacheTTL < 0 {
+		return nil, errors.New("ResponseCacheTTL must not be negative")
+	}
+	if len(config.Subjects) == 0 {
+		config.Subjects = []string{AuthCalloutSubject}
+	}
+	seen := make(map[string]bool, len(config.Subjects))
+	for _, subject := range config.Subjects {
+		if subject == "" || strings.ContainsAny(subject, " \t\r\n") {
+			return nil, fmt.Errorf("invalid callout subject %q", subject)
+		}
+		if seen[subject] {
+			return nil, fmt.Errorf("duplicate callout subject %q", subject)
+		}
+		seen[subject] = true
+	}
+	if seen[config.DelegateSubject] {
+		return nil, fmt.Errorf("delegate subject %q must differ from the callout subjects", config.DelegateSubject)
+	}
+	if config.DelegateTimeout < 0 {
+		return nil, errors.New("DelegateTimeout must not be negative")
+	}
+	if config.DelegateSubject != "" && config.DelegateTimeout == 0 {
+		config.DelegateTimeout = 2 * time.Second
+	}
+	switch config.Shadow {
+	case ShadowOff, ShadowDeny:
+	case ShadowPassthrough:
+		if config.DelegateSubject == "" {
+			return nil, errors.New("shadow mode passthrough requires DelegateSubject")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported shadow mode %q", config.Shadow)
+	}
+	if config.PendingMsgsLimit < -1 || config.PendingBytesLimit < -1 {
+		return nil, errors.New("PendingMsgsLimit and PendingBytesLimit must be -1 (unlimited) or greater")
+	}
+	if config.SlowConsumerLogInterval < 0 {
+		return nil, errors.New("SlowConsumerLogInterval must not be negative")
+	}
+	if config.SlowConsumerLogInterval == 0 {
+		config.SlowConsumerLogInterval = DefaultSlowConsumerLogInterval
+	}
+	if config.MaxConcurrentRequests < 0 || config.RequestQueueDepth < 0 {
+		return nil, errors.New("MaxConcurrentRequests and RequestQueueDepth must not be negative")
+	}
+	if config.MaxConcurrentRequests > 0 && config.RequestQueueDepth == 0 {
+		config.RequestQueueDepth = DefaultRequestQueueDepth
+	}
 	if config.NatsURL == "" {
 		config.NatsURL = nats.DefaultURL
 	}
@@ -95,10 +254,11 @@ func NewCalloutService(controller *AuthController, config CalloutConfig, opts ..
 	}
 
 	s := &CalloutService{
-		controller: controller,
-		config:     config,
-		logger:     &defaultLogger{},
-		done:       make(chan struct{}),
+		controllers:   newControllerHolder(controller),
+		config:        config,
+		logger:        &defaultLogger{},
+		slowConsumers: make(map[string]uint64),
+		done:          make(chan struct{}),
 	}
 
 	for _, opt := range opts {
@@ -114,15 +274,56 @@ func NewCalloutService(controller *AuthController, config CalloutConfig, opts ..
 		s.curveKeyPair = kp
 	}
 
+	if config.ResponseCacheTTL > 0 {
+		s.responses = newResponseCache(config.ResponseCacheTTL)
+	}
+
+	if config.AccountRateLimit.enabled() || config.UserRateLimit.enabled() {
+		limiter, err := NewRateLimiter(config.AccountRateLimit, config.UserRateLimit)
+		if err != nil {
+			return nil, err
+		}
+		s.limiter = limiter
+	}
+
 	return s, nil
 }
 
+// SetController replaces the controller used for new requests, e.g. after the
+// configuration was reloaded. It blocks until in-flight requests using the
+// previous controller have completed and returns the previous controller, so
+// that the caller can release its resources.
+func (s *CalloutService) SetController(controller *AuthController) *AuthController {
+	prev := s.controllers.swap(controller)
+	if s.responses != nil {
+		s.responses.clear()
+	}
+	return prev
+}
+
+// RateLimitStats returns the throttled request counters per account, or nil
+// if rate limiting is disabled.
+func (s *CalloutService) RateLimitStats() []RateLimitStats {
+	if s.limiter == nil {
+		return nil
+	}
+	return s.limiter.Stats()
+}
+
+// RateLimiter returns the limiter of auth requests, or nil if rate limiting
+// is disabled. The HTTP and gRPC token exchanges share it, so that the
+// limits apply across front-ends.
+func (s *CalloutService) RateLimiter() *RateLimiter {
+	return s.limiter
+}
+
 // Start connects to NATS and begins handling auth callout requests.
 // This method blocks until Stop is called or the context is cancelled.
 func (s *CalloutService) Start(ctx context.Context) error {
 	// Build NATS connection options
 	opts := []nats.Option{
 		nats.Name("nauts-auth-callout"),
+		nats.ErrorHandler(s.handleAsyncError),
 	}
 
 	// Add authentication option
@@ -141,17 +342,80 @@ func (s *CalloutService) Start(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("connecting to NATS: %w", err)
 	}
+	s.statsMu.Lock()
 	s.nc = nc
-
-	// Subscribe to auth callout subject
-	sub, err := nc.Subscribe(AuthCalloutSubject, s.handleRequest)
-	if err != nil {
+	s.statsMu.Unlock()
+
+	// Handle requests on a worker pool if configured
+	handler := s.handleRequest
+	if s.config.MaxConcurrentRequests > 0 {
+		pool := newRequestPool(s.config.MaxConcurrentRequests, s.config.RequestQueueDepth, func(msg *nats.Msg) {
+			defer s.wg.Done()
+			s.handleRequest(msg)
+		})
+		s.statsMu.Lock()
+		s.pool = pool
+		s.statsMu.Unlock()
+		handler = s.dispatch
+	}
+	closeAll := func() {
 		nc.Close()
-		return fmt.Errorf("subscribing to %s: %w", AuthCalloutSubject, err)
+		if s.pool != nil {
+			s.pool.close()
+		}
 	}
-	s.sub = sub
 
-	s.logger.Info("auth callout service started, listening on %s", AuthCalloutSubject)
+	// Subscribe to auth callout subjects
+	for _, subject := range s.config.Subjects {
+		sub, err := nc.Subscribe(subject, handler)
+		if err != nil {
+			closeAll()
+			return fmt.Errorf("subscribing to %s: %w", subject, err)
+		}
+		if err := s.setPendingLimits(sub); err != nil {
+			closeAll()
+			return fmt.Errorf("setting pending limits on %s: %w", subject, err)
+		}
+		s.statsMu.Lock()
+		s.subs = append(s.subs, sub)
+		s.statsMu.Unlock()
+	}
+
+	// Wait until the server has processed the subscriptions, so that
+	// readiness is not reported before auth requests can be routed to us.
+	if err := nc.Flush(); err != nil {
+		closeAll()
+		return fmt.Errorf("confirming subscriptions: %w", err)
+	}
+
+	s.logger.Info("auth callout service started, listening on %s", strings.Join(s.config.Subjects, ", "))
+	if s.pool != nil {
+		s.logger.Info("handling up to %d requests concurrently, queueing up to %d", s.config.MaxConcurrentRequests, s.config.RequestQueueDepth)
+	}
+	if s.config.ErrorDetail {
+		s.logger.Warn("error responses include failure details (server.errorDetail); do not use in production")
+	}
+	if s.config.Shadow != ShadowOff {
+		s.logger.Warn("shadow mode (%s): nauts results are logged and audited but not returned to clients", s.config.Shadow)
+	}
+	if s.onReady != nil {
+		s.onReady()
+	}
+
+	stopPush := func() {}
+	if s.pusher != nil {
+		pushCtx, cancel := context.WithCancel(ctx)
+		stopPush = cancel
+		s.pusher.logger = s.logger
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			if err := s.pusher.Run(pushCtx); err != nil {
+				s.logger.Warn("revocation push stopped: %v", err)
+			}
+		}()
+		s.logger.Info("pushing token revocations to the servers")
+	}
 
 	// Wait for shutdown signal
 	select {
@@ -161,9 +425,19 @@ func (s *CalloutService) Start(ctx context.Context) error {
 		s.logger.Info("stop requested, shutting down")
 	}
 
+	stopPush()
 	return s.shutdown()
 }
 
+// Healthy reports whether the service is subscribed to the callout subjects
+// and its NATS connection is not closed. A reconnecting connection counts as
+// healthy, since the client restores the subscriptions once it is back.
+func (s *CalloutService) Healthy() bool {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	return s.nc != nil && !s.nc.IsClosed() && len(s.subs) == len(s.config.Subjects)
+}
+
 // Stop signals the service to shut down gracefully.
 func (s *CalloutService) Stop() error {
 	s.mu.Lock()
@@ -179,15 +453,18 @@ func (s *CalloutService) Stop() error {
 
 // shutdown performs graceful shutdown.
 func (s *CalloutService) shutdown() error {
-	// Drain subscription to stop receiving new requests
-	if s.sub != nil {
-		if err := s.sub.Drain(); err != nil {
-			s.logger.Warn("error draining subscription: %v", err)
+	// Drain subscriptions to stop receiving new requests
+	for _, sub := range s.subs {
+		if err := sub.Drain(); err != nil {
+			s.logger.Warn("error draining subscription %s: %v", sub.Subject, err)
 		}
 	}
 
-	// Wait for in-flight requests to complete
+	// Wait for in-flight and queued requests to complete
 	s.wg.Wait()
+	if s.pool != nil {
+		s.pool.close()
+	}
 
 	// Close NATS connection
 	if s.nc != nil {
@@ -204,35 +481,69 @@ type ResponseConfig struct {
 	ServerXkey string
 }
 
-// handleRequest processes an auth callout request.
-func (s *CalloutService) handleRequest(msg *nats.Msg) {
+// dispatch queues an auth callout request for the worker pool, or rejects it
+// if the queue is full. It runs on the subscription's delivery goroutine.
+func (s *CalloutService) dispatch(msg *nats.Msg) {
+	// Queued requests count as in flight, so that shutdown waits for them.
 	s.wg.Add(1)
+	if s.pool.submit(msg) {
+		return
+	}
 	defer s.wg.Done()
 
-	ctx := context.Background()
+	s.statsMu.Lock()
+	now := time.Now()
+	shouldLog := now.Sub(s.lastOverloadLog) >= s.config.SlowConsumerLogInterval
+	if shouldLog {
+		s.lastOverloadLog = now
+	}
+	s.statsMu.Unlock()
+	if shouldLog {
+		s.logger.Warn("request queue full (%d requests): rejecting auth requests; consider raising server.maxConcurrentRequests or adding instances", s.config.RequestQueueDepth)
+	}
 
-	// setup response config
-	responseConfig := ResponseConfig{
-		UserNkey:   "",
-		ServerId:   "",
-		ServerXkey: "",
+	controller, release := s.controllers.acquire()
+	defer release()
+	authReq, responseConfig, err := s.decodeRequest(msg)
+	if err != nil {
+		s.logger.Warn("failed to read auth request: %v", err)
+		s.respondWithError(controller, msg, responseConfig, s.errorMessage("authentication failed", err))
+		return
 	}
+	s.logger.Debug("rejecting auth request of server %s: request queue full", authReq.Server.ID)
+	s.respondWithError(controller, msg, responseConfig, "too many requests")
+}
+
+// RequestPoolStats returns the counters of the worker pool, or nil if
+// MaxConcurrentRequests is not set or the service has not started.
+func (s *CalloutService) RequestPoolStats() *RequestPoolStats {
+	s.statsMu.Lock()
+	pool := s.pool
+	s.statsMu.Unlock()
+	if pool == nil {
+		return nil
+	}
+	stats := pool.stats()
+	return &stats
+}
+
+// decodeRequest decrypts, if the service has an xkey, and decodes the auth
+// request in msg. The returned response config is usable for an error
+// response even if decoding fails.
+func (s *CalloutService) decodeRequest(msg *nats.Msg) (*natsjwt.AuthorizationRequestClaims, ResponseConfig, error) {
+	var responseConfig ResponseConfig
 
 	// Extract server xkey from headers
-	serverXKey := ""
 	if msg.Header != nil {
-		serverXKey = msg.Header.Get(ServerXKeyHeader)
+		responseConfig.ServerXkey = msg.Header.Get(ServerXKeyHeader)
 	}
-	responseConfig.ServerXkey = serverXKey
 
 	// Decrypt request if we have an xkey
 	requestData := msg.Data
-	if s.curveKeyPair != nil && serverXKey != "" {
-		decrypted, err := s.curveKeyPair.Open(msg.Data, serverXKey)
+	if s.curveKeyPair != nil && responseConfig.ServerXkey != "" {
+		decrypted, err := s.curveKeyPair.Open(msg.Data, responseConfig.ServerXkey)
 		if err != nil {
-			s.logger.Warn("failed to decrypt request: %v", err)
-			s.respondWithError(msg, responseConfig, "authentication failed")
-			return
+			return nil, responseConfig, fmt.Errorf("decrypting request: %w", err)
 		}
 		requestData = decrypted
 	}
@@ -240,85 +551,242 @@ func (s *CalloutService) handleRequest(msg *nats.Msg) {
 	// Decode auth request claims
 	authReq, err := natsjwt.DecodeAuthorizationRequestClaims(string(requestData))
 	if err != nil {
-		s.logger.Warn("failed to decode auth request: %v", err)
-		s.respondWithError(msg, responseConfig, "authentication failed")
-		return
+		return nil, responseConfig, fmt.Errorf("decoding request: %w", err)
 	}
 	responseConfig.UserNkey = authReq.UserNkey
 	responseConfig.ServerId = authReq.Server.ID
+	return authReq, responseConfig, nil
+}
+
+// handleRequest processes an auth callout request.
+func (s *CalloutService) handleRequest(msg *nats.Msg) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	ctx, span := tracing.Start(context.Background(), "nauts.callout", tracing.String("nats.subject", msg.Subject))
+	defer span.End()
+	controller, release := s.controllers.acquire()
+	defer release()
+
+	authReq, responseConfig, err := s.decodeRequest(msg)
+	if err != nil {
+		s.logger.Warn("failed to read auth request: %v", err)
+		span.SetError(err)
+		s.respondWithError(controller, msg, responseConfig, s.errorMessage("authentication failed", err))
+		return
+	}
+	serverXKey := responseConfig.ServerXkey
+	span.SetAttributes(tracing.String("nats.server_id", authReq.Server.ID))
 
 	s.logger.Debug("auth request received")
 
+	if s.config.DelegateSubject != "" && !s.managesRequest(ctx, controller, authReq) {
+		span.SetAttributes(tracing.Bool("nauts.delegated", true))
+		s.delegate(controller, msg, responseConfig)
+		return
+	}
+
+	if s.config.Shadow != ShadowOff {
+		span.SetAttributes(tracing.Bool("nauts.shadow", true))
+		if s.config.Shadow == ShadowPassthrough {
+			s.delegate(controller, msg, responseConfig)
+		} else {
+			s.respondWithError(controller, msg, responseConfig, "authentication failed")
+		}
+		s.shadow(ctx, controller, authReq)
+		return
+	}
+
+	if s.responses == nil {
+		token, _ := s.authorize(ctx, controller, authReq, responseConfig)
+		s.sendToken(controller, msg, serverXKey, token)
+		return
+	}
+
+	key := responseCacheKey(authReq.UserNkey, authReq.Server.ID, authReq.ConnectOptions)
+	token, shared := s.responses.do(key, func() (string, bool) {
+		return s.authorize(ctx, controller, authReq, responseConfig)
+	})
+	if shared {
+		s.logger.Debug("replaying cached auth response")
+	}
+	span.SetAttributes(tracing.Bool("nauts.response_cached", shared))
+	s.sendToken(controller, msg, serverXKey, token)
+}
+
+// managesRequest reports whether the request targets an account managed by nauts.
+// Tokens that are not nauts auth requests are considered unmanaged. Requests
+// of an unsupported version are nauts requests and handled (and rejected) here.
+func (s *CalloutService) managesRequest(ctx context.Context, controller *AuthController, authReq *natsjwt.AuthorizationRequestClaims) bool {
+	req, err := controller.authRequest(authReq.ConnectOptions)
+	if errors.Is(err, identity.ErrUnsupportedAuthRequestVersion) {
+		return true
+	}
+	if err != nil {
+		return false
+	}
+	_, err = controller.AccountProvider().GetAccount(ctx, req.Account)
+	return !errors.Is(err, provider.ErrAccountNotFound)
+}
+
+// delegate forwards the original (possibly encrypted) request to the delegate
+// subject and relays the response unchanged.
+func (s *CalloutService) delegate(controller *AuthController, msg *nats.Msg, responseConfig ResponseConfig) {
+	s.logger.Debug("delegating auth request to %s", s.config.DelegateSubject)
+	resp, err := s.nc.RequestMsg(&nats.Msg{
+		Subject: s.config.DelegateSubject,
+		Header:  msg.Header,
+		Data:    msg.Data,
+	}, s.config.DelegateTimeout)
+	if err != nil {
+		s.logger.Warn("delegate request to %s failed: %v", s.config.DelegateSubject, err)
+		s.respondWithError(controller, msg, responseConfig, s.errorMessage("authentication failed", fmt.Errorf("delegate: %w", err)))
+		return
+	}
+	s.respond(controller, msg, resp.Data)
+}
+
+// shadow authenticates the request in shadow mode and logs what the response
+// would have been. It runs after the client got its response, so that
+// shadow mode adds no latency to the existing auth system.
+func (s *CalloutService) shadow(ctx context.Context, controller *AuthController, authReq *natsjwt.AuthorizationRequestClaims) {
+	ctx = ContextWithShadow(ctx)
+	if ip, err := netip.ParseAddr(authReq.ClientInformation.Host); err == nil {
+		ctx = ContextWithClientIP(ctx, ip)
+	}
+	ctx = ContextWithClientNonce(ctx, authReq.ClientInformation.Nonce)
+	result, err := controller.Authenticate(ctx, authReq.ConnectOptions, authReq.UserNkey, s.config.DefaultTTL)
+	if err != nil {
+		s.logger.Info("shadow mode: would have rejected the request: %v", err)
+		return
+	}
+	s.logger.Info("shadow mode: would have allowed %s in account %s with roles %v", result.User.ID, result.User.Account, result.CompilationResult.Roles)
+}
+
+// authorize authenticates the request and returns the encoded response token.
+// cacheable is false for responses caused by internal errors, which should be
+// retried rather than replayed. An empty token means no response can be sent.
+func (s *CalloutService) authorize(ctx context.Context, controller *AuthController, authReq *natsjwt.AuthorizationRequestClaims, responseConfig ResponseConfig) (token string, cacheable bool) {
+	// Throttle accounts before doing any work; malformed requests are
+	// rejected by Authenticate.
+	if s.limiter != nil {
+		if req, err := controller.authRequest(authReq.ConnectOptions); err == nil {
+			if err := s.limiter.AllowAccount(req.Account); err != nil {
+				s.logger.Warn("authentication throttled: %v", err)
+				return s.errorResponse(controller, responseConfig, "too many requests"), false
+			}
+		}
+	}
+
 	// Authenticate
-	result, err := s.controller.Authenticate(ctx, authReq.ConnectOptions, authReq.UserNkey, s.config.DefaultTTL)
+	if ip, err := netip.ParseAddr(authReq.ClientInformation.Host); err == nil {
+		ctx = ContextWithClientIP(ctx, ip)
+	}
+	ctx = ContextWithClientNonce(ctx, authReq.ClientInformation.Nonce)
+	result, err := controller.Authenticate(ctx, authReq.ConnectOptions, authReq.UserNkey, s.config.DefaultTTL)
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, identity.ErrProviderUnavailable) {
+		s.logger.Warn("authentication failed: %v", err)
+		return s.errorResponse(controller, responseConfig, s.errorMessage("provider unavailable", err)), false
+	}
 	if err != nil {
 		s.logger.Warn("authentication failed: %v", err)
-		s.respondWithError(msg, responseConfig, "authentication failed")
-		return
+		return s.errorResponse(controller, responseConfig, s.errorMessage("authentication failed", err)), true
+	}
+	if s.limiter != nil {
+		if err := s.limiter.AllowUser(result.User.Account, result.User.ID); err != nil {
+			s.logger.Warn("authentication throttled: %v", err)
+			return s.errorResponse(controller, responseConfig, "too many requests"), false
+		}
 	}
 	// update user public key in response config
 	responseConfig.UserNkey = result.UserPublicKey
 
 	// Get account for IssuerAccount
-	account, err := s.controller.AccountProvider().GetAccount(ctx, result.User.Account)
+	account, err := controller.AccountProvider().GetAccount(ctx, result.User.Account)
 	if err != nil {
 		s.logger.Warn("failed to get account for user %s: %v", result.User.ID, err)
-		s.respondWithError(msg, responseConfig, "internal error")
-		return
+		err = &PhaseError{Phase: "issuer_account", Provider: "account provider", Err: err}
+		return s.errorResponse(controller, responseConfig, s.errorMessage("internal error", err)), false
 	}
 
 	// In operator mode, use signing key's public key for IssuerAccount
 	// In non-operator mode, use account's public key (though IssuerAccount is not set)
 	issuerAccount := account.PublicKey()
-	if s.controller.AccountProvider().IsOperatorMode() {
+	if controller.AccountProvider().IsOperatorMode() {
 		issuerAccount = account.Signer().PublicKey()
 	}
 
 	// Build auth response
-	s.respondWithSuccess(msg, responseConfig, result.JWT, issuerAccount)
+	return s.successResponse(controller, responseConfig, result.JWT, issuerAccount), true
+}
+
+// errorMessage returns msg for an error response, followed by the detail of
+// err if CalloutConfig.ErrorDetail is set.
+func (s *CalloutService) errorMessage(msg string, err error) string {
+	if !s.config.ErrorDetail || err == nil {
+		return msg
+	}
+	var phaseErr *PhaseError
+	if errors.As(err, &phaseErr) {
+		return msg + ": " + phaseErr.Detail()
+	}
+	return msg + ": " + err.Error()
 }
 
 // respondWithError sends an error response.
-func (s *CalloutService) respondWithError(msg *nats.Msg, responseConfig ResponseConfig, errMsg string) {
+func (s *CalloutService) respondWithError(controller *AuthController, msg *nats.Msg, responseConfig ResponseConfig, errMsg string) {
+	s.sendToken(controller, msg, responseConfig.ServerXkey, s.errorResponse(controller, responseConfig, errMsg))
+}
+
+// errorResponse builds and encodes an error response.
+func (s *CalloutService) errorResponse(controller *AuthController, responseConfig ResponseConfig, errMsg string) string {
 	resp := natsjwt.NewAuthorizationResponseClaims(responseConfig.UserNkey)
 	resp.Audience = responseConfig.ServerId
 	resp.Error = errMsg
-	s.sendResponse(msg, responseConfig.ServerXkey, resp)
+	return s.encodeResponse(controller, resp)
 }
 
-// respondWithSuccess sends a success response with the user JWT.
+// successResponse builds and encodes a success response with the user JWT.
 // In operator mode, IssuerAccount is set to the signing key's public key.
 // In non-operator mode, IssuerAccount is NOT set because the NATS server
 // derives the target account from the user JWT's Audience field instead.
-func (s *CalloutService) respondWithSuccess(msg *nats.Msg, responseConfig ResponseConfig, userJWT, issuerAccount string) {
+func (s *CalloutService) successResponse(controller *AuthController, responseConfig ResponseConfig, userJWT, issuerAccount string) string {
 	resp := natsjwt.NewAuthorizationResponseClaims(responseConfig.UserNkey)
 	resp.Jwt = userJWT
 	resp.Audience = responseConfig.ServerId
 
 	// In operator mode, set IssuerAccount to the signing key's public key
-	if s.controller.AccountProvider().IsOperatorMode() {
+	if controller.AccountProvider().IsOperatorMode() {
 		resp.IssuerAccount = issuerAccount
 	}
 
-	s.sendResponse(msg, responseConfig.ServerXkey, resp)
+	return s.encodeResponse(controller, resp)
 }
 
-// sendResponse encodes, optionally encrypts, and sends the response.
-func (s *CalloutService) sendResponse(msg *nats.Msg, serverXKey string, resp *natsjwt.AuthorizationResponseClaims) {
+// encodeResponse signs the response. Returns "" if encoding fails.
+func (s *CalloutService) encodeResponse(controller *AuthController, resp *natsjwt.AuthorizationResponseClaims) string {
 	// Get the account signer for encoding the response
 	// The auth callout response must be signed by the account that's configured as the auth issuer
 	// For simplicity, we use the first available account's signer
 	ctx := context.Background()
-	account, err := s.controller.AccountProvider().GetAccount(ctx, "AUTH")
+	account, err := controller.AccountProvider().GetAccount(ctx, "AUTH")
 	if err != nil {
 		s.logger.Warn("failed to get account for response signing: %v", err)
-		return
+		return ""
 	}
 
 	// Encode the response (signed by account)
 	token, err := resp.Encode(jwt.NewSignerAdapter(account.Signer()))
 	if err != nil {
 		s.logger.Warn("failed to encode response: %v", err)
+		return ""
+	}
+	return token
+}
+
+// sendToken optionally encrypts and sends an encoded response.
+func (s *CalloutService) sendToken(controller *AuthController, msg *nats.Msg, serverXKey string, token string) {
+	if token == "" {
 		return
 	}
 
@@ -334,8 +802,19 @@ func (s *CalloutService) sendResponse(msg *nats.Msg, serverXKey string, resp *na
 		responseData = encrypted
 	}
 
-	// Send response
-	if err := msg.Respond(responseData); err != nil {
+	s.respond(controller, msg, responseData)
+}
+
+// respond sends a response, unless the controller's NATS fault injector
+// drops it.
+func (s *CalloutService) respond(controller *AuthController, msg *nats.Msg, data []byte) {
+	if f := controller.natsFaults(); f != nil {
+		if err := f.inject(context.Background()); err != nil {
+			s.logger.Warn("dropping response: %v", err)
+			return
+		}
+	}
+	if err := msg.Respond(data); err != nil {
 		s.logger.Warn("failed to send response: %v", err)
 	}
 }
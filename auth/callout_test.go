@@ -1,11 +1,14 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"os"
 	"strings"
 	"testing"
 	"time"
 
+	natsjwt "github.com/nats-io/jwt/v2"
 	"github.com/nats-io/nkeys"
 )
 
@@ -46,6 +49,97 @@ func TestNewCalloutService_Validation(t *testing.T) {
 			},
 			wantErr: "parsing xkey seed",
 		},
+		{
+			name:       "negative response cache ttl",
+			controller: &AuthController{},
+			config: CalloutConfig{
+				NatsCredentials:  "/path/to/creds",
+				ResponseCacheTTL: -time.Second,
+			},
+			wantErr: "ResponseCacheTTL",
+		},
+		{
+			name:       "empty callout subject",
+			controller: &AuthController{},
+			config: CalloutConfig{
+				NatsCredentials: "/path/to/creds",
+				Subjects:        []string{""},
+			},
+			wantErr: "invalid callout subject",
+		},
+		{
+			name:       "duplicate callout subject",
+			controller: &AuthController{},
+			config: CalloutConfig{
+				NatsCredentials: "/path/to/creds",
+				Subjects:        []string{"test.auth", "test.auth"},
+			},
+			wantErr: "duplicate callout subject",
+		},
+		{
+			name:       "delegate subject equals callout subject",
+			controller: &AuthController{},
+			config: CalloutConfig{
+				NatsCredentials: "/path/to/creds",
+				DelegateSubject: AuthCalloutSubject,
+			},
+			wantErr: "delegate subject",
+		},
+		{
+			name:       "negative delegate timeout",
+			controller: &AuthController{},
+			config: CalloutConfig{
+				NatsCredentials: "/path/to/creds",
+				DelegateSubject: "legacy.auth",
+				DelegateTimeout: -time.Second,
+			},
+			wantErr: "DelegateTimeout",
+		},
+		{
+			name:       "shadow passthrough without delegate",
+			controller: &AuthController{},
+			config: CalloutConfig{
+				NatsCredentials: "/path/to/creds",
+				Shadow:          ShadowPassthrough,
+			},
+			wantErr: "requires DelegateSubject",
+		},
+		{
+			name:       "unsupported shadow mode",
+			controller: &AuthController{},
+			config: CalloutConfig{
+				NatsCredentials: "/path/to/creds",
+				Shadow:          "allow",
+			},
+			wantErr: "unsupported shadow mode",
+		},
+		{
+			name:       "invalid pending limit",
+			controller: &AuthController{},
+			config: CalloutConfig{
+				NatsCredentials:  "/path/to/creds",
+				PendingMsgsLimit: -2,
+			},
+			wantErr: "PendingMsgsLimit",
+		},
+		{
+			name:       "negative slow consumer log interval",
+			controller: &AuthController{},
+			config: CalloutConfig{
+				NatsCredentials:         "/path/to/creds",
+				SlowConsumerLogInterval: -time.Second,
+			},
+			wantErr: "SlowConsumerLogInterval",
+		},
+		{
+			name:       "negative max concurrent requests",
+			controller: &AuthController{},
+			config: CalloutConfig{
+				NatsCredentials:       "/path/to/creds",
+				MaxConcurrentRequests: -1,
+			},
+			wantErr: "MaxConcurrentRequests",
+		},
 	}
 
 	for _, tt := range tests {
@@ -78,6 +172,26 @@ func TestNewCalloutService_Defaults(t *testing.T) {
 	if svc.config.DefaultTTL != time.Hour {
 		t.Errorf("DefaultTTL = %v, want 1h", svc.config.DefaultTTL)
 	}
+	if len(svc.config.Subjects) != 1 || svc.config.Subjects[0] != AuthCalloutSubject {
+		t.Errorf("Subjects = %v, want [%s]", svc.config.Subjects, AuthCalloutSubject)
+	}
+	if svc.config.SlowConsumerLogInterval != DefaultSlowConsumerLogInterval {
+		t.Errorf("SlowConsumerLogInterval = %v, want %v", svc.config.SlowConsumerLogInterval, DefaultSlowConsumerLogInterval)
+	}
+	if svc.config.RequestQueueDepth != 0 {
+		t.Errorf("RequestQueueDepth = %d without a worker pool, want 0", svc.config.RequestQueueDepth)
+	}
+	if svc.RequestPoolStats() != nil {
+		t.Error("RequestPoolStats() should be nil without a worker pool")
+	}
+
+	svc, err = NewCalloutService(ctrl, CalloutConfig{NatsCredentials: "/path/to/creds", MaxConcurrentRequests: 8})
+	if err != nil {
+		t.Fatalf("NewCalloutService() error = %v", err)
+	}
+	if svc.config.RequestQueueDepth != DefaultRequestQueueDepth {
+		t.Errorf("RequestQueueDepth = %d, want %d", svc.config.RequestQueueDepth, DefaultRequestQueueDepth)
+	}
 }
 
 func TestNewCalloutService_EnvForNATSURL(t *testing.T) {
@@ -195,6 +309,67 @@ func TestCalloutConfig_Validation(t *testing.T) {
 	}
 }
 
+func TestCalloutService_ManagesRequest(t *testing.T) {
+	ctrl := createTestController(t)
+	svc, err := NewCalloutService(ctrl, CalloutConfig{
+		NatsCredentials: "/path/to/creds",
+		DelegateSubject: "legacy.auth",
+	})
+	if err != nil {
+		t.Fatalf("NewCalloutService() error = %v", err)
+	}
+	if svc.config.DelegateTimeout != 2*time.Second {
+		t.Errorf("DelegateTimeout = %v, want 2s", svc.config.DelegateTimeout)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  bool
+	}{
+		{name: "managed account", token: `{"account":"test-account","token":"alice:secret123"}`, want: true},
+		{name: "unknown account", token: `{"account":"legacy-account","token":"alice:secret123"}`, want: false},
+		{name: "legacy token", token: "alice:secret123", want: false},
+		{name: "unsupported version", token: `{"v":99,"account":"legacy-account","token":"alice:secret123"}`, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authReq := natsjwt.NewAuthorizationRequestClaims("UABC")
+			authReq.ConnectOptions.Token = tt.token
+			if got := svc.managesRequest(context.Background(), ctrl, authReq); got != tt.want {
+				t.Errorf("managesRequest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalloutService_ErrorMessage(t *testing.T) {
+	err := &PhaseError{
+		Phase:    "compile",
+		Provider: "policy provider",
+		Err:      NewAuthError("alice", "resolve_permissions", "nats: bucket not found", errors.New("nats: bucket not found")),
+	}
+	tests := []struct {
+		name        string
+		errorDetail bool
+		err         error
+		want        string
+	}{
+		{name: "disabled", err: err, want: "authentication failed"},
+		{name: "phase error", errorDetail: true, err: err, want: "authentication failed: policy provider: nats: bucket not found"},
+		{name: "phase without provider", errorDetail: true, err: &PhaseError{Phase: "parse_request", Err: errors.New("invalid token")}, want: "authentication failed: parse_request: invalid token"},
+		{name: "other error", errorDetail: true, err: errors.New("decoding request: bad"), want: "authentication failed: decoding request: bad"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &CalloutService{config: CalloutConfig{ErrorDetail: tt.errorDetail}}
+			if got := svc.errorMessage("authentication failed", tt.err); got != tt.want {
+				t.Errorf("errorMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestXKeyEncryptDecrypt(t *testing.T) {
 	// Test that xkey encryption/decryption works
 	// Generate two keypairs (service and "server")
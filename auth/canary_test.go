@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/policy"
+	"github.com/msimon/nauts/provider"
+)
+
+func TestPolicyCanary_Selects(t *testing.T) {
+	if (*PolicyCanary)(nil).Selects("APP", "alice") {
+		t.Error("nil canary selects users")
+	}
+	none, all := NewPolicyCanary(nil, 0), NewPolicyCanary(nil, 100)
+	ten, fifty := NewPolicyCanary(nil, 10), NewPolicyCanary(nil, 50)
+
+	selected := 0
+	for i := range 10000 {
+		user := fmt.Sprintf("user-%d", i)
+		if none.Selects("APP", user) || !all.Selects("APP", user) {
+			t.Fatalf("0%% or 100%% canary misselects %s", user)
+		}
+		if ten.Selects("APP", user) {
+			selected++
+			// Raising the percentage keeps the cohort.
+			if !fifty.Selects("APP", user) {
+				t.Fatalf("%s is selected at 10%% but not at 50%%", user)
+			}
+		}
+	}
+	if selected < 900 || selected > 1100 {
+		t.Errorf("10%% canary selected %d of 10000 users", selected)
+	}
+
+	if got := NewPolicyCanary(nil, 12.5).Status().Percent; got != 12.5 {
+		t.Errorf("Percent = %v, want 12.5", got)
+	}
+	if got := NewPolicyCanary(nil, 150).Status().Percent; got != 100 {
+		t.Errorf("Percent = %v, want 100", got)
+	}
+}
+
+func TestCompileNatsPermissions_PolicyCanary(t *testing.T) {
+	ctx := context.Background()
+	user := &AccountScopedUser{
+		User: identity.User{
+			ID:    "alice",
+			Roles: []identity.Role{{Account: "test-account", Name: "workers"}},
+		},
+		Account: "test-account",
+	}
+	newPub := policy.Permission{Type: policy.PermPub, Subject: "orders.>"}
+
+	t.Run("candidate policies", func(t *testing.T) {
+		ctrl := createTestController(t)
+		canary := NewPolicyCanary(createCanaryPolicyProvider(t), 100)
+		WithPolicyCanary(canary)(ctrl)
+
+		result, err := ctrl.CompileNatsPermissions(ctx, user)
+		if err != nil {
+			t.Fatalf("CompileNatsPermissions() error = %v", err)
+		}
+		if !result.PolicyCanary || !slices.Contains(result.Permissions.PubList(), newPub) {
+			t.Errorf("result = canary %v, permissions %v, want canary with pub orders.>", result.PolicyCanary, result.Permissions)
+		}
+		want := PolicyCanaryStatus{Percent: 100, Canary: 1, PermissionDiffs: 1}
+		if got := *ctrl.PolicyCanary(); got != want {
+			t.Errorf("Status() = %+v, want %+v", got, want)
+		}
+
+		explained, err := ctrl.ExplainPermissions(ctx, user)
+		if err != nil || !explained.PolicyCanary {
+			t.Errorf("ExplainPermissions() = canary %v, error %v, want canary", explained != nil && explained.PolicyCanary, err)
+		}
+	})
+
+	t.Run("stable cohort", func(t *testing.T) {
+		ctrl := createTestController(t)
+		WithPolicyCanary(NewPolicyCanary(createCanaryPolicyProvider(t), 0))(ctrl)
+
+		result, err := ctrl.CompileNatsPermissions(ctx, user)
+		if err != nil {
+			t.Fatalf("CompileNatsPermissions() error = %v", err)
+		}
+		if result.PolicyCanary || slices.Contains(result.Permissions.PubList(), newPub) {
+			t.Errorf("result = canary %v, permissions %v, want stable", result.PolicyCanary, result.Permissions)
+		}
+		if got := ctrl.PolicyCanary(); got.Stable != 1 || got.Canary != 0 {
+			t.Errorf("Status() = %+v, want 1 stable compilation", got)
+		}
+	})
+
+	t.Run("candidate failure falls back", func(t *testing.T) {
+		ctrl := createTestController(t)
+		WithPolicyCanary(NewPolicyCanary(&stubPolicyProvider{err: errors.New("kv timeout")}, 100))(ctrl)
+
+		result, err := ctrl.CompileNatsPermissions(ctx, user)
+		if err != nil {
+			t.Fatalf("CompileNatsPermissions() error = %v", err)
+		}
+		if result.PolicyCanary || result.Permissions.IsEmpty() {
+			t.Errorf("result = canary %v, permissions %v, want stable", result.PolicyCanary, result.Permissions)
+		}
+		if got := ctrl.PolicyCanary(); got.Errors != 1 || got.Canary != 0 {
+			t.Errorf("Status() = %+v, want 1 error", got)
+		}
+	})
+}
+
+// createCanaryPolicyProvider returns the bindings of createTestPolicyProvider
+// with a policy that additionally grants orders.>.
+func createCanaryPolicyProvider(t *testing.T) provider.PolicyProvider {
+	t.Helper()
+	dir := t.TempDir()
+	policies := `[{"id": "allow-basic", "account": "test-account", "name": "Basic Access", "statements": [
+		{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:test.>", "nats:orders.>"]}
+	]}]`
+	bindings := `[{"role": "workers", "account": "test-account", "policies": ["allow-basic"]}]`
+	if err := os.WriteFile(filepath.Join(dir, "policies.json"), []byte(policies), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bindings.json"), []byte(bindings), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := provider.NewFilePolicyProvider(provider.FilePolicyProviderConfig{
+		PoliciesPath: filepath.Join(dir, "policies.json"),
+		BindingsPath: filepath.Join(dir, "bindings.json"),
+	})
+	if err != nil {
+		t.Fatalf("creating canary policy provider: %v", err)
+	}
+	return p
+}
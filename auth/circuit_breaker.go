@@ -0,0 +1,286 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/policy"
+	"github.com/msimon/nauts/provider"
+)
+
+// Circuit breaker defaults.
+const (
+	DefaultCircuitBreakerFailureThreshold = 5
+	DefaultCircuitBreakerOpenDuration     = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned without calling the provider while its circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("provider unavailable: circuit breaker open")
+
+// Circuit breaker states.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// CircuitBreaker stops calling a provider after a number of consecutive
+// failures. While open, calls fail immediately with ErrCircuitOpen. After the
+// open duration a single probe call is let through (half-open): if it
+// succeeds the breaker closes, otherwise it opens again. It is safe for
+// concurrent use.
+type CircuitBreaker struct {
+	name         string
+	threshold    int
+	openDuration time.Duration
+	now          func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+
+	opens    uint64
+	rejected uint64
+}
+
+// CircuitBreakerStatus is a snapshot of a circuit breaker.
+type CircuitBreakerStatus struct {
+	Name                string `json:"name"`
+	State               string `json:"state"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	Opens               uint64 `json:"opens"`
+	Rejected            uint64 `json:"rejected"`
+}
+
+// NewCircuitBreaker creates a closed circuit breaker that opens after threshold
+// consecutive failures and stays open for openDuration. Non-positive values
+// select the defaults.
+func NewCircuitBreaker(name string, threshold int, openDuration time.Duration) *CircuitBreaker {
+	if threshold <= 0 {
+		threshold = DefaultCircuitBreakerFailureThreshold
+	}
+	if openDuration <= 0 {
+		openDuration = DefaultCircuitBreakerOpenDuration
+	}
+	return &CircuitBreaker{
+		name:         name,
+		threshold:    threshold,
+		openDuration: openDuration,
+		now:          time.Now,
+		state:        CircuitClosed,
+	}
+}
+
+// Name returns the name of the breaker.
+func (b *CircuitBreaker) Name() string {
+	return b.name
+}
+
+// Status returns a snapshot of the breaker's state and counters.
+func (b *CircuitBreaker) Status() CircuitBreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return CircuitBreakerStatus{
+		Name:                b.name,
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		Opens:               b.opens,
+		Rejected:            b.rejected,
+	}
+}
+
+// allow reports whether a call may proceed. Every allowed call must be
+// followed by exactly one call to record.
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if b.now().Sub(b.openedAt) < b.openDuration {
+			b.rejected++
+			return fmt.Errorf("%w: %s", ErrCircuitOpen, b.name)
+		}
+		b.state = CircuitHalfOpen
+		b.probing = true
+		return nil
+	case CircuitHalfOpen:
+		if b.probing {
+			b.rejected++
+			return fmt.Errorf("%w: %s", ErrCircuitOpen, b.name)
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// record updates the breaker with the outcome of an allowed call.
+func (b *CircuitBreaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitHalfOpen {
+		b.probing = false
+		if failed {
+			b.open()
+		} else {
+			b.state = CircuitClosed
+			b.failures = 0
+		}
+		return
+	}
+
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == CircuitClosed && b.failures >= b.threshold {
+		b.open()
+	}
+}
+
+func (b *CircuitBreaker) open() {
+	b.state = CircuitOpen
+	b.openedAt = b.now()
+	b.opens++
+}
+
+// call runs fn through the breaker. isFailure decides whether an error
+// indicates that the provider is unavailable; other errors (e.g., invalid
+// credentials) count as successful calls.
+func (b *CircuitBreaker) call(fn func() error, isFailure func(error) bool) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.record(err != nil && isFailure(err))
+	return err
+}
+
+// isAuthenticationFailure reports whether err means the authentication
+// provider could not reach its backend.
+func isAuthenticationFailure(err error) bool {
+	return errors.Is(err, identity.ErrProviderUnavailable) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// isPolicyFailure reports whether err means the policy provider could not
+// serve the request. Lookups of unknown policies and roles are regular results.
+func isPolicyFailure(err error) bool {
+	return !errors.Is(err, provider.ErrPolicyNotFound) &&
+		!errors.Is(err, provider.ErrRoleNotFound) &&
+		!errors.Is(err, context.Canceled)
+}
+
+// circuitBreakingAuthProvider guards an AuthenticationProvider with a CircuitBreaker.
+type circuitBreakingAuthProvider struct {
+	identity.AuthenticationProvider
+	breaker *CircuitBreaker
+}
+
+// NewCircuitBreakingAuthProvider wraps p so that Verify fails fast with
+// ErrCircuitOpen while breaker is open. Only errors wrapping
+// identity.ErrProviderUnavailable or context.DeadlineExceeded count as failures.
+func NewCircuitBreakingAuthProvider(p identity.AuthenticationProvider, breaker *CircuitBreaker) identity.AuthenticationProvider {
+	return &circuitBreakingAuthProvider{AuthenticationProvider: p, breaker: breaker}
+}
+
+func (p *circuitBreakingAuthProvider) Verify(ctx context.Context, req identity.AuthRequest) (*identity.User, error) {
+	var user *identity.User
+	err := p.breaker.call(func() error {
+		var err error
+		user, err = p.AuthenticationProvider.Verify(ctx, req)
+		return err
+	}, isAuthenticationFailure)
+	return user, err
+}
+
+// Stop stops the wrapped provider if it holds resources.
+func (p *circuitBreakingAuthProvider) Stop() error {
+	if s, ok := p.AuthenticationProvider.(interface{ Stop() error }); ok {
+		return s.Stop()
+	}
+	return nil
+}
+
+// circuitBreakingPolicyProvider guards a PolicyProvider with a CircuitBreaker.
+type circuitBreakingPolicyProvider struct {
+	inner   provider.PolicyProvider
+	breaker *CircuitBreaker
+}
+
+// NewCircuitBreakingPolicyProvider wraps p so that its methods fail fast with
+// ErrCircuitOpen while breaker is open. Every error except
+// provider.ErrPolicyNotFound, provider.ErrRoleNotFound and context.Canceled
+// counts as a failure. Bindings and Stop are forwarded if p supports them.
+func NewCircuitBreakingPolicyProvider(p provider.PolicyProvider, breaker *CircuitBreaker) provider.PolicyProvider {
+	return &circuitBreakingPolicyProvider{inner: p, breaker: breaker}
+}
+
+func (p *circuitBreakingPolicyProvider) GetPolicy(ctx context.Context, account string, id string) (*policy.Policy, error) {
+	var pol *policy.Policy
+	err := p.breaker.call(func() error {
+		var err error
+		pol, err = p.inner.GetPolicy(ctx, account, id)
+		return err
+	}, isPolicyFailure)
+	return pol, err
+}
+
+func (p *circuitBreakingPolicyProvider) GetPoliciesForRole(ctx context.Context, role identity.Role) ([]*policy.Policy, error) {
+	var policies []*policy.Policy
+	err := p.breaker.call(func() error {
+		var err error
+		policies, err = p.inner.GetPoliciesForRole(ctx, role)
+		return err
+	}, isPolicyFailure)
+	return policies, err
+}
+
+func (p *circuitBreakingPolicyProvider) GetPolicies(ctx context.Context, account string) ([]*policy.Policy, error) {
+	var policies []*policy.Policy
+	err := p.breaker.call(func() error {
+		var err error
+		policies, err = p.inner.GetPolicies(ctx, account)
+		return err
+	}, isPolicyFailure)
+	return policies, err
+}
+
+// GetBinding implements provider.BindingProvider. It returns
+// provider.ErrRoleNotFound if the wrapped provider has no bindings.
+func (p *circuitBreakingPolicyProvider) GetBinding(ctx context.Context, role identity.Role) (*provider.Binding, error) {
+	bp, ok := p.inner.(provider.BindingProvider)
+	if !ok {
+		return nil, provider.ErrRoleNotFound
+	}
+	var binding *provider.Binding
+	err := p.breaker.call(func() error {
+		var err error
+		binding, err = bp.GetBinding(ctx, role)
+		return err
+	}, isPolicyFailure)
+	return binding, err
+}
+
+// Unwrap returns the wrapped provider.
+func (p *circuitBreakingPolicyProvider) Unwrap() provider.PolicyProvider {
+	return p.inner
+}
+
+// Stop stops the wrapped provider if it holds resources.
+func (p *circuitBreakingPolicyProvider) Stop() error {
+	if s, ok := p.inner.(interface{ Stop() error }); ok {
+		return s.Stop()
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/policy"
+	"github.com/msimon/nauts/provider"
+)
+
+func TestCircuitBreaker_Transitions(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := NewCircuitBreaker("test", 2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	unavailable := errors.New("down")
+	fail := func() error { return unavailable }
+	ok := func() error { return nil }
+	always := func(error) bool { return true }
+
+	// Closed: failures below the threshold pass through.
+	if err := b.call(fail, always); err != unavailable {
+		t.Fatalf("call() error = %v, want %v", err, unavailable)
+	}
+	if got := b.Status().State; got != CircuitClosed {
+		t.Fatalf("state = %s, want %s", got, CircuitClosed)
+	}
+
+	// Threshold reached: the breaker opens and rejects without calling.
+	_ = b.call(fail, always)
+	if got := b.Status().State; got != CircuitOpen {
+		t.Fatalf("state = %s, want %s", got, CircuitOpen)
+	}
+	called := false
+	err := b.call(func() error { called = true; return nil }, always)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("call() error = %v, want ErrCircuitOpen", err)
+	}
+	if called {
+		t.Error("call() invoked the provider while open")
+	}
+
+	// After the open duration a failing probe re-opens the breaker.
+	now = now.Add(time.Minute)
+	if err := b.call(fail, always); err != unavailable {
+		t.Fatalf("probe error = %v, want %v", err, unavailable)
+	}
+	if got := b.Status().State; got != CircuitOpen {
+		t.Fatalf("state = %s, want %s", got, CircuitOpen)
+	}
+
+	// A successful probe closes it.
+	now = now.Add(time.Minute)
+	if err := b.call(ok, always); err != nil {
+		t.Fatalf("probe error = %v", err)
+	}
+	status := b.Status()
+	if status.State != CircuitClosed || status.ConsecutiveFailures != 0 {
+		t.Errorf("status = %+v, want closed without failures", status)
+	}
+	if status.Opens != 2 || status.Rejected != 1 {
+		t.Errorf("opens = %d, rejected = %d, want 2 and 1", status.Opens, status.Rejected)
+	}
+}
+
+func TestCircuitBreaker_SingleProbe(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := NewCircuitBreaker("test", 1, time.Second)
+	b.now = func() time.Time { return now }
+
+	_ = b.call(func() error { return errors.New("down") }, func(error) bool { return true })
+	now = now.Add(time.Second)
+
+	if err := b.allow(); err != nil {
+		t.Fatalf("allow() error = %v, want probe", err)
+	}
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("allow() during probe error = %v, want ErrCircuitOpen", err)
+	}
+	b.record(false)
+	if err := b.allow(); err != nil {
+		t.Errorf("allow() after successful probe error = %v", err)
+	}
+}
+
+type stubAuthProvider struct {
+	err   error
+	calls int
+}
+
+func (p *stubAuthProvider) Verify(context.Context, identity.AuthRequest) (*identity.User, error) {
+	p.calls++
+	return nil, p.err
+}
+
+func (p *stubAuthProvider) ManageableAccounts() []string { return []string{"*"} }
+
+func TestCircuitBreakingAuthProvider(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantOpen bool
+	}{
+		{"invalid credentials", fmt.Errorf("%w: bad password", identity.ErrInvalidCredentials), false},
+		{"unparseable token", errors.New("malformed token"), false},
+		{"backend unavailable", fmt.Errorf("%w: calling STS", identity.ErrProviderUnavailable), true},
+		{"deadline exceeded", context.DeadlineExceeded, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &stubAuthProvider{err: tt.err}
+			b := NewCircuitBreaker("auth:test", 3, time.Minute)
+			p := NewCircuitBreakingAuthProvider(inner, b)
+
+			for i := 0; i < 5; i++ {
+				_, _ = p.Verify(context.Background(), identity.AuthRequest{})
+			}
+			if got := b.Status().State == CircuitOpen; got != tt.wantOpen {
+				t.Errorf("open = %v, want %v", got, tt.wantOpen)
+			}
+			wantCalls := 5
+			if tt.wantOpen {
+				wantCalls = 3
+			}
+			if inner.calls != wantCalls {
+				t.Errorf("provider calls = %d, want %d", inner.calls, wantCalls)
+			}
+		})
+	}
+}
+
+type stubPolicyProvider struct {
+	err error
+}
+
+func (p *stubPolicyProvider) GetPolicy(context.Context, string, string) (*policy.Policy, error) {
+	return nil, p.err
+}
+
+func (p *stubPolicyProvider) GetPoliciesForRole(context.Context, identity.Role) ([]*policy.Policy, error) {
+	return nil, p.err
+}
+
+func (p *stubPolicyProvider) GetPolicies(context.Context, string) ([]*policy.Policy, error) {
+	return nil, p.err
+}
+
+func TestCircuitBreakingPolicyProvider(t *testing.T) {
+	ctx := context.Background()
+	role := identity.Role{Account: "APP", Name: "admin"}
+
+	t.Run("not found is not a failure", func(t *testing.T) {
+		b := NewCircuitBreaker("policy", 1, time.Minute)
+		p := NewCircuitBreakingPolicyProvider(&stubPolicyProvider{err: provider.ErrRoleNotFound}, b)
+		_, _ = p.GetPoliciesForRole(ctx, role)
+		if got := b.Status().State; got != CircuitClosed {
+			t.Errorf("state = %s, want %s", got, CircuitClosed)
+		}
+	})
+
+	t.Run("backend error opens", func(t *testing.T) {
+		b := NewCircuitBreaker("policy", 1, time.Minute)
+		p := NewCircuitBreakingPolicyProvider(&stubPolicyProvider{err: errors.New("kv timeout")}, b)
+		_, _ = p.GetPoliciesForRole(ctx, role)
+		if _, err := p.GetPolicy(ctx, "APP", "p1"); !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("GetPolicy() error = %v, want ErrCircuitOpen", err)
+		}
+	})
+
+	t.Run("bindings of providers without bindings", func(t *testing.T) {
+		b := NewCircuitBreaker("policy", 1, time.Minute)
+		p := NewCircuitBreakingPolicyProvider(&stubPolicyProvider{}, b)
+		bp, ok := p.(provider.BindingProvider)
+		if !ok {
+			t.Fatal("wrapper does not implement BindingProvider")
+		}
+		if _, err := bp.GetBinding(ctx, role); !errors.Is(err, provider.ErrRoleNotFound) {
+			t.Errorf("GetBinding() error = %v, want ErrRoleNotFound", err)
+		}
+	})
+}
@@ -1,14 +1,28 @@
 package auth
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"gopkg.in/yaml.v3"
+
 	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/jwt"
+	"github.com/msimon/nauts/policy"
 	"github.com/msimon/nauts/provider"
+	"github.com/msimon/nauts/strictjson"
+	"github.com/msimon/nauts/units"
 )
 
 // Config holds the complete configuration for the nauts authentication service.
@@ -28,7 +42,8 @@ type Config struct {
 
 // AccountConfig configures the account provider.
 type AccountConfig struct {
-	// Type specifies the account provider type: "operator" or "static".
+	// Type specifies the account provider type: "operator", "static", or
+	// "vault".
 	Type string `json:"type"`
 
 	// Operator contains operator mode configuration.
@@ -36,11 +51,56 @@ type AccountConfig struct {
 
 	// Static contains static account provider configuration.
 	Static *provider.StaticAccountProviderConfig `json:"static,omitempty"`
+
+	// Vault contains the configuration of accounts stored in HashiCorp Vault.
+	Vault *provider.VaultAccountProviderConfig `json:"vault,omitempty"`
+
+	// TTLs optionally replaces server.ttl for users of an account, keyed by
+	// account name (e.g., {"ADMIN": "15m"}). Role binding TTLs may lower it.
+	TTLs map[string]string `json:"ttls,omitempty"`
+
+	// Inboxes optionally replaces the inbox users of an account may
+	// subscribe to (default "_INBOX_{{ user.id }}.>"), keyed by account name
+	// or "*" for all accounts: a subject template like
+	// "_INBOX.{{ user.id }}.>", or "none" to grant no inbox. Policies may
+	// override it with their inbox.
+	Inboxes map[string]string `json:"inboxes,omitempty"`
+}
+
+// ValidateInboxes checks the per-account inbox templates.
+func (c *AccountConfig) ValidateInboxes() error {
+	for account, inbox := range c.Inboxes {
+		if account == "" {
+			return fmt.Errorf("account.inboxes contains an empty account name")
+		}
+		if err := policy.ValidateInboxTemplate(inbox); err != nil {
+			return fmt.Errorf("account.inboxes[%s]: %w", account, err)
+		}
+	}
+	return nil
+}
+
+// GetTTLs returns the parsed per-account TTL overrides.
+func (c *AccountConfig) GetTTLs() (map[string]time.Duration, error) {
+	ttls := make(map[string]time.Duration, len(c.TTLs))
+	for account, s := range c.TTLs {
+		if account == "" {
+			return nil, fmt.Errorf("account.ttls contains an empty account name")
+		}
+		d, err := policy.ParseMaxTTL(s)
+		if err != nil {
+			return nil, fmt.Errorf("account.ttls[%s]: %w", account, err)
+		}
+		if d > 0 {
+			ttls[account] = d
+		}
+	}
+	return ttls, nil
 }
 
 // PolicyConfig configures the policy provider.
 type PolicyConfig struct {
-	// Type specifies the policy provider type: "file" or "nats".
+	// Type specifies the policy provider type: "file", "nats", "sql" or "consul".
 	Type string `json:"type"`
 
 	// File contains file-based provider configuration.
@@ -48,25 +108,218 @@ type PolicyConfig struct {
 
 	// Nats contains NATS KV-based provider configuration.
 	Nats *provider.NatsPolicyProviderConfig `json:"nats,omitempty"`
+
+	// SQL holds the configuration for a PostgreSQL policy provider.
+	SQL *provider.SQLPolicyProviderConfig `json:"sql,omitempty"`
+
+	// Consul holds the configuration for a Consul KV policy provider.
+	Consul *provider.ConsulPolicyProviderConfig `json:"consul,omitempty"`
+
+	// Ownership claims subject prefixes of an account for a team. Policies
+	// naming a team (policy.Policy.Team) must not grant subjects claimed by
+	// another team; violations are lint findings and compile warnings.
+	Ownership []policy.SubjectClaim `json:"ownership,omitempty"`
+
+	// Canary rolls out the policies of a second store to a percentage of
+	// users (see PolicyCanary).
+	Canary *PolicyCanaryConfig `json:"canary,omitempty"`
+
+	// Routes serve the policies of matching accounts from other stores (see
+	// provider.RoutingPolicyProvider); the first matching route wins and
+	// other accounts use the store described by Type.
+	Routes []PolicyRouteConfig `json:"routes,omitempty"`
+}
+
+// PolicyRouteConfig routes the policies and bindings of accounts to a store
+// described like the policy provider.
+type PolicyRouteConfig struct {
+	// Accounts lists account names and patterns ("*", "prefix*").
+	Accounts []string `json:"accounts"`
+
+	// Type specifies the store type: "file", "nats", "sql" or "consul"
+	// (default: "file").
+	Type   string                               `json:"type"`
+	File   *provider.FilePolicyProviderConfig   `json:"file,omitempty"`
+	Nats   *provider.NatsPolicyProviderConfig   `json:"nats,omitempty"`
+	SQL    *provider.SQLPolicyProviderConfig    `json:"sql,omitempty"`
+	Consul *provider.ConsulPolicyProviderConfig `json:"consul,omitempty"`
+}
+
+// policyConfig returns the store of the route as a PolicyConfig.
+func (c *PolicyRouteConfig) policyConfig() PolicyConfig {
+	return PolicyConfig{Type: c.Type, File: c.File, Nats: c.Nats, SQL: c.SQL, Consul: c.Consul}
+}
+
+// PolicyCanaryConfig configures the policy canary: the candidate store is
+// described like the policy provider and is used for Percent of all users.
+type PolicyCanaryConfig struct {
+	// Percent is the share of users (0-100) that get the candidate policies.
+	Percent float64 `json:"percent"`
+
+	// Type specifies the candidate store type: "file", "nats", "sql" or
+	// "consul" (default: "file").
+	Type   string                               `json:"type"`
+	File   *provider.FilePolicyProviderConfig   `json:"file,omitempty"`
+	Nats   *provider.NatsPolicyProviderConfig   `json:"nats,omitempty"`
+	SQL    *provider.SQLPolicyProviderConfig    `json:"sql,omitempty"`
+	Consul *provider.ConsulPolicyProviderConfig `json:"consul,omitempty"`
+}
+
+// policyConfig returns the candidate store as a PolicyConfig.
+func (c *PolicyCanaryConfig) policyConfig() PolicyConfig {
+	return PolicyConfig{Type: c.Type, File: c.File, Nats: c.Nats, SQL: c.SQL, Consul: c.Consul}
+}
+
+// SubjectOwnership returns the subject ownership registry, or nil if no
+// claims are configured.
+func (c *PolicyConfig) SubjectOwnership() (*policy.SubjectOwnership, error) {
+	if len(c.Ownership) == 0 {
+		return nil, nil
+	}
+	return policy.NewSubjectOwnership(c.Ownership)
 }
 
 // AuthConfig configures the authentication providers.
 //
-// Multiple providers can be configured (file, jwt, and/or aws). Each provider must have a unique id.
+// Multiple providers can be configured (file, jwt, aws, gcp, azure, kubernetes, and/or custom). Each provider must have a unique id.
 type AuthConfig struct {
-	JWT  []JwtAuthProviderConfig  `json:"jwt,omitempty"`
-	File []FileAuthProviderConfig `json:"file,omitempty"`
-	Aws  []AwsAuthProviderConfig  `json:"aws,omitempty"`
+	JWT        []JwtAuthProviderConfig        `json:"jwt,omitempty"`
+	File       []FileAuthProviderConfig       `json:"file,omitempty"`
+	Aws        []AwsAuthProviderConfig        `json:"aws,omitempty"`
+	Gcp        []GcpAuthProviderConfig        `json:"gcp,omitempty"`
+	Azure      []AzureAuthProviderConfig      `json:"azure,omitempty"`
+	Kubernetes []KubernetesAuthProviderConfig `json:"kubernetes,omitempty"`
+	Nkey       []NkeyAuthProviderConfig       `json:"nkey,omitempty"`
+	// Custom configures providers of types registered with RegisterAuthProviderFactory.
+	Custom []CustomAuthProviderConfig `json:"custom,omitempty"`
+}
+
+// authRoleMapping is the roleMapping of an authentication provider.
+type authRoleMapping struct {
+	field  string // e.g. "auth.jwt[okta]", for errors
+	id     string
+	config *identity.RoleMappingConfig
+}
+
+// authResilience is the resilience configuration of an authentication provider.
+type authResilience struct {
+	field  string // e.g. "auth.aws[prod]", for errors
+	id     string
+	config *ProviderResilienceConfig
+}
+
+// resiliences returns the resilience configurations of all providers that
+// configure one.
+func (a AuthConfig) resiliences() []authResilience {
+	var configs []authResilience
+	add := func(kind, id string, cfg *ProviderResilienceConfig) {
+		if cfg != nil {
+			configs = append(configs, authResilience{fmt.Sprintf("auth.%s[%s]", kind, id), id, cfg})
+		}
+	}
+	for _, p := range a.JWT {
+		add("jwt", p.ID, p.Resilience)
+	}
+	for _, p := range a.File {
+		add("file", p.ID, p.Resilience)
+	}
+	for _, p := range a.Aws {
+		add("aws", p.ID, p.Resilience)
+	}
+	for _, p := range a.Gcp {
+		add("gcp", p.ID, p.Resilience)
+	}
+	for _, p := range a.Azure {
+		add("azure", p.ID, p.Resilience)
+	}
+	for _, p := range a.Kubernetes {
+		add("kubernetes", p.ID, p.Resilience)
+	}
+	for _, p := range a.Nkey {
+		add("nkey", p.ID, p.Resilience)
+	}
+	for _, p := range a.Custom {
+		add("custom", p.ID, p.Resilience)
+	}
+	return configs
+}
+
+// roleMappings returns the role mappings of all providers that configure one.
+func (a AuthConfig) roleMappings() []authRoleMapping {
+	var mappings []authRoleMapping
+	add := func(kind, id string, cfg *identity.RoleMappingConfig) {
+		if cfg != nil {
+			mappings = append(mappings, authRoleMapping{fmt.Sprintf("auth.%s[%s]", kind, id), id, cfg})
+		}
+	}
+	for _, p := range a.JWT {
+		add("jwt", p.ID, p.RoleMapping)
+	}
+	for _, p := range a.File {
+		add("file", p.ID, p.RoleMapping)
+	}
+	for _, p := range a.Aws {
+		add("aws", p.ID, p.RoleMapping)
+	}
+	for _, p := range a.Gcp {
+		add("gcp", p.ID, p.RoleMapping)
+	}
+	for _, p := range a.Azure {
+		add("azure", p.ID, p.RoleMapping)
+	}
+	for _, p := range a.Kubernetes {
+		add("kubernetes", p.ID, p.RoleMapping)
+	}
+	for _, p := range a.Nkey {
+		add("nkey", p.ID, p.RoleMapping)
+	}
+	for _, p := range a.Custom {
+		add("custom", p.ID, p.RoleMapping)
+	}
+	return mappings
 }
 
 type JwtAuthProviderConfig struct {
 	ID string `json:"id"`
 
 	Accounts []string `json:"accounts"`
-	Issuer   string   `json:"issuer"`
+	Issuer   string   `json:"issuer,omitempty"`
 	// PublicKey is a base64 encoded PEM block.
-	PublicKey      string `json:"publicKey"`
-	RolesClaimPath string `json:"rolesClaimPath,omitempty"`
+	// Exactly one of PublicKey, JWKSURL, and Discovery must be set.
+	PublicKey string `json:"publicKey,omitempty"`
+	// JWKSURL fetches signing keys from the issuer's JSON Web Key Set.
+	JWKSURL string `json:"jwksUrl,omitempty"`
+	// Discovery reads the JWKS URL from <issuer>/.well-known/openid-configuration.
+	Discovery bool `json:"discovery,omitempty"`
+	// JWKSRefreshInterval is how often JWKS keys are refreshed (e.g., "1h", default: 1h).
+	JWKSRefreshInterval string `json:"jwksRefreshInterval,omitempty"`
+	// Audience, if set, must be contained in the token's aud claim.
+	Audience string `json:"audience,omitempty"`
+	// Issuers trusts several issuers in one provider, selected by the token's
+	// iss claim. Mutually exclusive with the single-issuer fields above.
+	Issuers        []JwtIssuerConfig `json:"issuers,omitempty"`
+	RolesClaimPath string            `json:"rolesClaimPath,omitempty"`
+	// GroupsClaimPath reads directory groups for roleMapping (e.g., "groups").
+	GroupsClaimPath string `json:"groupsClaimPath,omitempty"`
+	// AllowedCidrs restricts the provider to clients from these networks
+	// (e.g., "10.0.0.0/8"). Empty allows all clients.
+	AllowedCidrs []string `json:"allowedCidrs,omitempty"`
+	// RoleMapping maps the groups and roles of verified users to nauts roles.
+	RoleMapping *identity.RoleMappingConfig `json:"roleMapping,omitempty"`
+	// Resilience bounds and retries the provider's verifications, and
+	// overrides server.circuitBreaker for it.
+	Resilience *ProviderResilienceConfig `json:"resilience,omitempty"`
+}
+
+// JwtIssuerConfig is a trusted issuer of a JWT provider with its own keys and
+// audience.
+type JwtIssuerConfig struct {
+	Issuer              string `json:"issuer"`
+	PublicKey           string `json:"publicKey,omitempty"`
+	JWKSURL             string `json:"jwksUrl,omitempty"`
+	Discovery           bool   `json:"discovery,omitempty"`
+	JWKSRefreshInterval string `json:"jwksRefreshInterval,omitempty"`
+	Audience            string `json:"audience,omitempty"`
 }
 
 type FileAuthProviderConfig struct {
@@ -75,6 +328,16 @@ type FileAuthProviderConfig struct {
 	Accounts []string `json:"accounts"`
 	// UsersPath is the path to the users JSON file.
 	UsersPath string `json:"userPath"`
+	// PasswordHashing configures the password hashing policy.
+	PasswordHashing *identity.PasswordHashingConfig `json:"passwordHashing,omitempty"`
+	// AllowedCidrs restricts the provider to clients from these networks
+	// (e.g., "10.0.0.0/8"). Empty allows all clients.
+	AllowedCidrs []string `json:"allowedCidrs,omitempty"`
+	// RoleMapping maps the groups and roles of verified users to nauts roles.
+	RoleMapping *identity.RoleMappingConfig `json:"roleMapping,omitempty"`
+	// Resilience bounds and retries the provider's verifications, and
+	// overrides server.circuitBreaker for it.
+	Resilience *ProviderResilienceConfig `json:"resilience,omitempty"`
 }
 
 type AwsAuthProviderConfig struct {
@@ -84,6 +347,112 @@ type AwsAuthProviderConfig struct {
 	Region       string        `json:"region,omitempty"`
 	MaxClockSkew time.Duration `json:"maxClockSkew,omitempty"`
 	AWSAccount   string        `json:"awsAccount"`
+	// AllowedCidrs restricts the provider to clients from these networks
+	// (e.g., "10.0.0.0/8"). Empty allows all clients.
+	AllowedCidrs []string `json:"allowedCidrs,omitempty"`
+	// RoleMapping maps the groups and roles of verified users to nauts roles.
+	RoleMapping *identity.RoleMappingConfig `json:"roleMapping,omitempty"`
+	// Resilience bounds and retries the provider's verifications, and
+	// overrides server.circuitBreaker for it.
+	Resilience *ProviderResilienceConfig `json:"resilience,omitempty"`
+}
+
+type GcpAuthProviderConfig struct {
+	ID string `json:"id"`
+
+	Accounts []string `json:"accounts"`
+	// Project is the GCP project ID whose service accounts may authenticate.
+	Project string `json:"project"`
+	// Audience is the audience identity tokens must be issued for (default: "nauts").
+	Audience string `json:"audience,omitempty"`
+	// JWKSURL overrides Google's JWKS URL (default: https://www.googleapis.com/oauth2/v3/certs).
+	JWKSURL string `json:"jwksUrl,omitempty"`
+	// JWKSRefreshInterval is how often JWKS keys are refreshed (e.g., "1h", default: 1h).
+	JWKSRefreshInterval string `json:"jwksRefreshInterval,omitempty"`
+	// AllowedCidrs restricts the provider to clients from these networks
+	// (e.g., "10.0.0.0/8"). Empty allows all clients.
+	AllowedCidrs []string `json:"allowedCidrs,omitempty"`
+	// RoleMapping maps the groups and roles of verified users to nauts roles.
+	RoleMapping *identity.RoleMappingConfig `json:"roleMapping,omitempty"`
+	// Resilience bounds and retries the provider's verifications, and
+	// overrides server.circuitBreaker for it.
+	Resilience *ProviderResilienceConfig `json:"resilience,omitempty"`
+}
+
+type AzureAuthProviderConfig struct {
+	ID string `json:"id"`
+
+	Accounts []string `json:"accounts"`
+	// TenantID is the Azure AD tenant that issues the tokens.
+	TenantID string `json:"tenantId"`
+	// SubscriptionID is the subscription the managed identities must belong to.
+	SubscriptionID string `json:"subscriptionId"`
+	// Audience is the application ID URI of the nauts app registration (e.g., "api://nauts").
+	Audience string `json:"audience"`
+	// JWKSURL overrides the tenant's JWKS URL.
+	JWKSURL string `json:"jwksUrl,omitempty"`
+	// JWKSRefreshInterval is how often JWKS keys are refreshed (e.g., "1h", default: 1h).
+	JWKSRefreshInterval string `json:"jwksRefreshInterval,omitempty"`
+	// AllowedCidrs restricts the provider to clients from these networks
+	// (e.g., "10.0.0.0/8"). Empty allows all clients.
+	AllowedCidrs []string `json:"allowedCidrs,omitempty"`
+	// RoleMapping maps the groups and roles of verified users to nauts roles.
+	RoleMapping *identity.RoleMappingConfig `json:"roleMapping,omitempty"`
+	// Resilience bounds and retries the provider's verifications, and
+	// overrides server.circuitBreaker for it.
+	Resilience *ProviderResilienceConfig `json:"resilience,omitempty"`
+}
+
+type KubernetesAuthProviderConfig struct {
+	ID string `json:"id"`
+
+	Accounts []string `json:"accounts"`
+	// Verification is "tokenReview" (default) or "jwks".
+	Verification string `json:"verification,omitempty"`
+	// Audience is the audience service account tokens must be issued for (default: "nauts").
+	Audience string `json:"audience,omitempty"`
+	// APIServer, TokenPath, and CAPath configure API server access for
+	// TokenReview and annotations (default: in-cluster).
+	APIServer string `json:"apiServer,omitempty"`
+	TokenPath string `json:"tokenPath,omitempty"`
+	CAPath    string `json:"caPath,omitempty"`
+	// Issuer is the service account token issuer (required for "jwks").
+	Issuer string `json:"issuer,omitempty"`
+	// JWKSURL overrides the JWKS URL from the issuer's discovery document.
+	JWKSURL string `json:"jwksUrl,omitempty"`
+	// JWKSRefreshInterval is how often JWKS keys are refreshed (e.g., "1h", default: 1h).
+	JWKSRefreshInterval string `json:"jwksRefreshInterval,omitempty"`
+	// Annotations reads roles from the nauts.io/roles annotation of the
+	// service account instead of the nauts.<account>.<role> naming convention.
+	Annotations bool `json:"annotations,omitempty"`
+	// AllowedCidrs restricts the provider to clients from these networks
+	// (e.g., "10.0.0.0/8"). Empty allows all clients.
+	AllowedCidrs []string `json:"allowedCidrs,omitempty"`
+	// RoleMapping maps the groups and roles of verified users to nauts roles.
+	RoleMapping *identity.RoleMappingConfig `json:"roleMapping,omitempty"`
+	// Resilience bounds and retries the provider's verifications, and
+	// overrides server.circuitBreaker for it.
+	Resilience *ProviderResilienceConfig `json:"resilience,omitempty"`
+}
+
+type NkeyAuthProviderConfig struct {
+	ID string `json:"id"`
+
+	Accounts []string `json:"accounts"`
+	// KeysPath is a JSON file mapping user public keys to identities.
+	// Exactly one of KeysPath and Bucket must be set.
+	KeysPath string `json:"keysPath,omitempty"`
+	// Bucket is a NATS KV bucket holding an identity per user public key,
+	// read over the server.natsUrl connection. It must already exist.
+	Bucket string `json:"bucket,omitempty"`
+	// AllowedCidrs restricts the provider to clients from these networks
+	// (e.g., "10.0.0.0/8"). Empty allows all clients.
+	AllowedCidrs []string `json:"allowedCidrs,omitempty"`
+	// RoleMapping maps the groups and roles of verified users to nauts roles.
+	RoleMapping *identity.RoleMappingConfig `json:"roleMapping,omitempty"`
+	// Resilience bounds and retries the provider's verifications, and
+	// overrides server.circuitBreaker for it.
+	Resilience *ProviderResilienceConfig `json:"resilience,omitempty"`
 }
 
 // ServerConfig configures the auth callout service.
@@ -100,190 +469,1413 @@ type ServerConfig struct {
 	NatsNkey string `json:"natsNkey,omitempty"`
 
 	// XKeySeedFile is the path to a file containing the XKey seed for encryption/decryption.
-	XKeySeedFile string `json:"xkeySeedFile,omitempty"`
+	XKeySeedFile string `json:"xkeySeedFile,omitempty" secret:"file"`
 
 	// TTL is the default JWT time-to-live as a duration string (e.g., "1h", "30m").
 	TTL string `json:"ttl,omitempty"`
+
+	// ResponseCacheTTL caches signed callout responses for retried requests as a
+	// duration string (e.g., "5s"). Empty disables the cache.
+	ResponseCacheTTL string `json:"responseCacheTtl,omitempty"`
+
+	// PermissionCacheTTL caches compiled permissions per account and role set
+	// as a duration string (e.g., "1m"). Empty disables the cache.
+	PermissionCacheTTL string `json:"permissionCacheTtl,omitempty"`
+
+	// CoalesceRequests lets concurrent identical auth requests (same account,
+	// credentials, and client) share one verification and permission
+	// compilation, e.g. during reconnect storms.
+	CoalesceRequests bool `json:"coalesceRequests,omitempty"`
+
+	// CalloutSubjects overrides the subjects on which auth callout requests are
+	// received. Default: ["$SYS.REQ.USER.AUTH"].
+	CalloutSubjects []string `json:"calloutSubjects,omitempty"`
+
+	// DelegateSubject forwards requests for accounts nauts does not manage to
+	// another auth callout service listening on this subject.
+	DelegateSubject string `json:"delegateSubject,omitempty"`
+
+	// DelegateTimeout bounds forwarded requests as a duration string. Default: "2s".
+	DelegateTimeout string `json:"delegateTimeout,omitempty"`
+
+	// ErrorDetail appends the failed step and backend to callout error
+	// responses (see CalloutConfig.ErrorDetail). For development only.
+	ErrorDetail bool `json:"errorDetail,omitempty"`
+
+	// ShadowMode authenticates requests and records the outcome without
+	// using it, for rolling out nauts next to an existing auth system. Nil
+	// disables shadow mode.
+	ShadowMode *ShadowModeConfig `json:"shadowMode,omitempty"`
+
+	// JWTSizeWarnBytes logs a warning for every issued user JWT of at least this
+	// many bytes, as a number or a size string (e.g. "8KiB"). 0 disables the
+	// warning; sizes are always recorded in the metrics.
+	JWTSizeWarnBytes units.Size `json:"jwtSizeWarnBytes,omitempty"`
+
+	// UserKeyStrategy determines the JWT subject key when no user public key is
+	// provided: "ephemeral" (default), "reject", or "derived".
+	UserKeyStrategy string `json:"userKeyStrategy,omitempty"`
+
+	// UserKeySecretFile is the path to a file containing the secret used to
+	// derive user keys. Required when UserKeyStrategy is "derived".
+	UserKeySecretFile string `json:"userKeySecretFile,omitempty" secret:"file"`
+
+	// UserPassword accepts the user and password connect options of NATS
+	// clients (e.g. nats --user --password) in place of a token. Nil rejects
+	// connections without a token.
+	UserPassword *UserPasswordConfig `json:"userPassword,omitempty"`
+
+	// Nkey accepts clients that connect with a user nkey in place of a
+	// token. Defaults to the only nkey auth provider, if exactly one is
+	// configured.
+	Nkey *NkeyConfig `json:"nkey,omitempty"`
+
+	// UserIDNormalization rewrites the IDs of verified users in order, before
+	// they are used in policies, inbox subjects, and JWT names. Empty keeps
+	// the IDs returned by the providers.
+	UserIDNormalization []UserIDNormalizationConfig `json:"userIdNormalization,omitempty"`
+
+	// CircuitBreaker guards every auth provider and the policy provider with a
+	// circuit breaker. Nil disables circuit breaking.
+	CircuitBreaker *CircuitBreakerConfig `json:"circuitBreaker,omitempty"`
+
+	// Audit records every authentication decision. Nil disables auditing.
+	Audit *AuditConfig `json:"audit,omitempty"`
+
+	// ReloadHistory is the number of previous configurations kept in memory
+	// after a reload, for rollback. Default: 3 (DefaultReloadHistory).
+	ReloadHistory int `json:"reloadHistory,omitempty"`
+
+	// Admin configures the admin service (--enable-admin-svc).
+	Admin *AdminConfig `json:"admin,omitempty"`
+
+	// HTTP serves health checks, metrics, and debug requests on an HTTP
+	// listener. Nil disables the listener.
+	HTTP *HTTPConfig `json:"http,omitempty"`
+
+	// GRPC serves one-shot authentication over gRPC (see authrpc) to
+	// components that do not connect through auth callout. Nil disables the
+	// listener.
+	GRPC *GRPCConfig `json:"grpc,omitempty"`
+
+	// Subscription tunes back-pressure on the callout subscriptions. Nil keeps
+	// the NATS client defaults.
+	Subscription *SubscriptionConfig `json:"subscription,omitempty"`
+
+	// MaxConcurrentRequests handles callout requests on this many workers, so
+	// that bursts are processed in parallel. 0 handles them one at a time per
+	// callout subject.
+	MaxConcurrentRequests int `json:"maxConcurrentRequests,omitempty"`
+
+	// RequestQueueDepth bounds the requests waiting for a worker; requests
+	// beyond it are rejected with "too many requests". Requires
+	// maxConcurrentRequests. Default: 1024.
+	RequestQueueDepth int `json:"requestQueueDepth,omitempty"`
+
+	// Revocation tracks issued JWTs by jti in a NATS KV bucket, so that they
+	// can be revoked through the admin service. Nil disables tracking.
+	Revocation *RevocationConfig `json:"revocation,omitempty"`
+
+	// RateLimit throttles auth requests per account and per user. Nil
+	// disables rate limiting.
+	RateLimit *RateLimitConfig `json:"rateLimit,omitempty"`
+
+	// BindingExpiryWarning is how long before a binding's expiresAt
+	// authentications using it log a warning, as a duration string.
+	// Default: "24h"; "0s" disables the warnings.
+	BindingExpiryWarning string `json:"bindingExpiryWarning,omitempty"`
+
+	// FaultInjection delays and fails a percentage of provider calls and
+	// callout responses, for resilience testing in staging. It only takes
+	// effect if the NAUTS_FAULT_INJECTION environment variable is true.
+	FaultInjection *FaultInjectionConfig `json:"faultInjection,omitempty"`
 }
 
-// LoadConfig reads and parses a configuration file.
-func LoadConfig(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("reading config file: %w", err)
-	}
+// FaultInjectionConfig configures fault injection.
+type FaultInjectionConfig struct {
+	// Targets selects where faults are injected: "auth" (authentication
+	// providers), "policy" (policy provider) and "nats" (callout responses).
+	// Empty selects all targets.
+	Targets []string `json:"targets,omitempty"`
 
-	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("parsing config file: %w", err)
-	}
+	// Delay is the injected latency as a duration string (e.g., "2s").
+	Delay string `json:"delay,omitempty"`
 
-	return &config, nil
+	// DelayPercent is the percentage of calls delayed by Delay (0-100).
+	DelayPercent float64 `json:"delayPercent,omitempty"`
+
+	// ErrorPercent is the percentage of calls that fail (0-100). Failed
+	// callout responses are dropped, so the server times out and retries.
+	ErrorPercent float64 `json:"errorPercent,omitempty"`
 }
 
-// Validate checks that the configuration is valid and complete.
-func (c *Config) Validate() error {
-	// Validate account config
-	if c.Account.Type == "" {
-		c.Account.Type = "static" // default to static
-	}
-	switch c.Account.Type {
-	case "operator":
-		if c.Account.Operator == nil {
-			return fmt.Errorf("account.operator configuration is required when type is 'operator'")
-		}
-		if len(c.Account.Operator.Accounts) == 0 {
-			return fmt.Errorf("account.operator.accounts must contain at least one account")
-		}
-		for name, accCfg := range c.Account.Operator.Accounts {
-			if name == "" {
-				return fmt.Errorf("account.operator.accounts contains an empty account name")
-			}
-			if accCfg.PublicKey == "" {
-				return fmt.Errorf("account.operator.accounts[%s].publicKey is required", name)
-			}
-			if accCfg.SigningKeyPath == "" {
-				return fmt.Errorf("account.operator.accounts[%s].signingKeyPath is required", name)
-			}
-		}
-	case "static":
-		if c.Account.Static == nil {
-			return fmt.Errorf("account.static configuration is required when type is 'static'")
-		}
-		if c.Account.Static.PublicKey == "" {
-			return fmt.Errorf("account.static.publicKey is required")
-		}
-		if c.Account.Static.PrivateKeyPath == "" {
-			return fmt.Errorf("account.static.privateKeyPath is required")
-		}
-		if len(c.Account.Static.Accounts) == 0 {
-			return fmt.Errorf("account.static.accounts must contain at least one account")
-		}
-		for i, name := range c.Account.Static.Accounts {
-			if name == "" {
-				return fmt.Errorf("account.static.accounts[%d] cannot be empty", i)
-			}
-		}
-	default:
-		return fmt.Errorf("unsupported account provider type: %s", c.Account.Type)
-	}
+// targets reports whether faults are injected into target.
+func (c *FaultInjectionConfig) targets(target string) bool {
+	return len(c.Targets) == 0 || slices.Contains(c.Targets, target)
+}
 
-	// Validate policy config
-	if c.Policy.Type == "" {
-		c.Policy.Type = "file" // default to file
-	}
-	switch c.Policy.Type {
-	case "file":
-		if c.Policy.File == nil {
-			return fmt.Errorf("policy.file configuration is required when type is 'file'")
-		}
-		if c.Policy.File.PoliciesPath == "" {
-			return fmt.Errorf("policy.file.policiesPath is required")
-		}
-		if c.Policy.File.BindingsPath == "" {
-			return fmt.Errorf("policy.file.bindingsPath is required")
-		}
-	case "nats":
-		if c.Policy.Nats == nil {
-			return fmt.Errorf("policy.nats configuration is required when type is 'nats'")
-		}
-		if c.Policy.Nats.Bucket == "" {
-			return fmt.Errorf("policy.nats.bucket is required")
-		}
-		if c.Policy.Nats.NatsURL == "" {
-			return fmt.Errorf("policy.nats.natsUrl is required")
-		}
-		if c.Policy.Nats.NatsCredentials != "" && c.Policy.Nats.NatsNkey != "" {
-			return fmt.Errorf("policy.nats.natsCredentials and policy.nats.natsNkey are mutually exclusive")
-		}
-	default:
-		return fmt.Errorf("unsupported policy provider type: %s", c.Policy.Type)
-	}
+// newInjector creates a fault injector from a validated configuration.
+func (c *FaultInjectionConfig) newInjector(name string) *FaultInjector {
+	delay, _ := units.ParseDuration(c.Delay)
+	return NewFaultInjector(name, delay, c.DelayPercent, c.ErrorPercent)
+}
 
-	// Validate identity config
-	providerCount := len(c.Auth.JWT) + len(c.Auth.File) + len(c.Auth.Aws)
-	if providerCount == 0 {
-		return fmt.Errorf("auth must contain at least one authentication provider")
+// activeFaultInjection returns the fault injection configuration if it is
+// enabled by FaultInjectionEnv, or nil.
+func (c *ServerConfig) activeFaultInjection() *FaultInjectionConfig {
+	if c.FaultInjection == nil || !FaultInjectionEnabled() {
+		return nil
 	}
+	return c.FaultInjection
+}
 
-	ids := make(map[string]struct{}, providerCount)
-	for i, p := range c.Auth.File {
-		if strings.TrimSpace(p.ID) == "" {
-			return fmt.Errorf("auth.file[%d].id is required", i)
-		}
-		if _, ok := ids[p.ID]; ok {
-			return fmt.Errorf("auth providers contain duplicate id: %s", p.ID)
-		}
-		ids[p.ID] = struct{}{}
-		if p.UsersPath == "" {
-			return fmt.Errorf("auth.file[%s].userPath is required", p.ID)
-		}
-		if len(p.Accounts) == 0 {
-			return fmt.Errorf("auth.file[%s].accounts must contain at least one account", p.ID)
-		}
-	}
-	for i, p := range c.Auth.JWT {
-		if strings.TrimSpace(p.ID) == "" {
-			return fmt.Errorf("auth.jwt[%d].id is required", i)
-		}
-		if _, ok := ids[p.ID]; ok {
-			return fmt.Errorf("auth providers contain duplicate id: %s", p.ID)
-		}
-		ids[p.ID] = struct{}{}
-		if p.Issuer == "" {
-			return fmt.Errorf("auth.jwt[%s].issuer is required", p.ID)
-		}
-		if p.PublicKey == "" {
-			return fmt.Errorf("auth.jwt[%s].publicKey is required", p.ID)
-		}
-		if len(p.Accounts) == 0 {
-			return fmt.Errorf("auth.jwt[%s].accounts must contain at least one account", p.ID)
-		}
-	}
-	for i, p := range c.Auth.Aws {
-		if strings.TrimSpace(p.ID) == "" {
-			return fmt.Errorf("auth.aws[%d].id is required", i)
-		}
-		if _, ok := ids[p.ID]; ok {
-			return fmt.Errorf("auth providers contain duplicate id: %s", p.ID)
-		}
-		ids[p.ID] = struct{}{}
-		if len(p.Accounts) == 0 {
-			return fmt.Errorf("auth.aws[%s].accounts must contain at least one account", p.ID)
-		}
-		if strings.TrimSpace(p.AWSAccount) == "" {
-			return fmt.Errorf("auth.aws[%s].awsAccount is required", p.ID)
-		}
-		if p.AWSAccount == "*" || strings.Contains(p.AWSAccount, "*") {
-			return fmt.Errorf("auth.aws[%s].awsAccount must not contain wildcards", p.ID)
-		}
-	}
+// RevocationConfig configures the revocation list.
+type RevocationConfig struct {
+	// Bucket is the NATS KV bucket holding issued and revoked tokens. It is
+	// created if it does not exist. Default: "nauts-revocations".
+	Bucket string `json:"bucket,omitempty"`
 
-	return nil
+	// Retention is how long issued and revoked tokens are kept, as a duration
+	// string. Tokens can only be revoked while they are tracked, so it should
+	// be at least the longest JWT TTL. Default: "24h".
+	Retention string `json:"retention,omitempty"`
+
+	// Push enforces revocations on the NATS servers by updating the account
+	// JWTs. Operator mode only. Nil only records revocations.
+	Push *RevocationPushConfig `json:"push,omitempty"`
 }
 
-// GetTTL returns the TTL as a time.Duration, or the default if not set.
-func (c *ServerConfig) GetTTL(defaultTTL time.Duration) time.Duration {
-	if c.TTL == "" {
-		return defaultTTL
-	}
-	d, err := time.ParseDuration(c.TTL)
-	if err != nil {
-		return defaultTTL
-	}
-	return d
+// RevocationPushConfig configures how revocations are pushed to the servers.
+type RevocationPushConfig struct {
+	// SystemCredentials is the path to the credentials file of a system
+	// account user, used to look up and update account JWTs.
+	SystemCredentials string `json:"systemCredentials"`
+
+	// OperatorSigningKeyPath is the path to an operator signing key seed
+	// (.nk file), a secret:// reference, or a vault://kv reference that
+	// re-signs the account JWTs.
+	OperatorSigningKeyPath string `json:"operatorSigningKeyPath" secret:"file"`
 }
 
-// GetXKeySeed returns the XKey seed, reading from file.
-func (c *ServerConfig) GetXKeySeed() (string, error) {
-	if c.XKeySeedFile == "" {
-		return "", nil
+// GetRetention returns the retention as a time.Duration, defaulting to
+// DefaultRevocationRetention.
+func (c *RevocationConfig) GetRetention() (time.Duration, error) {
+	if c.Retention == "" {
+		return DefaultRevocationRetention, nil
 	}
-	data, err := os.ReadFile(c.XKeySeedFile)
+	d, err := units.ParseDuration(c.Retention)
 	if err != nil {
-		return "", fmt.Errorf("reading xkey seed file: %w", err)
+		return 0, fmt.Errorf("invalid server.revocation.retention: %w", err)
 	}
-	return strings.TrimSpace(string(data)), nil
+	if d <= 0 {
+		return 0, fmt.Errorf("server.revocation.retention must be positive")
+	}
+	return d, nil
+}
+
+// SubscriptionConfig configures the pending limits and slow consumer handling
+// of the callout subscriptions.
+type SubscriptionConfig struct {
+	// PendingMsgs is the number of requests buffered per subscription before
+	// new ones are dropped. 0 keeps the client default (524288), -1 removes
+	// the limit.
+	PendingMsgs int `json:"pendingMsgs,omitempty"`
+
+	// PendingBytes is the number of bytes buffered per subscription before new
+	// requests are dropped, as a number or a size string (e.g. "128MiB"). 0
+	// keeps the client default (64 MiB), -1 removes the limit.
+	PendingBytes units.Size `json:"pendingBytes,omitempty"`
+
+	// SlowConsumerLogInterval rate-limits slow consumer warnings.
+	// Default: "10s".
+	SlowConsumerLogInterval string `json:"slowConsumerLogInterval,omitempty"`
+}
+
+// ShadowModeConfig configures shadow mode.
+type ShadowModeConfig struct {
+	// Response is what clients get instead of the nauts result:
+	// "passthrough" (default) relays the response of the auth service on
+	// server.delegateSubject, "deny" rejects every request.
+	Response string `json:"response,omitempty"`
+}
+
+// GetResponse returns the configured shadow mode response.
+func (c *ShadowModeConfig) GetResponse() ShadowMode {
+	if c.Response == "" {
+		return ShadowPassthrough
+	}
+	return ShadowMode(c.Response)
+}
+
+// RateLimitConfig configures the token buckets limiting auth requests.
+// Requests beyond a limit are rejected with "too many requests".
+type RateLimitConfig struct {
+	// AccountPerSecond is the average number of auth requests allowed per
+	// account and second. 0 disables the account limit.
+	AccountPerSecond float64 `json:"accountPerSecond,omitempty"`
+
+	// AccountBurst is the number of requests an account may make at once.
+	// Default: AccountPerSecond, rounded up.
+	AccountBurst int `json:"accountBurst,omitempty"`
+
+	// UserPerSecond is the average number of authentications allowed per user
+	// ID and second, within an account. The user is known after verification,
+	// so the account limit also bounds requests with invalid credentials.
+	// 0 disables the user limit.
+	UserPerSecond float64 `json:"userPerSecond,omitempty"`
+
+	// UserBurst is the number of authentications a user may make at once.
+	// Default: UserPerSecond, rounded up.
+	UserBurst int `json:"userBurst,omitempty"`
+}
+
+// AdminConfig configures the authorization of the admin service.
+type AdminConfig struct {
+	// TokenFile is the path to a file containing the token that admin requests
+	// must carry in the Nauts-Admin-Token header. Setting it also enables the
+	// policy and binding management subjects.
+	TokenFile string `json:"tokenFile,omitempty" secret:"file"`
+
+	// PendingBindings enables binding requests that holders of the admin
+	// token approve (nauts binding approve). Nil disables them.
+	PendingBindings *PendingBindingsConfig `json:"pendingBindings,omitempty"`
+}
+
+// HTTPConfig configures the HTTP listener. Metrics and debug requests must be
+// authenticated with a bearer token, a client certificate, or both; the
+// health checks are served to everyone, so that probes need no credentials.
+type HTTPConfig struct {
+	// Address is the address to listen on, e.g. ":8222" or "127.0.0.1:8222".
+	Address string `json:"address"`
+
+	// TLS serves HTTPS. Nil serves plain HTTP.
+	TLS *HTTPTLSConfig `json:"tls,omitempty"`
+
+	// TokenFile is the path to a file containing the token that requests to
+	// /metrics and /debug must carry as "Authorization: Bearer <token>".
+	TokenFile string `json:"tokenFile,omitempty" secret:"file"`
+
+	// Debug enables POST /debug, which compiles the permissions of a user like
+	// the NATS debug service.
+	Debug bool `json:"debug,omitempty"`
+
+	// Authenticate enables POST /v1/authenticate, which exchanges a nauts
+	// token for a user JWT so that browser and WebSocket clients can fetch
+	// credentials before connecting. Requires tls, as the request carries
+	// the user's credentials.
+	Authenticate bool `json:"authenticate,omitempty"`
+
+	// AllowedOrigins lists the origins browsers may call /v1/authenticate
+	// from, or "*" for any. Empty allows no cross-origin requests.
+	AllowedOrigins []string `json:"allowedOrigins,omitempty"`
+}
+
+// HTTPTLSConfig configures TLS for the HTTP listener.
+type HTTPTLSConfig struct {
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+
+	// ClientCAFile enables mTLS: requests to /metrics and /debug must present
+	// a client certificate signed by one of the CAs in this PEM file.
+	ClientCAFile string `json:"clientCaFile,omitempty"`
+}
+
+// GRPCConfig configures the gRPC listener. Every client must present a
+// certificate signed by one of the CAs in TLS.ClientCAFile.
+type GRPCConfig struct {
+	// Address is the address to listen on, e.g. ":4223".
+	Address string `json:"address"`
+
+	// TLS holds the server certificate and the client CAs; all three files
+	// are required.
+	TLS *HTTPTLSConfig `json:"tls"`
+
+	// AllowedClients restricts access to client certificates with one of
+	// these common names or DNS names. Empty allows every verified
+	// certificate.
+	AllowedClients []string `json:"allowedClients,omitempty"`
+}
+
+// PendingBindingsConfig configures the pending bindings.
+type PendingBindingsConfig struct {
+	// Bucket is the NATS KV bucket holding the binding requests. It is created
+	// if it does not exist. Default: "nauts-pending-bindings".
+	Bucket string `json:"bucket,omitempty"`
+
+	// Retention is how long a request waits for approval before it expires,
+	// as a duration string. Default: "168h".
+	Retention string `json:"retention,omitempty"`
+}
+
+// GetRetention returns the retention as a time.Duration, defaulting to
+// DefaultPendingBindingRetention.
+func (c *PendingBindingsConfig) GetRetention() (time.Duration, error) {
+	if c.Retention == "" {
+		return DefaultPendingBindingRetention, nil
+	}
+	d, err := units.ParseDuration(c.Retention)
+	if err != nil {
+		return 0, fmt.Errorf("invalid server.admin.pendingBindings.retention: %w", err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("server.admin.pendingBindings.retention must be positive")
+	}
+	return d, nil
+}
+
+// AuditConfig configures the audit log sinks. Any combination may be enabled.
+type AuditConfig struct {
+	// Stdout writes audit records as JSON lines to standard output.
+	Stdout bool `json:"stdout,omitempty"`
+
+	// File appends audit records as JSON lines to this path. The hash chain is
+	// resumed from the last record in the file.
+	File string `json:"file,omitempty"`
+
+	// Subject publishes audit records to this NATS subject, using the server's
+	// NATS URL and credentials.
+	Subject string `json:"subject,omitempty"`
+}
+
+// UserPasswordConfig maps user and password connect options to a file
+// authentication provider. The user may name the account as
+// "<account>/<username>".
+type UserPasswordConfig struct {
+	// Provider is the id of the file authentication provider. Optional if
+	// exactly one file provider is configured.
+	Provider string `json:"provider,omitempty"`
+	// DefaultAccount is used for users without an account prefix. Empty
+	// requires the prefix.
+	DefaultAccount string `json:"defaultAccount,omitempty"`
+}
+
+// userPasswordProvider returns the id of the file authentication provider of
+// server.userPassword: its provider, or else the only file provider. It is
+// empty if server.userPassword is unset or the provider is ambiguous.
+func (c *Config) userPasswordProvider() string {
+	up := c.Server.UserPassword
+	if up == nil {
+		return ""
+	}
+	if up.Provider == "" && len(c.Auth.File) == 1 {
+		return c.Auth.File[0].ID
+	}
+	return up.Provider
+}
+
+// NkeyConfig maps nkey connect options to an nkey authentication provider.
+// The user connect option names the account.
+type NkeyConfig struct {
+	// Provider is the id of the nkey authentication provider. Optional if
+	// exactly one nkey provider is configured.
+	Provider string `json:"provider,omitempty"`
+	// DefaultAccount is used for clients that do not set the user connect
+	// option. Empty requires it.
+	DefaultAccount string `json:"defaultAccount,omitempty"`
+}
+
+// nkeyConfig returns server.nkey with its defaults applied, or nil if nkey
+// authentication is disabled. A single nkey auth provider enables it, and is
+// the default provider.
+func (c *Config) nkeyConfig() *NkeyConfig {
+	if c.Server.Nkey == nil && len(c.Auth.Nkey) != 1 {
+		return nil
+	}
+	var nk NkeyConfig
+	if c.Server.Nkey != nil {
+		nk = *c.Server.Nkey
+	}
+	if nk.Provider == "" && len(c.Auth.Nkey) == 1 {
+		nk.Provider = c.Auth.Nkey[0].ID
+	}
+	return &nk
+}
+
+// CircuitBreakerConfig configures the provider circuit breakers.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures that opens a
+	// breaker. Default: 5.
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+
+	// OpenDuration is how long an open breaker rejects calls before probing
+	// the provider again, as a duration string. Default: "30s".
+	OpenDuration string `json:"openDuration,omitempty"`
+}
+
+// newBreaker creates a circuit breaker from a validated configuration.
+func (c *CircuitBreakerConfig) newBreaker(name string) *CircuitBreaker {
+	var openDuration time.Duration
+	if c.OpenDuration != "" {
+		openDuration, _ = units.ParseDuration(c.OpenDuration)
+	}
+	return NewCircuitBreaker(name, c.FailureThreshold, openDuration)
+}
+
+// validate checks the circuit breaker configuration; field prefixes errors.
+func (c *CircuitBreakerConfig) validate(field string) error {
+	if c.FailureThreshold < 0 {
+		return fmt.Errorf("%s.failureThreshold must not be negative", field)
+	}
+	if c.OpenDuration != "" {
+		d, err := units.ParseDuration(c.OpenDuration)
+		if err != nil {
+			return fmt.Errorf("invalid %s.openDuration: %w", field, err)
+		}
+		if d < 0 {
+			return fmt.Errorf("%s.openDuration must not be negative", field)
+		}
+	}
+	return nil
+}
+
+// ProviderResilienceConfig configures how the verifications of an
+// authentication provider are bounded and retried, so that a slow identity
+// backend fails logins fast instead of holding every callout until the NATS
+// server gives up.
+type ProviderResilienceConfig struct {
+	// Timeout bounds each verification attempt, as a duration string
+	// (e.g., "2s"). Empty leaves attempts bounded by the provider only.
+	Timeout string `json:"timeout,omitempty"`
+
+	// Retries is how often a verification is retried after the backend was
+	// unavailable or timed out. Invalid credentials are never retried.
+	// Default: 0.
+	Retries int `json:"retries,omitempty"`
+
+	// RetryBackoff is the delay before the first retry, doubled for every
+	// further retry, as a duration string. Default: "100ms".
+	RetryBackoff string `json:"retryBackoff,omitempty"`
+
+	// CircuitBreaker overrides server.circuitBreaker for the provider. It
+	// enables circuit breaking for the provider even if server.circuitBreaker
+	// is not set.
+	CircuitBreaker *CircuitBreakerConfig `json:"circuitBreaker,omitempty"`
+}
+
+// retryPolicy returns the RetryPolicy of a validated configuration.
+func (c *ProviderResilienceConfig) retryPolicy() RetryPolicy {
+	policy := RetryPolicy{Retries: c.Retries}
+	if c.Timeout != "" {
+		policy.Timeout, _ = units.ParseDuration(c.Timeout)
+	}
+	if c.RetryBackoff != "" {
+		policy.Backoff, _ = units.ParseDuration(c.RetryBackoff)
+	}
+	return policy
+}
+
+// validate checks the configuration; field prefixes errors.
+func (c *ProviderResilienceConfig) validate(field string) error {
+	for _, d := range []struct{ name, value string }{{"timeout", c.Timeout}, {"retryBackoff", c.RetryBackoff}} {
+		if d.value == "" {
+			continue
+		}
+		duration, err := units.ParseDuration(d.value)
+		if err != nil {
+			return fmt.Errorf("invalid %s.resilience.%s: %w", field, d.name, err)
+		}
+		if duration <= 0 {
+			return fmt.Errorf("%s.resilience.%s must be positive", field, d.name)
+		}
+	}
+	if c.Retries < 0 {
+		return fmt.Errorf("%s.resilience.retries must not be negative", field)
+	}
+	if c.CircuitBreaker != nil {
+		return c.CircuitBreaker.validate(field + ".resilience.circuitBreaker")
+	}
+	return nil
+}
+
+// LoadConfig reads and parses a JSON or YAML (.yaml, .yml) configuration file, resolves
+// ${ENV} and secret:// references (see ResolveReferences), and applies the
+// NAUTS_AUTH_<ID>_<FIELD> environment overrides (see ApplyEnvOverrides).
+func LoadConfig(path string) (*Config, error) {
+	config, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.ResolveReferences(os.LookupEnv); err != nil {
+		return nil, fmt.Errorf("resolving config file references: %w", err)
+	}
+	config.ApplyEnvOverrides(os.LookupEnv)
+	return config, nil
+}
+
+// readConfigFile reads and parses a configuration file without resolving
+// references or environment overrides, for callers that write the
+// configuration back.
+func readConfigFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	var config Config
+	if err := unmarshalYAMLOrJSON(path, data, &config); err != nil {
+		return nil, fmt.Errorf("parsing config file: %w", err)
+	}
+
+	return &config, nil
+}
+
+// isYAMLPath reports whether path has a .yaml or .yml extension.
+func isYAMLPath(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// unmarshalYAMLOrJSON decodes data into v. Files with a .yaml or .yml extension
+// are converted to JSON first so that the json struct tags apply to both formats.
+func unmarshalYAMLOrJSON(path string, data []byte, v any) error {
+	if isYAMLPath(path) {
+		var raw any
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+		converted, err := json.Marshal(raw)
+		if err != nil {
+			return err
+		}
+		data = converted
+		return json.Unmarshal(data, v)
+	}
+	return strictjson.Unmarshal(data, v)
+}
+
+// marshalYAMLOrJSON encodes v as indented JSON, or as block-style YAML for files
+// with a .yaml or .yml extension. Field order follows the json struct tags.
+func marshalYAMLOrJSON(path string, v any) ([]byte, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil || !isYAMLPath(path) {
+		return data, err
+	}
+	// JSON is valid YAML; decoding it into a node keeps the key order.
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	resetYAMLStyle(&node)
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// resetYAMLStyle switches flow-style (JSON) nodes to the default block style.
+func resetYAMLStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		resetYAMLStyle(c)
+	}
+}
+
+// SaveConfig atomically writes the configuration to path as indented JSON, or as
+// YAML if path has a .yaml or .yml extension.
+func SaveConfig(path string, config *Config) error {
+	data, err := marshalYAMLOrJSON(path, config)
+	if err != nil {
+		return fmt.Errorf("encoding config: %w", err)
+	}
+	data = bytes.TrimRight(data, "\n")
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("writing config file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing config file: %w", err)
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing config file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing config file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("writing config file: %w", err)
+	}
+	return nil
+}
+
+// Validate checks that the configuration is valid and complete.
+func (c *Config) Validate() error {
+	// Validate account config
+	if c.Account.Type == "" {
+		c.Account.Type = "static" // default to static
+	}
+	switch c.Account.Type {
+	case "operator":
+		if c.Account.Operator == nil {
+			return fmt.Errorf("account.operator configuration is required when type is 'operator'")
+		}
+		if len(c.Account.Operator.Accounts) == 0 {
+			return fmt.Errorf("account.operator.accounts must contain at least one account")
+		}
+		for name, accCfg := range c.Account.Operator.Accounts {
+			if name == "" {
+				return fmt.Errorf("account.operator.accounts contains an empty account name")
+			}
+			if accCfg.PublicKey == "" {
+				return fmt.Errorf("account.operator.accounts[%s].publicKey is required", name)
+			}
+			if accCfg.SigningKeyPath == "" {
+				return fmt.Errorf("account.operator.accounts[%s].signingKeyPath is required", name)
+			}
+		}
+		if m := c.Account.Operator.Manage; m != nil {
+			if m.OperatorSigningKeyPath == "" || m.SystemCredentials == "" {
+				return fmt.Errorf("account.operator.manage requires operatorSigningKeyPath and systemCredentials")
+			}
+		}
+	case "static":
+		if c.Account.Static == nil {
+			return fmt.Errorf("account.static configuration is required when type is 'static'")
+		}
+		if err := c.Account.Static.Validate(); err != nil {
+			return fmt.Errorf("account.static.%w", err)
+		}
+		if len(c.Account.Static.Accounts) == 0 {
+			return fmt.Errorf("account.static.accounts must contain at least one account")
+		}
+		for i, name := range c.Account.Static.Accounts {
+			if name == "" {
+				return fmt.Errorf("account.static.accounts[%d] cannot be empty", i)
+			}
+		}
+	case "vault":
+		if c.Account.Vault == nil {
+			return fmt.Errorf("account.vault configuration is required when type is 'vault'")
+		}
+		if err := c.Account.Vault.Validate(); err != nil {
+			return fmt.Errorf("account.vault: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported account provider type: %s", c.Account.Type)
+	}
+	if _, err := c.Account.GetTTLs(); err != nil {
+		return err
+	}
+	if err := c.Account.ValidateInboxes(); err != nil {
+		return err
+	}
+
+	// Validate policy config
+	if err := c.Policy.Validate(); err != nil {
+		return err
+	}
+
+	// Validate server config
+	if err := UserKeyStrategy(c.Server.UserKeyStrategy).Validate(); err != nil {
+		return fmt.Errorf("server.userKeyStrategy: %w", err)
+	}
+	if UserKeyStrategy(c.Server.UserKeyStrategy) == UserKeyDerived && c.Server.UserKeySecretFile == "" {
+		return fmt.Errorf("server.userKeySecretFile is required when userKeyStrategy is 'derived'")
+	}
+	if a := c.Server.Audit; a != nil {
+		if !a.Stdout && a.File == "" && a.Subject == "" {
+			return fmt.Errorf("server.audit must enable at least one of stdout, file, or subject")
+		}
+		if strings.ContainsAny(a.Subject, " \t\r\n*>") {
+			return fmt.Errorf("server.audit.subject must be a literal subject: %q", a.Subject)
+		}
+	}
+	if n, err := c.Server.JWTSizeWarnBytes.Bytes(); err != nil {
+		return fmt.Errorf("invalid server.jwtSizeWarnBytes: %w", err)
+	} else if n < 0 {
+		return fmt.Errorf("server.jwtSizeWarnBytes must not be negative")
+	}
+	if c.Server.PermissionCacheTTL != "" {
+		d, err := units.ParseDuration(c.Server.PermissionCacheTTL)
+		if err != nil {
+			return fmt.Errorf("invalid server.permissionCacheTtl: %w", err)
+		}
+		if d < 0 {
+			return fmt.Errorf("server.permissionCacheTtl must not be negative")
+		}
+	}
+	if c.Server.BindingExpiryWarning != "" {
+		d, err := units.ParseDuration(c.Server.BindingExpiryWarning)
+		if err != nil {
+			return fmt.Errorf("invalid server.bindingExpiryWarning: %w", err)
+		}
+		if d < 0 {
+			return fmt.Errorf("server.bindingExpiryWarning must not be negative")
+		}
+	}
+	if c.Server.ReloadHistory < 0 {
+		return fmt.Errorf("server.reloadHistory must not be negative")
+	}
+	if a := c.Server.Admin; a != nil {
+		if a.TokenFile == "" {
+			return fmt.Errorf("server.admin.tokenFile is required")
+		}
+		if pb := a.PendingBindings; pb != nil {
+			if _, err := pb.GetRetention(); err != nil {
+				return err
+			}
+			if strings.ContainsAny(pb.Bucket, " \t\r\n.*>") {
+				return fmt.Errorf("server.admin.pendingBindings.bucket must be a valid bucket name: %q", pb.Bucket)
+			}
+		}
+	}
+	if h := c.Server.HTTP; h != nil {
+		if h.Address == "" {
+			return fmt.Errorf("server.http.address is required")
+		}
+		if h.TLS != nil && (h.TLS.CertFile == "" || h.TLS.KeyFile == "") {
+			return fmt.Errorf("server.http.tls requires certFile and keyFile")
+		}
+		if h.TokenFile == "" && (h.TLS == nil || h.TLS.ClientCAFile == "") {
+			return fmt.Errorf("server.http requires tokenFile or tls.clientCaFile, so that metrics and debug data are not served unauthenticated")
+		}
+		if h.Authenticate && h.TLS == nil {
+			return fmt.Errorf("server.http.authenticate requires tls, so that credentials are not sent in plain text")
+		}
+		if len(h.AllowedOrigins) > 0 && !h.Authenticate {
+			return fmt.Errorf("server.http.allowedOrigins requires authenticate")
+		}
+	}
+	if g := c.Server.GRPC; g != nil {
+		if g.Address == "" {
+			return fmt.Errorf("server.grpc.address is required")
+		}
+		if g.TLS == nil || g.TLS.CertFile == "" || g.TLS.KeyFile == "" || g.TLS.ClientCAFile == "" {
+			return fmt.Errorf("server.grpc.tls requires certFile, keyFile, and clientCaFile, so that only clients with a certificate can obtain credentials")
+		}
+	}
+	if sc := c.Server.Subscription; sc != nil {
+		if sc.PendingMsgs < -1 {
+			return fmt.Errorf("server.subscription.pendingMsgs must be -1 (unlimited) or greater")
+		}
+		n, err := sc.PendingBytes.Bytes()
+		if err != nil {
+			return fmt.Errorf("invalid server.subscription.pendingBytes: %w", err)
+		}
+		if n < -1 {
+			return fmt.Errorf("server.subscription.pendingBytes must be -1 (unlimited) or greater")
+		}
+		if sc.SlowConsumerLogInterval != "" {
+			d, err := units.ParseDuration(sc.SlowConsumerLogInterval)
+			if err != nil {
+				return fmt.Errorf("invalid server.subscription.slowConsumerLogInterval: %w", err)
+			}
+			if d < 0 {
+				return fmt.Errorf("server.subscription.slowConsumerLogInterval must not be negative")
+			}
+		}
+	}
+	if c.Server.MaxConcurrentRequests < 0 {
+		return fmt.Errorf("server.maxConcurrentRequests must not be negative")
+	}
+	if c.Server.RequestQueueDepth < 0 {
+		return fmt.Errorf("server.requestQueueDepth must not be negative")
+	}
+	if c.Server.RequestQueueDepth > 0 && c.Server.MaxConcurrentRequests == 0 {
+		return fmt.Errorf("server.requestQueueDepth requires server.maxConcurrentRequests")
+	}
+	if rl := c.Server.RateLimit; rl != nil {
+		if rl.AccountPerSecond < 0 || rl.UserPerSecond < 0 {
+			return fmt.Errorf("server.rateLimit.accountPerSecond and userPerSecond must not be negative")
+		}
+		if rl.AccountBurst < 0 || rl.UserBurst < 0 {
+			return fmt.Errorf("server.rateLimit.accountBurst and userBurst must not be negative")
+		}
+		if rl.AccountPerSecond == 0 && rl.UserPerSecond == 0 {
+			return fmt.Errorf("server.rateLimit must set accountPerSecond or userPerSecond")
+		}
+	}
+	if sm := c.Server.ShadowMode; sm != nil {
+		switch sm.GetResponse() {
+		case ShadowPassthrough:
+			if c.Server.DelegateSubject == "" {
+				return fmt.Errorf("server.shadowMode.response 'passthrough' requires server.delegateSubject")
+			}
+		case ShadowDeny:
+		default:
+			return fmt.Errorf("server.shadowMode.response must be 'passthrough' or 'deny', got %q", sm.Response)
+		}
+	}
+	if r := c.Server.Revocation; r != nil {
+		if _, err := r.GetRetention(); err != nil {
+			return err
+		}
+		if strings.ContainsAny(r.Bucket, " \t\r\n.*>") {
+			return fmt.Errorf("server.revocation.bucket must be a valid bucket name: %q", r.Bucket)
+		}
+		if p := r.Push; p != nil {
+			if c.Account.Type != "operator" {
+				return fmt.Errorf("server.revocation.push requires account.type 'operator'")
+			}
+			if p.SystemCredentials == "" || p.OperatorSigningKeyPath == "" {
+				return fmt.Errorf("server.revocation.push requires systemCredentials and operatorSigningKeyPath")
+			}
+		}
+	}
+	if fi := c.Server.FaultInjection; fi != nil {
+		for _, target := range fi.Targets {
+			if target != FaultTargetAuth && target != FaultTargetPolicy && target != FaultTargetNats {
+				return fmt.Errorf("server.faultInjection.targets: unknown target %q (must be 'auth', 'policy' or 'nats')", target)
+			}
+		}
+		if fi.Delay != "" {
+			d, err := units.ParseDuration(fi.Delay)
+			if err != nil {
+				return fmt.Errorf("invalid server.faultInjection.delay: %w", err)
+			}
+			if d < 0 {
+				return fmt.Errorf("server.faultInjection.delay must not be negative")
+			}
+		}
+		if fi.DelayPercent < 0 || fi.DelayPercent > 100 || fi.ErrorPercent < 0 || fi.ErrorPercent > 100 {
+			return fmt.Errorf("server.faultInjection.delayPercent and errorPercent must be between 0 and 100")
+		}
+	}
+	if cb := c.Server.CircuitBreaker; cb != nil {
+		if err := cb.validate("server.circuitBreaker"); err != nil {
+			return err
+		}
+	}
+
+	// Validate identity config
+	providerCount := len(c.Auth.JWT) + len(c.Auth.File) + len(c.Auth.Aws) + len(c.Auth.Gcp) + len(c.Auth.Azure) + len(c.Auth.Kubernetes) + len(c.Auth.Nkey) + len(c.Auth.Custom)
+	if providerCount == 0 {
+		return fmt.Errorf("auth must contain at least one authentication provider")
+	}
+
+	ids := make(map[string]struct{}, providerCount)
+	for i, p := range c.Auth.File {
+		if strings.TrimSpace(p.ID) == "" {
+			return fmt.Errorf("auth.file[%d].id is required", i)
+		}
+		if _, ok := ids[p.ID]; ok {
+			return fmt.Errorf("auth providers contain duplicate id: %s", p.ID)
+		}
+		ids[p.ID] = struct{}{}
+		if p.UsersPath == "" {
+			return fmt.Errorf("auth.file[%s].userPath is required", p.ID)
+		}
+		if len(p.Accounts) == 0 {
+			return fmt.Errorf("auth.file[%s].accounts must contain at least one account", p.ID)
+		}
+		if p.PasswordHashing != nil {
+			if _, err := identity.NewPasswordHasher(*p.PasswordHashing); err != nil {
+				return fmt.Errorf("auth.file[%s].passwordHashing: %w", p.ID, err)
+			}
+		}
+		if _, err := identity.ParseNetworks(p.AllowedCidrs); err != nil {
+			return fmt.Errorf("auth.file[%s].allowedCidrs: %w", p.ID, err)
+		}
+	}
+	for i, p := range c.Auth.JWT {
+		if strings.TrimSpace(p.ID) == "" {
+			return fmt.Errorf("auth.jwt[%d].id is required", i)
+		}
+		if _, ok := ids[p.ID]; ok {
+			return fmt.Errorf("auth providers contain duplicate id: %s", p.ID)
+		}
+		ids[p.ID] = struct{}{}
+		if len(p.Issuers) == 0 {
+			if err := validateJwtIssuer(fmt.Sprintf("auth.jwt[%s]", p.ID), JwtIssuerConfig{
+				Issuer:              p.Issuer,
+				PublicKey:           p.PublicKey,
+				JWKSURL:             p.JWKSURL,
+				Discovery:           p.Discovery,
+				JWKSRefreshInterval: p.JWKSRefreshInterval,
+				Audience:            p.Audience,
+			}); err != nil {
+				return err
+			}
+		} else {
+			if p.Issuer != "" || p.PublicKey != "" || p.JWKSURL != "" || p.Discovery || p.JWKSRefreshInterval != "" || p.Audience != "" {
+				return fmt.Errorf("auth.jwt[%s].issuers is mutually exclusive with issuer, publicKey, jwksUrl, discovery, jwksRefreshInterval, and audience", p.ID)
+			}
+			seen := make(map[string]struct{}, len(p.Issuers))
+			for j, ic := range p.Issuers {
+				if err := validateJwtIssuer(fmt.Sprintf("auth.jwt[%s].issuers[%d]", p.ID, j), ic); err != nil {
+					return err
+				}
+				if _, ok := seen[ic.Issuer]; ok {
+					return fmt.Errorf("auth.jwt[%s].issuers contains duplicate issuer: %s", p.ID, ic.Issuer)
+				}
+				seen[ic.Issuer] = struct{}{}
+			}
+		}
+		if len(p.Accounts) == 0 {
+			return fmt.Errorf("auth.jwt[%s].accounts must contain at least one account", p.ID)
+		}
+		if _, err := identity.ParseNetworks(p.AllowedCidrs); err != nil {
+			return fmt.Errorf("auth.jwt[%s].allowedCidrs: %w", p.ID, err)
+		}
+	}
+	for i, p := range c.Auth.Aws {
+		if strings.TrimSpace(p.ID) == "" {
+			return fmt.Errorf("auth.aws[%d].id is required", i)
+		}
+		if _, ok := ids[p.ID]; ok {
+			return fmt.Errorf("auth providers contain duplicate id: %s", p.ID)
+		}
+		ids[p.ID] = struct{}{}
+		if len(p.Accounts) == 0 {
+			return fmt.Errorf("auth.aws[%s].accounts must contain at least one account", p.ID)
+		}
+		if strings.TrimSpace(p.AWSAccount) == "" {
+			return fmt.Errorf("auth.aws[%s].awsAccount is required", p.ID)
+		}
+		if p.AWSAccount == "*" || strings.Contains(p.AWSAccount, "*") {
+			return fmt.Errorf("auth.aws[%s].awsAccount must not contain wildcards", p.ID)
+		}
+		if _, err := identity.ParseNetworks(p.AllowedCidrs); err != nil {
+			return fmt.Errorf("auth.aws[%s].allowedCidrs: %w", p.ID, err)
+		}
+	}
+	for i, p := range c.Auth.Gcp {
+		if strings.TrimSpace(p.ID) == "" {
+			return fmt.Errorf("auth.gcp[%d].id is required", i)
+		}
+		if _, ok := ids[p.ID]; ok {
+			return fmt.Errorf("auth providers contain duplicate id: %s", p.ID)
+		}
+		ids[p.ID] = struct{}{}
+		if len(p.Accounts) == 0 {
+			return fmt.Errorf("auth.gcp[%s].accounts must contain at least one account", p.ID)
+		}
+		if strings.TrimSpace(p.Project) == "" {
+			return fmt.Errorf("auth.gcp[%s].project is required", p.ID)
+		}
+		if strings.Contains(p.Project, "*") {
+			return fmt.Errorf("auth.gcp[%s].project must not contain wildcards", p.ID)
+		}
+		if p.JWKSURL != "" {
+			if u, err := url.Parse(p.JWKSURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				return fmt.Errorf("auth.gcp[%s].jwksUrl must be an http(s) URL", p.ID)
+			}
+		}
+		if p.JWKSRefreshInterval != "" {
+			d, err := units.ParseDuration(p.JWKSRefreshInterval)
+			if err != nil {
+				return fmt.Errorf("invalid auth.gcp[%s].jwksRefreshInterval: %w", p.ID, err)
+			}
+			if d <= 0 {
+				return fmt.Errorf("auth.gcp[%s].jwksRefreshInterval must be positive", p.ID)
+			}
+		}
+		if _, err := identity.ParseNetworks(p.AllowedCidrs); err != nil {
+			return fmt.Errorf("auth.gcp[%s].allowedCidrs: %w", p.ID, err)
+		}
+	}
+	for i, p := range c.Auth.Azure {
+		if strings.TrimSpace(p.ID) == "" {
+			return fmt.Errorf("auth.azure[%d].id is required", i)
+		}
+		if _, ok := ids[p.ID]; ok {
+			return fmt.Errorf("auth providers contain duplicate id: %s", p.ID)
+		}
+		ids[p.ID] = struct{}{}
+		if len(p.Accounts) == 0 {
+			return fmt.Errorf("auth.azure[%s].accounts must contain at least one account", p.ID)
+		}
+		for _, f := range []struct{ name, value string }{{"tenantId", p.TenantID}, {"subscriptionId", p.SubscriptionID}, {"audience", p.Audience}} {
+			if strings.TrimSpace(f.value) == "" {
+				return fmt.Errorf("auth.azure[%s].%s is required", p.ID, f.name)
+			}
+			if strings.Contains(f.value, "*") {
+				return fmt.Errorf("auth.azure[%s].%s must not contain wildcards", p.ID, f.name)
+			}
+		}
+		if p.JWKSURL != "" {
+			if u, err := url.Parse(p.JWKSURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				return fmt.Errorf("auth.azure[%s].jwksUrl must be an http(s) URL", p.ID)
+			}
+		}
+		if p.JWKSRefreshInterval != "" {
+			d, err := units.ParseDuration(p.JWKSRefreshInterval)
+			if err != nil {
+				return fmt.Errorf("invalid auth.azure[%s].jwksRefreshInterval: %w", p.ID, err)
+			}
+			if d <= 0 {
+				return fmt.Errorf("auth.azure[%s].jwksRefreshInterval must be positive", p.ID)
+			}
+		}
+		if _, err := identity.ParseNetworks(p.AllowedCidrs); err != nil {
+			return fmt.Errorf("auth.azure[%s].allowedCidrs: %w", p.ID, err)
+		}
+	}
+	for i, p := range c.Auth.Kubernetes {
+		if strings.TrimSpace(p.ID) == "" {
+			return fmt.Errorf("auth.kubernetes[%d].id is required", i)
+		}
+		if _, ok := ids[p.ID]; ok {
+			return fmt.Errorf("auth providers contain duplicate id: %s", p.ID)
+		}
+		ids[p.ID] = struct{}{}
+		if len(p.Accounts) == 0 {
+			return fmt.Errorf("auth.kubernetes[%s].accounts must contain at least one account", p.ID)
+		}
+		switch p.Verification {
+		case "", identity.KubernetesVerificationTokenReview:
+		case identity.KubernetesVerificationJWKS:
+			if p.Issuer == "" {
+				return fmt.Errorf("auth.kubernetes[%s].issuer is required for jwks verification", p.ID)
+			}
+		default:
+			return fmt.Errorf("auth.kubernetes[%s]: unsupported verification %q (expected tokenReview or jwks)", p.ID, p.Verification)
+		}
+		for _, f := range []struct{ name, value string }{{"apiServer", p.APIServer}, {"jwksUrl", p.JWKSURL}} {
+			if f.value == "" {
+				continue
+			}
+			if u, err := url.Parse(f.value); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				return fmt.Errorf("auth.kubernetes[%s].%s must be an http(s) URL", p.ID, f.name)
+			}
+		}
+		if p.JWKSRefreshInterval != "" {
+			d, err := units.ParseDuration(p.JWKSRefreshInterval)
+			if err != nil {
+				return fmt.Errorf("invalid auth.kubernetes[%s].jwksRefreshInterval: %w", p.ID, err)
+			}
+			if d <= 0 {
+				return fmt.Errorf("auth.kubernetes[%s].jwksRefreshInterval must be positive", p.ID)
+			}
+		}
+		if _, err := identity.ParseNetworks(p.AllowedCidrs); err != nil {
+			return fmt.Errorf("auth.kubernetes[%s].allowedCidrs: %w", p.ID, err)
+		}
+	}
+	for i, p := range c.Auth.Nkey {
+		if strings.TrimSpace(p.ID) == "" {
+			return fmt.Errorf("auth.nkey[%d].id is required", i)
+		}
+		if _, ok := ids[p.ID]; ok {
+			return fmt.Errorf("auth providers contain duplicate id: %s", p.ID)
+		}
+		ids[p.ID] = struct{}{}
+		if len(p.Accounts) == 0 {
+			return fmt.Errorf("auth.nkey[%s].accounts must contain at least one account", p.ID)
+		}
+		if (p.KeysPath == "") == (p.Bucket == "") {
+			return fmt.Errorf("auth.nkey[%s]: exactly one of keysPath and bucket is required", p.ID)
+		}
+		if _, err := identity.ParseNetworks(p.AllowedCidrs); err != nil {
+			return fmt.Errorf("auth.nkey[%s].allowedCidrs: %w", p.ID, err)
+		}
+	}
+	for i, p := range c.Auth.Custom {
+		if strings.TrimSpace(p.ID) == "" {
+			return fmt.Errorf("auth.custom[%d].id is required", i)
+		}
+		if _, ok := ids[p.ID]; ok {
+			return fmt.Errorf("auth providers contain duplicate id: %s", p.ID)
+		}
+		ids[p.ID] = struct{}{}
+		if p.Type == "" {
+			return fmt.Errorf("auth.custom[%s].type is required", p.ID)
+		}
+		if _, ok := lookupAuthProviderFactory(p.Type); !ok {
+			return fmt.Errorf("auth.custom[%s]: provider type %q is not registered (registered: %s)", p.ID, p.Type, strings.Join(AuthProviderTypes(), ", "))
+		}
+		if len(p.Accounts) == 0 {
+			return fmt.Errorf("auth.custom[%s].accounts must contain at least one account", p.ID)
+		}
+		if _, err := identity.ParseNetworks(p.AllowedCidrs); err != nil {
+			return fmt.Errorf("auth.custom[%s].allowedCidrs: %w", p.ID, err)
+		}
+	}
+	for _, m := range c.Auth.roleMappings() {
+		if _, err := identity.NewRoleMapper(*m.config); err != nil {
+			return fmt.Errorf("%s.roleMapping.%w", m.field, err)
+		}
+	}
+	for _, r := range c.Auth.resiliences() {
+		if err := r.config.validate(r.field); err != nil {
+			return err
+		}
+	}
+
+	if up := c.Server.UserPassword; up != nil {
+		providerID := c.userPasswordProvider()
+		if providerID == "" {
+			return fmt.Errorf("server.userPassword.provider is required unless exactly one file auth provider is configured")
+		}
+		if !slices.ContainsFunc(c.Auth.File, func(p FileAuthProviderConfig) bool { return p.ID == providerID }) {
+			return fmt.Errorf("server.userPassword.provider must name a file auth provider: %s", providerID)
+		}
+		if strings.ContainsAny(up.DefaultAccount, "*/") {
+			return fmt.Errorf("server.userPassword.defaultAccount must be an account name: %q", up.DefaultAccount)
+		}
+	}
+	if nk := c.nkeyConfig(); nk != nil {
+		if nk.Provider == "" {
+			return fmt.Errorf("server.nkey.provider is required unless exactly one nkey auth provider is configured")
+		}
+		if !slices.ContainsFunc(c.Auth.Nkey, func(p NkeyAuthProviderConfig) bool { return p.ID == nk.Provider }) {
+			return fmt.Errorf("server.nkey.provider must name an nkey auth provider: %s", nk.Provider)
+		}
+		if strings.Contains(nk.DefaultAccount, "*") {
+			return fmt.Errorf("server.nkey.defaultAccount must be an account name: %q", nk.DefaultAccount)
+		}
+	}
+	if _, err := NewUserIDNormalizer(c.Server.UserIDNormalization); err != nil {
+		return err
+	}
+	for i, step := range c.Server.UserIDNormalization {
+		for _, id := range step.Providers {
+			if _, ok := ids[id]; !ok {
+				return fmt.Errorf("server.userIdNormalization[%d].providers: unknown auth provider %s", i, id)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateJwtIssuer checks an issuer of a JWT provider; path prefixes the
+// errors.
+func validateJwtIssuer(path string, ic JwtIssuerConfig) error {
+	if ic.Issuer == "" {
+		return fmt.Errorf("%s.issuer is required", path)
+	}
+	sources := 0
+	for _, set := range []bool{ic.PublicKey != "", ic.JWKSURL != "", ic.Discovery} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("%s: exactly one of publicKey, jwksUrl, and discovery is required", path)
+	}
+	if ic.JWKSURL != "" {
+		if u, err := url.Parse(ic.JWKSURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("%s.jwksUrl must be an http(s) URL", path)
+		}
+	}
+	if ic.JWKSRefreshInterval != "" {
+		d, err := units.ParseDuration(ic.JWKSRefreshInterval)
+		if err != nil {
+			return fmt.Errorf("invalid %s.jwksRefreshInterval: %w", path, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("%s.jwksRefreshInterval must be positive", path)
+		}
+	}
+	return nil
+}
+
+// jwksRefreshInterval parses a validated JWKS refresh interval; empty means
+// the provider default.
+func jwksRefreshInterval(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	d, _ := units.ParseDuration(s)
+	return d
+}
+
+// Validate checks that the policy provider configuration is valid.
+// An empty Type defaults to "file".
+func (c *PolicyConfig) Validate() error {
+	if c.Type == "" {
+		c.Type = "file" // default to file
+	}
+	switch c.Type {
+	case "file":
+		if c.File == nil {
+			return fmt.Errorf("policy.file configuration is required when type is 'file'")
+		}
+		if c.File.PoliciesPath == "" {
+			return fmt.Errorf("policy.file.policiesPath is required")
+		}
+		if c.File.BindingsPath == "" {
+			return fmt.Errorf("policy.file.bindingsPath is required")
+		}
+	case "nats":
+		if c.Nats == nil {
+			return fmt.Errorf("policy.nats configuration is required when type is 'nats'")
+		}
+		if c.Nats.Bucket == "" {
+			return fmt.Errorf("policy.nats.bucket is required")
+		}
+		if c.Nats.NatsURL == "" {
+			return fmt.Errorf("policy.nats.natsUrl is required")
+		}
+		if c.Nats.NatsCredentials != "" && c.Nats.NatsNkey != "" {
+			return fmt.Errorf("policy.nats.natsCredentials and policy.nats.natsNkey are mutually exclusive")
+		}
+		if err := c.Nats.Cache.Validate(); err != nil {
+			return fmt.Errorf("policy.nats.cache: %w", err)
+		}
+	case "sql":
+		if c.SQL == nil {
+			return fmt.Errorf("policy.sql configuration is required when type is 'sql'")
+		}
+		if c.SQL.DSN == "" && c.SQL.DSNFile == "" {
+			return fmt.Errorf("policy.sql.dsn or policy.sql.dsnFile is required")
+		}
+		if err := c.SQL.Validate(); err != nil {
+			return fmt.Errorf("policy.sql: %w", err)
+		}
+	case "consul":
+		if c.Consul == nil {
+			return fmt.Errorf("policy.consul configuration is required when type is 'consul'")
+		}
+		if err := c.Consul.Validate(); err != nil {
+			return fmt.Errorf("policy.consul: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported policy provider type: %s", c.Type)
+	}
+	if _, err := c.SubjectOwnership(); err != nil {
+		return fmt.Errorf("policy.ownership: %w", err)
+	}
+	if c.Canary != nil {
+		if c.Canary.Percent < 0 || c.Canary.Percent > 100 {
+			return fmt.Errorf("policy.canary.percent must be between 0 and 100")
+		}
+		cfg := c.Canary.policyConfig()
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("policy.canary: %w", err)
+		}
+		c.Canary.Type = cfg.Type
+	}
+	for i := range c.Routes {
+		route := &c.Routes[i]
+		if len(route.Accounts) == 0 {
+			return fmt.Errorf("policy.routes[%d].accounts is required", i)
+		}
+		for _, account := range route.Accounts {
+			if strings.TrimSpace(account) == "" {
+				return fmt.Errorf("policy.routes[%d].accounts must not contain empty names", i)
+			}
+		}
+		cfg := route.policyConfig()
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("policy.routes[%d]: %w", i, err)
+		}
+		route.Type = cfg.Type
+	}
+	return nil
+}
+
+// GetTTL returns the TTL as a time.Duration, or the default if not set.
+func (c *ServerConfig) GetTTL(defaultTTL time.Duration) time.Duration {
+	if c.TTL == "" {
+		return defaultTTL
+	}
+	d, err := units.ParseDuration(c.TTL)
+	if err != nil {
+		return defaultTTL
+	}
+	return d
+}
+
+// GetXKeySeed returns the XKey seed, reading from file. Seeds encrypted with
+// provider.EncryptSeed are decrypted with $NAUTS_KEY_PASSPHRASE.
+func (c *ServerConfig) GetXKeySeed() (string, error) {
+	if c.XKeySeedFile == "" {
+		return "", nil
+	}
+	data, err := readSecretFile(c.XKeySeedFile)
+	if err != nil {
+		return "", fmt.Errorf("reading xkey seed file: %w", err)
+	}
+	if data, err = provider.ResolveSeed(data); err != nil {
+		return "", fmt.Errorf("reading xkey seed file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// GetAdminToken returns the admin service token, reading from file, or "" if
+// no token is configured.
+func (c *ServerConfig) GetAdminToken() (string, error) {
+	if c.Admin == nil || c.Admin.TokenFile == "" {
+		return "", nil
+	}
+	data, err := readSecretFile(c.Admin.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("reading admin token file: %w", err)
+	}
+	token := string(data)
+	if token == "" {
+		return "", fmt.Errorf("admin token file %s is empty", c.Admin.TokenFile)
+	}
+	return token, nil
+}
+
+// GetToken returns the token of the HTTP listener, reading from file, or ""
+// if no token is configured.
+func (c *HTTPConfig) GetToken() (string, error) {
+	if c.TokenFile == "" {
+		return "", nil
+	}
+	data, err := readSecretFile(c.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("reading http token file: %w", err)
+	}
+	token := string(data)
+	if token == "" {
+		return "", fmt.Errorf("http token file %s is empty", c.TokenFile)
+	}
+	return token, nil
+}
+
+// GetUserKeySecret returns the secret for derived user keys, reading from file.
+func (c *ServerConfig) GetUserKeySecret() ([]byte, error) {
+	if c.UserKeySecretFile == "" {
+		return nil, nil
+	}
+	secret, err := readSecretFile(c.UserKeySecretFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading user key secret file: %w", err)
+	}
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("user key secret file %s is empty", c.UserKeySecretFile)
+	}
+	return secret, nil
+}
+
+// CompilationOptionsWithConfig returns the controller options of a validated
+// Config that affect permission compilation: account inboxes, binding expiry
+// warnings, subject ownership, and user ID normalization. NewAuthControllerWithConfig applies
+// them; tools compiling permissions without issuing JWTs (e.g., 'nauts
+// policy test') pass them to NewAuthController.
+func CompilationOptionsWithConfig(config *Config) ([]ControllerOption, error) {
+	var opts []ControllerOption
+	if len(config.Account.Inboxes) > 0 {
+		opts = append(opts, WithAccountInboxes(config.Account.Inboxes))
+	}
+	if config.Server.BindingExpiryWarning != "" {
+		d, _ := units.ParseDuration(config.Server.BindingExpiryWarning)
+		opts = append(opts, WithBindingExpiryWarning(d))
+	}
+	if ownership, _ := config.Policy.SubjectOwnership(); ownership != nil {
+		opts = append(opts, WithSubjectOwnership(ownership))
+	}
+	if steps := config.Server.UserIDNormalization; len(steps) > 0 {
+		normalizer, err := NewUserIDNormalizer(steps)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithUserIDNormalizer(normalizer))
+	}
+	return opts, nil
 }
 
 // NewAuthControllerWithConfig creates a new AuthController from a Config.
@@ -293,61 +1885,420 @@ func NewAuthControllerWithConfig(config *Config, opts ...ControllerOption) (*Aut
 		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
 
-	// Initialize account provider
-	var accountProvider provider.AccountProvider
-	var err error
+	accountProvider, err := newAccountProvider(config.Account)
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialize policy provider
+	var policyProvider provider.PolicyProvider
+	policyProvider, err = newPolicyStore(config.Policy)
+	if err != nil {
+		return nil, err
+	}
+
+	authProviders, breakers, faults, err := newAuthenticationProviderManager(config)
+	if err != nil {
+		return nil, err
+	}
+	// Faults are injected below the circuit breaker, so that they open it.
+	fi := config.Server.activeFaultInjection()
+	if fi != nil && fi.targets(FaultTargetPolicy) {
+		f := fi.newInjector(FaultTargetPolicy)
+		policyProvider = NewFaultInjectingPolicyProvider(policyProvider, f)
+		faults = append(faults, f)
+	}
+	if fi != nil && fi.targets(FaultTargetNats) {
+		faults = append(faults, fi.newInjector(FaultTargetNats))
+	}
+	if cb := config.Server.CircuitBreaker; cb != nil {
+		b := cb.newBreaker("policy")
+		policyProvider = NewCircuitBreakingPolicyProvider(policyProvider, b)
+		breakers = append(breakers, b)
+	}
+	if canary := config.Policy.Canary; canary != nil {
+		var candidate provider.PolicyProvider
+		candidate, err = newPolicyStore(canary.policyConfig())
+		if err != nil {
+			return nil, fmt.Errorf("policy canary: %w", err)
+		}
+		if cb := config.Server.CircuitBreaker; cb != nil {
+			b := cb.newBreaker("policy-canary")
+			candidate = NewCircuitBreakingPolicyProvider(candidate, b)
+			breakers = append(breakers, b)
+		}
+		opts = append([]ControllerOption{WithPolicyCanary(NewPolicyCanary(candidate, canary.Percent))}, opts...)
+	}
+
+	var userKeySecret []byte
+	if UserKeyStrategy(config.Server.UserKeyStrategy) == UserKeyDerived {
+		userKeySecret, err = config.Server.GetUserKeySecret()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	accountTTLs, err := config.Account.GetTTLs()
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := NewJWTSizeMetrics()
+	warnBytes, _ := config.Server.JWTSizeWarnBytes.Bytes()
+	metrics.WarnThreshold = int(warnBytes)
+	compileOpts, err := CompilationOptionsWithConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(compileOpts, opts...)
+	if config.Server.PermissionCacheTTL != "" {
+		d, _ := units.ParseDuration(config.Server.PermissionCacheTTL)
+		opts = append([]ControllerOption{WithPermissionCache(d)}, opts...)
+	}
+	if config.Server.CoalesceRequests {
+		opts = append([]ControllerOption{WithRequestCoalescing()}, opts...)
+	}
+	if up := config.Server.UserPassword; up != nil {
+		opts = append([]ControllerOption{WithUserPassword(config.userPasswordProvider(), up.DefaultAccount)}, opts...)
+	}
+	if nk := config.nkeyConfig(); nk != nil {
+		opts = append([]ControllerOption{WithNkeyAuthentication(nk.Provider, nk.DefaultAccount)}, opts...)
+	}
+	opts = append([]ControllerOption{
+		WithAccountTTLs(accountTTLs),
+		WithJWTSizeMetrics(metrics),
+		WithAccountStats(NewAccountStats()),
+		WithUserKeyStrategy(UserKeyStrategy(config.Server.UserKeyStrategy), userKeySecret),
+		WithCircuitBreakers(breakers...),
+		WithFaultInjectors(faults...),
+	}, opts...)
+
+	controller := NewAuthController(accountProvider, policyProvider, authProviders, opts...)
+
+	// An audit log passed with WithAuditLog (e.g., carried over on reload) takes precedence.
+	if controller.auditLog == nil && config.Server.Audit != nil {
+		auditLog, err := NewAuditLogWithConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		controller.auditLog = auditLog
+	}
+
+	// Likewise for a token tracker passed with WithTokenTracker.
+	if controller.tokenTracker == nil && config.Server.Revocation != nil {
+		list, err := NewRevocationListWithConfig(config)
+		if err != nil {
+			if controller.auditLog != nil {
+				_ = controller.auditLog.Close()
+			}
+			return nil, err
+		}
+		controller.tokenTracker = list
+	}
+
+	return controller, nil
+}
 
-	switch config.Account.Type {
+// newAccountProvider initializes the account provider for a validated AccountConfig.
+func newAccountProvider(cfg AccountConfig) (provider.AccountProvider, error) {
+	switch cfg.Type {
 	case "operator":
-		accountProvider, err = provider.NewOperatorAccountProvider(*config.Account.Operator)
+		p, err := provider.NewOperatorAccountProvider(*cfg.Operator)
 		if err != nil {
 			return nil, fmt.Errorf("initializing operator account provider: %w", err)
 		}
+		return p, nil
 	case "static":
-		accountProvider, err = provider.NewStaticAccountProvider(*config.Account.Static)
+		p, err := provider.NewStaticAccountProvider(*cfg.Static)
 		if err != nil {
 			return nil, fmt.Errorf("initializing static account provider: %w", err)
 		}
+		return p, nil
+	case "vault":
+		p, err := provider.NewVaultAccountProvider(*cfg.Vault)
+		if err != nil {
+			return nil, fmt.Errorf("initializing vault account provider: %w", err)
+		}
+		return p, nil
+	default:
+		return nil, fmt.Errorf("unsupported account provider type: %s", cfg.Type)
 	}
+}
 
-	// Initialize policy provider
-	var policyProvider provider.PolicyProvider
+// connectServerNats connects to NATS with the server's URL and credentials.
+func connectServerNats(config *Config, name string) (*nats.Conn, error) {
+	opts := []nats.Option{nats.Name(name)}
+	if config.Server.NatsCredentials != "" {
+		opts = append(opts, nats.UserCredentials(config.Server.NatsCredentials))
+	} else if config.Server.NatsNkey != "" {
+		opt, err := nats.NkeyOptionFromSeed(config.Server.NatsNkey)
+		if err != nil {
+			return nil, fmt.Errorf("loading nkey from %s: %w", config.Server.NatsNkey, err)
+		}
+		opts = append(opts, opt)
+	}
+	return nats.Connect(serverNatsURL(config), opts...)
+}
 
-	switch config.Policy.Type {
-	case "file":
-		policyProvider, err = provider.NewFilePolicyProvider(*config.Policy.File)
+// serverNatsURL returns the server's NATS URL, overridden by $NATS_URL.
+func serverNatsURL(config *Config) string {
+	if v := os.Getenv("NATS_URL"); v != "" {
+		return v
+	}
+	if config.Server.NatsURL != "" {
+		return config.Server.NatsURL
+	}
+	return nats.DefaultURL
+}
+
+// NewRevocationListWithConfig opens the revocation list described by
+// server.revocation, creating or updating its bucket, or returns nil if
+// revocation is disabled. The caller is responsible for closing it.
+func NewRevocationListWithConfig(config *Config) (*RevocationList, error) {
+	cfg := config.Server.Revocation
+	if cfg == nil {
+		return nil, nil
+	}
+	retention, err := cfg.GetRetention()
+	if err != nil {
+		return nil, err
+	}
+	bucket := cfg.Bucket
+	if bucket == "" {
+		bucket = DefaultRevocationBucket
+	}
+
+	nc, err := connectServerNats(config, "nauts-revocations")
+	if err != nil {
+		return nil, fmt.Errorf("connecting to NATS for revocations: %w", err)
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("creating jetstream context: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      bucket,
+		Description: "nauts issued and revoked user JWTs",
+		TTL:         retention,
+	})
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("opening revocation bucket %q: %w", bucket, err)
+	}
+
+	list := NewRevocationList(kv)
+	list.nc = nc
+	return list, nil
+}
+
+// NewPendingBindingsWithConfig opens the pending bindings described by
+// server.admin.pendingBindings, creating or updating their bucket, or returns
+// nil if they are disabled. The caller is responsible for closing them.
+func NewPendingBindingsWithConfig(config *Config) (*PendingBindings, error) {
+	if config.Server.Admin == nil || config.Server.Admin.PendingBindings == nil {
+		return nil, nil
+	}
+	cfg := config.Server.Admin.PendingBindings
+	retention, err := cfg.GetRetention()
+	if err != nil {
+		return nil, err
+	}
+	bucket := cfg.Bucket
+	if bucket == "" {
+		bucket = DefaultPendingBindingBucket
+	}
+
+	nc, err := connectServerNats(config, "nauts-pending-bindings")
+	if err != nil {
+		return nil, fmt.Errorf("connecting to NATS for pending bindings: %w", err)
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("creating jetstream context: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      bucket,
+		Description: "nauts binding requests waiting for approval",
+		TTL:         retention,
+	})
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("opening pending binding bucket %q: %w", bucket, err)
+	}
+
+	pending := NewPendingBindings(kv)
+	pending.nc = nc
+	return pending, nil
+}
+
+// NewRevocationPusherWithConfig creates the pusher described by
+// server.revocation.push for list, or returns nil if pushing is disabled.
+// The caller is responsible for closing it.
+func NewRevocationPusherWithConfig(config *Config, list *RevocationList) (*RevocationPusher, error) {
+	if config.Server.Revocation == nil || config.Server.Revocation.Push == nil {
+		return nil, nil
+	}
+	if list == nil {
+		return nil, errors.New("revocation list is required")
+	}
+	cfg := config.Server.Revocation.Push
+
+	data, err := readSecretFile(cfg.OperatorSigningKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading operator signing key: %w", err)
+	}
+	if data, err = provider.ResolveSeed(data); err != nil {
+		return nil, fmt.Errorf("reading operator signing key: %w", err)
+	}
+	signer, err := jwt.NewLocalSigner(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("loading operator signing key: %w", err)
+	}
+	if !strings.HasPrefix(signer.PublicKey(), "O") {
+		return nil, fmt.Errorf("server.revocation.push.operatorSigningKeyPath must contain an operator key")
+	}
+
+	nc, err := nats.Connect(serverNatsURL(config), nats.Name("nauts-revocation-push"), nats.UserCredentials(cfg.SystemCredentials))
+	if err != nil {
+		return nil, fmt.Errorf("connecting to NATS as system user: %w", err)
+	}
+
+	pusher := NewRevocationPusher(list, nc, signer)
+	pusher.owned = true
+	return pusher, nil
+}
+
+// NewAuditLogWithConfig creates the audit log described by server.audit, or
+// returns nil if auditing is disabled. The caller is responsible for closing it.
+func NewAuditLogWithConfig(config *Config) (*AuditLog, error) {
+	cfg := config.Server.Audit
+	if cfg == nil {
+		return nil, nil
+	}
+
+	var sinks []AuditSink
+	closeSinks := func() {
+		_ = NewAuditLog(sinks...).Close()
+	}
+	var seq uint64
+	var hash string
+	if cfg.Stdout {
+		sinks = append(sinks, NewWriterAuditSink(os.Stdout))
+	}
+	if cfg.File != "" {
+		sink, err := OpenFileAuditSink(cfg.File)
 		if err != nil {
-			return nil, fmt.Errorf("initializing file policy provider: %w", err)
+			return nil, err
 		}
-	case "nats":
-		policyProvider, err = provider.NewNatsPolicyProvider(*config.Policy.Nats)
+		seq, hash = sink.Head()
+		sinks = append(sinks, sink)
+	}
+	if cfg.Subject != "" {
+		opts := []nats.Option{nats.Name("nauts-audit")}
+		if config.Server.NatsCredentials != "" {
+			opts = append(opts, nats.UserCredentials(config.Server.NatsCredentials))
+		} else if config.Server.NatsNkey != "" {
+			opt, err := nats.NkeyOptionFromSeed(config.Server.NatsNkey)
+			if err != nil {
+				closeSinks()
+				return nil, fmt.Errorf("loading nkey from %s: %w", config.Server.NatsNkey, err)
+			}
+			opts = append(opts, opt)
+		}
+		nc, err := nats.Connect(config.Server.NatsURL, opts...)
 		if err != nil {
-			return nil, fmt.Errorf("initializing nats policy provider: %w", err)
+			closeSinks()
+			return nil, fmt.Errorf("connecting to NATS for audit: %w", err)
 		}
+		sink := NewNatsAuditSink(nc, cfg.Subject)
+		sink.owned = true
+		sinks = append(sinks, sink)
+	}
+
+	auditLog := NewAuditLog(sinks...)
+	auditLog.Resume(seq, hash)
+	return auditLog, nil
+}
+
+// NewAuthenticationProviderManagerWithConfig creates the authentication providers
+// described by the configuration, without account and policy providers. This
+// allows tooling to explain provider selection without access to signing keys.
+func NewAuthenticationProviderManagerWithConfig(config *Config) (*identity.AuthenticationProviderManager, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
+	authProviders, _, _, err := newAuthenticationProviderManager(config)
+	return authProviders, err
+}
 
+// newAuthenticationProviderManager initializes the authentication providers of a
+// validated configuration, wrapped in fault injectors and circuit breakers if
+// configured.
+func newAuthenticationProviderManager(config *Config) (*identity.AuthenticationProviderManager, []*CircuitBreaker, []*FaultInjector, error) {
 	providers := make(map[string]identity.AuthenticationProvider)
+	var managerOpts []identity.ManagerOption
+	allowNetworks := func(id string, cidrs []string) error {
+		networks, err := identity.ParseNetworks(cidrs)
+		if err != nil {
+			return fmt.Errorf("parsing allowed networks of authentication provider %q: %w", id, err)
+		}
+		managerOpts = append(managerOpts, identity.WithAllowedNetworks(id, networks))
+		return nil
+	}
 	for _, fc := range config.Auth.File {
-		p, err := identity.NewFileAuthenticationProvider(identity.FileAuthenticationProviderConfig{
+		fileCfg := identity.FileAuthenticationProviderConfig{
 			UsersPath: fc.UsersPath,
 			Accounts:  fc.Accounts,
-		})
+		}
+		if fc.PasswordHashing != nil {
+			fileCfg.PasswordHashing = *fc.PasswordHashing
+		}
+		p, err := identity.NewFileAuthenticationProvider(fileCfg)
 		if err != nil {
-			return nil, fmt.Errorf("initializing file authentication provider %q: %w", fc.ID, err)
+			return nil, nil, nil, fmt.Errorf("initializing file authentication provider %q: %w", fc.ID, err)
 		}
 		providers[fc.ID] = p
+		if err := allowNetworks(fc.ID, fc.AllowedCidrs); err != nil {
+			return nil, nil, nil, err
+		}
 	}
 	for _, jc := range config.Auth.JWT {
+		issuers := make([]identity.JwtIssuerConfig, 0, len(jc.Issuers))
+		for _, ic := range jc.Issuers {
+			issuers = append(issuers, identity.JwtIssuerConfig{
+				Issuer:              ic.Issuer,
+				PublicKey:           ic.PublicKey,
+				JWKSURL:             ic.JWKSURL,
+				Discovery:           ic.Discovery,
+				JWKSRefreshInterval: jwksRefreshInterval(ic.JWKSRefreshInterval),
+				Audience:            ic.Audience,
+			})
+		}
 		p, err := identity.NewJwtAuthenticationProvider(identity.JwtAuthenticationProviderConfig{
-			Accounts:       jc.Accounts,
-			Issuer:         jc.Issuer,
-			PublicKey:      jc.PublicKey,
-			RolesClaimPath: jc.RolesClaimPath,
+			Accounts:            jc.Accounts,
+			Issuer:              jc.Issuer,
+			PublicKey:           jc.PublicKey,
+			JWKSURL:             jc.JWKSURL,
+			Discovery:           jc.Discovery,
+			JWKSRefreshInterval: jwksRefreshInterval(jc.JWKSRefreshInterval),
+			Audience:            jc.Audience,
+			Issuers:             issuers,
+			RolesClaimPath:      jc.RolesClaimPath,
+			GroupsClaimPath:     jc.GroupsClaimPath,
 		})
 		if err != nil {
-			return nil, fmt.Errorf("initializing jwt authentication provider %q: %w", jc.ID, err)
+			return nil, nil, nil, fmt.Errorf("initializing jwt authentication provider %q: %w", jc.ID, err)
 		}
 		providers[jc.ID] = p
+		if err := allowNetworks(jc.ID, jc.AllowedCidrs); err != nil {
+			return nil, nil, nil, err
+		}
 	}
 	for _, ac := range config.Auth.Aws {
 		p, err := identity.NewAwsSigV4AuthenticationProvider(identity.AwsSigV4AuthenticationProviderConfig{
@@ -357,17 +2308,253 @@ func NewAuthControllerWithConfig(config *Config, opts ...ControllerOption) (*Aut
 			AWSAccount:   ac.AWSAccount,
 		})
 		if err != nil {
-			return nil, fmt.Errorf("initializing aws authentication provider %q: %w", ac.ID, err)
+			return nil, nil, nil, fmt.Errorf("initializing aws authentication provider %q: %w", ac.ID, err)
 		}
 		providers[ac.ID] = p
+		if err := allowNetworks(ac.ID, ac.AllowedCidrs); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	for _, gc := range config.Auth.Gcp {
+		var refreshInterval time.Duration
+		if gc.JWKSRefreshInterval != "" {
+			refreshInterval, _ = units.ParseDuration(gc.JWKSRefreshInterval)
+		}
+		p, err := identity.NewGcpAuthenticationProvider(identity.GcpAuthenticationProviderConfig{
+			Accounts:            gc.Accounts,
+			Project:             gc.Project,
+			Audience:            gc.Audience,
+			JWKSURL:             gc.JWKSURL,
+			JWKSRefreshInterval: refreshInterval,
+		})
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("initializing gcp authentication provider %q: %w", gc.ID, err)
+		}
+		providers[gc.ID] = p
+		if err := allowNetworks(gc.ID, gc.AllowedCidrs); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	for _, zc := range config.Auth.Azure {
+		var refreshInterval time.Duration
+		if zc.JWKSRefreshInterval != "" {
+			refreshInterval, _ = units.ParseDuration(zc.JWKSRefreshInterval)
+		}
+		p, err := identity.NewAzureAuthenticationProvider(identity.AzureAuthenticationProviderConfig{
+			Accounts:            zc.Accounts,
+			TenantID:            zc.TenantID,
+			SubscriptionID:      zc.SubscriptionID,
+			Audience:            zc.Audience,
+			JWKSURL:             zc.JWKSURL,
+			JWKSRefreshInterval: refreshInterval,
+		})
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("initializing azure authentication provider %q: %w", zc.ID, err)
+		}
+		providers[zc.ID] = p
+		if err := allowNetworks(zc.ID, zc.AllowedCidrs); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	for _, kc := range config.Auth.Kubernetes {
+		var refreshInterval time.Duration
+		if kc.JWKSRefreshInterval != "" {
+			refreshInterval, _ = units.ParseDuration(kc.JWKSRefreshInterval)
+		}
+		p, err := identity.NewKubernetesAuthenticationProvider(identity.KubernetesAuthenticationProviderConfig{
+			Accounts:            kc.Accounts,
+			Verification:        kc.Verification,
+			Audience:            kc.Audience,
+			APIServer:           kc.APIServer,
+			TokenPath:           kc.TokenPath,
+			CAPath:              kc.CAPath,
+			Issuer:              kc.Issuer,
+			JWKSURL:             kc.JWKSURL,
+			JWKSRefreshInterval: refreshInterval,
+			Annotations:         kc.Annotations,
+		})
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("initializing kubernetes authentication provider %q: %w", kc.ID, err)
+		}
+		providers[kc.ID] = p
+		if err := allowNetworks(kc.ID, kc.AllowedCidrs); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	for _, nc := range config.Auth.Nkey {
+		p, err := newNkeyAuthProvider(config, nc)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("initializing nkey authentication provider %q: %w", nc.ID, err)
+		}
+		providers[nc.ID] = p
+		if err := allowNetworks(nc.ID, nc.AllowedCidrs); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	for _, cc := range config.Auth.Custom {
+		p, err := newCustomAuthProvider(cc)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("initializing %s authentication provider %q: %w", cc.Type, cc.ID, err)
+		}
+		providers[cc.ID] = p
+		if err := allowNetworks(cc.ID, cc.AllowedCidrs); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	for _, m := range config.Auth.roleMappings() {
+		mapper, err := identity.NewRoleMapper(*m.config)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%s.roleMapping.%w", m.field, err)
+		}
+		providers[m.id] = identity.NewRoleMappingProvider(providers[m.id], mapper)
+	}
+
+	var faults []*FaultInjector
+	if fi := config.Server.activeFaultInjection(); fi != nil && fi.targets(FaultTargetAuth) {
+		for id, p := range providers {
+			f := fi.newInjector("auth:" + id)
+			providers[id] = NewFaultInjectingAuthProvider(p, f)
+			faults = append(faults, f)
+		}
+	}
+
+	// Retries run inside the breaker, which counts a verification as failed
+	// only once all attempts failed.
+	breakerConfigs := make(map[string]*CircuitBreakerConfig, len(providers))
+	for id := range providers {
+		breakerConfigs[id] = config.Server.CircuitBreaker
 	}
+	for _, r := range config.Auth.resiliences() {
+		providers[r.id] = NewRetryingAuthProvider(providers[r.id], r.id, r.config.retryPolicy())
+		if r.config.CircuitBreaker != nil {
+			breakerConfigs[r.id] = r.config.CircuitBreaker
+		}
+	}
+	var breakers []*CircuitBreaker
+	for id, p := range providers {
+		if cb := breakerConfigs[id]; cb != nil {
+			b := cb.newBreaker("auth:" + id)
+			providers[id] = NewCircuitBreakingAuthProvider(p, b)
+			breakers = append(breakers, b)
+		}
+	}
+
+	authProviders, err := identity.NewAuthenticationProviderManager(providers, managerOpts...)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("initializing authentication providers: %w", err)
+	}
+	return authProviders, breakers, faults, nil
+}
+
+// NewPolicyStoreWithConfig creates the policy store described by the configuration.
+// The caller is responsible for stopping stores that hold connections (see StopPolicyStore).
+func NewPolicyStoreWithConfig(config *Config) (provider.PolicyStore, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return newPolicyStore(config.Policy)
+}
+
+// NewPolicyStoreOfType creates a policy store of the given type ("file", "nats", "sql" or "consul")
+// from the corresponding section of the configuration, independent of policy.type.
+// This allows tooling to compare or sync two backends described by one config file.
+// The type "canary" selects the candidate store of policy.canary.
+func NewPolicyStoreOfType(config *Config, storeType string) (provider.PolicyStore, error) {
+	if storeType == "canary" {
+		if config.Policy.Canary == nil {
+			return nil, fmt.Errorf("invalid configuration: policy.canary is not configured")
+		}
+		cfg := config.Policy.Canary.policyConfig()
+		if err := cfg.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid configuration: policy.canary: %w", err)
+		}
+		return newPolicyStore(cfg)
+	}
+	cfg := PolicyConfig{
+		Type:   storeType,
+		File:   config.Policy.File,
+		Nats:   config.Policy.Nats,
+		SQL:    config.Policy.SQL,
+		Consul: config.Policy.Consul,
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return newPolicyStore(cfg)
+}
+
+// StopPolicyStore releases resources held by a policy store, if any.
+func StopPolicyStore(store provider.PolicyProvider) {
+	if s, ok := store.(interface{ Stop() error }); ok {
+		_ = s.Stop()
+	}
+}
 
-	authProviders, err := identity.NewAuthenticationProviderManager(providers)
+// newPolicyStore initializes the policy provider for a validated PolicyConfig,
+// routing accounts to the stores of cfg.Routes if any.
+func newPolicyStore(cfg PolicyConfig) (provider.PolicyStore, error) {
+	if len(cfg.Routes) == 0 {
+		return newPolicyStoreOfType(cfg)
+	}
+	routes := make([]provider.PolicyRoute, 0, len(cfg.Routes))
+	stopRoutes := func() {
+		for _, r := range routes {
+			StopPolicyStore(r.Store)
+		}
+	}
+	for i, rc := range cfg.Routes {
+		store, err := newPolicyStoreOfType(rc.policyConfig())
+		if err != nil {
+			stopRoutes()
+			return nil, fmt.Errorf("policy.routes[%d]: %w", i, err)
+		}
+		routes = append(routes, provider.PolicyRoute{Accounts: rc.Accounts, Store: store})
+	}
+	fallback, err := newPolicyStoreOfType(cfg)
+	if err != nil {
+		stopRoutes()
+		return nil, err
+	}
+	p, err := provider.NewRoutingPolicyProvider(routes, fallback)
 	if err != nil {
-		return nil, fmt.Errorf("initializing authentication providers: %w", err)
+		stopRoutes()
+		StopPolicyStore(fallback)
+		return nil, err
 	}
+	return p, nil
+}
 
-	return NewAuthController(accountProvider, policyProvider, authProviders, opts...), nil
+// newPolicyStoreOfType initializes the store described by cfg.Type.
+func newPolicyStoreOfType(cfg PolicyConfig) (provider.PolicyStore, error) {
+	switch cfg.Type {
+	case "file":
+		p, err := provider.NewFilePolicyProvider(*cfg.File)
+		if err != nil {
+			return nil, fmt.Errorf("initializing file policy provider: %w", err)
+		}
+		return p, nil
+	case "nats":
+		p, err := provider.NewNatsPolicyProvider(*cfg.Nats)
+		if err != nil {
+			return nil, fmt.Errorf("initializing nats policy provider: %w", err)
+		}
+		return p, nil
+	case "sql":
+		p, err := provider.NewSQLPolicyProvider(*cfg.SQL)
+		if err != nil {
+			return nil, fmt.Errorf("initializing sql policy provider: %w", err)
+		}
+		return p, nil
+	case "consul":
+		p, err := provider.NewConsulPolicyProvider(*cfg.Consul)
+		if err != nil {
+			return nil, fmt.Errorf("initializing consul policy provider: %w", err)
+		}
+		return p, nil
+	default:
+		return nil, fmt.Errorf("unsupported policy provider type: %s", cfg.Type)
+	}
 }
 
 // ToCalloutConfig converts the server configuration to a CalloutConfig.
@@ -377,11 +2564,57 @@ func (c *ServerConfig) ToCalloutConfig() (CalloutConfig, error) {
 		return CalloutConfig{}, err
 	}
 
-	return CalloutConfig{
-		NatsURL:         c.NatsURL,
-		NatsCredentials: c.NatsCredentials,
-		NatsNkey:        c.NatsNkey,
-		XKeySeed:        xkeySeed,
-		DefaultTTL:      c.GetTTL(time.Hour),
-	}, nil
+	var responseCacheTTL time.Duration
+	if c.ResponseCacheTTL != "" {
+		responseCacheTTL, err = units.ParseDuration(c.ResponseCacheTTL)
+		if err != nil {
+			return CalloutConfig{}, fmt.Errorf("invalid server.responseCacheTtl: %w", err)
+		}
+	}
+
+	var delegateTimeout time.Duration
+	if c.DelegateTimeout != "" {
+		delegateTimeout, err = units.ParseDuration(c.DelegateTimeout)
+		if err != nil {
+			return CalloutConfig{}, fmt.Errorf("invalid server.delegateTimeout: %w", err)
+		}
+	}
+
+	cfg := CalloutConfig{
+		NatsURL:          c.NatsURL,
+		NatsCredentials:  c.NatsCredentials,
+		NatsNkey:         c.NatsNkey,
+		XKeySeed:         xkeySeed,
+		DefaultTTL:       c.GetTTL(time.Hour),
+		ResponseCacheTTL: responseCacheTTL,
+		Subjects:         c.CalloutSubjects,
+		DelegateSubject:  c.DelegateSubject,
+		DelegateTimeout:  delegateTimeout,
+		ErrorDetail:      c.ErrorDetail,
+
+		MaxConcurrentRequests: c.MaxConcurrentRequests,
+		RequestQueueDepth:     c.RequestQueueDepth,
+	}
+	if c.ShadowMode != nil {
+		cfg.Shadow = c.ShadowMode.GetResponse()
+	}
+	if sc := c.Subscription; sc != nil {
+		cfg.PendingMsgsLimit = sc.PendingMsgs
+		pendingBytes, err := sc.PendingBytes.Bytes()
+		if err != nil {
+			return CalloutConfig{}, fmt.Errorf("invalid server.subscription.pendingBytes: %w", err)
+		}
+		cfg.PendingBytesLimit = int(pendingBytes)
+		if sc.SlowConsumerLogInterval != "" {
+			cfg.SlowConsumerLogInterval, err = units.ParseDuration(sc.SlowConsumerLogInterval)
+			if err != nil {
+				return CalloutConfig{}, fmt.Errorf("invalid server.subscription.slowConsumerLogInterval: %w", err)
+			}
+		}
+	}
+	if rl := c.RateLimit; rl != nil {
+		cfg.AccountRateLimit = RateLimit{PerSecond: rl.AccountPerSecond, Burst: rl.AccountBurst}
+		cfg.UserRateLimit = RateLimit{PerSecond: rl.UserPerSecond, Burst: rl.UserBurst}
+	}
+	return cfg, nil
 }
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// authEnvPrefix is the prefix of environment variables that override auth provider fields.
+const authEnvPrefix = "NAUTS_AUTH_"
+
+// AuthProviderEnvName returns the environment variable overriding field of the
+// auth provider with the given id: NAUTS_AUTH_<ID>_<FIELD>. The id is upper-cased
+// and every character other than A-Z and 0-9 is replaced by "_", so the provider
+// "corp-idp" becomes NAUTS_AUTH_CORP_IDP_ISSUER.
+func AuthProviderEnvName(id, field string) string {
+	normalized := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, id)
+	return authEnvPrefix + normalized + "_" + field
+}
+
+// ApplyEnvOverrides overrides auth provider fields with environment variables
+// named NAUTS_AUTH_<ID>_<FIELD> (see AuthProviderEnvName). Supported fields:
+//
+//   - file: USER_PATH
+//   - jwt:  ISSUER, PUBLIC_KEY, JWKS_URL, ROLES_CLAIM_PATH
+//   - aws:  AWS_ACCOUNT, REGION
+//   - gcp:  PROJECT, JWKS_URL
+//   - azure: TENANT_ID, SUBSCRIPTION_ID, AUDIENCE, JWKS_URL
+//   - kubernetes: API_SERVER, ISSUER, JWKS_URL
+//
+// lookup is typically os.LookupEnv. Unset and empty variables are ignored.
+func (c *Config) ApplyEnvOverrides(lookup func(string) (string, bool)) {
+	override := func(id, field string, target *string) {
+		if v, ok := lookup(AuthProviderEnvName(id, field)); ok && v != "" {
+			*target = v
+		}
+	}
+
+	for i := range c.Auth.File {
+		p := &c.Auth.File[i]
+		override(p.ID, "USER_PATH", &p.UsersPath)
+	}
+	for i := range c.Auth.JWT {
+		p := &c.Auth.JWT[i]
+		override(p.ID, "ISSUER", &p.Issuer)
+		override(p.ID, "PUBLIC_KEY", &p.PublicKey)
+		override(p.ID, "JWKS_URL", &p.JWKSURL)
+		override(p.ID, "AUDIENCE", &p.Audience)
+		override(p.ID, "ROLES_CLAIM_PATH", &p.RolesClaimPath)
+	}
+	for i := range c.Auth.Aws {
+		p := &c.Auth.Aws[i]
+		override(p.ID, "AWS_ACCOUNT", &p.AWSAccount)
+		override(p.ID, "REGION", &p.Region)
+	}
+	for i := range c.Auth.Gcp {
+		p := &c.Auth.Gcp[i]
+		override(p.ID, "PROJECT", &p.Project)
+		override(p.ID, "JWKS_URL", &p.JWKSURL)
+	}
+	for i := range c.Auth.Azure {
+		p := &c.Auth.Azure[i]
+		override(p.ID, "TENANT_ID", &p.TenantID)
+		override(p.ID, "SUBSCRIPTION_ID", &p.SubscriptionID)
+		override(p.ID, "AUDIENCE", &p.Audience)
+		override(p.ID, "JWKS_URL", &p.JWKSURL)
+	}
+	for i := range c.Auth.Kubernetes {
+		p := &c.Auth.Kubernetes[i]
+		override(p.ID, "API_SERVER", &p.APIServer)
+		override(p.ID, "ISSUER", &p.Issuer)
+		override(p.ID, "JWKS_URL", &p.JWKSURL)
+	}
+}
+
+// clone returns a deep copy of the configuration.
+func (c *Config) clone() (*Config, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("encoding config: %w", err)
+	}
+	var copied Config
+	if err := json.Unmarshal(data, &copied); err != nil {
+		return nil, fmt.Errorf("decoding config: %w", err)
+	}
+	return &copied, nil
+}
@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/msimon/nauts/provider"
+)
+
+// SecretScheme prefixes configuration values that reference a secret:
+//
+//   - secret://env/<NAME> is the value of the environment variable NAME
+//   - secret://file/<path> is the content of the file at /<path>
+//   - secret://exec/<command> [args...] is the output of the command, run
+//     without a shell
+//
+// Values are trimmed of surrounding whitespace.
+const SecretScheme = "secret://"
+
+// secretExecTimeout bounds secret://exec commands.
+const secretExecTimeout = 10 * time.Second
+
+// ResolveReferences expands ${NAME} (or ${NAME:-default}) with environment
+// variables in all string values of the configuration and then replaces
+// values starting with secret:// by the referenced secret (see SecretScheme).
+// "$${" escapes a literal "${"; other "$" characters (e.g. in "$SYS") are
+// kept. Fields holding paths to secret files (e.g. server.xkeySeedFile) keep
+// their secret:// reference, which is resolved when the file is read, so
+// the secret itself can be referenced. lookup is typically os.LookupEnv.
+func (c *Config) ResolveReferences(lookup func(string) (string, bool)) error {
+	return resolveValue(reflect.ValueOf(c).Elem(), "", lookup)
+}
+
+// resolveValue resolves the strings in v, which is located at path.
+func resolveValue(v reflect.Value, path string, lookup func(string) (string, bool)) error {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return resolveValue(v.Elem(), path, lookup)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			fieldPath := joinConfigPath(path, name)
+			if field.Anonymous {
+				fieldPath = path
+			}
+			if field.Tag.Get("secret") == "file" && field.Type.Kind() == reflect.String {
+				// Resolved by readSecretFile; only expand variables.
+				s, err := expandEnv(v.Field(i).String(), lookup)
+				if err != nil {
+					return fmt.Errorf("%s: %w", fieldPath, err)
+				}
+				v.Field(i).SetString(s)
+				continue
+			}
+			if err := resolveValue(v.Field(i), fieldPath, lookup); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// Raw JSON and byte strings are not configuration text.
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := resolveValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), lookup); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			// Map values are not addressable: resolve a copy and store it.
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			if err := resolveValue(elem, fmt.Sprintf("%s[%v]", path, key), lookup); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, elem)
+		}
+	case reflect.String:
+		s, err := resolveString(v.String(), lookup)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		v.SetString(s)
+	}
+	return nil
+}
+
+func joinConfigPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// resolveString expands environment variables in s and resolves it if it is
+// a secret reference.
+func resolveString(s string, lookup func(string) (string, bool)) (string, error) {
+	s, err := expandEnv(s, lookup)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(s, SecretScheme) {
+		return resolveSecret(s, lookup)
+	}
+	return s, nil
+}
+
+// expandEnv replaces ${NAME} and ${NAME:-default} in s. A variable without
+// default that is not set is an error.
+func expandEnv(s string, lookup func(string) (string, bool)) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			// "$${" is a literal "${".
+			b.WriteString(s[:i-1])
+			b.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated variable reference in %q", s)
+		}
+		b.WriteString(s[:i])
+		name, def, hasDefault := strings.Cut(s[i+2:i+end], ":-")
+		if name == "" {
+			return "", fmt.Errorf("empty variable reference in %q", s)
+		}
+		value, ok := lookup(name)
+		switch {
+		case ok:
+			b.WriteString(value)
+		case hasDefault:
+			b.WriteString(def)
+		default:
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		s = s[i+end+1:]
+	}
+}
+
+// resolveSecret returns the secret referenced by ref (see SecretScheme).
+func resolveSecret(ref string, lookup func(string) (string, bool)) (string, error) {
+	kind, arg, _ := strings.Cut(strings.TrimPrefix(ref, SecretScheme), "/")
+	if arg == "" {
+		return "", fmt.Errorf("invalid secret reference %q", ref)
+	}
+	var value string
+	switch kind {
+	case "env":
+		v, ok := lookup(arg)
+		if !ok {
+			return "", fmt.Errorf("secret environment variable %s is not set", arg)
+		}
+		value = v
+	case "file":
+		data, err := os.ReadFile("/" + arg)
+		if err != nil {
+			return "", fmt.Errorf("reading secret file: %w", err)
+		}
+		value = string(data)
+	case "exec":
+		args := strings.Fields(arg)
+		if len(args) == 0 {
+			return "", fmt.Errorf("invalid secret reference %q", ref)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), secretExecTimeout)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, args[0], args[1:]...).Output()
+		if err != nil {
+			return "", fmt.Errorf("running secret command %s: %w", args[0], err)
+		}
+		value = string(out)
+	default:
+		return "", fmt.Errorf("unsupported secret reference %q (must be secret://env/, secret://file/ or secret://exec/)", ref)
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", fmt.Errorf("secret %s is empty", ref)
+	}
+	return value, nil
+}
+
+// readSecretFile returns the trimmed content of the file at path, the secret
+// if path is a secret:// reference, or the KV secret field if path is a
+// vault://kv reference (see provider.VaultScheme). Vault is reached with the
+// VAULT_* environment variables.
+func readSecretFile(path string) ([]byte, error) {
+	if strings.HasPrefix(path, provider.VaultScheme) {
+		client, err := provider.NewVaultClient(provider.VaultConfig{})
+		if err != nil {
+			return nil, err
+		}
+		defer client.Stop()
+		ctx, cancel := context.WithTimeout(context.Background(), secretExecTimeout)
+		defer cancel()
+		value, err := client.ReadSecret(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(value), nil
+	}
+	if strings.HasPrefix(path, SecretScheme) {
+		value, err := resolveSecret(path, os.LookupEnv)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(value), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.TrimSpace(string(data))), nil
+}
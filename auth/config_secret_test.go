@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfig_ResolveReferences(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "app.nk")
+	if err := os.WriteFile(keyPath, []byte("APPKEY\n"), 0600); err != nil {
+		t.Fatalf("writing secret file: %v", err)
+	}
+	env := map[string]string{"NATS_HOST": "nats.internal", "APP_PUBLIC_KEY": "AAPP"}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	configJSON := `{
+		"account": {"type": "operator", "operator": {"accounts": {
+			"APP": {"publicKey": "secret://env/APP_PUBLIC_KEY", "signingKeyPath": "${KEY_DIR:-/etc/nauts}/app.nk"}
+		}}},
+		"server": {
+			"natsUrl": "nats://${NATS_HOST}:4222",
+			"calloutSubjects": ["$SYS.REQ.USER.AUTH"],
+			"xkeySeedFile": "secret://file` + keyPath + `",
+			"userKeySecretFile": "secret://exec/cat ` + keyPath + `"
+		}
+	}`
+	var config Config
+	if err := unmarshalYAMLOrJSON("config.json", []byte(configJSON), &config); err != nil {
+		t.Fatalf("parsing config: %v", err)
+	}
+	if err := config.ResolveReferences(lookup); err != nil {
+		t.Fatalf("ResolveReferences() error = %v", err)
+	}
+
+	app := config.Account.Operator.Accounts["APP"]
+	if app.PublicKey != "AAPP" || app.SigningKeyPath != "/etc/nauts/app.nk" {
+		t.Errorf("APP = %+v, want resolved public key and default key dir", app)
+	}
+	if config.Server.NatsURL != "nats://nats.internal:4222" {
+		t.Errorf("natsUrl = %q", config.Server.NatsURL)
+	}
+	if got := config.Server.CalloutSubjects; len(got) != 1 || got[0] != "$SYS.REQ.USER.AUTH" {
+		t.Errorf("calloutSubjects = %v, want $SYS subjects unchanged", got)
+	}
+	// Secret file fields keep the reference, which is resolved on read.
+	if !strings.HasPrefix(config.Server.XKeySeedFile, SecretScheme) {
+		t.Errorf("xkeySeedFile = %q, want secret reference", config.Server.XKeySeedFile)
+	}
+	if seed, err := config.Server.GetXKeySeed(); err != nil || seed != "APPKEY" {
+		t.Errorf("GetXKeySeed() = %q, %v, want APPKEY", seed, err)
+	}
+	if secret, err := config.Server.GetUserKeySecret(); err != nil || string(secret) != "APPKEY" {
+		t.Errorf("GetUserKeySecret() = %q, %v, want APPKEY", secret, err)
+	}
+
+	config.Server.NatsURL = "nats://${MISSING}"
+	if err := config.ResolveReferences(lookup); err == nil || !strings.Contains(err.Error(), "server.natsUrl: environment variable MISSING is not set") {
+		t.Errorf("ResolveReferences() error = %v, want unset variable error", err)
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		if name == "A" {
+			return "1", true
+		}
+		return "", false
+	}
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{in: "plain $SYS.>", want: "plain $SYS.>"},
+		{in: "${A}-${B:-2}", want: "1-2"},
+		{in: "$${A}", want: "${A}"},
+		{in: "${B}", wantErr: true},
+		{in: "${A", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := expandEnv(tt.in, lookup)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("expandEnv(%q) = %q, %v, want %q (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
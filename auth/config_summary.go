@@ -0,0 +1,270 @@
+package auth
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/msimon/nauts/provider"
+	"github.com/msimon/nauts/units"
+)
+
+// ConfigSummary is the effective configuration of a nauts instance as logged on
+// startup. It contains no secrets: credentials, keys and seeds are only reported
+// as the NATS auth method or the encryption flag, and user info in URLs is
+// redacted.
+type ConfigSummary struct {
+	AccountMode           string                `json:"account_mode"`
+	Accounts              []string              `json:"accounts"`
+	SigningKey            string                `json:"signing_key,omitempty"`
+	PolicyProvider        string                `json:"policy_provider"`
+	PolicySource          string                `json:"policy_source"`
+	PolicyCanary          string                `json:"policy_canary,omitempty"`
+	PolicyRoutes          []string              `json:"policy_routes,omitempty"`
+	AuthProviders         []AuthProviderSummary `json:"auth_providers"`
+	NatsURL               string                `json:"nats_url"`
+	NatsAuth              string                `json:"nats_auth"`
+	CalloutSubjects       []string              `json:"callout_subjects"`
+	DelegateSubject       string                `json:"delegate_subject,omitempty"`
+	TTL                   string                `json:"ttl"`
+	AccountTTLs           map[string]string     `json:"account_ttls,omitempty"`
+	ResponseCacheTTL      string                `json:"response_cache_ttl,omitempty"`
+	PermissionCacheTTL    string                `json:"permission_cache_ttl,omitempty"`
+	CoalesceRequests      bool                  `json:"coalesce_requests,omitempty"`
+	Encryption            bool                  `json:"encryption"`
+	UserKeyStrategy       string                `json:"user_key_strategy"`
+	UserPassword          string                `json:"user_password,omitempty"`
+	Nkey                  string                `json:"nkey,omitempty"`
+	UserIDNormalization   []string              `json:"user_id_normalization,omitempty"`
+	CircuitBreaker        bool                  `json:"circuit_breaker"`
+	RateLimit             bool                  `json:"rate_limit,omitempty"`
+	MaxConcurrentRequests int                   `json:"max_concurrent_requests,omitempty"`
+	RequestQueueDepth     int                   `json:"request_queue_depth,omitempty"`
+	ErrorDetail           bool                  `json:"error_detail,omitempty"`
+	ShadowMode            string                `json:"shadow_mode,omitempty"`
+	AuditSinks            []string              `json:"audit_sinks,omitempty"`
+	RevocationBucket      string                `json:"revocation_bucket,omitempty"`
+	RevocationPush        bool                  `json:"revocation_push,omitempty"`
+	PendingBindingBucket  string                `json:"pending_binding_bucket,omitempty"`
+	HTTPAddress           string                `json:"http_address,omitempty"`
+	HTTPAuthenticate      bool                  `json:"http_authenticate,omitempty"`
+	GRPCAddress           string                `json:"grpc_address,omitempty"`
+	FaultInjection        []string              `json:"fault_injection,omitempty"`
+	ReloadHistory         int                   `json:"reload_history"`
+}
+
+// AuthProviderSummary describes a configured authentication provider.
+type AuthProviderSummary struct {
+	ID           string   `json:"id"`
+	Type         string   `json:"type"`
+	Accounts     []string `json:"accounts"`
+	AllowedCidrs []string `json:"allowed_cidrs,omitempty"`
+}
+
+// Summary returns the effective configuration with defaults applied, as the
+// callout service would run it. The NATS_URL environment variable overrides
+// server.natsUrl, as in NewCalloutService.
+func (c *Config) Summary() ConfigSummary {
+	s := ConfigSummary{
+		AccountMode:     c.Account.Type,
+		PolicyProvider:  c.Policy.Type,
+		CalloutSubjects: c.Server.CalloutSubjects,
+		DelegateSubject: c.Server.DelegateSubject,
+		TTL:             c.Server.GetTTL(time.Hour).String(),
+		AccountTTLs:     c.Account.TTLs,
+		Encryption:      c.Server.XKeySeedFile != "",
+		UserKeyStrategy: c.Server.UserKeyStrategy,
+		CircuitBreaker:  c.Server.CircuitBreaker != nil,
+		RateLimit:       c.Server.RateLimit != nil,
+		ErrorDetail:     c.Server.ErrorDetail,
+		ReloadHistory:   c.Server.ReloadHistory,
+	}
+
+	if c.Server.ShadowMode != nil {
+		s.ShadowMode = string(c.Server.ShadowMode.GetResponse())
+	}
+	if n := c.Server.MaxConcurrentRequests; n > 0 {
+		s.MaxConcurrentRequests = n
+		s.RequestQueueDepth = c.Server.RequestQueueDepth
+		if s.RequestQueueDepth == 0 {
+			s.RequestQueueDepth = DefaultRequestQueueDepth
+		}
+	}
+
+	switch {
+	case c.Account.Operator != nil:
+		for name := range c.Account.Operator.Accounts {
+			s.Accounts = append(s.Accounts, name)
+		}
+		sort.Strings(s.Accounts)
+	case c.Account.Static != nil:
+		s.Accounts = c.Account.Static.Accounts
+		if keys := c.Account.Static.SigningKeys; len(keys) > 0 {
+			s.SigningKey = c.Account.Static.ActiveKey
+			if s.SigningKey == "" {
+				s.SigningKey = keys[0].ID
+			}
+		}
+	}
+
+	switch {
+	case c.Policy.Type == "file" && c.Policy.File != nil:
+		s.PolicySource = c.Policy.File.PoliciesPath + ", " + c.Policy.File.BindingsPath
+	case c.Policy.Type == "nats" && c.Policy.Nats != nil:
+		s.PolicySource = c.Policy.Nats.Bucket + " @ " + redactURL(c.Policy.Nats.NatsURL)
+		if c.Policy.Nats.Revision != "" {
+			s.PolicySource += " (pinned to revision " + c.Policy.Nats.Revision + ")"
+		}
+	case c.Policy.Type == "sql" && c.Policy.SQL != nil:
+		policies, bindings := c.Policy.SQL.PoliciesTable, c.Policy.SQL.BindingsTable
+		if policies == "" {
+			policies = provider.DefaultSQLPoliciesTable
+		}
+		if bindings == "" {
+			bindings = provider.DefaultSQLBindingsTable
+		}
+		s.PolicySource = policies + ", " + bindings
+	case c.Policy.Type == "consul" && c.Policy.Consul != nil:
+		s.PolicySource = c.Policy.Consul.GetPrefix()
+		if c.Policy.Consul.Address != "" {
+			s.PolicySource += " @ " + redactURL(c.Policy.Consul.Address)
+		}
+	}
+	if canary := c.Policy.Canary; canary != nil {
+		s.PolicyCanary = fmt.Sprintf("%g%% %s", canary.Percent, canary.Type)
+	}
+	for _, r := range c.Policy.Routes {
+		s.PolicyRoutes = append(s.PolicyRoutes, fmt.Sprintf("%s: %s", strings.Join(r.Accounts, ","), r.Type))
+	}
+
+	for _, p := range c.Auth.File {
+		s.AuthProviders = append(s.AuthProviders, AuthProviderSummary{p.ID, "file", p.Accounts, p.AllowedCidrs})
+	}
+	for _, p := range c.Auth.JWT {
+		s.AuthProviders = append(s.AuthProviders, AuthProviderSummary{p.ID, "jwt", p.Accounts, p.AllowedCidrs})
+	}
+	for _, p := range c.Auth.Aws {
+		s.AuthProviders = append(s.AuthProviders, AuthProviderSummary{p.ID, "aws", p.Accounts, p.AllowedCidrs})
+	}
+	for _, p := range c.Auth.Gcp {
+		s.AuthProviders = append(s.AuthProviders, AuthProviderSummary{p.ID, "gcp", p.Accounts, p.AllowedCidrs})
+	}
+	for _, p := range c.Auth.Azure {
+		s.AuthProviders = append(s.AuthProviders, AuthProviderSummary{p.ID, "azure", p.Accounts, p.AllowedCidrs})
+	}
+	for _, p := range c.Auth.Kubernetes {
+		s.AuthProviders = append(s.AuthProviders, AuthProviderSummary{p.ID, "kubernetes", p.Accounts, p.AllowedCidrs})
+	}
+	for _, p := range c.Auth.Nkey {
+		s.AuthProviders = append(s.AuthProviders, AuthProviderSummary{p.ID, "nkey", p.Accounts, p.AllowedCidrs})
+	}
+	for _, p := range c.Auth.Custom {
+		s.AuthProviders = append(s.AuthProviders, AuthProviderSummary{p.ID, p.Type, p.Accounts, p.AllowedCidrs})
+	}
+
+	natsURL := c.Server.NatsURL
+	if v := os.Getenv("NATS_URL"); v != "" {
+		natsURL = v
+	}
+	if natsURL == "" {
+		natsURL = nats.DefaultURL
+	}
+	s.NatsURL = redactURL(natsURL)
+	switch {
+	case c.Server.NatsCredentials != "":
+		s.NatsAuth = "credentials"
+	case c.Server.NatsNkey != "":
+		s.NatsAuth = "nkey"
+	}
+
+	if len(s.CalloutSubjects) == 0 {
+		s.CalloutSubjects = []string{AuthCalloutSubject}
+	}
+	if d, err := units.ParseDuration(c.Server.ResponseCacheTTL); err == nil && d > 0 {
+		s.ResponseCacheTTL = d.String()
+	}
+	if d, err := units.ParseDuration(c.Server.PermissionCacheTTL); err == nil && d > 0 {
+		s.PermissionCacheTTL = d.String()
+	}
+	s.CoalesceRequests = c.Server.CoalesceRequests
+	s.UserPassword = c.userPasswordProvider()
+	if nk := c.nkeyConfig(); nk != nil {
+		s.Nkey = nk.Provider
+	}
+	for _, step := range c.Server.UserIDNormalization {
+		s.UserIDNormalization = append(s.UserIDNormalization, step.Type)
+	}
+	if s.UserKeyStrategy == "" {
+		s.UserKeyStrategy = string(UserKeyEphemeral)
+	}
+	if s.ReloadHistory <= 0 {
+		s.ReloadHistory = DefaultReloadHistory
+	}
+
+	if a := c.Server.Audit; a != nil {
+		if a.Stdout {
+			s.AuditSinks = append(s.AuditSinks, "stdout")
+		}
+		if a.File != "" {
+			s.AuditSinks = append(s.AuditSinks, "file:"+a.File)
+		}
+		if a.Subject != "" {
+			s.AuditSinks = append(s.AuditSinks, "nats:"+a.Subject)
+		}
+	}
+	if r := c.Server.Revocation; r != nil {
+		s.RevocationBucket = r.Bucket
+		if s.RevocationBucket == "" {
+			s.RevocationBucket = DefaultRevocationBucket
+		}
+		s.RevocationPush = r.Push != nil
+	}
+	if a := c.Server.Admin; a != nil && a.PendingBindings != nil {
+		s.PendingBindingBucket = a.PendingBindings.Bucket
+		if s.PendingBindingBucket == "" {
+			s.PendingBindingBucket = DefaultPendingBindingBucket
+		}
+	}
+	if h := c.Server.HTTP; h != nil {
+		s.HTTPAddress = h.Address
+		s.HTTPAuthenticate = h.Authenticate
+	}
+	if g := c.Server.GRPC; g != nil {
+		s.GRPCAddress = g.Address
+	}
+	if fi := c.Server.activeFaultInjection(); fi != nil {
+		for _, target := range []string{FaultTargetAuth, FaultTargetPolicy, FaultTargetNats} {
+			if fi.targets(target) {
+				s.FaultInjection = append(s.FaultInjection, target)
+			}
+		}
+	}
+
+	return s
+}
+
+// redactURL replaces the user info (user, password or token) of each URL in a
+// comma-separated NATS server list.
+func redactURL(raw string) string {
+	parts := strings.Split(raw, ",")
+	for i, part := range parts {
+		u, err := url.Parse(strings.TrimSpace(part))
+		if err != nil {
+			if at := strings.LastIndex(part, "@"); at >= 0 {
+				parts[i] = "redacted" + part[at:]
+			}
+			continue
+		}
+		if u.User == nil {
+			continue
+		}
+		u.User = url.User("redacted")
+		parts[i] = u.String()
+	}
+	return strings.Join(parts, ",")
+}
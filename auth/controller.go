@@ -7,6 +7,9 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net/netip"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
@@ -17,6 +20,7 @@ import (
 	"github.com/msimon/nauts/jwt"
 	"github.com/msimon/nauts/policy"
 	"github.com/msimon/nauts/provider"
+	"github.com/msimon/nauts/tracing"
 )
 
 // Logger is an interface for logging during authentication.
@@ -47,8 +51,34 @@ type AuthController struct {
 	policyProvider  provider.PolicyProvider
 	authProviders   *identity.AuthenticationProviderManager
 	logger          Logger
+	jwtSizeMetrics  *JWTSizeMetrics
+	accountStats    *AccountStats
+	jwtEncoder      jwt.UserJWTEncoder
+	userKeyStrategy UserKeyStrategy
+	userKeySecret   []byte
+	breakers        []*CircuitBreaker
+	auditLog        *AuditLog
+	tokenTracker    TokenTracker
+	accountTTLs     map[string]time.Duration
+	faults          []*FaultInjector
+	// accountInboxes are the inbox templates of accounts ("*" for all).
+	accountInboxes map[string]string
+	// bindingExpiryWarning is how long before a binding's expiry warnings are emitted.
+	bindingExpiryWarning time.Duration
+	permissionCache      *permissionCache
+	coalescer            *requestCoalescer
+	// subjectOwnership flags policies granting subjects of other teams.
+	subjectOwnership *policy.SubjectOwnership
+	policyCanary     *PolicyCanary
+	userPassword     *userPassword
+	nkeyAuth         *nkeyAuth
+	userIDNormalizer UserIDNormalizer
 }
 
+// DefaultBindingExpiryWarning is how long before a binding expires
+// authentications using it log a warning.
+const DefaultBindingExpiryWarning = 24 * time.Hour
+
 // ControllerOption configures an AuthController.
 type ControllerOption func(*AuthController)
 
@@ -59,6 +89,138 @@ func WithLogger(l Logger) ControllerOption {
 	}
 }
 
+// WithJWTSizeMetrics records the size of every issued user JWT in m.
+func WithJWTSizeMetrics(m *JWTSizeMetrics) ControllerOption {
+	return func(c *AuthController) {
+		c.jwtSizeMetrics = m
+	}
+}
+
+// WithAccountStats counts every Authenticate call per account in s.
+func WithAccountStats(s *AccountStats) ControllerOption {
+	return func(c *AuthController) {
+		c.accountStats = s
+	}
+}
+
+// WithUserJWTEncoder sets the encoder used to sign user JWTs. The encoder
+// receives the fully-populated claims and may add custom fields or reject them.
+// Default: jwt.DefaultUserJWTEncoder.
+func WithUserJWTEncoder(enc jwt.UserJWTEncoder) ControllerOption {
+	return func(c *AuthController) {
+		c.jwtEncoder = enc
+	}
+}
+
+// WithCircuitBreakers registers the circuit breakers guarding the controller's
+// providers, so that their status is reported by CircuitBreakers.
+func WithCircuitBreakers(breakers ...*CircuitBreaker) ControllerOption {
+	return func(c *AuthController) {
+		c.breakers = breakers
+	}
+}
+
+// WithAccountTTLs sets per-account session TTLs that replace the requested
+// (default) TTL for users of those accounts. See NautsCompilationResult.TTL.
+func WithAccountTTLs(ttls map[string]time.Duration) ControllerOption {
+	return func(c *AuthController) {
+		c.accountTTLs = ttls
+	}
+}
+
+// WithAccountInboxes sets the inbox users of an account may subscribe to,
+// keyed by account name or "*" for all accounts: a subject template like
+// "_INBOX.{{ user.id }}.>", or policy.InboxNone. Policies may override it
+// (policy.ResolveInbox). Without an entry, policy.DefaultInbox applies.
+func WithAccountInboxes(inboxes map[string]string) ControllerOption {
+	return func(c *AuthController) {
+		c.accountInboxes = inboxes
+	}
+}
+
+// accountInbox returns the configured inbox template of account, or "" for
+// policy.DefaultInbox.
+func (c *AuthController) accountInbox(account string) string {
+	if inbox, ok := c.accountInboxes[account]; ok {
+		return inbox
+	}
+	return c.accountInboxes["*"]
+}
+
+// WithAuditLog records every Authenticate call in a.
+func WithAuditLog(a *AuditLog) ControllerOption {
+	return func(c *AuthController) {
+		c.auditLog = a
+	}
+}
+
+// WithTokenTracker records every issued user JWT in t, so that it can be
+// revoked by its jti.
+func WithTokenTracker(t TokenTracker) ControllerOption {
+	return func(c *AuthController) {
+		c.tokenTracker = t
+	}
+}
+
+// WithFaultInjectors registers the fault injectors wrapping the controller's
+// providers, so that their counters are reported by FaultInjection. An
+// injector named FaultTargetNats is applied by the callout service to its
+// responses.
+func WithFaultInjectors(injectors ...*FaultInjector) ControllerOption {
+	return func(c *AuthController) {
+		c.faults = injectors
+	}
+}
+
+// WithBindingExpiryWarning sets how long before a binding's expiresAt
+// authentications using it log a warning (default: DefaultBindingExpiryWarning).
+// 0 disables the warnings.
+func WithBindingExpiryWarning(d time.Duration) ControllerOption {
+	return func(c *AuthController) {
+		c.bindingExpiryWarning = d
+	}
+}
+
+// WithPermissionCache caches compiled permissions per account, role set, and
+// policy version for ttl. A policy provider implementing
+// provider.PolicyVersioner invalidates the cache on every change; otherwise
+// changes take effect once entries expire. 0 disables the cache (default).
+func WithPermissionCache(ttl time.Duration) ControllerOption {
+	return func(c *AuthController) {
+		c.permissionCache = nil
+		if ttl > 0 {
+			c.permissionCache = newPermissionCache(ttl)
+		}
+	}
+}
+
+// WithRequestCoalescing lets concurrent Authenticate calls with the same
+// account, credentials, and client share one provider verification and
+// permission compilation, e.g. when many connections of a user reconnect at
+// once. Each call still gets its own JWT for its user nkey.
+func WithRequestCoalescing() ControllerOption {
+	return func(c *AuthController) {
+		c.coalescer = newRequestCoalescer()
+	}
+}
+
+// WithSubjectOwnership adds a warning to the compilation result for every
+// policy statement granting subjects claimed by another team in o.
+func WithSubjectOwnership(o *policy.SubjectOwnership) ControllerOption {
+	return func(c *AuthController) {
+		c.subjectOwnership = o
+	}
+}
+
+// WithPolicyCanary compiles the permissions of the canary's share of users
+// with its candidate policy provider, and compares them with the permissions
+// of the controller's policy provider (see PolicyCanary).
+func WithPolicyCanary(p *PolicyCanary) ControllerOption {
+	return func(c *AuthController) {
+		c.policyCanary = p
+	}
+}
+
 // NewAuthController creates a new AuthController with the given providers.
 func NewAuthController(
 	accountProvider provider.AccountProvider,
@@ -71,6 +233,9 @@ func NewAuthController(
 		policyProvider:  policyProvider,
 		authProviders:   authProviders,
 		logger:          &defaultLogger{},
+		jwtEncoder:      jwt.DefaultUserJWTEncoder,
+
+		bindingExpiryWarning: DefaultBindingExpiryWarning,
 	}
 	for _, opt := range opts {
 		opt(c)
@@ -78,17 +243,130 @@ func NewAuthController(
 	return c
 }
 
+// JWTSizeMetrics returns the JWT size metrics of this controller, or nil if not configured.
+func (c *AuthController) JWTSizeMetrics() *JWTSizeMetrics {
+	return c.jwtSizeMetrics
+}
+
+// AccountStats returns the per-account statistics of this controller, or nil if not configured.
+func (c *AuthController) AccountStats() *AccountStats {
+	return c.accountStats
+}
+
+// AuditLog returns the audit log of this controller, or nil if auditing is disabled.
+func (c *AuthController) AuditLog() *AuditLog {
+	return c.auditLog
+}
+
+// TokenTracker returns the token tracker of this controller, or nil if issued
+// tokens are not tracked.
+func (c *AuthController) TokenTracker() TokenTracker {
+	return c.tokenTracker
+}
+
+// CircuitBreakers returns the status of the registered circuit breakers, sorted by name.
+func (c *AuthController) CircuitBreakers() []CircuitBreakerStatus {
+	statuses := make([]CircuitBreakerStatus, 0, len(c.breakers))
+	for _, b := range c.breakers {
+		statuses = append(statuses, b.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// PolicyCanary returns the status of the policy canary, or nil if none is configured.
+func (c *AuthController) PolicyCanary() *PolicyCanaryStatus {
+	if c.policyCanary == nil {
+		return nil
+	}
+	s := c.policyCanary.Status()
+	return &s
+}
+
+// FaultInjection returns the status of the registered fault injectors, sorted by name.
+func (c *AuthController) FaultInjection() []FaultInjectionStatus {
+	return faultInjectionStatuses(c.faults)
+}
+
+// natsFaults returns the fault injector for NATS operations, or nil.
+func (c *AuthController) natsFaults() *FaultInjector {
+	for _, f := range c.faults {
+		if f.Name() == FaultTargetNats {
+			return f
+		}
+	}
+	return nil
+}
+
+// ExplainProviderSelection reports which authentication provider would be
+// selected for req and why, without verifying credentials.
+func (c *AuthController) ExplainProviderSelection(req identity.AuthRequest) (*identity.ProviderSelection, error) {
+	return c.authProviders.ExplainSelection(req)
+}
+
 // AccountProvider returns the account provider used by this controller.
 func (c *AuthController) AccountProvider() provider.AccountProvider {
 	return c.accountProvider
 }
 
+// PolicyProvider returns the policy provider used by this controller.
+func (c *AuthController) PolicyProvider() provider.PolicyProvider {
+	return c.policyProvider
+}
+
+// PolicyStore returns the policy provider of this controller as a
+// provider.PolicyStore, bypassing circuit breakers and fault injection, or
+// false if the provider does not support writes.
+func (c *AuthController) PolicyStore() (provider.PolicyStore, bool) {
+	store, ok := unwrapPolicyProvider(c.policyProvider).(provider.PolicyStore)
+	return store, ok
+}
+
+// policyVersion returns the version of the policy provider, or 0 if it does
+// not implement provider.PolicyVersioner.
+func (c *AuthController) policyVersion() uint64 {
+	if v, ok := unwrapPolicyProvider(c.policyProvider).(provider.PolicyVersioner); ok {
+		return v.PolicyVersion()
+	}
+	return 0
+}
+
+// unwrapPolicyProvider returns the provider wrapped by circuit breakers and
+// fault injection.
+func unwrapPolicyProvider(p provider.PolicyProvider) provider.PolicyProvider {
+	for {
+		w, ok := p.(interface {
+			Unwrap() provider.PolicyProvider
+		})
+		if !ok {
+			return p
+		}
+		p = w.Unwrap()
+	}
+}
+
+// Stop releases resources held by the account, policy, and authentication
+// providers, such as KV watches, JWKS refreshes, and Vault token renewals.
+// Call it once no request uses the controller anymore.
+func (c *AuthController) Stop() {
+	if s, ok := c.accountProvider.(interface{ Stop() error }); ok {
+		_ = s.Stop()
+	}
+	StopPolicyStore(c.policyProvider)
+	if c.policyCanary != nil {
+		StopPolicyStore(c.policyCanary.provider)
+	}
+	if c.authProviders != nil {
+		_ = c.authProviders.Stop()
+	}
+}
+
 func (c *AuthController) ScopeUserToAccount(ctx context.Context, user *identity.User, account string) (*AccountScopedUser, error) {
 	// Filter user roles to only include those for the requested account
 	// This is the authorization step - separating it from authentication
 	filteredRoles := make([]identity.Role, 0, len(user.Roles))
 	for _, role := range user.Roles {
-		if strings.Contains(role.Account, "*") || strings.Contains(role.Name, "*") {
+		if role.HasWildcard() {
 			return nil, NewAuthError(user.ID, "resolve_user", "invalid role: wildcards not allowed", nil)
 		}
 		if role.Account == account {
@@ -103,12 +381,101 @@ func (c *AuthController) ScopeUserToAccount(ctx context.Context, user *identity.
 	return scoped, nil
 }
 
+type clientIPKey struct{}
+
+// ContextWithClientIP returns a context carrying the client's source address.
+// Authenticate uses it to enforce provider network restrictions, and policy
+// compilation to evaluate client.ip statement conditions.
+func ContextWithClientIP(ctx context.Context, ip netip.Addr) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIPFromContext returns the client address stored by ContextWithClientIP.
+// The zero value is returned if none is set.
+func ClientIPFromContext(ctx context.Context) netip.Addr {
+	ip, _ := ctx.Value(clientIPKey{}).(netip.Addr)
+	return ip
+}
+
+type clientNonceKey struct{}
+
+// ContextWithClientNonce returns a context carrying the nonce the NATS server
+// sent to the client, against which nkey authentication checks the client's
+// signature.
+func ContextWithClientNonce(ctx context.Context, nonce string) context.Context {
+	return context.WithValue(ctx, clientNonceKey{}, nonce)
+}
+
+// ClientNonceFromContext returns the nonce stored by ContextWithClientNonce,
+// or "" if none is set.
+func ClientNonceFromContext(ctx context.Context) string {
+	nonce, _ := ctx.Value(clientNonceKey{}).(string)
+	return nonce
+}
+
+// ClientInfo holds the details a client sends in its CONNECT. Clients choose
+// them freely; they are exposed to policies as client.name, client.lang, and
+// client.version.
+type ClientInfo struct {
+	Name    string
+	Lang    string
+	Version string
+}
+
+type clientInfoKey struct{}
+
+// ContextWithClientInfo returns a context carrying the client's connect
+// details. Authenticate sets them from the connect options of the request.
+func ContextWithClientInfo(ctx context.Context, info ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, info)
+}
+
+// ClientInfoFromContext returns the details stored by ContextWithClientInfo.
+// The zero value is returned if none are set.
+func ClientInfoFromContext(ctx context.Context) ClientInfo {
+	info, _ := ctx.Value(clientInfoKey{}).(ClientInfo)
+	return info
+}
+
+type shadowKey struct{}
+
+// ContextWithShadow returns a context marking an authentication as done in
+// shadow mode: its audit event is flagged, and the issued JWT, which is never
+// used, is not tracked.
+func ContextWithShadow(ctx context.Context) context.Context {
+	return context.WithValue(ctx, shadowKey{}, true)
+}
+
+// ShadowFromContext reports whether ctx was returned by ContextWithShadow.
+func ShadowFromContext(ctx context.Context) bool {
+	shadow, _ := ctx.Value(shadowKey{}).(bool)
+	return shadow
+}
+
 // parseAuthRequest parses the JSON token into an AuthRequest.
-// Expected format: { "account": string, "token": string }
+// Expected format: { "v": number, "account": string, "token": string, "ap": string }
+// The version is checked first, so that requests of a newer version fail with
+// ErrUnsupportedAuthRequestVersion rather than a confusing field error.
 func parseAuthRequest(token string) (identity.AuthRequest, error) {
+	var envelope struct {
+		Version json.RawMessage `json:"v"`
+	}
+	if err := json.Unmarshal([]byte(token), &envelope); err != nil {
+		return identity.AuthRequest{}, fmt.Errorf("decoding auth request: %w", err)
+	}
+	var version int
+	if len(envelope.Version) > 0 {
+		if err := json.Unmarshal(envelope.Version, &version); err != nil {
+			return identity.AuthRequest{}, fmt.Errorf("auth request version must be an integer, got %s", envelope.Version)
+		}
+	}
+	if err := (identity.AuthRequest{Version: version}).CheckVersion(); err != nil {
+		return identity.AuthRequest{}, err
+	}
+
 	var req identity.AuthRequest
 	if err := json.Unmarshal([]byte(token), &req); err != nil {
-		return identity.AuthRequest{}, err
+		return identity.AuthRequest{}, fmt.Errorf("decoding auth request: %w", err)
 	}
 	if req.Token == "" {
 		return identity.AuthRequest{}, errors.New("token field is required")
@@ -129,42 +496,316 @@ type NautsCompilationResult struct {
 	Warnings       []string                    `json:"warnings"`
 	Roles          []identity.Role             `json:"roles"`
 	Policies       map[string][]*policy.Policy `json:"policies"`
+	// TTL is the smallest session TTL override of the user's account and
+	// role bindings (0 = none, the requested TTL applies).
+	TTL time.Duration `json:"ttl,omitempty"`
+	// MaxTTL is the smallest maximum session TTL requested by the user's
+	// policies and role bindings, and the time until the earliest binding
+	// expiry (0 = no limit).
+	MaxTTL time.Duration `json:"maxTTL,omitempty"`
+	// Limits are the most restrictive connection limits of the user's
+	// policies, embedded in the user JWT.
+	Limits policy.UserLimits `json:"limits,omitzero"`
+	// ExpiredBindings lists the roles skipped because their binding expired.
+	// They are not part of Roles.
+	ExpiredBindings []string `json:"expiredBindings,omitempty"`
+	// PolicyCanary is true if the policies of the policy canary were used.
+	PolicyCanary bool `json:"policyCanary,omitempty"`
+	// Origins explains every compiled permission. Only set by ExplainPermissions.
+	Origins []PermissionOrigin `json:"origins,omitempty"`
+}
+
+// PermissionOrigin is a compiled permission together with the role, policy
+// statement, and resource that produced it.
+type PermissionOrigin struct {
+	policy.PermissionOrigin
+	// Role is the role whose policies produced the permission; empty for
+	// implicit permissions granted to every user.
+	Role string `json:"role,omitempty"`
+	// Effective is false if the permission was dropped during deduplication,
+	// e.g. because a broader permission or a deny covers it.
+	Effective bool `json:"effective"`
+}
+
+// EffectiveTTL returns the JWT TTL for the requested (default) TTL: TTL
+// replaces it if set, and the result is capped with MaxTTL. A TTL of 0 (no
+// expiry) is replaced by MaxTTL if one is set.
+func (r *NautsCompilationResult) EffectiveTTL(requested time.Duration) time.Duration {
+	if r == nil {
+		return requested
+	}
+	if r.TTL > 0 {
+		requested = r.TTL
+	}
+	return policy.MinTTL(requested, r.MaxTTL)
 }
 
 // CompileNatsPermissions compiles NATS permissions for a given user.
+//
+// Users selected by the policy canary get the permissions of the candidate
+// policy provider; they are compared with the permissions of the stable
+// provider and differences are counted. If the candidate fails, the stable
+// provider is used.
 func (c *AuthController) CompileNatsPermissions(ctx context.Context, user *AccountScopedUser) (*NautsCompilationResult, error) {
+	ctx, span := tracing.Start(ctx, "nauts.compile_permissions")
+	defer span.End()
+
+	result, err := c.compileWithPolicyCanary(ctx, user)
+	if result != nil {
+		span.SetAttributes(
+			tracing.Int("nauts.roles", len(result.Roles)),
+			tracing.Bool("nauts.policy_canary", result.PolicyCanary),
+		)
+		if p := result.Permissions; p != nil {
+			span.SetAttributes(tracing.Int("nauts.permissions.pub", len(p.PubList())), tracing.Int("nauts.permissions.sub", len(p.SubList())))
+		}
+	}
+	span.SetError(err)
+	return result, err
+}
+
+// compileWithPolicyCanary implements CompileNatsPermissions.
+func (c *AuthController) compileWithPolicyCanary(ctx context.Context, user *AccountScopedUser) (*NautsCompilationResult, error) {
+	if user == nil || !c.policyCanary.Selects(user.Account, user.ID) {
+		result, err := c.compileNatsPermissions(ctx, user, c.policyProvider, false)
+		if err == nil && c.policyCanary != nil {
+			c.policyCanary.stable.Add(1)
+		}
+		return result, err
+	}
+
+	stable, err := c.compileNatsPermissions(ctx, user, c.policyProvider, false)
+	if err != nil {
+		return nil, err
+	}
+	result, err := c.compileNatsPermissions(ctx, user, c.policyCanary.provider, false)
+	if err != nil {
+		c.policyCanary.errors.Add(1)
+		c.logger.Warn("policy canary failed for %s in %s, using stable policies: %v", user.ID, user.Account, err)
+		return stable, nil
+	}
+	c.policyCanary.canary.Add(1)
+	if permissionsDiffer(stable, result) {
+		c.policyCanary.diffs.Add(1)
+		c.logger.Debug("policy canary changes permissions of %s in %s: stable %s, canary %s", user.ID, user.Account, stable.Permissions, result.Permissions)
+	}
+	result.PolicyCanary = true
+	return result, nil
+}
+
+// ExplainPermissions compiles the user's permissions like
+// CompileNatsPermissions and records in Origins which role, policy statement,
+// and resource produced each permission.
+func (c *AuthController) ExplainPermissions(ctx context.Context, user *AccountScopedUser) (*NautsCompilationResult, error) {
+	if user != nil && c.policyCanary.Selects(user.Account, user.ID) {
+		result, err := c.compileNatsPermissions(ctx, user, c.policyCanary.provider, true)
+		if err == nil {
+			result.PolicyCanary = true
+			return result, nil
+		}
+	}
+	return c.compileNatsPermissions(ctx, user, c.policyProvider, true)
+}
+
+// ExplainToken runs the authentication flow for an auth request token
+// (provider selection, verification, and account scoping) and explains the
+// resulting permissions with ExplainPermissions. No JWT is issued and nothing
+// is audited.
+func (c *AuthController) ExplainToken(ctx context.Context, token string) (*NautsCompilationResult, error) {
+	authReq, err := parseAuthRequest(token)
+	if err != nil {
+		return nil, err
+	}
+	authReq.ClientIP = ClientIPFromContext(ctx)
+
+	selection, err := c.authProviders.ExplainSelection(authReq)
+	if err != nil {
+		return nil, err
+	}
+	user, err := c.authProviders.Provider(selection.ProviderID).Verify(ctx, authReq)
+	if err != nil {
+		return nil, err
+	}
+	user = c.normalizeUserID(selection.ProviderID, user)
+	userScoped, err := c.ScopeUserToAccount(ctx, user, authReq.Account)
+	if err != nil {
+		return nil, err
+	}
+	return c.ExplainPermissions(ctx, userScoped)
+}
+
+// compileNatsPermissions implements CompileNatsPermissions with the policies
+// of policyProvider. With explain, the origin of every permission is recorded.
+// Only permissions of the controller's policy provider are cached.
+func (c *AuthController) compileNatsPermissions(ctx context.Context, user *AccountScopedUser, policyProvider provider.PolicyProvider, explain bool) (*NautsCompilationResult, error) {
 	if user == nil {
 		return nil, NewAuthError("", "resolve_permissions", "user is nil", nil)
 	}
 
 	roles := c.collectRoles(user)
+	var cacheKey string
+	var version uint64
+	if c.permissionCache != nil && !explain && policyProvider == c.policyProvider {
+		version = c.policyVersion()
+		cacheKey = permissionCacheKey(user.Account, roles, version)
+		if set, ok := c.permissionCache.get(cacheKey, version); ok && set != nil {
+			return set.result(policyContext(ctx, user), user, roles), nil
+		}
+	}
+	// cachedRoles collects the role set for the permission cache; it is nil
+	// if the cache is disabled or the role set is not cacheable.
+	var cachedRoles map[string]*cachedRole
+	if cacheKey != "" {
+		cachedRoles = make(map[string]*cachedRole, len(roles))
+	}
+
+	activeRoles := make([]identity.Role, 0, len(roles))
+	var expiredBindings []string
+	now := time.Now()
 	compiled := policy.NewNatsPermissions()
-	basePolicyCtx := userToPolicyContext(user)
+	basePolicyCtx := policyContext(ctx, user)
 
 	warnings := make([]string, 0)
+	var origins []PermissionOrigin
 	policiesByRole := make(map[string][]*policy.Policy, len(roles))
+	// compiledPolicies collects the policies of the compiled roles, compiledAny
+	// whether a role was compiled at all.
+	var compiledPolicies []*policy.Policy
+	compiledAny := false
+	ttl := c.accountTTLs[user.Account]
+	var maxTTL time.Duration
+	var userLimits policy.UserLimits
+	var limits *provider.AccountLimits
+	if c.accountProvider != nil {
+		// Limits are advisory; an unknown account fails later in the flow.
+		limits, _ = c.accountProvider.GetAccountLimits(ctx, user.Account)
+	}
 
 	for _, role := range roles {
-		policies, err := c.policyProvider.GetPoliciesForRole(ctx, role)
+		roleWarnings := len(warnings)
+		fetchCtx, span := tracing.Start(ctx, "nauts.fetch_policies", tracing.String("nauts.role", role.String()))
+		binding := roleBinding(fetchCtx, policyProvider, role)
+		if binding != nil && binding.ExpiresAt != nil {
+			// The remaining time caps MaxTTL.
+			cachedRoles = nil
+		}
+		if binding != nil && binding.Expired(now) {
+			span.SetAttributes(tracing.Bool("nauts.binding_expired", true))
+			span.End()
+			warnings = append(warnings, fmt.Sprintf("binding expired: %s (at %s, user: %s)", role, binding.ExpiresAt.Format(time.RFC3339), user.ID))
+			expiredBindings = append(expiredBindings, role.String())
+			continue
+		}
+		activeRoles = append(activeRoles, role)
+
+		policies, err := policyProvider.GetPoliciesForRole(fetchCtx, role)
+		span.SetAttributes(tracing.Int("nauts.policies", len(policies)))
+		if !errors.Is(err, provider.ErrRoleNotFound) {
+			span.SetError(err)
+		}
+		span.End()
 		if err != nil {
 			if errors.Is(err, provider.ErrRoleNotFound) {
-				warnings = append(warnings, fmt.Sprintf("role not found: %s.%s (user: %s)", role.Account, role.Name, user.ID))
-				policiesByRole[role.Account+"."+role.Name] = []*policy.Policy{}
+				warnings = append(warnings, fmt.Sprintf("role not found: %s (user: %s)", role, user.ID))
+				policiesByRole[role.String()] = []*policy.Policy{}
+				if cachedRoles != nil {
+					cachedRoles[role.String()] = &cachedRole{policies: []*policy.Policy{}, notFound: true}
+				}
 				continue
 			}
 			return nil, NewAuthError(user.ID, "resolve_permissions", err.Error(), err)
 		}
-		policiesByRole[role.Account+"."+role.Name] = policies
+		policiesByRole[role.String()] = policies
+		if slices.ContainsFunc(policies, (*policy.Policy).UsesUserContext) {
+			cachedRoles = nil
+		}
+		if c.subjectOwnership != nil {
+			for _, pol := range policies {
+				for _, v := range c.subjectOwnership.Check(pol) {
+					warnings = append(warnings, fmt.Sprintf("foreign subjects granted (%s): %s", v, pol.ID))
+				}
+			}
+		}
+		if limits != nil && !limits.JetStream {
+			for _, pol := range policies {
+				if actions := provider.JetStreamActions(pol); len(actions) > 0 {
+					warnings = append(warnings, fmt.Sprintf("JetStream actions without effect (account %s has JetStream disabled): %s", user.Account, pol.ID))
+				}
+			}
+		}
+		if binding != nil {
+			ttl = policy.MinTTL(ttl, binding.GetTTL())
+			maxTTL = policy.MinTTL(maxTTL, binding.GetMaxTTL())
+			if binding.ExpiresAt != nil {
+				// Sessions must not outlive the grant.
+				remaining := binding.ExpiresAt.Sub(now)
+				maxTTL = policy.MinTTL(maxTTL, remaining.Truncate(time.Second)+time.Second)
+				if remaining <= c.bindingExpiryWarning {
+					warnings = append(warnings, fmt.Sprintf("binding expires soon: %s (at %s, user: %s)", role, binding.ExpiresAt.Format(time.RFC3339), user.ID))
+					c.logger.Warn("binding %s of %s expires in %s", role, user.ID, remaining.Truncate(time.Second))
+				}
+			}
+		}
 
 		ctxCopy := basePolicyCtx.Clone()
 		if ctxCopy == nil {
 			ctxCopy = &policy.PolicyContext{}
 		}
 		ctxCopy.Role = role.Name
-		compileResult := policy.Compile(policies, ctxCopy, compiled)
+		// The inbox depends on the policies of all roles; it is granted once below.
+		ctxCopy.Inbox = policy.InboxNone
+		compiledAny = true
+		compiledPolicies = append(compiledPolicies, policies...)
+		var compileResult policy.CompileResult
+		if explain {
+			compileResult = policy.CompileExplained(policies, ctxCopy, compiled)
+			for _, o := range compileResult.Origins {
+				origin := PermissionOrigin{PermissionOrigin: o}
+				if o.PolicyID != "" {
+					origin.Role = role.String()
+				} else if slices.Contains(origins, origin) {
+					// The user's inbox is granted again for every role.
+					continue
+				}
+				origins = append(origins, origin)
+			}
+		} else {
+			compileResult = policy.Compile(policies, ctxCopy, compiled)
+		}
 		if len(compileResult.Warnings) > 0 {
 			warnings = append(warnings, compileResult.Warnings...)
 		}
+		maxTTL = policy.MinTTL(maxTTL, compileResult.MaxTTL)
+		userLimits = userLimits.Restrict(compileResult.Limits)
+		if cachedRoles != nil {
+			cachedRoles[role.String()] = &cachedRole{policies: policies, warnings: slices.Clone(warnings[roleWarnings:])}
+		}
+	}
+	inbox, inboxWarnings := policy.ResolveInbox(c.accountInbox(user.Account), compiledPolicies)
+	warnings = append(warnings, inboxWarnings...)
+	if cacheKey != "" {
+		var set *permissionSet
+		if cachedRoles != nil {
+			set = newPermissionSet(user.Account, activeRoles, cachedRoles)
+			set.ttl, set.maxTTL, set.limits = ttl, maxTTL, userLimits
+			set.inbox, set.inboxWarnings = inbox, inboxWarnings
+		}
+		c.permissionCache.put(cacheKey, version, set)
+	}
+	if compiledAny {
+		inboxCtx := basePolicyCtx.Clone()
+		if inboxCtx != nil {
+			inboxCtx.Inbox = inbox
+		}
+		if perm, ok, err := policy.InboxPermission(inboxCtx); err != nil {
+			warnings = append(warnings, fmt.Sprintf("inbox skipped (%v, user: %s)", err, user.ID))
+		} else if ok {
+			compiled.Allow(perm)
+			if explain {
+				origin := PermissionOrigin{PermissionOrigin: policy.PermissionOrigin{Permission: perm, Effect: policy.EffectAllow, Implicit: "user inbox"}}
+				origins = append([]PermissionOrigin{origin}, origins...)
+			}
+		}
 	}
 
 	preDedup := compiled.Clone()
@@ -172,88 +813,270 @@ func (c *AuthController) CompileNatsPermissions(ctx context.Context, user *Accou
 	if postDedup != nil {
 		postDedup.Deduplicate()
 	}
+	for i := range origins {
+		origins[i].Effective = isEffective(postDedup, origins[i].Permission, origins[i].Effect)
+	}
 
 	return &NautsCompilationResult{
-		User:           user,
-		Permissions:    postDedup,
-		PermissionsRaw: preDedup,
-		Warnings:       warnings,
-		Roles:          roles,
-		Policies:       policiesByRole,
+		User:            user,
+		Permissions:     postDedup,
+		PermissionsRaw:  preDedup,
+		Warnings:        warnings,
+		Roles:           activeRoles,
+		ExpiredBindings: expiredBindings,
+		Policies:        policiesByRole,
+		TTL:             ttl,
+		MaxTTL:          maxTTL,
+		Limits:          userLimits,
+		Origins:         origins,
 	}, nil
 }
 
+// isEffective reports whether perm with the given effect is part of the
+// deduplicated permissions.
+func isEffective(perms *policy.NatsPermissions, perm policy.Permission, effect policy.Effect) bool {
+	if perms == nil {
+		return false
+	}
+	var list []policy.Permission
+	switch {
+	case perm.Type == policy.PermResp:
+		return effect == policy.EffectAllow && perms.AllowResponses
+	case perm.Type == policy.PermPub && effect == policy.EffectDeny:
+		list = perms.PubDenyList()
+	case perm.Type == policy.PermPub:
+		list = perms.PubList()
+	case effect == policy.EffectDeny:
+		list = perms.SubDenyList()
+	default:
+		list = perms.SubList()
+	}
+	return slices.Contains(list, perm)
+}
+
+// roleBinding returns the role's binding, or nil if the policy provider does
+// not expose bindings or the lookup fails.
+func roleBinding(ctx context.Context, policyProvider provider.PolicyProvider, role identity.Role) *provider.Binding {
+	bp, ok := policyProvider.(provider.BindingProvider)
+	if !ok {
+		return nil
+	}
+	b, err := bp.GetBinding(ctx, role)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
 // AuthResult contains the result of a successful authentication.
 type AuthResult struct {
 	User              *AccountScopedUser
 	UserPublicKey     string
 	CompilationResult *NautsCompilationResult
 	AuthProviderId    string
+	ProviderSelection *identity.ProviderSelection
 	JWT               string
+	// TokenID is the jti claim of JWT.
+	TokenID string
 }
 
 // Authenticate performs the complete authentication flow
 // Parameters:
 //   - ctx: context for the operation
 //   - token: the identity token to verify
-//   - userPublicKey: the user's public key (subject of the JWT). If empty, an ephemeral key is generated.
+//   - userPublicKey: the user's public key (subject of the JWT). Must be a user nkey; if empty, a key is
+//     generated, derived, or the request rejected according to the controller's UserKeyStrategy.
 //   - ttl: time-to-live for the JWT (0 means no expiry)
+//
+// Errors are returned as *PhaseError, naming the step of the flow that failed.
 func (c *AuthController) Authenticate(
 	ctx context.Context,
 	connectOptions natsjwt.ConnectOptions,
 	userPublicKey string,
 	ttl time.Duration,
 ) (*AuthResult, error) {
-	// Step 1: Parse AuthRequest
-	authReq, err := parseAuthRequest(connectOptions.Token)
-	if err != nil {
-		return nil, err
-	}
+	ctx, span := tracing.Start(ctx, "nauts.authenticate")
+	defer span.End()
 
-	// Step 2: select auth provider
-	providerID, provider, err := c.authProviders.SelectProvider(authReq)
+	event := &AuditEvent{}
+	result, err := c.authenticate(ctx, connectOptions, userPublicKey, ttl, event)
+	// Set after authenticate, as coalesced requests copy the event of the first.
+	event.Shadow = ShadowFromContext(ctx)
 	if err != nil {
-		return nil, err
+		err = &PhaseError{Phase: event.Phase, Provider: phaseProvider(event.Phase, event.Provider), Err: err}
+		span.SetAttributes(tracing.String("nauts.phase", event.Phase))
+	}
+	span.SetAttributes(
+		tracing.String("nauts.account", event.Account),
+		tracing.String("nauts.provider", event.Provider),
+		tracing.String("nauts.user_id", event.UserID),
+		tracing.String("nauts.jti", event.TokenID),
+	)
+	span.SetError(err)
+	if c.accountStats != nil {
+		c.recordAccountStats(ctx, event.Account, result, err)
+	}
+	if c.auditLog != nil {
+		c.recordAudit(event, result, err)
 	}
+	return result, err
+}
 
-	// Step 3: Verify user
-	user, err := provider.Verify(ctx, authReq)
-	if err != nil {
-		return nil, err
+// authenticate implements Authenticate. It fills event with the request
+// details and the current phase as the flow progresses.
+func (c *AuthController) authenticate(
+	ctx context.Context,
+	connectOptions natsjwt.ConnectOptions,
+	userPublicKey string,
+	ttl time.Duration,
+	event *AuditEvent,
+) (*AuthResult, error) {
+	// Reject unusable subject keys before doing any work
+	event.Phase = "validate_user_key"
+	if userPublicKey != "" {
+		if err := validateUserPublicKey(userPublicKey); err != nil {
+			return nil, NewAuthError("", "authenticate", "validating user public key", err)
+		}
+	} else if c.userKeyStrategy == UserKeyReject {
+		return nil, NewAuthError("", "authenticate", "no user public key provided", ErrUserPublicKeyRequired)
 	}
 
-	// Step 4: scope user to account
-	userScoped, err := c.ScopeUserToAccount(ctx, user, authReq.Account)
+	// Step 1: Parse AuthRequest
+	event.Phase = "parse_request"
+	authReq, err := c.authRequest(connectOptions)
 	if err != nil {
 		return nil, err
 	}
+	authReq.ClientIP = ClientIPFromContext(ctx)
+	authReq.Nonce = ClientNonceFromContext(ctx)
+	client := ClientInfo{Name: connectOptions.Name, Lang: connectOptions.Lang, Version: connectOptions.Version}
+	ctx = ContextWithClientInfo(ctx, client)
+	event.Account = authReq.Account
 
-	// Step 5: compile NATS permissions
-	compilationResult, err := c.CompileNatsPermissions(ctx, userScoped)
+	// Steps 2-5: select the provider, verify, scope, and compile, shared by
+	// concurrent identical requests if coalescing is enabled
+	var resolved *resolvedRequest
+	if c.coalescer != nil {
+		var shared bool
+		resolved, shared, err = c.coalescer.do(coalescingKey(authReq, client), event, func(event *AuditEvent) (*resolvedRequest, error) {
+			return c.resolve(ctx, authReq, event)
+		})
+		tracing.SpanFromContext(ctx).SetAttributes(tracing.Bool("nauts.coalesced", shared))
+	} else {
+		resolved, err = c.resolve(ctx, authReq, event)
+	}
 	if err != nil {
 		return nil, err
 	}
+	user, userScoped, compilationResult := resolved.user, resolved.userScoped, resolved.compilationResult
+	selection, providerID := resolved.selection, resolved.providerID
 
-	// Step 6: Generate ephemeral key if not provided
+	// Step 6: Generate ephemeral or derived key if not provided
+	event.Phase = "user_key"
 	if userPublicKey == "" {
-		userPublicKey, err = generateEphemeralUserKey()
+		userPublicKey, err = c.defaultUserPublicKey(user.ID)
 		if err != nil {
-			return nil, NewAuthError(user.ID, "authenticate", "failed to generate ephemeral key", err)
+			return nil, NewAuthError(user.ID, "authenticate", "failed to obtain user key", err)
 		}
 	}
 
-	// Step 7: Create JWT
-	jwtToken, err := c.CreateUserJWT(ctx, userScoped, userPublicKey, compilationResult.Permissions, ttl)
+	// Step 7: Create JWT, capped by the TTL limits of the user's roles and policies
+	event.Phase = "create_jwt"
+	issueCtx, span := tracing.Start(ctx, "nauts.issue_jwt", tracing.String("nauts.account", userScoped.Account))
+	var previous *IssuedToken
+	if c.auditLog != nil {
+		previous = c.lastIssued(issueCtx, userScoped)
+	}
+	jwtToken, issued, err := c.issueUserJWT(issueCtx, userScoped, userPublicKey, compilationResult.Permissions, compilationResult.Limits, compilationResult.EffectiveTTL(ttl))
+	span.SetAttributes(tracing.String("nauts.jti", issued.ID), tracing.Int("nauts.jwt_size", len(jwtToken)))
+	span.SetError(err)
+	span.End()
 	if err != nil {
 		return nil, err
 	}
+	event.TokenID = issued.ID
+	if event.PermissionDiff = diffIssuedPermissions(previous, &issued); event.PermissionDiff != nil && event.PermissionDiff.Escalated {
+		c.logger.Info("permissions of %s in account %s escalated since token %s", user.ID, userScoped.Account, previous.ID)
+	}
 
 	return &AuthResult{
 		User:              userScoped,
 		UserPublicKey:     userPublicKey,
 		CompilationResult: compilationResult,
 		AuthProviderId:    providerID,
+		ProviderSelection: selection,
 		JWT:               jwtToken,
+		TokenID:           issued.ID,
+	}, nil
+}
+
+// resolvedRequest is the outcome of steps 2-5 of the authentication flow,
+// which do not depend on the user nkey of the connection. It is shared by
+// coalesced requests and must not be modified.
+type resolvedRequest struct {
+	selection         *identity.ProviderSelection
+	providerID        string
+	user              *identity.User
+	userScoped        *AccountScopedUser
+	compilationResult *NautsCompilationResult
+}
+
+// resolve selects the auth provider for authReq, verifies the user, scopes it
+// to the requested account, and compiles its permissions. Like authenticate,
+// it fills event as the flow progresses.
+func (c *AuthController) resolve(ctx context.Context, authReq identity.AuthRequest, event *AuditEvent) (*resolvedRequest, error) {
+	// Step 2: select auth provider (enforces network restrictions)
+	event.Phase = "select_provider"
+	selection, err := c.authProviders.ExplainSelection(authReq)
+	event.ProviderSelection = selection
+	if err != nil {
+		c.logger.Debug("provider selection failed: %s: %v", selection, err)
+		return nil, err
+	}
+	c.logger.Debug("selected %s", selection)
+	providerID := selection.ProviderID
+	provider := c.authProviders.Provider(providerID)
+	event.Provider = providerID
+
+	// Step 3: Verify user
+	event.Phase = "verify"
+	verifyCtx, span := tracing.Start(ctx, "nauts.verify", tracing.String("nauts.provider", providerID))
+	user, err := provider.Verify(verifyCtx, authReq)
+	span.SetError(err)
+	span.End()
+	if err != nil {
+		return nil, err
+	}
+	if normalized := c.normalizeUserID(providerID, user); normalized != user {
+		event.RawUserID = user.ID
+		user = normalized
+	}
+	event.UserID = user.ID
+
+	// Step 4: scope user to account
+	event.Phase = "scope"
+	scopeCtx, span := tracing.Start(ctx, "nauts.scope_user", tracing.String("nauts.account", authReq.Account))
+	userScoped, err := c.ScopeUserToAccount(scopeCtx, user, authReq.Account)
+	span.SetError(err)
+	span.End()
+	if err != nil {
+		return nil, err
+	}
+
+	// Step 5: compile NATS permissions
+	event.Phase = "compile"
+	compilationResult, err := c.CompileNatsPermissions(ctx, userScoped)
+	if err != nil {
+		return nil, err
+	}
+	event.ExpiredBindings = compilationResult.ExpiredBindings
+
+	return &resolvedRequest{
+		selection:         selection,
+		providerID:        providerID,
+		user:              user,
+		userScoped:        userScoped,
+		compilationResult: compilationResult,
 	}, nil
 }
 
@@ -266,14 +1089,16 @@ func generateEphemeralUserKey() (string, error) {
 	return kp.PublicKey()
 }
 
-// CreateUserJWT creates a signed JWT for the user with the given permissions.
-// The JWT is signed by the account's signer retrieved from the AccountProvider.
+// CreateUserJWT creates a signed JWT for the user with the given permissions
+// and no connection limits. The JWT is signed by the account's signer
+// retrieved from the AccountProvider.
 // Parameters:
 //   - ctx: context for the operation
 //   - user: the user to create the JWT for
-//   - userPublicKey: the user's public key (subject of the JWT)
+//   - userPublicKey: the user's public key (subject of the JWT); must be a user nkey (prefix U)
 //   - permissions: NATS permissions to embed in the JWT
-//   - ttl: time-to-live for the JWT (0 means no expiry)
+//   - ttl: time-to-live for the JWT (0 means no expiry). Callers should derive it with
+//     NautsCompilationResult.EffectiveTTL to honor account and role TTL overrides and limits.
 func (c *AuthController) CreateUserJWT(
 	ctx context.Context,
 	user *AccountScopedUser,
@@ -281,8 +1106,23 @@ func (c *AuthController) CreateUserJWT(
 	permissions *policy.NatsPermissions,
 	ttl time.Duration,
 ) (string, error) {
+	token, _, err := c.issueUserJWT(ctx, user, userPublicKey, permissions, policy.UserLimits{}, ttl)
+	return token, err
+}
+
+// issueUserJWT implements CreateUserJWT with connection limits and also
+// returns the identifying claims of the JWT, which are recorded with the
+// token tracker.
+func (c *AuthController) issueUserJWT(
+	ctx context.Context,
+	user *AccountScopedUser,
+	userPublicKey string,
+	permissions *policy.NatsPermissions,
+	limits policy.UserLimits,
+	ttl time.Duration,
+) (string, IssuedToken, error) {
 	if user == nil {
-		return "", NewAuthError("", "create_jwt", "user is nil", nil)
+		return "", IssuedToken{}, NewAuthError("", "create_jwt", "user is nil", nil)
 	}
 
 	account := user.Account
@@ -290,7 +1130,11 @@ func (c *AuthController) CreateUserJWT(
 	// Get the account from the account provider
 	accountEntity, err := c.accountProvider.GetAccount(ctx, account)
 	if err != nil {
-		return "", NewAuthError(user.ID, "create_jwt", "failed to get account", err)
+		return "", IssuedToken{}, NewAuthError(user.ID, "create_jwt", "failed to get account", err)
+	}
+
+	if err := validateUserPublicKey(userPublicKey); err != nil {
+		return "", IssuedToken{}, NewAuthError(user.ID, "create_jwt", "validating user public key", err)
 	}
 
 	// Determine audience based on operator mode
@@ -308,12 +1152,87 @@ func (c *AuthController) CreateUserJWT(
 	}
 
 	// Issue the JWT using the account's signer
-	token, err := jwt.IssueUserJWT(user.ID, userPublicKey, ttl, permissions, accountEntity.Signer(), audienceAccount, issuerAccount)
+	claims := jwt.NewUserClaims(user.ID, userPublicKey, ttl, permissions, limits, audienceAccount, issuerAccount)
+	token, err := c.jwtEncoder.Encode(claims, accountEntity.Signer())
 	if err != nil {
-		return "", NewAuthError(user.ID, "create_jwt", "failed to issue JWT", err)
+		return "", IssuedToken{}, NewAuthError(user.ID, "create_jwt", "failed to issue JWT", err)
+	}
+
+	c.recordJWTSize(user, len(token))
+
+	// The nats-io/jwt encoding sets the jti (a hash of the claims) and iat on
+	// the encoded claims. Encoders that sign other claims are read back.
+	if claims.ID == "" {
+		if decoded, err := natsjwt.DecodeUserClaims(token); err == nil {
+			claims = decoded
+		}
+	}
+	issued := IssuedToken{
+		ID:            claims.ID,
+		Account:       account,
+		AccountKey:    accountEntity.PublicKey(),
+		UserID:        user.ID,
+		UserPublicKey: userPublicKey,
+		IssuedAt:      time.Unix(claims.IssuedAt, 0).UTC(),
+		Permissions:   &claims.Permissions,
+	}
+	if claims.Expires > 0 {
+		expires := time.Unix(claims.Expires, 0).UTC()
+		issued.ExpiresAt = &expires
+	}
+	if c.tokenTracker != nil && !ShadowFromContext(ctx) {
+		if err := c.tokenTracker.Track(ctx, issued); err != nil {
+			c.logger.Warn("failed to track JWT %s of %s in account %s, it cannot be revoked: %v", issued.ID, user.ID, account, err)
+		}
 	}
 
-	return token, nil
+	return token, issued, nil
+}
+
+// normalizeUserID applies the controller's UserIDNormalizer to the ID of a
+// user verified by providerID. It returns user itself if the ID is
+// unchanged, and otherwise a copy with the normalized ID.
+func (c *AuthController) normalizeUserID(providerID string, user *identity.User) *identity.User {
+	if c.userIDNormalizer == nil {
+		return user
+	}
+	id := c.userIDNormalizer.NormalizeUserID(providerID, user.ID)
+	if id == user.ID {
+		return user
+	}
+	normalized := *user
+	normalized.ID = id
+	return &normalized
+}
+
+// lastIssued returns the last token issued to user, if the token tracker
+// remembers issuances.
+func (c *AuthController) lastIssued(ctx context.Context, user *AccountScopedUser) *IssuedToken {
+	history, ok := c.tokenTracker.(IssuanceHistory)
+	if !ok {
+		return nil
+	}
+	previous, err := history.LastIssued(ctx, user.Account, user.ID)
+	if err != nil {
+		c.logger.Warn("failed to read the last token of %s in account %s, permission changes are not audited: %v", user.ID, user.Account, err)
+		return nil
+	}
+	return previous
+}
+
+// recordJWTSize observes the JWT size for each of the user's roles and warns
+// when the size reaches the configured threshold.
+func (c *AuthController) recordJWTSize(user *AccountScopedUser, size int) {
+	m := c.jwtSizeMetrics
+	if m == nil {
+		return
+	}
+	for _, role := range c.collectRoles(user) {
+		m.Observe(role.Account, role.Name, size)
+	}
+	if m.WarnThreshold > 0 && size >= m.WarnThreshold {
+		c.logger.Warn("user JWT for %s in account %s is %d bytes (warning threshold %d)", user.ID, user.Account, size, m.WarnThreshold)
+	}
 }
 
 // DefaultRoleName is the implicit role applied to every user.
@@ -321,27 +1240,36 @@ const DefaultRoleName = "default"
 
 // collectRoles returns all roles for a user, always including the default role.
 func (c *AuthController) collectRoles(user *AccountScopedUser) []identity.Role {
-	seen := make(map[string]bool)
+	seen := make(map[identity.Role]bool)
 	roles := make([]identity.Role, 0, 8)
 
 	// Always include default role first.
 	defaultRole := identity.Role{Account: user.Account, Name: DefaultRoleName}
-	seen[defaultRole.Account+"."+defaultRole.Name] = true
+	seen[defaultRole] = true
 	roles = append(roles, defaultRole)
 
 	// Add user's roles.
 	for _, r := range user.Roles {
-		key := r.Account + "." + r.Name
-		if seen[key] {
+		if seen[r] {
 			continue
 		}
-		seen[key] = true
+		seen[r] = true
 		roles = append(roles, r)
 	}
 
 	return roles
 }
 
+// policyContext returns the policy context of user with the client details
+// of ctx (ContextWithClientIP, ContextWithClientInfo).
+func policyContext(ctx context.Context, user *AccountScopedUser) *policy.PolicyContext {
+	policyCtx := userToPolicyContext(user)
+	client := ClientInfoFromContext(ctx)
+	policyCtx.ClientIP = ClientIPFromContext(ctx)
+	policyCtx.ClientName, policyCtx.ClientLang, policyCtx.ClientVersion = client.Name, client.Lang, client.Version
+	return policyCtx
+}
+
 // userToPolicyContext converts an AccountScopedUser to a policy.PolicyContext for policy compilation.
 func userToPolicyContext(user *AccountScopedUser) *policy.PolicyContext {
 	if user == nil {
@@ -1,10 +1,16 @@
 package auth
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"net/netip"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,7 +20,10 @@ import (
 	"github.com/nats-io/nkeys"
 
 	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/jwt"
+	"github.com/msimon/nauts/policy"
 	"github.com/msimon/nauts/provider"
+	"github.com/msimon/nauts/tracing"
 )
 
 // testLogger captures log messages for testing
@@ -144,6 +153,93 @@ func TestCompileNatsPermissions_DefaultRole(t *testing.T) {
 	_ = result
 }
 
+func TestCompileNatsPermissions_SubjectOwnership(t *testing.T) {
+	ctrl := createTestController(t)
+	ownership, err := policy.NewSubjectOwnership([]policy.SubjectClaim{
+		{Account: "test-account", Team: "secrets", Prefixes: []string{"test.secret"}},
+	})
+	if err != nil {
+		t.Fatalf("NewSubjectOwnership() error = %v", err)
+	}
+	WithSubjectOwnership(ownership)(ctrl)
+
+	user := &AccountScopedUser{
+		User: identity.User{
+			ID:    "alice",
+			Roles: []identity.Role{{Account: "test-account", Name: "workers"}},
+		},
+		Account: "test-account",
+	}
+	result, err := ctrl.CompileNatsPermissions(context.Background(), user)
+	if err != nil {
+		t.Fatalf("CompileNatsPermissions() error = %v", err)
+	}
+	want := `foreign subjects granted (statement 0: resource "nats:test.>" reaches into "test.secret" owned by team secrets): allow-basic`
+	if len(result.Warnings) != 1 || result.Warnings[0] != want {
+		t.Errorf("Warnings = %q, want [%q]", result.Warnings, want)
+	}
+	// Ownership is advisory: the permissions are granted.
+	if !slices.Contains(result.Permissions.PubList(), policy.Permission{Type: policy.PermPub, Subject: "test.>"}) {
+		t.Errorf("Permissions = %v, want pub test.>", result.Permissions)
+	}
+}
+
+func TestExplainToken(t *testing.T) {
+	ctrl := createTestController(t)
+
+	result, err := ctrl.ExplainToken(context.Background(), `{"account":"test-account","token":"alice:secret123"}`)
+	if err != nil {
+		t.Fatalf("ExplainToken() error = %v", err)
+	}
+	if result.User.ID != "alice" {
+		t.Errorf("result.User.ID = %q, want alice", result.User.ID)
+	}
+
+	want := PermissionOrigin{
+		PermissionOrigin: policy.PermissionOrigin{
+			Permission:    policy.Permission{Type: policy.PermPub, Subject: "test.>"},
+			Effect:        policy.EffectAllow,
+			PolicyID:      "allow-basic",
+			PolicyAccount: "test-account",
+			Statement:     0,
+			Resource:      "nats:test.>",
+			Action:        policy.ActionNATSPub,
+		},
+		Role:      "test-account.workers",
+		Effective: true,
+	}
+	if !slices.Contains(result.Origins, want) {
+		t.Errorf("Origins = %+v, missing %+v", result.Origins, want)
+	}
+
+	// The inbox is granted once per role but explained once.
+	var inbox int
+	for _, o := range result.Origins {
+		if o.Implicit == "user inbox" {
+			inbox++
+			if o.Role != "" || !o.Effective {
+				t.Errorf("inbox origin = %+v", o)
+			}
+		}
+	}
+	if inbox != 1 {
+		t.Errorf("inbox explained %d times, want 1", inbox)
+	}
+
+	// Explaining leaves regular compilation untouched.
+	compiled, err := ctrl.CompileNatsPermissions(context.Background(), result.User)
+	if err != nil {
+		t.Fatalf("CompileNatsPermissions() error = %v", err)
+	}
+	if compiled.Origins != nil {
+		t.Errorf("CompileNatsPermissions() Origins = %v, want nil", compiled.Origins)
+	}
+
+	if _, err := ctrl.ExplainToken(context.Background(), `{"account":"test-account","token":"alice:wrong"}`); err == nil {
+		t.Error("ExplainToken() with invalid credentials succeeded")
+	}
+}
+
 func TestCreateUserJWT(t *testing.T) {
 	ctrl := createTestController(t)
 
@@ -182,6 +278,52 @@ func TestCreateUserJWT(t *testing.T) {
 	}
 }
 
+func TestCreateUserJWT_CustomEncoder(t *testing.T) {
+	ctrl := createTestController(t)
+
+	user := &AccountScopedUser{
+		User: identity.User{
+			ID:    "alice",
+			Roles: []identity.Role{{Account: "test-account", Name: "workers"}},
+		},
+		Account: "test-account",
+	}
+	userKp, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatalf("creating user keypair: %v", err)
+	}
+	userPub, err := userKp.PublicKey()
+	if err != nil {
+		t.Fatalf("getting user public key: %v", err)
+	}
+
+	WithUserJWTEncoder(jwt.UserJWTEncoderFunc(func(claims *natsjwt.UserClaims, signer jwt.Signer) (string, error) {
+		claims.Tags.Add("org:acme")
+		return jwt.DefaultUserJWTEncoder.Encode(claims, signer)
+	}))(ctrl)
+
+	token, err := ctrl.CreateUserJWT(context.Background(), user, userPub, nil, time.Hour)
+	if err != nil {
+		t.Fatalf("CreateUserJWT() error = %v", err)
+	}
+	claims, err := natsjwt.DecodeUserClaims(token)
+	if err != nil {
+		t.Fatalf("decoding user claims: %v", err)
+	}
+	if !claims.Tags.Contains("org:acme") {
+		t.Errorf("tags = %v, want org:acme", claims.Tags)
+	}
+
+	errRejected := errors.New("rejected")
+	WithUserJWTEncoder(jwt.UserJWTEncoderFunc(func(*natsjwt.UserClaims, jwt.Signer) (string, error) {
+		return "", errRejected
+	}))(ctrl)
+
+	if _, err := ctrl.CreateUserJWT(context.Background(), user, userPub, nil, time.Hour); !errors.Is(err, errRejected) {
+		t.Errorf("CreateUserJWT() error = %v, want %v", err, errRejected)
+	}
+}
+
 func TestCreateUserJWT_NilUser(t *testing.T) {
 	ctrl := createTestController(t)
 
@@ -210,6 +352,49 @@ func TestCreateUserJWT_AccountNotFound(t *testing.T) {
 	}
 }
 
+func TestParseAuthRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		token       string
+		wantVersion int
+		wantErr     error
+		wantErrText string
+	}{
+		{name: "unversioned", token: `{"account":"APP","token":"alice:secret"}`},
+		{name: "version 1", token: `{"v":1,"account":"APP","token":"alice:secret"}`, wantVersion: 1},
+		{name: "unknown fields are ignored", token: `{"v":1,"account":"APP","token":"alice:secret","otp":"123456"}`, wantVersion: 1},
+		{name: "newer version", token: `{"v":2,"account":"APP","token":"alice:secret","otp":"123456"}`, wantErr: identity.ErrUnsupportedAuthRequestVersion},
+		{name: "newer version with incompatible fields", token: `{"v":2,"account":{"name":"APP"}}`, wantErr: identity.ErrUnsupportedAuthRequestVersion},
+		{name: "negative version", token: `{"v":-1,"account":"APP","token":"alice:secret"}`, wantErr: identity.ErrUnsupportedAuthRequestVersion},
+		{name: "non-integer version", token: `{"v":"1","account":"APP","token":"alice:secret"}`, wantErrText: "auth request version must be an integer"},
+		{name: "not json", token: `alice:secret`, wantErrText: "decoding auth request"},
+		{name: "missing account", token: `{"v":1,"token":"alice:secret"}`, wantErrText: "account field is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := parseAuthRequest(tt.token)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("parseAuthRequest() error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantErrText != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrText) {
+					t.Fatalf("parseAuthRequest() error = %v, want containing %q", err, tt.wantErrText)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("parseAuthRequest() error = %v", err)
+				}
+				if req.Version != tt.wantVersion || req.Account != "APP" {
+					t.Errorf("parseAuthRequest() = %+v, want version %d for APP", req, tt.wantVersion)
+				}
+			}
+		})
+	}
+}
+
 func TestAuthenticate_Success(t *testing.T) {
 	ctrl := createTestController(t)
 
@@ -250,6 +435,264 @@ func TestAuthenticate_Success(t *testing.T) {
 	}
 }
 
+func TestAuthenticate_UserPassword(t *testing.T) {
+	tests := []struct {
+		name           string
+		enabled        bool
+		defaultAccount string
+		opts           natsjwt.ConnectOptions
+		wantErr        string
+	}{
+		{name: "account prefix", enabled: true, opts: natsjwt.ConnectOptions{Username: "test-account/alice", Password: "secret123"}},
+		{name: "default account", enabled: true, defaultAccount: "test-account", opts: natsjwt.ConnectOptions{Username: "alice", Password: "secret123"}},
+		{name: "no account", enabled: true, opts: natsjwt.ConnectOptions{Username: "alice", Password: "secret123"}, wantErr: "<account>/<username>"},
+		{name: "wrong password", enabled: true, opts: natsjwt.ConnectOptions{Username: "test-account/alice", Password: "wrong"}, wantErr: "invalid credentials"},
+		{name: "colon in username", enabled: true, opts: natsjwt.ConnectOptions{Username: "test-account/al:ice", Password: "secret123"}, wantErr: "invalid username"},
+		{name: "wildcard account", enabled: true, opts: natsjwt.ConnectOptions{Username: "test-*/alice", Password: "secret123"}, wantErr: "wildcards"},
+		{
+			name: "token takes precedence", enabled: true,
+			opts: natsjwt.ConnectOptions{Username: "test-account/alice", Password: "wrong", Token: `{"account":"test-account","token":"alice:secret123"}`},
+		},
+		{name: "disabled", opts: natsjwt.ConnectOptions{Username: "test-account/alice", Password: "secret123"}, wantErr: "decoding auth request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := createTestController(t)
+			if tt.enabled {
+				WithUserPassword("file", tt.defaultAccount)(ctrl)
+			}
+			result, err := ctrl.Authenticate(context.Background(), tt.opts, "", time.Hour)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Authenticate() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if result.User.ID != "alice" || result.User.Account != "test-account" || result.AuthProviderId != "file" {
+				t.Errorf("user = %s in %s via %s, want alice in test-account via file", result.User.ID, result.User.Account, result.AuthProviderId)
+			}
+		})
+	}
+}
+
+// nkeyStore is an identity.NkeyIdentityStore backed by a map.
+type nkeyStore map[string]*identity.NkeyIdentity
+
+func (s nkeyStore) GetIdentity(_ context.Context, publicKey string) (*identity.NkeyIdentity, error) {
+	if ident, ok := s[publicKey]; ok {
+		return ident, nil
+	}
+	return nil, identity.ErrUserNotFound
+}
+
+func TestAuthenticate_Nkey(t *testing.T) {
+	userKp, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatalf("creating user keypair: %v", err)
+	}
+	userPub, _ := userKp.PublicKey()
+	nonce := "server-nonce"
+	rawSig, err := userKp.Sign([]byte(nonce))
+	if err != nil {
+		t.Fatalf("signing nonce: %v", err)
+	}
+	sig := base64.RawURLEncoding.EncodeToString(rawSig)
+
+	tmpDir := t.TempDir()
+	nkeyProvider, err := identity.NewNkeyAuthenticationProvider(identity.NkeyAuthenticationProviderConfig{
+		Accounts: []string{"*"},
+		Store: nkeyStore{userPub: {
+			ID:       "sensor-1",
+			Accounts: []string{"test-account"},
+			Roles:    []string{"test-account.workers"},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("creating nkey provider: %v", err)
+	}
+	manager, err := identity.NewAuthenticationProviderManager(map[string]identity.AuthenticationProvider{
+		"file":     createTestIdentityProvider(t, tmpDir),
+		"machines": nkeyProvider,
+	})
+	if err != nil {
+		t.Fatalf("creating provider manager: %v", err)
+	}
+	ctrl := NewAuthController(createTestAccountProvider(t, tmpDir), createTestPolicyProvider(t, tmpDir), manager,
+		WithLogger(&testLogger{}), WithNkeyAuthentication("machines", ""))
+
+	tests := []struct {
+		name    string
+		nonce   string
+		opts    natsjwt.ConnectOptions
+		wantErr string
+	}{
+		{name: "signed nonce", nonce: nonce, opts: natsjwt.ConnectOptions{Nkey: userPub, SignedNonce: sig, Username: "test-account"}},
+		{name: "no account", nonce: nonce, opts: natsjwt.ConnectOptions{Nkey: userPub, SignedNonce: sig}, wantErr: "user must name the account"},
+		{name: "other nonce", nonce: "replayed", opts: natsjwt.ConnectOptions{Nkey: userPub, SignedNonce: sig, Username: "test-account"}, wantErr: "invalid nonce signature"},
+		{name: "no nonce", opts: natsjwt.ConnectOptions{Nkey: userPub, SignedNonce: sig, Username: "test-account"}, wantErr: "missing nonce signature"},
+		{name: "account not mapped", nonce: nonce, opts: natsjwt.ConnectOptions{Nkey: userPub, SignedNonce: sig, Username: "other"}, wantErr: "invalid account"},
+		{
+			name: "token takes precedence", nonce: nonce,
+			opts: natsjwt.ConnectOptions{Nkey: userPub, SignedNonce: sig, Token: `{"account":"test-account","token":"alice:secret123","ap":"file"}`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := ContextWithClientNonce(context.Background(), tt.nonce)
+			result, err := ctrl.Authenticate(ctx, tt.opts, "", time.Hour)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Authenticate() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if tt.opts.Token == "" && (result.User.ID != "sensor-1" || result.AuthProviderId != "machines" || len(result.User.Roles) != 1) {
+				t.Errorf("user = %s with roles %v via %s, want sensor-1 with workers via machines", result.User.ID, result.User.Roles, result.AuthProviderId)
+			}
+		})
+	}
+}
+
+func TestAuthenticate_InvalidUserPublicKey(t *testing.T) {
+	ctrl := createTestController(t)
+
+	accountKp, err := nkeys.CreateAccount()
+	if err != nil {
+		t.Fatalf("creating account keypair: %v", err)
+	}
+	accountPub, err := accountKp.PublicKey()
+	if err != nil {
+		t.Fatalf("getting account public key: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		wantMsg string
+	}{
+		{name: "account key", key: accountPub, wantMsg: "got account key"},
+		{name: "garbage", key: "UABC", wantMsg: "not a valid nkey"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ctrl.Authenticate(context.Background(), natsjwt.ConnectOptions{
+				Token: `{"account":"test-account","token":"alice:secret123"}`,
+			}, tt.key, time.Hour)
+			if !errors.Is(err, ErrInvalidUserPublicKey) {
+				t.Fatalf("Authenticate() error = %v, want ErrInvalidUserPublicKey", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("error = %q, want it to contain %q", err.Error(), tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestAuthenticate_UserKeyStrategy(t *testing.T) {
+	connectOptions := natsjwt.ConnectOptions{
+		Token: `{"account":"test-account","token":"alice:secret123"}`,
+	}
+
+	t.Run("ephemeral", func(t *testing.T) {
+		ctrl := createTestController(t)
+		first, err := ctrl.Authenticate(context.Background(), connectOptions, "", time.Hour)
+		if err != nil {
+			t.Fatalf("Authenticate() error = %v", err)
+		}
+		second, err := ctrl.Authenticate(context.Background(), connectOptions, "", time.Hour)
+		if err != nil {
+			t.Fatalf("Authenticate() error = %v", err)
+		}
+		if !nkeys.IsValidPublicUserKey(first.UserPublicKey) {
+			t.Errorf("UserPublicKey = %q, want a user nkey", first.UserPublicKey)
+		}
+		if first.UserPublicKey == second.UserPublicKey {
+			t.Error("expected a new ephemeral key per request")
+		}
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		ctrl := createTestController(t)
+		WithUserKeyStrategy(UserKeyReject, nil)(ctrl)
+		_, err := ctrl.Authenticate(context.Background(), connectOptions, "", time.Hour)
+		if !errors.Is(err, ErrUserPublicKeyRequired) {
+			t.Errorf("Authenticate() error = %v, want ErrUserPublicKeyRequired", err)
+		}
+	})
+
+	t.Run("derived", func(t *testing.T) {
+		ctrl := createTestController(t)
+		WithUserKeyStrategy(UserKeyDerived, []byte("secret"))(ctrl)
+		first, err := ctrl.Authenticate(context.Background(), connectOptions, "", time.Hour)
+		if err != nil {
+			t.Fatalf("Authenticate() error = %v", err)
+		}
+		second, err := ctrl.Authenticate(context.Background(), connectOptions, "", time.Hour)
+		if err != nil {
+			t.Fatalf("Authenticate() error = %v", err)
+		}
+		if !nkeys.IsValidPublicUserKey(first.UserPublicKey) {
+			t.Errorf("UserPublicKey = %q, want a user nkey", first.UserPublicKey)
+		}
+		if first.UserPublicKey != second.UserPublicKey {
+			t.Errorf("derived keys differ: %q != %q", first.UserPublicKey, second.UserPublicKey)
+		}
+
+		other, err := deriveUserKey([]byte("other-secret"), "alice")
+		if err != nil {
+			t.Fatalf("deriveUserKey() error = %v", err)
+		}
+		if other == first.UserPublicKey {
+			t.Error("expected a different key for a different secret")
+		}
+	})
+
+	t.Run("derived without secret", func(t *testing.T) {
+		ctrl := createTestController(t)
+		WithUserKeyStrategy(UserKeyDerived, nil)(ctrl)
+		if _, err := ctrl.Authenticate(context.Background(), connectOptions, "", time.Hour); err == nil {
+			t.Error("expected error for derived keys without a secret")
+		}
+	})
+}
+
+func TestAuthenticate_ClientIP(t *testing.T) {
+	ctrl := createTestController(t)
+	office, err := identity.ParseNetworks([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("ParseNetworks() error = %v", err)
+	}
+	manager, err := identity.NewAuthenticationProviderManager(
+		map[string]identity.AuthenticationProvider{"file": createTestIdentityProvider(t, t.TempDir())},
+		identity.WithAllowedNetworks("file", office),
+	)
+	if err != nil {
+		t.Fatalf("creating provider manager: %v", err)
+	}
+	ctrl.authProviders = manager
+
+	connectOptions := natsjwt.ConnectOptions{
+		Token: `{"account":"test-account","token":"alice:secret123"}`,
+	}
+
+	ctx := ContextWithClientIP(context.Background(), netip.MustParseAddr("10.0.0.1"))
+	if _, err := ctrl.Authenticate(ctx, connectOptions, "", time.Hour); err != nil {
+		t.Fatalf("Authenticate() from allowed network error = %v", err)
+	}
+
+	ctx = ContextWithClientIP(context.Background(), netip.MustParseAddr("192.0.2.1"))
+	if _, err := ctrl.Authenticate(ctx, connectOptions, "", time.Hour); !errors.Is(err, identity.ErrAuthenticationProviderNotAllowed) {
+		t.Errorf("Authenticate() error = %v, want ErrAuthenticationProviderNotAllowed", err)
+	}
+}
+
 func TestAuthenticate_InvalidCredentials(t *testing.T) {
 	ctrl := createTestController(t)
 
@@ -268,6 +711,10 @@ func TestAuthenticate_InvalidCredentials(t *testing.T) {
 	if err == nil {
 		t.Fatal("Authenticate() expected error")
 	}
+	var phaseErr *PhaseError
+	if !errors.As(err, &phaseErr) || phaseErr.Phase != "verify" || phaseErr.Provider != "auth provider file" {
+		t.Errorf("Authenticate() error = %#v, want *PhaseError in verify of auth provider file", err)
+	}
 }
 
 func TestAuthenticate_EphemeralKey(t *testing.T) {
@@ -304,6 +751,226 @@ func TestAuthenticate_EphemeralKey(t *testing.T) {
 	}
 }
 
+func TestAuthenticate_MaxTTL(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	policiesFile := filepath.Join(tmpDir, "policies.json")
+	bindingsFile := filepath.Join(tmpDir, "bindings.json")
+	policiesContent := `[
+  {"id": "allow-basic", "account": "test-account", "name": "Basic", "maxTTL": "30m",
+   "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:test.>"]}]}
+]`
+	bindingsContent := `[
+  {"role": "workers", "account": "test-account", "policies": ["allow-basic"], "maxTTL": "15m"}
+]`
+	if err := os.WriteFile(policiesFile, []byte(policiesContent), 0644); err != nil {
+		t.Fatalf("writing policies file: %v", err)
+	}
+	if err := os.WriteFile(bindingsFile, []byte(bindingsContent), 0644); err != nil {
+		t.Fatalf("writing bindings file: %v", err)
+	}
+	pp, err := provider.NewFilePolicyProvider(provider.FilePolicyProviderConfig{
+		PoliciesPath: policiesFile,
+		BindingsPath: bindingsFile,
+	})
+	if err != nil {
+		t.Fatalf("creating policy provider: %v", err)
+	}
+
+	manager, err := identity.NewAuthenticationProviderManager(map[string]identity.AuthenticationProvider{
+		"file": createTestIdentityProvider(t, tmpDir),
+	})
+	if err != nil {
+		t.Fatalf("creating provider manager: %v", err)
+	}
+	ctrl := NewAuthController(createTestAccountProvider(t, tmpDir), pp, manager, WithLogger(&testLogger{}))
+
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		want time.Duration
+	}{
+		{name: "longer ttl is capped", ttl: time.Hour, want: 15 * time.Minute},
+		{name: "no expiry is capped", ttl: 0, want: 15 * time.Minute},
+		{name: "shorter ttl is kept", ttl: 5 * time.Minute, want: 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ctrl.Authenticate(context.Background(), natsjwt.ConnectOptions{
+				Token: `{"account":"test-account","token":"alice:secret123"}`,
+			}, "", tt.ttl)
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if result.CompilationResult.MaxTTL != 15*time.Minute {
+				t.Errorf("MaxTTL = %v, want 15m", result.CompilationResult.MaxTTL)
+			}
+
+			claims, err := natsjwt.DecodeUserClaims(result.JWT)
+			if err != nil {
+				t.Fatalf("decoding JWT: %v", err)
+			}
+			if got := time.Duration(claims.Expires-claims.IssuedAt) * time.Second; got != tt.want {
+				t.Errorf("JWT lifetime = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticate_TTLOverrides(t *testing.T) {
+	tests := []struct {
+		name       string
+		binding    string
+		accountTTL time.Duration
+		want       time.Duration
+	}{
+		{name: "no override", binding: `"ttl": ""`, want: time.Hour},
+		{name: "role ttl replaces default", binding: `"ttl": "24h"`, want: 24 * time.Hour},
+		{name: "account ttl replaces default", binding: `"ttl": ""`, accountTTL: 30 * time.Minute, want: 30 * time.Minute},
+		{name: "smallest override wins", binding: `"ttl": "24h"`, accountTTL: 15 * time.Minute, want: 15 * time.Minute},
+		{name: "maxTTL caps override", binding: `"ttl": "24h", "maxTTL": "2h"`, want: 2 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			policiesFile := filepath.Join(tmpDir, "policies.json")
+			bindingsFile := filepath.Join(tmpDir, "bindings.json")
+			policiesContent := `[
+  {"id": "allow-basic", "account": "test-account", "name": "Basic",
+   "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:test.>"]}]}
+]`
+			bindingsContent := `[{"role": "workers", "account": "test-account", "policies": ["allow-basic"], ` + tt.binding + `}]`
+			if err := os.WriteFile(policiesFile, []byte(policiesContent), 0644); err != nil {
+				t.Fatalf("writing policies file: %v", err)
+			}
+			if err := os.WriteFile(bindingsFile, []byte(bindingsContent), 0644); err != nil {
+				t.Fatalf("writing bindings file: %v", err)
+			}
+			pp, err := provider.NewFilePolicyProvider(provider.FilePolicyProviderConfig{
+				PoliciesPath: policiesFile,
+				BindingsPath: bindingsFile,
+			})
+			if err != nil {
+				t.Fatalf("creating policy provider: %v", err)
+			}
+			manager, err := identity.NewAuthenticationProviderManager(map[string]identity.AuthenticationProvider{
+				"file": createTestIdentityProvider(t, tmpDir),
+			})
+			if err != nil {
+				t.Fatalf("creating provider manager: %v", err)
+			}
+			var accountTTLs map[string]time.Duration
+			if tt.accountTTL > 0 {
+				accountTTLs = map[string]time.Duration{"test-account": tt.accountTTL}
+			}
+			ctrl := NewAuthController(createTestAccountProvider(t, tmpDir), pp, manager,
+				WithLogger(&testLogger{}), WithAccountTTLs(accountTTLs))
+
+			result, err := ctrl.Authenticate(context.Background(), natsjwt.ConnectOptions{
+				Token: `{"account":"test-account","token":"alice:secret123"}`,
+			}, "", time.Hour)
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			claims, err := natsjwt.DecodeUserClaims(result.JWT)
+			if err != nil {
+				t.Fatalf("decoding JWT: %v", err)
+			}
+			if got := time.Duration(claims.Expires-claims.IssuedAt) * time.Second; got != tt.want {
+				t.Errorf("JWT lifetime = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticate_BindingExpiry(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name        string
+		expiresAt   time.Time
+		wantExpired bool
+		wantWarning bool
+		maxLifetime time.Duration
+	}{
+		{name: "expired binding is skipped", expiresAt: now.Add(-time.Minute), wantExpired: true},
+		{name: "expiring binding caps the session", expiresAt: now.Add(30 * time.Minute), wantWarning: true, maxLifetime: 31 * time.Minute},
+		{name: "distant expiry", expiresAt: now.Add(72 * time.Hour), maxLifetime: time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			policiesFile := filepath.Join(tmpDir, "policies.json")
+			bindingsFile := filepath.Join(tmpDir, "bindings.json")
+			policiesContent := `[
+  {"id": "allow-basic", "account": "test-account", "name": "Basic",
+   "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:test.>"]}]}
+]`
+			bindingsContent := `[{"role": "workers", "account": "test-account", "policies": ["allow-basic"], "expiresAt": "` + tt.expiresAt.Format(time.RFC3339) + `"}]`
+			if err := os.WriteFile(policiesFile, []byte(policiesContent), 0644); err != nil {
+				t.Fatalf("writing policies file: %v", err)
+			}
+			if err := os.WriteFile(bindingsFile, []byte(bindingsContent), 0644); err != nil {
+				t.Fatalf("writing bindings file: %v", err)
+			}
+			pp, err := provider.NewFilePolicyProvider(provider.FilePolicyProviderConfig{
+				PoliciesPath: policiesFile,
+				BindingsPath: bindingsFile,
+			})
+			if err != nil {
+				t.Fatalf("creating policy provider: %v", err)
+			}
+			manager, err := identity.NewAuthenticationProviderManager(map[string]identity.AuthenticationProvider{
+				"file": createTestIdentityProvider(t, tmpDir),
+			})
+			if err != nil {
+				t.Fatalf("creating provider manager: %v", err)
+			}
+			var audit bytes.Buffer
+			logger := &testLogger{}
+			ctrl := NewAuthController(createTestAccountProvider(t, tmpDir), pp, manager,
+				WithLogger(logger), WithAuditLog(NewAuditLog(NewWriterAuditSink(&audit))))
+
+			result, err := ctrl.Authenticate(context.Background(), natsjwt.ConnectOptions{
+				Token: `{"account":"test-account","token":"alice:secret123"}`,
+			}, "", time.Hour)
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			cr := result.CompilationResult
+
+			var event AuditEvent
+			if err := json.Unmarshal(audit.Bytes(), &event); err != nil {
+				t.Fatalf("decoding audit event: %v", err)
+			}
+			if tt.wantExpired {
+				if len(cr.ExpiredBindings) != 1 || cr.ExpiredBindings[0] != "test-account.workers" || slices.Contains(cr.Roles, identity.Role{Account: "test-account", Name: "workers"}) {
+					t.Errorf("ExpiredBindings = %v, Roles = %v", cr.ExpiredBindings, cr.Roles)
+				}
+				if slices.Contains(cr.Permissions.PubList(), policy.Permission{Type: policy.PermPub, Subject: "test.>"}) {
+					t.Errorf("expired binding granted %v", cr.Permissions.PubList())
+				}
+				if len(event.ExpiredBindings) != 1 {
+					t.Errorf("audit expired_bindings = %v", event.ExpiredBindings)
+				}
+				return
+			}
+			if len(cr.ExpiredBindings) != 0 || event.ExpiredBindings != nil || !slices.Contains(cr.Permissions.PubList(), policy.Permission{Type: policy.PermPub, Subject: "test.>"}) {
+				t.Errorf("ExpiredBindings = %v, audit = %v, pub = %v", cr.ExpiredBindings, event.ExpiredBindings, cr.Permissions.PubList())
+			}
+			if got := len(logger.warnings) > 0; got != tt.wantWarning {
+				t.Errorf("expiry warning logged = %v, want %v", got, tt.wantWarning)
+			}
+			claims, err := natsjwt.DecodeUserClaims(result.JWT)
+			if err != nil {
+				t.Fatalf("decoding JWT: %v", err)
+			}
+			if got := time.Duration(claims.Expires-claims.IssuedAt) * time.Second; got > tt.maxLifetime || got < tt.maxLifetime-2*time.Minute {
+				t.Errorf("JWT lifetime = %v, want about %v", got, tt.maxLifetime)
+			}
+		})
+	}
+}
+
 // createTestController creates an AuthController with test providers.
 func createTestController(t *testing.T) *AuthController {
 	t.Helper()
@@ -466,3 +1133,232 @@ func (m *mockAuthProviderWithWildcard) Verify(_ context.Context, req identity.Au
 		},
 	}, nil
 }
+
+// spanRecorder is a tracing.Exporter keeping exported spans.
+type spanRecorder struct {
+	spans []tracing.SpanData
+}
+
+func (r *spanRecorder) Export(_ context.Context, _ []tracing.Attribute, spans []tracing.SpanData) error {
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func TestAuthenticate_Tracing(t *testing.T) {
+	ctrl := createTestController(t)
+	recorder := &spanRecorder{}
+	tracer := tracing.NewTracer(recorder, tracing.TracerOptions{})
+	tracing.SetDefault(tracer)
+	defer tracing.SetDefault(nil)
+
+	ctx := context.Background()
+	if _, err := ctrl.Authenticate(ctx, natsjwt.ConnectOptions{
+		Token: `{"account":"test-account","token":"alice:secret123"}`,
+	}, "", time.Hour); err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if _, err := ctrl.Authenticate(ctx, natsjwt.ConnectOptions{
+		Token: `{"account":"test-account","token":"alice:wrongpassword"}`,
+	}, "", time.Hour); err == nil {
+		t.Fatal("Authenticate() with wrong password succeeded")
+	}
+	if err := tracer.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	byName := make(map[string][]tracing.SpanData)
+	for _, s := range recorder.spans {
+		byName[s.Name] = append(byName[s.Name], s)
+	}
+	for _, name := range []string{"nauts.verify", "nauts.scope_user", "nauts.compile_permissions", "nauts.fetch_policies", "nauts.issue_jwt"} {
+		if len(byName[name]) == 0 {
+			t.Errorf("no %s span", name)
+		}
+	}
+	roots := byName["nauts.authenticate"]
+	if len(roots) != 2 {
+		t.Fatalf("got %d nauts.authenticate spans, want 2", len(roots))
+	}
+	success, failure := roots[0], roots[1]
+	if success.Failed || !slices.Contains(success.Attributes, tracing.String("nauts.user_id", "alice")) {
+		t.Errorf("success span = %+v", success)
+	}
+	if !failure.Failed || !slices.Contains(failure.Attributes, tracing.String("nauts.phase", "verify")) {
+		t.Errorf("failure span = %+v, want failure in verify", failure)
+	}
+	issue := byName["nauts.issue_jwt"][0]
+	if issue.TraceID != success.TraceID || issue.ParentID != success.SpanID {
+		t.Error("nauts.issue_jwt is not a child of nauts.authenticate")
+	}
+	verify := byName["nauts.verify"]
+	if len(verify) != 2 || !verify[1].Failed || verify[1].TraceID != failure.TraceID {
+		t.Errorf("verify spans = %+v, want the second one failed", verify)
+	}
+}
+
+func TestCompileNatsPermissions_Inbox(t *testing.T) {
+	workers := func(inbox string) string {
+		return `[{"id": "workers", "account": "test-account", "name": "Workers", "inbox": "` + inbox + `",
+  "statements": [{"effect": "allow", "actions": ["nats.sub"], "resources": ["nats:jobs.>"]}]}]`
+	}
+
+	tests := []struct {
+		name        string
+		policyInbox string
+		accounts    map[string]string
+		want        string // "" for no inbox
+	}{
+		{name: "default", want: "_INBOX_alice.>"},
+		{name: "account", accounts: map[string]string{"test-account": "_INBOX.{{ user.id }}.>"}, want: "_INBOX.alice.>"},
+		{name: "all accounts disabled", accounts: map[string]string{"*": policy.InboxNone}},
+		{name: "policy", policyInbox: "_R_.{{ account.id }}.{{ user.id }}.>", accounts: map[string]string{"*": policy.InboxNone}, want: "_R_.test-account.alice.>"},
+		{name: "policy disabled", policyInbox: policy.InboxNone, accounts: map[string]string{"test-account": "_INBOX.{{ user.id }}.>"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cached, uncached, _ := newPermissionCacheTestController(t, workers(tt.policyInbox))
+			var results []*NautsCompilationResult
+			for _, ctrl := range []*AuthController{uncached, cached, cached} {
+				WithAccountInboxes(tt.accounts)(ctrl)
+				result, err := ctrl.CompileNatsPermissions(context.Background(), permissionCacheTestUser("alice"))
+				if err != nil {
+					t.Fatalf("CompileNatsPermissions() error = %v", err)
+				}
+				results = append(results, result)
+			}
+			var inboxes []string
+			for _, p := range results[0].Permissions.SubList() {
+				if p.Subject != "jobs.>" {
+					inboxes = append(inboxes, p.Subject)
+				}
+			}
+			if (tt.want == "" && len(inboxes) != 0) || (tt.want != "" && !slices.Equal(inboxes, []string{tt.want})) {
+				t.Errorf("inbox permissions = %v, want %q", inboxes, tt.want)
+			}
+			assertSameCompilation(t, results[2], results[0])
+		})
+	}
+
+	cached, _, _ := newPermissionCacheTestController(t, workers(""))
+	WithAccountInboxes(map[string]string{"*": "{{ user.attr.queue }}.>"})(cached)
+	result, err := cached.CompileNatsPermissions(context.Background(), &AccountScopedUser{
+		User:    identity.User{ID: "bob", Roles: []identity.Role{{Account: "test-account", Name: "workers"}}},
+		Account: "test-account",
+	})
+	if err != nil {
+		t.Fatalf("CompileNatsPermissions() error = %v", err)
+	}
+	if !slices.ContainsFunc(result.Warnings, func(w string) bool {
+		return strings.HasPrefix(w, "inbox skipped (unresolved variable: user.attr.queue")
+	}) {
+		t.Errorf("warnings = %q, want an inbox warning", result.Warnings)
+	}
+}
+
+func TestCompileNatsPermissions_DefaultBinding(t *testing.T) {
+	tmpDir := t.TempDir()
+	policiesFile := filepath.Join(tmpDir, "policies.json")
+	bindingsFile := filepath.Join(tmpDir, "bindings.json")
+	policies := `[
+  {"id": "status", "account": "test-account", "name": "Status", "statements": [{"effect": "allow", "actions": ["nats.sub"], "resources": ["nats:status.>"]}]},
+  {"id": "workers", "account": "test-account", "name": "Workers", "statements": [{"effect": "allow", "actions": ["nats.sub"], "resources": ["nats:jobs.>"]}]}
+]`
+	bindings := `[
+  {"role": "default", "account": "test-account", "policies": ["status"]},
+  {"role": "workers", "account": "test-account", "policies": ["workers"]}
+]`
+	if err := os.WriteFile(policiesFile, []byte(policies), 0644); err != nil {
+		t.Fatalf("writing policies file: %v", err)
+	}
+	if err := os.WriteFile(bindingsFile, []byte(bindings), 0644); err != nil {
+		t.Fatalf("writing bindings file: %v", err)
+	}
+	store, err := provider.NewFilePolicyProvider(provider.FilePolicyProviderConfig{PoliciesPath: policiesFile, BindingsPath: bindingsFile})
+	if err != nil {
+		t.Fatalf("creating policy provider: %v", err)
+	}
+	ctrl := NewAuthController(createTestAccountProvider(t, tmpDir), store, nil, WithLogger(&testLogger{}), WithAccountInboxes(map[string]string{"*": policy.InboxNone}))
+
+	tests := []struct {
+		name  string
+		roles []identity.Role
+		want  []string
+	}{
+		{name: "no roles", want: []string{"status.>"}},
+		{name: "workers", roles: []identity.Role{{Account: "test-account", Name: "workers"}}, want: []string{"jobs.>", "status.>"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ctrl.CompileNatsPermissions(context.Background(), &AccountScopedUser{
+				User:    identity.User{ID: "alice", Roles: tt.roles},
+				Account: "test-account",
+			})
+			if err != nil {
+				t.Fatalf("CompileNatsPermissions() error = %v", err)
+			}
+			var subjects []string
+			for _, p := range result.Permissions.SubList() {
+				subjects = append(subjects, p.Subject)
+			}
+			slices.Sort(subjects)
+			if !slices.Equal(subjects, tt.want) {
+				t.Errorf("subscribe permissions = %v, want %v", subjects, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileNatsPermissions_ClientInfo(t *testing.T) {
+	tmpDir := t.TempDir()
+	policiesFile := filepath.Join(tmpDir, "policies.json")
+	bindingsFile := filepath.Join(tmpDir, "bindings.json")
+	policies := `[
+  {"id": "apps", "account": "test-account", "name": "Apps", "statements": [
+    {"effect": "allow", "actions": ["nats.sub"], "resources": ["nats:apps.{{ client.name }}.>"]},
+    {"effect": "allow", "actions": ["nats.sub"], "resources": ["nats:debug.>"], "conditions": {"StringEquals": {"client.lang": "go"}}}
+  ]}
+]`
+	bindings := `[{"role": "default", "account": "test-account", "policies": ["apps"]}]`
+	if err := os.WriteFile(policiesFile, []byte(policies), 0644); err != nil {
+		t.Fatalf("writing policies file: %v", err)
+	}
+	if err := os.WriteFile(bindingsFile, []byte(bindings), 0644); err != nil {
+		t.Fatalf("writing bindings file: %v", err)
+	}
+	store, err := provider.NewFilePolicyProvider(provider.FilePolicyProviderConfig{PoliciesPath: policiesFile, BindingsPath: bindingsFile})
+	if err != nil {
+		t.Fatalf("creating policy provider: %v", err)
+	}
+	ctrl := NewAuthController(createTestAccountProvider(t, tmpDir), store, nil, WithLogger(&testLogger{}),
+		WithAccountInboxes(map[string]string{"*": policy.InboxNone}), WithPermissionCache(time.Minute))
+
+	tests := []struct {
+		name   string
+		client ClientInfo
+		want   []string
+	}{
+		{name: "go client", client: ClientInfo{Name: "billing", Lang: "go"}, want: []string{"apps.billing.>", "debug.>"}},
+		{name: "other client", client: ClientInfo{Name: "reports", Lang: "python3"}, want: []string{"apps.reports.>"}},
+		{name: "no client info"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := ContextWithClientInfo(context.Background(), tt.client)
+			result, err := ctrl.CompileNatsPermissions(ctx, &AccountScopedUser{
+				User:    identity.User{ID: "alice"},
+				Account: "test-account",
+			})
+			if err != nil {
+				t.Fatalf("CompileNatsPermissions() error = %v", err)
+			}
+			var subjects []string
+			for _, p := range result.Permissions.SubList() {
+				subjects = append(subjects, p.Subject)
+			}
+			slices.Sort(subjects)
+			if !slices.Equal(subjects, tt.want) {
+				t.Errorf("subscribe permissions = %v, want %v", subjects, tt.want)
+			}
+		})
+	}
+}
@@ -10,22 +10,31 @@ import (
 
 	"github.com/nats-io/nats.go"
 
+	"github.com/msimon/nauts/depstats"
 	"github.com/msimon/nauts/identity"
 )
 
 const (
 	// DebugSubject is the NATS subject for auth debug requests.
 	DebugSubject = "nauts.debug"
+
+	// DebugMetricsSubject is the NATS subject for controller metrics requests.
+	DebugMetricsSubject = "nauts.debug.metrics"
 )
 
 // DebugService handles NATS debug requests.
 type DebugService struct {
-	controller *AuthController
-	config     ServerConfig
+	controllers *controllerHolder
+	config      ServerConfig
+
+	nc         *nats.Conn
+	sub        *nats.Subscription
+	metricsSub *nats.Subscription
+	logger     Logger
 
-	nc     *nats.Conn
-	sub    *nats.Subscription
-	logger Logger
+	subscriptionStats func() []SubscriptionStats
+	rateLimitStats    func() []RateLimitStats
+	requestPoolStats  func() *RequestPoolStats
 
 	done   chan struct{}
 	wg     sync.WaitGroup
@@ -43,6 +52,30 @@ func WithDebugLogger(l Logger) DebugOption {
 	}
 }
 
+// WithSubscriptionStats adds the back-pressure counters returned by stats,
+// typically CalloutService.SubscriptionStats, to the metrics response.
+func WithSubscriptionStats(stats func() []SubscriptionStats) DebugOption {
+	return func(s *DebugService) {
+		s.subscriptionStats = stats
+	}
+}
+
+// WithRateLimitStats adds the throttled request counters returned by stats,
+// typically CalloutService.RateLimitStats, to the metrics response.
+func WithRateLimitStats(stats func() []RateLimitStats) DebugOption {
+	return func(s *DebugService) {
+		s.rateLimitStats = stats
+	}
+}
+
+// WithRequestPoolStats adds the worker pool counters returned by stats,
+// typically CalloutService.RequestPoolStats, to the metrics response.
+func WithRequestPoolStats(stats func() *RequestPoolStats) DebugOption {
+	return func(s *DebugService) {
+		s.requestPoolStats = stats
+	}
+}
+
 // NewDebugService creates a new DebugService.
 func NewDebugService(controller *AuthController, config ServerConfig, opts ...DebugOption) (*DebugService, error) {
 	if controller == nil {
@@ -65,10 +98,10 @@ func NewDebugService(controller *AuthController, config ServerConfig, opts ...De
 	}
 
 	s := &DebugService{
-		controller: controller,
-		config:     config,
-		logger:     &defaultLogger{},
-		done:       make(chan struct{}),
+		controllers: newControllerHolder(controller),
+		config:      config,
+		logger:      &defaultLogger{},
+		done:        make(chan struct{}),
 	}
 
 	for _, opt := range opts {
@@ -78,6 +111,13 @@ func NewDebugService(controller *AuthController, config ServerConfig, opts ...De
 	return s, nil
 }
 
+// SetController replaces the controller used for new requests. It blocks
+// until in-flight requests using the previous controller have completed and
+// returns the previous controller.
+func (s *DebugService) SetController(controller *AuthController) *AuthController {
+	return s.controllers.swap(controller)
+}
+
 // Start connects to NATS and begins handling debug requests.
 // This method blocks until Stop is called or the context is cancelled.
 func (s *DebugService) Start(ctx context.Context) error {
@@ -108,7 +148,14 @@ func (s *DebugService) Start(ctx context.Context) error {
 	}
 	s.sub = sub
 
-	s.logger.Info("auth debug service started, listening on %s", DebugSubject)
+	metricsSub, err := nc.Subscribe(DebugMetricsSubject, s.handleMetricsRequest)
+	if err != nil {
+		nc.Close()
+		return fmt.Errorf("subscribing to %s: %w", DebugMetricsSubject, err)
+	}
+	s.metricsSub = metricsSub
+
+	s.logger.Info("auth debug service started, listening on %s and %s", DebugSubject, DebugMetricsSubject)
 
 	select {
 	case <-ctx.Done():
@@ -135,8 +182,11 @@ func (s *DebugService) Stop() error {
 
 // shutdown performs graceful shutdown.
 func (s *DebugService) shutdown() error {
-	if s.sub != nil {
-		if err := s.sub.Drain(); err != nil {
+	for _, sub := range []*nats.Subscription{s.sub, s.metricsSub} {
+		if sub == nil {
+			continue
+		}
+		if err := sub.Drain(); err != nil {
 			s.logger.Warn("error draining subscription: %v", err)
 		}
 	}
@@ -159,12 +209,18 @@ type debugError struct {
 type debugRequest struct {
 	User    *identity.User `json:"user"`
 	Account string         `json:"account"`
+	// AP optionally names the authentication provider, as in an auth request.
+	AP string `json:"ap,omitempty"`
 }
 
 type debugResponse struct {
 	Request           *debugRequest           `json:"request"`
 	CompilationResult *NautsCompilationResult `json:"compilation_result"`
-	Error             *debugError             `json:"error"`
+	// ProviderSelection explains which authentication provider an auth request
+	// for the account would use. Selection errors do not fail the request.
+	ProviderSelection      *identity.ProviderSelection `json:"provider_selection,omitempty"`
+	ProviderSelectionError string                      `json:"provider_selection_error,omitempty"`
+	Error                  *debugError                 `json:"error"`
 }
 
 func (r *debugResponse) setError(code, message string) {
@@ -183,36 +239,113 @@ func (s *DebugService) handleRequest(msg *nats.Msg) {
 	s.wg.Add(1)
 	defer s.wg.Done()
 
-	ctx := context.Background()
+	controller, release := s.controllers.acquire()
+	defer release()
+
+	s.respondWithJSON(msg, debugPermissions(context.Background(), controller, msg.Data))
+}
+
+// debugPermissions compiles the permissions of the user in a JSON encoded
+// debugRequest, as served by the NATS debug subject and the HTTP listener.
+func debugPermissions(ctx context.Context, controller *AuthController, data []byte) debugResponse {
 	resp := debugResponse{}
 
-	// get debugRequest from msg.Data json
+	// get debugRequest from data json
 	var req debugRequest
-	if err := json.Unmarshal(msg.Data, &req); err != nil {
+	if err := json.Unmarshal(data, &req); err != nil {
 		resp.setError("invalid_request", fmt.Sprintf("failed to parse debug request: %v", err))
-		s.respondWithJSON(msg, resp)
-		return
+		return resp
 	}
 	resp.Request = &req
+	if req.User == nil {
+		resp.setError("invalid_request", "debug request has no user")
+		return resp
+	}
+
+	// explain provider selection
+	selection, err := controller.ExplainProviderSelection(identity.AuthRequest{Account: req.Account, AP: req.AP})
+	resp.ProviderSelection = selection
+	if err != nil {
+		resp.ProviderSelectionError = err.Error()
+	}
 
 	// scope user
-	scopedUser, err := s.controller.ScopeUserToAccount(ctx, req.User, req.Account)
+	scopedUser, err := controller.ScopeUserToAccount(ctx, req.User, req.Account)
 	if err != nil {
 		resp.setError("compile_error", fmt.Sprintf("failed to scope user %s to account %s: %v", req.User.ID, req.Account, err))
-		s.respondWithJSON(msg, resp)
-		return
+		return resp
 	}
 
 	// compile permissions
-	compileResult, err := s.controller.CompileNatsPermissions(ctx, scopedUser)
+	compileResult, err := controller.CompileNatsPermissions(ctx, scopedUser)
 	if err != nil {
 		resp.setError("compile_error", fmt.Sprintf("failed to compile permissions for user %s: %v", scopedUser.ID, err))
-		s.respondWithJSON(msg, resp)
-		return
+		return resp
 	}
 	resp.CompilationResult = compileResult
+	return resp
+}
+
+type debugMetricsResponse struct {
+	JWTSizes        []JWTSizeSeries        `json:"jwt_sizes"`
+	CircuitBreakers []CircuitBreakerStatus `json:"circuit_breakers"`
+	FaultInjection  []FaultInjectionStatus `json:"fault_injection,omitempty"`
+	PolicyCanary    *PolicyCanaryStatus    `json:"policy_canary,omitempty"`
+	Accounts        []AccountStatsSnapshot `json:"accounts"`
+	Subscriptions   []SubscriptionStats    `json:"subscriptions"`
+	RateLimits      []RateLimitStats       `json:"rate_limits,omitempty"`
+	RequestPool     *RequestPoolStats      `json:"request_pool,omitempty"`
+	Dependencies    []depstats.Stats       `json:"dependencies"`
+}
+
+// handleMetricsRequest responds with a snapshot of the controller metrics.
+func (s *DebugService) handleMetricsRequest(msg *nats.Msg) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	controller, release := s.controllers.acquire()
+	defer release()
+
+	data, err := json.Marshal(collectMetrics(controller, s.subscriptionStats, s.rateLimitStats, s.requestPoolStats))
+	if err != nil {
+		s.logger.Warn("failed to encode metrics response: %v", err)
+		return
+	}
+	if err := msg.Respond(data); err != nil {
+		s.logger.Warn("failed to send metrics response: %v", err)
+	}
+}
 
-	s.respondWithJSON(msg, resp)
+// collectMetrics takes a snapshot of the controller metrics and, if set, of
+// the callout subscription, rate limit, and worker pool counters.
+func collectMetrics(controller *AuthController, subscriptionStats func() []SubscriptionStats, rateLimitStats func() []RateLimitStats, requestPoolStats func() *RequestPoolStats) debugMetricsResponse {
+	resp := debugMetricsResponse{
+		JWTSizes:        []JWTSizeSeries{},
+		CircuitBreakers: controller.CircuitBreakers(),
+		FaultInjection:  controller.FaultInjection(),
+		PolicyCanary:    controller.PolicyCanary(),
+		Accounts:        []AccountStatsSnapshot{},
+		Subscriptions:   []SubscriptionStats{},
+		Dependencies:    depstats.Snapshot(),
+	}
+	if m := controller.JWTSizeMetrics(); m != nil {
+		resp.JWTSizes = m.Snapshot()
+	}
+	if a := controller.AccountStats(); a != nil {
+		resp.Accounts = a.Snapshot()
+	}
+	if subscriptionStats != nil {
+		if stats := subscriptionStats(); stats != nil {
+			resp.Subscriptions = stats
+		}
+	}
+	if rateLimitStats != nil {
+		resp.RateLimits = rateLimitStats()
+	}
+	if requestPoolStats != nil {
+		resp.RequestPool = requestPoolStats()
+	}
+	return resp
 }
 
 func (s *DebugService) respondWithJSON(msg *nats.Msg, resp debugResponse) {
@@ -0,0 +1,319 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nats-io/nkeys"
+
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/policy"
+	"github.com/msimon/nauts/provider"
+)
+
+// Files of a development environment, relative to its directory.
+const (
+	DevConfigFile       = "nauts.json"
+	DevServerConfigFile = "nats-server.conf"
+)
+
+// DevAccount is the account the sample users of a development environment log in to.
+const DevAccount = "APP"
+
+// DevPassword is the password of every sample user of a development environment.
+const DevPassword = "secret"
+
+// DevEnvironmentConfig configures GenerateDevEnvironment.
+type DevEnvironmentConfig struct {
+	// Dir is the directory the environment is written to. Existing keys,
+	// users, policies, bindings, and the nauts configuration are kept, so
+	// edits survive restarts; the nats-server configuration is rewritten.
+	Dir string
+
+	// Port is the NATS client port (default: 4222).
+	Port int
+
+	// JetStream enables JetStream, stored in <Dir>/jetstream.
+	JetStream bool
+}
+
+// DevUser is a sample user of a development environment.
+type DevUser struct {
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	Account  string   `json:"account"`
+	Roles    []string `json:"roles"`
+}
+
+// DevEnvironment describes a generated development environment.
+type DevEnvironment struct {
+	// Dir is the absolute directory of the environment.
+	Dir string `json:"dir"`
+
+	// ConfigPath is the nauts configuration file.
+	ConfigPath string `json:"configPath"`
+
+	// ServerConfigPath is the nats-server configuration file, with the auth
+	// callout pre-wired to nauts.
+	ServerConfigPath string `json:"serverConfigPath"`
+
+	// NatsURL is the client URL of the NATS server.
+	NatsURL string `json:"natsUrl"`
+
+	// Users are the sample users (only those generated by this call, an
+	// existing users file is not read back).
+	Users []DevUser `json:"users"`
+}
+
+// devUsers are the sample users of a development environment.
+var devUsers = []DevUser{
+	{Username: "alice", Password: DevPassword, Account: DevAccount, Roles: []string{DevAccount + ".developer"}},
+	{Username: "bob", Password: DevPassword, Account: DevAccount, Roles: []string{DevAccount + ".viewer"}},
+}
+
+// devPolicies are the sample policies of a development environment.
+var devPolicies = []*policy.Policy{
+	{
+		ID:      "app-developer",
+		Account: DevAccount,
+		Name:    "Read and write application subjects, manage streams and buckets",
+		Statements: []policy.Statement{
+			{Effect: policy.EffectAllow, Actions: []policy.Action{"nats.*"}, Resources: []string{"nats:app.>"}},
+			{Effect: policy.EffectAllow, Actions: []policy.Action{"js.manage"}, Resources: []string{"js:*"}},
+			{Effect: policy.EffectAllow, Actions: []policy.Action{"kv.manage"}, Resources: []string{"kv:*"}},
+		},
+	},
+	{
+		ID:      "app-viewer",
+		Account: DevAccount,
+		Name:    "Subscribe to application subjects, view streams",
+		Statements: []policy.Statement{
+			{Effect: policy.EffectAllow, Actions: []policy.Action{"nats.sub"}, Resources: []string{"nats:app.>"}},
+			{Effect: policy.EffectAllow, Actions: []policy.Action{"js.view"}, Resources: []string{"js:*"}},
+		},
+	},
+}
+
+// devBindings are the sample role bindings of a development environment.
+var devBindings = []*provider.Binding{
+	{Role: "developer", Account: DevAccount, Policies: []string{"app-developer", "builtin:user-subjects"}},
+	{Role: "viewer", Account: DevAccount, Policies: []string{"app-viewer", "builtin:user-subjects"}},
+}
+
+// GenerateDevEnvironment writes a self-contained nauts setup for local
+// development: static account keys, an auth callout service user, an xkey,
+// sample users, policies, and bindings, a nauts configuration, and a
+// nats-server configuration that delegates authentication to nauts.
+// It is not meant for production: the sample users share a well-known password.
+func GenerateDevEnvironment(cfg DevEnvironmentConfig) (*DevEnvironment, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("dev environment directory is required")
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 4222
+	}
+	if cfg.Port < 0 || cfg.Port > 65535 {
+		return nil, fmt.Errorf("invalid port %d", cfg.Port)
+	}
+	dir, err := filepath.Abs(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("resolving dev environment directory: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("creating dev environment directory: %w", err)
+	}
+
+	env := &DevEnvironment{
+		Dir:              dir,
+		ConfigPath:       filepath.Join(dir, DevConfigFile),
+		ServerConfigPath: filepath.Join(dir, DevServerConfigFile),
+		NatsURL:          fmt.Sprintf("nats://127.0.0.1:%d", cfg.Port),
+	}
+
+	accountKey, err := devSeed(filepath.Join(dir, "account.nk"), nkeys.CreateAccount)
+	if err != nil {
+		return nil, err
+	}
+	serviceKey, err := devSeed(filepath.Join(dir, "auth-service.nk"), nkeys.CreateUser)
+	if err != nil {
+		return nil, err
+	}
+	xkey, err := devSeed(filepath.Join(dir, "xkey.nk"), nkeys.CreateCurveKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeDevJSON(filepath.Join(dir, "policies.json"), devPolicies); err != nil {
+		return nil, err
+	}
+	if err := writeDevJSON(filepath.Join(dir, "bindings.json"), devBindings); err != nil {
+		return nil, err
+	}
+	usersPath := filepath.Join(dir, "users.json")
+	if _, err := os.Stat(usersPath); errors.Is(err, os.ErrNotExist) {
+		users, err := devUsersFile()
+		if err != nil {
+			return nil, err
+		}
+		if err := writeDevJSON(usersPath, users); err != nil {
+			return nil, err
+		}
+		env.Users = append([]DevUser(nil), devUsers...)
+	}
+
+	config := &Config{
+		Account: AccountConfig{
+			Type: "static",
+			Static: &provider.StaticAccountProviderConfig{
+				PublicKey:      accountKey,
+				PrivateKeyPath: filepath.Join(dir, "account.nk"),
+				Accounts:       []string{"AUTH", DevAccount},
+			},
+		},
+		Policy: PolicyConfig{
+			Type: "file",
+			File: &provider.FilePolicyProviderConfig{
+				PoliciesPath: filepath.Join(dir, "policies.json"),
+				BindingsPath: filepath.Join(dir, "bindings.json"),
+			},
+		},
+		Auth: AuthConfig{
+			File: []FileAuthProviderConfig{
+				{ID: "dev", Accounts: []string{DevAccount}, UsersPath: usersPath},
+			},
+		},
+		Server: ServerConfig{
+			NatsURL:      env.NatsURL,
+			NatsNkey:     filepath.Join(dir, "auth-service.nk"),
+			XKeySeedFile: filepath.Join(dir, "xkey.nk"),
+			TTL:          "1h",
+			ErrorDetail:  true,
+		},
+	}
+	if err := writeDevJSON(env.ConfigPath, config); err != nil {
+		return nil, err
+	}
+
+	serverConfig := devServerConfig(cfg, dir, accountKey, serviceKey, xkey)
+	if err := writeDevFile(env.ServerConfigPath, []byte(serverConfig)); err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// devSeed returns the public key of the seed stored at path, creating the
+// seed with create if the file does not exist.
+func devSeed(path string, create func() (nkeys.KeyPair, error)) (string, error) {
+	seed, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		kp, err := create()
+		if err != nil {
+			return "", fmt.Errorf("creating key %s: %w", filepath.Base(path), err)
+		}
+		if seed, err = kp.Seed(); err != nil {
+			return "", fmt.Errorf("creating key %s: %w", filepath.Base(path), err)
+		}
+		if err := writeDevFile(path, append(seed, '\n')); err != nil {
+			return "", err
+		}
+	} else if err != nil {
+		return "", fmt.Errorf("reading key %s: %w", filepath.Base(path), err)
+	}
+
+	kp, err := nkeys.FromSeed([]byte(strings.TrimSpace(string(seed))))
+	if err != nil {
+		return "", fmt.Errorf("parsing key %s: %w", filepath.Base(path), err)
+	}
+	return kp.PublicKey()
+}
+
+// devUsersFile returns the users file contents for the sample users.
+func devUsersFile() (any, error) {
+	hasher, err := identity.NewPasswordHasher(identity.PasswordHashingConfig{})
+	if err != nil {
+		return nil, err
+	}
+	type fileUser struct {
+		Accounts     []string `json:"accounts"`
+		Roles        []string `json:"roles"`
+		PasswordHash string   `json:"passwordHash"`
+	}
+	users := make(map[string]fileUser, len(devUsers))
+	for _, u := range devUsers {
+		hash, err := hasher.Hash(u.Password)
+		if err != nil {
+			return nil, fmt.Errorf("hashing password of %s: %w", u.Username, err)
+		}
+		users[u.Username] = fileUser{Accounts: []string{u.Account}, Roles: u.Roles, PasswordHash: hash}
+	}
+	return map[string]any{"users": users}, nil
+}
+
+// devServerConfig renders the nats-server configuration: the AUTH account
+// hosts the callout service, APP is managed by nauts.
+func devServerConfig(cfg DevEnvironmentConfig, dir, issuer, serviceUser, xkey string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated by 'nauts dev'. Not for production use.\n")
+	fmt.Fprintf(&b, "server_name: nauts-dev\n")
+	fmt.Fprintf(&b, "listen: 127.0.0.1:%d\n", cfg.Port)
+	if cfg.JetStream {
+		fmt.Fprintf(&b, "\njetstream {\n  store_dir: %q\n}\n", filepath.Join(dir, "jetstream"))
+	}
+	fmt.Fprintf(&b, `
+accounts {
+  AUTH {
+    users: [
+      { nkey: %s }
+    ]
+  }
+  %s {
+    jetstream: %s
+  }
+  SYS {}
+}
+
+system_account: SYS
+
+authorization {
+  auth_callout {
+    issuer: %s
+    users: [ %s ]
+    account: AUTH
+    xkey: %s
+  }
+}
+`, serviceUser, DevAccount, devEnabled(cfg.JetStream), issuer, serviceUser, xkey)
+	return b.String()
+}
+
+func devEnabled(enabled bool) string {
+	if enabled {
+		return "enabled"
+	}
+	return "disabled"
+}
+
+// writeDevJSON writes v as indented JSON to path unless the file exists.
+func writeDevJSON(path string, v any) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding %s: %w", filepath.Base(path), err)
+	}
+	return writeDevFile(path, append(data, '\n'))
+}
+
+// writeDevFile writes data to path, readable only by the owner.
+func writeDevFile(path string, data []byte) error {
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("writing %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+
+	"github.com/msimon/nauts/policy"
+)
+
+func TestGenerateDevEnvironment(t *testing.T) {
+	env, err := GenerateDevEnvironment(DevEnvironmentConfig{Dir: t.TempDir(), Port: 14222, JetStream: true})
+	if err != nil {
+		t.Fatalf("GenerateDevEnvironment() error = %v", err)
+	}
+	if env.NatsURL != "nats://127.0.0.1:14222" {
+		t.Errorf("NatsURL = %q", env.NatsURL)
+	}
+	if len(env.Users) != 2 {
+		t.Fatalf("Users = %v, want 2 sample users", env.Users)
+	}
+
+	serverConfig, err := os.ReadFile(env.ServerConfigPath)
+	if err != nil {
+		t.Fatalf("reading server config: %v", err)
+	}
+	for _, want := range []string{"listen: 127.0.0.1:14222", "auth_callout", "jetstream: enabled"} {
+		if !strings.Contains(string(serverConfig), want) {
+			t.Errorf("server config does not contain %q:\n%s", want, serverConfig)
+		}
+	}
+
+	config, err := LoadConfig(env.ConfigPath)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	ctrl, err := NewAuthControllerWithConfig(config)
+	if err != nil {
+		t.Fatalf("NewAuthControllerWithConfig() error = %v", err)
+	}
+
+	tests := []struct {
+		user       string
+		canPublish bool
+	}{
+		{user: "alice", canPublish: true},
+		{user: "bob", canPublish: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.user, func(t *testing.T) {
+			result, err := ctrl.Authenticate(context.Background(), natsjwt.ConnectOptions{
+				Token: `{"account":"APP","token":"` + tt.user + `:` + DevPassword + `"}`,
+			}, "", time.Hour)
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			perms := result.CompilationResult.Permissions
+			if !hasSubject(perms.SubList(), "app.>") {
+				t.Errorf("%s cannot subscribe to app.>", tt.user)
+			}
+			if got := hasSubject(perms.PubList(), "app.>"); got != tt.canPublish {
+				t.Errorf("%s can publish to app.> = %v, want %v", tt.user, got, tt.canPublish)
+			}
+		})
+	}
+}
+
+func hasSubject(perms []policy.Permission, subject string) bool {
+	for _, p := range perms {
+		if p.Subject == subject {
+			return true
+		}
+	}
+	return false
+}
+
+func TestGenerateDevEnvironment_KeepsExistingFiles(t *testing.T) {
+	dir := t.TempDir()
+	first, err := GenerateDevEnvironment(DevEnvironmentConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("GenerateDevEnvironment() error = %v", err)
+	}
+	policiesPath := filepath.Join(dir, "policies.json")
+	if err := os.WriteFile(policiesPath, []byte("[]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	seed, err := os.ReadFile(filepath.Join(dir, "account.nk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := GenerateDevEnvironment(DevEnvironmentConfig{Dir: dir, Port: 4333})
+	if err != nil {
+		t.Fatalf("GenerateDevEnvironment() error = %v", err)
+	}
+	if len(first.Users) == 0 || len(second.Users) != 0 {
+		t.Errorf("Users = %d then %d, want sample users only on the first run", len(first.Users), len(second.Users))
+	}
+	if data, _ := os.ReadFile(policiesPath); string(data) != "[]\n" {
+		t.Errorf("edited policies were overwritten: %s", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "account.nk")); string(data) != string(seed) {
+		t.Error("account key was regenerated")
+	}
+	if data, _ := os.ReadFile(second.ServerConfigPath); !strings.Contains(string(data), "listen: 127.0.0.1:4333") {
+		t.Errorf("server config was not rewritten for the new port:\n%s", data)
+	}
+}
+
+func TestGenerateDevEnvironment_Invalid(t *testing.T) {
+	if _, err := GenerateDevEnvironment(DevEnvironmentConfig{}); err == nil {
+		t.Error("expected error for missing directory")
+	}
+	if _, err := GenerateDevEnvironment(DevEnvironmentConfig{Dir: t.TempDir(), Port: 70000}); err == nil {
+		t.Error("expected error for invalid port")
+	}
+}
@@ -1,6 +1,15 @@
 package auth
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nkeys"
+)
+
+// ErrInvalidUserPublicKey is returned when the subject key of a user JWT is
+// not a valid user nkey.
+var ErrInvalidUserPublicKey = errors.New("invalid user public key")
 
 // AuthError represents an error during authentication or permission compilation.
 type AuthError struct {
@@ -30,3 +39,66 @@ func NewAuthError(userID, phase, message string, err error) *AuthError {
 		Err:     err,
 	}
 }
+
+// PhaseError is returned by AuthController.Authenticate. It records the step
+// of the authentication flow that failed (see AuditEvent.Phase) and, for steps
+// backed by a provider, which one. Error returns the message of the wrapped
+// error unchanged.
+type PhaseError struct {
+	Phase string
+	// Provider names the failed backend, e.g. "auth provider local",
+	// "policy provider", or "account provider"; empty for other steps.
+	Provider string
+	Err      error
+}
+
+func (e *PhaseError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PhaseError) Unwrap() error {
+	return e.Err
+}
+
+// Detail describes the failure for clients of a development setup, e.g.
+// "policy provider: nats: bucket not found". It is not meant for production
+// responses, as it may reveal internal details.
+func (e *PhaseError) Detail() string {
+	msg := e.Err.Error()
+	var authErr *AuthError
+	if errors.As(e.Err, &authErr) {
+		msg = authErr.Message
+		if authErr.Err != nil && authErr.Err.Error() != authErr.Message {
+			msg += ": " + authErr.Err.Error()
+		}
+	}
+	if e.Provider != "" {
+		return e.Provider + ": " + msg
+	}
+	return e.Phase + ": " + msg
+}
+
+// phaseProvider returns the backend used by an authentication phase.
+func phaseProvider(phase, authProvider string) string {
+	switch phase {
+	case "verify":
+		return "auth provider " + authProvider
+	case "compile":
+		return "policy provider"
+	case "create_jwt":
+		return "account provider"
+	}
+	return ""
+}
+
+// validateUserPublicKey checks that key is a public user nkey (prefix U).
+// The NATS server silently rejects user JWTs with any other subject.
+func validateUserPublicKey(key string) error {
+	if nkeys.IsValidPublicUserKey(key) {
+		return nil
+	}
+	if nkeys.IsValidPublicKey(key) {
+		return fmt.Errorf("%w: expected a user key (prefix U), got %s key", ErrInvalidUserPublicKey, nkeys.Prefix(key))
+	}
+	return fmt.Errorf("%w: %q is not a valid nkey", ErrInvalidUserPublicKey, key)
+}
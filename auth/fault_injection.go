@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/policy"
+	"github.com/msimon/nauts/provider"
+)
+
+// FaultInjectionEnv must be set to a true value (e.g., "1") for
+// server.faultInjection to take effect, so that a staging configuration
+// copied to production does not inject faults.
+const FaultInjectionEnv = "NAUTS_FAULT_INJECTION"
+
+// Fault injection targets.
+const (
+	// FaultTargetAuth targets the Verify calls of every authentication provider.
+	FaultTargetAuth = "auth"
+	// FaultTargetPolicy targets the policy provider lookups.
+	FaultTargetPolicy = "policy"
+	// FaultTargetNats targets the callout responses sent to the NATS server.
+	FaultTargetNats = "nats"
+)
+
+// ErrInjectedFault is returned by calls failed by a FaultInjector.
+var ErrInjectedFault = errors.New("injected fault")
+
+// FaultInjectionEnabled reports whether FaultInjectionEnv allows fault injection.
+func FaultInjectionEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv(FaultInjectionEnv))
+	return enabled
+}
+
+// FaultInjector delays and fails a percentage of calls, to validate timeouts,
+// retries, and circuit breakers before incidents happen. Delays are applied
+// before failures, so a call can be both delayed and failed. It is safe for
+// concurrent use.
+type FaultInjector struct {
+	name         string
+	delay        time.Duration
+	delayPercent float64
+	errorPercent float64
+	rand         func() float64 // in [0, 100)
+
+	mu     sync.Mutex
+	calls  uint64
+	delays uint64
+	errors uint64
+}
+
+// FaultInjectionStatus is a snapshot of a fault injector's counters.
+type FaultInjectionStatus struct {
+	Name   string `json:"name"`
+	Calls  uint64 `json:"calls"`
+	Delays uint64 `json:"delays"`
+	Errors uint64 `json:"errors"`
+}
+
+// NewFaultInjector creates a fault injector that delays delayPercent of the
+// calls by delay and fails errorPercent of them. Percentages are clamped to
+// [0, 100].
+func NewFaultInjector(name string, delay time.Duration, delayPercent, errorPercent float64) *FaultInjector {
+	return &FaultInjector{
+		name:         name,
+		delay:        delay,
+		delayPercent: min(max(delayPercent, 0), 100),
+		errorPercent: min(max(errorPercent, 0), 100),
+		rand:         func() float64 { return rand.Float64() * 100 },
+	}
+}
+
+// Name returns the name of the injector.
+func (f *FaultInjector) Name() string {
+	return f.name
+}
+
+// Status returns a snapshot of the injector's counters.
+func (f *FaultInjector) Status() FaultInjectionStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return FaultInjectionStatus{Name: f.name, Calls: f.calls, Delays: f.delays, Errors: f.errors}
+}
+
+// inject decides the faults for one call, sleeps for an injected delay, and
+// returns an error wrapping ErrInjectedFault for an injected failure. A
+// cancelled ctx ends the delay early with ctx.Err().
+func (f *FaultInjector) inject(ctx context.Context) error {
+	f.mu.Lock()
+	f.calls++
+	delayed := f.delay > 0 && f.rand() < f.delayPercent
+	failed := f.rand() < f.errorPercent
+	if delayed {
+		f.delays++
+	}
+	if failed {
+		f.errors++
+	}
+	f.mu.Unlock()
+
+	if delayed {
+		timer := time.NewTimer(f.delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	if failed {
+		return fmt.Errorf("%w: %s", ErrInjectedFault, f.name)
+	}
+	return nil
+}
+
+// faultInjectingAuthProvider injects faults into an AuthenticationProvider.
+type faultInjectingAuthProvider struct {
+	identity.AuthenticationProvider
+	faults *FaultInjector
+}
+
+// NewFaultInjectingAuthProvider wraps p so that faults are injected before
+// Verify. Injected failures also wrap identity.ErrProviderUnavailable, so
+// they are handled like an unreachable backend.
+func NewFaultInjectingAuthProvider(p identity.AuthenticationProvider, faults *FaultInjector) identity.AuthenticationProvider {
+	return &faultInjectingAuthProvider{AuthenticationProvider: p, faults: faults}
+}
+
+func (p *faultInjectingAuthProvider) Verify(ctx context.Context, req identity.AuthRequest) (*identity.User, error) {
+	if err := p.faults.inject(ctx); err != nil {
+		return nil, fmt.Errorf("%w: %w", identity.ErrProviderUnavailable, err)
+	}
+	return p.AuthenticationProvider.Verify(ctx, req)
+}
+
+// Stop stops the wrapped provider if it holds resources.
+func (p *faultInjectingAuthProvider) Stop() error {
+	if s, ok := p.AuthenticationProvider.(interface{ Stop() error }); ok {
+		return s.Stop()
+	}
+	return nil
+}
+
+// faultInjectingPolicyProvider injects faults into a PolicyProvider.
+type faultInjectingPolicyProvider struct {
+	inner  provider.PolicyProvider
+	faults *FaultInjector
+}
+
+// NewFaultInjectingPolicyProvider wraps p so that faults are injected before
+// each lookup. Bindings and Stop are forwarded if p supports them.
+func NewFaultInjectingPolicyProvider(p provider.PolicyProvider, faults *FaultInjector) provider.PolicyProvider {
+	return &faultInjectingPolicyProvider{inner: p, faults: faults}
+}
+
+func (p *faultInjectingPolicyProvider) GetPolicy(ctx context.Context, account string, id string) (*policy.Policy, error) {
+	if err := p.faults.inject(ctx); err != nil {
+		return nil, err
+	}
+	return p.inner.GetPolicy(ctx, account, id)
+}
+
+func (p *faultInjectingPolicyProvider) GetPoliciesForRole(ctx context.Context, role identity.Role) ([]*policy.Policy, error) {
+	if err := p.faults.inject(ctx); err != nil {
+		return nil, err
+	}
+	return p.inner.GetPoliciesForRole(ctx, role)
+}
+
+func (p *faultInjectingPolicyProvider) GetPolicies(ctx context.Context, account string) ([]*policy.Policy, error) {
+	if err := p.faults.inject(ctx); err != nil {
+		return nil, err
+	}
+	return p.inner.GetPolicies(ctx, account)
+}
+
+// GetBinding implements provider.BindingProvider. It returns
+// provider.ErrRoleNotFound if the wrapped provider has no bindings.
+func (p *faultInjectingPolicyProvider) GetBinding(ctx context.Context, role identity.Role) (*provider.Binding, error) {
+	bp, ok := p.inner.(provider.BindingProvider)
+	if !ok {
+		return nil, provider.ErrRoleNotFound
+	}
+	if err := p.faults.inject(ctx); err != nil {
+		return nil, err
+	}
+	return bp.GetBinding(ctx, role)
+}
+
+// Unwrap returns the wrapped provider.
+func (p *faultInjectingPolicyProvider) Unwrap() provider.PolicyProvider {
+	return p.inner
+}
+
+// Stop stops the wrapped provider if it holds resources.
+func (p *faultInjectingPolicyProvider) Stop() error {
+	if s, ok := p.inner.(interface{ Stop() error }); ok {
+		return s.Stop()
+	}
+	return nil
+}
+
+// faultInjectionStatuses returns the status of injectors, sorted by name.
+func faultInjectionStatuses(injectors []*FaultInjector) []FaultInjectionStatus {
+	statuses := make([]FaultInjectionStatus, 0, len(injectors))
+	for _, f := range injectors {
+		statuses = append(statuses, f.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/provider"
+)
+
+// sequence returns a rand function cycling through values.
+func sequence(values ...float64) func() float64 {
+	i := 0
+	return func() float64 {
+		v := values[i%len(values)]
+		i++
+		return v
+	}
+}
+
+func TestFaultInjector(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("errors", func(t *testing.T) {
+		f := NewFaultInjector("test", 0, 0, 50)
+		f.rand = sequence(10, 90)
+		if err := f.inject(ctx); !errors.Is(err, ErrInjectedFault) {
+			t.Errorf("inject() error = %v, want ErrInjectedFault", err)
+		}
+		if err := f.inject(ctx); err != nil {
+			t.Errorf("inject() error = %v, want nil", err)
+		}
+		if got := f.Status(); got.Calls != 2 || got.Errors != 1 || got.Delays != 0 {
+			t.Errorf("Status() = %+v", got)
+		}
+	})
+
+	t.Run("delay", func(t *testing.T) {
+		f := NewFaultInjector("test", 20*time.Millisecond, 100, 0)
+		start := time.Now()
+		if err := f.inject(ctx); err != nil {
+			t.Fatalf("inject() error = %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+			t.Errorf("inject() returned after %v, want at least 20ms", elapsed)
+		}
+		if got := f.Status(); got.Delays != 1 {
+			t.Errorf("Status() = %+v, want 1 delay", got)
+		}
+	})
+
+	t.Run("delay ends with context", func(t *testing.T) {
+		f := NewFaultInjector("test", time.Hour, 100, 0)
+		cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		if err := f.inject(cctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("inject() error = %v, want DeadlineExceeded", err)
+		}
+	})
+
+	t.Run("percentages are clamped", func(t *testing.T) {
+		f := NewFaultInjector("test", 0, -5, 200)
+		for i := 0; i < 10; i++ {
+			if err := f.inject(ctx); !errors.Is(err, ErrInjectedFault) {
+				t.Fatalf("inject() error = %v, want ErrInjectedFault", err)
+			}
+		}
+	})
+}
+
+func TestFaultInjectingAuthProvider_OpensCircuitBreaker(t *testing.T) {
+	inner := &stubAuthProvider{}
+	b := NewCircuitBreaker("auth:test", 2, time.Minute)
+	p := NewCircuitBreakingAuthProvider(NewFaultInjectingAuthProvider(inner, NewFaultInjector("auth:test", 0, 0, 100)), b)
+
+	_, err := p.Verify(context.Background(), identity.AuthRequest{})
+	if !errors.Is(err, ErrInjectedFault) || !errors.Is(err, identity.ErrProviderUnavailable) {
+		t.Fatalf("Verify() error = %v, want ErrInjectedFault and ErrProviderUnavailable", err)
+	}
+	_, _ = p.Verify(context.Background(), identity.AuthRequest{})
+	if got := b.Status().State; got != CircuitOpen {
+		t.Errorf("state = %s, want %s", got, CircuitOpen)
+	}
+	if inner.calls != 0 {
+		t.Errorf("provider calls = %d, want 0", inner.calls)
+	}
+}
+
+func TestFaultInjectingPolicyProvider(t *testing.T) {
+	ctx := context.Background()
+	role := identity.Role{Account: "APP", Name: "admin"}
+	f := NewFaultInjector("policy", 0, 0, 0)
+	p := NewFaultInjectingPolicyProvider(&stubPolicyProvider{err: provider.ErrRoleNotFound}, f)
+
+	if _, err := p.GetPoliciesForRole(ctx, role); !errors.Is(err, provider.ErrRoleNotFound) {
+		t.Errorf("GetPoliciesForRole() error = %v, want the provider's error", err)
+	}
+	f.errorPercent = 100
+	if _, err := p.GetPolicy(ctx, "APP", "p1"); !errors.Is(err, ErrInjectedFault) {
+		t.Errorf("GetPolicy() error = %v, want ErrInjectedFault", err)
+	}
+	if _, err := p.(provider.BindingProvider).GetBinding(ctx, role); !errors.Is(err, provider.ErrRoleNotFound) {
+		t.Errorf("GetBinding() error = %v, want ErrRoleNotFound", err)
+	}
+}
+
+func TestFaultInjectionConfig_EnvGuard(t *testing.T) {
+	config := &Config{Server: ServerConfig{FaultInjection: &FaultInjectionConfig{Targets: []string{"nats", "auth"}, ErrorPercent: 10}}}
+
+	t.Setenv(FaultInjectionEnv, "")
+	if got := config.Summary().FaultInjection; got != nil {
+		t.Errorf("without %s: FaultInjection = %v, want none", FaultInjectionEnv, got)
+	}
+
+	t.Setenv(FaultInjectionEnv, "1")
+	if got := config.Summary().FaultInjection; !slices.Equal(got, []string{"auth", "nats"}) {
+		t.Errorf("FaultInjection = %v, want [auth nats]", got)
+	}
+}
@@ -0,0 +1,289 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nats-io/nkeys"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/policy"
+	"github.com/msimon/nauts/provider"
+)
+
+// FixturePassword is the password of every user of generated fixtures.
+const FixturePassword = "secret"
+
+// FixtureConfig configures GenerateFixtures.
+type FixtureConfig struct {
+	// Dir is the directory the fixtures are written to. Existing fixture
+	// files are overwritten; an existing account key is kept.
+	Dir string
+
+	// Accounts is the number of accounts (default: 10).
+	Accounts int
+
+	// Roles is the number of roles per account (default: 10).
+	Roles int
+
+	// Statements is the number of statements per policy (default: 5).
+	Statements int
+
+	// Users is the number of users per account (default: 10).
+	Users int
+
+	// Seed makes the generated policies, bindings, and users reproducible.
+	Seed uint64
+}
+
+// Fixtures describes generated fixtures.
+type Fixtures struct {
+	// Dir is the absolute directory of the fixtures.
+	Dir string `json:"dir"`
+
+	// ConfigPath is a nauts configuration using the fixtures with a static
+	// account provider and a file auth provider.
+	ConfigPath string `json:"configPath"`
+
+	Accounts   []string `json:"accounts"`
+	Policies   int      `json:"policies"`
+	Bindings   int      `json:"bindings"`
+	Statements int      `json:"statements"`
+	Users      int      `json:"users"`
+}
+
+// fixtureDomains are the business domains subjects, streams, and buckets of
+// generated policies are named after.
+var fixtureDomains = []string{
+	"orders", "payments", "inventory", "shipping", "billing", "catalog",
+	"customers", "analytics", "notifications", "search", "pricing", "fraud",
+}
+
+// fixtureEntities are the entities within a domain.
+var fixtureEntities = []string{"created", "updated", "deleted", "status", "metrics", "audit", "commands", "events"}
+
+// GenerateFixtures writes a large, realistic set of policies, bindings, and
+// users to cfg.Dir, with a nauts configuration serving them, for benchmarks
+// and for validating a deployment at target scale. Every account has one
+// policy per role plus a common policy; each role is bound to its policy, the
+// common policy, and builtin:user-subjects. Statements mix NATS, JetStream,
+// KV, and object store resources, user-scoped subjects, queue groups, and
+// denials. Users hold one to three roles of one account and share
+// FixturePassword.
+func GenerateFixtures(cfg FixtureConfig) (*Fixtures, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("fixture directory is required")
+	}
+	for _, n := range []struct {
+		name  string
+		value *int
+		def   int
+	}{
+		{"accounts", &cfg.Accounts, 10},
+		{"roles", &cfg.Roles, 10},
+		{"statements", &cfg.Statements, 5},
+		{"users", &cfg.Users, 10},
+	} {
+		if *n.value == 0 {
+			*n.value = n.def
+		}
+		if *n.value < 0 {
+			return nil, fmt.Errorf("invalid number of %s %d", n.name, *n.value)
+		}
+	}
+	dir, err := filepath.Abs(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("resolving fixture directory: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("creating fixture directory: %w", err)
+	}
+
+	rng := rand.New(rand.NewPCG(cfg.Seed, 0x6e61757473))
+	fixtures := &Fixtures{Dir: dir, ConfigPath: filepath.Join(dir, DevConfigFile)}
+
+	var policies []*policy.Policy
+	var bindings []*provider.Binding
+	for a := range cfg.Accounts {
+		account := fmt.Sprintf("ACC%03d", a+1)
+		fixtures.Accounts = append(fixtures.Accounts, account)
+
+		common := &policy.Policy{
+			ID:      strings.ToLower(account) + "-common",
+			Account: account,
+			Name:    "Common subjects of " + account,
+			Statements: []policy.Statement{
+				{Effect: policy.EffectAllow, Actions: []policy.Action{policy.ActionNATSSub}, Resources: []string{"nats:" + strings.ToLower(account) + ".broadcast.>"}},
+				{Effect: policy.EffectAllow, Actions: []policy.Action{policy.ActionKVRead}, Resources: []string{"kv:config"}},
+			},
+		}
+		policies = append(policies, common)
+
+		for r := range cfg.Roles {
+			role := fmt.Sprintf("role%02d", r+1)
+			p := &policy.Policy{
+				ID:      fmt.Sprintf("%s-%s", strings.ToLower(account), role),
+				Account: account,
+				Name:    fmt.Sprintf("Generated policy of %s in %s", role, account),
+			}
+			for range cfg.Statements {
+				p.Statements = append(p.Statements, fixtureStatement(rng))
+			}
+			policies = append(policies, p)
+			bindings = append(bindings, &provider.Binding{
+				Role:     role,
+				Account:  account,
+				Policies: []string{p.ID, common.ID, "builtin:user-subjects"},
+			})
+		}
+	}
+	for _, p := range policies {
+		fixtures.Statements += len(p.Statements)
+	}
+	fixtures.Policies = len(policies)
+	fixtures.Bindings = len(bindings)
+
+	users, err := fixtureUsers(rng, fixtures.Accounts, cfg.Roles, cfg.Users)
+	if err != nil {
+		return nil, err
+	}
+	fixtures.Users = len(users)
+
+	accountKey, err := devSeed(filepath.Join(dir, "account.nk"), nkeys.CreateAccount)
+	if err != nil {
+		return nil, err
+	}
+	usersPath := filepath.Join(dir, "users.json")
+	config := &Config{
+		Account: AccountConfig{
+			Type: "static",
+			Static: &provider.StaticAccountProviderConfig{
+				PublicKey:      accountKey,
+				PrivateKeyPath: filepath.Join(dir, "account.nk"),
+				Accounts:       append([]string{"AUTH"}, fixtures.Accounts...),
+			},
+		},
+		Policy: PolicyConfig{
+			Type: "file",
+			File: &provider.FilePolicyProviderConfig{
+				PoliciesPath: filepath.Join(dir, "policies.json"),
+				BindingsPath: filepath.Join(dir, "bindings.json"),
+			},
+		},
+		Auth: AuthConfig{
+			File: []FileAuthProviderConfig{
+				{ID: "fixtures", Accounts: []string{"*"}, UsersPath: usersPath},
+			},
+		},
+		Server: ServerConfig{TTL: "1h"},
+	}
+
+	for _, f := range []struct {
+		path string
+		v    any
+	}{
+		{filepath.Join(dir, "policies.json"), policies},
+		{filepath.Join(dir, "bindings.json"), bindings},
+		{usersPath, map[string]any{"users": users}},
+		{fixtures.ConfigPath, config},
+	} {
+		if err := writeFixtureJSON(f.path, f.v); err != nil {
+			return nil, err
+		}
+	}
+	return fixtures, nil
+}
+
+// fixtureStatement returns a random statement: mostly NATS subjects, some
+// JetStream, KV, and object store access, and about one in ten a denial.
+func fixtureStatement(rng *rand.Rand) policy.Statement {
+	domain := fixtureDomains[rng.IntN(len(fixtureDomains))]
+	entity := fixtureEntities[rng.IntN(len(fixtureEntities))]
+	stream := strings.ToUpper(domain + "_" + entity)
+
+	if rng.IntN(10) == 0 {
+		return policy.Statement{
+			Effect:    policy.EffectDeny,
+			Actions:   []policy.Action{policy.ActionNATSPub},
+			Resources: []string{fmt.Sprintf("nats:%s.admin.>", domain)},
+		}
+	}
+
+	var actions []policy.Action
+	var resources []string
+	switch rng.IntN(8) {
+	case 0, 1:
+		actions = []policy.Action{policy.ActionNATSPub, policy.ActionNATSSub}
+		resources = []string{fmt.Sprintf("nats:%s.%s.>", domain, entity)}
+	case 2:
+		actions = []policy.Action{policy.ActionNATSSub}
+		resources = []string{fmt.Sprintf("nats:%s.*.%s", domain, entity), fmt.Sprintf("nats:%s.%s.*:workers", domain, entity)}
+	case 3:
+		actions = []policy.Action{policy.ActionNATSService}
+		resources = []string{fmt.Sprintf("nats:%s.rpc.%s", domain, entity)}
+	case 4:
+		actions = []policy.Action{policy.ActionNATSPub, policy.ActionNATSSub}
+		resources = []string{fmt.Sprintf("nats:%s.user.{{ user.id }}.>", domain)}
+	case 5:
+		actions = []policy.Action{policy.ActionJSConsume}
+		resources = []string{"js:" + stream, fmt.Sprintf("js:%s:%s-worker", stream, entity)}
+	case 6:
+		actions = []policy.Action{policy.ActionKVRead, policy.ActionKVEdit}
+		resources = []string{fmt.Sprintf("kv:%s_%s", domain, entity)}
+	default:
+		actions = []policy.Action{policy.ActionObjRead}
+		resources = []string{fmt.Sprintf("obj:%s_files", domain)}
+	}
+	return policy.Statement{Effect: policy.EffectAllow, Actions: actions, Resources: resources}
+}
+
+// fixtureUser is an entry of the users file.
+type fixtureUser struct {
+	Accounts     []string `json:"accounts"`
+	Roles        []string `json:"roles"`
+	PasswordHash string   `json:"passwordHash"`
+}
+
+// fixtureUsers returns users per account with one to three roles each. They
+// share one FixturePassword hash of the lowest bcrypt cost, so large user
+// sets are generated and verified quickly.
+func fixtureUsers(rng *rand.Rand, accounts []string, roles, perAccount int) (map[string]fixtureUser, error) {
+	hasher, err := identity.NewPasswordHasher(identity.PasswordHashingConfig{Cost: bcrypt.MinCost})
+	if err != nil {
+		return nil, err
+	}
+	hash, err := hasher.Hash(FixturePassword)
+	if err != nil {
+		return nil, fmt.Errorf("hashing fixture password: %w", err)
+	}
+
+	users := make(map[string]fixtureUser, len(accounts)*perAccount)
+	if roles == 0 {
+		return users, nil
+	}
+	for _, account := range accounts {
+		for u := range perAccount {
+			n := 1 + rng.IntN(min(3, roles))
+			var userRoles []string
+			for _, r := range rng.Perm(roles)[:n] {
+				userRoles = append(userRoles, fmt.Sprintf("%s.role%02d", account, r+1))
+			}
+			name := fmt.Sprintf("%s-user%03d", strings.ToLower(account), u+1)
+			users[name] = fixtureUser{Accounts: []string{account}, Roles: userRoles, PasswordHash: hash}
+		}
+	}
+	return users, nil
+}
+
+// writeFixtureJSON writes v as indented JSON to path, replacing the file.
+func writeFixtureJSON(path string, v any) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("replacing %s: %w", filepath.Base(path), err)
+	}
+	return writeDevJSON(path, v)
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+)
+
+func TestGenerateFixtures(t *testing.T) {
+	dir := t.TempDir()
+	fixtures, err := GenerateFixtures(FixtureConfig{Dir: dir, Accounts: 3, Roles: 4, Statements: 6, Users: 5, Seed: 7})
+	if err != nil {
+		t.Fatalf("GenerateFixtures() error = %v", err)
+	}
+	if len(fixtures.Accounts) != 3 || fixtures.Policies != 15 || fixtures.Bindings != 12 || fixtures.Users != 15 {
+		t.Errorf("fixtures = %+v", fixtures)
+	}
+	if fixtures.Statements != 3*(4*6+2) {
+		t.Errorf("Statements = %d, want %d", fixtures.Statements, 3*(4*6+2))
+	}
+
+	report := ValidateConfigFile(context.Background(), fixtures.ConfigPath)
+	for _, f := range report.Findings {
+		t.Errorf("finding: %s", f.String())
+	}
+	if !report.Valid {
+		t.Fatal("generated fixtures are not valid")
+	}
+
+	// The same seed generates the same policies.
+	first, _ := os.ReadFile(fixtures.Dir + "/policies.json")
+	if _, err := GenerateFixtures(FixtureConfig{Dir: dir, Accounts: 3, Roles: 4, Statements: 6, Users: 5, Seed: 7}); err != nil {
+		t.Fatal(err)
+	}
+	second, _ := os.ReadFile(fixtures.Dir + "/policies.json")
+	if string(first) != string(second) {
+		t.Error("policies differ for the same seed")
+	}
+
+	if _, err := GenerateFixtures(FixtureConfig{Dir: dir, Roles: -1}); err == nil {
+		t.Error("GenerateFixtures() with negative roles succeeded")
+	}
+}
+
+// BenchmarkAuthenticate_Fixtures authenticates users of generated fixtures,
+// at the scale of a large deployment.
+func BenchmarkAuthenticate_Fixtures(b *testing.B) {
+	fixtures, err := GenerateFixtures(FixtureConfig{Dir: b.TempDir(), Accounts: 50, Roles: 20, Statements: 10, Users: 20})
+	if err != nil {
+		b.Fatal(err)
+	}
+	config, err := LoadConfig(fixtures.ConfigPath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	ctrl, err := NewAuthControllerWithConfig(config)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for i := 0; b.Loop(); i++ {
+		account := fixtures.Accounts[i%len(fixtures.Accounts)]
+		user := fmt.Sprintf("acc%03d-user%03d", i%len(fixtures.Accounts)+1, i%20+1)
+		_, err := ctrl.Authenticate(context.Background(), natsjwt.ConnectOptions{
+			Token: `{"account":"` + account + `","token":"` + user + `:` + FixturePassword + `"}`,
+		}, "", time.Hour)
+		if err != nil {
+			b.Fatalf("Authenticate(%s) error = %v", user, err)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/msimon/nauts/authrpc"
+)
+
+// grpcShutdownTimeout bounds the wait for in-flight gRPC calls on stop.
+const grpcShutdownTimeout = 5 * time.Second
+
+// GRPCService serves authrpc.AuthenticatorServer: it authenticates requests
+// with the controller's Authenticate, like auth callout does for NATS
+// clients, and returns the issued JWT. Clients must present a certificate
+// signed by one of the configured CAs.
+type GRPCService struct {
+	controllers *controllerHolder
+	config      GRPCConfig
+	tlsConfig   *tls.Config
+	defaultTTL  time.Duration
+	limiter     *RateLimiter
+	logger      Logger
+
+	done   chan struct{}
+	mu     sync.Mutex
+	closed bool
+}
+
+// GRPCOption configures a GRPCService.
+type GRPCOption func(*GRPCService)
+
+// WithGRPCLogger sets a custom logger for the gRPC service.
+func WithGRPCLogger(l Logger) GRPCOption {
+	return func(s *GRPCService) {
+		s.logger = l
+	}
+}
+
+// WithGRPCDefaultTTL sets the lifetime of issued JWTs, which requests may
+// only shorten. Default: 1h, like server.ttl.
+func WithGRPCDefaultTTL(ttl time.Duration) GRPCOption {
+	return func(s *GRPCService) {
+		s.defaultTTL = ttl
+	}
+}
+
+// WithGRPCRateLimiter throttles requests with l, typically
+// CalloutService.RateLimiter, so that the limits of auth callout cannot be
+// evaded over gRPC.
+func WithGRPCRateLimiter(l *RateLimiter) GRPCOption {
+	return func(s *GRPCService) {
+		s.limiter = l
+	}
+}
+
+// NewGRPCService creates a new GRPCService. The TLS files are read here, so
+// that a misconfigured listener fails on startup.
+func NewGRPCService(controller *AuthController, config GRPCConfig, opts ...GRPCOption) (*GRPCService, error) {
+	if controller == nil {
+		return nil, errors.New("controller is required")
+	}
+	if config.Address == "" {
+		return nil, errors.New("address is required")
+	}
+	if config.TLS == nil || config.TLS.ClientCAFile == "" {
+		return nil, errors.New("a client CA file is required")
+	}
+	tlsConfig, err := loadTLSConfig("grpc", config.TLS)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+
+	s := &GRPCService{
+		controllers: newControllerHolder(controller),
+		config:      config,
+		tlsConfig:   tlsConfig,
+		defaultTTL:  time.Hour,
+		logger:      &defaultLogger{},
+		done:        make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+// SetController replaces the controller used for new requests. It blocks
+// until in-flight requests using the previous controller have completed and
+// returns the previous controller.
+func (s *GRPCService) SetController(controller *AuthController) *AuthController {
+	return s.controllers.swap(controller)
+}
+
+// Start listens on the configured address and serves requests.
+// This method blocks until Stop is called or the context is cancelled.
+func (s *GRPCService) Start(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.config.Address)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", s.config.Address, err)
+	}
+	server := grpc.NewServer(authrpc.ServerCodec(), grpc.Creds(credentials.NewTLS(s.tlsConfig)))
+	authrpc.RegisterAuthenticatorServer(server, s)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.Serve(ln)
+	}()
+
+	s.logger.Info("grpc service started, listening on %s", ln.Addr())
+
+	select {
+	case <-ctx.Done():
+		s.logger.Info("context cancelled, shutting down")
+	case <-s.done:
+		s.logger.Info("stop requested, shutting down")
+	case err := <-errCh:
+		return fmt.Errorf("serving grpc: %w", err)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(grpcShutdownTimeout):
+		s.logger.Warn("grpc calls still in flight after %s, closing them", grpcShutdownTimeout)
+		server.Stop()
+	}
+	s.logger.Info("grpc service stopped")
+	return nil
+}
+
+// Stop signals the service to shut down gracefully.
+func (s *GRPCService) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	return nil
+}
+
+// Authenticate implements authrpc.AuthenticatorServer.
+func (s *GRPCService) Authenticate(ctx context.Context, req *authrpc.AuthenticateRequest) (*authrpc.AuthenticateResponse, error) {
+	p, _ := peer.FromContext(ctx)
+	if err := s.checkClient(p); err != nil {
+		return nil, err
+	}
+	if p != nil {
+		if addr, err := netip.ParseAddrPort(p.Addr.String()); err == nil {
+			ctx = ContextWithClientIP(ctx, addr.Addr().Unmap())
+		}
+	}
+
+	ttl, err := exchangeTTL(s.defaultTTL, req.TTL)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid ttl %q", req.TTL)
+	}
+
+	controller, release := s.controllers.acquire()
+	defer release()
+
+	connectOptions := natsjwt.ConnectOptions{Token: req.Token, Username: req.User, Password: req.Password}
+	resp, err := exchangeToken(ctx, controller, s.limiter, connectOptions, req.UserPublicKey, ttl)
+	if err != nil {
+		s.logger.Warn("grpc authentication failed: %v", err)
+		return nil, grpcAuthError(err)
+	}
+	return resp, nil
+}
+
+// checkClient rejects peers whose certificate is not in AllowedClients.
+func (s *GRPCService) checkClient(p *peer.Peer) error {
+	if len(s.config.AllowedClients) == 0 {
+		return nil
+	}
+	if p != nil {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.VerifiedChains) > 0 {
+			cert := info.State.VerifiedChains[0][0]
+			if slices.Contains(s.config.AllowedClients, cert.Subject.CommonName) {
+				return nil
+			}
+			for _, name := range cert.DNSNames {
+				if slices.Contains(s.config.AllowedClients, name) {
+					return nil
+				}
+			}
+		}
+	}
+	return status.Error(codes.PermissionDenied, "client certificate not allowed")
+}
+
+// grpcAuthError maps an error of exchangeToken to a gRPC status.
+func grpcAuthError(err error) error {
+	switch exchangeErrorCode(err) {
+	case exchangeUnavailable:
+		return status.Error(codes.Unavailable, "provider unavailable")
+	case exchangeInvalidRequest:
+		return status.Error(codes.InvalidArgument, "invalid request")
+	case exchangeRateLimited:
+		return status.Error(codes.ResourceExhausted, "too many requests")
+	case exchangeInternal:
+		return status.Error(codes.Internal, "internal error")
+	default:
+		return status.Error(codes.Unauthenticated, "authentication failed")
+	}
+}
@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"path/filepath"
+	"testing"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	"github.com/msimon/nauts/authrpc"
+)
+
+func TestNewGRPCService_Validation(t *testing.T) {
+	controller := createTestController(t)
+	tests := []struct {
+		name   string
+		config GRPCConfig
+	}{
+		{name: "missing address", config: GRPCConfig{TLS: &HTTPTLSConfig{ClientCAFile: "ca.crt"}}},
+		{name: "missing tls", config: GRPCConfig{Address: ":0"}},
+		{name: "missing client CA", config: GRPCConfig{Address: ":0", TLS: &HTTPTLSConfig{CertFile: "server.crt", KeyFile: "server.key"}}},
+		{name: "missing certificate", config: GRPCConfig{Address: ":0", TLS: &HTTPTLSConfig{CertFile: "missing.crt", KeyFile: "missing.key", ClientCAFile: "ca.crt"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewGRPCService(controller, tt.config); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+// startTestGRPCService serves s on a local port and returns a client
+// presenting the certificate <client>.crt of dir, or none if client is empty.
+func startTestGRPCService(t *testing.T, s *GRPCService, dir string, ca *x509.Certificate, client string) *authrpc.Client {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(authrpc.ServerCodec(), grpc.Creds(credentials.NewTLS(s.tlsConfig)))
+	authrpc.RegisterAuthenticatorServer(server, s)
+	go server.Serve(ln)
+	t.Cleanup(server.Stop)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	tlsConfig := &tls.Config{RootCAs: roots, ServerName: "localhost"}
+	if client != "" {
+		cert, err := tls.LoadX509KeyPair(filepath.Join(dir, client+".crt"), filepath.Join(dir, client+".key"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	conn, err := authrpc.Dial(ln.Addr().String(), tlsConfig)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return authrpc.NewClient(conn)
+}
+
+func TestGRPCService_Authenticate(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := createTestCertificate(t, dir, "ca", nil, nil)
+	createTestCertificate(t, dir, "server", ca, caKey)
+	createTestCertificate(t, dir, "gateway", ca, caKey)
+	createTestCertificate(t, dir, "other", ca, caKey)
+
+	s, err := NewGRPCService(createTestController(t), GRPCConfig{
+		Address: "127.0.0.1:0",
+		TLS: &HTTPTLSConfig{
+			CertFile:     filepath.Join(dir, "server.crt"),
+			KeyFile:      filepath.Join(dir, "server.key"),
+			ClientCAFile: filepath.Join(dir, "ca.crt"),
+		},
+		AllowedClients: []string{"gateway"},
+	}, WithGRPCLogger(&testLogger{}))
+	if err != nil {
+		t.Fatalf("NewGRPCService() error = %v", err)
+	}
+	ctx := context.Background()
+	token := `{"account":"test-account","token":"alice:secret123"}`
+
+	t.Run("generated key", func(t *testing.T) {
+		client := startTestGRPCService(t, s, dir, ca, "gateway")
+		resp, err := client.Authenticate(ctx, &authrpc.AuthenticateRequest{Token: token, TTL: "5m"})
+		if err != nil {
+			t.Fatalf("Authenticate() error = %v", err)
+		}
+		if resp.Account != "test-account" || resp.UserID != "alice" {
+			t.Errorf("Authenticate() = %s in %s, want alice in test-account", resp.UserID, resp.Account)
+		}
+		if resp.ExpiresAt == nil {
+			t.Error("ExpiresAt not set")
+		}
+		kp, err := nkeys.FromSeed([]byte(resp.Seed))
+		if err != nil {
+			t.Fatalf("invalid seed: %v", err)
+		}
+		if pub, _ := kp.PublicKey(); pub != resp.UserPublicKey {
+			t.Errorf("seed belongs to %s, want %s", pub, resp.UserPublicKey)
+		}
+		if jwt, err := natsjwt.ParseDecoratedJWT([]byte(resp.Creds)); err != nil || jwt != resp.JWT {
+			t.Errorf("creds do not hold the JWT: %v", err)
+		}
+	})
+
+	t.Run("provided key", func(t *testing.T) {
+		client := startTestGRPCService(t, s, dir, ca, "gateway")
+		kp, _ := nkeys.CreateUser()
+		pub, _ := kp.PublicKey()
+		resp, err := client.Authenticate(ctx, &authrpc.AuthenticateRequest{Token: token, UserPublicKey: pub})
+		if err != nil {
+			t.Fatalf("Authenticate() error = %v", err)
+		}
+		if resp.UserPublicKey != pub || resp.Seed != "" || resp.Creds != "" {
+			t.Errorf("Authenticate() = key %s, seed %q; want the provided key and no seed", resp.UserPublicKey, resp.Seed)
+		}
+	})
+
+	t.Run("rejected credentials", func(t *testing.T) {
+		client := startTestGRPCService(t, s, dir, ca, "gateway")
+		_, err := client.Authenticate(ctx, &authrpc.AuthenticateRequest{Token: `{"account":"test-account","token":"alice:wrong"}`})
+		if status.Code(err) != codes.Unauthenticated {
+			t.Errorf("Authenticate() error = %v, want Unauthenticated", err)
+		}
+		_, err = client.Authenticate(ctx, &authrpc.AuthenticateRequest{Token: token, TTL: "soon"})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Authenticate() with invalid ttl error = %v, want InvalidArgument", err)
+		}
+	})
+
+	t.Run("client not allowed", func(t *testing.T) {
+		client := startTestGRPCService(t, s, dir, ca, "other")
+		_, err := client.Authenticate(ctx, &authrpc.AuthenticateRequest{Token: token})
+		if status.Code(err) != codes.PermissionDenied {
+			t.Errorf("Authenticate() error = %v, want PermissionDenied", err)
+		}
+	})
+
+	t.Run("no client certificate", func(t *testing.T) {
+		client := startTestGRPCService(t, s, dir, ca, "")
+		_, err := client.Authenticate(ctx, &authrpc.AuthenticateRequest{Token: token})
+		if err == nil {
+			t.Error("Authenticate() without client certificate succeeded")
+		}
+	})
+
+	t.Run("rate limited", func(t *testing.T) {
+		s.limiter, _ = newTestRateLimiter(t, RateLimit{}, RateLimit{PerSecond: 1, Burst: 1})
+		client := startTestGRPCService(t, s, dir, ca, "gateway")
+		if _, err := client.Authenticate(ctx, &authrpc.AuthenticateRequest{Token: token}); err != nil {
+			t.Fatalf("first Authenticate() error = %v", err)
+		}
+		_, err := client.Authenticate(ctx, &authrpc.AuthenticateRequest{Token: token})
+		if status.Code(err) != codes.ResourceExhausted {
+			t.Errorf("second Authenticate() error = %v, want ResourceExhausted", err)
+		}
+	})
+}
@@ -0,0 +1,455 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+
+	"github.com/msimon/nauts/depstats"
+)
+
+const (
+	// httpShutdownTimeout bounds the wait for in-flight HTTP requests on stop.
+	httpShutdownTimeout = 5 * time.Second
+
+	// readinessTimeout bounds the checks of GET /readyz.
+	readinessTimeout = 2 * time.Second
+
+	// maxHTTPDebugRequestSize limits the body of POST /debug.
+	maxHTTPDebugRequestSize = 1 << 20
+
+	// maxHTTPAuthenticateRequestSize limits the body of POST /v1/authenticate.
+	maxHTTPAuthenticateRequestSize = 1 << 20
+)
+
+// HTTPService serves health checks, metrics, and debug requests on one HTTP
+// listener:
+//
+//	GET  /healthz  200 while the process serves requests
+//	GET  /readyz   200 once the callout service is ready, 503 otherwise
+//	GET  /metrics  controller metrics, as on nauts.debug.metrics, or the
+//	               dependency metrics in the OpenMetrics text format
+//	POST /debug    permissions of a user, as on nauts.debug (if enabled)
+//	POST /v1/authenticate
+//	               a user JWT for a nauts token, as issued by auth
+//	               callout (if enabled)
+//
+// /metrics and /debug require the configured bearer token and, with mTLS, a
+// verified client certificate. /v1/authenticate is authenticated by the
+// token it exchanges.
+type HTTPService struct {
+	controllers *controllerHolder
+	config      HTTPConfig
+	token       string
+	tlsConfig   *tls.Config
+	logger      Logger
+	defaultTTL  time.Duration
+	limiter     *RateLimiter
+
+	ready             func() bool
+	readinessChecks   func(context.Context) []ReadinessCheck
+	subscriptionStats func() []SubscriptionStats
+	rateLimitStats    func() []RateLimitStats
+	requestPoolStats  func() *RequestPoolStats
+
+	done   chan struct{}
+	mu     sync.Mutex
+	closed bool
+}
+
+// HTTPOption configures an HTTPService.
+type HTTPOption func(*HTTPService)
+
+// WithHTTPLogger sets a custom logger for the HTTP service.
+func WithHTTPLogger(l Logger) HTTPOption {
+	return func(s *HTTPService) {
+		s.logger = l
+	}
+}
+
+// WithHTTPReadiness makes /readyz report ready, typically
+// CalloutService.Healthy. Without it, /readyz reports ready like /healthz.
+func WithHTTPReadiness(ready func() bool) HTTPOption {
+	return func(s *HTTPService) {
+		s.ready = ready
+	}
+}
+
+// WithHTTPReadinessChecks makes /readyz run checks, typically
+// CalloutService.CheckReadiness, and report ready only if all pass. The
+// response lists each check, so that a failing probe shows what is missing.
+func WithHTTPReadinessChecks(checks func(context.Context) []ReadinessCheck) HTTPOption {
+	return func(s *HTTPService) {
+		s.readinessChecks = checks
+	}
+}
+
+// WithHTTPSubscriptionStats adds the back-pressure counters returned by stats
+// to /metrics.
+func WithHTTPSubscriptionStats(stats func() []SubscriptionStats) HTTPOption {
+	return func(s *HTTPService) {
+		s.subscriptionStats = stats
+	}
+}
+
+// WithHTTPRateLimitStats adds the throttled request counters returned by
+// stats to /metrics.
+func WithHTTPRateLimitStats(stats func() []RateLimitStats) HTTPOption {
+	return func(s *HTTPService) {
+		s.rateLimitStats = stats
+	}
+}
+
+// WithHTTPRequestPoolStats adds the worker pool counters returned by stats
+// to /metrics.
+func WithHTTPRequestPoolStats(stats func() *RequestPoolStats) HTTPOption {
+	return func(s *HTTPService) {
+		s.requestPoolStats = stats
+	}
+}
+
+// WithHTTPDefaultTTL sets the lifetime of JWTs issued by /v1/authenticate,
+// which requests may only shorten. Default: 1h, like server.ttl.
+func WithHTTPDefaultTTL(ttl time.Duration) HTTPOption {
+	return func(s *HTTPService) {
+		s.defaultTTL = ttl
+	}
+}
+
+// WithHTTPRateLimiter throttles /v1/authenticate with l, typically
+// CalloutService.RateLimiter, so that the limits of auth callout cannot be
+// evaded over HTTP.
+func WithHTTPRateLimiter(l *RateLimiter) HTTPOption {
+	return func(s *HTTPService) {
+		s.limiter = l
+	}
+}
+
+// NewHTTPService creates a new HTTPService. The token and TLS files are read
+// here, so that a misconfigured listener fails on startup.
+func NewHTTPService(controller *AuthController, config HTTPConfig, opts ...HTTPOption) (*HTTPService, error) {
+	if controller == nil {
+		return nil, errors.New("controller is required")
+	}
+	if config.Address == "" {
+		return nil, errors.New("address is required")
+	}
+	token, err := config.GetToken()
+	if err != nil {
+		return nil, err
+	}
+	if token == "" && (config.TLS == nil || config.TLS.ClientCAFile == "") {
+		return nil, errors.New("a token file or a client CA file is required")
+	}
+	if config.Authenticate && config.TLS == nil {
+		return nil, errors.New("authenticate requires tls")
+	}
+
+	s := &HTTPService{
+		controllers: newControllerHolder(controller),
+		config:      config,
+		token:       token,
+		logger:      &defaultLogger{},
+		defaultTTL:  time.Hour,
+		done:        make(chan struct{}),
+	}
+	if config.TLS != nil {
+		if s.tlsConfig, err = loadTLSConfig("http", config.TLS); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s, nil
+}
+
+// loadTLSConfig loads the server certificate and, for mTLS, the client CAs
+// of the named listener. Client certificates are verified if given but not
+// required, so that health probes can connect without one; protected
+// endpoints check for them.
+func loadTLSConfig(listener string, c *HTTPTLSConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading %s certificate: %w", listener, err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if c.ClientCAFile != "" {
+		data, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s client CA file: %w", listener, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("%s client CA file %s contains no certificates", listener, c.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+// SetController replaces the controller used for new requests. It blocks
+// until in-flight requests using the previous controller have completed and
+// returns the previous controller.
+func (s *HTTPService) SetController(controller *AuthController) *AuthController {
+	return s.controllers.swap(controller)
+}
+
+// Handler returns the handler serving the endpoints.
+func (s *HTTPService) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.HandleFunc("GET /readyz", s.handleReady)
+	mux.HandleFunc("GET /metrics", s.authenticated(s.handleMetrics))
+	if s.config.Debug {
+		mux.HandleFunc("POST /debug", s.authenticated(s.handleDebug))
+	}
+	if s.config.Authenticate {
+		mux.HandleFunc("POST /v1/authenticate", s.cors(s.handleAuthenticate))
+		mux.HandleFunc("OPTIONS /v1/authenticate", s.cors(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	}
+	return mux
+}
+
+// Start listens on the configured address and serves requests.
+// This method blocks until Stop is called or the context is cancelled.
+func (s *HTTPService) Start(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.config.Address)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", s.config.Address, err)
+	}
+	scheme := "http"
+	if s.tlsConfig != nil {
+		ln = tls.NewListener(ln, s.tlsConfig)
+		scheme = "https"
+	}
+
+	server := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.Serve(ln)
+	}()
+
+	s.logger.Info("http service started, listening on %s://%s", scheme, ln.Addr())
+
+	select {
+	case <-ctx.Done():
+		s.logger.Info("context cancelled, shutting down")
+	case <-s.done:
+		s.logger.Info("stop requested, shutting down")
+	case err := <-errCh:
+		return fmt.Errorf("serving http: %w", err)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		s.logger.Warn("error shutting down http server: %v", err)
+	}
+	s.logger.Info("http service stopped")
+	return nil
+}
+
+// Stop signals the service to shut down gracefully.
+func (s *HTTPService) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	return nil
+}
+
+// authenticated rejects requests without the token or, with mTLS, without a
+// verified client certificate.
+func (s *HTTPService) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.tlsConfig != nil && s.tlsConfig.ClientCAs != nil {
+			if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+				s.writeJSON(w, http.StatusUnauthorized, debugError{Code: "unauthorized", Message: "client certificate required"})
+				return
+			}
+		}
+		if s.token != "" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				s.writeJSON(w, http.StatusUnauthorized, debugError{Code: "unauthorized", Message: "missing or invalid bearer token"})
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// cors allows browsers on the configured origins to call next.
+func (s *HTTPService) cors(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin != "" && (slices.Contains(s.config.AllowedOrigins, "*") || slices.Contains(s.config.AllowedOrigins, origin)) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.Header().Add("Vary", "Origin")
+		}
+		next(w, r)
+	}
+}
+
+func (s *HTTPService) handleHealth(w http.ResponseWriter, _ *http.Request) {
+	io.WriteString(w, "ok\n")
+}
+
+func (s *HTTPService) handleReady(w http.ResponseWriter, r *http.Request) {
+	if s.ready != nil && !s.ready() {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	if s.readinessChecks == nil {
+		io.WriteString(w, "ok\n")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+	var body strings.Builder
+	status := http.StatusOK
+	for _, check := range s.readinessChecks(ctx) {
+		if check.Ready {
+			fmt.Fprintf(&body, "[+] %s ok\n", check.Name)
+		} else {
+			fmt.Fprintf(&body, "[-] %s failed: %s\n", check.Name, check.Error)
+			status = http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	io.WriteString(w, body.String())
+}
+
+// handleMetrics responds with JSON, or with the dependency metrics in the
+// OpenMetrics text format if the client accepts it (as Prometheus does) or
+// requests ?format=openmetrics.
+func (s *HTTPService) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("format") == "openmetrics" ||
+		strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text") {
+		w.Header().Set("Content-Type", depstats.OpenMetricsContentType)
+		if err := depstats.WriteOpenMetrics(w, depstats.Snapshot()); err != nil {
+			s.logger.Warn("failed to write openmetrics response: %v", err)
+		}
+		return
+	}
+
+	controller, release := s.controllers.acquire()
+	defer release()
+
+	s.writeJSON(w, http.StatusOK, collectMetrics(controller, s.subscriptionStats, s.rateLimitStats, s.requestPoolStats))
+}
+
+func (s *HTTPService) handleDebug(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxHTTPDebugRequestSize))
+	if err != nil {
+		resp := debugResponse{}
+		resp.setError("invalid_request", fmt.Sprintf("failed to read debug request: %v", err))
+		s.writeJSON(w, http.StatusBadRequest, resp)
+		return
+	}
+
+	controller, release := s.controllers.acquire()
+	defer release()
+
+	resp := debugPermissions(r.Context(), controller, data)
+	status := http.StatusOK
+	if resp.Error != nil && resp.Error.Code == "invalid_request" {
+		status = http.StatusBadRequest
+	}
+	s.writeJSON(w, status, resp)
+}
+
+// handleAuthenticate exchanges the nauts token in the body, the same JSON as
+// the auth_token connect option, for a user JWT. The query parameters
+// userPublicKey and ttl correspond to the fields of
+// authrpc.AuthenticateRequest.
+func (s *HTTPService) handleAuthenticate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxHTTPAuthenticateRequestSize))
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, debugError{Code: exchangeInvalidRequest, Message: "failed to read request"})
+		return
+	}
+	query := r.URL.Query()
+	ttl, err := exchangeTTL(s.defaultTTL, query.Get("ttl"))
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, debugError{Code: exchangeInvalidRequest, Message: fmt.Sprintf("invalid ttl %q", query.Get("ttl"))})
+		return
+	}
+
+	ctx := r.Context()
+	if addr, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		ctx = ContextWithClientIP(ctx, addr.Addr().Unmap())
+	}
+
+	controller, release := s.controllers.acquire()
+	defer release()
+
+	connectOptions := natsjwt.ConnectOptions{Token: string(data)}
+	resp, err := exchangeToken(ctx, controller, s.limiter, connectOptions, query.Get("userPublicKey"), ttl)
+	if err != nil {
+		s.logger.Warn("http authentication failed: %v", err)
+		switch code := exchangeErrorCode(err); code {
+		case exchangeUnavailable:
+			s.writeJSON(w, http.StatusServiceUnavailable, debugError{Code: code, Message: "provider unavailable"})
+		case exchangeInvalidRequest:
+			s.writeJSON(w, http.StatusBadRequest, debugError{Code: code, Message: "invalid request"})
+		case exchangeRateLimited:
+			s.writeJSON(w, http.StatusTooManyRequests, debugError{Code: code, Message: "too many requests"})
+		case exchangeInternal:
+			s.writeJSON(w, http.StatusInternalServerError, debugError{Code: code, Message: "internal error"})
+		default:
+			s.writeJSON(w, http.StatusUnauthorized, debugError{Code: code, Message: "authentication failed"})
+		}
+		return
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *HTTPService) writeJSON(w http.ResponseWriter, status int, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		s.logger.Warn("failed to encode http response: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
@@ -0,0 +1,373 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nkeys"
+
+	"github.com/msimon/nauts/authrpc"
+	"github.com/msimon/nauts/depstats"
+)
+
+func writeHTTPToken(t *testing.T, token string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "http.token")
+	if err := os.WriteFile(path, []byte(token+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNewHTTPService_Validation(t *testing.T) {
+	controller := createTestController(t)
+	tokenFile := writeHTTPToken(t, "s3cret")
+
+	tests := []struct {
+		name   string
+		config HTTPConfig
+	}{
+		{name: "missing address", config: HTTPConfig{TokenFile: tokenFile}},
+		{name: "unauthenticated", config: HTTPConfig{Address: ":0"}},
+		{name: "missing token file", config: HTTPConfig{Address: ":0", TokenFile: filepath.Join(t.TempDir(), "missing")}},
+		{name: "empty token file", config: HTTPConfig{Address: ":0", TokenFile: writeHTTPToken(t, " ")}},
+		{name: "missing certificate", config: HTTPConfig{Address: ":0", TokenFile: tokenFile, TLS: &HTTPTLSConfig{CertFile: "missing.crt", KeyFile: "missing.key"}}},
+		{name: "authenticate without tls", config: HTTPConfig{Address: ":0", TokenFile: tokenFile, Authenticate: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewHTTPService(controller, tt.config); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+	if _, err := NewHTTPService(nil, HTTPConfig{Address: ":0", TokenFile: tokenFile}); err == nil {
+		t.Error("expected error for nil controller")
+	}
+}
+
+func TestHTTPService_Endpoints(t *testing.T) {
+	ready := false
+	s, err := NewHTTPService(createTestController(t), HTTPConfig{Address: ":0", TokenFile: writeHTTPToken(t, "s3cret"), Debug: true},
+		WithHTTPLogger(&testLogger{}),
+		WithHTTPReadiness(func() bool { return ready }),
+		WithHTTPRateLimitStats(func() []RateLimitStats { return []RateLimitStats{{Account: "test-account", UserThrottled: 2}} }),
+	)
+	if err != nil {
+		t.Fatalf("NewHTTPService() error = %v", err)
+	}
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	do := func(method, path, token, body string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	if resp := do("GET", "/healthz", "", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("/healthz status = %d", resp.StatusCode)
+	}
+	if resp := do("GET", "/readyz", "", ""); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("/readyz before ready status = %d", resp.StatusCode)
+	}
+	ready = true
+	if resp := do("GET", "/readyz", "", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("/readyz status = %d", resp.StatusCode)
+	}
+
+	for _, token := range []string{"", "wrong"} {
+		if resp := do("GET", "/metrics", token, ""); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("/metrics with token %q status = %d, want 401", token, resp.StatusCode)
+		}
+		if resp := do("POST", "/debug", token, "{}"); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("/debug with token %q status = %d, want 401", token, resp.StatusCode)
+		}
+	}
+
+	resp := do("GET", "/metrics", "s3cret", "")
+	var metrics debugMetricsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&metrics); err != nil {
+		t.Fatalf("decoding /metrics: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || len(metrics.RateLimits) != 1 || metrics.RateLimits[0].UserThrottled != 2 {
+		t.Errorf("/metrics status = %d, rate limits = %+v", resp.StatusCode, metrics.RateLimits)
+	}
+
+	resp = do("GET", "/metrics?format=openmetrics", "s3cret", "")
+	body, _ := io.ReadAll(resp.Body)
+	if resp.Header.Get("Content-Type") != depstats.OpenMetricsContentType || !strings.HasSuffix(string(body), "# EOF\n") {
+		t.Errorf("/metrics?format=openmetrics content type = %q, body = %q", resp.Header.Get("Content-Type"), body)
+	}
+
+	resp = do("POST", "/debug", "s3cret", `{"user":{"id":"alice","roles":[{"account":"test-account","name":"workers"}]},"account":"test-account"}`)
+	var debug debugResponse
+	if err := json.NewDecoder(resp.Body).Decode(&debug); err != nil {
+		t.Fatalf("decoding /debug: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || debug.Error != nil || debug.CompilationResult == nil {
+		t.Errorf("/debug status = %d, error = %+v", resp.StatusCode, debug.Error)
+	}
+
+	if resp := do("POST", "/debug", "s3cret", `{"account":"test-account"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("/debug without user status = %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestHTTPService_DebugDisabled(t *testing.T) {
+	s, err := NewHTTPService(createTestController(t), HTTPConfig{Address: ":0", TokenFile: writeHTTPToken(t, "s3cret")})
+	if err != nil {
+		t.Fatalf("NewHTTPService() error = %v", err)
+	}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/debug", strings.NewReader("{}"))
+	req.Header.Set("Authorization", "Bearer s3cret")
+	s.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound && rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("/debug status = %d, want it not to be served", rec.Code)
+	}
+}
+
+func TestHTTPService_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := createTestCertificate(t, dir, "ca", nil, nil)
+	createTestCertificate(t, dir, "server", ca, caKey)
+	client, clientKey := createTestCertificate(t, dir, "client", ca, caKey)
+
+	s, err := NewHTTPService(createTestController(t), HTTPConfig{
+		Address: "127.0.0.1:0",
+		TLS: &HTTPTLSConfig{
+			CertFile:     filepath.Join(dir, "server.crt"),
+			KeyFile:      filepath.Join(dir, "server.key"),
+			ClientCAFile: filepath.Join(dir, "ca.crt"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewHTTPService() error = %v", err)
+	}
+	server := httptest.NewUnstartedServer(s.Handler())
+	server.TLS = s.tlsConfig
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	get := func(path string, certs []tls.Certificate) int {
+		t.Helper()
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+		resp, err := httpClient.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := get("/healthz", nil); status != http.StatusOK {
+		t.Errorf("/healthz without client certificate status = %d", status)
+	}
+	if status := get("/metrics", nil); status != http.StatusUnauthorized {
+		t.Errorf("/metrics without client certificate status = %d, want 401", status)
+	}
+	clientCert := tls.Certificate{Certificate: [][]byte{client.Raw}, PrivateKey: clientKey}
+	if status := get("/metrics", []tls.Certificate{clientCert}); status != http.StatusOK {
+		t.Errorf("/metrics with client certificate status = %d", status)
+	}
+}
+
+func TestHTTPService_AuthenticateRateLimit(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := createTestCertificate(t, dir, "ca", nil, nil)
+	createTestCertificate(t, dir, "server", ca, caKey)
+
+	limiter, _ := newTestRateLimiter(t, RateLimit{PerSecond: 1, Burst: 3}, RateLimit{PerSecond: 1, Burst: 1})
+	s, err := NewHTTPService(createTestController(t), HTTPConfig{
+		Address:      "127.0.0.1:0",
+		TokenFile:    writeHTTPToken(t, "s3cret"),
+		TLS:          &HTTPTLSConfig{CertFile: filepath.Join(dir, "server.crt"), KeyFile: filepath.Join(dir, "server.key")},
+		Authenticate: true,
+	}, WithHTTPLogger(&testLogger{}), WithHTTPRateLimiter(limiter))
+	if err != nil {
+		t.Fatalf("NewHTTPService() error = %v", err)
+	}
+	do := func(token string) int {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, httptest.NewRequest("POST", "/v1/authenticate", strings.NewReader(token)))
+		return rec.Code
+	}
+
+	valid := `{"account":"test-account","token":"alice:secret123"}`
+	wrong := `{"account":"test-account","token":"alice:wrong"}`
+	if code := do(valid); code != http.StatusOK {
+		t.Fatalf("first request status = %d, want 200", code)
+	}
+	if code := do(valid); code != http.StatusTooManyRequests {
+		t.Errorf("second request of alice status = %d, want 429 (user limit)", code)
+	}
+	if code := do(wrong); code != http.StatusUnauthorized {
+		t.Errorf("wrong password status = %d, want 401", code)
+	}
+	// The account burst is exhausted, so guesses are rejected before
+	// authentication.
+	if code := do(wrong); code != http.StatusTooManyRequests {
+		t.Errorf("guess beyond account burst status = %d, want 429", code)
+	}
+
+	want := RateLimitStats{Account: "test-account", AccountThrottled: 1, UserThrottled: 1}
+	if stats := limiter.Stats(); len(stats) != 1 || stats[0] != want {
+		t.Errorf("Stats() = %+v, want [%+v]", stats, want)
+	}
+}
+
+func TestHTTPService_Authenticate(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := createTestCertificate(t, dir, "ca", nil, nil)
+	createTestCertificate(t, dir, "server", ca, caKey)
+
+	s, err := NewHTTPService(createTestController(t), HTTPConfig{
+		Address:        "127.0.0.1:0",
+		TokenFile:      writeHTTPToken(t, "s3cret"),
+		TLS:            &HTTPTLSConfig{CertFile: filepath.Join(dir, "server.crt"), KeyFile: filepath.Join(dir, "server.key")},
+		Authenticate:   true,
+		AllowedOrigins: []string{"https://app.example.com"},
+	}, WithHTTPLogger(&testLogger{}), WithHTTPDefaultTTL(time.Hour))
+	if err != nil {
+		t.Fatalf("NewHTTPService() error = %v", err)
+	}
+
+	token := `{"account":"test-account","token":"alice:secret123"}`
+	do := func(method, target, origin, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("generated key", func(t *testing.T) {
+		rec := do("POST", "/v1/authenticate?ttl=15m", "https://app.example.com", token)
+		var resp authrpc.AuthenticateResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decoding response: %v", err)
+		}
+		if rec.Code != http.StatusOK || resp.JWT == "" || resp.Seed == "" || resp.Creds == "" || resp.Account != "test-account" {
+			t.Fatalf("status = %d, response = %+v", rec.Code, resp)
+		}
+		if resp.ExpiresAt == nil || time.Until(*resp.ExpiresAt) > 15*time.Minute {
+			t.Errorf("ExpiresAt = %v, want within 15m", resp.ExpiresAt)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+			t.Errorf("Access-Control-Allow-Origin = %q", got)
+		}
+		if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+			t.Errorf("Cache-Control = %q, want no-store", got)
+		}
+	})
+
+	t.Run("provided key", func(t *testing.T) {
+		kp, _ := nkeys.CreateUser()
+		pub, _ := kp.PublicKey()
+		rec := do("POST", "/v1/authenticate?userPublicKey="+pub, "", token)
+		var resp authrpc.AuthenticateResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decoding response: %v", err)
+		}
+		if rec.Code != http.StatusOK || resp.UserPublicKey != pub || resp.Seed != "" {
+			t.Errorf("status = %d, response = %+v", rec.Code, resp)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		if rec := do("POST", "/v1/authenticate", "", `{"account":"test-account","token":"alice:wrong"}`); rec.Code != http.StatusUnauthorized {
+			t.Errorf("wrong password status = %d, want 401", rec.Code)
+		}
+		if rec := do("POST", "/v1/authenticate?ttl=soon", "", token); rec.Code != http.StatusBadRequest {
+			t.Errorf("invalid ttl status = %d, want 400", rec.Code)
+		}
+	})
+
+	t.Run("cors", func(t *testing.T) {
+		rec := do("OPTIONS", "/v1/authenticate", "https://app.example.com", "")
+		if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Methods") == "" {
+			t.Errorf("preflight status = %d, headers = %v", rec.Code, rec.Header())
+		}
+		if rec := do("OPTIONS", "/v1/authenticate", "https://evil.example.com", ""); rec.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("unlisted origin allowed: %v", rec.Header())
+		}
+	})
+}
+
+// createTestCertificate writes <name>.crt and <name>.key to dir. Without a
+// parent, it creates a self-signed CA.
+func createTestCertificate(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
@@ -0,0 +1,584 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/policy"
+	"github.com/msimon/nauts/provider"
+)
+
+// AccountManifest describes everything needed to onboard an account in a single document:
+// account keys, policies, default policies, role bindings, and authentication provider assignments.
+type AccountManifest struct {
+	// Account is the NATS account name.
+	Account string `json:"account"`
+
+	// Keys references the account keys. Required in operator mode when the account is new.
+	Keys *AccountManifestKeys `json:"keys,omitempty"`
+
+	// Policies are the account-local policies. An empty policy account defaults to Account.
+	Policies []*policy.Policy `json:"policies,omitempty"`
+
+	// DefaultPolicies are attached to the implicit default role of the account.
+	DefaultPolicies []string `json:"defaultPolicies,omitempty"`
+
+	// Bindings attach policies to roles of the account.
+	Bindings []AccountManifestBinding `json:"bindings,omitempty"`
+
+	// Providers are the ids of the authentication providers allowed to manage the account.
+	Providers []string `json:"providers,omitempty"`
+}
+
+// AccountManifestKeys references the keys of an account.
+type AccountManifestKeys struct {
+	// PublicKey is the account's public key (starts with 'A').
+	PublicKey string `json:"publicKey,omitempty"`
+
+	// SigningKeyPath is the path to the account signing key file (operator mode).
+	SigningKeyPath string `json:"signingKeyPath,omitempty"`
+}
+
+// AccountManifestBinding attaches policies to a role within the manifest's account.
+type AccountManifestBinding struct {
+	Role     string   `json:"role"`
+	Policies []string `json:"policies"`
+	TTL      string   `json:"ttl,omitempty"`
+	MaxTTL   string   `json:"maxTTL,omitempty"`
+}
+
+// ApplyManifestOptions controls how an account manifest is applied.
+type ApplyManifestOptions struct {
+	// DryRun computes and returns the changes without writing anything.
+	DryRun bool
+
+	// Prune removes policies and bindings of the account that are not part of the manifest.
+	Prune bool
+}
+
+// ApplyManifestResult lists the changes made (or planned, in dry-run mode) by ApplyAccountManifest.
+type ApplyManifestResult struct {
+	Changes []string `json:"changes"`
+}
+
+// LoadAccountManifest reads an account manifest from a YAML or JSON file.
+func LoadAccountManifest(path string) (*AccountManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest file: %w", err)
+	}
+
+	var m AccountManifest
+	if err := unmarshalYAMLOrJSON(path, data, &m); err != nil {
+		return nil, fmt.Errorf("parsing manifest file: %w", err)
+	}
+	return &m, nil
+}
+
+// Validate checks that the manifest is self-consistent.
+func (m *AccountManifest) Validate() error {
+	if strings.TrimSpace(m.Account) == "" {
+		return errors.New("manifest account is required")
+	}
+	if strings.ContainsAny(m.Account, "*>.") {
+		return fmt.Errorf("manifest account %q must not contain wildcards or dots", m.Account)
+	}
+
+	policyIDs := make(map[string]struct{}, len(m.Policies))
+	for i, p := range m.Policies {
+		if p == nil {
+			return fmt.Errorf("policies[%d] is empty", i)
+		}
+		if p.Account == "" {
+			p.Account = m.Account
+		}
+		if p.Account != m.Account {
+			return fmt.Errorf("policies[%d] (%s) belongs to account %q, expected %q", i, p.ID, p.Account, m.Account)
+		}
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("policies[%d]: %w", i, err)
+		}
+		if _, ok := policyIDs[p.ID]; ok {
+			return fmt.Errorf("policies contain duplicate id: %s", p.ID)
+		}
+		policyIDs[p.ID] = struct{}{}
+	}
+
+	checkRefs := func(field string, refs []string) error {
+		for _, id := range refs {
+			if strings.HasPrefix(id, "_global:") {
+				continue
+			}
+			if policy.IsBuiltinID(id) {
+				if _, err := policy.Builtin(id); err != nil {
+					return fmt.Errorf("%s: %w", field, err)
+				}
+				continue
+			}
+			if _, ok := policyIDs[id]; !ok {
+				return fmt.Errorf("%s references unknown policy %q (use the _global: prefix for global policies)", field, id)
+			}
+		}
+		return nil
+	}
+
+	if err := checkRefs("defaultPolicies", m.DefaultPolicies); err != nil {
+		return err
+	}
+
+	roles := make(map[string]struct{}, len(m.Bindings))
+	for i, b := range m.Bindings {
+		if strings.TrimSpace(b.Role) == "" {
+			return fmt.Errorf("bindings[%d].role is required", i)
+		}
+		if b.Role == DefaultRoleName && len(m.DefaultPolicies) > 0 {
+			return fmt.Errorf("bindings[%d]: role %q conflicts with defaultPolicies", i, DefaultRoleName)
+		}
+		if _, ok := roles[b.Role]; ok {
+			return fmt.Errorf("bindings contain duplicate role: %s", b.Role)
+		}
+		roles[b.Role] = struct{}{}
+		if err := checkRefs(fmt.Sprintf("bindings[%s]", b.Role), b.Policies); err != nil {
+			return err
+		}
+		if _, err := policy.ParseMaxTTL(b.TTL); err != nil {
+			return fmt.Errorf("bindings[%s].ttl: %w", b.Role, err)
+		}
+		if _, err := policy.ParseMaxTTL(b.MaxTTL); err != nil {
+			return fmt.Errorf("bindings[%s].maxTTL: %w", b.Role, err)
+		}
+	}
+
+	return nil
+}
+
+// bindings returns the manifest bindings as provider bindings, including the default role.
+func (m *AccountManifest) bindings() []*provider.Binding {
+	result := make([]*provider.Binding, 0, len(m.Bindings)+1)
+	if len(m.DefaultPolicies) > 0 {
+		result = append(result, &provider.Binding{
+			Role:     DefaultRoleName,
+			Account:  m.Account,
+			Policies: append([]string(nil), m.DefaultPolicies...),
+		})
+	}
+	for _, b := range m.Bindings {
+		result = append(result, &provider.Binding{
+			Role:     b.Role,
+			Account:  m.Account,
+			Policies: append([]string(nil), b.Policies...),
+			TTL:      b.TTL,
+			MaxTTL:   b.MaxTTL,
+		})
+	}
+	return result
+}
+
+// applyToConfig registers the manifest account with the account provider and the
+// assigned authentication providers. It returns the list of changes made to config.
+func (m *AccountManifest) applyToConfig(config *Config) ([]string, error) {
+	var changes []string
+
+	switch config.Account.Type {
+	case "operator":
+		if config.Account.Operator == nil {
+			return nil, errors.New("account.operator configuration is missing")
+		}
+		existing, exists := config.Account.Operator.Accounts[m.Account]
+		if m.Keys == nil {
+			if !exists {
+				return nil, fmt.Errorf("manifest keys are required to add account %q in operator mode", m.Account)
+			}
+			break
+		}
+		if m.Keys.PublicKey == "" || m.Keys.SigningKeyPath == "" {
+			return nil, errors.New("manifest keys.publicKey and keys.signingKeyPath are required in operator mode")
+		}
+		updated := provider.AccountSigningConfig{PublicKey: m.Keys.PublicKey, SigningKeyPath: m.Keys.SigningKeyPath}
+		if exists && existing == updated {
+			break
+		}
+		if config.Account.Operator.Accounts == nil {
+			config.Account.Operator.Accounts = make(map[string]provider.AccountSigningConfig)
+		}
+		config.Account.Operator.Accounts[m.Account] = updated
+		changes = append(changes, fmt.Sprintf("set account %s signing configuration", m.Account))
+	case "static":
+		if config.Account.Static == nil {
+			return nil, errors.New("account.static configuration is missing")
+		}
+		if m.Keys != nil && m.Keys.SigningKeyPath != "" {
+			return nil, errors.New("manifest keys.signingKeyPath is not supported in static mode")
+		}
+		if m.Keys != nil && m.Keys.PublicKey != "" && !staticAccountHasKey(config.Account.Static, m.Keys.PublicKey) {
+			return nil, errors.New("manifest keys.publicKey does not match account.static.publicKey or signingKeys")
+		}
+		if !containsString(config.Account.Static.Accounts, m.Account) {
+			config.Account.Static.Accounts = append(config.Account.Static.Accounts, m.Account)
+			changes = append(changes, fmt.Sprintf("add account %s to static account provider", m.Account))
+		}
+	case "vault":
+		return nil, errors.New("accounts of the vault account provider are managed in Vault, not in the configuration")
+	default:
+		return nil, fmt.Errorf("unsupported account provider type: %s", config.Account.Type)
+	}
+
+	for _, id := range m.Providers {
+		accounts := config.authProviderAccounts(id)
+		if accounts == nil {
+			return nil, fmt.Errorf("manifest references unknown authentication provider %q", id)
+		}
+		if !containsString(*accounts, m.Account) {
+			*accounts = append(*accounts, m.Account)
+			changes = append(changes, fmt.Sprintf("add account %s to authentication provider %s", m.Account, id))
+		}
+	}
+
+	return changes, nil
+}
+
+// authProviderAccounts returns a pointer to the account list of the authentication
+// provider with the given id, or nil if no such provider is configured.
+func (c *Config) authProviderAccounts(id string) *[]string {
+	for i := range c.Auth.File {
+		if c.Auth.File[i].ID == id {
+			return &c.Auth.File[i].Accounts
+		}
+	}
+	for i := range c.Auth.JWT {
+		if c.Auth.JWT[i].ID == id {
+			return &c.Auth.JWT[i].Accounts
+		}
+	}
+	for i := range c.Auth.Aws {
+		if c.Auth.Aws[i].ID == id {
+			return &c.Auth.Aws[i].Accounts
+		}
+	}
+	for i := range c.Auth.Gcp {
+		if c.Auth.Gcp[i].ID == id {
+			return &c.Auth.Gcp[i].Accounts
+		}
+	}
+	for i := range c.Auth.Azure {
+		if c.Auth.Azure[i].ID == id {
+			return &c.Auth.Azure[i].Accounts
+		}
+	}
+	for i := range c.Auth.Kubernetes {
+		if c.Auth.Kubernetes[i].ID == id {
+			return &c.Auth.Kubernetes[i].Accounts
+		}
+	}
+	for i := range c.Auth.Nkey {
+		if c.Auth.Nkey[i].ID == id {
+			return &c.Auth.Nkey[i].Accounts
+		}
+	}
+	for i := range c.Auth.Custom {
+		if c.Auth.Custom[i].ID == id {
+			return &c.Auth.Custom[i].Accounts
+		}
+	}
+	return nil
+}
+
+// effectiveConfig returns a validated copy of config as LoadConfig would
+// return it, with references resolved and environment overrides applied.
+// config itself keeps its references, so that it can be saved without
+// writing secrets into the file. Defaults set by Validate are kept in both.
+func effectiveConfig(config *Config) (*Config, error) {
+	effective, err := config.clone()
+	if err != nil {
+		return nil, err
+	}
+	if err := effective.ResolveReferences(os.LookupEnv); err != nil {
+		return nil, fmt.Errorf("resolving config file references: %w", err)
+	}
+	effective.ApplyEnvOverrides(os.LookupEnv)
+	if err := effective.Validate(); err != nil {
+		return nil, err
+	}
+	config.Account.Type = effective.Account.Type
+	config.Policy.Type = effective.Policy.Type
+	return effective, nil
+}
+
+// ApplyAccountManifest configures the account provider, the authentication providers,
+// and the policy store for the manifest's account.
+//
+// The manifest and the resulting configuration are validated before anything is written.
+// Policy store writes are journaled: if a later write (including saving the configuration
+// file) fails, previously applied policy store changes are rolled back.
+func ApplyAccountManifest(ctx context.Context, configPath string, m *AccountManifest, opts ApplyManifestOptions) (*ApplyManifestResult, error) {
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	// The configuration is written back, so references and environment
+	// overrides are only applied to the copy that is validated and used to
+	// open the policy store.
+	config, err := readConfigFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := effectiveConfig(config); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	configChanges, err := m.applyToConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	effective, err := effectiveConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration after applying manifest: %w", err)
+	}
+
+	store, err := newPolicyStore(effective.Policy)
+	if err != nil {
+		return nil, err
+	}
+	defer StopPolicyStore(store)
+
+	plan, err := planManifestStoreChanges(ctx, store, m, opts.Prune)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ApplyManifestResult{Changes: append(configChanges, plan.descriptions()...)}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	journal := &storeJournal{store: store}
+	if err := journal.apply(ctx, plan); err != nil {
+		if rbErr := journal.rollback(ctx); rbErr != nil {
+			return nil, fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return nil, err
+	}
+
+	if len(configChanges) > 0 {
+		if err := SaveConfig(configPath, config); err != nil {
+			if rbErr := journal.rollback(ctx); rbErr != nil {
+				return nil, fmt.Errorf("saving configuration: %w (rollback failed: %v)", err, rbErr)
+			}
+			return nil, fmt.Errorf("saving configuration: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// storeChange is a single write against a policy store.
+type storeChange struct {
+	policy        *policy.Policy    // policy to put
+	binding       *provider.Binding // binding to put
+	deletePolicy  string            // policy id to delete
+	deleteBinding string            // role to delete
+	account       string
+}
+
+func (c storeChange) String() string {
+	switch {
+	case c.policy != nil:
+		return fmt.Sprintf("put policy %s.%s", c.account, c.policy.ID)
+	case c.binding != nil:
+		return fmt.Sprintf("put binding %s.%s", c.account, c.binding.Role)
+	case c.deletePolicy != "":
+		return fmt.Sprintf("delete policy %s.%s", c.account, c.deletePolicy)
+	default:
+		return fmt.Sprintf("delete binding %s.%s", c.account, c.deleteBinding)
+	}
+}
+
+type storePlan []storeChange
+
+func (p storePlan) descriptions() []string {
+	out := make([]string, 0, len(p))
+	for _, c := range p {
+		out = append(out, c.String())
+	}
+	return out
+}
+
+// planManifestStoreChanges computes the policy store writes needed to converge
+// the store to the manifest. Unchanged entries are skipped.
+func planManifestStoreChanges(ctx context.Context, store provider.PolicyStore, m *AccountManifest, prune bool) (storePlan, error) {
+	var plan storePlan
+
+	wanted := make(map[string]struct{}, len(m.Policies))
+	for _, p := range m.Policies {
+		wanted[p.ID] = struct{}{}
+		existing, err := store.GetPolicy(ctx, m.Account, p.ID)
+		switch {
+		case errors.Is(err, provider.ErrPolicyNotFound):
+		case err != nil:
+			return nil, fmt.Errorf("reading policy %s: %w", p.ID, err)
+		case existing.Account != m.Account:
+			return nil, fmt.Errorf("policy id %q is already used by account %q", p.ID, existing.Account)
+		case jsonEqual(existing, p):
+			continue
+		}
+		plan = append(plan, storeChange{account: m.Account, policy: p})
+	}
+
+	wantedRoles := make(map[string]struct{}, len(m.Bindings)+1)
+	for _, b := range m.bindings() {
+		wantedRoles[b.Role] = struct{}{}
+		existing, err := store.GetBinding(ctx, b.IdentityRole())
+		switch {
+		case errors.Is(err, provider.ErrRoleNotFound):
+		case err != nil:
+			return nil, fmt.Errorf("reading binding %s: %w", b.Role, err)
+		case jsonEqual(existing, b):
+			continue
+		}
+		plan = append(plan, storeChange{account: m.Account, binding: b})
+	}
+
+	if !prune {
+		return plan, nil
+	}
+
+	policies, err := store.GetPolicies(ctx, m.Account)
+	if err != nil {
+		return nil, fmt.Errorf("listing policies: %w", err)
+	}
+	for _, p := range policies {
+		if p.Account != m.Account {
+			continue
+		}
+		if _, ok := wanted[p.ID]; !ok {
+			plan = append(plan, storeChange{account: m.Account, deletePolicy: p.ID})
+		}
+	}
+
+	bindings, err := store.GetBindings(ctx, m.Account)
+	if err != nil {
+		return nil, fmt.Errorf("listing bindings: %w", err)
+	}
+	for _, b := range bindings {
+		if _, ok := wantedRoles[b.Role]; !ok {
+			plan = append(plan, storeChange{account: m.Account, deleteBinding: b.Role})
+		}
+	}
+
+	return plan, nil
+}
+
+// storeJournal applies store changes and remembers how to undo them.
+type storeJournal struct {
+	store provider.PolicyStore
+	undo  []func(ctx context.Context) error
+}
+
+func (j *storeJournal) apply(ctx context.Context, plan storePlan) error {
+	for _, c := range plan {
+		if err := j.applyOne(ctx, c); err != nil {
+			return fmt.Errorf("%s: %w", c, err)
+		}
+	}
+	return nil
+}
+
+func (j *storeJournal) applyOne(ctx context.Context, c storeChange) error {
+	switch {
+	case c.policy != nil || c.deletePolicy != "":
+		id := c.deletePolicy
+		if c.policy != nil {
+			id = c.policy.ID
+		}
+		previous, err := j.store.GetPolicy(ctx, c.account, id)
+		if err != nil && !errors.Is(err, provider.ErrPolicyNotFound) {
+			return err
+		}
+		if c.policy != nil {
+			err = j.store.PutPolicy(ctx, c.policy)
+		} else {
+			err = j.store.DeletePolicy(ctx, c.account, id)
+		}
+		if err != nil {
+			return err
+		}
+		j.undo = append(j.undo, func(ctx context.Context) error {
+			if previous == nil {
+				return j.store.DeletePolicy(ctx, c.account, id)
+			}
+			return j.store.PutPolicy(ctx, previous)
+		})
+	default:
+		role := identity.Role{Account: c.account, Name: c.deleteBinding}
+		if c.binding != nil {
+			role = c.binding.IdentityRole()
+		}
+		previous, err := j.store.GetBinding(ctx, role)
+		if err != nil && !errors.Is(err, provider.ErrRoleNotFound) {
+			return err
+		}
+		if c.binding != nil {
+			err = j.store.PutBinding(ctx, c.binding)
+		} else {
+			err = j.store.DeleteBinding(ctx, role)
+		}
+		if err != nil {
+			return err
+		}
+		j.undo = append(j.undo, func(ctx context.Context) error {
+			if previous == nil {
+				return j.store.DeleteBinding(ctx, role)
+			}
+			return j.store.PutBinding(ctx, previous)
+		})
+	}
+	return nil
+}
+
+// rollback undoes all applied changes in reverse order.
+func (j *storeJournal) rollback(ctx context.Context) error {
+	var errs []error
+	for i := len(j.undo) - 1; i >= 0; i-- {
+		if err := j.undo[i](ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	j.undo = nil
+	return errors.Join(errs...)
+}
+
+// jsonEqual reports whether a and b have the same JSON encoding.
+func jsonEqual(a, b any) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
+
+// containsString checks if a string slice contains a specific value.
+func containsString(slice []string, value string) bool {
+	for _, item := range slice {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// staticAccountHasKey reports whether publicKey is the key of a static
+// account provider or one of its signing keys.
+func staticAccountHasKey(cfg *provider.StaticAccountProviderConfig, publicKey string) bool {
+	if cfg.PublicKey == publicKey {
+		return true
+	}
+	for _, k := range cfg.SigningKeys {
+		if k.PublicKey == publicKey {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,279 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/provider"
+)
+
+// writeManifestTestConfig writes a static-mode config with a file policy provider
+// and returns the config path.
+func writeManifestTestConfig(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	policiesPath := filepath.Join(dir, "policies.json")
+	bindingsPath := filepath.Join(dir, "bindings.json")
+	if err := os.WriteFile(policiesPath, []byte(`[{"id":"base","account":"APP","name":"base","statements":[{"effect":"allow","actions":["nats.sub"],"resources":["nats:base.>"]}]}]`), 0644); err != nil {
+		t.Fatalf("writing policies: %v", err)
+	}
+	if err := os.WriteFile(bindingsPath, []byte(`[{"account":"APP","role":"admin","policies":["base"]}]`), 0644); err != nil {
+		t.Fatalf("writing bindings: %v", err)
+	}
+
+	config := `{
+		"account": {"type": "static", "static": {"publicKey": "APUB", "privateKeyPath": "key.nk", "accounts": ["APP"]}},
+		"policy": {"type": "file", "file": {"policiesPath": "` + policiesPath + `", "bindingsPath": "` + bindingsPath + `"}},
+		"auth": {"file": [{"id": "local", "accounts": ["APP"], "userPath": "users.json"}]}
+	}`
+	configPath := filepath.Join(dir, "nauts.json")
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+	return configPath
+}
+
+const testManifestYAML = `
+account: TENANT
+policies:
+  - id: tenant-read
+    name: Tenant read
+    statements:
+      - effect: allow
+        actions: ["nats.sub"]
+        resources: ["nats:tenant.>"]
+defaultPolicies: [tenant-read]
+bindings:
+  - role: admin
+    policies: [tenant-read, "_global:base"]
+providers: [local]
+`
+
+func writeManifest(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "manifest.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("writing manifest: %v", err)
+	}
+	return path
+}
+
+func TestLoadAccountManifest_YAML(t *testing.T) {
+	m, err := LoadAccountManifest(writeManifest(t, testManifestYAML))
+	if err != nil {
+		t.Fatalf("LoadAccountManifest() error = %v", err)
+	}
+	if m.Account != "TENANT" {
+		t.Errorf("Account = %q, want TENANT", m.Account)
+	}
+	if len(m.Policies) != 1 || m.Policies[0].ID != "tenant-read" || len(m.Policies[0].Statements) != 1 {
+		t.Errorf("Policies = %+v, want one tenant-read policy", m.Policies)
+	}
+	if len(m.Bindings) != 1 || m.Bindings[0].Role != "admin" {
+		t.Errorf("Bindings = %+v, want admin binding", m.Bindings)
+	}
+	if err := m.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+	if m.Policies[0].Account != "TENANT" {
+		t.Errorf("policy account = %q, want defaulted to TENANT", m.Policies[0].Account)
+	}
+}
+
+func TestAccountManifest_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{"missing account", "policies: []", "account is required"},
+		{"wildcard account", "account: 'T*'", "wildcards"},
+		{"foreign policy", "account: T\npolicies:\n  - {id: p, account: OTHER, statements: [{effect: allow, actions: [nats.pub], resources: ['nats:a']}]}", "belongs to account"},
+		{"unknown policy ref", "account: T\nbindings:\n  - {role: admin, policies: [missing]}", "unknown policy"},
+		{"unknown builtin ref", "account: T\nbindings:\n  - {role: admin, policies: ['builtin:kv-reader']}", "unknown built-in policy"},
+		{"duplicate role", "account: T\nbindings:\n  - {role: a, policies: []}\n  - {role: a, policies: []}", "duplicate role"},
+		{"default conflict", "account: T\ndefaultPolicies: ['_global:x']\nbindings:\n  - {role: default, policies: []}", "conflicts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := LoadAccountManifest(writeManifest(t, tt.yaml))
+			if err != nil {
+				t.Fatalf("LoadAccountManifest() error = %v", err)
+			}
+			err = m.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyAccountManifest(t *testing.T) {
+	configPath := writeManifestTestConfig(t)
+	m, err := LoadAccountManifest(writeManifest(t, testManifestYAML))
+	if err != nil {
+		t.Fatalf("LoadAccountManifest() error = %v", err)
+	}
+
+	result, err := ApplyAccountManifest(context.Background(), configPath, m, ApplyManifestOptions{})
+	if err != nil {
+		t.Fatalf("ApplyAccountManifest() error = %v", err)
+	}
+	if len(result.Changes) != 5 {
+		t.Errorf("Changes = %v, want 5 changes", result.Changes)
+	}
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if !containsString(config.Account.Static.Accounts, "TENANT") {
+		t.Errorf("static accounts = %v, want TENANT added", config.Account.Static.Accounts)
+	}
+	if !containsString(config.Auth.File[0].Accounts, "TENANT") {
+		t.Errorf("auth.file[local].accounts = %v, want TENANT added", config.Auth.File[0].Accounts)
+	}
+
+	store, err := provider.NewFilePolicyProvider(*config.Policy.File)
+	if err != nil {
+		t.Fatalf("NewFilePolicyProvider() error = %v", err)
+	}
+	ctx := context.Background()
+	if _, err := store.GetPolicy(ctx, "TENANT", "tenant-read"); err != nil {
+		t.Errorf("GetPolicy(tenant-read) error = %v", err)
+	}
+	if _, err := store.GetPolicy(ctx, "APP", "base"); err != nil {
+		t.Errorf("existing policy was lost: %v", err)
+	}
+	b, err := store.GetBinding(ctx, identity.Role{Account: "TENANT", Name: DefaultRoleName})
+	if err != nil || len(b.Policies) != 1 || b.Policies[0] != "tenant-read" {
+		t.Errorf("GetBinding(default) = %+v, %v", b, err)
+	}
+
+	// Re-applying the same manifest is a no-op.
+	result, err = ApplyAccountManifest(ctx, configPath, m, ApplyManifestOptions{})
+	if err != nil {
+		t.Fatalf("second ApplyAccountManifest() error = %v", err)
+	}
+	if len(result.Changes) != 0 {
+		t.Errorf("second apply Changes = %v, want none", result.Changes)
+	}
+}
+
+func TestApplyAccountManifest_KeepsEnvOverridesOutOfConfig(t *testing.T) {
+	t.Setenv("NAUTS_AUTH_LOCAL_USER_PATH", "/run/secrets/users.json")
+	configPath := writeManifestTestConfig(t)
+	m, err := LoadAccountManifest(writeManifest(t, testManifestYAML))
+	if err != nil {
+		t.Fatalf("LoadAccountManifest() error = %v", err)
+	}
+
+	if _, err := ApplyAccountManifest(context.Background(), configPath, m, ApplyManifestOptions{}); err != nil {
+		t.Fatalf("ApplyAccountManifest() error = %v", err)
+	}
+
+	config, err := readConfigFile(configPath)
+	if err != nil {
+		t.Fatalf("readConfigFile() error = %v", err)
+	}
+	if config.Auth.File[0].UsersPath != "users.json" {
+		t.Errorf("saved userPath = %q, want the override not to be persisted", config.Auth.File[0].UsersPath)
+	}
+}
+
+func TestApplyAccountManifest_ResolvesReferences(t *testing.T) {
+	configPath := writeManifestTestConfig(t)
+	dir := filepath.Dir(configPath)
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = []byte(strings.ReplaceAll(string(data), dir, "${NAUTS_TEST_POLICY_DIR}"))
+	if err := os.WriteFile(configPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NAUTS_TEST_POLICY_DIR", dir)
+
+	m, err := LoadAccountManifest(writeManifest(t, testManifestYAML))
+	if err != nil {
+		t.Fatalf("LoadAccountManifest() error = %v", err)
+	}
+	if _, err := ApplyAccountManifest(context.Background(), configPath, m, ApplyManifestOptions{}); err != nil {
+		t.Fatalf("ApplyAccountManifest() error = %v", err)
+	}
+
+	policies, err := os.ReadFile(filepath.Join(dir, "policies.json"))
+	if err != nil || !strings.Contains(string(policies), "tenant-read") {
+		t.Errorf("policies file = %s, %v, want the manifest policy", policies, err)
+	}
+	config, err := readConfigFile(configPath)
+	if err != nil {
+		t.Fatalf("readConfigFile() error = %v", err)
+	}
+	if want := "${NAUTS_TEST_POLICY_DIR}/policies.json"; config.Policy.File.PoliciesPath != want {
+		t.Errorf("saved policiesPath = %q, want the reference %q", config.Policy.File.PoliciesPath, want)
+	}
+}
+
+func TestApplyAccountManifest_DryRun(t *testing.T) {
+	configPath := writeManifestTestConfig(t)
+	before, _ := os.ReadFile(configPath)
+
+	m, _ := LoadAccountManifest(writeManifest(t, testManifestYAML))
+	result, err := ApplyAccountManifest(context.Background(), configPath, m, ApplyManifestOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("ApplyAccountManifest() error = %v", err)
+	}
+	if len(result.Changes) == 0 {
+		t.Error("dry run returned no changes")
+	}
+
+	after, _ := os.ReadFile(configPath)
+	if string(before) != string(after) {
+		t.Error("dry run modified the config file")
+	}
+	config, _ := LoadConfig(configPath)
+	data, _ := os.ReadFile(config.Policy.File.PoliciesPath)
+	if strings.Contains(string(data), "tenant-read") {
+		t.Error("dry run modified the policies file")
+	}
+}
+
+func TestApplyAccountManifest_Prune(t *testing.T) {
+	configPath := writeManifestTestConfig(t)
+	m, _ := LoadAccountManifest(writeManifest(t, "account: APP\nbindings:\n  - {role: viewer, policies: ['_global:x']}\n"))
+
+	if _, err := ApplyAccountManifest(context.Background(), configPath, m, ApplyManifestOptions{Prune: true}); err != nil {
+		t.Fatalf("ApplyAccountManifest() error = %v", err)
+	}
+
+	config, _ := LoadConfig(configPath)
+	var bindings []provider.Binding
+	data, _ := os.ReadFile(config.Policy.File.BindingsPath)
+	if err := json.Unmarshal(data, &bindings); err != nil {
+		t.Fatalf("decoding bindings: %v", err)
+	}
+	if len(bindings) != 1 || bindings[0].Role != "viewer" {
+		t.Errorf("bindings = %+v, want only viewer", bindings)
+	}
+	data, _ = os.ReadFile(config.Policy.File.PoliciesPath)
+	if strings.Contains(string(data), `"base"`) {
+		t.Error("prune did not remove policy base")
+	}
+}
+
+func TestApplyAccountManifest_UnknownProvider(t *testing.T) {
+	configPath := writeManifestTestConfig(t)
+	m, _ := LoadAccountManifest(writeManifest(t, "account: TENANT\nproviders: [missing]\n"))
+
+	_, err := ApplyAccountManifest(context.Background(), configPath, m, ApplyManifestOptions{})
+	if err == nil || !strings.Contains(err.Error(), "unknown authentication provider") {
+		t.Errorf("ApplyAccountManifest() error = %v, want unknown provider error", err)
+	}
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+)
+
+// DefaultJWTSizeBuckets are the default histogram bucket upper bounds for
+// encoded user JWT sizes, in bytes.
+var DefaultJWTSizeBuckets = []int{512, 1024, 2048, 4096, 8192, 16384, 32768, 65536}
+
+// JWTSizeMetrics records the encoded sizes of issued user JWTs as a histogram
+// per (account, role). It is safe for concurrent use.
+//
+// JWTSizeMetrics implements expvar.Var, so embedders can publish it with
+// expvar.Publish.
+type JWTSizeMetrics struct {
+	// WarnThreshold, if positive, makes the controller log a warning for every
+	// issued JWT of at least this many bytes.
+	WarnThreshold int
+
+	buckets []int
+
+	mu     sync.Mutex
+	series map[jwtSizeKey]*jwtSizeSeries
+}
+
+type jwtSizeKey struct {
+	account string
+	role    string
+}
+
+type jwtSizeSeries struct {
+	count   uint64
+	sum     uint64
+	max     int
+	buckets []uint64 // non-cumulative; len(buckets) == len(m.buckets)+1 (last is +Inf)
+}
+
+// JWTSizeSeries is a snapshot of the histogram for one (account, role) pair.
+type JWTSizeSeries struct {
+	Account string          `json:"account"`
+	Role    string          `json:"role"`
+	Count   uint64          `json:"count"`
+	Sum     uint64          `json:"sum"`
+	Max     int             `json:"max"`
+	Buckets []JWTSizeBucket `json:"buckets"`
+}
+
+// JWTSizeBucket is a cumulative histogram bucket.
+// UpperBound is 0 for the final (+Inf) bucket.
+type JWTSizeBucket struct {
+	UpperBound int    `json:"le,omitempty"`
+	Count      uint64 `json:"count"`
+}
+
+// NewJWTSizeMetrics creates a JWTSizeMetrics with the given bucket upper bounds
+// in bytes. If no buckets are given, DefaultJWTSizeBuckets is used.
+func NewJWTSizeMetrics(buckets ...int) *JWTSizeMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultJWTSizeBuckets
+	}
+	sorted := append([]int(nil), buckets...)
+	sort.Ints(sorted)
+	return &JWTSizeMetrics{
+		buckets: sorted,
+		series:  make(map[jwtSizeKey]*jwtSizeSeries),
+	}
+}
+
+// Observe records a JWT of size bytes issued for the given account and role.
+func (m *JWTSizeMetrics) Observe(account, role string, size int) {
+	idx := sort.SearchInts(m.buckets, size)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := jwtSizeKey{account: account, role: role}
+	s, ok := m.series[key]
+	if !ok {
+		s = &jwtSizeSeries{buckets: make([]uint64, len(m.buckets)+1)}
+		m.series[key] = s
+	}
+	s.count++
+	s.sum += uint64(size)
+	if size > s.max {
+		s.max = size
+	}
+	s.buckets[idx]++
+}
+
+// Snapshot returns the current histograms, sorted by account and role.
+func (m *JWTSizeMetrics) Snapshot() []JWTSizeSeries {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]JWTSizeSeries, 0, len(m.series))
+	for key, s := range m.series {
+		series := JWTSizeSeries{
+			Account: key.account,
+			Role:    key.role,
+			Count:   s.count,
+			Sum:     s.sum,
+			Max:     s.max,
+			Buckets: make([]JWTSizeBucket, len(s.buckets)),
+		}
+		var cumulative uint64
+		for i, n := range s.buckets {
+			cumulative += n
+			series.Buckets[i].Count = cumulative
+			if i < len(m.buckets) {
+				series.Buckets[i].UpperBound = m.buckets[i]
+			}
+		}
+		result = append(result, series)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Account != result[j].Account {
+			return result[i].Account < result[j].Account
+		}
+		return result[i].Role < result[j].Role
+	})
+	return result
+}
+
+// String returns the snapshot as JSON (implements expvar.Var).
+func (m *JWTSizeMetrics) String() string {
+	data, err := json.Marshal(m.Snapshot())
+	if err != nil {
+		return "[]"
+	}
+	return string(data)
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nkeys"
+
+	"github.com/msimon/nauts/identity"
+)
+
+func TestJWTSizeMetrics_Observe(t *testing.T) {
+	m := NewJWTSizeMetrics(1024, 512)
+
+	m.Observe("APP", "admin", 100)
+	m.Observe("APP", "admin", 512)
+	m.Observe("APP", "admin", 700)
+	m.Observe("APP", "admin", 5000)
+	m.Observe("APP", "default", 300)
+
+	snap := m.Snapshot()
+	if len(snap) != 2 {
+		t.Fatalf("got %d series, want 2", len(snap))
+	}
+
+	admin := snap[0]
+	if admin.Account != "APP" || admin.Role != "admin" {
+		t.Fatalf("first series = %s.%s, want APP.admin", admin.Account, admin.Role)
+	}
+	if admin.Count != 4 || admin.Sum != 6312 || admin.Max != 5000 {
+		t.Errorf("admin count/sum/max = %d/%d/%d, want 4/6312/5000", admin.Count, admin.Sum, admin.Max)
+	}
+	want := []JWTSizeBucket{{UpperBound: 512, Count: 2}, {UpperBound: 1024, Count: 3}, {Count: 4}}
+	if len(admin.Buckets) != len(want) {
+		t.Fatalf("buckets = %v, want %v", admin.Buckets, want)
+	}
+	for i := range want {
+		if admin.Buckets[i] != want[i] {
+			t.Errorf("bucket[%d] = %+v, want %+v", i, admin.Buckets[i], want[i])
+		}
+	}
+
+	var decoded []JWTSizeSeries
+	if err := json.Unmarshal([]byte(m.String()), &decoded); err != nil {
+		t.Fatalf("String() is not valid JSON: %v", err)
+	}
+}
+
+func TestJWTSizeMetrics_Concurrent(t *testing.T) {
+	m := NewJWTSizeMetrics()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				m.Observe("APP", "workers", 2000)
+				_ = m.Snapshot()
+			}
+		}()
+	}
+	wg.Wait()
+
+	snap := m.Snapshot()
+	if len(snap) != 1 || snap[0].Count != 800 {
+		t.Errorf("snapshot = %+v, want one series with 800 observations", snap)
+	}
+}
+
+func TestCreateUserJWT_RecordsSize(t *testing.T) {
+	tmpDir := t.TempDir()
+	metrics := NewJWTSizeMetrics()
+	metrics.WarnThreshold = 1
+	logger := &testLogger{}
+
+	manager, err := identity.NewAuthenticationProviderManager(map[string]identity.AuthenticationProvider{
+		"file": createTestIdentityProvider(t, tmpDir),
+	})
+	if err != nil {
+		t.Fatalf("creating provider manager: %v", err)
+	}
+	ctrl := NewAuthController(
+		createTestAccountProvider(t, tmpDir),
+		createTestPolicyProvider(t, tmpDir),
+		manager,
+		WithLogger(logger),
+		WithJWTSizeMetrics(metrics),
+	)
+
+	userKp, _ := nkeys.CreateUser()
+	userPub, _ := userKp.PublicKey()
+	user := &AccountScopedUser{
+		User:    identity.User{ID: "alice", Roles: []identity.Role{{Account: "test-account", Name: "workers"}}},
+		Account: "test-account",
+	}
+	token, err := ctrl.CreateUserJWT(context.Background(), user, userPub, nil, time.Hour)
+	if err != nil {
+		t.Fatalf("CreateUserJWT() error = %v", err)
+	}
+
+	snap := metrics.Snapshot()
+	if len(snap) != 2 {
+		t.Fatalf("got %d series, want default and workers", len(snap))
+	}
+	for _, s := range snap {
+		if s.Count != 1 || s.Max != len(token) {
+			t.Errorf("series %s.%s = count %d max %d, want 1/%d", s.Account, s.Role, s.Count, s.Max, len(token))
+		}
+	}
+	if len(logger.warnings) != 1 {
+		t.Errorf("warnings = %v, want 1 size warning", logger.warnings)
+	}
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/msimon/nauts/identity"
+)
+
+// nkeyAuth routes nkey connect options to an nkey authentication provider.
+type nkeyAuth struct {
+	provider       string
+	defaultAccount string
+}
+
+// WithNkeyAuthentication lets clients connect with a user nkey instead of a
+// token. Such requests are verified by the authentication provider with id
+// providerID (identity.NkeyAuthenticationProvider), which checks the
+// signature of the connection nonce. The user connect option names the
+// account; otherwise defaultAccount is used, and if it is empty the request
+// is rejected. Requests carrying a token are unaffected.
+func WithNkeyAuthentication(providerID, defaultAccount string) ControllerOption {
+	return func(c *AuthController) {
+		c.nkeyAuth = &nkeyAuth{provider: providerID, defaultAccount: defaultAccount}
+	}
+}
+
+// nkeyAuthRequest returns the auth request of a client that connected with
+// a user nkey. The nonce is added by authenticate.
+func (c *AuthController) nkeyAuthRequest(opts natsjwt.ConnectOptions) (identity.AuthRequest, error) {
+	account := opts.Username
+	if account == "" {
+		account = c.nkeyAuth.defaultAccount
+	}
+	if account == "" {
+		return identity.AuthRequest{}, errors.New("user must name the account for nkey authentication")
+	}
+	if strings.Contains(account, "*") {
+		return identity.AuthRequest{}, errors.New("account must not contain wildcards")
+	}
+	return identity.AuthRequest{
+		Version:     identity.AuthRequestVersion,
+		Account:     account,
+		Token:       opts.Nkey,
+		AP:          c.nkeyAuth.provider,
+		SignedNonce: opts.SignedNonce,
+	}, nil
+}
+
+// newNkeyAuthProvider creates the nkey authentication provider of nc,
+// connecting to NATS for its bucket.
+func newNkeyAuthProvider(config *Config, nc NkeyAuthProviderConfig) (*identity.NkeyAuthenticationProvider, error) {
+	cfg := identity.NkeyAuthenticationProviderConfig{
+		Accounts: nc.Accounts,
+		KeysPath: nc.KeysPath,
+	}
+	if nc.Bucket != "" {
+		conn, err := connectServerNats(config, "nauts-nkeys")
+		if err != nil {
+			return nil, fmt.Errorf("connecting to NATS: %w", err)
+		}
+		js, err := jetstream.New(conn)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("creating jetstream context: %w", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		kv, err := js.KeyValue(ctx, nc.Bucket)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("opening bucket %q: %w", nc.Bucket, err)
+		}
+		cfg.Store = &kvNkeyStore{kv: kv, nc: conn}
+	}
+	p, err := identity.NewNkeyAuthenticationProvider(cfg)
+	if err != nil {
+		if s, ok := cfg.Store.(*kvNkeyStore); ok {
+			s.Stop()
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+// kvNkeyStore looks up nkey identities in a NATS KV bucket keyed by public
+// key.
+type kvNkeyStore struct {
+	kv jetstream.KeyValue
+	nc *nats.Conn
+}
+
+// GetIdentity implements identity.NkeyIdentityStore.
+func (s *kvNkeyStore) GetIdentity(ctx context.Context, publicKey string) (*identity.NkeyIdentity, error) {
+	entry, err := s.kv.Get(ctx, publicKey)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return nil, identity.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading nkey identity: %w", identity.ErrProviderUnavailable, err)
+	}
+	var ident identity.NkeyIdentity
+	if err := json.Unmarshal(entry.Value(), &ident); err != nil {
+		return nil, fmt.Errorf("%w: decoding nkey identity: %w", identity.ErrInvalidCredentials, err)
+	}
+	return &ident, nil
+}
+
+// Stop closes the NATS connection of the store.
+func (s *kvNkeyStore) Stop() error {
+	s.nc.Close()
+	return nil
+}
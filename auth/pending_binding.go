@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/provider"
+)
+
+const (
+	// DefaultPendingBindingBucket is the NATS KV bucket of pending bindings.
+	DefaultPendingBindingBucket = "nauts-pending-bindings"
+
+	// DefaultPendingBindingRetention is how long a binding request waits for
+	// approval before it expires.
+	DefaultPendingBindingRetention = 7 * 24 * time.Hour
+)
+
+var (
+	// ErrPendingBindingNotFound is returned for roles without a pending
+	// binding request, including requests that expired.
+	ErrPendingBindingNotFound = errors.New("pending binding not found")
+
+	// pendingKeyPattern keeps accounts and roles usable as KV key tokens.
+	pendingKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// PendingBinding is a requested binding waiting for approval. Approving it
+// writes Binding to the policy store.
+type PendingBinding struct {
+	Binding *provider.Binding `json:"binding"`
+	// RequestedBy identifies the requester, as given by the requester.
+	RequestedBy string    `json:"requested_by"`
+	Reason      string    `json:"reason,omitempty"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// pendingBindingKV is the subset of jetstream.KeyValue used by PendingBindings.
+type pendingBindingKV interface {
+	Get(ctx context.Context, key string) (jetstream.KeyValueEntry, error)
+	Put(ctx context.Context, key string, value []byte) (uint64, error)
+	Delete(ctx context.Context, key string, opts ...jetstream.KVDeleteOpt) error
+	ListKeysFiltered(ctx context.Context, filters ...string) (jetstream.KeyLister, error)
+}
+
+// PendingBindings keeps binding requests by role in a NATS KV bucket, under
+// the key <account>.<role>. A new request for a role replaces the previous
+// one. Requests expire with the bucket's TTL. It is safe for concurrent use.
+type PendingBindings struct {
+	kv  pendingBindingKV
+	nc  *nats.Conn // closed by Close if owned
+	now func() time.Time
+}
+
+// NewPendingBindings creates pending bindings on an existing bucket.
+func NewPendingBindings(kv jetstream.KeyValue) *PendingBindings {
+	return &PendingBindings{kv: kv, now: time.Now}
+}
+
+// Request records a binding request and returns it with RequestedAt set.
+func (p *PendingBindings) Request(ctx context.Context, b *provider.Binding, requestedBy, reason string) (*PendingBinding, error) {
+	if b == nil {
+		return nil, errors.New("binding is required")
+	}
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	if requestedBy == "" {
+		return nil, errors.New("requester is required")
+	}
+	key, err := pendingBindingKey(b.IdentityRole())
+	if err != nil {
+		return nil, err
+	}
+	pending := &PendingBinding{Binding: b, RequestedBy: requestedBy, Reason: reason, RequestedAt: p.now().UTC()}
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return nil, fmt.Errorf("encoding pending binding: %w", err)
+	}
+	if _, err := p.kv.Put(ctx, key, data); err != nil {
+		return nil, fmt.Errorf("requesting binding %s: %w", b.IdentityRole(), err)
+	}
+	return pending, nil
+}
+
+// Get returns the pending binding of role. Returns an error wrapping
+// ErrPendingBindingNotFound if there is none.
+func (p *PendingBindings) Get(ctx context.Context, role identity.Role) (*PendingBinding, error) {
+	key, err := pendingBindingKey(role)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := p.kv.Get(ctx, key)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrPendingBindingNotFound, role)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading pending binding %s: %w", role, err)
+	}
+	var pending PendingBinding
+	if err := json.Unmarshal(entry.Value(), &pending); err != nil {
+		return nil, fmt.Errorf("decoding pending binding %s: %w", role, err)
+	}
+	if pending.Binding == nil {
+		return nil, fmt.Errorf("decoding pending binding %s: binding is missing", role)
+	}
+	return &pending, nil
+}
+
+// List returns the pending bindings of account, or of all accounts if
+// account is empty, oldest request first.
+func (p *PendingBindings) List(ctx context.Context, account string) ([]*PendingBinding, error) {
+	filter := ">"
+	if account != "" {
+		if !pendingKeyPattern.MatchString(account) {
+			return nil, fmt.Errorf("invalid account %q", account)
+		}
+		filter = account + ".*"
+	}
+	lister, err := p.kv.ListKeysFiltered(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("listing pending bindings: %w", err)
+	}
+	defer lister.Stop()
+
+	var pending []*PendingBinding
+	for key := range lister.Keys() {
+		acc, role, _ := strings.Cut(key, ".")
+		pb, err := p.Get(ctx, identity.Role{Account: acc, Name: role})
+		if errors.Is(err, ErrPendingBindingNotFound) {
+			continue // expired or removed while listing
+		}
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, pb)
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].RequestedAt.Before(pending[j].RequestedAt) })
+	return pending, nil
+}
+
+// Remove deletes the pending binding of role, after it was approved or
+// rejected. Removing a missing request is not an error.
+func (p *PendingBindings) Remove(ctx context.Context, role identity.Role) error {
+	key, err := pendingBindingKey(role)
+	if err != nil {
+		return err
+	}
+	if err := p.kv.Delete(ctx, key); err != nil && !errors.Is(err, jetstream.ErrKeyNotFound) {
+		return fmt.Errorf("removing pending binding %s: %w", role, err)
+	}
+	return nil
+}
+
+// Close closes the NATS connection if the pending bindings own it.
+func (p *PendingBindings) Close() error {
+	if p.nc != nil {
+		p.nc.Close()
+	}
+	return nil
+}
+
+// pendingBindingKey returns the KV key of role's pending binding.
+func pendingBindingKey(role identity.Role) (string, error) {
+	if !pendingKeyPattern.MatchString(role.Account) || !pendingKeyPattern.MatchString(role.Name) {
+		return "", fmt.Errorf("invalid role %q for a pending binding: account and role must only contain letters, digits, '_' and '-'", role)
+	}
+	return role.Account + "." + role.Name, nil
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/provider"
+)
+
+func TestPendingBindings(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	pending := &PendingBindings{kv: newMemKV(), now: func() time.Time { now = now.Add(time.Minute); return now }}
+
+	oncall := &provider.Binding{Role: "oncall", Account: "APP", Policies: []string{"ops"}}
+	if _, err := pending.Request(ctx, oncall, "alice", "incident 42"); err != nil {
+		t.Fatalf("Request() error = %v", err)
+	}
+	if _, err := pending.Request(ctx, &provider.Binding{Role: "reader", Account: "OTHER"}, "bob", ""); err != nil {
+		t.Fatalf("Request() error = %v", err)
+	}
+
+	got, err := pending.Get(ctx, identity.Role{Account: "APP", Name: "oncall"})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.RequestedBy != "alice" || got.Reason != "incident 42" || got.Binding.Policies[0] != "ops" {
+		t.Errorf("Get() = %+v", got)
+	}
+
+	all, err := pending.List(ctx, "")
+	if err != nil || len(all) != 2 || all[0].RequestedBy != "alice" {
+		t.Fatalf("List() = %v, %v, want alice's request first", all, err)
+	}
+	app, err := pending.List(ctx, "APP")
+	if err != nil || len(app) != 1 {
+		t.Fatalf("List(APP) = %v, %v", app, err)
+	}
+
+	if err := pending.Remove(ctx, identity.Role{Account: "APP", Name: "oncall"}); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, err := pending.Get(ctx, identity.Role{Account: "APP", Name: "oncall"}); !errors.Is(err, ErrPendingBindingNotFound) {
+		t.Errorf("Get() after Remove error = %v, want ErrPendingBindingNotFound", err)
+	}
+
+	invalid := []struct {
+		name    string
+		binding *provider.Binding
+		by      string
+	}{
+		{"missing binding", nil, "alice"},
+		{"missing requester", oncall, ""},
+		{"invalid binding", &provider.Binding{Account: "APP"}, "alice"},
+		{"role not a key token", &provider.Binding{Role: "on.call", Account: "APP"}, "alice"},
+	}
+	for _, tt := range invalid {
+		if _, err := pending.Request(ctx, tt.binding, tt.by, ""); err == nil {
+			t.Errorf("Request(%s) succeeded", tt.name)
+		}
+	}
+}
+
+func TestAdminService_PendingBindings(t *testing.T) {
+	s := newTestAdminService(t)
+	s.pending = &PendingBindings{kv: newMemKV(), now: time.Now}
+
+	send := func(op string, header nats.Header, req AdminStoreRequest) AdminStoreResponse {
+		t.Helper()
+		data, err := json.Marshal(req)
+		if err != nil {
+			t.Fatalf("encoding request: %v", err)
+		}
+		return s.servePendingRequest(AdminPendingSubjectPrefix+op, header, data)
+	}
+	admin := nats.Header{AdminTokenHeader: []string{"s3cret"}}
+
+	// Requests need no admin token.
+	binding := &provider.Binding{Role: "oncall", Account: "test-account", Policies: []string{"allow-basic"}}
+	resp := send("request", nil, AdminStoreRequest{Binding: binding, RequestedBy: "alice", Reason: "incident"})
+	if resp.Error != nil || len(resp.Pending) != 1 {
+		t.Fatalf("request = %+v", resp)
+	}
+	resp = send("request", nil, AdminStoreRequest{Binding: &provider.Binding{Role: "typo", Account: "test-account", Policies: []string{"missing"}}, RequestedBy: "alice"})
+	if resp.Error == nil || resp.Error.Code != "invalid_request" {
+		t.Errorf("request with unknown policy error = %+v, want invalid_request", resp.Error)
+	}
+
+	// Everything else does.
+	for _, op := range []string{"list", "approve", "reject"} {
+		if resp := send(op, nil, AdminStoreRequest{Account: "test-account", Role: "oncall"}); resp.Error == nil || resp.Error.Code != "unauthorized" {
+			t.Errorf("%s without token error = %+v, want unauthorized", op, resp.Error)
+		}
+	}
+
+	resp = send("list", admin, AdminStoreRequest{})
+	if resp.Error != nil || len(resp.Pending) != 1 || resp.Pending[0].RequestedBy != "alice" {
+		t.Fatalf("list = %+v", resp)
+	}
+
+	resp = send("approve", admin, AdminStoreRequest{Account: "test-account", Role: "oncall"})
+	if resp.Error != nil || resp.Binding == nil {
+		t.Fatalf("approve = %+v", resp)
+	}
+	store, _ := s.reloader.Current().PolicyStore()
+	if _, err := store.GetBinding(context.Background(), identity.Role{Account: "test-account", Name: "oncall"}); err != nil {
+		t.Errorf("approved binding not in store: %v", err)
+	}
+	if resp := send("approve", admin, AdminStoreRequest{Account: "test-account", Role: "oncall"}); resp.Error == nil || resp.Error.Code != "not_found" {
+		t.Errorf("second approve error = %+v, want not_found", resp.Error)
+	}
+
+	send("request", nil, AdminStoreRequest{Binding: binding, RequestedBy: "bob"})
+	if resp := send("reject", admin, AdminStoreRequest{Account: "test-account", Role: "oncall", Reason: "not on call"}); resp.Error != nil {
+		t.Fatalf("reject = %+v", resp)
+	}
+	if resp := send("list", admin, AdminStoreRequest{}); len(resp.Pending) != 0 {
+		t.Errorf("list after reject = %+v", resp.Pending)
+	}
+}
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/policy"
+)
+
+// permissionCache caches compiled permissions per (account, role set, policy
+// version), so that authentications of users with the same roles skip the
+// policy provider lookups and the compilation. Role sets whose compilation
+// depends on the user (see policy.Policy.UsesUserContext) or whose bindings
+// expire are remembered as not cacheable.
+//
+// Entries are dropped when the policy provider reports a new version (see
+// provider.PolicyVersioner) and otherwise expire after the TTL.
+type permissionCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	version   uint64
+	entries   map[string]*permissionCacheEntry
+	nextSweep time.Time
+}
+
+type permissionCacheEntry struct {
+	set       *permissionSet // nil if the role set is not cacheable
+	expiresAt time.Time
+}
+
+// permissionSet is the user-independent part of a compilation result.
+type permissionSet struct {
+	raw    *policy.NatsPermissions // compiled without the user inbox
+	roles  map[string]*cachedRole  // by role.String()
+	ttl    time.Duration
+	maxTTL time.Duration
+	limits policy.UserLimits
+	// inbox is the resolved inbox template, granted per user by result.
+	inbox         string
+	inboxWarnings []string
+}
+
+// cachedRole holds the policies and compile warnings of one role.
+type cachedRole struct {
+	policies []*policy.Policy
+	warnings []string
+	notFound bool
+}
+
+func newPermissionCache(ttl time.Duration) *permissionCache {
+	return &permissionCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]*permissionCacheEntry),
+	}
+}
+
+// permissionCacheKey derives the cache key from the account, the sorted role
+// names, and the policy version.
+func permissionCacheKey(account string, roles []identity.Role, version uint64) string {
+	names := make([]string, len(roles))
+	for i, role := range roles {
+		names[i] = role.String()
+	}
+	sort.Strings(names)
+	return account + "\x00" + strings.Join(names, "\x00") + "\x00" + strconv.FormatUint(version, 10)
+}
+
+// get returns the cached set for key and whether key is cached. A nil set
+// means the role set is not cacheable.
+func (c *permissionCache) get(key string, version uint64) (*permissionSet, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if !c.prune(version, now) {
+		return nil, false
+	}
+	e, ok := c.entries[key]
+	if !ok || !now.Before(e.expiresAt) {
+		return nil, false
+	}
+	return e.set, true
+}
+
+// put caches set for key. Sets compiled for an outdated policy version are
+// discarded.
+func (c *permissionCache) put(key string, version uint64, set *permissionSet) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if !c.prune(version, now) {
+		return
+	}
+	c.entries[key] = &permissionCacheEntry{set: set, expiresAt: now.Add(c.ttl)}
+}
+
+// prune drops all entries when version is newer than the cached one, and
+// expired entries at most once per TTL. It reports false if version is
+// outdated. The caller must hold c.mu.
+func (c *permissionCache) prune(version uint64, now time.Time) bool {
+	switch {
+	case version < c.version:
+		return false
+	case version > c.version:
+		c.version = version
+		c.entries = make(map[string]*permissionCacheEntry)
+	}
+	if now.Before(c.nextSweep) {
+		return true
+	}
+	c.nextSweep = now.Add(c.ttl)
+	for k, e := range c.entries {
+		if !now.Before(e.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	return true
+}
+
+// newPermissionSet compiles the policies of roles without a user, i.e.
+// without the user inbox that result adds per user.
+func newPermissionSet(account string, roles []identity.Role, cached map[string]*cachedRole) *permissionSet {
+	raw := policy.NewNatsPermissions()
+	for _, role := range roles {
+		if r := cached[role.String()]; !r.notFound {
+			policy.Compile(r.policies, &policy.PolicyContext{Account: account, Role: role.Name}, raw)
+		}
+	}
+	return &permissionSet{raw: raw, roles: cached}
+}
+
+// result builds the compilation result of the set for user, whose roles are
+// the role set of the cache key in the user's order. policyCtx is the
+// context of user the inbox is resolved with.
+func (s *permissionSet) result(policyCtx *policy.PolicyContext, user *AccountScopedUser, roles []identity.Role) *NautsCompilationResult {
+	raw := s.raw.Clone()
+	warnings := make([]string, 0)
+	policies := make(map[string][]*policy.Policy, len(roles))
+	compiledAny := false
+	for _, role := range roles {
+		r := s.roles[role.String()]
+		if r.notFound {
+			warnings = append(warnings, fmt.Sprintf("role not found: %s (user: %s)", role, user.ID))
+		} else {
+			compiledAny = true
+		}
+		warnings = append(warnings, r.warnings...)
+		policies[role.String()] = r.policies
+	}
+	warnings = append(warnings, s.inboxWarnings...)
+	if compiledAny {
+		// Like compileNatsPermissions, grant the user's inbox once.
+		inboxCtx := policyCtx.Clone()
+		inboxCtx.Inbox = s.inbox
+		if perm, ok, err := policy.InboxPermission(inboxCtx); err != nil {
+			warnings = append(warnings, fmt.Sprintf("inbox skipped (%v, user: %s)", err, user.ID))
+		} else if ok {
+			raw.Allow(perm)
+		}
+	}
+	perms := raw.Clone()
+	perms.Deduplicate()
+
+	return &NautsCompilationResult{
+		User:           user,
+		Permissions:    perms,
+		PermissionsRaw: raw,
+		Warnings:       warnings,
+		Roles:          roles,
+		Policies:       policies,
+		TTL:            s.ttl,
+		MaxTTL:         s.maxTTL,
+		Limits:         s.limits,
+	}
+}
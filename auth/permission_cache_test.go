@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/policy"
+	"github.com/msimon/nauts/provider"
+)
+
+// newPermissionCacheTestController creates controllers with and without a
+// permission cache sharing a file policy provider.
+func newPermissionCacheTestController(t *testing.T, policies string) (cached, uncached *AuthController, store *provider.FilePolicyProvider) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	policiesFile := filepath.Join(tmpDir, "policies.json")
+	bindingsFile := filepath.Join(tmpDir, "bindings.json")
+	bindings := `[
+  {"role": "default", "account": "test-account", "policies": []},
+  {"role": "workers", "account": "test-account", "policies": ["workers"], "maxTTL": "1h"}
+]`
+	if err := os.WriteFile(policiesFile, []byte(policies), 0644); err != nil {
+		t.Fatalf("writing policies file: %v", err)
+	}
+	if err := os.WriteFile(bindingsFile, []byte(bindings), 0644); err != nil {
+		t.Fatalf("writing bindings file: %v", err)
+	}
+	store, err := provider.NewFilePolicyProvider(provider.FilePolicyProviderConfig{
+		PoliciesPath: policiesFile,
+		BindingsPath: bindingsFile,
+	})
+	if err != nil {
+		t.Fatalf("creating policy provider: %v", err)
+	}
+	accounts := createTestAccountProvider(t, tmpDir)
+	manager, err := identity.NewAuthenticationProviderManager(map[string]identity.AuthenticationProvider{
+		"file": createTestIdentityProvider(t, tmpDir),
+	})
+	if err != nil {
+		t.Fatalf("creating provider manager: %v", err)
+	}
+	cached = NewAuthController(accounts, store, manager, WithLogger(&testLogger{}), WithPermissionCache(time.Minute))
+	uncached = NewAuthController(accounts, store, manager, WithLogger(&testLogger{}))
+	return cached, uncached, store
+}
+
+func permissionCacheTestUser(id string) *AccountScopedUser {
+	return &AccountScopedUser{
+		User: identity.User{
+			ID: id,
+			Roles: []identity.Role{
+				{Account: "test-account", Name: "missing"},
+				{Account: "test-account", Name: "workers"},
+			},
+			Attributes: map[string]string{"team": id},
+		},
+		Account: "test-account",
+	}
+}
+
+func assertSameCompilation(t *testing.T, got, want *NautsCompilationResult) {
+	t.Helper()
+	if !reflect.DeepEqual(got.Permissions, want.Permissions) || !reflect.DeepEqual(got.PermissionsRaw, want.PermissionsRaw) {
+		t.Errorf("permissions = %v, want %v", got.Permissions, want.Permissions)
+	}
+	if !reflect.DeepEqual(got.Warnings, want.Warnings) {
+		t.Errorf("warnings = %q, want %q", got.Warnings, want.Warnings)
+	}
+	if !reflect.DeepEqual(got.Roles, want.Roles) || !reflect.DeepEqual(got.Policies, want.Policies) {
+		t.Errorf("roles = %v, policies = %v, want %v, %v", got.Roles, got.Policies, want.Roles, want.Policies)
+	}
+	if got.TTL != want.TTL || got.MaxTTL != want.MaxTTL || got.Limits != want.Limits {
+		t.Errorf("ttl = %v/%v, limits = %+v, want %v/%v, %+v", got.TTL, got.MaxTTL, got.Limits, want.TTL, want.MaxTTL, want.Limits)
+	}
+}
+
+func TestPermissionCache_SharedAcrossUsers(t *testing.T) {
+	cached, uncached, _ := newPermissionCacheTestController(t, `[
+  {"id": "workers", "account": "test-account", "name": "Workers", "limits": {"maxPayload": "1KiB"},
+   "statements": [
+     {"effect": "allow", "actions": ["nats.pub", "nats.sub"], "resources": ["nats:{{ account.id }}.{{ role.id }}.>"]},
+     {"effect": "deny", "actions": ["nats.sub"], "resources": ["nats:_INBOX_bob.>"]}
+   ]}
+]`)
+	ctx := context.Background()
+
+	for _, id := range []string{"alice", "bob", "alice"} {
+		user := permissionCacheTestUser(id)
+		got, err := cached.CompileNatsPermissions(ctx, user)
+		if err != nil {
+			t.Fatalf("CompileNatsPermissions(%s) error = %v", id, err)
+		}
+		want, err := uncached.CompileNatsPermissions(ctx, user)
+		if err != nil {
+			t.Fatalf("CompileNatsPermissions(%s) uncached error = %v", id, err)
+		}
+		assertSameCompilation(t, got, want)
+	}
+	if n := len(cached.permissionCache.entries); n != 1 {
+		t.Errorf("cache entries = %d, want 1", n)
+	}
+	for key, e := range cached.permissionCache.entries {
+		if e.set == nil {
+			t.Errorf("entry %q not cacheable", key)
+		}
+	}
+}
+
+func TestPermissionCache_UserContextNotCached(t *testing.T) {
+	cached, uncached, _ := newPermissionCacheTestController(t, `[
+  {"id": "workers", "account": "test-account", "name": "Workers",
+   "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:teams.{{ user.attr.team }}.>"]}]}
+]`)
+	ctx := context.Background()
+
+	for _, id := range []string{"alice", "bob"} {
+		user := permissionCacheTestUser(id)
+		got, err := cached.CompileNatsPermissions(ctx, user)
+		if err != nil {
+			t.Fatalf("CompileNatsPermissions(%s) error = %v", id, err)
+		}
+		want, _ := uncached.CompileNatsPermissions(ctx, user)
+		assertSameCompilation(t, got, want)
+	}
+	for key, e := range cached.permissionCache.entries {
+		if e.set != nil {
+			t.Errorf("entry %q cached a user-dependent role set", key)
+		}
+	}
+}
+
+func TestPermissionCache_InvalidatedByPolicyChange(t *testing.T) {
+	cached, _, store := newPermissionCacheTestController(t, `[
+  {"id": "workers", "account": "test-account", "name": "Workers",
+   "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:old.>"]}]}
+]`)
+	ctx := context.Background()
+	user := permissionCacheTestUser("alice")
+	if _, err := cached.CompileNatsPermissions(ctx, user); err != nil {
+		t.Fatalf("CompileNatsPermissions() error = %v", err)
+	}
+
+	err := store.PutPolicy(ctx, &policy.Policy{
+		ID: "workers", Account: "test-account", Name: "Workers",
+		Statements: []policy.Statement{{Effect: policy.EffectAllow, Actions: []policy.Action{"nats.pub"}, Resources: []string{"nats:new.>"}}},
+	})
+	if err != nil {
+		t.Fatalf("PutPolicy() error = %v", err)
+	}
+	result, err := cached.CompileNatsPermissions(ctx, user)
+	if err != nil {
+		t.Fatalf("CompileNatsPermissions() error = %v", err)
+	}
+	if pub := result.Permissions.PubList(); len(pub) != 1 || pub[0].Subject != "new.>" {
+		t.Errorf("pub = %v after policy change, want [new.>]", pub)
+	}
+}
+
+func TestPermissionCache_Versions(t *testing.T) {
+	now := time.Unix(1000, 0)
+	c := newPermissionCache(time.Minute)
+	c.now = func() time.Time { return now }
+	set := &permissionSet{}
+
+	c.put("k1", 1, set)
+	if got, ok := c.get("k1", 1); !ok || got != set {
+		t.Fatalf("get(k1) = %v, %v; want cached set", got, ok)
+	}
+	if _, ok := c.get("k1", 2); ok || len(c.entries) != 0 {
+		t.Error("entries of an older version should be dropped")
+	}
+	c.put("k1", 1, set)
+	if len(c.entries) != 0 {
+		t.Error("put of an outdated version should be discarded")
+	}
+
+	c.put("k2", 2, nil)
+	if got, ok := c.get("k2", 2); !ok || got != nil {
+		t.Errorf("get(k2) = %v, %v; want cached nil set", got, ok)
+	}
+	now = now.Add(time.Minute)
+	if _, ok := c.get("k2", 2); ok {
+		t.Error("expired entry should not be returned")
+	}
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/msimon/nauts/identity"
+)
+
+// CustomAuthProviderConfig configures an authentication provider of a type
+// registered with RegisterAuthProviderFactory.
+type CustomAuthProviderConfig struct {
+	ID string `json:"id"`
+
+	// Type is the registered provider type.
+	Type string `json:"type"`
+
+	Accounts []string `json:"accounts"`
+
+	// Config is passed to the factory unchanged. In YAML files it is converted
+	// to JSON like the rest of the configuration.
+	Config json.RawMessage `json:"config,omitempty"`
+
+	// AllowedCidrs restricts the provider to clients from these networks
+	// (e.g., "10.0.0.0/8"). Empty allows all clients.
+	AllowedCidrs []string `json:"allowedCidrs,omitempty"`
+	// RoleMapping maps the groups and roles of verified users to nauts roles.
+	RoleMapping *identity.RoleMappingConfig `json:"roleMapping,omitempty"`
+	// Resilience bounds and retries the provider's verifications, and
+	// overrides server.circuitBreaker for it.
+	Resilience *ProviderResilienceConfig `json:"resilience,omitempty"`
+}
+
+// AuthProviderFactory creates an authentication provider from an auth.custom
+// entry. The provider must manage cfg.Accounts. If it has a Stop() error
+// method, it is called when the controller is stopped (e.g., after a reload).
+type AuthProviderFactory func(cfg CustomAuthProviderConfig) (identity.AuthenticationProvider, error)
+
+// builtinAuthProviderTypes are the types configured in their own auth section.
+var builtinAuthProviderTypes = []string{"file", "jwt", "aws", "gcp", "azure", "kubernetes"}
+
+var (
+	authProviderFactoriesMu sync.RWMutex
+	authProviderFactories   = make(map[string]AuthProviderFactory)
+)
+
+// RegisterAuthProviderFactory makes an authentication provider type available
+// to the auth.custom configuration section, typically from the init function
+// of the package implementing it:
+//
+//	func init() {
+//		auth.RegisterAuthProviderFactory("ldap", newLDAPProvider)
+//	}
+//
+// It panics if typ is empty, names a built-in provider type, or is already
+// registered, or if factory is nil.
+func RegisterAuthProviderFactory(typ string, factory AuthProviderFactory) {
+	authProviderFactoriesMu.Lock()
+	defer authProviderFactoriesMu.Unlock()
+
+	if typ == "" {
+		panic("auth: RegisterAuthProviderFactory with empty type")
+	}
+	if factory == nil {
+		panic("auth: RegisterAuthProviderFactory factory is nil for type " + typ)
+	}
+	for _, builtin := range builtinAuthProviderTypes {
+		if typ == builtin {
+			panic("auth: RegisterAuthProviderFactory for built-in type " + typ)
+		}
+	}
+	if _, dup := authProviderFactories[typ]; dup {
+		panic("auth: RegisterAuthProviderFactory called twice for type " + typ)
+	}
+	authProviderFactories[typ] = factory
+}
+
+// AuthProviderTypes returns the registered custom authentication provider types, sorted.
+func AuthProviderTypes() []string {
+	authProviderFactoriesMu.RLock()
+	defer authProviderFactoriesMu.RUnlock()
+	types := make([]string, 0, len(authProviderFactories))
+	for typ := range authProviderFactories {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// lookupAuthProviderFactory returns the factory registered for typ.
+func lookupAuthProviderFactory(typ string) (AuthProviderFactory, bool) {
+	authProviderFactoriesMu.RLock()
+	defer authProviderFactoriesMu.RUnlock()
+	f, ok := authProviderFactories[typ]
+	return f, ok
+}
+
+// newCustomAuthProvider creates the provider of a validated auth.custom entry.
+func newCustomAuthProvider(cfg CustomAuthProviderConfig) (identity.AuthenticationProvider, error) {
+	factory, ok := lookupAuthProviderFactory(cfg.Type)
+	if !ok {
+		return nil, fmt.Errorf("authentication provider type %q is not registered", cfg.Type)
+	}
+	p, err := factory(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, fmt.Errorf("factory for type %q returned no provider", cfg.Type)
+	}
+	return p, nil
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+
+	"github.com/msimon/nauts/identity"
+)
+
+// tokenAuthProvider maps static tokens to users; it is registered as the
+// custom type "test-token".
+type tokenAuthProvider struct {
+	accounts []string
+	Tokens   map[string]string `json:"tokens"`
+}
+
+func (p *tokenAuthProvider) ManageableAccounts() []string {
+	return p.accounts
+}
+
+func (p *tokenAuthProvider) Verify(_ context.Context, req identity.AuthRequest) (*identity.User, error) {
+	user, ok := p.Tokens[req.Token]
+	if !ok {
+		return nil, identity.ErrInvalidCredentials
+	}
+	return &identity.User{ID: user, Roles: []identity.Role{{Account: req.Account, Name: "developer"}}}, nil
+}
+
+var registerTestProvider sync.Once
+
+func registerTokenAuthProvider() {
+	registerTestProvider.Do(func() {
+		RegisterAuthProviderFactory("test-token", func(cfg CustomAuthProviderConfig) (identity.AuthenticationProvider, error) {
+			p := &tokenAuthProvider{accounts: cfg.Accounts}
+			if err := json.Unmarshal(cfg.Config, p); err != nil {
+				return nil, err
+			}
+			return p, nil
+		})
+	})
+}
+
+func TestRegisterAuthProviderFactory_Panics(t *testing.T) {
+	registerTokenAuthProvider()
+	factory := func(CustomAuthProviderConfig) (identity.AuthenticationProvider, error) { return nil, nil }
+
+	tests := []struct {
+		name    string
+		typ     string
+		factory AuthProviderFactory
+	}{
+		{name: "empty type", typ: "", factory: factory},
+		{name: "nil factory", typ: "other", factory: nil},
+		{name: "built-in type", typ: "jwt", factory: factory},
+		{name: "duplicate", typ: "test-token", factory: factory},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected panic")
+				}
+			}()
+			RegisterAuthProviderFactory(tt.typ, tt.factory)
+		})
+	}
+}
+
+func TestNewAuthControllerWithConfig_CustomProvider(t *testing.T) {
+	registerTokenAuthProvider()
+	env, err := GenerateDevEnvironment(DevEnvironmentConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("GenerateDevEnvironment() error = %v", err)
+	}
+	config, err := LoadConfig(env.ConfigPath)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	config.Auth.File = nil
+	config.Auth.Custom = []CustomAuthProviderConfig{{
+		ID:       "tokens",
+		Type:     "test-token",
+		Accounts: []string{DevAccount},
+		Config:   json.RawMessage(`{"tokens": {"t0k3n": "carol"}}`),
+	}}
+
+	ctrl, err := NewAuthControllerWithConfig(config)
+	if err != nil {
+		t.Fatalf("NewAuthControllerWithConfig() error = %v", err)
+	}
+	result, err := ctrl.Authenticate(context.Background(), natsjwt.ConnectOptions{
+		Token: `{"account":"APP","token":"t0k3n"}`,
+	}, "", time.Hour)
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if result.User.ID != "carol" || result.AuthProviderId != "tokens" {
+		t.Errorf("user = %q via %q, want carol via tokens", result.User.ID, result.AuthProviderId)
+	}
+	if summary := config.Summary(); len(summary.AuthProviders) != 1 || summary.AuthProviders[0].Type != "test-token" {
+		t.Errorf("Summary().AuthProviders = %+v", summary.AuthProviders)
+	}
+
+	config.Auth.Custom[0].Config = json.RawMessage(`{"tokens": 1}`)
+	if _, err := NewAuthControllerWithConfig(config); err == nil || !strings.Contains(err.Error(), `test-token authentication provider "tokens"`) {
+		t.Errorf("NewAuthControllerWithConfig() with invalid provider config error = %v", err)
+	}
+}
+
+func TestConfig_Validate_CustomProvider(t *testing.T) {
+	registerTokenAuthProvider()
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "nauts.yaml")
+	configYAML := `
+account:
+  type: static
+  static:
+    publicKey: AAUTH
+    privateKeyPath: account.nk
+    accounts: [APP]
+policy:
+  type: file
+  file: {policiesPath: policies.json, bindingsPath: bindings.json}
+auth:
+  custom:
+    - id: tokens
+      type: test-token
+      accounts: [APP]
+      config:
+        tokens:
+          t0k3n: carol
+`
+	if err := os.WriteFile(configPath, []byte(configYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if got := string(config.Auth.Custom[0].Config); got != `{"tokens":{"t0k3n":"carol"}}` {
+		t.Errorf("Config = %s", got)
+	}
+
+	config.Auth.Custom[0].Type = "ldap"
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), `provider type "ldap" is not registered`) {
+		t.Errorf("Validate() with unregistered type error = %v", err)
+	}
+	config.Auth.Custom[0].Type = ""
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "auth.custom[tokens].type is required") {
+		t.Errorf("Validate() without type error = %v", err)
+	}
+}
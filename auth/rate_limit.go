@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned for auth requests beyond the rate allowed for
+// their account or user.
+var ErrRateLimited = errors.New("too many authentication requests")
+
+// rateLimitSweepInterval is how often idle buckets are removed.
+const rateLimitSweepInterval = time.Minute
+
+// RateLimit is a token bucket: PerSecond requests are allowed on average,
+// with bursts of up to Burst requests. A zero PerSecond disables the limit.
+type RateLimit struct {
+	PerSecond float64
+	Burst     int
+}
+
+// enabled reports whether the limit applies.
+func (r RateLimit) enabled() bool {
+	return r.PerSecond > 0
+}
+
+// burst returns the bucket capacity, defaulting to one second of requests.
+func (r RateLimit) burst() float64 {
+	if r.Burst > 0 {
+		return float64(r.Burst)
+	}
+	return math.Max(1, math.Ceil(r.PerSecond))
+}
+
+// tokenBucket holds the tokens left for one account or user.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimitStats is a snapshot of the requests a RateLimiter rejected.
+type RateLimitStats struct {
+	Account string `json:"account"`
+	// AccountThrottled counts requests rejected by the account limit.
+	AccountThrottled uint64 `json:"account_throttled"`
+	// UserThrottled counts requests rejected by the per-user limit.
+	UserThrottled uint64 `json:"user_throttled"`
+}
+
+// RateLimiter limits auth requests per account and per user ID within an
+// account, so that a client flooding the callout subject cannot starve the
+// logins of others. It is safe for concurrent use.
+type RateLimiter struct {
+	account RateLimit
+	user    RateLimit
+	now     func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	throttled map[string]*RateLimitStats
+}
+
+// NewRateLimiter creates a rate limiter with the given per-account and
+// per-user limits. Either may be zero to disable it.
+func NewRateLimiter(account, user RateLimit) (*RateLimiter, error) {
+	if account.PerSecond < 0 || user.PerSecond < 0 {
+		return nil, errors.New("rate limits must not be negative")
+	}
+	if account.Burst < 0 || user.Burst < 0 {
+		return nil, errors.New("rate limit bursts must not be negative")
+	}
+	return &RateLimiter{
+		account:   account,
+		user:      user,
+		now:       time.Now,
+		buckets:   make(map[string]*tokenBucket),
+		throttled: make(map[string]*RateLimitStats),
+	}, nil
+}
+
+// AllowAccount takes a token from the bucket of account. It returns an error
+// wrapping ErrRateLimited if the bucket is empty.
+func (l *RateLimiter) AllowAccount(account string) error {
+	if !l.account.enabled() {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.take("a\x00"+account, l.account) {
+		return nil
+	}
+	l.stats(account).AccountThrottled++
+	return fmt.Errorf("%w for account %s", ErrRateLimited, account)
+}
+
+// AllowUser takes a token from the bucket of the user userID in account. It
+// returns an error wrapping ErrRateLimited if the bucket is empty.
+func (l *RateLimiter) AllowUser(account, userID string) error {
+	if !l.user.enabled() {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.take("u\x00"+account+"\x00"+userID, l.user) {
+		return nil
+	}
+	l.stats(account).UserThrottled++
+	return fmt.Errorf("%w for user %s in account %s", ErrRateLimited, userID, account)
+}
+
+// Stats returns the throttled request counters per account, sorted by account.
+func (l *RateLimiter) Stats() []RateLimitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	result := make([]RateLimitStats, 0, len(l.throttled))
+	for _, s := range l.throttled {
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Account < result[j].Account })
+	return result
+}
+
+func (l *RateLimiter) stats(account string) *RateLimitStats {
+	s, ok := l.throttled[account]
+	if !ok {
+		s = &RateLimitStats{Account: account}
+		l.throttled[account] = s
+	}
+	return s
+}
+
+// take refills the bucket for key and takes a token if one is left. The
+// caller must hold l.mu.
+func (l *RateLimiter) take(key string, limit RateLimit) bool {
+	now := l.now()
+	l.sweep(now)
+
+	burst := limit.burst()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	} else if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+elapsed.Seconds()*limit.PerSecond)
+		b.last = now
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sweep removes the buckets that have refilled completely, so that one-off
+// users do not accumulate. The caller must hold l.mu.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		limit := l.account
+		if key[0] == 'u' {
+			limit = l.user
+		}
+		if b.tokens+now.Sub(b.last).Seconds()*limit.PerSecond >= limit.burst() {
+			delete(l.buckets, key)
+		}
+	}
+}
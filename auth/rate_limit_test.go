@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+)
+
+func newTestRateLimiter(t *testing.T, account, user RateLimit) (*RateLimiter, *time.Time) {
+	t.Helper()
+	l, err := NewRateLimiter(account, user)
+	if err != nil {
+		t.Fatalf("NewRateLimiter() error = %v", err)
+	}
+	now := time.Unix(1000, 0)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestRateLimiter_Account(t *testing.T) {
+	l, now := newTestRateLimiter(t, RateLimit{PerSecond: 2, Burst: 3}, RateLimit{})
+
+	for i := 0; i < 3; i++ {
+		if err := l.AllowAccount("APP"); err != nil {
+			t.Fatalf("request %d: AllowAccount() error = %v", i, err)
+		}
+	}
+	if err := l.AllowAccount("APP"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("AllowAccount() after burst = %v, want ErrRateLimited", err)
+	}
+	if err := l.AllowAccount("OTHER"); err != nil {
+		t.Errorf("other account throttled: %v", err)
+	}
+
+	*now = now.Add(500 * time.Millisecond)
+	if err := l.AllowAccount("APP"); err != nil {
+		t.Errorf("AllowAccount() after refill error = %v", err)
+	}
+	if err := l.AllowAccount("APP"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("AllowAccount() = %v, want ErrRateLimited", err)
+	}
+	if err := l.AllowUser("APP", "alice"); err != nil {
+		t.Errorf("AllowUser() with user limit disabled = %v", err)
+	}
+
+	stats := l.Stats()
+	if len(stats) != 1 || stats[0] != (RateLimitStats{Account: "APP", AccountThrottled: 2}) {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+func TestRateLimiter_User(t *testing.T) {
+	l, _ := newTestRateLimiter(t, RateLimit{}, RateLimit{PerSecond: 0.5})
+
+	if err := l.AllowUser("APP", "alice"); err != nil {
+		t.Fatalf("AllowUser() error = %v", err)
+	}
+	if err := l.AllowUser("APP", "alice"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("AllowUser() = %v, want ErrRateLimited (default burst 1)", err)
+	}
+	if err := l.AllowUser("APP", "bob"); err != nil {
+		t.Errorf("other user throttled: %v", err)
+	}
+	if err := l.AllowUser("OTHER", "alice"); err != nil {
+		t.Errorf("same user in other account throttled: %v", err)
+	}
+	if stats := l.Stats(); len(stats) != 1 || stats[0].UserThrottled != 1 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+func TestRateLimiter_SweepsIdleBuckets(t *testing.T) {
+	l, now := newTestRateLimiter(t, RateLimit{PerSecond: 1}, RateLimit{PerSecond: 1})
+	_ = l.AllowAccount("APP")
+	_ = l.AllowUser("APP", "alice")
+
+	*now = now.Add(rateLimitSweepInterval)
+	_ = l.AllowAccount("OTHER")
+	if len(l.buckets) != 1 {
+		t.Errorf("buckets = %d, want only the new one", len(l.buckets))
+	}
+}
+
+func TestNewRateLimiter_Invalid(t *testing.T) {
+	if _, err := NewRateLimiter(RateLimit{PerSecond: -1}, RateLimit{}); err == nil {
+		t.Error("expected error for negative rate")
+	}
+	if _, err := NewRateLimiter(RateLimit{}, RateLimit{PerSecond: 1, Burst: -1}); err == nil {
+		t.Error("expected error for negative burst")
+	}
+}
+
+func TestCalloutService_RateLimit(t *testing.T) {
+	env, err := GenerateDevEnvironment(DevEnvironmentConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("GenerateDevEnvironment() error = %v", err)
+	}
+	config, err := LoadConfig(env.ConfigPath)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	ctrl, err := NewAuthControllerWithConfig(config)
+	if err != nil {
+		t.Fatalf("NewAuthControllerWithConfig() error = %v", err)
+	}
+	svc, err := NewCalloutService(ctrl, CalloutConfig{
+		NatsNkey:         config.Server.NatsNkey,
+		AccountRateLimit: RateLimit{PerSecond: 1, Burst: 3},
+		UserRateLimit:    RateLimit{PerSecond: 1, Burst: 1},
+	}, WithCalloutLogger(&testLogger{}))
+	if err != nil {
+		t.Fatalf("NewCalloutService() error = %v", err)
+	}
+	// A frozen clock, so that no bucket refills while bcrypt runs.
+	now := time.Unix(1000, 0)
+	svc.limiter.now = func() time.Time { return now }
+
+	userKp, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	userPub, _ := userKp.PublicKey()
+
+	authorize := func(user string) *natsjwt.AuthorizationResponseClaims {
+		t.Helper()
+		authReq := natsjwt.NewAuthorizationRequestClaims(userPub)
+		authReq.ConnectOptions.Token = `{"account":"APP","token":"` + user + `:` + DevPassword + `"}`
+		token, _ := svc.authorize(context.Background(), ctrl, authReq, ResponseConfig{UserNkey: userPub, ServerId: "server"})
+		resp, err := natsjwt.DecodeAuthorizationResponseClaims(token)
+		if err != nil {
+			t.Fatalf("decoding response: %v", err)
+		}
+		return resp
+	}
+
+	if resp := authorize("alice"); resp.Error != "" || resp.Jwt == "" {
+		t.Fatalf("first request: error = %q", resp.Error)
+	}
+	if resp := authorize("alice"); resp.Error != "too many requests" {
+		t.Errorf("second request of alice: error = %q, want user throttled", resp.Error)
+	}
+	if resp := authorize("bob"); resp.Error != "" {
+		t.Errorf("bob: error = %q", resp.Error)
+	}
+	// A third user, whose own bucket is full: only the account limit applies.
+	// The account is checked before authentication, so carol need not exist.
+	if resp := authorize("carol"); resp.Error != "too many requests" {
+		t.Errorf("account burst exhausted: error = %q, want account throttled", resp.Error)
+	}
+
+	stats := svc.RateLimitStats()
+	want := RateLimitStats{Account: "APP", AccountThrottled: 1, UserThrottled: 1}
+	if len(stats) != 1 || stats[0] != want {
+		t.Errorf("RateLimitStats() = %+v, want [%+v]", stats, want)
+	}
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nkeys"
+
+	"github.com/msimon/nauts/provider"
+)
+
+// ReadinessCheck is the result of one readiness check.
+type ReadinessCheck struct {
+	Name  string `json:"name"`
+	Ready bool   `json:"ready"`
+	Error string `json:"error,omitempty"`
+}
+
+func readinessCheck(name string, err error) ReadinessCheck {
+	check := ReadinessCheck{Name: name, Ready: err == nil}
+	if err != nil {
+		check.Error = err.Error()
+	}
+	return check
+}
+
+// CheckReadiness checks that the policy provider, and the candidate of a
+// policy canary, can read policies, e.g. that a NATS KV bucket or database
+// is reachable. Policy files are loaded when the controller is built, so they
+// are always ready.
+func (c *AuthController) CheckReadiness(ctx context.Context) []ReadinessCheck {
+	checks := []ReadinessCheck{readinessCheck("policy", checkPolicyProvider(ctx, c.policyProvider))}
+	if c.policyCanary != nil {
+		checks = append(checks, readinessCheck("policy-canary", checkPolicyProvider(ctx, c.policyCanary.provider)))
+	}
+	return checks
+}
+
+func checkPolicyProvider(ctx context.Context, p provider.PolicyProvider) error {
+	if hc, ok := unwrapPolicyProvider(p).(provider.PolicyHealthChecker); ok {
+		return hc.CheckHealth(ctx)
+	}
+	return nil
+}
+
+// CheckReadiness checks everything the service needs to answer auth requests:
+// the NATS connection is up and responds to a ping, the callout subjects are
+// subscribed, the xkey (if configured) can encrypt and decrypt, and the
+// policy providers of the current controller are reachable. Unlike Healthy,
+// a reconnecting connection is not ready.
+func (s *CalloutService) CheckReadiness(ctx context.Context) []ReadinessCheck {
+	checks := []ReadinessCheck{readinessCheck("nats", s.checkNats(ctx))}
+	if s.curveKeyPair != nil {
+		checks = append(checks, readinessCheck("xkey", checkXKey(s.curveKeyPair)))
+	}
+
+	controller, release := s.controllers.acquire()
+	defer release()
+	return append(checks, controller.CheckReadiness(ctx)...)
+}
+
+func (s *CalloutService) checkNats(ctx context.Context) error {
+	s.statsMu.Lock()
+	nc, subscribed := s.nc, len(s.subs) == len(s.config.Subjects)
+	s.statsMu.Unlock()
+
+	if nc == nil || !subscribed {
+		return errors.New("not subscribed to the callout subjects")
+	}
+	if !nc.IsConnected() {
+		return fmt.Errorf("not connected (%s)", nc.Status())
+	}
+	if err := nc.FlushWithContext(ctx); err != nil {
+		return fmt.Errorf("ping: %w", err)
+	}
+	return nil
+}
+
+// checkXKey verifies that kp is a curve key that can decrypt what is
+// encrypted for it.
+func checkXKey(kp nkeys.KeyPair) error {
+	pub, err := kp.PublicKey()
+	if err != nil {
+		return err
+	}
+	if !nkeys.IsValidPublicCurveKey(pub) {
+		return errors.New("not a curve key")
+	}
+	sealed, err := kp.Seal([]byte("nauts"), pub)
+	if err != nil {
+		return fmt.Errorf("encrypting: %w", err)
+	}
+	if _, err := kp.Open(sealed, pub); err != nil {
+		return fmt.Errorf("decrypting: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nkeys"
+)
+
+// unhealthyPolicyProvider is a policy provider whose store is unreachable.
+type unhealthyPolicyProvider struct {
+	stubPolicyProvider
+}
+
+func (p *unhealthyPolicyProvider) CheckHealth(context.Context) error {
+	return p.err
+}
+
+func TestAuthController_CheckReadiness(t *testing.T) {
+	ctx := context.Background()
+
+	ctrl := createTestController(t)
+	if checks := ctrl.CheckReadiness(ctx); len(checks) != 1 || !checks[0].Ready {
+		t.Errorf("CheckReadiness() with policy files = %+v, want ready", checks)
+	}
+
+	// Health checks reach through circuit breakers.
+	unreachable := &unhealthyPolicyProvider{stubPolicyProvider{err: errors.New("bucket unreachable")}}
+	breaker := NewCircuitBreaker("policy-canary", 5, time.Minute)
+	WithPolicyCanary(NewPolicyCanary(NewCircuitBreakingPolicyProvider(unreachable, breaker), 10))(ctrl)
+	checks := ctrl.CheckReadiness(ctx)
+	if len(checks) != 2 || checks[1].Name != "policy-canary" || checks[1].Ready || checks[1].Error != "bucket unreachable" {
+		t.Errorf("CheckReadiness() = %+v, want failing policy-canary check", checks)
+	}
+}
+
+func TestCheckXKey(t *testing.T) {
+	curve, err := nkeys.CreateCurveKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkXKey(curve); err != nil {
+		t.Errorf("checkXKey(curve key) error = %v", err)
+	}
+	account, _ := nkeys.CreateAccount()
+	if err := checkXKey(account); err == nil {
+		t.Error("checkXKey(account key) succeeded, want error")
+	}
+}
+
+func TestHTTPService_ReadinessChecks(t *testing.T) {
+	checks := []ReadinessCheck{{Name: "nats", Ready: true}, {Name: "policy", Ready: true}}
+	s, err := NewHTTPService(createTestController(t), HTTPConfig{Address: ":0", TokenFile: writeHTTPToken(t, "s3cret")},
+		WithHTTPLogger(&testLogger{}),
+		WithHTTPReadinessChecks(func(context.Context) []ReadinessCheck { return checks }),
+	)
+	if err != nil {
+		t.Fatalf("NewHTTPService() error = %v", err)
+	}
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	readyz := func() (int, string) {
+		t.Helper()
+		resp, err := http.Get(server.URL + "/readyz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if status, body := readyz(); status != http.StatusOK || !strings.Contains(body, "[+] policy ok") {
+		t.Errorf("/readyz = %d %q, want 200 listing the checks", status, body)
+	}
+	checks[1] = ReadinessCheck{Name: "policy", Error: `bucket "nauts-policies" unreachable`}
+	if status, body := readyz(); status != http.StatusServiceUnavailable || !strings.Contains(body, `[-] policy failed: bucket "nauts-policies" unreachable`) {
+		t.Errorf("/readyz = %d %q, want 503 naming the failed check", status, body)
+	}
+}
@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/msimon/nauts/provider"
+)
+
+func TestControllerHolder_SwapWaitsForInflight(t *testing.T) {
+	first := &AuthController{}
+	second := &AuthController{}
+	h := newControllerHolder(first)
+
+	got, release := h.acquire()
+	if got != first {
+		t.Fatal("acquire() did not return the initial controller")
+	}
+
+	swapped := make(chan *AuthController)
+	go func() {
+		swapped <- h.swap(second)
+	}()
+
+	// New requests see the new controller while the old one is still in use.
+	deadline := time.Now().Add(time.Second)
+	for {
+		c, r := h.acquire()
+		r()
+		if c == second {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("new controller was not installed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	select {
+	case <-swapped:
+		t.Fatal("swap() returned before the in-flight request released the previous controller")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	release()
+	select {
+	case prev := <-swapped:
+		if prev != first {
+			t.Error("swap() did not return the previous controller")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("swap() did not return after release")
+	}
+}
+
+func TestCalloutService_SetController(t *testing.T) {
+	first := createTestController(t)
+	svc, err := NewCalloutService(first, CalloutConfig{
+		NatsCredentials:  "/path/to/creds",
+		ResponseCacheTTL: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewCalloutService() error = %v", err)
+	}
+	svc.responses.do("key", func() (string, bool) { return "token", true })
+
+	second := createTestController(t)
+	if prev := svc.SetController(second); prev != first {
+		t.Error("SetController() did not return the previous controller")
+	}
+	if got, release := svc.controllers.acquire(); got != second {
+		t.Error("SetController() did not install the new controller")
+	} else {
+		release()
+	}
+
+	// Cached responses of the previous controller are not replayed.
+	_, shared := svc.responses.do("key", func() (string, bool) { return "new-token", true })
+	if shared {
+		t.Error("response cache was not cleared on controller swap")
+	}
+}
+
+// recordingSetter records the controllers installed by a Reloader.
+type recordingSetter struct {
+	installed []*AuthController
+}
+
+func (s *recordingSetter) SetController(c *AuthController) *AuthController {
+	s.installed = append(s.installed, c)
+	return nil
+}
+
+// stoppablePolicyProvider counts Stop calls made by AuthController.Stop.
+type stoppablePolicyProvider struct {
+	provider.PolicyProvider
+	stops int
+}
+
+func (p *stoppablePolicyProvider) Stop() error {
+	p.stops++
+	return nil
+}
+
+func TestReloader_RollbackAndHistory(t *testing.T) {
+	policies := make([]*stoppablePolicyProvider, 4)
+	controllers := make([]*AuthController, 4)
+	for i := range controllers {
+		policies[i] = &stoppablePolicyProvider{}
+		controllers[i] = &AuthController{policyProvider: policies[i]}
+	}
+	svc := &recordingSetter{}
+	r := NewReloader(controllers[0], "v0.json", 2, svc)
+
+	r.Reload(controllers[1], "v1.json")
+	r.Reload(controllers[2], "v2.json")
+	entry := r.Reload(controllers[3], "v3.json")
+	if entry.Generation != 4 || r.Current() != controllers[3] {
+		t.Fatalf("Reload() = %+v, want generation 4 serving the last controller", entry)
+	}
+	// Only two previous controllers are kept; the oldest is stopped.
+	if policies[0].stops != 1 || policies[1].stops != 0 {
+		t.Errorf("stops = %d, %d, want the evicted controller stopped once", policies[0].stops, policies[1].stops)
+	}
+	status := r.Status()
+	if len(status.History) != 2 || status.History[0].Source != "v2.json" || status.History[1].Source != "v1.json" {
+		t.Errorf("Status().History = %+v, want v2 then v1", status.History)
+	}
+
+	// Rollbacks walk back through the history and stop the discarded controller.
+	for _, want := range []int{2, 1} {
+		entry, err := r.Rollback()
+		if err != nil {
+			t.Fatalf("Rollback() error = %v", err)
+		}
+		if entry.Generation != want+1 || r.Current() != controllers[want] {
+			t.Errorf("Rollback() = %+v, want controller %d", entry, want)
+		}
+		if policies[want+1].stops != 1 {
+			t.Errorf("discarded controller %d stopped %d times, want 1", want+1, policies[want+1].stops)
+		}
+	}
+	if _, err := r.Rollback(); !errors.Is(err, ErrNoRollback) {
+		t.Errorf("Rollback() with empty history error = %v, want ErrNoRollback", err)
+	}
+
+	want := []*AuthController{controllers[1], controllers[2], controllers[3], controllers[2], controllers[1]}
+	if len(svc.installed) != len(want) {
+		t.Fatalf("service saw %d swaps, want %d", len(svc.installed), len(want))
+	}
+	for i := range want {
+		if svc.installed[i] != want[i] {
+			t.Errorf("swap %d installed the wrong controller", i)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"sync"
+
+	"github.com/msimon/nauts/identity"
+)
+
+// requestCoalescer lets concurrent, identical authentication requests share
+// one verification and permission compilation. Unlike responseCache, it
+// ignores the user nkey of the connection, which differs for every client
+// reconnecting after an outage, and keeps nothing once the first request
+// finished.
+type requestCoalescer struct {
+	mu       sync.Mutex
+	inFlight map[string]*coalescedRequest
+}
+
+type coalescedRequest struct {
+	ready    chan struct{} // closed once resolved, event, and err are set
+	resolved *resolvedRequest
+	event    AuditEvent
+	err      error
+	waiters  int
+}
+
+func newRequestCoalescer() *requestCoalescer {
+	return &requestCoalescer{inFlight: make(map[string]*coalescedRequest)}
+}
+
+// coalescingKey derives the key of an authentication request from everything
+// verification and compilation depend on: the account, the credentials, the
+// requested provider, the client address and connect details, and the nonce.
+// Requests signing a nonce are therefore never coalesced.
+func coalescingKey(req identity.AuthRequest, client ClientInfo) string {
+	h := sha256.New()
+	for _, field := range []string{
+		strconv.Itoa(req.Version),
+		req.Account,
+		req.Token,
+		req.AP,
+		req.ClientIP.String(),
+		req.Nonce,
+		req.SignedNonce,
+		client.Name,
+		client.Lang,
+		client.Version,
+	} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// do calls resolve, or waits for the in-flight call with the same key, and
+// returns its result. The event filled by resolve is copied to every caller's
+// event. shared is true if the result was not resolved by this call.
+func (c *requestCoalescer) do(key string, event *AuditEvent, resolve func(*AuditEvent) (*resolvedRequest, error)) (resolved *resolvedRequest, shared bool, err error) {
+	c.mu.Lock()
+	if r, ok := c.inFlight[key]; ok {
+		r.waiters++
+		c.mu.Unlock()
+		<-r.ready
+		*event = r.event
+		return r.resolved, true, r.err
+	}
+	r := &coalescedRequest{ready: make(chan struct{})}
+	c.inFlight[key] = r
+	c.mu.Unlock()
+
+	r.event = *event
+	r.resolved, r.err = resolve(&r.event)
+
+	c.mu.Lock()
+	delete(c.inFlight, key)
+	c.mu.Unlock()
+	close(r.ready)
+
+	*event = r.event
+	return r.resolved, false, r.err
+}
+
+// pending returns the number of requests waiting for the in-flight request
+// with key.
+func (c *requestCoalescer) pending(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if r, ok := c.inFlight[key]; ok {
+		return r.waiters
+	}
+	return 0
+}
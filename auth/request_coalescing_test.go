@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+
+	"github.com/msimon/nauts/identity"
+)
+
+// blockingAuthProvider counts Verify calls and blocks them until release is
+// closed.
+type blockingAuthProvider struct {
+	calls   atomic.Int32
+	release chan struct{}
+	err     error
+}
+
+func (p *blockingAuthProvider) ManageableAccounts() []string {
+	return []string{"test-account"}
+}
+
+func (p *blockingAuthProvider) Verify(_ context.Context, req identity.AuthRequest) (*identity.User, error) {
+	p.calls.Add(1)
+	<-p.release
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &identity.User{ID: "alice", Roles: []identity.Role{{Account: req.Account, Name: "workers"}}}, nil
+}
+
+func newCoalescingTestController(t *testing.T, p identity.AuthenticationProvider) *AuthController {
+	t.Helper()
+	tmpDir := t.TempDir()
+	manager, err := identity.NewAuthenticationProviderManager(map[string]identity.AuthenticationProvider{"blocking": p})
+	if err != nil {
+		t.Fatalf("creating provider manager: %v", err)
+	}
+	return NewAuthController(createTestAccountProvider(t, tmpDir), createTestPolicyProvider(t, tmpDir), manager,
+		WithLogger(&testLogger{}), WithRequestCoalescing())
+}
+
+// authenticateConcurrently runs n Authenticate calls with token and waits
+// until n-1 of them wait for the first before releasing the provider.
+func authenticateConcurrently(t *testing.T, c *AuthController, p *blockingAuthProvider, token string, n int) ([]*AuthResult, []error) {
+	t.Helper()
+	opts := natsjwt.ConnectOptions{Token: `{"account":"test-account","token":"` + token + `"}`}
+	authReq, err := c.authRequest(opts)
+	if err != nil {
+		t.Fatalf("authRequest() error = %v", err)
+	}
+	key := coalescingKey(authReq, ClientInfo{})
+
+	results := make([]*AuthResult, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = c.Authenticate(context.Background(), opts, "", time.Hour)
+		}(i)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for c.coalescer.pending(key) < n-1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d requests waiting, want %d", c.coalescer.pending(key), n-1)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(p.release)
+	wg.Wait()
+	return results, errs
+}
+
+func TestAuthenticate_CoalescesIdenticalRequests(t *testing.T) {
+	p := &blockingAuthProvider{release: make(chan struct{})}
+	c := newCoalescingTestController(t, p)
+
+	results, errs := authenticateConcurrently(t, c, p, "secret", 5)
+	if got := p.calls.Load(); got != 1 {
+		t.Errorf("Verify called %d times, want 1", got)
+	}
+	keys := make(map[string]bool)
+	for i, result := range results {
+		if errs[i] != nil {
+			t.Fatalf("Authenticate() #%d error = %v", i, errs[i])
+		}
+		if result.User.ID != "alice" || result.AuthProviderId != "blocking" {
+			t.Errorf("Authenticate() #%d user = %s via %s", i, result.User.ID, result.AuthProviderId)
+		}
+		if result.CompilationResult != results[0].CompilationResult {
+			t.Errorf("Authenticate() #%d compiled its own permissions", i)
+		}
+		keys[result.UserPublicKey] = true
+	}
+	if len(keys) != len(results) {
+		t.Errorf("got %d distinct user keys for %d requests, want one JWT per request", len(keys), len(results))
+	}
+
+	// Nothing is kept once the requests finished.
+	if _, err := c.Authenticate(context.Background(), natsjwt.ConnectOptions{Token: `{"account":"test-account","token":"secret"}`}, "", time.Hour); err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if got := p.calls.Load(); got != 2 {
+		t.Errorf("Verify called %d times, want 2", got)
+	}
+}
+
+func TestAuthenticate_CoalescesErrors(t *testing.T) {
+	p := &blockingAuthProvider{release: make(chan struct{}), err: identity.ErrInvalidCredentials}
+	c := newCoalescingTestController(t, p)
+
+	_, errs := authenticateConcurrently(t, c, p, "wrong", 3)
+	if got := p.calls.Load(); got != 1 {
+		t.Errorf("Verify called %d times, want 1", got)
+	}
+	for i, err := range errs {
+		var phaseErr *PhaseError
+		if !errors.As(err, &phaseErr) || phaseErr.Phase != "verify" || !errors.Is(err, identity.ErrInvalidCredentials) {
+			t.Errorf("Authenticate() #%d error = %v, want invalid credentials in phase verify", i, err)
+		}
+	}
+}
+
+func TestCoalescingKey(t *testing.T) {
+	base := identity.AuthRequest{Account: "APP", Token: "alice:secret", ClientIP: netip.MustParseAddr("10.0.0.1")}
+	if coalescingKey(base, ClientInfo{}) != coalescingKey(base, ClientInfo{}) {
+		t.Fatal("coalescingKey() differs for the same request")
+	}
+	for name, req := range map[string]identity.AuthRequest{
+		"account":   {Account: "OPS", Token: base.Token, ClientIP: base.ClientIP},
+		"token":     {Account: base.Account, Token: "alice:other", ClientIP: base.ClientIP},
+		"provider":  {Account: base.Account, Token: base.Token, ClientIP: base.ClientIP, AP: "ldap"},
+		"client ip": {Account: base.Account, Token: base.Token, ClientIP: netip.MustParseAddr("10.0.0.2")},
+		"nonce":     {Account: base.Account, Token: base.Token, ClientIP: base.ClientIP, Nonce: "n1"},
+	} {
+		if coalescingKey(req, ClientInfo{}) == coalescingKey(base, ClientInfo{}) {
+			t.Errorf("coalescingKey() ignores the %s", name)
+		}
+	}
+	if coalescingKey(base, ClientInfo{Name: "worker"}) == coalescingKey(base, ClientInfo{}) {
+		t.Error("coalescingKey() ignores the client name")
+	}
+}
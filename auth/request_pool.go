@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/nats-io/nats.go"
+)
+
+// DefaultRequestQueueDepth is the default number of callout requests waiting
+// for a worker.
+const DefaultRequestQueueDepth = 1024
+
+// RequestPoolStats is a snapshot of the callout worker pool.
+type RequestPoolStats struct {
+	Workers    int `json:"workers"`
+	QueueDepth int `json:"queue_depth"`
+	// Queued is the number of requests waiting for a worker, Active the
+	// number being handled.
+	Queued int   `json:"queued"`
+	Active int64 `json:"active"`
+	// Processed counts handled requests, Rejected the requests answered with
+	// "too many requests" because the queue was full.
+	Processed uint64 `json:"processed"`
+	Rejected  uint64 `json:"rejected"`
+}
+
+// requestPool handles callout requests on a fixed number of workers, so that
+// a burst is processed in parallel instead of one request at a time on the
+// subscription's delivery goroutine.
+type requestPool struct {
+	queue   chan *nats.Msg
+	workers int
+	stop    chan struct{}
+	wg      sync.WaitGroup
+
+	active    atomic.Int64
+	processed atomic.Uint64
+	rejected  atomic.Uint64
+}
+
+// newRequestPool starts workers that call handle for every submitted request.
+func newRequestPool(workers, queueDepth int, handle func(*nats.Msg)) *requestPool {
+	p := &requestPool{
+		queue:   make(chan *nats.Msg, queueDepth),
+		workers: workers,
+		stop:    make(chan struct{}),
+	}
+	for range workers {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for {
+				select {
+				case msg := <-p.queue:
+					p.active.Add(1)
+					handle(msg)
+					p.active.Add(-1)
+					p.processed.Add(1)
+				case <-p.stop:
+					return
+				}
+			}
+		}()
+	}
+	return p
+}
+
+// submit queues msg for a worker. It reports false without blocking if the
+// queue is full.
+func (p *requestPool) submit(msg *nats.Msg) bool {
+	select {
+	case p.queue <- msg:
+		return true
+	default:
+		p.rejected.Add(1)
+		return false
+	}
+}
+
+// close stops the workers once they finished their current request. Queued
+// requests are discarded; callers wait for them before.
+func (p *requestPool) close() {
+	close(p.stop)
+	p.wg.Wait()
+}
+
+func (p *requestPool) stats() RequestPoolStats {
+	return RequestPoolStats{
+		Workers:    p.workers,
+		QueueDepth: cap(p.queue),
+		Queued:     len(p.queue),
+		Active:     p.active.Load(),
+		Processed:  p.processed.Load(),
+		Rejected:   p.rejected.Load(),
+	}
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestRequestPool(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 4)
+	p := newRequestPool(2, 1, func(*nats.Msg) {
+		started <- struct{}{}
+		<-release
+	})
+	defer p.close()
+
+	// Two requests run in parallel, a third waits in the queue, and a
+	// fourth is rejected.
+	for i := range 3 {
+		if !p.submit(&nats.Msg{}) {
+			t.Fatalf("submit() #%d rejected", i)
+		}
+		if i < 2 {
+			select {
+			case <-started:
+			case <-time.After(time.Second):
+				t.Fatalf("request #%d not started", i)
+			}
+		}
+	}
+	if p.submit(&nats.Msg{}) {
+		t.Fatal("submit() accepted a request with a full queue")
+	}
+	stats := p.stats()
+	if stats.Active != 2 || stats.Queued != 1 || stats.Rejected != 1 {
+		t.Errorf("stats = %+v, want 2 active, 1 queued, 1 rejected", stats)
+	}
+
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for p.stats().Processed != 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("stats = %+v, want 3 processed", p.stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if stats := p.stats(); stats.Active != 0 || stats.Queued != 0 || stats.Workers != 2 || stats.QueueDepth != 1 {
+		t.Errorf("stats = %+v, want 2 idle workers and an empty queue of 1", stats)
+	}
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+)
+
+// responseCache caches signed auth callout responses for a short time so that
+// NATS server retries of the same request receive an identical response
+// without re-running authentication. Concurrent requests with the same key
+// wait for the first one to finish.
+type responseCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*responseCacheEntry
+	nextSweep time.Time
+}
+
+type responseCacheEntry struct {
+	ready     chan struct{} // closed once token is set
+	token     string
+	cacheable bool
+	expiresAt time.Time
+}
+
+func newResponseCache(ttl time.Duration) *responseCache {
+	return &responseCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]*responseCacheEntry),
+	}
+}
+
+// responseCacheKey derives the cache key from the user nkey, the requesting
+// server, and a hash of the connect options (which carry the credentials).
+func responseCacheKey(userNkey, serverID string, opts natsjwt.ConnectOptions) string {
+	data, _ := json.Marshal(opts)
+	h := sha256.New()
+	h.Write([]byte(userNkey))
+	h.Write([]byte{0})
+	h.Write([]byte(serverID))
+	h.Write([]byte{0})
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// do returns the cached token for key, or calls compute and caches its result
+// if compute reports it as cacheable. shared is true if the token was not
+// computed by this call.
+func (c *responseCache) do(key string, compute func() (token string, cacheable bool)) (token string, shared bool) {
+	c.mu.Lock()
+	now := c.now()
+	c.sweep(now)
+	if e, ok := c.entries[key]; ok {
+		select {
+		case <-e.ready:
+			if e.cacheable && now.Before(e.expiresAt) {
+				c.mu.Unlock()
+				return e.token, true
+			}
+		default:
+			// In flight: wait for the first request to finish.
+			c.mu.Unlock()
+			<-e.ready
+			if e.cacheable {
+				return e.token, true
+			}
+			return c.do(key, compute)
+		}
+	}
+	e := &responseCacheEntry{ready: make(chan struct{})}
+	c.entries[key] = e
+	c.mu.Unlock()
+
+	token, cacheable := compute()
+
+	c.mu.Lock()
+	e.token = token
+	e.cacheable = cacheable && token != ""
+	e.expiresAt = c.now().Add(c.ttl)
+	if !e.cacheable {
+		delete(c.entries, key)
+	}
+	close(e.ready)
+	c.mu.Unlock()
+
+	return token, false
+}
+
+// clear drops all completed entries, e.g. after the controller was replaced.
+// In-flight computations still deliver their result to waiting requests.
+func (c *responseCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.entries {
+		select {
+		case <-e.ready:
+			delete(c.entries, k)
+		default:
+		}
+	}
+}
+
+// sweep removes expired entries at most once per TTL. The caller must hold c.mu.
+func (c *responseCache) sweep(now time.Time) {
+	if now.Before(c.nextSweep) {
+		return
+	}
+	c.nextSweep = now.Add(c.ttl)
+	for k, e := range c.entries {
+		select {
+		case <-e.ready:
+			if !now.Before(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		default:
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+)
+
+func TestResponseCache_ReplaysWithinTTL(t *testing.T) {
+	now := time.Unix(1000, 0)
+	c := newResponseCache(5 * time.Second)
+	c.now = func() time.Time { return now }
+
+	calls := 0
+	compute := func() (string, bool) {
+		calls++
+		return "token", true
+	}
+
+	if token, shared := c.do("k", compute); token != "token" || shared {
+		t.Fatalf("first do() = %q, %v; want computed token", token, shared)
+	}
+	if token, shared := c.do("k", compute); token != "token" || !shared {
+		t.Fatalf("second do() = %q, %v; want cached token", token, shared)
+	}
+	if calls != 1 {
+		t.Errorf("compute called %d times, want 1", calls)
+	}
+
+	now = now.Add(5 * time.Second)
+	if _, shared := c.do("k", compute); shared {
+		t.Error("expired entry should be recomputed")
+	}
+	if calls != 2 {
+		t.Errorf("compute called %d times, want 2", calls)
+	}
+}
+
+func TestResponseCache_NotCacheable(t *testing.T) {
+	c := newResponseCache(time.Minute)
+
+	calls := 0
+	compute := func() (string, bool) {
+		calls++
+		return "internal-error", false
+	}
+	c.do("k", compute)
+	c.do("k", compute)
+	if calls != 2 {
+		t.Errorf("compute called %d times, want 2 for non-cacheable responses", calls)
+	}
+	if len(c.entries) != 0 {
+		t.Errorf("non-cacheable response left %d entries", len(c.entries))
+	}
+}
+
+func TestResponseCache_CoalescesConcurrentRequests(t *testing.T) {
+	c := newResponseCache(time.Minute)
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	compute := func() (string, bool) {
+		calls.Add(1)
+		<-release
+		return "token", true
+	}
+
+	var wg sync.WaitGroup
+	results := make([]string, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = c.do("k", compute)
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("compute called %d times, want 1", n)
+	}
+	for i, r := range results {
+		if r != "token" {
+			t.Errorf("results[%d] = %q, want token", i, r)
+		}
+	}
+}
+
+func TestResponseCache_Sweep(t *testing.T) {
+	now := time.Unix(1000, 0)
+	c := newResponseCache(time.Second)
+	c.now = func() time.Time { return now }
+
+	c.do("a", func() (string, bool) { return "a", true })
+	now = now.Add(2 * time.Second)
+	c.do("b", func() (string, bool) { return "b", true })
+
+	if _, ok := c.entries["a"]; ok {
+		t.Error("expired entry was not swept")
+	}
+	if _, ok := c.entries["b"]; !ok {
+		t.Error("fresh entry missing")
+	}
+}
+
+func TestResponseCacheKey(t *testing.T) {
+	opts := natsjwt.ConnectOptions{Token: `{"account":"APP","token":"alice:secret"}`}
+	base := responseCacheKey("UABC", "server-1", opts)
+
+	if responseCacheKey("UABC", "server-1", opts) != base {
+		t.Error("key is not deterministic")
+	}
+	if responseCacheKey("UXYZ", "server-1", opts) == base {
+		t.Error("key must depend on user nkey")
+	}
+	if responseCacheKey("UABC", "server-2", opts) == base {
+		t.Error("key must depend on server id")
+	}
+	other := natsjwt.ConnectOptions{Token: `{"account":"APP","token":"alice:other"}`}
+	if responseCacheKey("UABC", "server-1", other) == base {
+		t.Error("key must depend on credentials")
+	}
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/msimon/nauts/identity"
+)
+
+// DefaultRetryBackoff is the delay before the first retry of a verification.
+const DefaultRetryBackoff = 100 * time.Millisecond
+
+// RetryPolicy bounds and retries the verifications of an authentication
+// provider.
+type RetryPolicy struct {
+	// Timeout bounds each attempt. 0 leaves attempts bounded by the caller's
+	// context only.
+	Timeout time.Duration
+	// Retries is how many further attempts are made after an attempt failed
+	// because the backend was unavailable or timed out.
+	Retries int
+	// Backoff is the delay before the first retry, doubled for every further
+	// retry. 0 selects DefaultRetryBackoff.
+	Backoff time.Duration
+}
+
+// retryingAuthProvider bounds and retries the verifications of an
+// AuthenticationProvider.
+type retryingAuthProvider struct {
+	identity.AuthenticationProvider
+	id     string
+	policy RetryPolicy
+}
+
+// NewRetryingAuthProvider wraps p, the provider with id, so that every Verify
+// attempt is bounded by policy.Timeout and attempts failing with errors that
+// wrap identity.ErrProviderUnavailable or context.DeadlineExceeded are
+// retried. Attempts that time out fail with an error wrapping both. Other
+// errors, such as invalid credentials, are returned right away.
+func NewRetryingAuthProvider(p identity.AuthenticationProvider, id string, policy RetryPolicy) identity.AuthenticationProvider {
+	if policy.Backoff <= 0 {
+		policy.Backoff = DefaultRetryBackoff
+	}
+	return &retryingAuthProvider{AuthenticationProvider: p, id: id, policy: policy}
+}
+
+func (p *retryingAuthProvider) Verify(ctx context.Context, req identity.AuthRequest) (*identity.User, error) {
+	backoff := p.policy.Backoff
+	for attempt := 0; ; attempt++ {
+		user, err := p.verify(ctx, req)
+		if err == nil || attempt >= p.policy.Retries || !isAuthenticationFailure(err) || ctx.Err() != nil {
+			return user, err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// verify makes a single attempt, bounded by the policy's timeout.
+func (p *retryingAuthProvider) verify(ctx context.Context, req identity.AuthRequest) (*identity.User, error) {
+	if p.policy.Timeout <= 0 {
+		return p.AuthenticationProvider.Verify(ctx, req)
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, p.policy.Timeout)
+	defer cancel()
+	user, err := p.AuthenticationProvider.Verify(attemptCtx, req)
+	if err != nil && ctx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%w: %s: verification timed out after %s: %w", identity.ErrProviderUnavailable, p.id, p.policy.Timeout, context.DeadlineExceeded)
+	}
+	return user, err
+}
+
+// Stop stops the wrapped provider if it holds resources.
+func (p *retryingAuthProvider) Stop() error {
+	if s, ok := p.AuthenticationProvider.(interface{ Stop() error }); ok {
+		return s.Stop()
+	}
+	return nil
+}
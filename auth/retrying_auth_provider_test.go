@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/msimon/nauts/identity"
+)
+
+func TestRetryingAuthProvider(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantCalls int
+	}{
+		{"invalid credentials", fmt.Errorf("%w: bad password", identity.ErrInvalidCredentials), 1},
+		{"backend unavailable", fmt.Errorf("%w: calling STS", identity.ErrProviderUnavailable), 3},
+		{"deadline exceeded", context.DeadlineExceeded, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &stubAuthProvider{err: tt.err}
+			p := NewRetryingAuthProvider(inner, "test", RetryPolicy{Retries: 2, Backoff: time.Millisecond})
+
+			if _, err := p.Verify(context.Background(), identity.AuthRequest{}); !errors.Is(err, tt.err) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.err)
+			}
+			if inner.calls != tt.wantCalls {
+				t.Errorf("provider calls = %d, want %d", inner.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// slowAuthProvider blocks Verify until the context is done.
+type slowAuthProvider struct {
+	stubAuthProvider
+}
+
+func (p *slowAuthProvider) Verify(ctx context.Context, _ identity.AuthRequest) (*identity.User, error) {
+	p.calls++
+	<-ctx.Done()
+	return nil, fmt.Errorf("calling backend: %w", ctx.Err())
+}
+
+func TestRetryingAuthProvider_Timeout(t *testing.T) {
+	inner := &slowAuthProvider{}
+	p := NewRetryingAuthProvider(inner, "sts", RetryPolicy{Timeout: 10 * time.Millisecond, Retries: 1, Backoff: time.Millisecond})
+
+	start := time.Now()
+	_, err := p.Verify(context.Background(), identity.AuthRequest{})
+	if !errors.Is(err, identity.ErrProviderUnavailable) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Verify() error = %v, want ErrProviderUnavailable and DeadlineExceeded", err)
+	}
+	if inner.calls != 2 {
+		t.Errorf("provider calls = %d, want 2", inner.calls)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Verify() took %s", elapsed)
+	}
+
+	// The caller's deadline is not retried.
+	inner.calls = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	p = NewRetryingAuthProvider(inner, "sts", RetryPolicy{Timeout: time.Second, Retries: 3})
+	if _, err := p.Verify(ctx, identity.AuthRequest{}); errors.Is(err, identity.ErrProviderUnavailable) {
+		t.Errorf("Verify() error = %v, want the caller's deadline", err)
+	}
+	if inner.calls != 1 {
+		t.Errorf("provider calls = %d, want 1", inner.calls)
+	}
+}
+
+func TestRetryingAuthProvider_CircuitBreaker(t *testing.T) {
+	// The breaker counts a verification once, after all retries failed.
+	inner := &stubAuthProvider{err: identity.ErrProviderUnavailable}
+	b := NewCircuitBreaker("auth:test", 2, time.Minute)
+	p := NewCircuitBreakingAuthProvider(NewRetryingAuthProvider(inner, "test", RetryPolicy{Retries: 2, Backoff: time.Millisecond}), b)
+
+	_, _ = p.Verify(context.Background(), identity.AuthRequest{})
+	if got := b.Status(); got.State != CircuitClosed || got.ConsecutiveFailures != 1 {
+		t.Errorf("breaker = %+v, want closed with 1 failure", got)
+	}
+	_, _ = p.Verify(context.Background(), identity.AuthRequest{})
+	if _, err := p.Verify(context.Background(), identity.AuthRequest{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Verify() error = %v, want ErrCircuitOpen", err)
+	}
+	if inner.calls != 6 {
+		t.Errorf("provider calls = %d, want 6", inner.calls)
+	}
+}
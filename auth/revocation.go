@@ -0,0 +1,263 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	// DefaultRevocationBucket is the NATS KV bucket of the revocation list.
+	DefaultRevocationBucket = "nauts-revocations"
+
+	// DefaultRevocationRetention is how long issued and revoked tokens are
+	// kept in the revocation list.
+	DefaultRevocationRetention = 24 * time.Hour
+
+	issuedKeyPrefix  = "issued."
+	revokedKeyPrefix = "revoked."
+	userKeyPrefix    = "user."
+)
+
+var (
+	// ErrTokenNotTracked is returned by RevocationList.Revoke for token IDs
+	// that were never issued or whose record has expired.
+	ErrTokenNotTracked = errors.New("token not tracked")
+
+	// tokenIDPattern matches jti claims (base32 hashes) and keeps IDs usable
+	// as KV keys.
+	tokenIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// IssuedToken identifies a user JWT issued by nauts.
+type IssuedToken struct {
+	// ID is the jti claim of the JWT.
+	ID      string `json:"jti"`
+	Account string `json:"account"`
+	// AccountKey is the public key of the account, used to push revocations.
+	AccountKey    string     `json:"account_key"`
+	UserID        string     `json:"user_id"`
+	UserPublicKey string     `json:"user_public_key"`
+	IssuedAt      time.Time  `json:"issued_at"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	// Permissions are the permissions embedded in the JWT.
+	Permissions *natsjwt.Permissions `json:"permissions,omitempty"`
+}
+
+// RevokedToken is an issued token that was revoked.
+type RevokedToken struct {
+	IssuedToken
+	RevokedAt time.Time `json:"revoked_at"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// TokenTracker records issued user JWTs, so that they can be revoked later.
+type TokenTracker interface {
+	Track(ctx context.Context, token IssuedToken) error
+}
+
+// IssuanceHistory is implemented by token trackers that remember the last
+// token issued to each user, so that permission changes between issuances
+// can be audited.
+type IssuanceHistory interface {
+	// LastIssued returns the last token issued to the user in account, or
+	// nil if none is known.
+	LastIssued(ctx context.Context, account, userID string) (*IssuedToken, error)
+}
+
+// revocationKV is the subset of jetstream.KeyValue used by RevocationList.
+type revocationKV interface {
+	Get(ctx context.Context, key string) (jetstream.KeyValueEntry, error)
+	Put(ctx context.Context, key string, value []byte) (uint64, error)
+	ListKeysFiltered(ctx context.Context, filters ...string) (jetstream.KeyLister, error)
+}
+
+// RevocationList keeps issued and revoked tokens by jti in a NATS KV bucket.
+// Entries expire with the bucket's TTL, so the retention should be at least
+// the longest JWT TTL. It is safe for concurrent use.
+type RevocationList struct {
+	kv  revocationKV
+	nc  *nats.Conn // closed by Close if owned
+	now func() time.Time
+}
+
+// NewRevocationList creates a revocation list on an existing bucket.
+func NewRevocationList(kv jetstream.KeyValue) *RevocationList {
+	return &RevocationList{kv: kv, now: time.Now}
+}
+
+// Track implements TokenTracker. The token is also kept as the last token
+// issued to its user.
+func (l *RevocationList) Track(ctx context.Context, token IssuedToken) error {
+	if !tokenIDPattern.MatchString(token.ID) {
+		return fmt.Errorf("invalid token id %q", token.ID)
+	}
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("encoding issued token: %w", err)
+	}
+	if _, err := l.kv.Put(ctx, issuedKeyPrefix+token.ID, data); err != nil {
+		return fmt.Errorf("tracking token %s: %w", token.ID, err)
+	}
+	if _, err := l.kv.Put(ctx, userKey(token.Account, token.UserID), data); err != nil {
+		return fmt.Errorf("tracking token %s of %s: %w", token.ID, token.UserID, err)
+	}
+	return nil
+}
+
+// LastIssued implements IssuanceHistory.
+func (l *RevocationList) LastIssued(ctx context.Context, account, userID string) (*IssuedToken, error) {
+	token, err := l.get(ctx, userKey(account, userID))
+	if errors.Is(err, ErrTokenNotTracked) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token.IssuedToken, nil
+}
+
+// userKey returns the key of the last token issued to a user. User IDs may
+// contain characters that are not valid in keys, so the key is a hash.
+func userKey(account, userID string) string {
+	sum := sha256.Sum256([]byte(account + "\x00" + userID))
+	return userKeyPrefix + hex.EncodeToString(sum[:16])
+}
+
+// Revoke marks a tracked token as revoked and returns its record. Revoking a
+// token again returns the existing record. Returns an error wrapping
+// ErrTokenNotTracked if the token is unknown.
+func (l *RevocationList) Revoke(ctx context.Context, id, reason string) (*RevokedToken, error) {
+	if !tokenIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("invalid token id %q", id)
+	}
+	if revoked, err := l.get(ctx, revokedKeyPrefix+id); err == nil {
+		return revoked, nil
+	} else if !errors.Is(err, ErrTokenNotTracked) {
+		return nil, err
+	}
+
+	issued, err := l.get(ctx, issuedKeyPrefix+id)
+	if err != nil {
+		return nil, err
+	}
+	revoked := &RevokedToken{IssuedToken: issued.IssuedToken, RevokedAt: l.now().UTC(), Reason: reason}
+	data, err := json.Marshal(revoked)
+	if err != nil {
+		return nil, fmt.Errorf("encoding revoked token: %w", err)
+	}
+	if _, err := l.kv.Put(ctx, revokedKeyPrefix+id, data); err != nil {
+		return nil, fmt.Errorf("revoking token %s: %w", id, err)
+	}
+	return revoked, nil
+}
+
+// IsRevoked reports whether the token was revoked.
+func (l *RevocationList) IsRevoked(ctx context.Context, id string) (bool, error) {
+	if !tokenIDPattern.MatchString(id) {
+		return false, fmt.Errorf("invalid token id %q", id)
+	}
+	_, err := l.get(ctx, revokedKeyPrefix+id)
+	if errors.Is(err, ErrTokenNotTracked) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Revoked returns all revoked tokens, oldest revocation first.
+func (l *RevocationList) Revoked(ctx context.Context) ([]RevokedToken, error) {
+	lister, err := l.kv.ListKeysFiltered(ctx, revokedKeyPrefix+">")
+	if err != nil {
+		return nil, fmt.Errorf("listing revoked tokens: %w", err)
+	}
+	defer lister.Stop()
+
+	var tokens []RevokedToken
+	for key := range lister.Keys() {
+		token, err := l.get(ctx, key)
+		if errors.Is(err, ErrTokenNotTracked) {
+			continue // expired while listing
+		}
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].RevokedAt.Before(tokens[j].RevokedAt) })
+	return tokens, nil
+}
+
+// Watch calls fn for every revoked token, first for the existing ones and
+// then for new revocations, until ctx is cancelled. fn is called with nil
+// once the existing revocations have been delivered.
+func (l *RevocationList) Watch(ctx context.Context, fn func(*RevokedToken)) error {
+	kv, ok := l.kv.(jetstream.KeyValue)
+	if !ok {
+		return errors.New("revocation list does not support watching")
+	}
+	watcher, err := kv.WatchFiltered(ctx, []string{revokedKeyPrefix + ">"})
+	if err != nil {
+		return fmt.Errorf("watching revocations: %w", err)
+	}
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case entry, ok := <-watcher.Updates():
+			if !ok {
+				return nil
+			}
+			if entry == nil {
+				fn(nil)
+				continue
+			}
+			if entry.Operation() != jetstream.KeyValuePut {
+				continue
+			}
+			var token RevokedToken
+			if err := json.Unmarshal(entry.Value(), &token); err != nil {
+				continue
+			}
+			fn(&token)
+		}
+	}
+}
+
+// Close closes the NATS connection if the list owns it.
+func (l *RevocationList) Close() error {
+	if l.nc != nil {
+		l.nc.Close()
+	}
+	return nil
+}
+
+// get decodes the entry at key. Both issued and revoked entries decode into
+// a RevokedToken; RevokedAt is zero for issued entries.
+func (l *RevocationList) get(ctx context.Context, key string) (*RevokedToken, error) {
+	entry, err := l.kv.Get(ctx, key)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		_, id, _ := strings.Cut(key, ".")
+		return nil, fmt.Errorf("%w: %s", ErrTokenNotTracked, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", key, err)
+	}
+	var token RevokedToken
+	if err := json.Unmarshal(entry.Value(), &token); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", key, err)
+	}
+	return &token, nil
+}
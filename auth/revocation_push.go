@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+
+	"github.com/msimon/nauts/jwt"
+)
+
+const (
+	// accountLookupSubject returns the current JWT of an account from the
+	// server's account resolver.
+	accountLookupSubject = "$SYS.REQ.ACCOUNT.%s.CLAIMS.LOOKUP"
+
+	// claimsUpdateSubject updates an account JWT on all servers.
+	claimsUpdateSubject = "$SYS.REQ.CLAIMS.UPDATE"
+
+	// revocationPushTimeout bounds each lookup and update request.
+	revocationPushTimeout = 5 * time.Second
+)
+
+// RevocationPusher enforces revoked tokens on the NATS servers: it adds the
+// revoked user keys to the revocations of their account JWT, re-signs the
+// JWT with an operator signing key, and pushes it as a $SYS claims update.
+// Servers then disconnect the affected users and reject the revoked JWTs.
+//
+// Requires operator mode with a full account resolver, a connection of a
+// system account user, and a signing key of the operator.
+type RevocationPusher struct {
+	list   *RevocationList
+	nc     *nats.Conn
+	signer jwt.Signer
+	logger Logger
+	owned  bool
+}
+
+// NewRevocationPusher creates a pusher for the revocations of list, pushing
+// on nc (a system account connection) with the operator signing key signer.
+func NewRevocationPusher(list *RevocationList, nc *nats.Conn, signer jwt.Signer) *RevocationPusher {
+	return &RevocationPusher{list: list, nc: nc, signer: signer, logger: &defaultLogger{}}
+}
+
+// Run pushes revocations until ctx is cancelled. Existing revocations are
+// pushed once per account at start, so revocations made while no pusher was
+// running are applied as well. Failed pushes are logged and not retried
+// until the next start.
+func (p *RevocationPusher) Run(ctx context.Context) error {
+	initial := make(map[string][]RevokedToken)
+	loaded := false
+	return p.list.Watch(ctx, func(token *RevokedToken) {
+		switch {
+		case token == nil && !loaded:
+			loaded = true
+			for accountKey, tokens := range initial {
+				p.push(ctx, accountKey, tokens)
+			}
+			initial = nil
+		case token == nil:
+		case token.AccountKey == "":
+			p.logger.Warn("revocation of token %s has no account key, not pushed", token.ID)
+		case !loaded:
+			initial[token.AccountKey] = append(initial[token.AccountKey], *token)
+		default:
+			p.push(ctx, token.AccountKey, []RevokedToken{*token})
+		}
+	})
+}
+
+func (p *RevocationPusher) push(ctx context.Context, accountKey string, tokens []RevokedToken) {
+	if err := p.Push(ctx, accountKey, tokens); err != nil {
+		p.logger.Warn("pushing %d revocation(s) for account %s: %v", len(tokens), accountKey, err)
+		return
+	}
+	p.logger.Info("pushed %d revocation(s) for account %s", len(tokens), accountKey)
+}
+
+// Push adds tokens to the revocations of the account and pushes the updated
+// account JWT to the servers.
+func (p *RevocationPusher) Push(ctx context.Context, accountKey string, tokens []RevokedToken) error {
+	ctx, cancel := context.WithTimeout(ctx, revocationPushTimeout)
+	defer cancel()
+
+	current, err := lookupAccountJWT(ctx, p.nc, accountKey)
+	if err != nil {
+		return err
+	}
+	if current == "" {
+		return fmt.Errorf("account %s not found by the account resolver", accountKey)
+	}
+
+	token, changed, err := applyRevocations(current, tokens, p.signer)
+	if err != nil || !changed {
+		return err
+	}
+	return updateAccountJWT(ctx, p.nc, token)
+}
+
+// lookupAccountJWT returns the JWT of the account from the account resolver,
+// or an empty string if the resolver does not know the account.
+func lookupAccountJWT(ctx context.Context, nc *nats.Conn, accountKey string) (string, error) {
+	msg, err := nc.RequestWithContext(ctx, fmt.Sprintf(accountLookupSubject, accountKey), nil)
+	if err != nil {
+		return "", fmt.Errorf("looking up account JWT: %w", err)
+	}
+	return string(msg.Data), nil
+}
+
+// updateAccountJWT pushes an account JWT to the servers as a claims update.
+func updateAccountJWT(ctx context.Context, nc *nats.Conn, token string) error {
+	msg, err := nc.RequestWithContext(ctx, claimsUpdateSubject, []byte(token))
+	if err != nil {
+		return fmt.Errorf("updating account JWT: %w", err)
+	}
+	var resp struct {
+		Error *struct {
+			Description string `json:"description"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(msg.Data, &resp); err != nil {
+		return fmt.Errorf("decoding claims update response: %w", err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("updating account JWT: %s", resp.Error.Description)
+	}
+	return nil
+}
+
+// Close closes the NATS connection if the pusher owns it.
+func (p *RevocationPusher) Close() error {
+	if p.owned && p.nc != nil {
+		p.nc.Close()
+	}
+	return nil
+}
+
+// applyRevocations revokes the user keys of tokens in the account JWT, up
+// to each token's issue time, and re-signs it with signer. changed is false
+// if all tokens were already revoked.
+func applyRevocations(accountJWT string, tokens []RevokedToken, signer jwt.Signer) (token string, changed bool, err error) {
+	claims, err := natsjwt.DecodeAccountClaims(accountJWT)
+	if err != nil {
+		return "", false, fmt.Errorf("decoding account JWT: %w", err)
+	}
+	for _, t := range tokens {
+		if t.UserPublicKey == "" {
+			continue
+		}
+		issuedAt := t.IssuedAt.Unix()
+		if claims.Revocations != nil && claims.Revocations[t.UserPublicKey] >= issuedAt {
+			continue
+		}
+		claims.RevokeAt(t.UserPublicKey, time.Unix(issuedAt, 0))
+		changed = true
+	}
+	if !changed {
+		return accountJWT, false, nil
+	}
+	token, err = claims.Encode(jwt.NewSignerAdapter(signer))
+	if err != nil {
+		return "", false, fmt.Errorf("encoding account JWT: %w", err)
+	}
+	return token, true, nil
+}
@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nkeys"
+
+	"github.com/msimon/nauts/jwt"
+)
+
+// memKV is an in-memory revocationKV and pendingBindingKV.
+type memKV struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func newMemKV() *memKV {
+	return &memKV{data: make(map[string][]byte)}
+}
+
+func (m *memKV) Get(_ context.Context, key string) (jetstream.KeyValueEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.data[key]
+	if !ok {
+		return nil, jetstream.ErrKeyNotFound
+	}
+	return memEntry{key: key, value: value}, nil
+}
+
+func (m *memKV) Put(_ context.Context, key string, value []byte) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = value
+	return uint64(len(m.data)), nil
+}
+
+func (m *memKV) Delete(_ context.Context, key string, _ ...jetstream.KVDeleteOpt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, key)
+	return nil
+}
+
+func (m *memKV) ListKeysFiltered(_ context.Context, filters ...string) (jetstream.KeyLister, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []string
+	for key := range m.data {
+		for _, f := range filters {
+			if strings.HasPrefix(key, strings.TrimRight(f, ">*")) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	ch := make(chan string, len(keys))
+	for _, key := range keys {
+		ch <- key
+	}
+	close(ch)
+	return memLister(ch), nil
+}
+
+type memLister chan string
+
+func (l memLister) Keys() <-chan string { return l }
+func (l memLister) Stop() error         { return nil }
+
+type memEntry struct {
+	jetstream.KeyValueEntry
+	key   string
+	value []byte
+}
+
+func (e memEntry) Key() string   { return e.key }
+func (e memEntry) Value() []byte { return e.value }
+
+// recordingTracker records tracked tokens.
+type recordingTracker struct {
+	tokens []IssuedToken
+	err    error
+}
+
+func (r *recordingTracker) Track(_ context.Context, token IssuedToken) error {
+	r.tokens = append(r.tokens, token)
+	return r.err
+}
+
+func TestRevocationList(t *testing.T) {
+	ctx := context.Background()
+	list := &RevocationList{kv: newMemKV(), now: func() time.Time { return time.Unix(1700000000, 0) }}
+
+	issued := IssuedToken{ID: "ABC123", Account: "APP", AccountKey: "AKEY", UserID: "alice", UserPublicKey: "UKEY", IssuedAt: time.Unix(1690000000, 0).UTC()}
+	if err := list.Track(ctx, issued); err != nil {
+		t.Fatalf("Track() error = %v", err)
+	}
+
+	if revoked, err := list.IsRevoked(ctx, "ABC123"); err != nil || revoked {
+		t.Fatalf("IsRevoked() = %v, %v before revocation", revoked, err)
+	}
+	if _, err := list.Revoke(ctx, "UNKNOWN", ""); !errors.Is(err, ErrTokenNotTracked) {
+		t.Errorf("Revoke(unknown) error = %v, want ErrTokenNotTracked", err)
+	}
+	if _, err := list.Revoke(ctx, "bad.id", ""); err == nil {
+		t.Error("Revoke(bad.id) succeeded")
+	}
+	if err := list.Track(ctx, IssuedToken{ID: "*"}); err == nil {
+		t.Error("Track(*) succeeded")
+	}
+
+	revoked, err := list.Revoke(ctx, "ABC123", "laptop stolen")
+	if err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	if revoked.UserID != "alice" || revoked.UserPublicKey != "UKEY" || revoked.Reason != "laptop stolen" || !revoked.RevokedAt.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("Revoke() = %+v", revoked)
+	}
+	if ok, err := list.IsRevoked(ctx, "ABC123"); err != nil || !ok {
+		t.Errorf("IsRevoked() = %v, %v after revocation", ok, err)
+	}
+
+	list.now = func() time.Time { return time.Unix(1800000000, 0) }
+	again, err := list.Revoke(ctx, "ABC123", "other")
+	if err != nil || again.Reason != "laptop stolen" || !again.RevokedAt.Equal(revoked.RevokedAt) {
+		t.Errorf("second Revoke() = %+v, %v, want the existing record", again, err)
+	}
+
+	all, err := list.Revoked(ctx)
+	if err != nil || len(all) != 1 || all[0].ID != "ABC123" {
+		t.Errorf("Revoked() = %+v, %v", all, err)
+	}
+}
+
+func TestAuthenticate_TracksToken(t *testing.T) {
+	ctrl := createTestController(t)
+	tracker := &recordingTracker{err: errors.New("bucket unavailable")}
+	WithTokenTracker(tracker)(ctrl)
+
+	result, err := ctrl.Authenticate(context.Background(), natsjwt.ConnectOptions{
+		Token: `{"account":"test-account","token":"alice:secret123"}`,
+	}, "", time.Hour)
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v (tracking failures must not fail authentication)", err)
+	}
+	claims, err := natsjwt.DecodeUserClaims(result.JWT)
+	if err != nil {
+		t.Fatalf("decoding JWT: %v", err)
+	}
+	if claims.ID == "" || result.TokenID != claims.ID {
+		t.Errorf("TokenID = %q, want jti %q", result.TokenID, claims.ID)
+	}
+
+	if len(tracker.tokens) != 1 {
+		t.Fatalf("tracked %d tokens, want 1", len(tracker.tokens))
+	}
+	got := tracker.tokens[0]
+	if got.ID != claims.ID || got.UserID != "alice" || got.Account != "test-account" || got.UserPublicKey != claims.Subject {
+		t.Errorf("tracked token = %+v", got)
+	}
+	if got.AccountKey == "" || got.IssuedAt.Unix() != claims.IssuedAt || got.ExpiresAt == nil || got.ExpiresAt.Unix() != claims.Expires {
+		t.Errorf("tracked token times or account key = %+v", got)
+	}
+}
+
+func TestAdminService_Revoke(t *testing.T) {
+	s := newTestAdminService(t)
+	header := nats.Header{AdminTokenHeader: []string{"s3cret"}}
+
+	if resp := s.serveRevokeRequest(AdminRevocationsSubject, header, nil); resp.Error == nil || resp.Error.Code != "revocation_disabled" {
+		t.Fatalf("without list: error = %+v, want revocation_disabled", resp.Error)
+	}
+
+	list := &RevocationList{kv: newMemKV(), now: time.Now}
+	WithAdminRevocationList(list)(s)
+	if err := list.Track(context.Background(), IssuedToken{ID: "JTI1", Account: "test-account", UserID: "alice"}); err != nil {
+		t.Fatalf("Track() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		subject  string
+		header   nats.Header
+		data     string
+		wantCode string
+	}{
+		{name: "unauthorized", subject: AdminRevokeSubject, header: nil, data: `{"jti":"JTI1"}`, wantCode: "unauthorized"},
+		{name: "missing jti", subject: AdminRevokeSubject, header: header, data: `{}`, wantCode: "invalid_request"},
+		{name: "invalid payload", subject: AdminRevokeSubject, header: header, data: `{`, wantCode: "invalid_request"},
+		{name: "unknown jti", subject: AdminRevokeSubject, header: header, data: `{"jti":"JTI2"}`, wantCode: "not_found"},
+		{name: "revoke", subject: AdminRevokeSubject, header: header, data: `{"jti":"JTI1","reason":"offboarded"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := s.serveRevokeRequest(tt.subject, tt.header, []byte(tt.data))
+			if tt.wantCode != "" {
+				if resp.Error == nil || resp.Error.Code != tt.wantCode {
+					t.Fatalf("error = %+v, want %s", resp.Error, tt.wantCode)
+				}
+				return
+			}
+			if resp.Error != nil || resp.Revoked == nil || resp.Revoked.UserID != "alice" || resp.Revoked.Reason != "offboarded" {
+				t.Fatalf("response = %+v", resp)
+			}
+		})
+	}
+
+	resp := s.serveRevokeRequest(AdminRevocationsSubject, header, nil)
+	if resp.Error != nil || len(resp.Revocations) != 1 || resp.Revocations[0].ID != "JTI1" {
+		t.Fatalf("revocations = %+v", resp)
+	}
+	data, err := json.Marshal(resp)
+	if err != nil || !strings.Contains(string(data), `"jti":"JTI1"`) {
+		t.Errorf("encoded response = %s, %v", data, err)
+	}
+}
+
+func TestApplyRevocations(t *testing.T) {
+	operator, err := nkeys.CreateOperator()
+	if err != nil {
+		t.Fatalf("creating operator key: %v", err)
+	}
+	operatorSeed, _ := operator.Seed()
+	signer, err := jwt.NewLocalSigner(string(operatorSeed))
+	if err != nil {
+		t.Fatalf("creating signer: %v", err)
+	}
+	account, _ := nkeys.CreateAccount()
+	accountPub, _ := account.PublicKey()
+	accountJWT, err := natsjwt.NewAccountClaims(accountPub).Encode(operator)
+	if err != nil {
+		t.Fatalf("encoding account JWT: %v", err)
+	}
+	user, _ := nkeys.CreateUser()
+	userPub, _ := user.PublicKey()
+
+	issuedAt := time.Unix(1700000000, 0)
+	tokens := []RevokedToken{{IssuedToken: IssuedToken{ID: "JTI", UserPublicKey: userPub, IssuedAt: issuedAt}}}
+	updated, changed, err := applyRevocations(accountJWT, tokens, signer)
+	if err != nil || !changed {
+		t.Fatalf("applyRevocations() = %v, %v", changed, err)
+	}
+	claims, err := natsjwt.DecodeAccountClaims(updated)
+	if err != nil {
+		t.Fatalf("decoding updated JWT: %v", err)
+	}
+	if claims.Issuer != signer.PublicKey() {
+		t.Errorf("issuer = %s, want the operator signing key", claims.Issuer)
+	}
+	revokedClaims := natsjwt.NewUserClaims(userPub)
+	revokedClaims.IssuedAt = issuedAt.Unix()
+	if !claims.IsClaimRevoked(revokedClaims) {
+		t.Error("token issued at the revocation time is not revoked")
+	}
+	laterClaims := natsjwt.NewUserClaims(userPub)
+	laterClaims.IssuedAt = issuedAt.Add(time.Minute).Unix()
+	if claims.IsClaimRevoked(laterClaims) {
+		t.Error("token issued after the revocation is revoked")
+	}
+
+	if _, changed, err := applyRevocations(updated, tokens, signer); err != nil || changed {
+		t.Errorf("reapplying = %v, %v, want unchanged", changed, err)
+	}
+}
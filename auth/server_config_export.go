@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+
+	"github.com/msimon/nauts/identity"
+)
+
+// ServerConfigUser is a user of an exported nats-server configuration.
+type ServerConfigUser struct {
+	Account string `json:"account"`
+	// User is the username of the file provider, or "<account>/<username>"
+	// for users of several accounts, like in server.userPassword.
+	User string `json:"user"`
+	// Password is the bcrypt hash of the user's password, which nats-server
+	// verifies itself.
+	Password    string              `json:"password"`
+	Permissions natsjwt.Permissions `json:"permissions"`
+	Provider    string              `json:"provider"`
+	Roles       []string            `json:"roles,omitempty"`
+}
+
+// ServerConfigExport is the result of ExportServerConfig.
+type ServerConfigExport struct {
+	Users []ServerConfigUser `json:"users"`
+	// Warnings lists users that were skipped and permissions that static
+	// configuration cannot express.
+	Warnings []string `json:"warnings"`
+}
+
+// ExportServerConfig compiles the permissions of every user of the file
+// authentication providers in config, so that a nats-server can authorize
+// them from its own configuration instead of calling out to nauts. Role
+// mapping and user ID normalization are applied as in Authenticate; the
+// client is unknown, so client.* variables and conditions never match. Users
+// whose password hash is not bcrypt cannot be verified by nats-server and are
+// skipped. Users are sorted by account and user.
+func (c *AuthController) ExportServerConfig(ctx context.Context, config *Config) (*ServerConfigExport, error) {
+	export := &ServerConfigExport{Users: []ServerConfigUser{}, Warnings: []string{}}
+	warn := func(format string, args ...any) {
+		export.Warnings = append(export.Warnings, fmt.Sprintf(format, args...))
+	}
+	seen := make(map[string]string)
+	for _, fc := range config.Auth.File {
+		store, err := identity.NewFileUserStore(fc.UsersPath, identity.PasswordHashingConfig{})
+		if err != nil {
+			return nil, fmt.Errorf("file authentication provider %q: %w", fc.ID, err)
+		}
+		users, err := store.List()
+		if err != nil {
+			return nil, fmt.Errorf("file authentication provider %q: %w", fc.ID, err)
+		}
+		var mapper identity.RoleMapper
+		if fc.RoleMapping != nil {
+			if mapper, err = identity.NewRoleMapper(*fc.RoleMapping); err != nil {
+				return nil, fmt.Errorf("auth.file[%s].roleMapping: %w", fc.ID, err)
+			}
+		}
+		for _, fu := range users {
+			if fu.Algorithm != identity.PasswordAlgorithmBcrypt {
+				warn("%s: user %s skipped: nats-server only verifies bcrypt password hashes", fc.ID, fu.Username)
+				continue
+			}
+			user, err := exportedIdentityUser(ctx, fu, mapper)
+			if err != nil {
+				warn("%s: user %s skipped: %v", fc.ID, fu.Username, err)
+				continue
+			}
+			user = c.normalizeUserID(fc.ID, user)
+			for _, account := range fu.Accounts {
+				name := fu.Username
+				if len(fu.Accounts) > 1 {
+					name = account + "/" + fu.Username
+				}
+				if other, ok := seen[name]; ok {
+					warn("%s: user %s skipped: already exported from %s", fc.ID, name, other)
+					continue
+				}
+				scoped, err := c.ScopeUserToAccount(ctx, user, account)
+				if err != nil {
+					warn("%s: user %s skipped: %v", fc.ID, name, err)
+					continue
+				}
+				result, err := c.CompileNatsPermissions(ctx, scoped)
+				if err != nil {
+					return nil, fmt.Errorf("compiling permissions of %s in account %s: %w", fu.Username, account, err)
+				}
+				for _, w := range result.Warnings {
+					warn("%s: user %s: %s", fc.ID, name, w)
+				}
+				if !result.Limits.IsZero() {
+					warn("%s: user %s: connection limits cannot be exported", fc.ID, name)
+				}
+				seen[name] = fc.ID
+				roles := make([]string, 0, len(result.Roles))
+				for _, role := range result.Roles {
+					roles = append(roles, role.String())
+				}
+				export.Users = append(export.Users, ServerConfigUser{
+					Account:     account,
+					User:        name,
+					Password:    fu.PasswordHash,
+					Permissions: result.Permissions.ToNatsJWT(),
+					Provider:    fc.ID,
+					Roles:       roles,
+				})
+			}
+		}
+	}
+	slices.SortFunc(export.Users, func(a, b ServerConfigUser) int {
+		if n := strings.Compare(a.Account, b.Account); n != 0 {
+			return n
+		}
+		return strings.Compare(a.User, b.User)
+	})
+	return export, nil
+}
+
+// exportedIdentityUser returns the user the file provider would verify for
+// fu, with its roles mapped by mapper if not nil.
+func exportedIdentityUser(ctx context.Context, fu identity.FileUser, mapper identity.RoleMapper) (*identity.User, error) {
+	user := &identity.User{ID: fu.Username, Attributes: fu.Attributes, Groups: fu.Groups}
+	for _, roleID := range fu.Roles {
+		// Invalid roles are skipped, as by the provider.
+		if role, err := identity.ParseRoleID(roleID); err == nil {
+			user.Roles = append(user.Roles, role)
+		}
+	}
+	if mapper != nil {
+		roles, err := mapper.MapRoles(ctx, user)
+		if err != nil {
+			return nil, fmt.Errorf("mapping roles: %w", err)
+		}
+		user.Roles = roles
+	}
+	return user, nil
+}
+
+// WriteNatsConfig writes the export as an accounts block of a nats-server
+// configuration file.
+func (e *ServerConfigExport) WriteNatsConfig(w io.Writer) error {
+	b := &strings.Builder{}
+	b.WriteString("# Generated by nauts. Passwords are bcrypt hashes.\n")
+	b.WriteString("accounts {\n")
+	for i, u := range e.Users {
+		if i == 0 || e.Users[i-1].Account != u.Account {
+			fmt.Fprintf(b, "  %s {\n    users = [\n", strconv.Quote(u.Account))
+		}
+		fmt.Fprintf(b, "      {\n")
+		fmt.Fprintf(b, "        # provider %s, roles %s\n", u.Provider, strings.Join(u.Roles, ", "))
+		fmt.Fprintf(b, "        user = %s\n", strconv.Quote(u.User))
+		fmt.Fprintf(b, "        password = %s\n", strconv.Quote(u.Password))
+		fmt.Fprintf(b, "        permissions {\n")
+		writeNatsConfigPermission(b, "publish", u.Permissions.Pub)
+		writeNatsConfigPermission(b, "subscribe", u.Permissions.Sub)
+		if r := u.Permissions.Resp; r != nil {
+			if r.MaxMsgs == 0 && r.Expires == 0 {
+				fmt.Fprintf(b, "          allow_responses = true\n")
+			} else {
+				fmt.Fprintf(b, "          allow_responses {")
+				if r.MaxMsgs != 0 {
+					fmt.Fprintf(b, " max = %d", r.MaxMsgs)
+				}
+				if r.Expires != 0 {
+					fmt.Fprintf(b, " expires = %s", strconv.Quote(r.Expires.String()))
+				}
+				fmt.Fprintf(b, " }\n")
+			}
+		}
+		fmt.Fprintf(b, "        }\n")
+		fmt.Fprintf(b, "      }\n")
+		if i == len(e.Users)-1 || e.Users[i+1].Account != u.Account {
+			fmt.Fprintf(b, "    ]\n  }\n")
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeNatsConfigPermission writes the allow and deny lists of p.
+func writeNatsConfigPermission(b *strings.Builder, name string, p natsjwt.Permission) {
+	fmt.Fprintf(b, "          %s {\n", name)
+	for _, list := range []struct {
+		name     string
+		subjects []string
+	}{{"allow", p.Allow}, {"deny", p.Deny}} {
+		if len(list.subjects) == 0 {
+			continue
+		}
+		quoted := make([]string, 0, len(list.subjects))
+		for _, s := range list.subjects {
+			quoted = append(quoted, strconv.Quote(s))
+		}
+		fmt.Fprintf(b, "            %s = [%s]\n", list.name, strings.Join(quoted, ", "))
+	}
+	fmt.Fprintf(b, "          }\n")
+}
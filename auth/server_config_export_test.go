@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/msimon/nauts/identity"
+)
+
+func TestExportServerConfig(t *testing.T) {
+	ctrl := createTestController(t)
+	usersPath := filepath.Join(t.TempDir(), "users.json")
+	store, err := identity.NewFileUserStore(usersPath, identity.PasswordHashingConfig{Cost: bcrypt.MinCost})
+	if err != nil {
+		t.Fatalf("NewFileUserStore() error = %v", err)
+	}
+	for _, u := range []identity.FileUser{
+		{Username: "alice", Accounts: []string{"test-account"}, Roles: []string{"test-account.workers"}},
+		{Username: "carol", Accounts: []string{"test-account", "other-account"}},
+	} {
+		if err := store.Add(u, "secret"); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+	argon2id, err := identity.NewFileUserStore(usersPath, identity.PasswordHashingConfig{Algorithm: identity.PasswordAlgorithmArgon2id, Cost: 1})
+	if err != nil {
+		t.Fatalf("NewFileUserStore() error = %v", err)
+	}
+	if err := argon2id.Add(identity.FileUser{Username: "bob", Accounts: []string{"test-account"}}, "secret"); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	config := &Config{Auth: AuthConfig{File: []FileAuthProviderConfig{{ID: "local", Accounts: []string{"*"}, UsersPath: usersPath}}}}
+	export, err := ctrl.ExportServerConfig(context.Background(), config)
+	if err != nil {
+		t.Fatalf("ExportServerConfig() error = %v", err)
+	}
+
+	var names []string
+	for _, u := range export.Users {
+		names = append(names, u.Account+":"+u.User)
+	}
+	if want := []string{"other-account:other-account/carol", "test-account:alice", "test-account:test-account/carol"}; !slices.Equal(names, want) {
+		t.Errorf("exported users = %v, want %v", names, want)
+	}
+	if !slices.ContainsFunc(export.Warnings, func(w string) bool { return strings.Contains(w, "user bob skipped") }) {
+		t.Errorf("warnings = %q, want bob skipped for its argon2id hash", export.Warnings)
+	}
+
+	// The configuration must load in nats-server with the compiled permissions.
+	var buf bytes.Buffer
+	if err := export.WriteNatsConfig(&buf); err != nil {
+		t.Fatalf("WriteNatsConfig() error = %v", err)
+	}
+	confPath := filepath.Join(t.TempDir(), "server.conf")
+	if err := os.WriteFile(confPath, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	opts, err := server.ProcessConfigFile(confPath)
+	if err != nil {
+		t.Fatalf("ProcessConfigFile() error = %v\n%s", err, buf.String())
+	}
+	var alice *server.User
+	for _, u := range opts.Users {
+		if u.Username == "alice" {
+			alice = u
+		}
+	}
+	if alice == nil || alice.Account == nil || alice.Account.Name != "test-account" {
+		t.Fatalf("nats-server users = %+v, want alice in test-account", opts.Users)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(alice.Password), []byte("secret")) != nil {
+		t.Error("alice's password is not the bcrypt hash of the users file")
+	}
+	if p := alice.Permissions; p == nil || p.Publish == nil || !slices.Equal(p.Publish.Allow, []string{"test.>"}) {
+		t.Errorf("alice's permissions = %+v, want publish to test.>", p)
+	}
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// SubscriptionStats is a snapshot of the back-pressure counters of one
+// callout subscription.
+type SubscriptionStats struct {
+	Subject string `json:"subject"`
+	// Pending and PendingBytes are the requests currently buffered.
+	Pending      int `json:"pending"`
+	PendingBytes int `json:"pending_bytes"`
+	// MaxPending and MaxPendingBytes are the highest values seen.
+	MaxPending      int `json:"max_pending"`
+	MaxPendingBytes int `json:"max_pending_bytes"`
+	// PendingLimit and PendingBytesLimit are the effective limits; -1 means
+	// unlimited.
+	PendingLimit      int `json:"pending_limit"`
+	PendingBytesLimit int `json:"pending_bytes_limit"`
+	// Delivered counts requests handed to the service, Dropped the requests
+	// discarded because a limit was reached.
+	Delivered int64 `json:"delivered"`
+	Dropped   int   `json:"dropped"`
+	// SlowConsumerEvents counts the times the subscription became a slow
+	// consumer.
+	SlowConsumerEvents uint64 `json:"slow_consumer_events"`
+}
+
+// setPendingLimits applies the configured pending limits to sub. Limits left
+// at 0 keep the client defaults.
+func (s *CalloutService) setPendingLimits(sub *nats.Subscription) error {
+	msgs, bytes := s.config.PendingMsgsLimit, s.config.PendingBytesLimit
+	if msgs == 0 && bytes == 0 {
+		return nil
+	}
+	if msgs == 0 {
+		msgs = nats.DefaultSubPendingMsgsLimit
+	}
+	if bytes == 0 {
+		bytes = nats.DefaultSubPendingBytesLimit
+	}
+	return sub.SetPendingLimits(msgs, bytes)
+}
+
+// handleAsyncError counts slow consumer events and logs them at most once per
+// SlowConsumerLogInterval; other asynchronous errors are logged directly.
+func (s *CalloutService) handleAsyncError(_ *nats.Conn, sub *nats.Subscription, err error) {
+	if sub == nil || !errors.Is(err, nats.ErrSlowConsumer) {
+		s.logger.Warn("NATS error: %v", err)
+		return
+	}
+
+	s.statsMu.Lock()
+	s.slowConsumers[sub.Subject]++
+	events := s.slowConsumers[sub.Subject]
+	now := time.Now()
+	shouldLog := now.Sub(s.lastSlowLog) >= s.config.SlowConsumerLogInterval
+	if shouldLog {
+		s.lastSlowLog = now
+	}
+	s.statsMu.Unlock()
+
+	if shouldLog {
+		dropped, _ := sub.Dropped()
+		pending, pendingBytes, _ := sub.Pending()
+		s.logger.Warn("slow consumer on %s: %d requests dropped so far (%d events), %d requests (%d bytes) pending; consider raising server.subscription limits or adding instances",
+			sub.Subject, dropped, events, pending, pendingBytes)
+	}
+}
+
+// SubscriptionStats returns the back-pressure counters of the callout
+// subscriptions, or nil before Start.
+func (s *CalloutService) SubscriptionStats() []SubscriptionStats {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	var result []SubscriptionStats
+	for _, sub := range s.subs {
+		stats := SubscriptionStats{
+			Subject:            sub.Subject,
+			SlowConsumerEvents: s.slowConsumers[sub.Subject],
+		}
+		// The getters fail only for closed subscriptions; report zeros then.
+		stats.Pending, stats.PendingBytes, _ = sub.Pending()
+		stats.MaxPending, stats.MaxPendingBytes, _ = sub.MaxPending()
+		stats.PendingLimit, stats.PendingBytesLimit, _ = sub.PendingLimits()
+		stats.Delivered, _ = sub.Delivered()
+		stats.Dropped, _ = sub.Dropped()
+		result = append(result, stats)
+	}
+	return result
+}
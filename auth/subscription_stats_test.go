@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestCalloutService_SlowConsumerEvents(t *testing.T) {
+	logger := &testLogger{}
+	svc, err := NewCalloutService(&AuthController{}, CalloutConfig{
+		NatsCredentials:         "/path/to/creds",
+		SlowConsumerLogInterval: time.Hour,
+	}, WithCalloutLogger(logger))
+	if err != nil {
+		t.Fatalf("NewCalloutService() error = %v", err)
+	}
+	sub := &nats.Subscription{Subject: AuthCalloutSubject}
+	svc.subs = []*nats.Subscription{sub}
+
+	svc.handleAsyncError(nil, sub, nats.ErrSlowConsumer)
+	svc.handleAsyncError(nil, sub, nats.ErrSlowConsumer)
+
+	if len(logger.warnings) != 1 {
+		t.Errorf("warnings = %d, want 1 (rate-limited)", len(logger.warnings))
+	}
+	stats := svc.SubscriptionStats()
+	if len(stats) != 1 {
+		t.Fatalf("SubscriptionStats() = %+v, want one subscription", stats)
+	}
+	if stats[0].Subject != AuthCalloutSubject || stats[0].SlowConsumerEvents != 2 {
+		t.Errorf("SubscriptionStats()[0] = %+v, want 2 slow consumer events on %s", stats[0], AuthCalloutSubject)
+	}
+
+	// Other asynchronous errors are logged without rate limiting.
+	svc.handleAsyncError(nil, nil, errors.New("permissions violation"))
+	if len(logger.warnings) != 2 {
+		t.Errorf("warnings = %d, want 2", len(logger.warnings))
+	}
+}
+
+func TestCalloutService_SubscriptionStatsBeforeStart(t *testing.T) {
+	svc, err := NewCalloutService(&AuthController{}, CalloutConfig{NatsCredentials: "/path/to/creds"})
+	if err != nil {
+		t.Fatalf("NewCalloutService() error = %v", err)
+	}
+	if stats := svc.SubscriptionStats(); stats != nil {
+		t.Errorf("SubscriptionStats() = %+v, want nil", stats)
+	}
+}
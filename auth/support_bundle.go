@@ -0,0 +1,397 @@
+package auth
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultSupportBundleLogLines is the number of lines kept from the end
+	// of each log file.
+	DefaultSupportBundleLogLines = 1000
+
+	// supportBundleMetricsTimeout bounds the request for the metrics snapshot.
+	supportBundleMetricsTimeout = 10 * time.Second
+)
+
+// SupportBundleOptions configures WriteSupportBundle.
+type SupportBundleOptions struct {
+	// ConfigPath is the configuration file of the instance.
+	ConfigPath string
+
+	// Version is the version of the nauts binary.
+	Version string
+
+	// LogFiles are read from the end, LogLines lines each.
+	LogFiles []string
+	LogLines int
+
+	// Logs are added as they are, e.g. the output of journalctl.
+	Logs []SupportBundleLog
+
+	// HTTPClient fetches the metrics snapshot from server.http. If nil, a
+	// client trusting the system roots and server.http.tls.certFile is used.
+	HTTPClient *http.Client
+
+	// Now returns the creation time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// SupportBundleLog is a log collected by the caller.
+type SupportBundleLog struct {
+	Name string
+	Data []byte
+}
+
+// SupportBundleManifest lists the contents of a support bundle and the
+// sections that could not be collected.
+type SupportBundleManifest struct {
+	CreatedAt time.Time         `json:"created_at"`
+	Files     []string          `json:"files"`
+	Errors    map[string]string `json:"errors,omitempty"`
+}
+
+// SortedErrors returns the sections that could not be collected, sorted.
+func (m *SupportBundleManifest) SortedErrors() []string {
+	sections := make([]string, 0, len(m.Errors))
+	for section := range m.Errors {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+	return sections
+}
+
+// SupportBundleVersion describes the binary and platform a bundle was
+// created with.
+type SupportBundleVersion struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+}
+
+// WriteSupportBundle writes a gzipped tarball with what bug reports need:
+//
+//	version.json         binary version and platform
+//	config/config.json   the configuration with secrets redacted
+//	config/summary.json  the effective configuration, as logged on startup
+//	validation.json      provider status and policy findings (nauts validate)
+//	metrics.json         GET /metrics of the running instance, if server.http is set
+//	logs/*               the end of each log, with tokens and seeds redacted
+//	manifest.json        the files above and the sections that failed
+//
+// A section that cannot be collected is recorded in the manifest rather than
+// failing the bundle; only errors writing to w are returned.
+func WriteSupportBundle(ctx context.Context, w io.Writer, opts SupportBundleOptions) (*SupportBundleManifest, error) {
+	now := time.Now
+	if opts.Now != nil {
+		now = opts.Now
+	}
+	created := now().UTC()
+	prefix := "nauts-support-" + created.Format("20060102-150405") + "/"
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	manifest := &SupportBundleManifest{CreatedAt: created, Errors: map[string]string{}}
+
+	add := func(name string, data []byte) error {
+		hdr := &tar.Header{
+			Name:    prefix + name,
+			Mode:    0o600,
+			Size:    int64(len(data)),
+			ModTime: created,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("writing %s: %w", name, err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			return fmt.Errorf("writing %s: %w", name, err)
+		}
+		manifest.Files = append(manifest.Files, name)
+		return nil
+	}
+	addJSON := func(name string, v any) error {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			manifest.Errors[name] = err.Error()
+			return nil
+		}
+		return add(name, append(data, '\n'))
+	}
+
+	if err := addJSON("version.json", SupportBundleVersion{
+		Version:   opts.Version,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+	}); err != nil {
+		return nil, err
+	}
+
+	config, err := LoadConfig(opts.ConfigPath)
+	if err != nil {
+		manifest.Errors["config"] = err.Error()
+	} else {
+		redacted, err := redactedConfig(config)
+		if err != nil {
+			manifest.Errors["config/config.json"] = err.Error()
+		} else if err := addJSON("config/config.json", redacted); err != nil {
+			return nil, err
+		}
+		if err := addJSON("config/summary.json", config.Summary()); err != nil {
+			return nil, err
+		}
+	}
+
+	validation, err := json.MarshalIndent(ValidateConfigFile(ctx, opts.ConfigPath), "", "  ")
+	if err != nil {
+		manifest.Errors["validation.json"] = err.Error()
+	} else if err := add("validation.json", append([]byte(redactSecrets(string(validation))), '\n')); err != nil {
+		return nil, err
+	}
+
+	if config != nil && config.Server.HTTP != nil {
+		metrics, err := fetchSupportBundleMetrics(ctx, opts.HTTPClient, config.Server.HTTP)
+		if err != nil {
+			manifest.Errors["metrics.json"] = err.Error()
+		} else if err := add("metrics.json", metrics); err != nil {
+			return nil, err
+		}
+	}
+
+	lines := opts.LogLines
+	if lines <= 0 {
+		lines = DefaultSupportBundleLogLines
+	}
+	for _, path := range opts.LogFiles {
+		name := "logs/" + filepath.Base(path)
+		data, err := tailFile(path, lines)
+		if err != nil {
+			manifest.Errors[name] = err.Error()
+			continue
+		}
+		if err := add(name, []byte(redactSecrets(string(data)))); err != nil {
+			return nil, err
+		}
+	}
+	for _, l := range opts.Logs {
+		if err := add("logs/"+l.Name, []byte(redactSecrets(string(l.Data)))); err != nil {
+			return nil, err
+		}
+	}
+
+	// The manifest lists itself, so that the file list is complete.
+	manifest.Files = append(manifest.Files, "manifest.json")
+	if len(manifest.Errors) == 0 {
+		manifest.Errors = nil
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encoding manifest: %w", err)
+	}
+	hdr := &tar.Header{Name: prefix + "manifest.json", Mode: 0o600, Size: int64(len(data) + 1), ModTime: created}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return nil, fmt.Errorf("writing manifest.json: %w", err)
+	}
+	if _, err := tw.Write(append(data, '\n')); err != nil {
+		return nil, fmt.Errorf("writing manifest.json: %w", err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("closing tarball: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("closing tarball: %w", err)
+	}
+	return manifest, nil
+}
+
+// supportBundleSecretKeys are substrings of configuration keys whose string
+// values are redacted. Keys naming a file or path are kept, as they only point
+// to the secret.
+var supportBundleSecretKeys = []string{"password", "secret", "token", "seed", "dsn", "privatekey", "apikey"}
+
+// redactedConfig returns the configuration as generic JSON with secret values
+// and the user info of URLs redacted. Custom provider configurations are
+// redacted the same way.
+func redactedConfig(c *Config) (any, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("encoding configuration: %w", err)
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("decoding configuration: %w", err)
+	}
+	return redactValue("", v), nil
+}
+
+func redactValue(key string, v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			v[k] = redactValue(k, child)
+		}
+		return v
+	case []any:
+		for i, child := range v {
+			v[i] = redactValue(key, child)
+		}
+		return v
+	case string:
+		if v != "" && isSecretKey(key) {
+			return "redacted"
+		}
+		if strings.Contains(v, "://") {
+			v = redactURL(v)
+		}
+		return redactSecrets(v)
+	default:
+		return v
+	}
+}
+
+func isSecretKey(key string) bool {
+	k := strings.ToLower(key)
+	if strings.HasSuffix(k, "file") || strings.HasSuffix(k, "path") {
+		return false
+	}
+	for _, s := range supportBundleSecretKeys {
+		if strings.Contains(k, s) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// jwtPattern matches JWTs, such as user JWTs and identity provider tokens.
+	jwtPattern = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	// nkeySeedPattern matches NATS nkey seeds.
+	nkeySeedPattern = regexp.MustCompile(`\bS[ACNOPUX][A-Z2-7]{56}\b`)
+	// urlUserInfoPattern matches the user info of URLs.
+	urlUserInfoPattern = regexp.MustCompile(`://[^/\s@"]+@`)
+	// bearerPattern matches bearer tokens in logged HTTP headers.
+	bearerPattern = regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/=-]+`)
+)
+
+// redactSecrets replaces the JWTs, nkey seeds, bearer tokens, and URL user
+// info in text.
+func redactSecrets(text string) string {
+	text = jwtPattern.ReplaceAllString(text, "redacted-jwt")
+	text = nkeySeedPattern.ReplaceAllString(text, "redacted-seed")
+	text = urlUserInfoPattern.ReplaceAllString(text, "://redacted@")
+	return bearerPattern.ReplaceAllString(text, "Bearer redacted")
+}
+
+// tailFile returns the last n lines of the file at path.
+func tailFile(path string, n int) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ring := make([]string, 0, n)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(ring) == n {
+			ring = ring[1:]
+		}
+		ring = append(ring, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	var buf bytes.Buffer
+	for _, line := range ring {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// fetchSupportBundleMetrics requests GET /metrics from the HTTP listener of
+// the running instance, authenticated with the configured token.
+func fetchSupportBundleMetrics(ctx context.Context, client *http.Client, c *HTTPConfig) ([]byte, error) {
+	token, err := c.GetToken()
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, fmt.Errorf("server.http has no tokenFile; metrics require a client certificate")
+	}
+
+	host, port, err := net.SplitHostPort(c.Address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server.http.address: %w", err)
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	scheme := "http"
+	if c.TLS != nil {
+		scheme = "https"
+	}
+	if client == nil {
+		client = supportBundleHTTPClient(c.TLS)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, supportBundleMetricsTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, scheme+"://"+net.JoinHostPort(host, port)+"/metrics", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading metrics: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET /metrics: %s", resp.Status)
+	}
+	return data, nil
+}
+
+// supportBundleHTTPClient returns a client trusting the system roots and,
+// for self-signed listeners, the listener's own certificate.
+func supportBundleHTTPClient(c *HTTPTLSConfig) *http.Client {
+	if c == nil {
+		return &http.Client{}
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if data, err := os.ReadFile(c.CertFile); err == nil {
+		pool.AppendCertsFromPEM(data)
+	}
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+	}}
+}
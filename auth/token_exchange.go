@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+
+	"github.com/msimon/nauts/authrpc"
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/units"
+)
+
+// Codes of failed token exchanges, mapped to gRPC and HTTP statuses by the
+// services serving them.
+const (
+	exchangeInvalidRequest = "invalid_request"
+	exchangeUnauthorized   = "unauthorized"
+	exchangeUnavailable    = "unavailable"
+	exchangeRateLimited    = "rate_limited"
+	exchangeInternal       = "internal"
+)
+
+// exchangeTTL returns the lifetime of a JWT issued by a token exchange:
+// defaultTTL, or the shorter duration requested.
+func exchangeTTL(defaultTTL time.Duration, requested string) (time.Duration, error) {
+	if requested == "" {
+		return defaultTTL, nil
+	}
+	d, err := units.ParseDuration(requested)
+	if err != nil || d <= 0 {
+		return 0, errors.New("invalid ttl")
+	}
+	if defaultTTL == 0 || d < defaultTTL {
+		return d, nil
+	}
+	return defaultTTL, nil
+}
+
+// exchangeToken authenticates connectOptions outside of auth callout and
+// returns the issued JWT. Without userPublicKey, it generates a key pair and
+// returns its seed and a creds file, since the controller's ephemeral keys
+// are discarded after signing. If limiter is set, requests are throttled per
+// account and per user like callout requests.
+func exchangeToken(ctx context.Context, controller *AuthController, limiter *RateLimiter, connectOptions natsjwt.ConnectOptions, userPublicKey string, ttl time.Duration) (*authrpc.AuthenticateResponse, error) {
+	// Like in auth callout, requests whose account cannot be determined are
+	// not throttled here; they are rejected by Authenticate.
+	if limiter != nil {
+		if req, err := controller.authRequest(connectOptions); err == nil {
+			if err := limiter.AllowAccount(req.Account); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	seed := ""
+	if userPublicKey == "" && controller.userKeyStrategy != UserKeyReject {
+		kp, err := nkeys.CreateUser()
+		if err != nil {
+			return nil, &PhaseError{Phase: "user_key", Err: err}
+		}
+		userPublicKey, _ = kp.PublicKey()
+		rawSeed, _ := kp.Seed()
+		seed = string(rawSeed)
+	}
+
+	result, err := controller.Authenticate(ctx, connectOptions, userPublicKey, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if limiter != nil {
+		if err := limiter.AllowUser(result.User.Account, result.User.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	resp := &authrpc.AuthenticateResponse{
+		JWT:           result.JWT,
+		UserPublicKey: result.UserPublicKey,
+		Account:       result.User.Account,
+		UserID:        result.User.ID,
+		Provider:      result.AuthProviderId,
+		TokenID:       result.TokenID,
+	}
+	for _, role := range result.CompilationResult.Roles {
+		resp.Roles = append(resp.Roles, role.String())
+	}
+	if claims, err := natsjwt.DecodeUserClaims(result.JWT); err == nil && claims.Expires > 0 {
+		expires := time.Unix(claims.Expires, 0).UTC()
+		resp.ExpiresAt = &expires
+	}
+	if seed != "" {
+		creds, err := natsjwt.FormatUserConfig(result.JWT, []byte(seed))
+		if err != nil {
+			return nil, &PhaseError{Phase: "create_jwt", Err: err}
+		}
+		resp.Seed = seed
+		resp.Creds = string(creds)
+	}
+	return resp, nil
+}
+
+// exchangeErrorCode classifies an error of exchangeToken. Like the callout
+// responses, failed exchanges report only the code.
+func exchangeErrorCode(err error) string {
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, identity.ErrProviderUnavailable) {
+		return exchangeUnavailable
+	}
+	if errors.Is(err, ErrRateLimited) {
+		return exchangeRateLimited
+	}
+	var phaseErr *PhaseError
+	if errors.As(err, &phaseErr) {
+		switch phaseErr.Phase {
+		case "validate_user_key", "parse_request":
+			return exchangeInvalidRequest
+		case "user_key", "create_jwt":
+			return exchangeInternal
+		}
+	}
+	return exchangeUnauthorized
+}
@@ -0,0 +1,336 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/policy"
+	"github.com/msimon/nauts/provider"
+)
+
+// Usage rules reported in a UsageFinding.
+const (
+	// UsageRuleUnusedBinding: no user was issued the role in the window.
+	UsageRuleUnusedBinding = "unused-binding"
+	// UsageRuleUnusedPolicy: the policy is only bound to unused roles.
+	UsageRuleUnusedPolicy = "unused-policy"
+	// UsageRuleUnusedSubscribe: the role was issued, but no subscription in
+	// its account was covered by the subscribe permission.
+	UsageRuleUnusedSubscribe = "unused-subscribe"
+)
+
+const (
+	// serverSubszSubject collects the subscriptions of all servers.
+	serverSubszSubject = "$SYS.REQ.SERVER.PING.SUBSZ"
+
+	// serverSubszLimit is the number of subscriptions requested per server.
+	serverSubszLimit = 100000
+)
+
+// AuditUsage counts the roles issued by successful authentications in an
+// audit log, within a time window.
+type AuditUsage struct {
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+	// Records is the number of audit records in the window.
+	Records int `json:"records"`
+	// Roles maps "<account>.<role>" to its issuances.
+	Roles map[string]*RoleUsage `json:"roles"`
+}
+
+// RoleUsage counts the issuances of one role.
+type RoleUsage struct {
+	Issued     int       `json:"issued"`
+	LastIssued time.Time `json:"last_issued"`
+}
+
+// ReadAuditUsage reads newline-delimited audit records from r (e.g. the
+// file of server.audit.file) and counts the roles of successful
+// authentications between since and until. A zero until means no upper bound.
+// The hash chain is not verified; use VerifyAuditChain for that.
+func ReadAuditUsage(r io.Reader, since, until time.Time) (*AuditUsage, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	usage := &AuditUsage{Since: since, Until: until, Roles: make(map[string]*RoleUsage)}
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		var e AuditEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, fmt.Errorf("decoding audit record on line %d: %w", line, err)
+		}
+		if e.Time.Before(since) || (!until.IsZero() && e.Time.After(until)) {
+			continue
+		}
+		usage.Records++
+		if e.Result != AuditResultSuccess {
+			continue
+		}
+		for _, role := range e.Roles {
+			u := usage.Roles[role]
+			if u == nil {
+				u = &RoleUsage{}
+				usage.Roles[role] = u
+			}
+			u.Issued++
+			if e.Time.After(u.LastIssued) {
+				u.LastIssued = e.Time
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading audit records: %w", err)
+	}
+	return usage, nil
+}
+
+// ServerSubscription is a subscription reported by a NATS server.
+type ServerSubscription struct {
+	// Account is the account name, or its public key in operator mode.
+	Account string `json:"account"`
+	// AccountTag is the account name in operator mode.
+	AccountTag string `json:"account_tag,omitempty"`
+	Subject    string `json:"subject"`
+	Queue      string `json:"qgroup,omitempty"`
+	Msgs       int64  `json:"msgs"`
+}
+
+// QueryServerInterest returns the subscriptions of all servers in the
+// cluster, from $SYS.REQ.SERVER.PING.SUBSZ. nc must be a system account
+// connection. Responses are collected for wait; servers that do not respond
+// in time are missing from the result.
+func QueryServerInterest(ctx context.Context, nc *nats.Conn, wait time.Duration) ([]ServerSubscription, error) {
+	req, err := json.Marshal(map[string]any{"subscriptions": true, "limit": serverSubszLimit})
+	if err != nil {
+		return nil, err
+	}
+	inbox := nc.NewRespInbox()
+	sub, err := nc.SubscribeSync(inbox)
+	if err != nil {
+		return nil, fmt.Errorf("subscribing to %s: %w", inbox, err)
+	}
+	defer sub.Unsubscribe()
+	if err := nc.PublishRequest(serverSubszSubject, inbox, req); err != nil {
+		return nil, fmt.Errorf("requesting %s: %w", serverSubszSubject, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+
+	subs := []ServerSubscription{}
+	servers := 0
+	for {
+		msg, err := sub.NextMsgWithContext(ctx)
+		if errors.Is(err, context.DeadlineExceeded) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %s responses: %w", serverSubszSubject, err)
+		}
+		var resp struct {
+			Data *struct {
+				Subs []ServerSubscription `json:"subscriptions_list"`
+			} `json:"data"`
+			Error *struct {
+				Description string `json:"description"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(msg.Data, &resp); err != nil {
+			return nil, fmt.Errorf("decoding %s response: %w", serverSubszSubject, err)
+		}
+		if resp.Error != nil {
+			return nil, fmt.Errorf("%s: %s", serverSubszSubject, resp.Error.Description)
+		}
+		if resp.Data != nil {
+			subs = append(subs, resp.Data.Subs...)
+		}
+		servers++
+	}
+	if servers == 0 {
+		return nil, fmt.Errorf("no server responded to %s (is the connection a system account user?)", serverSubszSubject)
+	}
+	return subs, nil
+}
+
+// UsageFinding is a binding, policy, or permission that was granted but not
+// used in the report window.
+type UsageFinding struct {
+	Rule    string `json:"rule"`
+	Account string `json:"account"`
+	// Role is set for unused bindings and permissions.
+	Role string `json:"role,omitempty"`
+	// PolicyID is set for unused policies and permissions.
+	PolicyID string `json:"policy_id,omitempty"`
+	// Statement and Resource locate an unused permission in its policy.
+	Statement  int                `json:"statement,omitempty"`
+	Resource   string             `json:"resource,omitempty"`
+	Permission *policy.Permission `json:"permission,omitempty"`
+	Message    string             `json:"message"`
+}
+
+func (f UsageFinding) String() string {
+	name := f.Role
+	if name == "" {
+		name = f.Account + "." + f.PolicyID
+	}
+	return fmt.Sprintf("%s: %s (%s)", name, f.Message, f.Rule)
+}
+
+// UsageReport lists what was granted but not used in a window.
+type UsageReport struct {
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+	// InterestChecked is set if subscribe permissions were compared with
+	// server interest.
+	InterestChecked bool           `json:"interest_checked"`
+	Findings        []UsageFinding `json:"findings"`
+}
+
+// PermissionUsage reports the bindings of the policy store whose role was
+// not issued according to usage, the policies bound only to such roles, and,
+// if interest is not nil, the subscribe permissions of issued roles that no
+// subscription in their account is covered by.
+//
+// Expired bindings are skipped (LintPolicyStore reports them). Permissions
+// from resources with variables are skipped, as they depend on the user.
+// Publish permissions are not checked, as servers do not report publishers
+// by subject. Findings are sorted by rule, account, role, and policy.
+func (c *AuthController) PermissionUsage(ctx context.Context, usage *AuditUsage, interest []ServerSubscription) (*UsageReport, error) {
+	store, ok := c.PolicyStore()
+	if !ok {
+		return nil, errors.New("the configured policy provider cannot list bindings")
+	}
+	bindings, err := store.ListBindings(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing bindings: %w", err)
+	}
+
+	report := &UsageReport{Since: usage.Since, Until: usage.Until, InterestChecked: interest != nil, Findings: []UsageFinding{}}
+	type policyKey struct{ account, id string }
+	policyUsed := make(map[policyKey]bool)
+	now := time.Now()
+	for _, b := range bindings {
+		if b == nil || b.Expired(now) {
+			continue
+		}
+		role := b.IdentityRole()
+		used := usage.Roles[role.String()] != nil
+		for _, id := range b.Policies {
+			pol, err := store.GetPolicy(ctx, b.Account, id)
+			if err != nil {
+				continue // reported by LintPolicyStore
+			}
+			key := policyKey{pol.Account, pol.ID}
+			policyUsed[key] = policyUsed[key] || used
+		}
+		if !used {
+			report.Findings = append(report.Findings, UsageFinding{
+				Rule: UsageRuleUnusedBinding, Account: b.Account, Role: role.String(),
+				Message: "no user was issued this role in the window",
+			})
+			continue
+		}
+		if interest == nil {
+			continue
+		}
+		findings, err := c.unusedSubscriptions(ctx, role, accountSubscriptions(ctx, c.accountProvider, b.Account, interest))
+		if err != nil {
+			return nil, err
+		}
+		report.Findings = append(report.Findings, findings...)
+	}
+	for key, used := range policyUsed {
+		if !used {
+			report.Findings = append(report.Findings, UsageFinding{
+				Rule: UsageRuleUnusedPolicy, Account: key.account, PolicyID: key.id,
+				Message: "the policy is only bound to roles that were not issued in the window",
+			})
+		}
+	}
+
+	sort.Slice(report.Findings, func(i, j int) bool {
+		a, b := report.Findings[i], report.Findings[j]
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		if a.Account != b.Account {
+			return a.Account < b.Account
+		}
+		if a.Role != b.Role {
+			return a.Role < b.Role
+		}
+		if a.PolicyID != b.PolicyID {
+			return a.PolicyID < b.PolicyID
+		}
+		return a.Statement < b.Statement
+	})
+	return report, nil
+}
+
+// unusedSubscriptions returns the effective subscribe permissions of role
+// that cover none of subs.
+func (c *AuthController) unusedSubscriptions(ctx context.Context, role identity.Role, subs []ServerSubscription) ([]UsageFinding, error) {
+	user := &AccountScopedUser{User: identity.User{ID: "usage", Roles: []identity.Role{role}}, Account: role.Account}
+	result, err := c.ExplainPermissions(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("compiling permissions of %s: %w", role, err)
+	}
+
+	var findings []UsageFinding
+	for _, o := range result.Origins {
+		if !o.Effective || o.Effect != policy.EffectAllow || o.Implicit != "" || o.Permission.Type != policy.PermSub ||
+			policy.ContainsVariables(o.Resource) {
+			continue
+		}
+		used := false
+		for _, s := range subs {
+			if o.Permission.Matches(s.Subject) {
+				used = true
+				break
+			}
+		}
+		if !used {
+			perm := o.Permission
+			findings = append(findings, UsageFinding{
+				Rule: UsageRuleUnusedSubscribe, Account: role.Account, Role: role.String(),
+				PolicyID: o.PolicyID, Statement: o.Statement, Resource: o.Resource, Permission: &perm,
+				Message: fmt.Sprintf("no subscription in the account is covered by SUB %s (%s)", perm.Subject, o.Action),
+			})
+		}
+	}
+	return findings, nil
+}
+
+// accountSubscriptions returns the subscriptions of account in subs. Servers
+// report accounts by public key in operator mode, so the key from accounts is
+// matched as well, if available.
+func accountSubscriptions(ctx context.Context, accounts provider.AccountProvider, account string, subs []ServerSubscription) []ServerSubscription {
+	var key string
+	if accounts != nil {
+		if acc, err := accounts.GetAccount(ctx, account); err == nil {
+			key = acc.PublicKey()
+		}
+	}
+	var out []ServerSubscription
+	for _, s := range subs {
+		if s.Account == account || s.AccountTag == account || (key != "" && s.Account == key) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
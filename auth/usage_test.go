@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/msimon/nauts/provider"
+)
+
+func TestReadAuditUsage(t *testing.T) {
+	records := `{"seq":1,"time":"2026-10-01T10:00:00Z","result":"success","roles":["app.workers"]}
+{"seq":2,"time":"2026-10-02T10:00:00Z","result":"success","roles":["app.workers","app.readers"]}
+
+{"seq":3,"time":"2026-10-03T10:00:00Z","result":"failure","roles":["app.admins"]}
+{"seq":4,"time":"2026-10-20T10:00:00Z","result":"success","roles":["app.late"]}
+`
+	since := time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	usage, err := ReadAuditUsage(strings.NewReader(records), since, until)
+	if err != nil {
+		t.Fatalf("ReadAuditUsage() error = %v", err)
+	}
+	if usage.Records != 2 {
+		t.Errorf("Records = %d, want 2", usage.Records)
+	}
+	if len(usage.Roles) != 2 || usage.Roles["app.workers"] == nil || usage.Roles["app.readers"] == nil {
+		t.Fatalf("Roles = %v, want app.workers and app.readers", usage.Roles)
+	}
+	if w := usage.Roles["app.workers"]; w.Issued != 1 || !w.LastIssued.Equal(time.Date(2026, 10, 2, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("app.workers = %+v, want one issuance on 2026-10-02", w)
+	}
+
+	if _, err := ReadAuditUsage(strings.NewReader("not json\n"), since, until); err == nil {
+		t.Error("expected an error for a malformed record")
+	}
+}
+
+func TestPermissionUsage(t *testing.T) {
+	dir := t.TempDir()
+	policies := `[
+  {"id": "orders", "account": "app", "statements": [
+    {"effect": "allow", "actions": ["nats.sub"], "resources": ["nats:orders.>", "nats:legacy.orders", "nats:user.{{ user.id }}"]}
+  ]},
+  {"id": "reports", "account": "app", "statements": [
+    {"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:reports.>"]}
+  ]}
+]`
+	bindings := `[
+  {"role": "workers", "account": "app", "policies": ["orders"]},
+  {"role": "auditors", "account": "app", "policies": ["reports"]},
+  {"role": "old", "account": "app", "policies": ["reports"], "expiresAt": "2020-01-01T00:00:00Z"}
+]`
+	for name, content := range map[string]string{"policies.json": policies, "bindings.json": bindings} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store, err := provider.NewFilePolicyProvider(provider.FilePolicyProviderConfig{
+		PoliciesPath: filepath.Join(dir, "policies.json"),
+		BindingsPath: filepath.Join(dir, "bindings.json"),
+	})
+	if err != nil {
+		t.Fatalf("creating policy provider: %v", err)
+	}
+	ctrl := NewAuthController(nil, store, nil, WithLogger(&testLogger{}))
+
+	usage := &AuditUsage{Roles: map[string]*RoleUsage{"app.workers": {Issued: 3}}}
+	interest := []ServerSubscription{
+		{Account: "app", Subject: "orders.created"},
+		{Account: "other", Subject: "legacy.orders"},
+	}
+
+	report, err := ctrl.PermissionUsage(context.Background(), usage, interest)
+	if err != nil {
+		t.Fatalf("PermissionUsage() error = %v", err)
+	}
+	if !report.InterestChecked {
+		t.Error("InterestChecked = false, want true")
+	}
+	var got []string
+	for _, f := range report.Findings {
+		got = append(got, f.String())
+	}
+	want := []string{
+		"app.auditors: no user was issued this role in the window (unused-binding)",
+		"app.reports: the policy is only bound to roles that were not issued in the window (unused-policy)",
+		"app.workers: no subscription in the account is covered by SUB legacy.orders (nats.sub) (unused-subscribe)",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("findings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	report, err = ctrl.PermissionUsage(context.Background(), usage, nil)
+	if err != nil {
+		t.Fatalf("PermissionUsage() error = %v", err)
+	}
+	if report.InterestChecked || len(report.Findings) != 2 {
+		t.Errorf("without interest: checked = %v, findings = %v, want only the unused binding and policy", report.InterestChecked, report.Findings)
+	}
+}
@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// DefaultUserIDHashLength is the length above which the "hash" step of
+// UserIDNormalizationConfig replaces user IDs.
+const DefaultUserIDHashLength = 64
+
+// UserIDNormalizer rewrites the ID of a verified user before it is used in
+// policy interpolation ({{user.id}}), the user inbox, the JWT name, and the
+// audit log, e.g. to lowercase emails or shorten AWS ARNs.
+type UserIDNormalizer interface {
+	NormalizeUserID(providerID, id string) string
+}
+
+// UserIDNormalizerFunc adapts a function to UserIDNormalizer.
+type UserIDNormalizerFunc func(providerID, id string) string
+
+// NormalizeUserID implements UserIDNormalizer.
+func (f UserIDNormalizerFunc) NormalizeUserID(providerID, id string) string {
+	return f(providerID, id)
+}
+
+// WithUserIDNormalizer normalizes the ID of every verified user with n.
+func WithUserIDNormalizer(n UserIDNormalizer) ControllerOption {
+	return func(c *AuthController) {
+		c.userIDNormalizer = n
+	}
+}
+
+// UserIDNormalizationConfig is one step of server.userIdNormalization.
+// Steps are applied in order.
+type UserIDNormalizationConfig struct {
+	// Type is "lowercase", "stripDomain" (remove "@domain"), "sanitize"
+	// (replace characters that are not allowed in a subject token with "_"),
+	// "hash" (replace long IDs with a SHA-256 hash), or a type registered
+	// with RegisterUserIDNormalizer.
+	Type string `json:"type"`
+
+	// Providers restricts the step to these authentication provider IDs.
+	// Empty applies it to all providers.
+	Providers []string `json:"providers,omitempty"`
+
+	// Domains restricts stripDomain to these domains (e.g., "example.com").
+	// Empty strips any domain.
+	Domains []string `json:"domains,omitempty"`
+
+	// MaxLength is the length above which hash replaces IDs. Default: 64
+	// (DefaultUserIDHashLength).
+	MaxLength int `json:"maxLength,omitempty"`
+}
+
+var (
+	userIDNormalizersMu sync.RWMutex
+	userIDNormalizers   = make(map[string]func(id string) string)
+)
+
+// builtinUserIDNormalizers are the step types implemented by nauts.
+var builtinUserIDNormalizers = []string{"lowercase", "stripDomain", "sanitize", "hash"}
+
+// RegisterUserIDNormalizer makes a user ID normalization step available to
+// server.userIdNormalization, typically from the init function of the
+// package implementing it. It panics if typ is empty, names a built-in step,
+// or is already registered, or if fn is nil.
+func RegisterUserIDNormalizer(typ string, fn func(id string) string) {
+	userIDNormalizersMu.Lock()
+	defer userIDNormalizersMu.Unlock()
+
+	if typ == "" {
+		panic("auth: RegisterUserIDNormalizer with empty type")
+	}
+	if fn == nil {
+		panic("auth: RegisterUserIDNormalizer function is nil for type " + typ)
+	}
+	if slices.Contains(builtinUserIDNormalizers, typ) {
+		panic("auth: RegisterUserIDNormalizer for built-in type " + typ)
+	}
+	if _, dup := userIDNormalizers[typ]; dup {
+		panic("auth: RegisterUserIDNormalizer called twice for type " + typ)
+	}
+	userIDNormalizers[typ] = fn
+}
+
+// UserIDNormalizerTypes returns the registered user ID normalization types, sorted.
+func UserIDNormalizerTypes() []string {
+	userIDNormalizersMu.RLock()
+	defer userIDNormalizersMu.RUnlock()
+	types := make([]string, 0, len(userIDNormalizers))
+	for typ := range userIDNormalizers {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// userIDStep is a compiled normalization step.
+type userIDStep struct {
+	providers []string
+	fn        func(id string) string
+}
+
+// userIDPipeline applies normalization steps in order.
+type userIDPipeline []userIDStep
+
+// NormalizeUserID implements UserIDNormalizer.
+func (p userIDPipeline) NormalizeUserID(providerID, id string) string {
+	for _, step := range p {
+		if len(step.providers) == 0 || slices.Contains(step.providers, providerID) {
+			id = step.fn(id)
+		}
+	}
+	return id
+}
+
+// NewUserIDNormalizer compiles server.userIdNormalization steps into a
+// normalizer.
+func NewUserIDNormalizer(steps []UserIDNormalizationConfig) (UserIDNormalizer, error) {
+	pipeline := make(userIDPipeline, 0, len(steps))
+	for i, step := range steps {
+		fn, err := step.compile()
+		if err != nil {
+			return nil, fmt.Errorf("server.userIdNormalization[%d]: %w", i, err)
+		}
+		pipeline = append(pipeline, userIDStep{providers: step.Providers, fn: fn})
+	}
+	return pipeline, nil
+}
+
+func (c UserIDNormalizationConfig) compile() (func(string) string, error) {
+	if c.MaxLength != 0 && c.Type != "hash" {
+		return nil, fmt.Errorf("maxLength is only valid for hash")
+	}
+	if len(c.Domains) > 0 && c.Type != "stripDomain" {
+		return nil, fmt.Errorf("domains are only valid for stripDomain")
+	}
+	switch c.Type {
+	case "lowercase":
+		return strings.ToLower, nil
+	case "stripDomain":
+		domains := make([]string, len(c.Domains))
+		for i, d := range c.Domains {
+			domains[i] = strings.ToLower(strings.TrimPrefix(d, "@"))
+		}
+		return func(id string) string { return stripDomain(id, domains) }, nil
+	case "sanitize":
+		return sanitizeUserID, nil
+	case "hash":
+		if c.MaxLength < 0 {
+			return nil, fmt.Errorf("maxLength must not be negative")
+		}
+		maxLength := c.MaxLength
+		if maxLength == 0 {
+			maxLength = DefaultUserIDHashLength
+		}
+		return func(id string) string { return hashLongUserID(id, maxLength) }, nil
+	case "":
+		return nil, fmt.Errorf("type is required")
+	}
+	userIDNormalizersMu.RLock()
+	fn, ok := userIDNormalizers[c.Type]
+	userIDNormalizersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown type %q (must be one of %s, or registered)", c.Type, strings.Join(builtinUserIDNormalizers, ", "))
+	}
+	return fn, nil
+}
+
+// stripDomain removes the domain of an email-like ID, if it is one of
+// domains or domains is empty.
+func stripDomain(id string, domains []string) string {
+	i := strings.LastIndexByte(id, '@')
+	if i <= 0 {
+		return id
+	}
+	if len(domains) > 0 && !slices.Contains(domains, strings.ToLower(id[i+1:])) {
+		return id
+	}
+	return id[:i]
+}
+
+// sanitizeUserID replaces characters that would split or widen the user's
+// inbox subject (".", "*", ">", and whitespace) with "_".
+func sanitizeUserID(id string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '.' || r == '*' || r == '>' || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return '_'
+		}
+		return r
+	}, id)
+}
+
+// hashLongUserID replaces IDs longer than maxLength with the first 128 bits
+// of their SHA-256 hash in hex, prefixed with "h_".
+func hashLongUserID(id string, maxLength int) string {
+	if len(id) <= maxLength {
+		return id
+	}
+	sum := sha256.Sum256([]byte(id))
+	return "h_" + hex.EncodeToString(sum[:16])
+}
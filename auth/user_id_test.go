@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+)
+
+func TestNewUserIDNormalizer(t *testing.T) {
+	arn := "arn:aws:sts::123456789012:assumed-role/payments-worker/i-0123456789abcdef0.session"
+
+	tests := []struct {
+		name     string
+		steps    []UserIDNormalizationConfig
+		provider string
+		id       string
+		want     string
+	}{
+		{"lowercase", []UserIDNormalizationConfig{{Type: "lowercase"}}, "file", "Alice", "alice"},
+		{"strip any domain", []UserIDNormalizationConfig{{Type: "stripDomain"}}, "file", "alice@example.com", "alice"},
+		{"strip listed domain", []UserIDNormalizationConfig{{Type: "stripDomain", Domains: []string{"@Example.com"}}}, "file", "alice@EXAMPLE.com", "alice"},
+		{"keep other domain", []UserIDNormalizationConfig{{Type: "stripDomain", Domains: []string{"example.com"}}}, "file", "alice@partner.com", "alice@partner.com"},
+		{"sanitize", []UserIDNormalizationConfig{{Type: "sanitize"}}, "file", "a.b*c> d", "a_b_c__d"},
+		{"hash long id", []UserIDNormalizationConfig{{Type: "hash"}}, "aws", arn, hashLongUserID(arn, DefaultUserIDHashLength)},
+		{"keep short id", []UserIDNormalizationConfig{{Type: "hash", MaxLength: 10}}, "aws", "worker", "worker"},
+		{"order", []UserIDNormalizationConfig{{Type: "stripDomain"}, {Type: "lowercase"}}, "file", "Alice@Example.com", "alice"},
+		{"other provider", []UserIDNormalizationConfig{{Type: "lowercase", Providers: []string{"aws"}}}, "file", "Alice", "Alice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := NewUserIDNormalizer(tt.steps)
+			if err != nil {
+				t.Fatalf("NewUserIDNormalizer() error = %v", err)
+			}
+			if got := n.NormalizeUserID(tt.provider, tt.id); got != tt.want {
+				t.Errorf("NormalizeUserID(%q) = %q, want %q", tt.id, got, tt.want)
+			}
+		})
+	}
+
+	if got := hashLongUserID(arn, DefaultUserIDHashLength); len(got) != 34 || !strings.HasPrefix(got, "h_") {
+		t.Errorf("hashLongUserID() = %q, want h_ and 32 hex digits", got)
+	}
+
+	for _, bad := range []UserIDNormalizationConfig{
+		{},
+		{Type: "uppercase"},
+		{Type: "lowercase", MaxLength: 10},
+		{Type: "hash", Domains: []string{"example.com"}},
+		{Type: "hash", MaxLength: -1},
+	} {
+		if _, err := NewUserIDNormalizer([]UserIDNormalizationConfig{bad}); err == nil {
+			t.Errorf("NewUserIDNormalizer(%+v) succeeded", bad)
+		}
+	}
+}
+
+func TestRegisterUserIDNormalizer(t *testing.T) {
+	RegisterUserIDNormalizer("test-reverse", func(id string) string {
+		r := []rune(id)
+		slices.Reverse(r)
+		return string(r)
+	})
+	defer func() {
+		userIDNormalizersMu.Lock()
+		delete(userIDNormalizers, "test-reverse")
+		userIDNormalizersMu.Unlock()
+	}()
+
+	if !slices.Contains(UserIDNormalizerTypes(), "test-reverse") {
+		t.Errorf("UserIDNormalizerTypes() = %v", UserIDNormalizerTypes())
+	}
+	n, err := NewUserIDNormalizer([]UserIDNormalizationConfig{{Type: "test-reverse"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := n.NormalizeUserID("file", "abc"); got != "cba" {
+		t.Errorf("NormalizeUserID() = %q, want cba", got)
+	}
+
+	for _, typ := range []string{"", "lowercase", "test-reverse"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterUserIDNormalizer(%q) did not panic", typ)
+				}
+			}()
+			RegisterUserIDNormalizer(typ, strings.ToUpper)
+		}()
+	}
+}
+
+func TestAuthenticate_NormalizesUserID(t *testing.T) {
+	ctrl := createTestController(t)
+	var buf bytes.Buffer
+	WithAuditLog(NewAuditLog(NewWriterAuditSink(&buf)))(ctrl)
+	normalizer, err := NewUserIDNormalizer([]UserIDNormalizationConfig{{Type: "lowercase"}, {Type: "sanitize"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	WithUserIDNormalizer(UserIDNormalizerFunc(func(providerID, id string) string {
+		return normalizer.NormalizeUserID(providerID, "Ext."+id)
+	}))(ctrl)
+
+	result, err := ctrl.Authenticate(context.Background(), natsjwt.ConnectOptions{
+		Token: `{"account":"test-account","token":"alice:secret123"}`,
+	}, "", time.Hour)
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if result.User.ID != "ext_alice" {
+		t.Fatalf("User.ID = %q, want ext_alice", result.User.ID)
+	}
+	claims, err := natsjwt.DecodeUserClaims(result.JWT)
+	if err != nil {
+		t.Fatalf("decoding JWT: %v", err)
+	}
+	if claims.Name != "ext_alice" {
+		t.Errorf("JWT name = %q, want ext_alice", claims.Name)
+	}
+	if !slices.Contains(claims.Sub.Allow, "_INBOX_ext_alice.>") {
+		t.Errorf("sub permissions %v lack the normalized inbox", claims.Sub.Allow)
+	}
+
+	var event AuditEvent
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &event); err != nil {
+		t.Fatalf("decoding audit record: %v", err)
+	}
+	if event.UserID != "ext_alice" || event.RawUserID != "alice" {
+		t.Errorf("audit user_id = %q, raw_user_id = %q, want ext_alice, alice", event.UserID, event.RawUserID)
+	}
+}
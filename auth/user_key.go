@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nkeys"
+)
+
+// UserKeyStrategy determines the subject key of the issued JWT when
+// Authenticate is called without a user public key.
+type UserKeyStrategy string
+
+const (
+	// UserKeyEphemeral generates a new random user key per request (default).
+	UserKeyEphemeral UserKeyStrategy = "ephemeral"
+	// UserKeyReject rejects requests without a user public key.
+	UserKeyReject UserKeyStrategy = "reject"
+	// UserKeyDerived derives a deterministic user key from the user ID and a
+	// secret, so that the same user always receives the same subject key.
+	UserKeyDerived UserKeyStrategy = "derived"
+)
+
+// ErrUserPublicKeyRequired is returned by Authenticate when no user public key
+// is provided and the strategy is UserKeyReject.
+var ErrUserPublicKeyRequired = errors.New("user public key is required")
+
+// Validate checks that s is a known strategy. The empty string is valid and
+// means UserKeyEphemeral.
+func (s UserKeyStrategy) Validate() error {
+	switch s {
+	case "", UserKeyEphemeral, UserKeyReject, UserKeyDerived:
+		return nil
+	default:
+		return fmt.Errorf("unsupported user key strategy: %s", s)
+	}
+}
+
+// WithUserKeyStrategy sets how Authenticate obtains the subject key when no
+// user public key is provided. UserKeyDerived requires a secret; it is
+// ignored for the other strategies. Default: UserKeyEphemeral.
+func WithUserKeyStrategy(strategy UserKeyStrategy, secret []byte) ControllerOption {
+	return func(c *AuthController) {
+		c.userKeyStrategy = strategy
+		c.userKeySecret = secret
+	}
+}
+
+// defaultUserPublicKey returns the subject key for userID according to the
+// controller's strategy.
+func (c *AuthController) defaultUserPublicKey(userID string) (string, error) {
+	switch c.userKeyStrategy {
+	case UserKeyReject:
+		return "", ErrUserPublicKeyRequired
+	case UserKeyDerived:
+		return deriveUserKey(c.userKeySecret, userID)
+	default:
+		return generateEphemeralUserKey()
+	}
+}
+
+// deriveUserKey derives a user public key from HMAC-SHA256(secret, userID).
+func deriveUserKey(secret []byte, userID string) (string, error) {
+	if len(secret) == 0 {
+		return "", errors.New("derived user keys require a secret")
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(userID))
+	kp, err := nkeys.FromRawSeed(nkeys.PrefixByteUser, mac.Sum(nil))
+	if err != nil {
+		return "", err
+	}
+	return kp.PublicKey()
+}
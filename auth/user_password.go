@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+
+	"github.com/msimon/nauts/identity"
+)
+
+// userPassword routes user and password connect options to a file
+// authentication provider.
+type userPassword struct {
+	provider       string
+	defaultAccount string
+}
+
+// WithUserPassword lets clients connect with the user and password connect
+// options instead of a token. Such requests are verified by the
+// authentication provider with id providerID, which must accept
+// "username:password" tokens (identity.FileAuthenticationProvider). The user
+// may name the account as "<account>/<username>"; otherwise defaultAccount
+// is used, and if it is empty the request is rejected. Requests carrying a
+// token are unaffected.
+func WithUserPassword(providerID, defaultAccount string) ControllerOption {
+	return func(c *AuthController) {
+		c.userPassword = &userPassword{provider: providerID, defaultAccount: defaultAccount}
+	}
+}
+
+// authRequest returns the auth request carried by the connect options: the
+// token, or if no token is set with WithNkeyAuthentication the user nkey and
+// with WithUserPassword the user and password.
+func (c *AuthController) authRequest(opts natsjwt.ConnectOptions) (identity.AuthRequest, error) {
+	if opts.Token == "" && c.nkeyAuth != nil && opts.Nkey != "" {
+		return c.nkeyAuthRequest(opts)
+	}
+	if opts.Token != "" || c.userPassword == nil || opts.Username == "" {
+		return parseAuthRequest(opts.Token)
+	}
+
+	account, username, ok := strings.Cut(opts.Username, "/")
+	if !ok {
+		account, username = c.userPassword.defaultAccount, opts.Username
+	}
+	if account == "" {
+		return identity.AuthRequest{}, errors.New("user must name the account as <account>/<username>")
+	}
+	if strings.Contains(account, "*") {
+		return identity.AuthRequest{}, errors.New("account must not contain wildcards")
+	}
+	// The file provider splits the token at the first colon.
+	if username == "" || strings.Contains(username, ":") {
+		return identity.AuthRequest{}, errors.New("invalid username")
+	}
+	return identity.AuthRequest{
+		Version: identity.AuthRequestVersion,
+		Account: account,
+		Token:   username + ":" + opts.Password,
+		AP:      c.userPassword.provider,
+	}, nil
+}
@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/msimon/nauts/provider"
+)
+
+// Finding types and rules reported by ValidateConfigFile in addition to the
+// policy and binding findings of the provider lint functions.
+const (
+	// ValidationTypeConfig marks findings about the configuration file itself.
+	ValidationTypeConfig = "config"
+	// ValidationTypeProvider marks findings about a provider that cannot be
+	// initialized (Name is "account", "auth", "policy" or "server").
+	ValidationTypeProvider = "provider"
+
+	// ValidationRuleInvalidConfig: the configuration cannot be loaded or fails
+	// validation.
+	ValidationRuleInvalidConfig = "invalid-config"
+	// ValidationRuleProviderError: a provider or a file it references cannot
+	// be loaded.
+	ValidationRuleProviderError = "provider-error"
+)
+
+// ValidationReport is the result of ValidateConfigFile.
+type ValidationReport struct {
+	Config string `json:"config"`
+	// Valid is true if no finding has level error.
+	Valid bool `json:"valid"`
+	// Policies and Bindings count the entries read from the policy provider.
+	Policies int                    `json:"policies"`
+	Bindings int                    `json:"bindings"`
+	Findings []provider.LintFinding `json:"findings"`
+}
+
+func (r *ValidationReport) add(rule, typ, name, message string) {
+	r.Findings = append(r.Findings, provider.LintFinding{
+		Rule: rule, Level: provider.LintError, Type: typ, Name: name, Message: message,
+	})
+}
+
+// ValidateConfigFile checks a configuration and everything it references
+// without serving requests: it loads the configuration, initializes the
+// account, authentication, and policy providers, reads the server key files,
+// and lints every policy and binding (invalid or duplicate entries, resource
+// syntax, unknown template variables, dangling policy references, subjects of
+// other teams). Nothing is written; NATS KV and SQL policy providers are only
+// read.
+func ValidateConfigFile(ctx context.Context, path string) *ValidationReport {
+	report := &ValidationReport{Config: path, Findings: []provider.LintFinding{}}
+	defer func() {
+		report.Valid = true
+		for _, f := range report.Findings {
+			if f.Level == provider.LintError {
+				report.Valid = false
+			}
+		}
+	}()
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		report.add(ValidationRuleInvalidConfig, ValidationTypeConfig, path, err.Error())
+		return report
+	}
+
+	accounts, err := newAccountProvider(config.Account)
+	if err != nil {
+		report.add(ValidationRuleProviderError, ValidationTypeProvider, "account", err.Error())
+	}
+	if authProviders, _, _, err := newAuthenticationProviderManager(config); err != nil {
+		report.add(ValidationRuleProviderError, ValidationTypeProvider, "auth", err.Error())
+	} else {
+		_ = authProviders.Stop()
+	}
+	validateServerFiles(report, &config.Server)
+	validatePolicies(ctx, report, config.Policy, accounts)
+
+	return report
+}
+
+// validateServerFiles reads the key and token files referenced by the server
+// section.
+func validateServerFiles(report *ValidationReport, c *ServerConfig) {
+	if _, err := c.GetXKeySeed(); err != nil {
+		report.add(ValidationRuleProviderError, ValidationTypeProvider, "server", err.Error())
+	}
+	if UserKeyStrategy(c.UserKeyStrategy) == UserKeyDerived {
+		if _, err := c.GetUserKeySecret(); err != nil {
+			report.add(ValidationRuleProviderError, ValidationTypeProvider, "server", err.Error())
+		}
+	}
+	if _, err := c.GetAdminToken(); err != nil {
+		report.add(ValidationRuleProviderError, ValidationTypeProvider, "server", err.Error())
+	}
+}
+
+// validatePolicies lints the policies and bindings of the policy provider.
+// Policies are checked against the account limits if accounts is not nil.
+func validatePolicies(ctx context.Context, report *ValidationReport, cfg PolicyConfig, accounts provider.AccountProvider) {
+	if cfg.Type == "file" {
+		findings, err := provider.LintPolicyFiles(cfg.File.PoliciesPath, cfg.File.BindingsPath)
+		if err != nil {
+			report.add(ValidationRuleProviderError, ValidationTypeProvider, "policy", err.Error())
+			return
+		}
+		report.Findings = append(report.Findings, findings...)
+		for _, f := range findings {
+			// The file provider refuses to load invalid entries; the findings
+			// above already explain why.
+			if f.Rule == provider.LintRuleInvalidPolicy || f.Rule == provider.LintRuleInvalidBinding {
+				return
+			}
+		}
+	}
+
+	store, err := newPolicyStore(cfg)
+	if err != nil {
+		report.add(ValidationRuleProviderError, ValidationTypeProvider, "policy", err.Error())
+		return
+	}
+	defer StopPolicyStore(store)
+
+	policies, err := store.ListPolicies(ctx)
+	if err != nil {
+		report.add(ValidationRuleProviderError, ValidationTypeProvider, "policy", fmt.Sprintf("listing policies: %v", err))
+		return
+	}
+	bindings, err := store.ListBindings(ctx)
+	if err != nil {
+		report.add(ValidationRuleProviderError, ValidationTypeProvider, "policy", fmt.Sprintf("listing bindings: %v", err))
+		return
+	}
+	report.Policies = len(policies)
+	report.Bindings = len(bindings)
+
+	report.Findings = append(report.Findings, provider.LintPolicyResources(policies)...)
+	if ownership, _ := cfg.SubjectOwnership(); ownership != nil {
+		report.Findings = append(report.Findings, provider.LintSubjectOwnership(policies, ownership)...)
+	}
+	findings, err := provider.LintPolicyStore(ctx, store)
+	if err != nil {
+		report.add(ValidationRuleProviderError, ValidationTypeProvider, "policy", err.Error())
+		return
+	}
+	report.Findings = append(report.Findings, findings...)
+	if accounts == nil {
+		return
+	}
+	findings, err = provider.LintAccountLimits(ctx, accounts, policies)
+	if err != nil {
+		report.add(ValidationRuleProviderError, ValidationTypeProvider, "account", err.Error())
+		return
+	}
+	report.Findings = append(report.Findings, findings...)
+}
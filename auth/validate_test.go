@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nats-io/nkeys"
+
+	"github.com/msimon/nauts/provider"
+)
+
+// writeValidationConfig writes a static-mode configuration with the given
+// policies and bindings files and returns its path.
+func writeValidationConfig(t *testing.T, policies, bindings string) string {
+	t.Helper()
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("writing %s: %v", name, err)
+		}
+		return path
+	}
+
+	kp, err := nkeys.CreateAccount()
+	if err != nil {
+		t.Fatalf("creating account key: %v", err)
+	}
+	pub, _ := kp.PublicKey()
+	seed, _ := kp.Seed()
+	keyPath := write("account.nk", string(seed))
+	usersPath := write("users.json", `{"users": {}}`)
+	policiesPath := write("policies.json", policies)
+	bindingsPath := write("bindings.json", bindings)
+
+	return write("nauts.json", `{
+		"account": {"type": "static", "static": {"publicKey": "`+pub+`", "privateKeyPath": "`+keyPath+`", "accounts": ["APP"]}},
+		"policy": {"type": "file", "file": {"policiesPath": "`+policiesPath+`", "bindingsPath": "`+bindingsPath+`"}},
+		"auth": {"file": [{"id": "local", "accounts": ["APP"], "userPath": "`+usersPath+`"}]},
+		"server": {"natsNkey": "/path/to/auth-service.nk"}
+	}`)
+}
+
+func TestValidateConfigFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		policies  string
+		bindings  string
+		wantValid bool
+		wantRules []string
+	}{
+		{
+			name:      "valid",
+			policies:  `[{"id": "pub", "account": "APP", "name": "pub", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:user.{{ user.id }}.>"]}]}]`,
+			bindings:  `[{"role": "writer", "account": "APP", "policies": ["pub"]}]`,
+			wantValid: true,
+		},
+		{
+			name: "store findings",
+			policies: `[
+				{"id": "pub", "account": "APP", "name": "pub", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:{{ user.mail }}", "nats:a.>.b"]}]},
+				{"id": "pub", "account": "APP", "name": "pub", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:a"]}]}
+			]`,
+			bindings: `[{"role": "writer", "account": "APP", "policies": ["pub", "gone"]}]`,
+			wantRules: []string{
+				provider.LintRuleMissingPolicy,
+				provider.LintRuleDuplicatePolicy,
+			},
+		},
+		{
+			name:      "invalid entry stops before the store",
+			policies:  `[{"id": "pub", "account": "APP", "name": "pub", "statements": []}]`,
+			bindings:  `[]`,
+			wantRules: []string{provider.LintRuleInvalidPolicy},
+		},
+		{
+			name:      "unparsable file",
+			policies:  `{`,
+			bindings:  `[]`,
+			wantRules: []string{ValidationRuleProviderError},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := ValidateConfigFile(context.Background(), writeValidationConfig(t, tt.policies, tt.bindings))
+			if report.Valid != tt.wantValid {
+				t.Errorf("Valid = %v, want %v (findings: %v)", report.Valid, tt.wantValid, report.Findings)
+			}
+			rules := make(map[string]bool)
+			for _, f := range report.Findings {
+				rules[f.Rule] = true
+			}
+			for _, rule := range tt.wantRules {
+				if !rules[rule] {
+					t.Errorf("findings %v do not contain %s", report.Findings, rule)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateConfigFile_ResourceFindings(t *testing.T) {
+	path := writeValidationConfig(t,
+		`[{"id": "pub", "account": "APP", "name": "pub", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:{{ user.mail }}", "nats:a.>.b"]}]}]`,
+		`[{"role": "writer", "account": "APP", "policies": ["pub"]}]`)
+
+	report := ValidateConfigFile(context.Background(), path)
+	if report.Valid {
+		t.Fatal("Valid = true, want false")
+	}
+	if report.Policies != 1 || report.Bindings != 1 {
+		t.Errorf("counts = %d policies, %d bindings, want 1, 1", report.Policies, report.Bindings)
+	}
+	want := []string{provider.LintRuleInvalidResource, provider.LintRuleUnresolvedVariable}
+	if len(report.Findings) != len(want) {
+		t.Fatalf("findings = %v, want %v", report.Findings, want)
+	}
+	for i, rule := range want {
+		if report.Findings[i].Rule != rule {
+			t.Errorf("finding %d = %s, want %s", i, report.Findings[i], rule)
+		}
+	}
+}
+
+func TestValidateConfigFile_InvalidConfig(t *testing.T) {
+	report := ValidateConfigFile(context.Background(), filepath.Join(t.TempDir(), "missing.json"))
+	if report.Valid {
+		t.Fatal("Valid = true for a missing config")
+	}
+	if len(report.Findings) != 1 || report.Findings[0].Rule != ValidationRuleInvalidConfig {
+		t.Errorf("findings = %v, want one %s", report.Findings, ValidationRuleInvalidConfig)
+	}
+}
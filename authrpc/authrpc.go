@@ -0,0 +1,159 @@
+// Package authrpc is the gRPC interface of nauts for one-shot
+// authentication: components that do not connect through NATS auth callout,
+// such as API gateways or provisioning jobs, send a nauts token and receive a
+// signed NATS user JWT, and with a key pair generated by nauts a ready-to-use
+// creds file.
+//
+//	conn, err := authrpc.Dial("nauts:4223", tlsConfig)
+//	resp, err := authrpc.NewClient(conn).Authenticate(ctx, &authrpc.AuthenticateRequest{Token: token})
+//
+// Messages are encoded as JSON (content-subtype "json") rather than protocol
+// buffers, so that the service needs no generated code; other gRPC clients
+// must use the same encoding. The server is auth.GRPCService, which requires
+// mTLS.
+package authrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// ServiceName is the full name of the authentication service.
+const ServiceName = "nauts.auth.v1.Authenticator"
+
+// AuthenticateMethod is the full method name of Authenticate.
+const AuthenticateMethod = "/" + ServiceName + "/Authenticate"
+
+// AuthenticateRequest carries the credentials of a NATS connect request.
+type AuthenticateRequest struct {
+	// Token is the nauts auth request (see nautsclient.Token), as sent in the
+	// auth_token connect option.
+	Token string `json:"token,omitempty"`
+
+	// User and Password are the user and pass connect options, for
+	// server.userPassword.
+	User     string `json:"user,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	// UserPublicKey is the user nkey the JWT is issued to. If empty, nauts
+	// generates a key pair and returns its seed and a creds file.
+	UserPublicKey string `json:"userPublicKey,omitempty"`
+
+	// TTL shortens the lifetime of the JWT below the server's default, as a
+	// duration string such as "15m". Empty uses the default.
+	TTL string `json:"ttl,omitempty"`
+}
+
+// AuthenticateResponse is the result of a successful authentication.
+type AuthenticateResponse struct {
+	// JWT is the signed user JWT.
+	JWT           string `json:"jwt"`
+	UserPublicKey string `json:"userPublicKey"`
+
+	// Seed and Creds are set if the request had no UserPublicKey: the seed of
+	// the generated key pair and a NATS creds file holding it and the JWT.
+	Seed  string `json:"seed,omitempty"`
+	Creds string `json:"creds,omitempty"`
+
+	Account  string   `json:"account"`
+	UserID   string   `json:"userId"`
+	Provider string   `json:"provider"`
+	Roles    []string `json:"roles,omitempty"`
+	// TokenID is the jti claim of the JWT.
+	TokenID string `json:"tokenId"`
+	// ExpiresAt is when the JWT expires; nil if it does not.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Codec encodes messages as JSON.
+type Codec struct{}
+
+// Marshal implements encoding.Codec.
+func (Codec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal implements encoding.Codec.
+func (Codec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// Name implements encoding.Codec.
+func (Codec) Name() string {
+	return "json"
+}
+
+// AuthenticatorServer is the server API of the authentication service.
+type AuthenticatorServer interface {
+	Authenticate(ctx context.Context, req *AuthenticateRequest) (*AuthenticateResponse, error)
+}
+
+// ServerCodec returns the server option that decodes requests with Codec.
+// Servers registering the service must use it.
+func ServerCodec() grpc.ServerOption {
+	return grpc.ForceServerCodec(Codec{})
+}
+
+// RegisterAuthenticatorServer registers srv on s.
+func RegisterAuthenticatorServer(s grpc.ServiceRegistrar, srv AuthenticatorServer) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*AuthenticatorServer)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Authenticate",
+		Handler:    authenticateHandler,
+	}},
+	Metadata: "authrpc",
+}
+
+func authenticateHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	req := new(AuthenticateRequest)
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthenticatorServer).Authenticate(ctx, req)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: AuthenticateMethod}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(AuthenticatorServer).Authenticate(ctx, req.(*AuthenticateRequest))
+	}
+	return interceptor(ctx, req, info, handler)
+}
+
+// Client calls the authentication service.
+type Client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient creates a client using cc.
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{cc: cc}
+}
+
+// Authenticate authenticates req and returns the issued JWT. Failures are
+// gRPC status errors: Unauthenticated for rejected credentials,
+// InvalidArgument for malformed requests, ResourceExhausted for requests
+// beyond the rate limits, and Unavailable if a backend of nauts is down.
+func (c *Client) Authenticate(ctx context.Context, req *AuthenticateRequest, opts ...grpc.CallOption) (*AuthenticateResponse, error) {
+	resp := new(AuthenticateResponse)
+	opts = append([]grpc.CallOption{grpc.ForceCodec(Codec{})}, opts...)
+	if err := c.cc.Invoke(ctx, AuthenticateMethod, req, resp, opts...); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Dial creates a client connection to target that authenticates with the
+// client certificate of tlsConfig.
+func Dial(target string, tlsConfig *tls.Config) (*grpc.ClientConn, error) {
+	return grpc.NewClient(target, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+}
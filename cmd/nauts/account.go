@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/msimon/nauts/auth"
+)
+
+// runAccount handles the 'account' subcommand group.
+func runAccount(args []string) error {
+	if len(args) == 0 {
+		printAccountUsage()
+		return fmt.Errorf("account: subcommand is required")
+	}
+
+	switch args[0] {
+	case "apply":
+		return runAccountApply(args[1:])
+	case "push":
+		return runAccountPush(args[1:])
+	case "-h", "-help", "--help", "help":
+		printAccountUsage()
+		return nil
+	default:
+		printAccountUsage()
+		return fmt.Errorf("account: unknown subcommand %q", args[0])
+	}
+}
+
+func printAccountUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: %s account <subcommand> [options]
+
+Subcommands:
+  apply    Apply an account onboarding manifest (YAML or JSON)
+  push     Generate the managed account JWTs and push them to the account resolver
+`, os.Args[0])
+}
+
+// runAccountApply handles 'account apply'.
+func runAccountApply(args []string) error {
+	fs := flag.NewFlagSet("nauts account apply", flag.ExitOnError)
+
+	var configPath string
+	var dryRun, prune bool
+
+	fs.StringVar(&configPath, "c", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&configPath, "config", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.BoolVar(&dryRun, "dry-run", false, "Print the changes without applying them")
+	fs.BoolVar(&prune, "prune", false, "Remove policies and bindings of the account that are not in the manifest")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s account apply [options] <manifest.yaml>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Apply an account manifest: account keys, policies, bindings, and provider assignments.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if configPath == "" {
+		return fmt.Errorf("-c/--config is required")
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("exactly one manifest file is required")
+	}
+
+	manifest, err := auth.LoadAccountManifest(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	result, err := auth.ApplyAccountManifest(context.Background(), configPath, manifest, auth.ApplyManifestOptions{
+		DryRun: dryRun,
+		Prune:  prune,
+	})
+	if err != nil {
+		return fmt.Errorf("applying manifest: %w", err)
+	}
+
+	prefix := ""
+	if dryRun {
+		prefix = "(dry-run) "
+	}
+	if len(result.Changes) == 0 {
+		fmt.Printf("%saccount %s is up to date\n", prefix, manifest.Account)
+		return nil
+	}
+	for _, change := range result.Changes {
+		fmt.Printf("%s%s\n", prefix, change)
+	}
+	return nil
+}
+
+// runAccountPush handles 'account push'.
+func runAccountPush(args []string) error {
+	fs := flag.NewFlagSet("nauts account push", flag.ExitOnError)
+
+	var configPath, format string
+	var dryRun bool
+
+	fs.StringVar(&configPath, "c", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&configPath, "config", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.BoolVar(&dryRun, "dry-run", false, "Print the changes without pushing them")
+	fs.StringVar(&format, "format", "text", "Output format: text or json")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s account push [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Generate the JWTs of the accounts in account.operator (with claims) and push them to the account resolver.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if configPath == "" {
+		return fmt.Errorf("-c/--config is required")
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unsupported format %q (must be 'text' or 'json')", format)
+	}
+
+	config, err := auth.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	results, err := auth.PushAccountJWTsWithConfig(context.Background(), config, dryRun)
+	if err != nil {
+		return fmt.Errorf("pushing account JWTs: %w", err)
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		}
+	}
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			return err
+		}
+	} else {
+		prefix := ""
+		if dryRun {
+			prefix = "(dry-run) "
+		}
+		for _, r := range results {
+			fmt.Printf("%s%s\n", prefix, r)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d account(s) failed", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/msimon/nauts/auth"
+)
+
+// runAdmin handles the 'admin' subcommand group.
+func runAdmin(args []string) error {
+	if len(args) == 0 {
+		printAdminUsage()
+		return fmt.Errorf("admin: subcommand is required")
+	}
+
+	switch args[0] {
+	case "history":
+		return runAdminRequest("history", auth.AdminHistorySubject, args[1:])
+	case "rollback":
+		return runAdminRequest("rollback", auth.AdminRollbackSubject, args[1:])
+	case "stats":
+		return runAdminRequest("stats", auth.AdminStatsSubject, args[1:])
+	case "revoke":
+		return runAdminRequest("revoke", auth.AdminRevokeSubject, args[1:])
+	case "revocations":
+		return runAdminRequest("revocations", auth.AdminRevocationsSubject, args[1:])
+	case "-h", "-help", "--help", "help":
+		printAdminUsage()
+		return nil
+	default:
+		printAdminUsage()
+		return fmt.Errorf("admin: unknown subcommand %q", args[0])
+	}
+}
+
+func printAdminUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: %s admin <subcommand> [options]
+
+Subcommands:
+  history      Show the current and previous configurations of a running nauts
+  rollback     Revert a running nauts to its previous configuration
+  stats        Show per-account authentication statistics of a running nauts
+  revoke       Revoke an issued user JWT by its jti (see the audit log)
+  revocations  List the revoked user JWTs
+
+The running nauts must be started with --enable-admin-svc. If server.admin.tokenFile
+is set, requests carry the token from that file; revoke and revocations require it
+and server.revocation.
+`, os.Args[0])
+}
+
+// runAdminRequest handles 'admin history', 'admin rollback', 'admin stats',
+// 'admin revoke' and 'admin revocations' by sending a request to the admin
+// service of a running nauts.
+func runAdminRequest(name, subject string, args []string) error {
+	fs := flag.NewFlagSet("nauts admin "+name, flag.ExitOnError)
+
+	var configPath, format, account, jti, reason string
+	var timeout time.Duration
+
+	fs.StringVar(&configPath, "c", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file (for the NATS connection)")
+	fs.StringVar(&configPath, "config", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file (for the NATS connection)")
+	fs.DurationVar(&timeout, "timeout", 5*time.Second, "Request timeout")
+	fs.StringVar(&format, "format", "text", "Output format (text or json)")
+	switch name {
+	case "stats":
+		fs.StringVar(&account, "account", "", "Only show statistics for this account")
+	case "revoke":
+		fs.StringVar(&jti, "jti", "", "jti claim of the JWT to revoke")
+		fs.StringVar(&reason, "reason", "", "Reason recorded with the revocation")
+	}
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s admin %s [options]\n\n", os.Args[0], name)
+		switch name {
+		case "rollback":
+			fmt.Fprintf(os.Stderr, "Revert a running nauts to the configuration served before the last reload.\n")
+			fmt.Fprintf(os.Stderr, "Repeated rollbacks walk further back in the kept history (server.reloadHistory).\n\n")
+		case "stats":
+			fmt.Fprintf(os.Stderr, "Show authentications, failures, unique users and the average number of\n")
+			fmt.Fprintf(os.Stderr, "granted permissions per account since a running nauts was started.\n\n")
+		case "revoke":
+			fmt.Fprintf(os.Stderr, "Revoke an issued user JWT by its jti, as recorded in the audit log. With\n")
+			fmt.Fprintf(os.Stderr, "server.revocation.push, the servers disconnect the user and reject the JWT.\n\n")
+		case "revocations":
+			fmt.Fprintf(os.Stderr, "List the revoked user JWTs kept in the revocation list.\n\n")
+		default:
+			fmt.Fprintf(os.Stderr, "Show the configuration generations kept by a running nauts for rollback.\n\n")
+		}
+		fmt.Fprintf(os.Stderr, "Connects with the server section of the configuration file.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if configPath == "" {
+		return fmt.Errorf("-c/--config is required")
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unsupported format %q (expected text or json)", format)
+	}
+	if name == "revoke" && jti == "" {
+		return fmt.Errorf("--jti is required")
+	}
+
+	config, err := auth.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	if err := validateServerConfig(&config.Server); err != nil {
+		return err
+	}
+
+	var payload []byte
+	switch {
+	case name == "revoke":
+		payload, err = json.Marshal(auth.AdminRevokeRequest{ID: jti, Reason: reason})
+		if err != nil {
+			return fmt.Errorf("encoding revoke request: %w", err)
+		}
+	case account != "":
+		payload, err = json.Marshal(auth.AdminStatsRequest{Account: account})
+		if err != nil {
+			return fmt.Errorf("encoding stats request: %w", err)
+		}
+	}
+	data, err := sendAdminRequest(config, subject, payload, timeout)
+	if err != nil {
+		return err
+	}
+	var resp auth.AdminResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return fmt.Errorf("decoding admin response: %w", err)
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(resp); err != nil {
+			return fmt.Errorf("encoding admin response: %w", err)
+		}
+	} else if name == "stats" {
+		printAccountStats(resp.Stats)
+	} else if name == "revoke" || name == "revocations" {
+		if resp.Revoked != nil {
+			resp.Revocations = append(resp.Revocations, *resp.Revoked)
+		}
+		printRevocations(resp.Revocations)
+	} else {
+		printReloadStatus(resp)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("%s: %s", resp.Error.Code, resp.Error.Message)
+	}
+	return nil
+}
+
+// sendAdminRequest sends a request to the admin service of a running nauts,
+// connecting with the server section of config and adding the admin token if
+// one is configured, and returns the reply.
+func sendAdminRequest(config *auth.Config, subject string, payload []byte, timeout time.Duration) ([]byte, error) {
+	opts := []nats.Option{nats.Name("nauts-admin-cli")}
+	if config.Server.NatsCredentials != "" {
+		opts = append(opts, nats.UserCredentials(config.Server.NatsCredentials))
+	} else {
+		opt, err := nats.NkeyOptionFromSeed(config.Server.NatsNkey)
+		if err != nil {
+			return nil, fmt.Errorf("loading nkey from %s: %w", config.Server.NatsNkey, err)
+		}
+		opts = append(opts, opt)
+	}
+	natsURL := config.Server.NatsURL
+	if v := os.Getenv("NATS_URL"); v != "" {
+		natsURL = v
+	}
+	if natsURL == "" {
+		natsURL = nats.DefaultURL
+	}
+	nc, err := nats.Connect(natsURL, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to NATS: %w", err)
+	}
+	defer nc.Close()
+
+	token, err := config.Server.GetAdminToken()
+	if err != nil {
+		return nil, err
+	}
+	req := &nats.Msg{Subject: subject, Data: payload}
+	if token != "" {
+		req.Header = nats.Header{auth.AdminTokenHeader: []string{token}}
+	}
+	msg, err := nc.RequestMsg(req, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("requesting %s: %w (is nauts running with --enable-admin-svc?)", subject, err)
+	}
+	return msg.Data, nil
+}
+
+// printReloadStatus writes a human-readable reload status to stdout.
+func printReloadStatus(resp auth.AdminResponse) {
+	if resp.RolledBackTo != nil {
+		fmt.Printf("rolled back to generation %d\n", resp.RolledBackTo.Generation)
+	}
+	printEntry := func(marker string, e auth.ReloadEntry) {
+		fmt.Printf("%s %d  %s  %s\n", marker, e.Generation, e.LoadedAt.Format(time.RFC3339), e.Source)
+	}
+	printEntry("*", resp.Status.Current)
+	for _, e := range resp.Status.History {
+		printEntry(" ", e)
+	}
+}
+
+// printAccountStats writes per-account statistics as a table to stdout.
+func printAccountStats(stats []auth.AccountStatsSnapshot) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ACCOUNT\tAUTHS\tFAILURES\tUNIQUE USERS\tAVG PERMISSIONS")
+	for _, s := range stats {
+		users := strconv.Itoa(s.UniqueUsers)
+		if s.UniqueUsersCapped {
+			users += "+"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%.1f\n", s.Account, s.Auths, s.Failures, users, s.AvgPermissions)
+	}
+	w.Flush()
+}
+
+// printRevocations writes revoked tokens as a table to stdout.
+func printRevocations(tokens []auth.RevokedToken) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "JTI\tACCOUNT\tUSER\tREVOKED AT\tREASON")
+	for _, t := range tokens {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", t.ID, t.Account, t.UserID, t.RevokedAt.Format(time.RFC3339), t.Reason)
+	}
+	w.Flush()
+}
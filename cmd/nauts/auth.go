@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+
+	"github.com/msimon/nauts/provider"
+	"github.com/msimon/nauts/units"
+)
+
+// runAuth handles 'auth'.
+func runAuth(args []string) error {
+	fs := flag.NewFlagSet("nauts auth", flag.ExitOnError)
+
+	var configPath, token, userSeedPath, ttlFlag, output, out string
+
+	fs.StringVar(&configPath, "c", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&configPath, "config", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&token, "token", "", "Auth request JSON, as sent by clients; - reads it from stdin")
+	fs.StringVar(&userSeedPath, "user-seed", "", "Path to the user nkey seed the JWT is issued to (default: an ephemeral key)")
+	fs.StringVar(&ttlFlag, "ttl", "", "JWT time-to-live (default: server.ttl, or 1h)")
+	fs.StringVar(&output, "output", "jwt", "Output format (jwt or creds)")
+	fs.StringVar(&out, "out", "", "Write the output to this file (mode 0600) instead of stdout")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s auth -c <config> --token <auth request> [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Authenticate an auth request like auth callout does and print the signed user JWT.\n")
+		fmt.Fprintf(os.Stderr, "With --output creds, print a creds file holding the JWT and the seed of the user key,\n")
+		fmt.Fprintf(os.Stderr, "generated unless --user-seed is given, for use with the nats CLI and client libraries.\n")
+		fmt.Fprintf(os.Stderr, "Servers accept such credentials only in operator mode; with a static account, the\n")
+		fmt.Fprintf(os.Stderr, "JWT is only valid inside callout responses.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if token == "" {
+		return fmt.Errorf("--token is required")
+	}
+	if output != "jwt" && output != "creds" {
+		return fmt.Errorf("unsupported output %q (expected jwt or creds)", output)
+	}
+	if token == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("reading token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	var userKey nkeys.KeyPair
+	if userSeedPath != "" {
+		data, err := os.ReadFile(userSeedPath)
+		if err != nil {
+			return fmt.Errorf("reading user seed: %w", err)
+		}
+		if data, err = provider.ResolveSeed(data); err != nil {
+			return fmt.Errorf("reading user seed: %w", err)
+		}
+		if userKey, err = nkeys.FromSeed(bytes.TrimSpace(data)); err != nil {
+			return fmt.Errorf("parsing user seed: %w", err)
+		}
+		if pub, _ := userKey.PublicKey(); !nkeys.IsValidPublicUserKey(pub) {
+			return fmt.Errorf("%s is not a user seed", userSeedPath)
+		}
+	} else if output == "creds" {
+		var err error
+		if userKey, err = nkeys.CreateUser(); err != nil {
+			return fmt.Errorf("creating user key: %w", err)
+		}
+	}
+
+	config, controller, err := loadOfflineController(configPath)
+	if err != nil {
+		return err
+	}
+	defer controller.Stop()
+
+	ttl := config.Server.GetTTL(time.Hour)
+	if ttlFlag != "" {
+		if ttl, err = units.ParseDuration(ttlFlag); err != nil {
+			return fmt.Errorf("invalid --ttl: %w", err)
+		}
+	}
+
+	// Without --user-seed and --output creds, the user key strategy of the
+	// configuration applies, as for callout requests without a key.
+	userPublicKey := ""
+	if userKey != nil {
+		userPublicKey, _ = userKey.PublicKey()
+	}
+	result, err := controller.Authenticate(context.Background(), natsjwt.ConnectOptions{Token: token}, userPublicKey, ttl)
+	if err != nil {
+		return fmt.Errorf("authentication failed: %w", err)
+	}
+
+	data := []byte(result.JWT + "\n")
+	if output == "creds" {
+		seed, _ := userKey.Seed()
+		if data, err = natsjwt.FormatUserConfig(result.JWT, seed); err != nil {
+			return fmt.Errorf("formatting creds: %w", err)
+		}
+	}
+	if out == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if err := writeSecretFile(out, data); err != nil {
+		return fmt.Errorf("writing %s: %w", out, err)
+	}
+	fmt.Fprintf(os.Stderr, "%s for %s written to %s\n", output, result.User.ID, out)
+	return nil
+}
+
+// writeSecretFile writes data to path with mode 0600. An existing file is
+// truncated and its mode tightened before the secret is written, as
+// os.WriteFile keeps the mode of existing files.
+func writeSecretFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/msimon/nauts/auth"
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/provider"
+)
+
+// runBinding handles the 'binding' subcommand group.
+func runBinding(args []string) error {
+	if len(args) == 0 {
+		printBindingUsage()
+		return fmt.Errorf("binding: subcommand is required")
+	}
+
+	switch args[0] {
+	case "request", "pending", "approve", "reject":
+		return runBindingRequest(args[0], args[1:])
+	case "-h", "-help", "--help", "help":
+		printBindingUsage()
+		return nil
+	default:
+		printBindingUsage()
+		return fmt.Errorf("binding: unknown subcommand %q", args[0])
+	}
+}
+
+func printBindingUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: %s binding <subcommand> [options]
+
+Subcommands:
+  request   Ask for a role binding; it takes effect once approved
+  pending   List the binding requests waiting for approval
+  approve   Write a requested binding to the policy store
+  reject    Discard a binding request
+
+The running nauts must be started with --enable-admin-svc and
+server.admin.pendingBindings. Requests need no admin token; pending, approve and
+reject require the token from server.admin.tokenFile.
+`, os.Args[0])
+}
+
+// runBindingRequest handles 'binding request', 'binding pending', 'binding
+// approve' and 'binding reject' by sending a request to the admin service of
+// a running nauts.
+func runBindingRequest(name string, args []string) error {
+	fs := flag.NewFlagSet("nauts binding "+name, flag.ExitOnError)
+
+	var configPath, format, roleID, account, policies, maxTTL, expiresAt, requestedBy, reason string
+	var timeout time.Duration
+
+	fs.StringVar(&configPath, "c", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file (for the NATS connection)")
+	fs.StringVar(&configPath, "config", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file (for the NATS connection)")
+	fs.DurationVar(&timeout, "timeout", 5*time.Second, "Request timeout")
+	fs.StringVar(&format, "format", "text", "Output format (text or json)")
+	switch name {
+	case "request":
+		fs.StringVar(&roleID, "role", "", "Role to bind (<account>.<role>)")
+		fs.StringVar(&policies, "policies", "", "Comma-separated policy IDs to bind")
+		fs.StringVar(&maxTTL, "max-ttl", "", "Maximum session TTL of the binding, e.g. 1h (optional)")
+		fs.StringVar(&expiresAt, "expires-at", "", "End of the grant in RFC 3339, e.g. 2026-11-01T00:00:00Z (optional)")
+		fs.StringVar(&requestedBy, "requested-by", os.Getenv("USER"), "Requester recorded with the request")
+		fs.StringVar(&reason, "reason", "", "Why the binding is needed")
+	case "pending":
+		fs.StringVar(&account, "account", "", "Only list requests for this account")
+	case "approve":
+		fs.StringVar(&roleID, "role", "", "Role of the request to approve (<account>.<role>)")
+	case "reject":
+		fs.StringVar(&roleID, "role", "", "Role of the request to reject (<account>.<role>)")
+		fs.StringVar(&reason, "reason", "", "Reason logged with the rejection")
+	}
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s binding %s [options]\n\n", os.Args[0], name)
+		switch name {
+		case "request":
+			fmt.Fprintf(os.Stderr, "Request a role binding. A new request for the same role replaces the previous one.\n")
+			fmt.Fprintf(os.Stderr, "Requests expire after server.admin.pendingBindings.retention.\n\n")
+		case "pending":
+			fmt.Fprintf(os.Stderr, "List the binding requests waiting for approval, oldest first.\n\n")
+		case "approve":
+			fmt.Fprintf(os.Stderr, "Approve a binding request: the binding is written to the policy store,\n")
+			fmt.Fprintf(os.Stderr, "replacing an existing binding of the role.\n\n")
+		case "reject":
+			fmt.Fprintf(os.Stderr, "Reject a binding request.\n\n")
+		}
+		fmt.Fprintf(os.Stderr, "Connects with the server section of the configuration file.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if configPath == "" {
+		return fmt.Errorf("-c/--config is required")
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unsupported format %q (expected text or json)", format)
+	}
+
+	var req auth.AdminStoreRequest
+	switch name {
+	case "request":
+		b, err := requestedBinding(roleID, policies, maxTTL, expiresAt)
+		if err != nil {
+			return err
+		}
+		if requestedBy == "" {
+			return fmt.Errorf("--requested-by is required")
+		}
+		req = auth.AdminStoreRequest{Binding: b, RequestedBy: requestedBy, Reason: reason}
+	case "pending":
+		req.Account = account
+	case "approve", "reject":
+		if roleID == "" {
+			return fmt.Errorf("--role is required")
+		}
+		role, err := identity.ParseRoleID(roleID)
+		if err != nil {
+			return fmt.Errorf("invalid --role: %w", err)
+		}
+		req = auth.AdminStoreRequest{Account: role.Account, Role: role.Name, Reason: reason}
+	}
+
+	config, err := auth.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	if err := validateServerConfig(&config.Server); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("encoding %s request: %w", name, err)
+	}
+	subject := auth.AdminPendingSubjectPrefix + name
+	if name == "pending" {
+		subject = auth.AdminPendingSubjectPrefix + "list"
+	}
+	data, err := sendAdminRequest(config, subject, payload, timeout)
+	if err != nil {
+		return err
+	}
+	var resp auth.AdminStoreResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return fmt.Errorf("decoding admin response: %w", err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("%s: %s", resp.Error.Code, resp.Error.Message)
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(resp); err != nil {
+			return fmt.Errorf("encoding admin response: %w", err)
+		}
+		return nil
+	}
+	switch name {
+	case "request":
+		fmt.Printf("requested binding %s, waiting for approval\n", req.Binding.IdentityRole())
+	case "approve":
+		fmt.Printf("approved binding %s\n", resp.Binding.IdentityRole())
+	case "reject":
+		fmt.Printf("rejected binding %s.%s\n", req.Account, req.Role)
+	default:
+		printPendingBindings(resp.Pending)
+	}
+	return nil
+}
+
+// requestedBinding builds the binding of 'binding request' from its flags.
+func requestedBinding(roleID, policies, maxTTL, expiresAt string) (*provider.Binding, error) {
+	if roleID == "" || policies == "" {
+		return nil, fmt.Errorf("--role and --policies are required")
+	}
+	role, err := identity.ParseRoleID(roleID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --role: %w", err)
+	}
+	b := &provider.Binding{Role: role.Name, Account: role.Account, MaxTTL: maxTTL}
+	for _, id := range strings.Split(policies, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			b.Policies = append(b.Policies, id)
+		}
+	}
+	if expiresAt != "" {
+		t, err := time.Parse(time.RFC3339, expiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --expires-at: %w", err)
+		}
+		b.ExpiresAt = &t
+	}
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// printPendingBindings writes binding requests as a table to stdout.
+func printPendingBindings(pending []*auth.PendingBinding) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ROLE\tPOLICIES\tEXPIRES AT\tREQUESTED BY\tREQUESTED AT\tREASON")
+	for _, p := range pending {
+		expires := "-"
+		if p.Binding.ExpiresAt != nil {
+			expires = p.Binding.ExpiresAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", p.Binding.IdentityRole(), strings.Join(p.Binding.Policies, ","),
+			expires, p.RequestedBy, p.RequestedAt.Format(time.RFC3339), p.Reason)
+	}
+	w.Flush()
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+
+	"github.com/msimon/nauts/auth"
+	"github.com/msimon/nauts/nautsclient"
+)
+
+// runDev handles the 'dev' command: an embedded nats-server with the auth
+// callout wired to an in-process nauts, using a generated configuration.
+func runDev(args []string) error {
+	fs := flag.NewFlagSet("nauts dev", flag.ExitOnError)
+
+	var dir string
+	var port int
+	var jetStream, enableDebugSvc, serverLogs bool
+
+	fs.StringVar(&dir, "dir", "", "Directory for the generated environment; kept across runs (default: a temporary directory removed on exit)")
+	fs.IntVar(&port, "port", 4222, "NATS client port")
+	fs.BoolVar(&jetStream, "jetstream", true, "Enable JetStream")
+	fs.BoolVar(&enableDebugSvc, "enable-debug-svc", false, "Start the NATS auth debug service")
+	fs.BoolVar(&serverLogs, "server-logs", false, "Print the nats-server log")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s dev [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Run an in-process nats-server with the auth callout handled by nauts, for local development.\n")
+		fmt.Fprintf(os.Stderr, "Keys, sample users, policies, and bindings are generated; with --dir, edits to them\n")
+		fmt.Fprintf(os.Stderr, "survive restarts. The sample users share a well-known password: never expose this server.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if dir == "" {
+		tmp, err := os.MkdirTemp("", "nauts-dev-*")
+		if err != nil {
+			return fmt.Errorf("creating temporary directory: %w", err)
+		}
+		defer os.RemoveAll(tmp)
+		dir = tmp
+	}
+
+	env, err := auth.GenerateDevEnvironment(auth.DevEnvironmentConfig{
+		Dir:       dir,
+		Port:      port,
+		JetStream: jetStream,
+	})
+	if err != nil {
+		return fmt.Errorf("generating dev environment: %w", err)
+	}
+
+	opts, err := server.ProcessConfigFile(env.ServerConfigPath)
+	if err != nil {
+		return fmt.Errorf("loading %s: %w", env.ServerConfigPath, err)
+	}
+	opts.NoSigs = true
+	ns, err := server.NewServer(opts)
+	if err != nil {
+		return fmt.Errorf("creating nats-server: %w", err)
+	}
+	if serverLogs {
+		ns.ConfigureLogger()
+	}
+	go ns.Start()
+	defer ns.WaitForShutdown()
+	defer ns.Shutdown()
+	if !ns.ReadyForConnections(10 * time.Second) {
+		return fmt.Errorf("nats-server did not start on %s", env.NatsURL)
+	}
+
+	// The generated configuration may predate a change of --port; $NATS_URL
+	// takes precedence over server.natsUrl in every service.
+	if err := os.Setenv("NATS_URL", ns.ClientURL()); err != nil {
+		return err
+	}
+
+	config, controller, err := loadConfigAndController(env.ConfigPath)
+	if err != nil {
+		return err
+	}
+	calloutConfig, err := config.Server.ToCalloutConfig()
+	if err != nil {
+		return fmt.Errorf("creating callout config: %w", err)
+	}
+	service, err := auth.NewCalloutService(controller, calloutConfig)
+	if err != nil {
+		return fmt.Errorf("creating callout service: %w", err)
+	}
+
+	var debugService *auth.DebugService
+	if enableDebugSvc {
+		debugService, err = auth.NewDebugService(controller, config.Server, auth.WithSubscriptionStats(service.SubscriptionStats))
+		if err != nil {
+			return fmt.Errorf("creating debug service: %w", err)
+		}
+	}
+
+	ctx, cancel := setupSignalHandler(func() {
+		service.Stop()
+		if debugService != nil {
+			debugService.Stop()
+		}
+	})
+	defer cancel()
+
+	debugErrCh := make(chan error, 1)
+	if debugService != nil {
+		go func() {
+			if err := debugService.Start(ctx); err != nil {
+				debugErrCh <- err
+				cancel()
+				return
+			}
+			debugErrCh <- nil
+		}()
+	}
+
+	printDevEnvironment(env, ns.ClientURL())
+
+	if err := service.Start(ctx); err != nil {
+		return fmt.Errorf("running callout service: %w", err)
+	}
+	if debugService != nil {
+		if err := <-debugErrCh; err != nil {
+			return fmt.Errorf("running debug service: %w", err)
+		}
+	}
+	return nil
+}
+
+// printDevEnvironment tells the developer where the environment lives and
+// how to connect as each sample user.
+func printDevEnvironment(env *auth.DevEnvironment, url string) {
+	fmt.Fprintf(os.Stderr, "nauts dev environment ready (press Ctrl-C to stop)\n\n")
+	fmt.Fprintf(os.Stderr, "  NATS URL:      %s\n", url)
+	fmt.Fprintf(os.Stderr, "  Directory:     %s\n", env.Dir)
+	fmt.Fprintf(os.Stderr, "  nauts config:  %s\n", env.ConfigPath)
+	fmt.Fprintf(os.Stderr, "  server config: %s\n", env.ServerConfigPath)
+	if len(env.Users) == 0 {
+		fmt.Fprintf(os.Stderr, "\nUsers are read from %s/users.json.\n", env.Dir)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\nSample users:\n")
+	for _, u := range env.Users {
+		token, err := nautsclient.Token(u.Account, nautsclient.Password(u.Username, u.Password))
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "  %-6s roles %v\n", u.Username, u.Roles)
+		fmt.Fprintf(os.Stderr, "         nats --server %s --token '%s' sub 'app.>'\n", url, token)
+	}
+	fmt.Fprintf(os.Stderr, "\nIn Go: nats.Connect(%q, nautsclient.Option(%q, nautsclient.Password(\"alice\", %q)))\n", url, auth.DevAccount, auth.DevPassword)
+}
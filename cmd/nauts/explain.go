@@ -0,0 +1,527 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/msimon/nauts/auth"
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/policy"
+	"github.com/msimon/nauts/provider"
+)
+
+// errPolicyLintFailed is returned by 'explain policies' when a lint error was found.
+var errPolicyLintFailed = errors.New("policy lint found errors")
+
+// lintRuleDescriptions are the SARIF short descriptions of the report rules.
+var lintRuleDescriptions = map[string]string{
+	provider.LintRuleMissingPolicy:     "Binding references a policy that does not exist",
+	provider.LintRuleAccountMismatch:   "Binding references a policy of another account",
+	provider.LintRuleEmptyBinding:      "Binding grants no policies",
+	provider.LintRuleExpiredBinding:    "Binding is past its expiry and grants no policies",
+	provider.LintRuleUnusedPolicy:      "Policy is not referenced by any binding",
+	provider.LintRuleJetStreamDisabled: "Policy grants JetStream actions in an account without JetStream",
+	provider.LintRuleForeignSubject:    "Policy grants subjects claimed by another team",
+	"diff-missing":                     "Entry exists only in the source store",
+	"diff-extra":                       "Entry exists only in the compared store",
+	"diff-changed":                     "Entry differs between the stores",
+}
+
+// runExplain handles the 'explain' subcommand group.
+func runExplain(args []string) error {
+	if len(args) == 0 {
+		printExplainUsage()
+		return fmt.Errorf("explain: subcommand is required")
+	}
+
+	switch args[0] {
+	case "provider":
+		return runExplainProvider(args[1:])
+	case "policies":
+		return runExplainPolicies(args[1:])
+	case "builtins":
+		return runExplainBuiltins(args[1:])
+	case "permissions":
+		return runExplainPermissions(args[1:])
+	case "-h", "-help", "--help", "help":
+		printExplainUsage()
+		return nil
+	default:
+		printExplainUsage()
+		return fmt.Errorf("explain: unknown subcommand %q", args[0])
+	}
+}
+
+func printExplainUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: %s explain <subcommand> [options]
+
+Subcommands:
+  provider   Show which authentication provider an auth request would use
+  policies   Lint a policy store and diff it against another, for CI annotations
+  builtins   List the built-in policies bindings can reference, or show one resolved
+  permissions
+             Show which policy statement granted each permission of a token or role
+`, os.Args[0])
+}
+
+// runExplainProvider handles 'explain provider'.
+func runExplainProvider(args []string) error {
+	fs := flag.NewFlagSet("nauts explain provider", flag.ExitOnError)
+
+	var configPath, account, ap, clientIP, format string
+
+	fs.StringVar(&configPath, "c", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&configPath, "config", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&account, "account", "", "Account of the auth request")
+	fs.StringVar(&ap, "ap", "", "Authentication provider id of the auth request (optional)")
+	fs.StringVar(&clientIP, "client-ip", "", "Client address, for providers restricted with allowedCidrs (optional)")
+	fs.StringVar(&format, "format", "text", "Output format (text or json)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s explain provider [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Show which authentication provider would verify an auth request for an account and why.\n")
+		fmt.Fprintf(os.Stderr, "Only auth providers are initialized; no NATS connection or signing keys are needed.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if configPath == "" {
+		return fmt.Errorf("-c/--config is required")
+	}
+	if account == "" {
+		return fmt.Errorf("--account is required")
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unsupported format %q (expected text or json)", format)
+	}
+
+	req := identity.AuthRequest{Account: account, AP: ap}
+	if clientIP != "" {
+		ip, err := netip.ParseAddr(clientIP)
+		if err != nil {
+			return fmt.Errorf("invalid --client-ip: %w", err)
+		}
+		req.ClientIP = ip
+	}
+
+	config, err := auth.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	providers, err := auth.NewAuthenticationProviderManagerWithConfig(config)
+	if err != nil {
+		return err
+	}
+	defer providers.Stop()
+
+	selection, selectErr := providers.ExplainSelection(req)
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(selection); err != nil {
+			return fmt.Errorf("encoding selection: %w", err)
+		}
+	} else {
+		printProviderSelection(selection)
+	}
+	return selectErr
+}
+
+// runExplainBuiltins handles 'explain builtins'.
+func runExplainBuiltins(args []string) error {
+	fs := flag.NewFlagSet("nauts explain builtins", flag.ExitOnError)
+
+	var id, format string
+
+	fs.StringVar(&id, "id", "", "Built-in policy ID to resolve, e.g. builtin:kv-reader:config (optional)")
+	fs.StringVar(&format, "format", "text", "Output format (text or json)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s explain builtins [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "List the built-in policies that bindings of any policy provider can reference as\n")
+		fmt.Fprintf(os.Stderr, "builtin:<name>[:<arg>]. With --id, print the resolved policy as JSON.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unsupported format %q (expected text or json)", format)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if id != "" {
+		pol, err := policy.Builtin(id)
+		if err != nil {
+			return err
+		}
+		return enc.Encode(pol)
+	}
+
+	templates := policy.BuiltinTemplates()
+	if format == "json" {
+		return enc.Encode(templates)
+	}
+	for _, t := range templates {
+		usage := policy.BuiltinPrefix + t.Name
+		switch {
+		case t.Arg != "" && t.DefaultArg != "":
+			usage += fmt.Sprintf("[:<%s>]", t.Arg)
+		case t.Arg != "":
+			usage += fmt.Sprintf(":<%s>", t.Arg)
+		}
+		fmt.Printf("%-32s %s\n", usage, t.Description)
+	}
+	return nil
+}
+
+// printProviderSelection writes a human-readable provider selection to stdout.
+func printProviderSelection(selection *identity.ProviderSelection) {
+	for _, c := range selection.Candidates {
+		switch {
+		case c.ID == selection.ProviderID:
+			fmt.Printf("* %s  matches %q\n", c.ID, c.Pattern)
+		case c.Skipped != "":
+			fmt.Printf("  %s  skipped: %s\n", c.ID, c.Skipped)
+		default:
+			fmt.Printf("  %s  matches %q\n", c.ID, c.Pattern)
+		}
+	}
+	if selection.ProviderID == "" {
+		fmt.Printf("no provider selected for account %q\n", selection.Account)
+		return
+	}
+	fmt.Printf("selected %s for account %q (%s)\n", selection.ProviderID, selection.Account, selection.Reason)
+}
+
+// runExplainPolicies handles 'explain policies'.
+func runExplainPolicies(args []string) error {
+	fs := flag.NewFlagSet("nauts explain policies", flag.ExitOnError)
+
+	var configPath, source, against, format string
+
+	fs.StringVar(&configPath, "c", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&configPath, "config", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&source, "source", "file", "Policy provider type to lint (file, nats, sql, consul or canary)")
+	fs.StringVar(&against, "against", "", "Policy provider type to diff the source against (file, nats, sql, consul or canary, optional)")
+	fs.StringVar(&format, "format", "text", "Output format (text, json, junit, or sarif)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s explain policies [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Lint the bindings and policies of a policy provider and optionally list its\n")
+		fmt.Fprintf(os.Stderr, "differences to another provider. junit and sarif output can be uploaded by CI\n")
+		fmt.Fprintf(os.Stderr, "systems to annotate pull requests. Exits with status 1 if a lint error is found.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if configPath == "" {
+		return fmt.Errorf("-c/--config is required")
+	}
+	if against == source {
+		return fmt.Errorf("--source and --against must differ")
+	}
+	switch format {
+	case "text", "json", "junit", "sarif":
+	default:
+		return fmt.Errorf("unsupported format %q (expected text, json, junit, or sarif)", format)
+	}
+
+	config, err := auth.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	sourceStore, err := auth.NewPolicyStoreOfType(config, source)
+	if err != nil {
+		return fmt.Errorf("opening source: %w", err)
+	}
+	defer auth.StopPolicyStore(sourceStore)
+
+	ctx := context.Background()
+	findings, err := provider.LintPolicyStore(ctx, sourceStore)
+	if err != nil {
+		return err
+	}
+	if ownership, _ := config.Policy.SubjectOwnership(); ownership != nil {
+		policies, err := sourceStore.ListPolicies(ctx)
+		if err != nil {
+			return fmt.Errorf("listing policies: %w", err)
+		}
+		findings = append(findings, provider.LintSubjectOwnership(policies, ownership)...)
+	}
+
+	var diff *provider.StoreDiff
+	if against != "" {
+		againstStore, err := auth.NewPolicyStoreOfType(config, against)
+		if err != nil {
+			return fmt.Errorf("opening %s: %w", against, err)
+		}
+		defer auth.StopPolicyStore(againstStore)
+
+		diff, err = provider.DiffPolicyStores(ctx, sourceStore, againstStore)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		out := struct {
+			Findings []provider.LintFinding `json:"findings"`
+			Diff     *provider.StoreDiff    `json:"diff,omitempty"`
+		}{findings, diff}
+		if err := enc.Encode(out); err != nil {
+			return fmt.Errorf("encoding report: %w", err)
+		}
+	case "junit", "sarif":
+		report := policyReportFindings(config, source, against, findings, diff)
+		if format == "junit" {
+			suites := []string{"lint"}
+			if diff != nil {
+				suites = append(suites, "diff")
+			}
+			err = writeJUnit(os.Stdout, "nauts explain policies", suites, report)
+		} else {
+			err = writeSARIF(os.Stdout, lintRuleDescriptions, report)
+		}
+		if err != nil {
+			return err
+		}
+	default:
+		for _, f := range findings {
+			fmt.Println(f.String())
+		}
+		fmt.Printf("%d finding(s) in %s\n", len(findings), source)
+		if diff != nil {
+			printPolicyDiff(diff, source, against)
+		}
+	}
+
+	for _, f := range findings {
+		if f.Level == provider.LintError {
+			return errPolicyLintFailed
+		}
+	}
+	return nil
+}
+
+// policyReportFindings converts lint findings and diff entries to report
+// findings. Entries of a file store are located in its policies or bindings file.
+func policyReportFindings(config *auth.Config, source, against string, findings []provider.LintFinding, diff *provider.StoreDiff) []reportFinding {
+	locate := func(entryType, name string) (string, int) {
+		file := config.Policy.File
+		if source != "file" || file == nil {
+			return "", 0
+		}
+		if entryType == provider.DiffEntryBinding {
+			return filepath.ToSlash(filepath.Clean(file.BindingsPath)), locateKey(file.BindingsPath, "role", name)
+		}
+		return filepath.ToSlash(filepath.Clean(file.PoliciesPath)), locateKey(file.PoliciesPath, "id", name)
+	}
+
+	var report []reportFinding
+	for _, f := range findings {
+		path, line := locate(f.Type, f.Name)
+		report = append(report, reportFinding{
+			Suite:   "lint",
+			Rule:    f.Rule,
+			Level:   string(f.Level),
+			Name:    fmt.Sprintf("%s %s.%s", f.Type, f.Account, f.Name),
+			Message: f.Message,
+			File:    path,
+			Line:    line,
+		})
+	}
+	if diff == nil {
+		return report
+	}
+	for _, e := range diff.Entries {
+		var message string
+		switch e.Kind {
+		case provider.DiffMissing:
+			message = "only in " + source
+		case provider.DiffExtra:
+			message = "only in " + against
+		default:
+			message = "differs between " + source + " and " + against
+		}
+		f := reportFinding{
+			Suite:   "diff",
+			Rule:    "diff-" + string(e.Kind),
+			Level:   reportNote,
+			Name:    fmt.Sprintf("%s %s.%s", e.Type, e.Account, e.Name),
+			Message: message,
+		}
+		if e.Kind != provider.DiffExtra {
+			f.File, f.Line = locate(e.Type, e.Name)
+		}
+		report = append(report, f)
+	}
+	return report
+}
+
+// runExplainPermissions handles 'explain permissions'.
+func runExplainPermissions(args []string) error {
+	fs := flag.NewFlagSet("nauts explain permissions", flag.ExitOnError)
+
+	var configPath, token, roles, userID, subject, format string
+
+	fs.StringVar(&configPath, "c", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&configPath, "config", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&token, "token", "", "Auth request JSON to verify, as sent by clients; - reads it from stdin")
+	fs.StringVar(&roles, "role", "", "Comma-separated roles of one account (<account>.<role>), instead of --token")
+	fs.StringVar(&userID, "user", "explain", "User ID for --role, used in {{ user.id }} templates")
+	fs.StringVar(&subject, "subject", "", "Only show permissions covering this subject (optional)")
+	fs.StringVar(&format, "format", "text", "Output format (text or json)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s explain permissions [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Compile the permissions of an auth request token or of roles and show the policy,\n")
+		fmt.Fprintf(os.Stderr, "statement, and resource that produced each of them. No JWT is issued, so no NATS\n")
+		fmt.Fprintf(os.Stderr, "connection or signing keys are needed.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if configPath == "" {
+		return fmt.Errorf("-c/--config is required")
+	}
+	if (token == "") == (roles == "") {
+		return fmt.Errorf("exactly one of --token and --role is required")
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unsupported format %q (expected text or json)", format)
+	}
+
+	var user *auth.AccountScopedUser
+	if roles != "" {
+		var err error
+		if user, err = explainRoleUser(userID, roles); err != nil {
+			return err
+		}
+	}
+	if token == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("reading token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	config, err := auth.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	store, err := auth.NewPolicyStoreWithConfig(config)
+	if err != nil {
+		return err
+	}
+	defer auth.StopPolicyStore(store)
+	providers, err := auth.NewAuthenticationProviderManagerWithConfig(config)
+	if err != nil {
+		return err
+	}
+	defer providers.Stop()
+	controller := auth.NewAuthController(nil, store, providers)
+
+	ctx := context.Background()
+	var result *auth.NautsCompilationResult
+	if user != nil {
+		result, err = controller.ExplainPermissions(ctx, user)
+	} else {
+		result, err = controller.ExplainToken(ctx, token)
+	}
+	if err != nil {
+		return err
+	}
+
+	origins := result.Origins
+	if subject != "" {
+		origins = []auth.PermissionOrigin{}
+		for _, o := range result.Origins {
+			if o.Permission.Matches(subject) {
+				origins = append(origins, o)
+			}
+		}
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		out := struct {
+			User     string                  `json:"user"`
+			Account  string                  `json:"account"`
+			Roles    []identity.Role         `json:"roles"`
+			Warnings []string                `json:"warnings,omitempty"`
+			Origins  []auth.PermissionOrigin `json:"origins"`
+		}{result.User.ID, result.User.Account, result.Roles, result.Warnings, origins}
+		return enc.Encode(out)
+	}
+	printPermissionOrigins(result, origins)
+	return nil
+}
+
+// explainRoleUser builds the user explained for --role.
+func explainRoleUser(userID, roles string) (*auth.AccountScopedUser, error) {
+	user := &auth.AccountScopedUser{User: identity.User{ID: userID}}
+	for _, id := range strings.Split(roles, ",") {
+		role, err := identity.ParseRoleID(strings.TrimSpace(id))
+		if err != nil {
+			return nil, fmt.Errorf("invalid --role %q: %w", id, err)
+		}
+		if user.Account != "" && role.Account != user.Account {
+			return nil, fmt.Errorf("--role: all roles must belong to one account (%s, %s)", user.Account, role.Account)
+		}
+		user.Account = role.Account
+		user.Roles = append(user.Roles, role)
+	}
+	return user, nil
+}
+
+// printPermissionOrigins writes the explained permissions to stdout, one per
+// line. Permissions dropped during deduplication are marked with "~".
+func printPermissionOrigins(result *auth.NautsCompilationResult, origins []auth.PermissionOrigin) {
+	fmt.Printf("user %s in account %s, roles %v\n", result.User.ID, result.User.Account, result.Roles)
+	for _, w := range result.Warnings {
+		fmt.Printf("warning: %s\n", w)
+	}
+	for _, o := range origins {
+		mark := " "
+		if !o.Effective {
+			mark = "~"
+		}
+		perm := fmt.Sprintf("%s %s %s", o.Effect, o.Permission.Type, o.Permission)
+		if o.PolicyID == "" {
+			fmt.Printf("%s %-48s implicit: %s\n", mark, perm, o.Implicit)
+			continue
+		}
+		origin := fmt.Sprintf("%s: %s statement %d, %s on %q", o.Role, o.PolicyID, o.Statement, o.Action, o.Resource)
+		if o.Implicit != "" {
+			origin += " (" + o.Implicit + ")"
+		}
+		fmt.Printf("%s %-48s %s\n", mark, perm, origin)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// runExport handles the 'export' subcommand group.
+func runExport(args []string) error {
+	if len(args) == 0 {
+		printExportUsage()
+		return fmt.Errorf("export: subcommand is required")
+	}
+
+	switch args[0] {
+	case "server-config":
+		return runExportServerConfig(args[1:])
+	case "-h", "-help", "--help", "help":
+		printExportUsage()
+		return nil
+	default:
+		printExportUsage()
+		return fmt.Errorf("export: unknown subcommand %q", args[0])
+	}
+}
+
+func printExportUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: %s export <subcommand> [options]
+
+Subcommands:
+  server-config   Emit the users of file providers with their compiled permissions as nats-server configuration
+`, os.Args[0])
+}
+
+// runExportServerConfig handles 'export server-config'.
+func runExportServerConfig(args []string) error {
+	fs := flag.NewFlagSet("nauts export server-config", flag.ExitOnError)
+
+	var configPath, format, output string
+
+	fs.StringVar(&configPath, "c", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&configPath, "config", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&format, "format", "conf", "Output format (conf or json)")
+	fs.StringVar(&output, "output", "", "Output file (default: stdout)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s export server-config [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Compile the permissions of every user of the file authentication providers and print them\n")
+		fmt.Fprintf(os.Stderr, "as an accounts block for nats-server, so a small deployment can run without auth callout,\n")
+		fmt.Fprintf(os.Stderr, "or so the result can be diffed against a legacy configuration. Users of several accounts\n")
+		fmt.Fprintf(os.Stderr, "are named <account>/<username>. Skipped users and lost details are reported on stderr.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if format != "conf" && format != "json" {
+		return fmt.Errorf("unsupported format %q (expected conf or json)", format)
+	}
+
+	config, controller, err := loadOfflineController(configPath)
+	if err != nil {
+		return err
+	}
+	defer controller.Stop()
+	if len(config.Auth.File) == 0 {
+		return fmt.Errorf("the configuration has no file authentication provider (auth.file)")
+	}
+
+	export, err := controller.ExportServerConfig(context.Background(), config)
+	if err != nil {
+		return err
+	}
+	for _, w := range export.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+
+	var out io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	if format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(export)
+	}
+	return export.WriteNatsConfig(out)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/msimon/nauts/provider"
+)
+
+// runKey handles the 'key' subcommand group.
+func runKey(args []string) error {
+	if len(args) == 0 {
+		printKeyUsage()
+		return fmt.Errorf("key: subcommand is required")
+	}
+
+	switch args[0] {
+	case "encrypt":
+		return runKeyEncrypt(args[1:])
+	case "-h", "-help", "--help", "help":
+		printKeyUsage()
+		return nil
+	default:
+		printKeyUsage()
+		return fmt.Errorf("key: unknown subcommand %q", args[0])
+	}
+}
+
+func printKeyUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: %s key <subcommand> [options]
+
+Subcommands:
+  encrypt   Encrypt an nkey or xkey seed file with a passphrase
+`, os.Args[0])
+}
+
+// runKeyEncrypt handles 'key encrypt'.
+func runKeyEncrypt(args []string) error {
+	fs := flag.NewFlagSet("nauts key encrypt", flag.ExitOnError)
+
+	var in, out string
+
+	fs.StringVar(&in, "in", "", "Path to the seed file to encrypt")
+	fs.StringVar(&out, "out", "", "Path to write the encrypted seed to")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s key encrypt --in <seed file> --out <file>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Encrypt a seed with AES-256-GCM under a key derived from $%s. The encrypted\n", provider.KeyPassphraseEnv)
+		fmt.Fprintf(os.Stderr, "file (mode 0600) can replace the seed file in privateKeyPath, signingKeyPath, and\n")
+		fmt.Fprintf(os.Stderr, "server.xkeySeedFile; nauts decrypts it at load time with the same variable.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if in == "" || out == "" {
+		return fmt.Errorf("--in and --out are required")
+	}
+	passphrase := os.Getenv(provider.KeyPassphraseEnv)
+	if passphrase == "" {
+		return fmt.Errorf("%s is not set", provider.KeyPassphraseEnv)
+	}
+
+	seed, err := os.ReadFile(in)
+	if err != nil {
+		return fmt.Errorf("reading seed: %w", err)
+	}
+	if provider.IsEncryptedSeed(seed) {
+		return fmt.Errorf("%s is already encrypted", in)
+	}
+	encrypted, err := provider.EncryptSeed(seed, []byte(passphrase))
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("writing encrypted seed: %w", err)
+	}
+	if _, err := f.Write(encrypted); err != nil {
+		f.Close()
+		return fmt.Errorf("writing encrypted seed: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing encrypted seed: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Encrypted seed written to %s\n", out)
+	return nil
+}
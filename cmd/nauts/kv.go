@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/msimon/nauts/auth"
+	"github.com/msimon/nauts/policy"
+	"github.com/msimon/nauts/provider"
+)
+
+// runKV handles the 'kv' subcommand group.
+func runKV(args []string) error {
+	if len(args) == 0 {
+		printKVUsage()
+		return fmt.Errorf("kv: subcommand is required")
+	}
+
+	switch args[0] {
+	case "bootstrap":
+		return runKVBootstrap(args[1:])
+	case "-h", "-help", "--help", "help":
+		printKVUsage()
+		return nil
+	default:
+		printKVUsage()
+		return fmt.Errorf("kv: unknown subcommand %q", args[0])
+	}
+}
+
+func printKVUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: %s kv <subcommand> [options]
+
+Subcommands:
+  bootstrap    Create the policy bucket and print the policy that grants nauts access to it
+`, os.Args[0])
+}
+
+// runKVBootstrap handles 'kv bootstrap'.
+func runKVBootstrap(args []string) error {
+	fs := flag.NewFlagSet("nauts kv bootstrap", flag.ExitOnError)
+
+	var configPath, account, format string
+	var history, maxValueSize, replicas int
+	var readOnly, dryRun bool
+
+	fs.StringVar(&configPath, "c", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&configPath, "config", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.IntVar(&history, "history", provider.DefaultPolicyBucketHistory, "Revisions kept per policy and binding (1-64)")
+	fs.IntVar(&maxValueSize, "max-value-size", provider.DefaultPolicyBucketMaxValueSize, "Maximum size of a policy or binding in bytes")
+	fs.IntVar(&replicas, "replicas", 1, "Number of bucket replicas in a cluster")
+	fs.StringVar(&account, "account", "*", "Account of the emitted policy")
+	fs.BoolVar(&readOnly, "read-only", false, "Only grant reading the bucket (no account apply or binding approvals)")
+	fs.StringVar(&format, "format", "policy", "Output format: policy (a nauts policy) or nats (the NATS pub/sub permissions)")
+	fs.BoolVar(&dryRun, "dry-run", false, "Only print the policy, without creating the bucket")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s kv bootstrap [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Create or update the bucket of policy.nats with the recommended settings, connecting with\n")
+		fmt.Fprintf(os.Stderr, "its credentials, and print the minimal policy granting the nauts service account access to it.\n")
+		fmt.Fprintf(os.Stderr, "Use --format nats for the permissions of a service account that nauts does not authenticate.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if configPath == "" {
+		return fmt.Errorf("-c/--config is required")
+	}
+	if format != "policy" && format != "nats" {
+		return fmt.Errorf("unsupported format %q (must be 'policy' or 'nats')", format)
+	}
+	if history < 1 || history > 64 {
+		return fmt.Errorf("--history must be between 1 and 64")
+	}
+	if maxValueSize < 1 || maxValueSize > 1<<31-1 {
+		return fmt.Errorf("--max-value-size must be positive")
+	}
+
+	config, err := auth.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	if config.Policy.Nats == nil {
+		return fmt.Errorf("policy.nats is not configured")
+	}
+	bucket := config.Policy.Nats.Bucket
+
+	if !dryRun {
+		status, err := provider.BootstrapNatsPolicyBucket(context.Background(), *config.Policy.Nats, provider.PolicyBucketOptions{
+			History:      uint8(history),
+			MaxValueSize: int32(maxValueSize),
+			Replicas:     replicas,
+		})
+		if err != nil {
+			return fmt.Errorf("bootstrapping bucket: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "bucket %s ready: history %d, %d keys\n", status.Bucket(), status.History(), status.Values())
+	}
+
+	pol := provider.PolicyBucketAccessPolicy(account, bucket, readOnly)
+	if err := pol.Validate(); err != nil {
+		return fmt.Errorf("invalid policy: %w", err)
+	}
+	var out any = pol
+	if format == "nats" {
+		perms := policy.NewNatsPermissions()
+		policy.Compile([]*policy.Policy{pol}, &policy.PolicyContext{Account: account}, perms)
+		// JetStream API responses arrive on the connection's inbox.
+		perms.Allow(policy.Permission{Type: policy.PermSub, Subject: "_INBOX.>"})
+		perms.Deduplicate()
+		out = perms.ToNatsJWT()
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(out)
+}
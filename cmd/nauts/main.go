@@ -3,13 +3,16 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/msimon/nauts/auth"
+	"github.com/msimon/nauts/tracing"
 )
 
 func main() {
@@ -25,19 +28,94 @@ func run() error {
 		case "-h", "-help", "--help", "help":
 			printUsage()
 			return nil
+		case "account":
+			return runAccount(os.Args[2:])
+		case "admin":
+			return runAdmin(os.Args[2:])
+		case "auth":
+			return runAuth(os.Args[2:])
+		case "binding":
+			return runBinding(os.Args[2:])
+		case "dev":
+			return runDev(os.Args[2:])
+		case "explain":
+			return runExplain(os.Args[2:])
+		case "export":
+			return runExport(os.Args[2:])
+		case "gen":
+			return runGen(os.Args[2:])
+		case "key":
+			return runKey(os.Args[2:])
+		case "kv":
+			return runKV(os.Args[2:])
+		case "policy":
+			return runPolicy(os.Args[2:])
+		case "reconcile":
+			return runReconcile(os.Args[2:])
+		case "release":
+			return runRelease(os.Args[2:])
+		case "self-update":
+			return runSelfUpdate(os.Args[2:])
+		case "support-bundle":
+			return runSupportBundle(os.Args[2:])
+		case "user":
+			return runUser(os.Args[2:])
+		case "validate":
+			return runValidate(os.Args[2:])
+		case "version", "--version":
+			return runVersion(os.Args[2:])
 		}
 	}
 
-	return runServe(os.Args[1:])
+	if handled, err := runPlatformService(os.Args[1:]); handled {
+		return err
+	}
+	return runServe(os.Args[1:], newServiceManager())
 }
 
 func printUsage() {
 	fmt.Fprintf(os.Stderr, `Usage: %s [options]
+       %s <command> [options]
 
 Run the NATS auth callout service (optionally with debug service).
 
+Commands:
+  account apply      Apply an account onboarding manifest
+  account push       Push the managed account JWTs to the account resolver
+  admin history      Show the configurations a running nauts keeps for rollback
+  admin rollback     Revert a running nauts to its previous configuration
+  admin revoke       Revoke an issued user JWT by its jti
+  auth               Authenticate a token offline and print the user JWT or a creds file
+  binding request    Request a role binding that an admin approves
+  binding pending    List the binding requests waiting for approval
+  binding approve    Approve a binding request (binding reject discards it)
+  dev                Run an embedded nats-server wired to nauts with sample users and policies
+  explain provider   Show which authentication provider an auth request would use
+  explain policies   Lint policies and bindings, with CI-friendly junit/sarif output
+  explain builtins   List the built-in policies (builtin:<name>[:<arg>])
+  explain permissions
+                     Show the policy statement behind each permission of a token or role
+  export server-config
+                     Emit file provider users and their compiled permissions as nats-server configuration
+  gen policies       Generate a large set of policies, bindings, and users for load tests
+  key encrypt        Encrypt an nkey or xkey seed file with a passphrase
+  kv bootstrap       Create the policy bucket and print the policy that grants nauts access to it
+  policy diff        Compare the contents of two policy providers
+  policy usage       Report bindings, policies, and permissions granted but not used
+  policy revisions   List the kept revisions of a policy or binding in NATS KV
+  policy rollback    Restore a policy or binding in NATS KV to an earlier revision
+  policy label       Name a NATS KV revision, to pin policy.nats.revision to it
+  reconcile          Continuously sync a policy source of truth into NATS KV
+  release keygen     Create the key pair that signs releases
+  release build      Cross-compile signed release binaries for all platforms
+  self-update        Replace this binary with the latest signed release (--check to only report)
+  support-bundle     Collect redacted config, provider status, metrics, and logs for a bug report
+  user add           Add a user to a file authentication provider (also remove, set-password, list)
+  validate           Check a configuration, its providers, policies, and bindings offline
+  version            Print the version of this binary
+
 Use '%s -h' for more information.
-`, os.Args[0], os.Args[0])
+`, os.Args[0], os.Args[0], os.Args[0])
 }
 
 // envOrDefault returns the environment variable value if set, otherwise the default.
@@ -48,16 +126,18 @@ func envOrDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
-// runServe handles the 'serve' subcommand for the auth callout service.
-func runServe(args []string) error {
+// runServe handles the 'serve' subcommand for the auth callout service,
+// reporting readiness, reloads, and shutdown to the process manager.
+func runServe(args []string, manager serviceManager) error {
 	fs := flag.NewFlagSet("nauts", flag.ExitOnError)
 
 	var configPath string
-	var enableDebugSvc bool
+	var enableDebugSvc, enableAdminSvc bool
 
 	fs.StringVar(&configPath, "c", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
 	fs.StringVar(&configPath, "config", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
 	fs.BoolVar(&enableDebugSvc, "enable-debug-svc", false, "Start the NATS auth debug service")
+	fs.BoolVar(&enableAdminSvc, "enable-admin-svc", false, "Start the NATS admin service (reload history and rollback)")
 
 	fs.Usage = func() {
 		printServiceUsage(fs, "Run the NATS auth callout service.", true)
@@ -67,10 +147,47 @@ func runServe(args []string) error {
 		return err
 	}
 
+	// Tracing is configured with the standard OTEL_* environment variables.
+	tracer, err := tracing.NewFromEnv()
+	if err != nil {
+		return fmt.Errorf("configuring tracing: %w", err)
+	}
+	if tracer != nil {
+		tracing.SetDefault(tracer)
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = tracer.Shutdown(ctx)
+		}()
+	}
+
 	config, controller, err := loadConfigAndController(configPath)
 	if err != nil {
 		return err
 	}
+	// The audit log is carried over on reload, so it lives as long as the process.
+	if auditLog := controller.AuditLog(); auditLog != nil {
+		defer auditLog.Close()
+	}
+	// Likewise the revocation list, which the admin service revokes tokens in.
+	revocations, _ := controller.TokenTracker().(*auth.RevocationList)
+	if revocations != nil {
+		defer revocations.Close()
+	}
+
+	// Log what this instance will do, so a deployment can be checked at a glance.
+	summary, err := json.Marshal(config.Summary())
+	if err != nil {
+		return fmt.Errorf("encoding configuration summary: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Effective configuration: %s\n", summary)
+	if config.Server.FaultInjection != nil {
+		if auth.FaultInjectionEnabled() {
+			fmt.Fprintf(os.Stderr, "WARNING: fault injection is enabled; do not run this configuration in production\n")
+		} else {
+			fmt.Fprintf(os.Stderr, "WARNING: server.faultInjection is ignored; set %s=1 to enable it\n", auth.FaultInjectionEnv)
+		}
+	}
 
 	// Create callout config
 	calloutConfig, err := config.Server.ToCalloutConfig()
@@ -78,28 +195,168 @@ func runServe(args []string) error {
 		return fmt.Errorf("creating callout config: %w", err)
 	}
 
+	if op := config.Account.Operator; config.Account.Type == "operator" && op != nil && op.Manage != nil {
+		// Failures are not fatal: the resolver keeps the previous JWTs.
+		results, err := auth.PushAccountJWTsWithConfig(context.Background(), config, false)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: pushing account JWTs: %v\n", err)
+		}
+		for _, r := range results {
+			fmt.Fprintf(os.Stderr, "Account JWT push: %s\n", r)
+		}
+	}
+
+	var calloutOpts []auth.CalloutOption
+	pusher, err := auth.NewRevocationPusherWithConfig(config, revocations)
+	if err != nil {
+		return fmt.Errorf("creating revocation pusher: %w", err)
+	}
+	if pusher != nil {
+		defer pusher.Close()
+		calloutOpts = append(calloutOpts, auth.WithRevocationPusher(pusher))
+	}
+
 	// Create callout service
-	service, err := auth.NewCalloutService(controller, calloutConfig)
+	calloutOpts = append(calloutOpts, auth.WithReadyFunc(manager.Ready))
+	service, err := auth.NewCalloutService(controller, calloutConfig, calloutOpts...)
 	if err != nil {
 		return fmt.Errorf("creating callout service: %w", err)
 	}
 
 	var debugService *auth.DebugService
 	if enableDebugSvc {
-		debugService, err = auth.NewDebugService(controller, config.Server)
+		debugService, err = auth.NewDebugService(controller, config.Server,
+			auth.WithSubscriptionStats(service.SubscriptionStats),
+			auth.WithRateLimitStats(service.RateLimitStats),
+			auth.WithRequestPoolStats(service.RequestPoolStats),
+		)
 		if err != nil {
 			return fmt.Errorf("creating debug service: %w", err)
 		}
 	}
 
-	ctx, cancel := setupSignalHandler(func() {
+	var httpService *auth.HTTPService
+	if config.Server.HTTP != nil {
+		httpService, err = auth.NewHTTPService(controller, *config.Server.HTTP,
+			auth.WithHTTPReadinessChecks(service.CheckReadiness),
+			auth.WithHTTPSubscriptionStats(service.SubscriptionStats),
+			auth.WithHTTPRateLimitStats(service.RateLimitStats),
+			auth.WithHTTPRequestPoolStats(service.RequestPoolStats),
+			auth.WithHTTPDefaultTTL(calloutConfig.DefaultTTL),
+			auth.WithHTTPRateLimiter(service.RateLimiter()),
+		)
+		if err != nil {
+			return fmt.Errorf("creating http service: %w", err)
+		}
+	}
+
+	var grpcService *auth.GRPCService
+	if config.Server.GRPC != nil {
+		grpcService, err = auth.NewGRPCService(controller, *config.Server.GRPC,
+			auth.WithGRPCDefaultTTL(calloutConfig.DefaultTTL),
+			auth.WithGRPCRateLimiter(service.RateLimiter()),
+		)
+		if err != nil {
+			return fmt.Errorf("creating grpc service: %w", err)
+		}
+	}
+
+	// Reload providers on SIGHUP without dropping in-flight requests; previous
+	// controllers are kept for rollback via the admin service.
+	services := []auth.ControllerSetter{service}
+	if debugService != nil {
+		services = append(services, debugService)
+	}
+	if httpService != nil {
+		services = append(services, httpService)
+	}
+	if grpcService != nil {
+		services = append(services, grpcService)
+	}
+	reloader := auth.NewReloader(controller, configPath, config.Server.ReloadHistory, services...)
+
+	var adminService *auth.AdminService
+	if enableAdminSvc {
+		var adminOpts []auth.AdminOption
+		if revocations != nil {
+			adminOpts = append(adminOpts, auth.WithAdminRevocationList(revocations))
+		}
+		pending, err := auth.NewPendingBindingsWithConfig(config)
+		if err != nil {
+			return fmt.Errorf("opening pending bindings: %w", err)
+		}
+		if pending != nil {
+			defer pending.Close()
+			adminOpts = append(adminOpts, auth.WithAdminPendingBindings(pending))
+		}
+		adminService, err = auth.NewAdminService(reloader, config.Server, adminOpts...)
+		if err != nil {
+			return fmt.Errorf("creating admin service: %w", err)
+		}
+	}
+
+	stopServices := func() {
+		manager.Stopping()
 		service.Stop()
 		if debugService != nil {
 			debugService.Stop()
 		}
-	})
+		if adminService != nil {
+			adminService.Stop()
+		}
+		if httpService != nil {
+			httpService.Stop()
+		}
+		if grpcService != nil {
+			grpcService.Stop()
+		}
+	}
+	ctx, cancel := setupSignalHandler(stopServices)
 	defer cancel()
 
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-manager.StopRequested():
+			cancel()
+			stopServices()
+		}
+	}()
+	go manager.Watchdog(ctx, service.Healthy)
+
+	reloadCh := make(chan os.Signal, 1)
+	signal.Notify(reloadCh, syscall.SIGHUP)
+	defer signal.Stop(reloadCh)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-reloadCh:
+				manager.Reloading()
+				entry, err := reloadController(configPath, reloader)
+				manager.Ready()
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Reload failed, keeping current configuration: %v\n", err)
+					continue
+				}
+				fmt.Fprintf(os.Stderr, "Configuration reloaded from %s (generation %d)\n", configPath, entry.Generation)
+			}
+		}
+	}()
+
+	adminErrCh := make(chan error, 1)
+	if adminService != nil {
+		go func() {
+			if err := adminService.Start(ctx); err != nil {
+				adminErrCh <- err
+				cancel()
+				return
+			}
+			adminErrCh <- nil
+		}()
+	}
+
 	debugErrCh := make(chan error, 1)
 	if debugService != nil {
 		go func() {
@@ -112,6 +369,30 @@ func runServe(args []string) error {
 		}()
 	}
 
+	httpErrCh := make(chan error, 1)
+	if httpService != nil {
+		go func() {
+			if err := httpService.Start(ctx); err != nil {
+				httpErrCh <- err
+				cancel()
+				return
+			}
+			httpErrCh <- nil
+		}()
+	}
+
+	grpcErrCh := make(chan error, 1)
+	if grpcService != nil {
+		go func() {
+			if err := grpcService.Start(ctx); err != nil {
+				grpcErrCh <- err
+				cancel()
+				return
+			}
+			grpcErrCh <- nil
+		}()
+	}
+
 	// Start the callout service (blocks until shutdown)
 	if err := service.Start(ctx); err != nil {
 		return fmt.Errorf("running callout service: %w", err)
@@ -122,6 +403,21 @@ func runServe(args []string) error {
 			return fmt.Errorf("running debug service: %w", err)
 		}
 	}
+	if adminService != nil {
+		if err := <-adminErrCh; err != nil {
+			return fmt.Errorf("running admin service: %w", err)
+		}
+	}
+	if httpService != nil {
+		if err := <-httpErrCh; err != nil {
+			return fmt.Errorf("running http service: %w", err)
+		}
+	}
+	if grpcService != nil {
+		if err := <-grpcErrCh; err != nil {
+			return fmt.Errorf("running grpc service: %w", err)
+		}
+	}
 
 	return nil
 }
@@ -141,21 +437,72 @@ func validateServerConfig(c *auth.ServerConfig) error {
 	return nil
 }
 
-func loadConfigAndController(configPath string) (*auth.Config, *auth.AuthController, error) {
+// reloadController builds a new controller from the configuration file and
+// swaps it into the running services; the previous controller is kept for
+// rollback. JWT size metrics, the audit log, and the revocation list are
+// carried over, so the audit chain continues. Changes to the server section
+// (NATS connection, subjects, xkey, audit sinks, revocation, reload history)
+// require a restart.
+func reloadController(configPath string, reloader *auth.Reloader) (auth.ReloadEntry, error) {
+	current := reloader.Current()
+	var opts []auth.ControllerOption
+	if m := current.JWTSizeMetrics(); m != nil {
+		opts = append(opts, auth.WithJWTSizeMetrics(m))
+	}
+	if s := current.AccountStats(); s != nil {
+		opts = append(opts, auth.WithAccountStats(s))
+	}
+	if a := current.AuditLog(); a != nil {
+		opts = append(opts, auth.WithAuditLog(a))
+	}
+	if t := current.TokenTracker(); t != nil {
+		opts = append(opts, auth.WithTokenTracker(t))
+	}
+	_, next, err := loadConfigAndController(configPath, opts...)
+	if err != nil {
+		return auth.ReloadEntry{}, err
+	}
+	return reloader.Reload(next, configPath), nil
+}
+
+func loadConfigAndController(configPath string, opts ...auth.ControllerOption) (*auth.Config, *auth.AuthController, error) {
+	config, err := loadServerConfig(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newController(config, opts...)
+}
+
+// loadOfflineController is loadConfigAndController for one-shot commands,
+// which run next to the server: auditing is disabled, so that they neither
+// print records to stdout nor append to the server's audit log.
+func loadOfflineController(configPath string) (*auth.Config, *auth.AuthController, error) {
+	config, err := loadServerConfig(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	config.Server.Audit = nil
+	return newController(config)
+}
+
+func loadServerConfig(configPath string) (*auth.Config, error) {
 	if configPath == "" {
-		return nil, nil, fmt.Errorf("-c/--config is required")
+		return nil, fmt.Errorf("-c/--config is required")
 	}
 
 	config, err := auth.LoadConfig(configPath)
 	if err != nil {
-		return nil, nil, fmt.Errorf("loading configuration: %w", err)
+		return nil, fmt.Errorf("loading configuration: %w", err)
 	}
 
 	if err := validateServerConfig(&config.Server); err != nil {
-		return nil, nil, err
+		return nil, err
 	}
+	return config, nil
+}
 
-	controller, err := auth.NewAuthControllerWithConfig(config)
+func newController(config *auth.Config, opts ...auth.ControllerOption) (*auth.Config, *auth.AuthController, error) {
+	controller, err := auth.NewAuthControllerWithConfig(config, opts...)
 	if err != nil {
 		return nil, nil, fmt.Errorf("creating auth controller: %w", err)
 	}
@@ -188,9 +535,11 @@ func printServiceUsage(fs *flag.FlagSet, description string, includeTTL bool) {
 	fs.PrintDefaults()
 	fmt.Fprintf(os.Stderr, "\nEnvironment variables:\n")
 	fmt.Fprintf(os.Stderr, "  NAUTS_CONFIG       Path to configuration file\n")
+	fmt.Fprintf(os.Stderr, "  NAUTS_AUTH_<ID>_<FIELD>\n")
+	fmt.Fprintf(os.Stderr, "                     Override an auth provider field, e.g. NAUTS_AUTH_CORP_IDP_ISSUER\n")
 	fmt.Fprintf(os.Stderr, "\nExample:\n")
 	fmt.Fprintf(os.Stderr, "  %s -c config.json\n", os.Args[0])
-	fmt.Fprintf(os.Stderr, "\nConfiguration file format (JSON):\n")
+	fmt.Fprintf(os.Stderr, "\nConfiguration file format (JSON, or YAML with a .yaml/.yml extension):\n")
 	fmt.Fprintf(os.Stderr, `  {
 	"account": {
 	  "type": "static",
@@ -0,0 +1,562 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+
+	"github.com/msimon/nauts/auth"
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/provider"
+)
+
+// errPolicyDiffFound is returned by 'policy diff --exit-code' when the stores differ.
+var errPolicyDiffFound = errors.New("policy stores differ")
+
+// errPolicyTestWarnings is returned by 'policy test --fail-on-warning' when
+// the compilation produced warnings.
+var errPolicyTestWarnings = errors.New("permission compilation produced warnings")
+
+// runPolicy handles the 'policy' subcommand group.
+func runPolicy(args []string) error {
+	if len(args) == 0 {
+		printPolicyUsage()
+		return fmt.Errorf("policy: subcommand is required")
+	}
+
+	switch args[0] {
+	case "diff":
+		return runPolicyDiff(args[1:])
+	case "test":
+		return runPolicyTest(args[1:])
+	case "usage":
+		return runPolicyUsage(args[1:])
+	case "revisions", "rollback", "label":
+		return runPolicyRevisions(args[0], args[1:])
+	case "-h", "-help", "--help", "help":
+		printPolicyUsage()
+		return nil
+	default:
+		printPolicyUsage()
+		return fmt.Errorf("policy: unknown subcommand %q", args[0])
+	}
+}
+
+func printPolicyUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: %s policy <subcommand> [options]
+
+Subcommands:
+  diff       Compare the policies and bindings of two policy providers
+  test       Compile the permissions of a user with given roles, as issued in the JWT
+  usage      Report bindings, policies, and permissions that were granted but not used
+  revisions  List the kept revisions of a policy or binding in NATS KV
+  rollback   Restore a policy or binding in NATS KV to an earlier revision
+  label      Name a revision of the NATS KV bucket, to pin policy.nats.revision to it
+`, os.Args[0])
+}
+
+// runPolicyDiff handles 'policy diff'.
+func runPolicyDiff(args []string) error {
+	fs := flag.NewFlagSet("nauts policy diff", flag.ExitOnError)
+
+	var configPath, source, target, format string
+	var exitCode bool
+
+	fs.StringVar(&configPath, "c", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&configPath, "config", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&source, "source", "file", "Source policy provider type (file, nats, sql, consul or canary)")
+	fs.StringVar(&target, "target", "nats", "Target policy provider type (file, nats, sql, consul or canary)")
+	fs.StringVar(&format, "format", "text", "Output format (text or json)")
+	fs.BoolVar(&exitCode, "exit-code", false, "Exit with status 1 if the stores differ")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s policy diff [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Compare two policy providers configured in the same config file.\n")
+		fmt.Fprintf(os.Stderr, "Entries are reported as missing (only in source), extra (only in target), or changed.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if configPath == "" {
+		return fmt.Errorf("-c/--config is required")
+	}
+	if source == target {
+		return fmt.Errorf("--source and --target must differ")
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unsupported format %q (expected text or json)", format)
+	}
+
+	config, err := auth.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	sourceStore, err := auth.NewPolicyStoreOfType(config, source)
+	if err != nil {
+		return fmt.Errorf("opening source: %w", err)
+	}
+	defer auth.StopPolicyStore(sourceStore)
+
+	targetStore, err := auth.NewPolicyStoreOfType(config, target)
+	if err != nil {
+		return fmt.Errorf("opening target: %w", err)
+	}
+	defer auth.StopPolicyStore(targetStore)
+
+	diff, err := provider.DiffPolicyStores(context.Background(), sourceStore, targetStore)
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(diff); err != nil {
+			return fmt.Errorf("encoding diff: %w", err)
+		}
+	} else {
+		printPolicyDiff(diff, source, target)
+	}
+
+	if exitCode && !diff.IsEmpty() {
+		return errPolicyDiffFound
+	}
+	return nil
+}
+
+// printPolicyDiff writes a human-readable diff to stdout.
+func printPolicyDiff(diff *provider.StoreDiff, source, target string) {
+	if diff.IsEmpty() {
+		fmt.Printf("no differences between %s and %s\n", source, target)
+		return
+	}
+	for _, e := range diff.Entries {
+		fmt.Println(e.String())
+	}
+	fmt.Printf("%d difference(s) between %s and %s\n", len(diff.Entries), source, target)
+}
+
+// runPolicyUsage handles 'policy usage'.
+func runPolicyUsage(args []string) error {
+	fs := flag.NewFlagSet("nauts policy usage", flag.ExitOnError)
+
+	var configPath, auditPath, systemCreds, format string
+	var window, wait time.Duration
+
+	fs.StringVar(&configPath, "c", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&configPath, "config", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&auditPath, "audit", "", "Path to the audit log (server.audit.file)")
+	fs.DurationVar(&window, "window", 30*24*time.Hour, "Report on the audit records of this period, up to now")
+	fs.StringVar(&systemCreds, "system-creds", "", "Credentials of a system account user, to compare subscribe permissions with server interest (optional)")
+	fs.DurationVar(&wait, "wait", 2*time.Second, "How long to collect server responses with --system-creds")
+	fs.StringVar(&format, "format", "text", "Output format (text or json)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s policy usage [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Report what was granted but not used over a window, to guide least-privilege cleanup:\n")
+		fmt.Fprintf(os.Stderr, "bindings whose role no user was issued according to the audit log, policies only bound\n")
+		fmt.Fprintf(os.Stderr, "to such roles, and, with --system-creds, subscribe permissions of issued roles that no\n")
+		fmt.Fprintf(os.Stderr, "current subscription in their account uses. Publish permissions are not checked.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if configPath == "" || auditPath == "" {
+		return fmt.Errorf("-c/--config and --audit are required")
+	}
+	if window <= 0 {
+		return fmt.Errorf("--window must be positive")
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unsupported format %q (expected text or json)", format)
+	}
+
+	config, err := auth.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(auditPath)
+	if err != nil {
+		return fmt.Errorf("opening audit log: %w", err)
+	}
+	defer f.Close()
+	now := time.Now()
+	usage, err := auth.ReadAuditUsage(f, now.Add(-window), now)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	var interest []auth.ServerSubscription
+	if systemCreds != "" {
+		natsURL := config.Server.NatsURL
+		if v := os.Getenv("NATS_URL"); v != "" {
+			natsURL = v
+		}
+		if natsURL == "" {
+			natsURL = nats.DefaultURL
+		}
+		nc, err := nats.Connect(natsURL, nats.Name("nauts-policy-usage"), nats.UserCredentials(systemCreds))
+		if err != nil {
+			return fmt.Errorf("connecting to NATS as system user: %w", err)
+		}
+		defer nc.Close()
+		if interest, err = auth.QueryServerInterest(ctx, nc, wait); err != nil {
+			return err
+		}
+	}
+
+	store, err := auth.NewPolicyStoreWithConfig(config)
+	if err != nil {
+		return err
+	}
+	defer auth.StopPolicyStore(store)
+	controller := auth.NewAuthController(nil, store, nil)
+
+	report, err := controller.PermissionUsage(ctx, usage, interest)
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return fmt.Errorf("encoding usage report: %w", err)
+		}
+		return nil
+	}
+	for _, f := range report.Findings {
+		fmt.Println(f.String())
+	}
+	checked := "bindings and policies"
+	if report.InterestChecked {
+		checked += ", subscribe permissions"
+	}
+	fmt.Printf("%d finding(s) in %d audit record(s) since %s (%s)\n", len(report.Findings), usage.Records, usage.Since.Format(time.RFC3339), checked)
+	return nil
+}
+
+// attrFlag collects repeated --attr key=value flags.
+type attrFlag map[string]string
+
+func (a attrFlag) String() string {
+	pairs := make([]string, 0, len(a))
+	for k, v := range a {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (a attrFlag) Set(v string) error {
+	key, value, ok := strings.Cut(v, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("invalid attribute %q (expected key=value)", v)
+	}
+	a[key] = value
+	return nil
+}
+
+// runPolicyTest handles 'policy test'.
+func runPolicyTest(args []string) error {
+	fs := flag.NewFlagSet("nauts policy test", flag.ExitOnError)
+
+	var configPath, account, roles, userID, clientIP, format string
+	var failOnWarning bool
+	attrs := attrFlag{}
+
+	fs.StringVar(&configPath, "c", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&configPath, "config", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&account, "account", "", "Account of the user")
+	fs.StringVar(&roles, "role", "", "Comma-separated roles of the user in --account")
+	fs.StringVar(&userID, "user", "test", "User ID, as issued (after server.userIdNormalization), used in {{ user.id }} templates")
+	fs.Var(attrs, "attr", "User attribute key=value, used in {{ user.attr.<key> }} templates and conditions (repeatable)")
+	fs.StringVar(&clientIP, "client-ip", "", "Client address, for client.ip conditions and {{ client.host }} templates (optional)")
+	var client auth.ClientInfo
+	fs.StringVar(&client.Name, "client-name", "", "Client connection name, for {{ client.name }} templates and conditions (optional)")
+	fs.StringVar(&client.Lang, "client-lang", "", "Client library language, for {{ client.lang }} templates and conditions (optional)")
+	fs.StringVar(&client.Version, "client-version", "", "Client library version, for {{ client.version }} templates and conditions (optional)")
+	fs.StringVar(&format, "format", "text", "Output format (text or json)")
+	fs.BoolVar(&failOnWarning, "fail-on-warning", false, "Exit with status 1 if the compilation produced warnings")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s policy test [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Compile the permissions of a user with the given roles like the auth callout does and\n")
+		fmt.Fprintf(os.Stderr, "print the publish and subscribe allow and deny lists as embedded in the user JWT, with\n")
+		fmt.Fprintf(os.Stderr, "the compilation warnings. No JWT is issued, so no NATS connection or signing keys are\n")
+		fmt.Fprintf(os.Stderr, "needed. Run it in CI to check the effect of policy changes.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if configPath == "" || account == "" || roles == "" {
+		return fmt.Errorf("-c/--config, --account, and --role are required")
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unsupported format %q (expected text or json)", format)
+	}
+
+	user := &auth.AccountScopedUser{User: identity.User{ID: userID}, Account: account}
+	if len(attrs) > 0 {
+		user.Attributes = attrs
+	}
+	for _, name := range strings.Split(roles, ",") {
+		role, err := identity.ParseRoleID(account + "." + strings.TrimSpace(name))
+		if err != nil {
+			return fmt.Errorf("invalid --role %q: %w", name, err)
+		}
+		user.Roles = append(user.Roles, role)
+	}
+
+	ctx := context.Background()
+	if clientIP != "" {
+		ip, err := netip.ParseAddr(clientIP)
+		if err != nil {
+			return fmt.Errorf("invalid --client-ip: %w", err)
+		}
+		ctx = auth.ContextWithClientIP(ctx, ip)
+	}
+	ctx = auth.ContextWithClientInfo(ctx, client)
+
+	config, err := auth.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	opts, err := auth.CompilationOptionsWithConfig(config)
+	if err != nil {
+		return err
+	}
+	store, err := auth.NewPolicyStoreWithConfig(config)
+	if err != nil {
+		return err
+	}
+	defer auth.StopPolicyStore(store)
+	controller := auth.NewAuthController(nil, store, nil, opts...)
+
+	result, err := controller.CompileNatsPermissions(ctx, user)
+	if err != nil {
+		return err
+	}
+	perms := result.Permissions.ToNatsJWT()
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		out := struct {
+			User        string              `json:"user"`
+			Account     string              `json:"account"`
+			Roles       []identity.Role     `json:"roles"`
+			Warnings    []string            `json:"warnings,omitempty"`
+			Permissions natsjwt.Permissions `json:"permissions"`
+		}{result.User.ID, result.User.Account, result.Roles, result.Warnings, perms}
+		if err := enc.Encode(out); err != nil {
+			return fmt.Errorf("encoding permissions: %w", err)
+		}
+	} else {
+		printPolicyTest(result, perms)
+	}
+
+	if failOnWarning && len(result.Warnings) > 0 {
+		return errPolicyTestWarnings
+	}
+	return nil
+}
+
+// printPolicyTest writes the compiled permissions to stdout, one subject per line.
+func printPolicyTest(result *auth.NautsCompilationResult, perms natsjwt.Permissions) {
+	fmt.Printf("user %s in account %s, roles %v\n", result.User.ID, result.User.Account, result.Roles)
+	for _, w := range result.Warnings {
+		fmt.Printf("warning: %s\n", w)
+	}
+	for _, list := range []struct {
+		name     string
+		subjects []string
+	}{
+		{"pub allow", perms.Pub.Allow},
+		{"pub deny", perms.Pub.Deny},
+		{"sub allow", perms.Sub.Allow},
+		{"sub deny", perms.Sub.Deny},
+	} {
+		for _, subject := range list.subjects {
+			fmt.Printf("%-9s  %s\n", list.name, subject)
+		}
+	}
+	if resp := perms.Resp; resp != nil {
+		fmt.Printf("responses  max %d, expires %s\n", resp.MaxMsgs, resp.Expires)
+	}
+}
+
+// runPolicyRevisions handles 'policy revisions', 'policy rollback', and
+// 'policy label', which work on the NATS KV store of policy.nats.
+func runPolicyRevisions(name string, args []string) error {
+	fs := flag.NewFlagSet("nauts policy "+name, flag.ExitOnError)
+
+	var configPath, policyRef, bindingRef, label, format string
+	var revision uint64
+
+	fs.StringVar(&configPath, "c", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&configPath, "config", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	if name != "label" {
+		fs.StringVar(&policyRef, "policy", "", "Policy as <account>.<id> (_global.<id> for global policies)")
+		fs.StringVar(&bindingRef, "binding", "", "Binding as <account>.<role>, instead of --policy")
+	} else {
+		fs.StringVar(&label, "name", "", "Label to set; without it, the labels are listed")
+	}
+	if name != "revisions" {
+		fs.Uint64Var(&revision, "revision", 0, "Bucket revision (rollback: required; label: default current)")
+	}
+	fs.StringVar(&format, "format", "text", "Output format (text or json)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s policy %s [options]\n\n", os.Args[0], name)
+		switch name {
+		case "revisions":
+			fmt.Fprintf(os.Stderr, "List the revisions of a policy or binding that the NATS KV bucket keeps (see\n")
+			fmt.Fprintf(os.Stderr, "'kv bootstrap --history'), oldest first.\n\n")
+		case "rollback":
+			fmt.Fprintf(os.Stderr, "Write a policy or binding again as it was at --revision, or delete it if that\n")
+			fmt.Fprintf(os.Stderr, "revision deleted it. Running nauts instances pick up the change like any other write.\n\n")
+		case "label":
+			fmt.Fprintf(os.Stderr, "Name a revision of the whole bucket. Setting policy.nats.revision to the label pins\n")
+			fmt.Fprintf(os.Stderr, "nauts to the policies and bindings of that revision, read-only, until it is changed.\n\n")
+		}
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if configPath == "" {
+		return fmt.Errorf("-c/--config is required")
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unsupported format %q (expected text or json)", format)
+	}
+	if name == "rollback" && revision == 0 {
+		return fmt.Errorf("--revision is required")
+	}
+	// ref holds the account and policy ID or role name.
+	var ref identity.Role
+	if name != "label" {
+		if (policyRef == "") == (bindingRef == "") {
+			return fmt.Errorf("exactly one of --policy and --binding is required")
+		}
+		var err error
+		if ref, err = identity.ParseRoleID(policyRef + bindingRef); err != nil {
+			return fmt.Errorf("invalid --policy or --binding: %w", err)
+		}
+	}
+
+	config, err := auth.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	if config.Policy.Nats == nil {
+		return fmt.Errorf("policy.nats is not configured")
+	}
+	// Revisions are managed on the live bucket, not on a pinned view of it.
+	natsConfig := *config.Policy.Nats
+	natsConfig.Revision = ""
+	store, err := provider.NewNatsPolicyProvider(natsConfig)
+	if err != nil {
+		return err
+	}
+	defer store.Stop()
+
+	ctx := context.Background()
+	var result any
+	switch {
+	case name == "label" && label == "":
+		labels, err := store.RevisionLabels(ctx)
+		if err != nil {
+			return err
+		}
+		result = labels
+		if format == "text" {
+			for _, l := range labels {
+				fmt.Printf("%-20s %8d  %s\n", l.Name, l.Revision, l.Created.Format(time.RFC3339))
+			}
+		}
+	case name == "label":
+		labeled, err := store.SetRevisionLabel(ctx, label, revision)
+		if err != nil {
+			return err
+		}
+		result = provider.RevisionLabel{Name: label, Revision: labeled}
+		if format == "text" {
+			fmt.Printf("labeled revision %d as %s\n", labeled, label)
+		}
+	case name == "rollback":
+		if policyRef != "" {
+			err = store.RollbackPolicy(ctx, ref.Account, ref.Name, revision)
+		} else {
+			err = store.RollbackBinding(ctx, ref, revision)
+		}
+		if err != nil {
+			return err
+		}
+		result = map[string]any{"rolledBack": policyRef + bindingRef, "revision": revision}
+		if format == "text" {
+			fmt.Printf("rolled back %s to revision %d\n", policyRef+bindingRef, revision)
+		}
+	default:
+		var revisions []provider.PolicyRevision
+		if policyRef != "" {
+			revisions, err = store.ListPolicyRevisions(ctx, ref.Account, ref.Name)
+		} else {
+			revisions, err = store.ListBindingRevisions(ctx, ref)
+		}
+		if err != nil {
+			return err
+		}
+		result = revisions
+		if format == "text" {
+			printPolicyRevisions(revisions)
+		}
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			return fmt.Errorf("encoding result: %w", err)
+		}
+	}
+	return nil
+}
+
+// printPolicyRevisions writes one line per revision to stdout.
+func printPolicyRevisions(revisions []provider.PolicyRevision) {
+	for _, r := range revisions {
+		summary := "deleted"
+		switch {
+		case r.Policy != nil:
+			summary = fmt.Sprintf("%q, %d statements", r.Policy.Name, len(r.Policy.Statements))
+		case r.Binding != nil:
+			summary = "policies " + strings.Join(r.Binding.Policies, ",")
+		}
+		fmt.Printf("%8d  %s  %s\n", r.Revision, r.Created.Format(time.RFC3339), summary)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/msimon/nauts/auth"
+	"github.com/msimon/nauts/provider"
+)
+
+// runReconcile handles the 'reconcile' command.
+func runReconcile(args []string) error {
+	fs := flag.NewFlagSet("nauts reconcile", flag.ExitOnError)
+
+	var configPath, source, target, statusFile string
+	var interval time.Duration
+	var once, dryRun, prune bool
+
+	fs.StringVar(&configPath, "c", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&configPath, "config", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&source, "source", "file", "Source of truth policy provider type (file, nats, sql, consul or canary)")
+	fs.StringVar(&target, "target", "nats", "Policy provider type to keep in sync (file, nats, sql, consul or canary)")
+	fs.DurationVar(&interval, "interval", 30*time.Second, "Time between reconciliation runs")
+	fs.BoolVar(&once, "once", false, "Run a single reconciliation and exit")
+	fs.BoolVar(&dryRun, "dry-run", false, "Report drift without writing to the target")
+	fs.BoolVar(&prune, "prune", true, "Delete policies and bindings that exist only in the target")
+	fs.StringVar(&statusFile, "status-file", "", "Write the reconciler status as JSON to this file after every run")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s reconcile [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Continuously sync the source policy provider into the target, correcting drift.\n")
+		fmt.Fprintf(os.Stderr, "The source is reloaded on every run, so file changes (e.g., a git checkout) are picked up.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if configPath == "" {
+		return fmt.Errorf("-c/--config is required")
+	}
+	if source == target {
+		return fmt.Errorf("--source and --target must differ")
+	}
+	if interval <= 0 {
+		return fmt.Errorf("--interval must be positive")
+	}
+
+	config, err := auth.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	targetStore, err := auth.NewPolicyStoreOfType(config, target)
+	if err != nil {
+		return fmt.Errorf("opening target: %w", err)
+	}
+	defer auth.StopPolicyStore(targetStore)
+
+	reconciler, err := provider.NewReconciler(provider.ReconcilerConfig{
+		OpenSource: func() (provider.PolicyStore, error) {
+			return auth.NewPolicyStoreOfType(config, source)
+		},
+		Target:   targetStore,
+		Interval: interval,
+		Options: provider.ReconcileOptions{
+			DryRun: dryRun,
+			Prune:  prune,
+		},
+		OnStatus: func(s provider.ReconcileStatus) {
+			reportReconcileStatus(s)
+			if statusFile != "" {
+				if err := writeStatusFile(statusFile, s); err != nil {
+					log.Printf("reconcile: writing status file: %v", err)
+				}
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := setupSignalHandler(nil)
+	defer cancel()
+
+	if once {
+		result, err := reconciler.RunOnce(ctx)
+		if err != nil {
+			return err
+		}
+		prefix := ""
+		if dryRun {
+			prefix = "(dry-run) "
+		}
+		for _, e := range result.Diff.Entries {
+			fmt.Printf("%s%s\n", prefix, e.String())
+		}
+		return nil
+	}
+
+	log.Printf("reconcile: syncing %s -> %s every %s", source, target, interval)
+	return reconciler.Run(ctx)
+}
+
+// reportReconcileStatus logs the outcome of a reconciliation run.
+func reportReconcileStatus(s provider.ReconcileStatus) {
+	switch {
+	case s.LastError != "":
+		log.Printf("reconcile: run %d failed: %s", s.Runs, s.LastError)
+	case s.Drift == 0:
+		log.Printf("reconcile: run %d: in sync", s.Runs)
+	case s.DryRun:
+		log.Printf("reconcile: run %d: %d difference(s) found (dry-run)", s.Runs, s.Drift)
+	default:
+		log.Printf("reconcile: run %d: %d difference(s) found, %d change(s) applied", s.Runs, s.Drift, s.Applied)
+	}
+}
+
+// writeStatusFile atomically writes the status as indented JSON.
+func writeStatusFile(path string, s provider.ReconcileStatus) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".nauts-status-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/msimon/nauts/release"
+)
+
+// Set with -ldflags by 'release build':
+//
+//	-X main.version=v1.2.0 -X main.releasePublicKey=<base64 Ed25519 key>
+var (
+	version          = "dev"
+	releasePublicKey = ""
+)
+
+// runVersion handles the 'version' subcommand.
+func runVersion(_ []string) error {
+	fmt.Printf("nauts %s %s/%s\n", version, runtime.GOOS, runtime.GOARCH)
+	return nil
+}
+
+// runRelease handles the 'release' subcommand group.
+func runRelease(args []string) error {
+	if len(args) == 0 {
+		printReleaseUsage()
+		return fmt.Errorf("release: subcommand is required")
+	}
+
+	switch args[0] {
+	case "keygen":
+		return runReleaseKeygen(args[1:])
+	case "build":
+		return runReleaseBuild(args[1:])
+	case "-h", "-help", "--help", "help":
+		printReleaseUsage()
+		return nil
+	default:
+		printReleaseUsage()
+		return fmt.Errorf("release: unknown subcommand %q", args[0])
+	}
+}
+
+func printReleaseUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: %s release <subcommand> [options]
+
+Subcommands:
+  keygen   Create the Ed25519 key pair that signs releases
+  build    Cross-compile signed release binaries from a source checkout
+`, os.Args[0])
+}
+
+// runReleaseKeygen handles 'release keygen'.
+func runReleaseKeygen(args []string) error {
+	fs := flag.NewFlagSet("nauts release keygen", flag.ExitOnError)
+
+	var out string
+
+	fs.StringVar(&out, "out", "release.key", "Path to write the private signing key to")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s release keygen [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Create a release signing key. The private key is written to --out (mode 0600) and must\n")
+		fmt.Fprintf(os.Stderr, "be kept secret; the public key is printed and embedded by 'release build'.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	pub, priv, err := release.GenerateKey()
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("writing signing key: %w", err)
+	}
+	if _, err := fmt.Fprintln(f, priv); err != nil {
+		f.Close()
+		return fmt.Errorf("writing signing key: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing signing key: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Private key written to %s\n", out)
+	fmt.Println(pub)
+	return nil
+}
+
+// runReleaseBuild handles 'release build'.
+func runReleaseBuild(args []string) error {
+	fs := flag.NewFlagSet("nauts release build", flag.ExitOnError)
+
+	var ver, keyPath, outDir, platforms string
+
+	fs.StringVar(&ver, "version", "", "Release version, e.g. v1.2.0")
+	fs.StringVar(&keyPath, "signing-key", envOrDefault("NAUTS_RELEASE_KEY", ""), "Path to the private key from 'release keygen'")
+	fs.StringVar(&outDir, "out", "dist", "Output directory")
+	fs.StringVar(&platforms, "platforms", strings.Join(release.DefaultPlatforms, ","), "Comma-separated GOOS/GOARCH pairs")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s release build [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Cross-compile nauts for each platform from the current source checkout (requires the go\n")
+		fmt.Fprintf(os.Stderr, "tool) and write the binaries, %s, and its signature %s to --out.\n", release.ChecksumsFile, release.SignatureFile)
+		fmt.Fprintf(os.Stderr, "The binaries embed the version and the public key, so 'self-update' can verify later releases.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if ver == "" {
+		return fmt.Errorf("--version is required")
+	}
+	if keyPath == "" {
+		return fmt.Errorf("--signing-key is required")
+	}
+
+	key, err := release.LoadPrivateKey(keyPath)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	files, err := release.Build(ctx, release.BuildOptions{
+		Version:    ver,
+		OutDir:     outDir,
+		Platforms:  strings.Split(platforms, ","),
+		SigningKey: key,
+	})
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		fmt.Println(f)
+	}
+	return nil
+}
+
+// runSelfUpdate handles the 'self-update' subcommand.
+func runSelfUpdate(args []string) error {
+	fs := flag.NewFlagSet("nauts self-update", flag.ExitOnError)
+
+	var check bool
+	var target, url string
+
+	fs.BoolVar(&check, "check", false, "Only report whether an update is available")
+	fs.StringVar(&target, "version", "", "Install this release instead of the latest one (also allows downgrades)")
+	fs.StringVar(&url, "url", envOrDefault("NAUTS_RELEASE_URL", release.DefaultURL), "GitHub-compatible releases API of the repository")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s self-update [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Replace this binary with the release binary for %s/%s. The release checksums must be\n", runtime.GOOS, runtime.GOARCH)
+		fmt.Fprintf(os.Stderr, "signed with the key embedded in this build, and the binary must match its checksum.\n")
+		fmt.Fprintf(os.Stderr, "A running service keeps the old binary until it is restarted.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	client := &release.Client{BaseURL: url}
+	var rel *release.Release
+	var err error
+	if target != "" {
+		rel, err = client.Get(ctx, target)
+	} else {
+		rel, err = client.Latest(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	if target == "" && !release.IsNewer(rel.Version, version) {
+		fmt.Printf("nauts %s is up to date (latest release: %s)\n", version, rel.Version)
+		return nil
+	}
+	if check {
+		fmt.Printf("update available: %s -> %s\n", version, rel.Version)
+		return nil
+	}
+
+	if releasePublicKey == "" {
+		return fmt.Errorf("%w; install a release binary or build with 'nauts release build'", release.ErrNoPublicKey)
+	}
+	data, err := client.Download(ctx, rel, runtime.GOOS, runtime.GOARCH, releasePublicKey)
+	if err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		return fmt.Errorf("locating executable: %w", err)
+	}
+	if err := release.ReplaceExecutable(exe, data); err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return fmt.Errorf("%w (run with permission to write %s)", err, exe)
+		}
+		return err
+	}
+	fmt.Printf("updated nauts %s -> %s (%s); restart running services to use it\n", version, rel.Version, exe)
+	return nil
+}
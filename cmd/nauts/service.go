@@ -0,0 +1,31 @@
+package main
+
+import "context"
+
+// serviceManager reports the lifecycle of serve mode to a process manager
+// (systemd, the Windows service control manager), so that it tracks the
+// actual state of nauts instead of assuming readiness at exec time.
+type serviceManager interface {
+	// Ready is called once the callout service accepts auth requests, and
+	// again after each reload.
+	Ready()
+	// Reloading is called when a configuration reload begins.
+	Reloading()
+	// Stopping is called when shutdown begins.
+	Stopping()
+	// Watchdog feeds the process manager's watchdog while healthy reports
+	// true, until ctx is done.
+	Watchdog(ctx context.Context, healthy func() bool)
+	// StopRequested is closed when the process manager asks nauts to stop.
+	StopRequested() <-chan struct{}
+}
+
+// noServiceManager is used when nauts is not run by a process manager
+// that expects notifications.
+type noServiceManager struct{}
+
+func (noServiceManager) Ready()                                {}
+func (noServiceManager) Reloading()                            {}
+func (noServiceManager) Stopping()                             {}
+func (noServiceManager) Watchdog(context.Context, func() bool) {}
+func (noServiceManager) StopRequested() <-chan struct{}        { return nil }
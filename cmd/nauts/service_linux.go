@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// runPlatformService reports whether serve mode was run as a platform
+// service; on Linux, systemd is supported through newServiceManager.
+func runPlatformService([]string) (bool, error) {
+	return false, nil
+}
+
+// newServiceManager returns a systemd notifier if the unit is of
+// Type=notify (or notify-reload), which sets $NOTIFY_SOCKET.
+func newServiceManager() serviceManager {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return noServiceManager{}
+	}
+	return &systemdManager{socket: socket, watchdogInterval: systemdWatchdogInterval()}
+}
+
+// systemdWatchdogInterval returns the interval to feed the watchdog at, half
+// of WatchdogSec, or 0 if the watchdog is disabled or meant for another process.
+func systemdWatchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// systemdManager implements the sd_notify protocol: newline-separated
+// assignments sent as a datagram to $NOTIFY_SOCKET.
+type systemdManager struct {
+	socket           string
+	watchdogInterval time.Duration
+}
+
+func (m *systemdManager) Ready() {
+	m.notify("READY=1\nSTATUS=Handling auth callout requests")
+}
+
+// Reloading tells systemd that a reload started; Type=notify-reload units
+// require the monotonic timestamp.
+func (m *systemdManager) Reloading() {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		m.notify("RELOADING=1")
+		return
+	}
+	m.notify(fmt.Sprintf("RELOADING=1\nMONOTONIC_USEC=%d", ts.Nano()/1000))
+}
+
+func (m *systemdManager) Stopping() {
+	m.notify("STOPPING=1")
+}
+
+// Watchdog feeds the watchdog while the callout service is healthy, so that
+// systemd restarts nauts if it loses its NATS connection for good.
+func (m *systemdManager) Watchdog(ctx context.Context, healthy func() bool) {
+	if m.watchdogInterval == 0 {
+		return
+	}
+	ticker := time.NewTicker(m.watchdogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if healthy() {
+				m.notify("WATCHDOG=1")
+			}
+		}
+	}
+}
+
+// StopRequested returns nil: systemd stops nauts with SIGTERM.
+func (m *systemdManager) StopRequested() <-chan struct{} {
+	return nil
+}
+
+func (m *systemdManager) notify(state string) {
+	addr := &net.UnixAddr{Name: m.socket, Net: "unixgram"}
+	// A leading @ denotes a socket in the abstract namespace.
+	if addr.Name[0] == '@' {
+		addr.Name = "\x00" + addr.Name[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err == nil {
+		_, err = conn.Write([]byte(state))
+		conn.Close()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Notifying systemd: %v\n", err)
+	}
+}
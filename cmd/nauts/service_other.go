@@ -0,0 +1,14 @@
+//go:build !linux && !windows
+
+package main
+
+// runPlatformService reports whether serve mode was run as a platform
+// service, which is not supported on this platform.
+func runPlatformService([]string) (bool, error) {
+	return false, nil
+}
+
+// newServiceManager returns a manager that ignores lifecycle changes.
+func newServiceManager() serviceManager {
+	return noServiceManager{}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// windowsServiceName is passed to the service control manager; it is
+// ignored for services running in their own process.
+const windowsServiceName = "nauts"
+
+// runPlatformService runs serve mode under the Windows service control
+// manager if nauts was started as a service. It reports false if nauts was
+// started from a console.
+func runPlatformService(args []string) (bool, error) {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return true, fmt.Errorf("detecting Windows service: %w", err)
+	}
+	if !isService {
+		return false, nil
+	}
+	return true, svc.Run(windowsServiceName, &windowsService{args: args})
+}
+
+// newServiceManager returns a manager that ignores lifecycle changes; a
+// console process has no service control manager to report to.
+func newServiceManager() serviceManager {
+	return noServiceManager{}
+}
+
+// windowsService runs serve mode as a Windows service: it stays in
+// StartPending until the callout service is subscribed, and stops on a
+// stop or shutdown request.
+type windowsService struct {
+	args []string
+}
+
+func (w *windowsService) Execute(_ []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	m := &windowsServiceManager{changes: changes, stop: make(chan struct{})}
+	changes <- svc.Status{State: svc.StartPending}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- runServe(w.args, m)
+	}()
+
+	for {
+		select {
+		case err := <-errCh:
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				return true, 1
+			}
+			return false, 0
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				changes <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				m.requestStop()
+			}
+		}
+	}
+}
+
+// windowsServiceManager reports the serve lifecycle to the service control
+// manager.
+type windowsServiceManager struct {
+	changes  chan<- svc.Status
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func (m *windowsServiceManager) Ready() {
+	m.changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+}
+
+// Reloading does nothing: Windows services cannot be sent SIGHUP.
+func (m *windowsServiceManager) Reloading() {}
+
+func (m *windowsServiceManager) Stopping() {
+	m.changes <- svc.Status{State: svc.StopPending}
+}
+
+// Watchdog does nothing: the service control manager has no watchdog;
+// recovery actions apply when the process exits.
+func (m *windowsServiceManager) Watchdog(context.Context, func() bool) {}
+
+func (m *windowsServiceManager) StopRequested() <-chan struct{} {
+	return m.stop
+}
+
+func (m *windowsServiceManager) requestStop() {
+	m.stopOnce.Do(func() { close(m.stop) })
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/msimon/nauts/auth"
+)
+
+// runSupportBundle handles the 'support-bundle' subcommand.
+func runSupportBundle(args []string) error {
+	fs := flag.NewFlagSet("nauts support-bundle", flag.ExitOnError)
+
+	var configPath, output, logs, journalUnit string
+	var logLines int
+
+	fs.StringVar(&configPath, "c", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&configPath, "config", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&output, "o", "", "Output file (default: nauts-support-<timestamp>.tar.gz)")
+	fs.StringVar(&output, "output", "", "Output file (default: nauts-support-<timestamp>.tar.gz)")
+	fs.StringVar(&logs, "log", "", "Comma-separated log files to include")
+	fs.StringVar(&journalUnit, "journal-unit", "", "Include the journal of this systemd unit (e.g. nauts)")
+	fs.IntVar(&logLines, "log-lines", auth.DefaultSupportBundleLogLines, "Number of lines to keep from the end of each log")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s support-bundle [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Collect what a bug report needs into a tarball: version info, the configuration with\n")
+		fmt.Fprintf(os.Stderr, "secrets redacted, provider status and policy findings, a metrics snapshot of the running\n")
+		fmt.Fprintf(os.Stderr, "instance (if server.http is configured), and the end of its logs. JWTs, nkey seeds, and\n")
+		fmt.Fprintf(os.Stderr, "URL credentials are redacted; review the bundle before sharing it.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if configPath == "" {
+		return fmt.Errorf("-c/--config is required")
+	}
+	if logLines <= 0 {
+		return fmt.Errorf("--log-lines must be positive")
+	}
+
+	now := time.Now()
+	if output == "" {
+		output = "nauts-support-" + now.UTC().Format("20060102-150405") + ".tar.gz"
+	}
+
+	opts := auth.SupportBundleOptions{
+		ConfigPath: configPath,
+		Version:    version,
+		LogLines:   logLines,
+		Now:        func() time.Time { return now },
+	}
+	if logs != "" {
+		for _, path := range strings.Split(logs, ",") {
+			opts.LogFiles = append(opts.LogFiles, strings.TrimSpace(path))
+		}
+	}
+	if journalUnit != "" {
+		out, err := exec.Command("journalctl", "--unit", journalUnit, "--lines", strconv.Itoa(logLines), "--no-pager").Output()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: journal of %s not included: %v\n", journalUnit, err)
+		} else {
+			opts.Logs = append(opts.Logs, auth.SupportBundleLog{Name: "journal-" + journalUnit + ".log", Data: out})
+		}
+	}
+
+	f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("creating support bundle: %w", err)
+	}
+	manifest, err := auth.WriteSupportBundle(context.Background(), f, opts)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(output)
+		return fmt.Errorf("writing support bundle: %w", err)
+	}
+
+	for _, section := range manifest.SortedErrors() {
+		fmt.Fprintf(os.Stderr, "WARNING: %s not included: %s\n", section, manifest.Errors[section])
+	}
+	fmt.Fprintf(os.Stderr, "Support bundle written to %s (%d files)\n", output, len(manifest.Files))
+	return nil
+}
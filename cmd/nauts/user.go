@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/msimon/nauts/auth"
+	"github.com/msimon/nauts/identity"
+)
+
+// runUser handles the 'user' subcommand group.
+func runUser(args []string) error {
+	if len(args) == 0 {
+		printUserUsage()
+		return fmt.Errorf("user: subcommand is required")
+	}
+
+	switch args[0] {
+	case "add", "remove", "set-password", "list":
+		return runUserCommand(args[0], args[1:])
+	case "-h", "-help", "--help", "help":
+		printUserUsage()
+		return nil
+	default:
+		printUserUsage()
+		return fmt.Errorf("user: unknown subcommand %q", args[0])
+	}
+}
+
+func printUserUsage() {
+	fmt.Fprintf(os.Stderr, `Usage: %s user <subcommand> [options]
+
+Subcommands:
+  add            Add a user with a password
+  remove         Remove a user
+  set-password   Replace the password of a user
+  list           List the users and the algorithm of their password hash
+
+Manage the users file of a file authentication provider (auth.file). Passwords
+are hashed as configured by the provider's passwordHashing (bcrypt by default).
+A running nauts picks up changes when it is reloaded.
+`, os.Args[0])
+}
+
+// runUserCommand handles 'user add', 'user remove', 'user set-password' and
+// 'user list'.
+func runUserCommand(name string, args []string) error {
+	fs := flag.NewFlagSet("nauts user "+name, flag.ExitOnError)
+
+	var configPath, providerID, algorithm, format, accounts, roles, groups string
+	var cost int
+	var generate bool
+	attrs := attrFlag{}
+
+	fs.StringVar(&configPath, "c", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&configPath, "config", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&providerID, "provider", "", "ID of the file authentication provider (required if there are several)")
+	switch name {
+	case "add":
+		fs.StringVar(&accounts, "accounts", "", "Comma-separated accounts the user may connect to")
+		fs.StringVar(&roles, "roles", "", "Comma-separated roles of the user (<account>.<role>)")
+		fs.StringVar(&groups, "groups", "", "Comma-separated groups, mapped by roleMapping (optional)")
+		fs.Var(attrs, "attr", "User attribute as key=value (repeatable)")
+	case "list":
+		fs.StringVar(&format, "format", "text", "Output format (text or json)")
+	}
+	if name == "add" || name == "set-password" {
+		fs.StringVar(&algorithm, "algorithm", "", "Hash algorithm (bcrypt or argon2id; default: the provider's passwordHashing)")
+		fs.IntVar(&cost, "cost", 0, "Hash cost (default: the provider's passwordHashing)")
+		fs.BoolVar(&generate, "generate", false, "Generate a random password and print it instead of reading one")
+	}
+
+	fs.Usage = func() {
+		switch name {
+		case "list":
+			fmt.Fprintf(os.Stderr, "Usage: %s user list [options]\n\n", os.Args[0])
+			fmt.Fprintf(os.Stderr, "List the users of a file authentication provider.\n\n")
+		case "remove":
+			fmt.Fprintf(os.Stderr, "Usage: %s user remove [options] <username>\n\n", os.Args[0])
+			fmt.Fprintf(os.Stderr, "Remove a user from a file authentication provider.\n\n")
+		default:
+			fmt.Fprintf(os.Stderr, "Usage: %s user %s [options] <username>\n\n", os.Args[0], name)
+			if name == "add" {
+				fmt.Fprintf(os.Stderr, "Add a user to a file authentication provider.\n")
+			} else {
+				fmt.Fprintf(os.Stderr, "Replace the password of a user of a file authentication provider.\n")
+			}
+			fmt.Fprintf(os.Stderr, "The password is read from the first line of stdin (prompted for on a terminal,\n")
+			fmt.Fprintf(os.Stderr, "where it is echoed) unless --generate is given.\n\n")
+		}
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if configPath == "" {
+		return fmt.Errorf("-c/--config is required")
+	}
+	var username string
+	if name != "list" {
+		if fs.NArg() != 1 {
+			fs.Usage()
+			return fmt.Errorf("exactly one username is required")
+		}
+		username = fs.Arg(0)
+	} else if format != "text" && format != "json" {
+		return fmt.Errorf("unsupported format %q (expected text or json)", format)
+	}
+
+	config, err := auth.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	fc, err := fileAuthProvider(config, providerID)
+	if err != nil {
+		return err
+	}
+	var hashing identity.PasswordHashingConfig
+	if fc.PasswordHashing != nil {
+		hashing = *fc.PasswordHashing
+	}
+	if algorithm != "" {
+		// The provider's cost applies to its own algorithm only.
+		if algorithm != hashing.Algorithm {
+			hashing.Cost = 0
+		}
+		hashing.Algorithm = algorithm
+	}
+	if cost != 0 {
+		hashing.Cost = cost
+	}
+	store, err := identity.NewFileUserStore(fc.UsersPath, hashing)
+	if err != nil {
+		return fmt.Errorf("file authentication provider %q: %w", fc.ID, err)
+	}
+
+	switch name {
+	case "list":
+		users, err := store.List()
+		if err != nil {
+			return err
+		}
+		if format == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(users)
+		}
+		printFileUsers(users)
+		return nil
+	case "remove":
+		if err := store.Remove(username); err != nil {
+			return err
+		}
+		fmt.Printf("removed user %s from %s\n", username, fc.UsersPath)
+		return nil
+	}
+
+	password, err := userPassword(generate)
+	if err != nil {
+		return err
+	}
+	if name == "add" {
+		user := identity.FileUser{
+			Username: username,
+			Accounts: splitList(accounts),
+			Roles:    splitList(roles),
+			Groups:   splitList(groups),
+		}
+		if len(attrs) > 0 {
+			user.Attributes = attrs
+		}
+		err = store.Add(user, password)
+	} else {
+		err = store.SetPassword(username, password)
+	}
+	if err != nil {
+		return err
+	}
+	if generate {
+		fmt.Println(password)
+	}
+	verb := "added user"
+	if name == "set-password" {
+		verb = "set password of user"
+	}
+	fmt.Fprintf(os.Stderr, "%s %s in %s\n", verb, username, fc.UsersPath)
+	return nil
+}
+
+// fileAuthProvider returns the file authentication provider with id, or the
+// only one if id is empty.
+func fileAuthProvider(config *auth.Config, id string) (*auth.FileAuthProviderConfig, error) {
+	providers := config.Auth.File
+	if id == "" {
+		switch len(providers) {
+		case 0:
+			return nil, errors.New("the configuration has no file authentication provider (auth.file)")
+		case 1:
+			return &providers[0], nil
+		}
+		ids := make([]string, 0, len(providers))
+		for _, p := range providers {
+			ids = append(ids, p.ID)
+		}
+		return nil, fmt.Errorf("--provider is required: choose one of %s", strings.Join(ids, ", "))
+	}
+	for i := range providers {
+		if providers[i].ID == id {
+			return &providers[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no file authentication provider %q", id)
+}
+
+// userPassword generates a password or reads it from the first line of stdin.
+func userPassword(generate bool) (string, error) {
+	if generate {
+		b := make([]byte, 18)
+		if _, err := rand.Read(b); err != nil {
+			return "", fmt.Errorf("generating password: %w", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b), nil
+	}
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprint(os.Stderr, "Password: ")
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("reading password: %w", err)
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("password must not be empty")
+	}
+	return password, nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// printFileUsers writes users as a table to stdout.
+func printFileUsers(users []identity.FileUser) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "USERNAME\tACCOUNTS\tROLES\tGROUPS\tHASH")
+	for _, u := range users {
+		algorithm := u.Algorithm
+		if algorithm == "" {
+			algorithm = "unsupported"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", u.Username, strings.Join(u.Accounts, ","), strings.Join(u.Roles, ","),
+			strings.Join(u.Groups, ","), algorithm)
+	}
+	w.Flush()
+}
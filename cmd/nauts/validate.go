@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/msimon/nauts/auth"
+)
+
+// errValidationFailed is returned by 'validate' when an error was found.
+var errValidationFailed = errors.New("validation found errors")
+
+// runValidate handles the 'validate' subcommand.
+func runValidate(args []string) error {
+	fs := flag.NewFlagSet("nauts validate", flag.ExitOnError)
+
+	var configPath, format string
+
+	fs.StringVar(&configPath, "c", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&configPath, "config", envOrDefault("NAUTS_CONFIG", ""), "Path to configuration file")
+	fs.StringVar(&format, "format", "json", "Output format (json or text)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s validate [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Check a configuration, its providers, and every policy and binding without serving\n")
+		fmt.Fprintf(os.Stderr, "requests: invalid or duplicate entries, resource syntax, unknown template variables,\n")
+		fmt.Fprintf(os.Stderr, "and bindings referencing missing policies. Nothing is written; a NATS KV or SQL policy\n")
+		fmt.Fprintf(os.Stderr, "provider is read. Exits with status 1 if an error was found.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if configPath == "" {
+		return fmt.Errorf("-c/--config is required")
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unsupported format %q (expected json or text)", format)
+	}
+
+	report := auth.ValidateConfigFile(context.Background(), configPath)
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return fmt.Errorf("encoding report: %w", err)
+		}
+	} else {
+		printValidationReport(report)
+	}
+
+	if !report.Valid {
+		return errValidationFailed
+	}
+	return nil
+}
+
+// printValidationReport writes a human-readable report to stdout.
+func printValidationReport(report *auth.ValidationReport) {
+	for _, f := range report.Findings {
+		if f.Account == "" {
+			fmt.Printf("%s %s %s: %s (%s)\n", f.Level, f.Type, f.Name, f.Message, f.Rule)
+			continue
+		}
+		fmt.Println(f.String())
+	}
+	status := "valid"
+	if !report.Valid {
+		status = "invalid"
+	}
+	fmt.Printf("%s: %s (%d policies, %d bindings, %d finding(s))\n", report.Config, status, report.Policies, report.Bindings, len(report.Findings))
+}
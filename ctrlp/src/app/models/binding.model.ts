@@ -2,6 +2,7 @@ export interface Binding {
   role: string;
   account: string;
   policies: string[];
+  expiresAt?: string;
 }
 
 export interface BindingEntry {
@@ -1,5 +1,5 @@
 export interface Statement {
-  effect: 'allow';
+  effect: 'allow' | 'deny';
   actions: string[];
   resources: string[];
 }
@@ -19,6 +19,7 @@ const VALID_ACTIONS = [
   'nats.pub', 'nats.sub', 'nats.service', 'nats.*',
   'js.manage', 'js.view', 'js.consume', 'js.*',
   'kv.read', 'kv.edit', 'kv.view', 'kv.manage', 'kv.*',
+  'obj.read', 'obj.write', 'obj.view', 'obj.manage', 'obj.*',
 ];
 
 export interface PolicyDialogData {
@@ -31,8 +31,8 @@ export function validateStatement(stmt: Partial<Statement>, index: number): Vali
   const errors: ValidationError[] = [];
   const prefix = `statements.${index}`;
 
-  if (stmt.effect !== 'allow') {
-    errors.push({ field: `${prefix}.effect`, message: 'Effect must be "allow"' });
+  if (stmt.effect !== 'allow' && stmt.effect !== 'deny') {
+    errors.push({ field: `${prefix}.effect`, message: 'Effect must be "allow" or "deny"' });
   }
 
   if (!stmt.actions || stmt.actions.length === 0) {
@@ -31,7 +31,7 @@ export function validateResource(resource: string): string | null {
   const { type, identifier, subIdentifier } = parsed;
 
   // Validate type
-  if (!['nats', 'js', 'kv'].includes(type)) {
+  if (!['nats', 'js', 'kv', 'obj'].includes(type)) {
     return `Unknown resource type: ${type}`;
   }
 
@@ -52,6 +52,8 @@ export function validateResource(resource: string): string | null {
       return validateJSResource(identifier, subIdentifier);
     case 'kv':
       return validateKVResource(identifier, subIdentifier);
+    case 'obj':
+      return validateObjResource(identifier, subIdentifier);
     default:
       return `Unknown resource type: ${type}`;
   }
@@ -155,6 +157,29 @@ function validateKVResource(bucket: string, key?: string): string | null {
   return null;
 }
 
+/**
+ * Validates object store bucket/object resources.
+ * Rules:
+ * - Bucket: only * wildcard allowed (no >)
+ * - Object: a literal name, or * or > for all objects
+ */
+function validateObjResource(bucket: string, object?: string): string | null {
+  // Bucket can only have *
+  const bucketError = validateWildcards(bucket, true, false);
+  if (bucketError) {
+    return `Invalid bucket: ${bucketError}`;
+  }
+
+  // Object names are base64 encoded in subjects, so wildcards must be the
+  // entire name
+  if (object && object !== '*' && object !== '>' &&
+      !(object.includes('{{') && object.includes('}}')) && /[*>]/.test(object)) {
+    return 'Invalid object: wildcards must be the entire object name';
+  }
+
+  return null;
+}
+
 /**
  * Validates wildcards in a value.
  * @param value - The value to validate
@@ -0,0 +1,226 @@
+// Package depstats records calls to the external dependencies of nauts: AWS
+// STS, JWKS and OpenID Connect discovery endpoints, the Kubernetes API
+// server, and Vault. Every call is counted per dependency and endpoint with
+// its outcome and latency, so that a degrading dependency is visible before
+// authentications start failing.
+//
+// Calls are recorded in a process-wide registry (Default) by HTTP clients
+// wrapped with Client, and reported by Snapshot and WriteOpenMetrics.
+package depstats
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Dependency names used by nauts.
+const (
+	DependencySTS        = "sts"
+	DependencyJWKS       = "jwks"
+	DependencyKubernetes = "kubernetes"
+	DependencyVault      = "vault"
+	DependencyConsul     = "consul"
+)
+
+// DefaultLatencyBuckets are the histogram bucket upper bounds for call
+// latencies, in seconds.
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Registry records dependency calls. It is safe for concurrent use.
+type Registry struct {
+	buckets []float64
+	now     func() time.Time
+
+	mu     sync.Mutex
+	series map[seriesKey]*series
+}
+
+type seriesKey struct {
+	dependency string
+	endpoint   string
+}
+
+type series struct {
+	success     uint64
+	errors      uint64
+	sum         float64
+	buckets     []uint64 // non-cumulative; len(buckets) == len(r.buckets)+1 (last is +Inf)
+	lastSuccess time.Time
+	lastError   time.Time
+	lastMessage string
+}
+
+// Stats is a snapshot of the calls to one dependency endpoint.
+type Stats struct {
+	Dependency string `json:"dependency"`
+	Endpoint   string `json:"endpoint"`
+	Success    uint64 `json:"success"`
+	// Errors counts calls that failed to get a response or got a 5xx status.
+	Errors uint64 `json:"errors"`
+	// LatencySum is the total latency of all calls in seconds.
+	LatencySum float64         `json:"latency_sum"`
+	Latency    []LatencyBucket `json:"latency"`
+	// LastSuccess and LastError are zero if no such call was recorded.
+	LastSuccess      time.Time `json:"last_success,omitzero"`
+	LastError        time.Time `json:"last_error,omitzero"`
+	LastErrorMessage string    `json:"last_error_message,omitempty"`
+}
+
+// LatencyBucket is a cumulative histogram bucket.
+// UpperBound is 0 for the final (+Inf) bucket.
+type LatencyBucket struct {
+	UpperBound float64 `json:"le,omitempty"`
+	Count      uint64  `json:"count"`
+}
+
+// NewRegistry creates a registry with the given latency bucket upper bounds
+// in seconds. If no buckets are given, DefaultLatencyBuckets is used.
+func NewRegistry(buckets ...float64) *Registry {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &Registry{
+		buckets: sorted,
+		now:     time.Now,
+		series:  make(map[seriesKey]*series),
+	}
+}
+
+// Default is the registry used by the package-level functions and by the
+// dependency clients of nauts.
+var Default = NewRegistry()
+
+// Record records a call to endpoint of dependency that took latency. A nil
+// err is a success.
+func (r *Registry) Record(dependency, endpoint string, latency time.Duration, err error) {
+	seconds := latency.Seconds()
+	idx := sort.SearchFloat64s(r.buckets, seconds)
+	now := r.now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := seriesKey{dependency: dependency, endpoint: endpoint}
+	s, ok := r.series[key]
+	if !ok {
+		s = &series{buckets: make([]uint64, len(r.buckets)+1)}
+		r.series[key] = s
+	}
+	s.sum += seconds
+	s.buckets[idx]++
+	if err != nil {
+		s.errors++
+		s.lastError = now
+		s.lastMessage = err.Error()
+	} else {
+		s.success++
+		s.lastSuccess = now
+	}
+}
+
+// Snapshot returns the recorded calls, sorted by dependency and endpoint.
+func (r *Registry) Snapshot() []Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make([]Stats, 0, len(r.series))
+	for key, s := range r.series {
+		stats := Stats{
+			Dependency:       key.dependency,
+			Endpoint:         key.endpoint,
+			Success:          s.success,
+			Errors:           s.errors,
+			LatencySum:       s.sum,
+			Latency:          make([]LatencyBucket, len(s.buckets)),
+			LastSuccess:      s.lastSuccess,
+			LastError:        s.lastError,
+			LastErrorMessage: s.lastMessage,
+		}
+		var cumulative uint64
+		for i, n := range s.buckets {
+			cumulative += n
+			stats.Latency[i].Count = cumulative
+			if i < len(r.buckets) {
+				stats.Latency[i].UpperBound = r.buckets[i]
+			}
+		}
+		result = append(result, stats)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Dependency != result[j].Dependency {
+			return result[i].Dependency < result[j].Dependency
+		}
+		return result[i].Endpoint < result[j].Endpoint
+	})
+	return result
+}
+
+// Record records a call in the Default registry.
+func Record(dependency, endpoint string, latency time.Duration, err error) {
+	Default.Record(dependency, endpoint, latency, err)
+}
+
+// Snapshot returns the calls recorded in the Default registry.
+func Snapshot() []Stats {
+	return Default.Snapshot()
+}
+
+// Client returns a copy of c (or of a default client if c is nil) that
+// records every request to dependency in the Default registry. The endpoint
+// is the request URL without query, or endpoint if it is not empty, e.g. to
+// keep secret paths of a Vault server out of the labels.
+func Client(c *http.Client, dependency, endpoint string) *http.Client {
+	var client http.Client
+	if c != nil {
+		client = *c
+	}
+	client.Transport = &transport{
+		base:       client.Transport,
+		registry:   Default,
+		dependency: dependency,
+		endpoint:   endpoint,
+	}
+	return &client
+}
+
+// transport records round trips in a registry.
+type transport struct {
+	base       http.RoundTripper
+	registry   *Registry
+	dependency string
+	endpoint   string
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	endpoint := t.endpoint
+	if endpoint == "" {
+		endpoint = req.URL.Scheme + "://" + req.URL.Host + req.URL.Path
+	}
+
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	failure := err
+	if err == nil && resp.StatusCode >= http.StatusInternalServerError {
+		failure = &statusError{status: resp.Status}
+	}
+	t.registry.Record(t.dependency, endpoint, time.Since(start), failure)
+	return resp, err
+}
+
+// statusError records a server error response.
+type statusError struct {
+	status string
+}
+
+func (e *statusError) Error() string {
+	return "server returned " + e.status
+}
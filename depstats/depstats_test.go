@@ -0,0 +1,106 @@
+package depstats
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistry_Snapshot(t *testing.T) {
+	r := NewRegistry(0.1, 1)
+	now := time.Unix(1700000000, 0)
+	r.now = func() time.Time { return now }
+
+	r.Record(DependencyJWKS, "https://idp/keys", 50*time.Millisecond, nil)
+	r.Record(DependencyJWKS, "https://idp/keys", 2*time.Second, errors.New("timeout"))
+	r.Record(DependencySTS, "https://sts/", 500*time.Millisecond, nil)
+
+	stats := r.Snapshot()
+	if len(stats) != 2 || stats[0].Dependency != DependencyJWKS || stats[1].Dependency != DependencySTS {
+		t.Fatalf("Snapshot() = %+v, want jwks and sts", stats)
+	}
+	jwks := stats[0]
+	if jwks.Success != 1 || jwks.Errors != 1 || jwks.LastErrorMessage != "timeout" || !jwks.LastSuccess.Equal(now) || !jwks.LastError.Equal(now) {
+		t.Errorf("jwks = %+v", jwks)
+	}
+	want := []LatencyBucket{{UpperBound: 0.1, Count: 1}, {UpperBound: 1, Count: 1}, {Count: 2}}
+	for i, b := range jwks.Latency {
+		if b != want[i] {
+			t.Errorf("bucket %d = %+v, want %+v", i, b, want[i])
+		}
+	}
+	if !stats[1].LastError.IsZero() {
+		t.Errorf("sts LastError = %v, want zero", stats[1].LastError)
+	}
+}
+
+func TestClient(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	find := func(dependency, endpoint string) Stats {
+		for _, s := range Snapshot() {
+			if s.Dependency == dependency && s.Endpoint == endpoint {
+				return s
+			}
+		}
+		return Stats{}
+	}
+
+	client := Client(nil, "test", "")
+	for _, code := range []int{http.StatusOK, http.StatusNotFound, http.StatusBadGateway} {
+		status = code
+		resp, err := client.Get(server.URL + "/keys?refresh=1")
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		resp.Body.Close()
+	}
+	// Only server errors count as failures; the query is not part of the endpoint.
+	s := find("test", server.URL+"/keys")
+	if s.Success != 2 || s.Errors != 1 || s.LastErrorMessage != "server returned 502 Bad Gateway" {
+		t.Errorf("stats = %+v, want 2 successes and 1 error", s)
+	}
+
+	client = Client(&http.Client{Timeout: time.Second}, "test-fixed", "vault")
+	server.Close()
+	if _, err := client.Get(server.URL + "/v1/secret"); err == nil {
+		t.Fatal("Get() on closed server succeeded")
+	}
+	if s := find("test-fixed", "vault"); s.Errors != 1 {
+		t.Errorf("stats = %+v, want 1 error for the fixed endpoint", s)
+	}
+}
+
+func TestWriteOpenMetrics(t *testing.T) {
+	r := NewRegistry(0.5)
+	r.now = func() time.Time { return time.Unix(1700000000, 0) }
+	r.Record(DependencyVault, `https://vault"1`, 100*time.Millisecond, nil)
+
+	var b strings.Builder
+	if err := WriteOpenMetrics(&b, r.Snapshot()); err != nil {
+		t.Fatalf("WriteOpenMetrics() error = %v", err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		`nauts_dependency_requests_total{dependency="vault",endpoint="https://vault\"1",result="success"} 1`,
+		`nauts_dependency_requests_total{dependency="vault",endpoint="https://vault\"1",result="error"} 0`,
+		`nauts_dependency_request_duration_seconds_bucket{dependency="vault",endpoint="https://vault\"1",le="0.5"} 1`,
+		`nauts_dependency_request_duration_seconds_bucket{dependency="vault",endpoint="https://vault\"1",le="+Inf"} 1`,
+		`nauts_dependency_request_duration_seconds_count{dependency="vault",endpoint="https://vault\"1"} 1`,
+		`nauts_dependency_last_success_timestamp_seconds{dependency="vault",endpoint="https://vault\"1"} 1700000000`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("output misses %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "nauts_dependency_last_error_timestamp_seconds{") || !strings.HasSuffix(out, "# EOF\n") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
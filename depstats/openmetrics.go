@@ -0,0 +1,81 @@
+package depstats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// OpenMetricsContentType is the content type of WriteOpenMetrics output.
+const OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// WriteOpenMetrics writes stats in the OpenMetrics text format, terminated
+// by "# EOF":
+//
+//	nauts_dependency_requests_total{dependency,endpoint,result="success"|"error"}
+//	nauts_dependency_request_duration_seconds (histogram)
+//	nauts_dependency_last_success_timestamp_seconds
+//	nauts_dependency_last_error_timestamp_seconds
+//
+// Timestamps are only written for endpoints with such a call.
+func WriteOpenMetrics(w io.Writer, stats []Stats) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "# TYPE nauts_dependency_requests counter")
+	fmt.Fprintln(bw, "# HELP nauts_dependency_requests Calls to external dependencies by result.")
+	for _, s := range stats {
+		fmt.Fprintf(bw, "nauts_dependency_requests_total{%s,result=\"success\"} %d\n", labels(s), s.Success)
+		fmt.Fprintf(bw, "nauts_dependency_requests_total{%s,result=\"error\"} %d\n", labels(s), s.Errors)
+	}
+
+	fmt.Fprintln(bw, "# TYPE nauts_dependency_request_duration_seconds histogram")
+	fmt.Fprintln(bw, "# UNIT nauts_dependency_request_duration_seconds seconds")
+	fmt.Fprintln(bw, "# HELP nauts_dependency_request_duration_seconds Latency of calls to external dependencies.")
+	for _, s := range stats {
+		for _, b := range s.Latency {
+			le := "+Inf"
+			if b.UpperBound > 0 {
+				le = formatFloat(b.UpperBound)
+			}
+			fmt.Fprintf(bw, "nauts_dependency_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels(s), le, b.Count)
+		}
+		fmt.Fprintf(bw, "nauts_dependency_request_duration_seconds_count{%s} %d\n", labels(s), s.Success+s.Errors)
+		fmt.Fprintf(bw, "nauts_dependency_request_duration_seconds_sum{%s} %s\n", labels(s), formatFloat(s.LatencySum))
+	}
+
+	fmt.Fprintln(bw, "# TYPE nauts_dependency_last_success_timestamp_seconds gauge")
+	fmt.Fprintln(bw, "# UNIT nauts_dependency_last_success_timestamp_seconds seconds")
+	fmt.Fprintln(bw, "# HELP nauts_dependency_last_success_timestamp_seconds Time of the last successful call.")
+	for _, s := range stats {
+		if !s.LastSuccess.IsZero() {
+			fmt.Fprintf(bw, "nauts_dependency_last_success_timestamp_seconds{%s} %s\n", labels(s), formatFloat(float64(s.LastSuccess.UnixMilli())/1000))
+		}
+	}
+
+	fmt.Fprintln(bw, "# TYPE nauts_dependency_last_error_timestamp_seconds gauge")
+	fmt.Fprintln(bw, "# UNIT nauts_dependency_last_error_timestamp_seconds seconds")
+	fmt.Fprintln(bw, "# HELP nauts_dependency_last_error_timestamp_seconds Time of the last failed call.")
+	for _, s := range stats {
+		if !s.LastError.IsZero() {
+			fmt.Fprintf(bw, "nauts_dependency_last_error_timestamp_seconds{%s} %s\n", labels(s), formatFloat(float64(s.LastError.UnixMilli())/1000))
+		}
+	}
+
+	fmt.Fprintln(bw, "# EOF")
+	return bw.Flush()
+}
+
+func labels(s Stats) string {
+	return "dependency=\"" + escapeLabel(s.Dependency) + "\",endpoint=\"" + escapeLabel(s.Endpoint) + "\""
+}
+
+// escapeLabel escapes a label value as required by OpenMetrics.
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
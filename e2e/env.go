@@ -4,6 +4,7 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -90,8 +91,27 @@ func (e *TestEnv) startNauts() {
 	e.t.Log("Starting nauts auth service...")
 	// environment variable NATS_URL
 	nautsPath := "../../bin/nauts"
+	// nauts signals readiness over the systemd notify protocol once it is
+	// subscribed to the callout subject.
+	notifyDir, err := os.MkdirTemp("", "nauts-notify")
+	if err != nil {
+		e.stopNats()
+		e.t.Fatalf("Failed to create notify socket directory: %v", err)
+	}
+	defer os.RemoveAll(notifyDir)
+	notifySocket := filepath.Join(notifyDir, "notify.sock")
+	notifyConn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: notifySocket, Net: "unixgram"})
+	if err != nil {
+		e.stopNats()
+		e.t.Fatalf("Failed to listen on notify socket: %v", err)
+	}
+	defer notifyConn.Close()
+
 	e.nautsCmd = exec.Command(nautsPath, "-c", "nauts.json")
-	e.nautsCmd.Env = []string{fmt.Sprintf("NATS_URL=nats://localhost:%d", e.port)}
+	e.nautsCmd.Env = []string{
+		fmt.Sprintf("NATS_URL=nats://localhost:%d", e.port),
+		"NOTIFY_SOCKET=" + notifySocket,
+	}
 	e.nautsCmd.Dir = e.baseDir
 	e.nautsCmd.Stdout = os.Stdout
 	e.nautsCmd.Stderr = os.Stderr
@@ -101,7 +121,29 @@ func (e *TestEnv) startNauts() {
 	}
 
 	// Wait for nauts to be ready
-	time.Sleep(time.Second)
+	if err := waitForReady(notifyConn, 10*time.Second); err != nil {
+		e.stop()
+		e.t.Fatalf("nauts did not become ready: %v", err)
+	}
+}
+
+// waitForReady reads sd_notify datagrams until one contains READY=1.
+func waitForReady(conn *net.UnixConn, timeout time.Duration) error {
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if line == "READY=1" {
+				return nil
+			}
+		}
+	}
 }
 
 func (e *TestEnv) stop() {
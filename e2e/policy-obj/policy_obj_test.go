@@ -0,0 +1,207 @@
+package policy_obj_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/msimon/nauts/e2e"
+	"github.com/nats-io/nats.go"
+)
+
+func TestPoliciesObj(t *testing.T) {
+	e2e.WithTestEnv(t, ".", "static", 4233, nil, func(t *testing.T, env *e2e.TestEnv) {
+		adminNc, err := env.ConnectWithUsernameAndPassword("admin", "secret", "POLICY", "policy-file")
+		if err != nil {
+			t.Fatalf("setup failed to authenticate as admin: %v", err)
+		}
+		defer adminNc.Close()
+
+		adminJs, err := adminNc.JetStream()
+		if err != nil {
+			t.Fatalf("setup failed to get JetStream context: %v", err)
+		}
+
+		if _, err := adminJs.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "STORE_VIEW"}); err != nil {
+			t.Fatalf("setup failed to create STORE_VIEW: %v", err)
+		}
+		objData, err := adminJs.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "STORE_DATA"})
+		if err != nil {
+			t.Fatalf("setup failed to create STORE_DATA: %v", err)
+		}
+		if _, err := objData.PutString("report.txt", "data"); err != nil {
+			t.Fatalf("setup failed to put report.txt: %v", err)
+		}
+		if _, err := adminJs.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "STORE_EDIT"}); err != nil {
+			t.Fatalf("setup failed to create STORE_EDIT: %v", err)
+		}
+		objScoped, err := adminJs.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "STORE_SCOPED"})
+		if err != nil {
+			t.Fatalf("setup failed to create STORE_SCOPED: %v", err)
+		}
+		_, _ = objScoped.PutString("scoper.txt", "yes")
+		_, _ = objScoped.PutString("nope.txt", "no")
+
+		t.Run("obj.manage: manager can create and delete STORE_MGR (but cannot delete STORE_VIEW)", func(t *testing.T) {
+			nc, err := env.ConnectWithUsernameAndPassword("manager", "secret", "POLICY", "policy-file")
+			if err != nil {
+				t.Fatalf("manager failed to authenticate: %v", err)
+			}
+			defer nc.Close()
+
+			js, err := nc.JetStream()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "STORE_MGR"}); err != nil {
+				t.Fatalf("manager failed to create STORE_MGR: %v", err)
+			}
+			if err := js.DeleteObjectStore("STORE_MGR"); err != nil {
+				t.Fatalf("manager failed to delete STORE_MGR: %v", err)
+			}
+
+			if err := js.DeleteObjectStore("STORE_VIEW"); err == nil {
+				t.Fatalf("manager succeeded to delete STORE_VIEW (expected error)")
+			}
+		})
+
+		t.Run("obj.view: viewer can inspect STORE_VIEW (but cannot read or write objects)", func(t *testing.T) {
+			nc, err := env.ConnectWithUsernameAndPassword("viewer", "secret", "POLICY", "policy-file")
+			if err != nil {
+				t.Fatalf("viewer failed to authenticate: %v", err)
+			}
+			defer nc.Close()
+
+			js, err := nc.JetStream()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			obs, err := js.ObjectStore("STORE_VIEW")
+			if err != nil {
+				t.Fatalf("viewer failed to bind to STORE_VIEW: %v", err)
+			}
+			if _, err := obs.Status(); err != nil {
+				t.Fatalf("viewer failed to get STORE_VIEW status: %v", err)
+			}
+
+			if _, err := obs.GetInfo("missing"); err == nil {
+				t.Fatalf("viewer succeeded to read object info from STORE_VIEW (expected error)")
+			}
+			if _, err := obs.PutString("o", "v"); err == nil {
+				t.Fatalf("viewer succeeded to write object to STORE_VIEW (expected error)")
+			}
+		})
+
+		t.Run("obj.read with object '>' wildcard: reader can get and list objects in STORE_DATA but cannot write", func(t *testing.T) {
+			nc, err := env.ConnectWithUsernameAndPassword("reader", "secret", "POLICY", "policy-file")
+			if err != nil {
+				t.Fatalf("reader failed to authenticate: %v", err)
+			}
+			defer nc.Close()
+
+			js, err := nc.JetStream()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			obs, err := js.ObjectStore("STORE_DATA")
+			if err != nil {
+				t.Fatalf("reader failed to bind to STORE_DATA: %v", err)
+			}
+			got, err := obs.GetString("report.txt")
+			if err != nil {
+				t.Fatalf("reader failed to get report.txt: %v", err)
+			}
+			if got != "data" {
+				t.Fatalf("reader got %q, want %q", got, "data")
+			}
+			infos, err := obs.List()
+			if err != nil {
+				t.Fatalf("reader failed to list STORE_DATA: %v", err)
+			}
+			if len(infos) != 1 {
+				t.Fatalf("reader listed %d objects, want 1", len(infos))
+			}
+			if _, err := obs.PutString("new.txt", "value"); err == nil {
+				t.Fatalf("reader succeeded to write to STORE_DATA (expected error)")
+			}
+
+			watcher, err := obs.Watch(nats.IgnoreDeletes())
+			if err != nil {
+				t.Fatalf("reader failed to start watch: %v", err)
+			}
+			defer watcher.Stop()
+			select {
+			case <-watcher.Updates():
+				// ok (initial values or subsequent updates)
+			case <-time.After(250 * time.Millisecond):
+				// also ok: the key point is that the watch subscription was allowed
+			}
+		})
+
+		t.Run("obj.write with object '>' wildcard: editor can put/get/delete in STORE_EDIT", func(t *testing.T) {
+			nc, err := env.ConnectWithUsernameAndPassword("editor", "secret", "POLICY", "policy-file")
+			if err != nil {
+				t.Fatalf("editor failed to authenticate: %v", err)
+			}
+			defer nc.Close()
+
+			js, err := nc.JetStream()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			obs, err := js.ObjectStore("STORE_EDIT")
+			if err != nil {
+				t.Fatalf("editor failed to bind to STORE_EDIT: %v", err)
+			}
+
+			if _, err := obs.PutString("file.txt", "value"); err != nil {
+				t.Fatalf("editor failed to put file.txt: %v", err)
+			}
+			if _, err := obs.PutString("file.txt", "replaced"); err != nil {
+				t.Fatalf("editor failed to replace file.txt: %v", err)
+			}
+			got, err := obs.GetString("file.txt")
+			if err != nil {
+				t.Fatalf("editor failed to get file.txt: %v", err)
+			}
+			if got != "replaced" {
+				t.Fatalf("editor got %q, want %q", got, "replaced")
+			}
+			if err := obs.Delete("file.txt"); err != nil {
+				t.Fatalf("editor failed to delete file.txt: %v", err)
+			}
+		})
+
+		t.Run("obj.read with object '{{ user.id }}.txt' scope: scoper can read own object but not write", func(t *testing.T) {
+			nc, err := env.ConnectWithUsernameAndPassword("scoper", "secret", "POLICY", "policy-file")
+			if err != nil {
+				t.Fatalf("scoper failed to authenticate: %v", err)
+			}
+			defer nc.Close()
+
+			js, err := nc.JetStream()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			obs, err := js.ObjectStore("STORE_SCOPED")
+			if err != nil {
+				t.Fatalf("scoper failed to bind to STORE_SCOPED: %v", err)
+			}
+
+			got, err := obs.GetString("scoper.txt")
+			if err != nil {
+				t.Fatalf("scoper failed to get scoper.txt: %v", err)
+			}
+			if got != "yes" {
+				t.Fatalf("scoper got %q, want %q", got, "yes")
+			}
+			if _, err := obs.PutString("scoper.txt", "nope"); err == nil {
+				t.Fatalf("scoper succeeded to write (expected error)")
+			}
+		})
+	})
+}
@@ -3,6 +3,8 @@ package identity
 import (
 	"errors"
 	"fmt"
+	"net/netip"
+	"sort"
 	"strings"
 )
 
@@ -15,6 +17,9 @@ var (
 
 	// ErrAuthenticationProviderNotManageable is returned when a request targets an account not manageable by the selected provider.
 	ErrAuthenticationProviderNotManageable = errors.New("account is not manageable by provider")
+
+	// ErrAuthenticationProviderNotAllowed is returned when the client address is outside the networks allowed for a provider.
+	ErrAuthenticationProviderNotAllowed = errors.New("authentication provider not allowed from client address")
 )
 
 type registeredAuthenticationProvider struct {
@@ -31,19 +36,61 @@ type registeredAuthenticationProvider struct {
 //
 // Manageable account matching supports patterns "*" and "prefix*".
 // Wildcards do not match SYS or AUTH; those accounts must be explicitly listed.
+//
+// Providers restricted with WithAllowedNetworks are only selected for requests whose
+// ClientIP is within one of their networks. Restrictions are enforced before verification.
 type AuthenticationProviderManager struct {
 	providers   []registeredAuthenticationProvider
 	providersBy map[string]AuthenticationProvider
+	networks    map[string][]netip.Prefix
+}
+
+// ManagerOption configures an AuthenticationProviderManager.
+type ManagerOption func(*AuthenticationProviderManager)
+
+// WithAllowedNetworks restricts the provider with the given id to clients whose
+// source address is within one of networks. Requests without a known client
+// address are rejected by restricted providers.
+func WithAllowedNetworks(id string, networks []netip.Prefix) ManagerOption {
+	return func(m *AuthenticationProviderManager) {
+		if len(networks) > 0 {
+			m.networks[id] = networks
+		}
+	}
+}
+
+// ParseNetworks parses CIDR strings (e.g., "10.0.0.0/8", "2001:db8::/32").
+// A bare address is treated as a single-host network.
+func ParseNetworks(cidrs []string) ([]netip.Prefix, error) {
+	networks := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if !strings.Contains(cidr, "/") {
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid network %q: %w", cidr, err)
+			}
+			networks = append(networks, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", cidr, err)
+		}
+		networks = append(networks, prefix.Masked())
+	}
+	return networks, nil
 }
 
 // NewAuthenticationProviderManager constructs an AuthenticationProviderManager.
-func NewAuthenticationProviderManager(providers map[string]AuthenticationProvider) (*AuthenticationProviderManager, error) {
+func NewAuthenticationProviderManager(providers map[string]AuthenticationProvider, opts ...ManagerOption) (*AuthenticationProviderManager, error) {
 	if len(providers) == 0 {
 		return nil, fmt.Errorf("no authentication providers configured")
 	}
 
 	m := &AuthenticationProviderManager{
 		providersBy: make(map[string]AuthenticationProvider, len(providers)),
+		networks:    make(map[string][]netip.Prefix),
 	}
 
 	for id, p := range providers {
@@ -59,60 +106,235 @@ func NewAuthenticationProviderManager(providers map[string]AuthenticationProvide
 		m.providersBy[id] = p
 		m.providers = append(m.providers, registeredAuthenticationProvider{id: id, provider: p})
 	}
+	sort.Slice(m.providers, func(i, j int) bool { return m.providers[i].id < m.providers[j].id })
+
+	for _, opt := range opts {
+		opt(m)
+	}
+	for id := range m.networks {
+		if _, ok := m.providersBy[id]; !ok {
+			return nil, fmt.Errorf("allowed networks configured for unknown authentication provider: %q", id)
+		}
+	}
 
 	return m, nil
 }
 
+// Provider returns the provider registered under id, or nil.
+func (m *AuthenticationProviderManager) Provider(id string) AuthenticationProvider {
+	return m.providersBy[id]
+}
+
+// Stop stops all providers that hold background resources (e.g., JWKS
+// refreshes). The manager must not be used afterwards.
+func (m *AuthenticationProviderManager) Stop() error {
+	var errs []error
+	for _, p := range m.providersBy {
+		if s, ok := p.(interface{ Stop() error }); ok {
+			errs = append(errs, s.Stop())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Selection reasons reported in ProviderSelection.Reason.
+const (
+	// SelectionExplicit means the request named the provider (ap).
+	SelectionExplicit = "explicit"
+	// SelectionAccountPattern means the provider is the only eligible one whose
+	// manageable accounts match the requested account.
+	SelectionAccountPattern = "account_pattern"
+)
+
+// Reasons reported in ProviderCandidate.Skipped.
+const (
+	SkippedAccountNotManageable = "account not manageable"
+	SkippedClientNotAllowed     = "client address not allowed"
+)
+
+// ProviderCandidate describes how a provider was evaluated during selection.
+type ProviderCandidate struct {
+	ID string `json:"id"`
+	// Pattern is the manageable-account pattern that matches the requested account.
+	Pattern string `json:"pattern,omitempty"`
+	// Skipped explains why the provider is not eligible. Empty for eligible providers.
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// ProviderSelection explains which provider is selected for a request and why.
+type ProviderSelection struct {
+	Account string `json:"account"`
+	AP      string `json:"ap,omitempty"`
+	// ProviderID is the selected provider. Empty if selection failed.
+	ProviderID string `json:"provider_id,omitempty"`
+	// Reason is SelectionExplicit or SelectionAccountPattern.
+	Reason string `json:"reason,omitempty"`
+	// Pattern is the manageable-account pattern of the selected provider that matches Account.
+	Pattern string `json:"pattern,omitempty"`
+	// Candidates lists the evaluated providers, sorted by id. For explicit
+	// selection only the requested provider is evaluated.
+	Candidates []ProviderCandidate `json:"candidates"`
+}
+
+// String returns a one-line summary for logs.
+func (s *ProviderSelection) String() string {
+	var b strings.Builder
+	if s.ProviderID != "" {
+		fmt.Fprintf(&b, "provider %q (%s", s.ProviderID, s.Reason)
+		if s.Pattern != "" {
+			fmt.Fprintf(&b, ", pattern %q", s.Pattern)
+		}
+		b.WriteString(")")
+	} else {
+		b.WriteString("no provider")
+	}
+	fmt.Fprintf(&b, " for account %q", s.Account)
+	for _, c := range s.Candidates {
+		if c.Skipped != "" {
+			fmt.Fprintf(&b, "; %s: %s", c.ID, c.Skipped)
+		}
+	}
+	return b.String()
+}
+
 // SelectProvider selects the provider for a request without performing verification.
 // Returns the provider id and instance, or an error if selection is invalid or ambiguous.
 func (m *AuthenticationProviderManager) SelectProvider(req AuthRequest) (string, AuthenticationProvider, error) {
+	selection, err := m.ExplainSelection(req)
+	if err != nil {
+		return "", nil, err
+	}
+	return selection.ProviderID, m.Provider(selection.ProviderID), nil
+}
+
+// ExplainSelection selects the provider for a request like SelectProvider and
+// reports how every candidate was evaluated. The selection is returned even if
+// the error is non-nil, so callers can show why no provider was selected.
+func (m *AuthenticationProviderManager) ExplainSelection(req AuthRequest) (*ProviderSelection, error) {
+	selection := &ProviderSelection{
+		Account:    req.Account,
+		AP:         req.AP,
+		Candidates: []ProviderCandidate{},
+	}
+
 	if req.AP != "" {
 		p, ok := m.providersBy[req.AP]
 		if !ok {
-			return "", nil, fmt.Errorf("%w: %s", ErrAuthenticationProviderNotFound, req.AP)
+			return selection, fmt.Errorf("%w: %s", ErrAuthenticationProviderNotFound, req.AP)
 		}
-		if !accountIsManageableByProvider(p.ManageableAccounts(), req.Account) {
-			return "", nil, fmt.Errorf("%w: %s", ErrAuthenticationProviderNotManageable, req.Account)
+		candidate := m.evaluate(req.AP, p, req)
+		selection.Candidates = append(selection.Candidates, candidate)
+		switch candidate.Skipped {
+		case SkippedAccountNotManageable:
+			return selection, fmt.Errorf("%w: %s", ErrAuthenticationProviderNotManageable, req.Account)
+		case SkippedClientNotAllowed:
+			return selection, fmt.Errorf("%w: %s from %s", ErrAuthenticationProviderNotAllowed, req.AP, clientIPString(req.ClientIP))
 		}
-		return req.AP, p, nil
+		selection.ProviderID = req.AP
+		selection.Reason = SelectionExplicit
+		selection.Pattern = candidate.Pattern
+		return selection, nil
 	}
 
-	matches := make([]registeredAuthenticationProvider, 0, 1)
+	// Providers restricted to other networks are skipped, so that e.g. a password
+	// provider limited to office ranges and a JWT provider can share an account.
+	var matches []ProviderCandidate
+	restricted := 0
 	for _, rp := range m.providers {
-		if accountIsManageableByProvider(rp.provider.ManageableAccounts(), req.Account) {
-			matches = append(matches, rp)
+		candidate := m.evaluate(rp.id, rp.provider, req)
+		selection.Candidates = append(selection.Candidates, candidate)
+		switch candidate.Skipped {
+		case "":
+			matches = append(matches, candidate)
+		case SkippedClientNotAllowed:
+			restricted++
 		}
 	}
 
 	switch len(matches) {
 	case 0:
-		return "", nil, fmt.Errorf("%w: %s", ErrAuthenticationProviderNotManageable, req.Account)
+		if restricted > 0 {
+			return selection, fmt.Errorf("%w: account %q from %s", ErrAuthenticationProviderNotAllowed, req.Account, clientIPString(req.ClientIP))
+		}
+		return selection, fmt.Errorf("%w: %s", ErrAuthenticationProviderNotManageable, req.Account)
 	case 1:
-		return matches[0].id, matches[0].provider, nil
+		selection.ProviderID = matches[0].ID
+		selection.Reason = SelectionAccountPattern
+		selection.Pattern = matches[0].Pattern
+		return selection, nil
 	default:
-		return "", nil, fmt.Errorf("%w: %d providers match account %q", ErrAuthenticationProviderAmbiguous, len(matches), req.Account)
+		return selection, fmt.Errorf("%w: %d providers match account %q", ErrAuthenticationProviderAmbiguous, len(matches), req.Account)
 	}
 }
 
-func accountIsManageableByProvider(patterns []string, account string) bool {
-	if account == "" {
+// evaluate checks whether the provider with the given id can serve req.
+func (m *AuthenticationProviderManager) evaluate(id string, p AuthenticationProvider, req AuthRequest) ProviderCandidate {
+	candidate := ProviderCandidate{ID: id}
+	pattern, ok := manageableAccountPattern(p.ManageableAccounts(), req.Account)
+	if !ok {
+		candidate.Skipped = SkippedAccountNotManageable
+		return candidate
+	}
+	candidate.Pattern = pattern
+	if !m.clientIsAllowed(id, req.ClientIP) {
+		candidate.Skipped = SkippedClientNotAllowed
+	}
+	return candidate
+}
+
+// clientIsAllowed reports whether a client at ip may use the provider with the given id.
+func (m *AuthenticationProviderManager) clientIsAllowed(id string, ip netip.Addr) bool {
+	networks, ok := m.networks[id]
+	if !ok {
+		return true
+	}
+	if !ip.IsValid() {
 		return false
 	}
+	ip = ip.Unmap()
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func clientIPString(ip netip.Addr) string {
+	if !ip.IsValid() {
+		return "unknown address"
+	}
+	return ip.String()
+}
+
+// MatchesAccount reports whether account is matched by one of patterns as
+// returned by AuthenticationProvider.ManageableAccounts. "*" and "prefix*"
+// never match SYS and AUTH; those must be listed explicitly.
+func MatchesAccount(patterns []string, account string) bool {
+	_, ok := manageableAccountPattern(patterns, account)
+	return ok
+}
+
+// manageableAccountPattern returns the first pattern that matches account.
+func manageableAccountPattern(patterns []string, account string) (string, bool) {
+	if account == "" {
+		return "", false
+	}
 	if account == "SYS" || account == "AUTH" {
 		for _, p := range patterns {
 			if p == account {
-				return true
+				return p, true
 			}
 		}
-		return false
+		return "", false
 	}
 
 	for _, pattern := range patterns {
 		if matchAccountPattern(pattern, account) {
-			return true
+			return pattern, true
 		}
 	}
-	return false
+	return "", false
 }
 
 func matchAccountPattern(pattern, account string) bool {
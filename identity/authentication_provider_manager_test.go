@@ -3,6 +3,7 @@ package identity
 import (
 	"context"
 	"errors"
+	"net/netip"
 	"strings"
 	"testing"
 )
@@ -170,6 +171,161 @@ func TestAuthenticationProviderManager_SelectProvider_ImplicitSelection(t *testi
 	})
 }
 
+func TestAuthenticationProviderManager_SelectProvider_AllowedNetworks(t *testing.T) {
+	office, err := ParseNetworks([]string{"10.0.0.0/8", "2001:db8::/32"})
+	if err != nil {
+		t.Fatalf("ParseNetworks() error = %v", err)
+	}
+	newManager := func(t *testing.T) *AuthenticationProviderManager {
+		t.Helper()
+		m, err := NewAuthenticationProviderManager(map[string]AuthenticationProvider{
+			"password": &recordingAuthProvider{patterns: []string{"ACME"}, userID: "password"},
+			"jwt":      &recordingAuthProvider{patterns: []string{"OTHER"}, userID: "jwt"},
+		}, WithAllowedNetworks("password", office))
+		if err != nil {
+			t.Fatalf("NewAuthenticationProviderManager() error = %v", err)
+		}
+		return m
+	}
+
+	tests := []struct {
+		name    string
+		req     AuthRequest
+		wantID  string
+		wantErr error
+	}{
+		{name: "explicit from office", req: AuthRequest{Account: "ACME", AP: "password", ClientIP: netip.MustParseAddr("10.1.2.3")}, wantID: "password"},
+		{name: "explicit from ipv6 office", req: AuthRequest{Account: "ACME", AP: "password", ClientIP: netip.MustParseAddr("2001:db8::1")}, wantID: "password"},
+		{name: "explicit from ipv4-mapped office", req: AuthRequest{Account: "ACME", AP: "password", ClientIP: netip.MustParseAddr("::ffff:10.1.2.3")}, wantID: "password"},
+		{name: "explicit from outside", req: AuthRequest{Account: "ACME", AP: "password", ClientIP: netip.MustParseAddr("192.0.2.1")}, wantErr: ErrAuthenticationProviderNotAllowed},
+		{name: "explicit without client address", req: AuthRequest{Account: "ACME", AP: "password"}, wantErr: ErrAuthenticationProviderNotAllowed},
+		{name: "implicit from outside", req: AuthRequest{Account: "ACME", ClientIP: netip.MustParseAddr("192.0.2.1")}, wantErr: ErrAuthenticationProviderNotAllowed},
+		{name: "unrestricted provider from outside", req: AuthRequest{Account: "OTHER", ClientIP: netip.MustParseAddr("192.0.2.1")}, wantID: "jwt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, _, err := newManager(t).SelectProvider(tt.req)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("SelectProvider() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SelectProvider() error = %v", err)
+			}
+			if id != tt.wantID {
+				t.Fatalf("SelectProvider() id = %q, want %q", id, tt.wantID)
+			}
+		})
+	}
+
+	t.Run("restricted provider does not make selection ambiguous", func(t *testing.T) {
+		m, err := NewAuthenticationProviderManager(map[string]AuthenticationProvider{
+			"password": &recordingAuthProvider{patterns: []string{"ACME"}, userID: "password"},
+			"jwt":      &recordingAuthProvider{patterns: []string{"ACME"}, userID: "jwt"},
+		}, WithAllowedNetworks("password", office))
+		if err != nil {
+			t.Fatalf("NewAuthenticationProviderManager() error = %v", err)
+		}
+		id, _, err := m.SelectProvider(AuthRequest{Account: "ACME", ClientIP: netip.MustParseAddr("192.0.2.1")})
+		if err != nil {
+			t.Fatalf("SelectProvider() error = %v", err)
+		}
+		if id != "jwt" {
+			t.Fatalf("SelectProvider() id = %q, want %q", id, "jwt")
+		}
+	})
+
+	t.Run("unknown provider id", func(t *testing.T) {
+		_, err := NewAuthenticationProviderManager(map[string]AuthenticationProvider{
+			"password": &recordingAuthProvider{patterns: []string{"ACME"}},
+		}, WithAllowedNetworks("missing", office))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestAuthenticationProviderManager_ExplainSelection(t *testing.T) {
+	office := netip.MustParsePrefix("10.0.0.0/8")
+	m, err := NewAuthenticationProviderManager(map[string]AuthenticationProvider{
+		"corp":   &recordingAuthProvider{patterns: []string{"APP*"}},
+		"local":  &recordingAuthProvider{patterns: []string{"DEV"}},
+		"office": &recordingAuthProvider{patterns: []string{"*"}},
+	}, WithAllowedNetworks("office", []netip.Prefix{office}))
+	if err != nil {
+		t.Fatalf("NewAuthenticationProviderManager() error = %v", err)
+	}
+
+	t.Run("account pattern", func(t *testing.T) {
+		sel, err := m.ExplainSelection(AuthRequest{Account: "APP1"})
+		if err != nil {
+			t.Fatalf("ExplainSelection() error = %v", err)
+		}
+		if sel.ProviderID != "corp" || sel.Reason != SelectionAccountPattern || sel.Pattern != "APP*" {
+			t.Errorf("selection = %+v, want corp by pattern APP*", sel)
+		}
+		want := []ProviderCandidate{
+			{ID: "corp", Pattern: "APP*"},
+			{ID: "local", Skipped: SkippedAccountNotManageable},
+			{ID: "office", Pattern: "*", Skipped: SkippedClientNotAllowed},
+		}
+		if len(sel.Candidates) != len(want) {
+			t.Fatalf("candidates = %+v, want %+v", sel.Candidates, want)
+		}
+		for i := range want {
+			if sel.Candidates[i] != want[i] {
+				t.Errorf("candidates[%d] = %+v, want %+v", i, sel.Candidates[i], want[i])
+			}
+		}
+	})
+
+	t.Run("explicit", func(t *testing.T) {
+		sel, err := m.ExplainSelection(AuthRequest{Account: "DEV", AP: "local"})
+		if err != nil {
+			t.Fatalf("ExplainSelection() error = %v", err)
+		}
+		if sel.ProviderID != "local" || sel.Reason != SelectionExplicit || len(sel.Candidates) != 1 {
+			t.Errorf("selection = %+v, want explicit local with one candidate", sel)
+		}
+	})
+
+	t.Run("ambiguous keeps candidates", func(t *testing.T) {
+		sel, err := m.ExplainSelection(AuthRequest{Account: "APP1", ClientIP: netip.MustParseAddr("10.1.2.3")})
+		if !errors.Is(err, ErrAuthenticationProviderAmbiguous) {
+			t.Fatalf("ExplainSelection() error = %v, want ErrAuthenticationProviderAmbiguous", err)
+		}
+		if sel == nil || sel.ProviderID != "" || len(sel.Candidates) != 3 {
+			t.Errorf("selection = %+v, want no provider and three candidates", sel)
+		}
+		if got := sel.String(); !strings.Contains(got, "local: account not manageable") {
+			t.Errorf("String() = %q, want skipped candidate", got)
+		}
+	})
+}
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks([]string{"10.1.2.3/8", "192.0.2.7", " 2001:db8::/32 "})
+	if err != nil {
+		t.Fatalf("ParseNetworks() error = %v", err)
+	}
+	want := []string{"10.0.0.0/8", "192.0.2.7/32", "2001:db8::/32"}
+	if len(networks) != len(want) {
+		t.Fatalf("ParseNetworks() = %v, want %v", networks, want)
+	}
+	for i, n := range networks {
+		if n.String() != want[i] {
+			t.Errorf("networks[%d] = %s, want %s", i, n, want[i])
+		}
+	}
+
+	if _, err := ParseNetworks([]string{"not-a-network"}); err == nil {
+		t.Error("expected error for invalid network")
+	}
+}
+
 func TestAuthenticationProviderManager_ManageableAccountMatching_SYS_AUTH(t *testing.T) {
 	m, err := NewAuthenticationProviderManager(map[string]AuthenticationProvider{
 		"p1": &recordingAuthProvider{patterns: []string{"*"}, userID: "p1"},
@@ -206,6 +362,29 @@ func TestAuthenticationProviderManager_ManageableAccountMatching_SYS_AUTH(t *tes
 	}
 }
 
+func TestMatchesAccount(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		account  string
+		want     bool
+	}{
+		{name: "exact", patterns: []string{"ACME"}, account: "ACME", want: true},
+		{name: "prefix", patterns: []string{"tenant-*"}, account: "tenant-a", want: true},
+		{name: "no match", patterns: []string{"tenant-*"}, account: "ACME", want: false},
+		{name: "wildcard excludes SYS", patterns: []string{"*"}, account: "SYS", want: false},
+		{name: "explicit AUTH", patterns: []string{"*", "AUTH"}, account: "AUTH", want: true},
+		{name: "empty account", patterns: []string{"*"}, account: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchesAccount(tt.patterns, tt.account); got != tt.want {
+				t.Fatalf("MatchesAccount(%v, %q) = %v, want %v", tt.patterns, tt.account, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestMatchAccountPattern(t *testing.T) {
 	tests := []struct {
 		name    string
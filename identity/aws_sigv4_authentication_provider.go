@@ -11,6 +11,8 @@ import (
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/msimon/nauts/depstats"
 )
 
 // AwsSigV4AuthenticationProviderConfig holds configuration for AwsSigV4AuthenticationProvider.
@@ -160,19 +162,19 @@ func (p *AwsSigV4AuthenticationProvider) Verify(ctx context.Context, req AuthReq
 	}
 
 	// 8. Validate and extract role name
-	account, role, err := validateAndParseRoleName(parsedARN.RoleName)
+	role, err := validateAndParseRoleName(parsedARN.RoleName)
 	if err != nil {
 		return nil, err
 	}
 
 	// 9. Validate AuthRequest.Account matches extracted account
-	if req.Account != account {
+	if req.Account != role.Account {
 		return nil, fmt.Errorf("%w: requested %s but role specifies %s",
-			ErrInvalidAccount, req.Account, account)
+			ErrInvalidAccount, req.Account, role.Account)
 	}
 
 	// 10. Construct User
-	return constructUser(parsedARN, account, role), nil
+	return constructUser(parsedARN, role), nil
 }
 
 // parseAwsSigV4Token parses the authentication token JSON.
@@ -288,20 +290,23 @@ func callSTSGetCallerIdentity(ctx context.Context, token *sigV4Token, region str
 	}
 
 	// Make the request with a timeout
-	client := &http.Client{
-		Timeout: 5 * time.Second,
-	}
+	client := depstats.Client(&http.Client{Timeout: 5 * time.Second}, depstats.DependencySTS, "")
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("calling STS: %w", err)
+		return "", fmt.Errorf("%w: calling STS: %w", ErrProviderUnavailable, err)
 	}
 	defer resp.Body.Close()
 
 	// Read response body
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("reading STS response: %w", err)
+		return "", fmt.Errorf("%w: reading STS response: %w", ErrProviderUnavailable, err)
+	}
+
+	// Server-side failures say nothing about the credentials
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return "", fmt.Errorf("%w: STS returned HTTP %d", ErrProviderUnavailable, resp.StatusCode)
 	}
 
 	// Check for error response
@@ -398,32 +403,31 @@ func parseRoleARN(arn string) (*parsedARN, error) {
 }
 
 // validateAndParseRoleName validates the role name follows nauts.<account>.<role> pattern.
-func validateAndParseRoleName(roleName string) (account, role string, err error) {
+func validateAndParseRoleName(roleName string) (Role, error) {
 	parts := strings.Split(roleName, ".")
 	if len(parts) != 3 {
-		return "", "", fmt.Errorf("%w: expected 3 parts, got %d", ErrInvalidRoleFormat, len(parts))
+		return Role{}, fmt.Errorf("%w: expected 3 parts, got %d", ErrInvalidRoleFormat, len(parts))
 	}
 
 	if parts[0] != "nauts" {
-		return "", "", fmt.Errorf("%w: must start with 'nauts'", ErrInvalidRoleFormat)
+		return Role{}, fmt.Errorf("%w: must start with 'nauts'", ErrInvalidRoleFormat)
 	}
 
-	account = parts[1]
-	role = parts[2]
+	role := Role{Account: parts[1], Name: parts[2]}
 
-	if !natsIdentifierRegex.MatchString(account) {
-		return "", "", fmt.Errorf("%w: invalid account name: %s", ErrInvalidRoleFormat, account)
+	if !natsIdentifierRegex.MatchString(role.Account) {
+		return Role{}, fmt.Errorf("%w: invalid account name: %s", ErrInvalidRoleFormat, role.Account)
 	}
 
-	if !natsIdentifierRegex.MatchString(role) {
-		return "", "", fmt.Errorf("%w: invalid role name: %s", ErrInvalidRoleFormat, role)
+	if !natsIdentifierRegex.MatchString(role.Name) {
+		return Role{}, fmt.Errorf("%w: invalid role name: %s", ErrInvalidRoleFormat, role.Name)
 	}
 
-	return account, role, nil
+	return role, nil
 }
 
 // constructUser builds a User object from the parsed ARN and role information.
-func constructUser(parsedARN *parsedARN, account, role string) *User {
+func constructUser(parsedARN *parsedARN, role Role) *User {
 	attributes := map[string]string{
 		"aws_account": parsedARN.AwsAccountID,
 		"aws_role":    parsedARN.RoleName,
@@ -435,10 +439,8 @@ func constructUser(parsedARN *parsedARN, account, role string) *User {
 	}
 
 	return &User{
-		ID: parsedARN.FullARN,
-		Roles: []Role{
-			{Account: account, Name: role},
-		},
+		ID:         parsedARN.FullARN,
+		Roles:      []Role{role},
 		Attributes: attributes,
 	}
 }
@@ -454,14 +454,14 @@ func TestValidateAndParseRoleName(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			account, role, err := validateAndParseRoleName(tt.roleName)
+			role, err := validateAndParseRoleName(tt.roleName)
 
 			if tt.wantErr {
 				assert.Error(t, err)
 			} else {
 				require.NoError(t, err)
-				assert.Equal(t, tt.wantAccount, account)
-				assert.Equal(t, tt.wantRole, role)
+				assert.Equal(t, tt.wantAccount, role.Account)
+				assert.Equal(t, tt.wantRole, role.Name)
 			}
 		})
 	}
@@ -524,7 +524,7 @@ func TestConstructUser(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := constructUser(tt.parsedARN, tt.account, tt.role)
+			got := constructUser(tt.parsedARN, Role{Account: tt.account, Name: tt.role})
 			assert.Equal(t, tt.want, got)
 		})
 	}
@@ -0,0 +1,252 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// azureLoginURL is the Microsoft Entra ID endpoint issuing managed identity tokens.
+const azureLoginURL = "https://login.microsoftonline.com/"
+
+var (
+	// ErrAzureTenantNotAllowed is returned when the token was issued by
+	// another Azure AD tenant than the configured one.
+	ErrAzureTenantNotAllowed = errors.New("azure tenant not allowed")
+
+	// ErrAzureSubscriptionNotAllowed is returned when the managed identity
+	// belongs to another subscription than the configured one.
+	ErrAzureSubscriptionNotAllowed = errors.New("azure subscription not allowed")
+
+	// ErrInvalidManagedIdentityFormat is returned when the managed identity
+	// name doesn't follow the nauts-<account>-<role> pattern.
+	ErrInvalidManagedIdentityFormat = errors.New("invalid azure managed identity format: expected nauts-<account>-<role>")
+
+	// azureGUIDRegex validates tenant and subscription IDs.
+	azureGUIDRegex = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// AzureAuthenticationProviderConfig holds configuration for AzureAuthenticationProvider.
+type AzureAuthenticationProviderConfig struct {
+	// Accounts is the list of NATS account patterns this provider manages.
+	// Patterns support wildcards in the form of "*" (all) or "prefix*".
+	Accounts []string `json:"accounts"`
+
+	// TenantID is the Azure AD tenant that issues the tokens.
+	// REQUIRED: Wildcards are NOT allowed.
+	TenantID string `json:"tenantId"`
+
+	// SubscriptionID is the subscription the managed identities must belong to.
+	// REQUIRED: Wildcards are NOT allowed.
+	SubscriptionID string `json:"subscriptionId"`
+
+	// Audience is the application ID URI (or client ID) of the app
+	// registration tokens are requested for, e.g. "api://nauts".
+	// REQUIRED.
+	Audience string `json:"audience"`
+
+	// JWKSURL is the URL of the tenant's JSON Web Key Set
+	// (default: https://login.microsoftonline.com/<tenant>/discovery/v2.0/keys).
+	JWKSURL string `json:"jwksUrl,omitempty"`
+	// JWKSRefreshInterval is how often JWKS keys are refreshed (default: 1h).
+	JWKSRefreshInterval time.Duration `json:"jwksRefreshInterval,omitempty"`
+
+	// HTTPClient fetches the JWKS (default: 10s timeout).
+	HTTPClient *http.Client `json:"-"`
+}
+
+// AzureAuthenticationProvider implements AuthenticationProvider using Azure AD
+// access tokens of managed identities.
+//
+// Managed identity names must follow the convention nauts-<account>-<role>
+// (e.g., a user-assigned identity nauts-app-worker). The provider extracts the
+// NATS account and role from the identity's resource ID (xms_mirid claim).
+type AzureAuthenticationProvider struct {
+	tenantID           string
+	subscriptionID     string
+	audience           string
+	issuers            []string
+	keys               *jwksKeySet
+	manageableAccounts []string
+}
+
+// azureManagedIdentity is a managed identity parsed from its resource ID:
+// /subscriptions/<sub>/resourcegroups/<rg>/providers/<provider>/<type>/<name>.
+type azureManagedIdentity struct {
+	ResourceID     string
+	SubscriptionID string
+	ResourceGroup  string
+	Name           string
+}
+
+// NewAzureAuthenticationProvider creates a new AzureAuthenticationProvider.
+// Signing keys are fetched in the background; call Stop to end the refresh.
+func NewAzureAuthenticationProvider(cfg AzureAuthenticationProviderConfig) (*AzureAuthenticationProvider, error) {
+	// Validate tenant and subscription are provided (REQUIRED)
+	if cfg.TenantID == "" {
+		return nil, errors.New("tenant ID is required")
+	}
+	if cfg.SubscriptionID == "" {
+		return nil, errors.New("subscription ID is required")
+	}
+
+	// Validate no wildcards and GUID format
+	for _, f := range []struct{ name, id string }{{"tenant", cfg.TenantID}, {"subscription", cfg.SubscriptionID}} {
+		if strings.Contains(f.id, "*") {
+			return nil, fmt.Errorf("%s ID must not contain wildcards: %s", f.name, f.id)
+		}
+		if !azureGUIDRegex.MatchString(f.id) {
+			return nil, fmt.Errorf("invalid azure %s ID format: %s", f.name, f.id)
+		}
+	}
+
+	if cfg.Audience == "" {
+		return nil, errors.New("audience is required")
+	}
+
+	tenantID := strings.ToLower(cfg.TenantID)
+	jwksURL := cfg.JWKSURL
+	if jwksURL == "" {
+		jwksURL = azureLoginURL + tenantID + "/discovery/v2.0/keys"
+	}
+
+	p := &AzureAuthenticationProvider{
+		tenantID:       tenantID,
+		subscriptionID: strings.ToLower(cfg.SubscriptionID),
+		audience:       cfg.Audience,
+		// v1.0 and v2.0 tokens, depending on the app registration's
+		// accessTokenAcceptedVersion.
+		issuers: []string{
+			"https://sts.windows.net/" + tenantID + "/",
+			azureLoginURL + tenantID + "/v2.0",
+		},
+		keys:               newJWKSKeySet(azureLoginURL+tenantID+"/v2.0", jwksURL, cfg.HTTPClient, cfg.JWKSRefreshInterval),
+		manageableAccounts: append([]string(nil), cfg.Accounts...),
+	}
+	p.keys.start()
+	return p, nil
+}
+
+// Stop stops the background JWKS refresh.
+func (p *AzureAuthenticationProvider) Stop() error {
+	p.keys.Stop()
+	return nil
+}
+
+// ManageableAccounts returns the list of account patterns this provider can manage.
+func (p *AzureAuthenticationProvider) ManageableAccounts() []string {
+	return append([]string(nil), p.manageableAccounts...)
+}
+
+// Verify validates the managed identity token and returns the user.
+func (p *AzureAuthenticationProvider) Verify(ctx context.Context, req AuthRequest) (*User, error) {
+	if req.Token == "" {
+		return nil, fmt.Errorf("%w: missing access token", ErrInvalidCredentials)
+	}
+
+	// 1. Verify the token signature, audience, and expiry
+	token, err := verifyJWT(ctx, req.Token, nil, p.keys,
+		jwt.WithAudience(p.audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidTokenType
+	}
+
+	// 2. Validate the tenant matches the configured tenant
+	tid, _ := claims["tid"].(string)
+	if !strings.EqualFold(tid, p.tenantID) {
+		return nil, fmt.Errorf("%w: expected %s, got %s", ErrAzureTenantNotAllowed, p.tenantID, tid)
+	}
+	iss, _ := claims["iss"].(string)
+	if !containsString(p.issuers, iss) {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidCredentials, iss)
+	}
+
+	// 3. Identify the managed identity and validate its subscription
+	mirid, _ := claims["xms_mirid"].(string)
+	if mirid == "" {
+		return nil, fmt.Errorf("%w: token is not issued to a managed identity", ErrInvalidCredentials)
+	}
+	mi, err := parseAzureManagedIdentity(mirid)
+	if err != nil {
+		return nil, err
+	}
+	if mi.SubscriptionID != p.subscriptionID {
+		return nil, fmt.Errorf("%w: expected %s, got %s", ErrAzureSubscriptionNotAllowed, p.subscriptionID, mi.SubscriptionID)
+	}
+
+	// 4. Validate and extract role from the identity name
+	role, err := roleFromManagedIdentityName(mi.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	// 5. Validate AuthRequest.Account matches extracted account
+	if req.Account != role.Account {
+		return nil, fmt.Errorf("%w: requested %s but managed identity specifies %s",
+			ErrInvalidAccount, req.Account, role.Account)
+	}
+
+	// 6. Construct User
+	attributes := map[string]string{
+		"azure_tenant":         p.tenantID,
+		"azure_subscription":   mi.SubscriptionID,
+		"azure_resource_group": mi.ResourceGroup,
+		"azure_identity":       mi.Name,
+	}
+	if oid, _ := claims["oid"].(string); oid != "" {
+		attributes["azure_object_id"] = oid
+	}
+	return &User{
+		ID:         mi.ResourceID,
+		Roles:      []Role{role},
+		Attributes: attributes,
+	}, nil
+}
+
+// parseAzureManagedIdentity parses the resource ID of a managed identity:
+// a user-assigned identity
+// (/subscriptions/<sub>/resourcegroups/<rg>/providers/Microsoft.ManagedIdentity/userAssignedIdentities/<name>)
+// or the resource of a system-assigned identity, e.g. a virtual machine.
+func parseAzureManagedIdentity(resourceID string) (*azureManagedIdentity, error) {
+	parts := strings.Split(strings.TrimPrefix(resourceID, "/"), "/")
+	if len(parts) < 8 || !strings.EqualFold(parts[0], "subscriptions") ||
+		!strings.EqualFold(parts[2], "resourcegroups") || !strings.EqualFold(parts[4], "providers") {
+		return nil, fmt.Errorf("%w: invalid managed identity resource ID %q", ErrInvalidCredentials, resourceID)
+	}
+	return &azureManagedIdentity{
+		ResourceID:     resourceID,
+		SubscriptionID: strings.ToLower(parts[1]),
+		ResourceGroup:  parts[3],
+		Name:           parts[len(parts)-1],
+	}, nil
+}
+
+// roleFromManagedIdentityName parses identity names of the form
+// nauts-<account>-<role>. The account is the first hyphen-separated segment;
+// the role is the rest and may contain hyphens.
+func roleFromManagedIdentityName(name string) (Role, error) {
+	rest, ok := strings.CutPrefix(name, "nauts-")
+	if !ok {
+		return Role{}, fmt.Errorf("%w: %s", ErrInvalidManagedIdentityFormat, name)
+	}
+	account, roleName, ok := strings.Cut(rest, "-")
+	if !ok || account == "" || roleName == "" {
+		return Role{}, fmt.Errorf("%w: %s", ErrInvalidManagedIdentityFormat, name)
+	}
+	if !natsIdentifierRegex.MatchString(account) || !natsIdentifierRegex.MatchString(roleName) {
+		return Role{}, fmt.Errorf("%w: %s", ErrInvalidManagedIdentityFormat, name)
+	}
+	return Role{Account: account, Name: roleName}, nil
+}
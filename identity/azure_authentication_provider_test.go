@@ -0,0 +1,156 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testAzureTenant       = "72f988bf-86f1-41af-91ab-2d7cd011db47"
+	testAzureSubscription = "0b1f6471-1bf0-4dda-aec3-cb9272f09590"
+)
+
+func testManagedIdentityID(subscription, name string) string {
+	return "/subscriptions/" + subscription + "/resourcegroups/rg-app/providers/Microsoft.ManagedIdentity/userAssignedIdentities/" + name
+}
+
+func signAzureToken(t *testing.T, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	t.Helper()
+	base := jwt.MapClaims{
+		"iss":       "https://sts.windows.net/" + testAzureTenant + "/",
+		"aud":       "api://nauts",
+		"tid":       testAzureTenant,
+		"oid":       "a1b2c3d4-0000-0000-0000-000000000000",
+		"xms_mirid": testManagedIdentityID(testAzureSubscription, "nauts-app-worker"),
+		"exp":       time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range claims {
+		if v == nil {
+			delete(base, k)
+			continue
+		}
+		base[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, base)
+	token.Header["kid"] = "k1"
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return s
+}
+
+func TestAzureAuthenticationProvider_Verify(t *testing.T) {
+	idp := newTestIdP(t)
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	idp.setKeys(http.StatusOK, rsaJWK("k1", &key.PublicKey))
+
+	p, err := NewAzureAuthenticationProvider(AzureAuthenticationProviderConfig{
+		Accounts:       []string{"app"},
+		TenantID:       testAzureTenant,
+		SubscriptionID: testAzureSubscription,
+		Audience:       "api://nauts",
+		JWKSURL:        idp.URL + "/keys",
+	})
+	if err != nil {
+		t.Fatalf("NewAzureAuthenticationProvider() error = %v", err)
+	}
+	_ = p.Stop()
+	ctx := context.Background()
+
+	otherTenant := "11111111-2222-3333-4444-555555555555"
+	tests := []struct {
+		name    string
+		account string
+		claims  jwt.MapClaims
+		wantErr error
+	}{
+		{name: "user-assigned identity", account: "app"},
+		{name: "v2 issuer", account: "app", claims: jwt.MapClaims{"iss": "https://login.microsoftonline.com/" + testAzureTenant + "/v2.0"}},
+		{name: "system-assigned identity", account: "app", claims: jwt.MapClaims{"xms_mirid": "/subscriptions/" + testAzureSubscription + "/resourcegroups/rg-app/providers/Microsoft.Compute/virtualMachines/nauts-app-worker"}},
+		{name: "missing token", account: "app", wantErr: ErrInvalidCredentials},
+		{name: "wrong audience", account: "app", claims: jwt.MapClaims{"aud": "https://management.azure.com/"}, wantErr: ErrInvalidCredentials},
+		{name: "expired", account: "app", claims: jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}, wantErr: ErrInvalidCredentials},
+		{name: "other tenant", account: "app", claims: jwt.MapClaims{"tid": otherTenant}, wantErr: ErrAzureTenantNotAllowed},
+		{name: "issuer of other tenant", account: "app", claims: jwt.MapClaims{"iss": "https://sts.windows.net/" + otherTenant + "/"}, wantErr: ErrInvalidCredentials},
+		{name: "not a managed identity", account: "app", claims: jwt.MapClaims{"xms_mirid": nil}, wantErr: ErrInvalidCredentials},
+		{name: "invalid resource ID", account: "app", claims: jwt.MapClaims{"xms_mirid": "nauts-app-worker"}, wantErr: ErrInvalidCredentials},
+		{name: "other subscription", account: "app", claims: jwt.MapClaims{"xms_mirid": testManagedIdentityID(otherTenant, "nauts-app-worker")}, wantErr: ErrAzureSubscriptionNotAllowed},
+		{name: "not a nauts identity", account: "app", claims: jwt.MapClaims{"xms_mirid": testManagedIdentityID(testAzureSubscription, "worker")}, wantErr: ErrInvalidManagedIdentityFormat},
+		{name: "account mismatch", account: "other", wantErr: ErrInvalidAccount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := ""
+			if tt.name != "missing token" {
+				token = signAzureToken(t, key, tt.claims)
+			}
+			user, err := p.Verify(ctx, AuthRequest{Account: tt.account, Token: token})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if len(user.Roles) != 1 || user.Roles[0] != (Role{Account: "app", Name: "worker"}) {
+				t.Errorf("user.Roles = %v", user.Roles)
+			}
+			if user.Attributes["azure_subscription"] != testAzureSubscription || user.Attributes["azure_resource_group"] != "rg-app" || user.Attributes["azure_identity"] != "nauts-app-worker" {
+				t.Errorf("user.Attributes = %v", user.Attributes)
+			}
+		})
+	}
+}
+
+func TestNewAzureAuthenticationProvider_Validation(t *testing.T) {
+	valid := AzureAuthenticationProviderConfig{TenantID: testAzureTenant, SubscriptionID: testAzureSubscription, Audience: "api://nauts"}
+	tests := []struct {
+		name   string
+		modify func(*AzureAuthenticationProviderConfig)
+	}{
+		{"missing tenant", func(c *AzureAuthenticationProviderConfig) { c.TenantID = "" }},
+		{"missing subscription", func(c *AzureAuthenticationProviderConfig) { c.SubscriptionID = "" }},
+		{"missing audience", func(c *AzureAuthenticationProviderConfig) { c.Audience = "" }},
+		{"wildcard subscription", func(c *AzureAuthenticationProviderConfig) { c.SubscriptionID = "*" }},
+		{"invalid tenant", func(c *AzureAuthenticationProviderConfig) { c.TenantID = "contoso.onmicrosoft.com" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid
+			tt.modify(&cfg)
+			if _, err := NewAzureAuthenticationProvider(cfg); err == nil {
+				t.Error("NewAzureAuthenticationProvider() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestRoleFromManagedIdentityName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Role
+		wantErr bool
+	}{
+		{"nauts-app-worker", Role{Account: "app", Name: "worker"}, false},
+		{"nauts-APP-read_only", Role{Account: "APP", Name: "read_only"}, false},
+		{"nauts-app", Role{}, true},
+		{"nauts-app-", Role{}, true},
+		{"app-worker", Role{}, true},
+	}
+	for _, tt := range tests {
+		got, err := roleFromManagedIdentityName(tt.name)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("roleFromManagedIdentityName(%q) = %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+}
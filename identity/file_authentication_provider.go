@@ -1,12 +1,19 @@
 package identity
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 
-	"golang.org/x/crypto/bcrypt"
+	"github.com/msimon/nauts/strictjson"
 )
 
 // usernamePassword is the identity token type for the file user provider.
@@ -21,6 +28,7 @@ type fileUser struct {
 	Roles        []string          `json:"roles"`
 	PasswordHash string            `json:"passwordHash"`
 	Attributes   map[string]string `json:"attributes,omitempty"`
+	Groups       []string          `json:"groups,omitempty"`
 }
 
 // usersFile represents the JSON file structure.
@@ -30,8 +38,12 @@ type usersFile struct {
 
 // FileAuthenticationProvider implements AuthenticationProvider using a JSON file.
 type FileAuthenticationProvider struct {
+	mu                 sync.RWMutex
 	users              map[string]*fileUser
+	usersPath          string
 	manageableAccounts []string
+	hasher             PasswordHasher
+	rehashOnLogin      bool
 }
 
 // FileAuthenticationProviderConfig holds configuration for FileAuthenticationProvider.
@@ -41,13 +53,24 @@ type FileAuthenticationProviderConfig struct {
 	// Accounts is the list of NATS accounts this provider can manage.
 	// Patterns support wildcards in the form of "*" (all) or "prefix*".
 	Accounts []string
+	// PasswordHashing configures the hashing algorithm and rehash-on-login behavior.
+	// Default: bcrypt with default cost, no rehashing.
+	PasswordHashing PasswordHashingConfig
 }
 
 // NewFileAuthenticationProvider creates a new FileAuthenticationProvider from the given configuration.
 func NewFileAuthenticationProvider(cfg FileAuthenticationProviderConfig) (*FileAuthenticationProvider, error) {
+	hasher, err := NewPasswordHasher(cfg.PasswordHashing)
+	if err != nil {
+		return nil, err
+	}
+
 	fp := &FileAuthenticationProvider{
 		users:              make(map[string]*fileUser),
+		usersPath:          cfg.UsersPath,
 		manageableAccounts: append([]string(nil), cfg.Accounts...),
+		hasher:             hasher,
+		rehashOnLogin:      cfg.PasswordHashing.RehashOnLogin,
 	}
 
 	if cfg.UsersPath != "" {
@@ -71,7 +94,7 @@ func (fp *FileAuthenticationProvider) loadUsers(path string) error {
 	}
 
 	var file usersFile
-	if err := json.Unmarshal(data, &file); err != nil {
+	if err := strictjson.Unmarshal(data, &file); err != nil {
 		return err
 	}
 
@@ -79,6 +102,170 @@ func (fp *FileAuthenticationProvider) loadUsers(path string) error {
 	return nil
 }
 
+// savePasswordHash atomically replaces the password hash of username in the
+// users file. Only that value is rewritten, so fields nauts does not model
+// and the formatting of the hand-maintained file are kept. The caller must
+// hold fp.mu.
+func (fp *FileAuthenticationProvider) savePasswordHash(username, hash string) error {
+	if fp.usersPath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(fp.usersPath)
+	if err != nil {
+		return err
+	}
+	start, end, err := passwordHashSpan(data, username)
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(hash)
+	if err != nil {
+		return err
+	}
+	patched := make([]byte, 0, len(data)-(end-start)+len(value))
+	patched = append(patched, data[:start]...)
+	patched = append(patched, value...)
+	patched = append(patched, data[end:]...)
+	return replaceUsersFile(fp.usersPath, patched)
+}
+
+// passwordHashSpan returns the byte range of the passwordHash string of
+// username in the users file data.
+func passwordHashSpan(data []byte, username string) (start, end int, err error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	path := []string{"users", username, "passwordHash"}
+	if err := expectDelim(dec, '{'); err != nil {
+		return 0, 0, err
+	}
+	for depth := 0; ; {
+		if !dec.More() {
+			return 0, 0, fmt.Errorf("user %s has no passwordHash in the users file", username)
+		}
+		tok, err := dec.Token()
+		if err != nil {
+			return 0, 0, err
+		}
+		if tok != path[depth] {
+			if err := skipValue(dec); err != nil {
+				return 0, 0, err
+			}
+			continue
+		}
+		if depth < len(path)-1 {
+			if err := expectDelim(dec, '{'); err != nil {
+				return 0, 0, err
+			}
+			depth++
+			continue
+		}
+		offset := int(dec.InputOffset())
+		tok, err = dec.Token()
+		if err != nil {
+			return 0, 0, err
+		}
+		if _, ok := tok.(string); !ok {
+			return 0, 0, fmt.Errorf("passwordHash of user %s is not a string", username)
+		}
+		end = int(dec.InputOffset())
+		return offset + bytes.IndexByte(data[offset:end], '"'), end, nil
+	}
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("unexpected %v in the users file, expected %v", tok, delim)
+	}
+	return nil
+}
+
+// skipValue consumes the next value of dec, including nested values.
+func skipValue(dec *json.Decoder) error {
+	for depth := 0; ; {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// writeUsersFile atomically replaces the users file at path with users,
+// keeping its permissions. A new file is only readable by its owner.
+func writeUsersFile(path string, users map[string]*fileUser) error {
+	data, err := json.MarshalIndent(usersFile{Users: users}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return replaceUsersFile(path, append(data, '\n'))
+}
+
+// replaceUsersFile atomically replaces the users file at path with data,
+// keeping its permissions. A new file is only readable by its owner.
+func replaceUsersFile(path string, data []byte) error {
+	mode := os.FileMode(0o600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".users-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// rehashPassword upgrades the stored hash of a user if it was produced with
+// outdated parameters. Failures are logged and do not affect authentication.
+func (fp *FileAuthenticationProvider) rehashPassword(username, password string) {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	fu, ok := fp.users[username]
+	if !ok || !fp.hasher.NeedsRehash(fu.PasswordHash) {
+		return
+	}
+
+	hash, err := fp.hasher.Hash(password)
+	if err != nil {
+		log.Printf("file authentication provider: rehashing password for %s: %v", username, err)
+		return
+	}
+
+	previous := fu.PasswordHash
+	fu.PasswordHash = hash
+	if err := fp.savePasswordHash(username, hash); err != nil {
+		fu.PasswordHash = previous
+		log.Printf("file authentication provider: persisting rehashed password for %s: %v", username, err)
+	}
+}
+
 // parseUsernamePassword parses a UsernamePassword token from basic auth format.
 func parseUsernamePassword(token string) (*usernamePassword, error) {
 	parts := strings.SplitN(token, ":", 2)
@@ -102,16 +289,24 @@ func (fp *FileAuthenticationProvider) Verify(_ context.Context, req AuthRequest)
 		return nil, ErrInvalidTokenType
 	}
 
+	fp.mu.RLock()
 	fu, ok := fp.users[creds.Username]
 	if !ok {
+		fp.mu.RUnlock()
 		return nil, ErrUserNotFound
 	}
+	passwordHash := fu.PasswordHash
+	fp.mu.RUnlock()
 
-	// Verify password with bcrypt
-	if err := bcrypt.CompareHashAndPassword([]byte(fu.PasswordHash), []byte(creds.Password)); err != nil {
+	// Verify password with the algorithm that produced the stored hash
+	if err := verifyPasswordHash(fp.hasher, passwordHash, creds.Password); err != nil {
 		return nil, ErrInvalidCredentials
 	}
 
+	if fp.rehashOnLogin && fp.hasher.NeedsRehash(passwordHash) {
+		fp.rehashPassword(creds.Username, creds.Password)
+	}
+
 	// Validate requested account is in user's accounts list
 	if !contains(fu.Accounts, req.Account) {
 		return nil, ErrInvalidAccount
@@ -129,10 +324,20 @@ func (fp *FileAuthenticationProvider) Verify(_ context.Context, req AuthRequest)
 		roles = append(roles, role)
 	}
 
+	// Copy attributes so callers cannot modify the loaded user.
+	var attributes map[string]string
+	if len(fu.Attributes) > 0 {
+		attributes = make(map[string]string, len(fu.Attributes))
+		for k, v := range fu.Attributes {
+			attributes[k] = v
+		}
+	}
+
 	return &User{
 		ID:         creds.Username,
 		Roles:      roles,
-		Attributes: fu.Attributes,
+		Attributes: attributes,
+		Groups:     slices.Clone(fu.Groups),
 	}, nil
 }
 
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"golang.org/x/crypto/bcrypt"
@@ -204,3 +205,132 @@ func createTestProvider(t *testing.T) *FileAuthenticationProvider {
 
 	return fp
 }
+
+func TestVerify_RehashOnLogin(t *testing.T) {
+	tmpDir := t.TempDir()
+	usersFile := filepath.Join(tmpDir, "users.json")
+
+	oldHash, _ := bcrypt.GenerateFromPassword([]byte("secret123"), bcrypt.MinCost)
+	content := `{"users": {"alice": {"accounts": ["ACME"], "roles": ["ACME.workers"], "passwordHash": "` + string(oldHash) + `"}}}`
+	if err := os.WriteFile(usersFile, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	fp, err := NewFileAuthenticationProvider(FileAuthenticationProviderConfig{
+		UsersPath: usersFile,
+		PasswordHashing: PasswordHashingConfig{
+			Cost:          bcrypt.MinCost + 1,
+			RehashOnLogin: true,
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewFileAuthenticationProvider() error = %v", err)
+	}
+
+	if _, err := fp.Verify(context.Background(), AuthRequest{Account: "ACME", Token: "alice:secret123"}); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	// The users file must now contain a hash with the configured cost.
+	reloaded, err := NewFileAuthenticationProvider(FileAuthenticationProviderConfig{UsersPath: usersFile})
+	if err != nil {
+		t.Fatalf("reloading users file: %v", err)
+	}
+	cost, err := bcrypt.Cost([]byte(reloaded.users["alice"].PasswordHash))
+	if err != nil {
+		t.Fatalf("bcrypt.Cost() error = %v", err)
+	}
+	if cost != bcrypt.MinCost+1 {
+		t.Errorf("persisted cost = %d, want %d", cost, bcrypt.MinCost+1)
+	}
+	if len(reloaded.users["alice"].Roles) != 1 {
+		t.Errorf("persisted roles = %v, want [ACME.workers]", reloaded.users["alice"].Roles)
+	}
+
+	// The rehashed password must still verify.
+	if _, err := fp.Verify(context.Background(), AuthRequest{Account: "ACME", Token: "alice:secret123"}); err != nil {
+		t.Errorf("Verify() after rehash error = %v", err)
+	}
+}
+
+func TestVerify_RehashKeepsUnknownFields(t *testing.T) {
+	tmpDir := t.TempDir()
+	usersFile := filepath.Join(tmpDir, "users.json")
+
+	oldHash, _ := bcrypt.GenerateFromPassword([]byte("secret123"), bcrypt.MinCost)
+	otherHash, _ := bcrypt.GenerateFromPassword([]byte("other"), bcrypt.MinCost)
+	content := `{
+  "comment": "maintained by the platform team",
+  "users": {
+    "bob": {"accounts": ["ACME"], "roles": [], "passwordHash": "` + string(otherHash) + `"},
+    "alice": {
+      "email": "alice@example.com",
+      "passwordHash": "` + string(oldHash) + `",
+      "accounts": ["ACME"],
+      "roles": ["ACME.workers"],
+      "ticket": {"id": 42}
+    }
+  }
+}
+`
+	if err := os.WriteFile(usersFile, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	fp, err := NewFileAuthenticationProvider(FileAuthenticationProviderConfig{
+		UsersPath: usersFile,
+		PasswordHashing: PasswordHashingConfig{
+			Cost:          bcrypt.MinCost + 1,
+			RehashOnLogin: true,
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewFileAuthenticationProvider() error = %v", err)
+	}
+	if _, err := fp.Verify(context.Background(), AuthRequest{Account: "ACME", Token: "alice:secret123"}); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	data, err := os.ReadFile(usersFile)
+	if err != nil {
+		t.Fatalf("reading users file: %v", err)
+	}
+	newHash := fp.users["alice"].PasswordHash
+	if newHash == string(oldHash) {
+		t.Fatal("password was not rehashed")
+	}
+	if want := strings.Replace(content, string(oldHash), newHash, 1); string(data) != want {
+		t.Errorf("users file =\n%s\nwant only the hash of alice replaced:\n%s", data, want)
+	}
+}
+
+func TestVerify_NoRehashWhenDisabled(t *testing.T) {
+	tmpDir := t.TempDir()
+	usersFile := filepath.Join(tmpDir, "users.json")
+
+	oldHash, _ := bcrypt.GenerateFromPassword([]byte("secret123"), bcrypt.MinCost)
+	content := `{"users": {"alice": {"accounts": ["ACME"], "roles": ["ACME.workers"], "passwordHash": "` + string(oldHash) + `"}}}`
+	if err := os.WriteFile(usersFile, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	fp, err := NewFileAuthenticationProvider(FileAuthenticationProviderConfig{
+		UsersPath:       usersFile,
+		PasswordHashing: PasswordHashingConfig{Cost: bcrypt.MinCost + 1},
+	})
+	if err != nil {
+		t.Fatalf("NewFileAuthenticationProvider() error = %v", err)
+	}
+
+	if _, err := fp.Verify(context.Background(), AuthRequest{Account: "ACME", Token: "alice:secret123"}); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	data, err := os.ReadFile(usersFile)
+	if err != nil {
+		t.Fatalf("reading users file: %v", err)
+	}
+	if string(data) != content {
+		t.Error("users file was modified although rehashOnLogin is disabled")
+	}
+}
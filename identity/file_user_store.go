@@ -0,0 +1,181 @@
+package identity
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/msimon/nauts/strictjson"
+)
+
+// ErrUserExists is returned when adding a user that already exists.
+var ErrUserExists = errors.New("user already exists")
+
+// FileUser is a user of the users file of FileAuthenticationProvider, as
+// listed and added by FileUserStore.
+type FileUser struct {
+	Username   string            `json:"username"`
+	Accounts   []string          `json:"accounts"`
+	Roles      []string          `json:"roles"`
+	Groups     []string          `json:"groups,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+
+	// Algorithm is the algorithm of the stored password hash, or "" if it is
+	// not recognized. It is ignored by Add.
+	Algorithm string `json:"algorithm,omitempty"`
+
+	// PasswordHash is the stored password hash, set by List. It is not
+	// encoded, so listings do not reveal hashes.
+	PasswordHash string `json:"-"`
+}
+
+// FileUserStore manages the users file of a FileAuthenticationProvider.
+// Every call reads the file and atomically replaces it after a change; a
+// running provider picks changes up when it is reloaded.
+type FileUserStore struct {
+	path   string
+	hasher PasswordHasher
+}
+
+// NewFileUserStore returns a store for the users file at path, hashing new
+// passwords as configured by hashing. The file is created by the first Add.
+func NewFileUserStore(path string, hashing PasswordHashingConfig) (*FileUserStore, error) {
+	if path == "" {
+		return nil, errors.New("users path is required")
+	}
+	hasher, err := NewPasswordHasher(hashing)
+	if err != nil {
+		return nil, err
+	}
+	return &FileUserStore{path: path, hasher: hasher}, nil
+}
+
+// List returns the users sorted by username.
+func (s *FileUserStore) List() ([]FileUser, error) {
+	users, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]FileUser, 0, len(users))
+	for _, username := range slices.Sorted(maps.Keys(users)) {
+		fu := users[username]
+		result = append(result, FileUser{
+			Username:     username,
+			Accounts:     fu.Accounts,
+			Roles:        fu.Roles,
+			Groups:       fu.Groups,
+			Attributes:   fu.Attributes,
+			Algorithm:    hashAlgorithm(fu.PasswordHash),
+			PasswordHash: fu.PasswordHash,
+		})
+	}
+	return result, nil
+}
+
+// Add adds a user with the given password. Returns ErrUserExists if the
+// username is taken. The username must not contain ":", which separates it
+// from the password in tokens, and roles must be role IDs
+// ("<account>.<role>").
+func (s *FileUserStore) Add(user FileUser, password string) error {
+	if strings.TrimSpace(user.Username) == "" || strings.Contains(user.Username, ":") {
+		return fmt.Errorf("invalid username %q: must not be empty or contain ':'", user.Username)
+	}
+	if len(user.Accounts) == 0 {
+		return errors.New("at least one account is required")
+	}
+	for _, roleID := range user.Roles {
+		if _, err := ParseRoleID(roleID); err != nil {
+			return fmt.Errorf("role %q: %w", roleID, err)
+		}
+	}
+	if password == "" {
+		return errors.New("password must not be empty")
+	}
+
+	users, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := users[user.Username]; ok {
+		return fmt.Errorf("%w: %s", ErrUserExists, user.Username)
+	}
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return fmt.Errorf("hashing password: %w", err)
+	}
+	users[user.Username] = &fileUser{
+		Accounts:     slices.Clone(user.Accounts),
+		Roles:        slices.Clone(user.Roles),
+		PasswordHash: hash,
+		Attributes:   maps.Clone(user.Attributes),
+		Groups:       slices.Clone(user.Groups),
+	}
+	return writeUsersFile(s.path, users)
+}
+
+// Remove removes a user. Returns ErrUserNotFound if it does not exist.
+func (s *FileUserStore) Remove(username string) error {
+	users, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := users[username]; !ok {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, username)
+	}
+	delete(users, username)
+	return writeUsersFile(s.path, users)
+}
+
+// SetPassword replaces the password of a user, hashed with the configured
+// algorithm. Returns ErrUserNotFound if the user does not exist.
+func (s *FileUserStore) SetPassword(username, password string) error {
+	if password == "" {
+		return errors.New("password must not be empty")
+	}
+	users, err := s.load()
+	if err != nil {
+		return err
+	}
+	fu, ok := users[username]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, username)
+	}
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return fmt.Errorf("hashing password: %w", err)
+	}
+	fu.PasswordHash = hash
+	return writeUsersFile(s.path, users)
+}
+
+// load reads the users file. A missing file has no users.
+func (s *FileUserStore) load() (map[string]*fileUser, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]*fileUser{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file usersFile
+	if err := strictjson.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", s.path, err)
+	}
+	if file.Users == nil {
+		file.Users = map[string]*fileUser{}
+	}
+	return file.Users, nil
+}
+
+// hashAlgorithm returns the algorithm that produced hash, or "".
+func hashAlgorithm(hash string) string {
+	for _, algorithm := range slices.Sorted(maps.Keys(passwordHasherFactories)) {
+		if h, err := passwordHasherFactories[algorithm](0); err == nil && h.Identifies(hash) {
+			return algorithm
+		}
+	}
+	return ""
+}
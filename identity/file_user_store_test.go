@@ -0,0 +1,135 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestFileUserStore(t *testing.T, hashing PasswordHashingConfig) (*FileUserStore, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "users.json")
+	store, err := NewFileUserStore(path, hashing)
+	if err != nil {
+		t.Fatalf("NewFileUserStore() error = %v", err)
+	}
+	return store, path
+}
+
+func TestFileUserStore_AddAndVerify(t *testing.T) {
+	for _, hashing := range []PasswordHashingConfig{
+		{Algorithm: PasswordAlgorithmBcrypt, Cost: 4},
+		{Algorithm: PasswordAlgorithmArgon2id, Cost: 1},
+	} {
+		algorithm := hashing.Algorithm
+		t.Run(algorithm, func(t *testing.T) {
+			store, path := newTestFileUserStore(t, hashing)
+
+			user := FileUser{Username: "alice", Accounts: []string{"ACME"}, Roles: []string{"ACME.workers"}, Groups: []string{"dev"}}
+			if err := store.Add(user, "secret123"); err != nil {
+				t.Fatalf("Add() error = %v", err)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("stat users file: %v", err)
+			}
+			if info.Mode().Perm() != 0600 {
+				t.Errorf("users file mode = %v, want 0600", info.Mode().Perm())
+			}
+
+			fp, err := NewFileAuthenticationProvider(FileAuthenticationProviderConfig{UsersPath: path})
+			if err != nil {
+				t.Fatalf("NewFileAuthenticationProvider() error = %v", err)
+			}
+			got, err := fp.Verify(context.Background(), AuthRequest{Account: "ACME", Token: "alice:secret123"})
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if got.ID != "alice" || len(got.Roles) != 1 || got.Roles[0].Name != "workers" {
+				t.Errorf("Verify() user = %+v", got)
+			}
+
+			users, err := store.List()
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			if len(users) != 1 || users[0].Username != "alice" || users[0].Algorithm != algorithm {
+				t.Errorf("List() = %+v, want alice hashed with %s", users, algorithm)
+			}
+		})
+	}
+}
+
+func TestFileUserStore_AddInvalid(t *testing.T) {
+	store, _ := newTestFileUserStore(t, PasswordHashingConfig{Cost: 4})
+	if err := store.Add(FileUser{Username: "alice", Accounts: []string{"ACME"}}, "secret"); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		user     FileUser
+		password string
+	}{
+		{"empty username", FileUser{Accounts: []string{"ACME"}}, "secret"},
+		{"colon in username", FileUser{Username: "a:b", Accounts: []string{"ACME"}}, "secret"},
+		{"no account", FileUser{Username: "bob"}, "secret"},
+		{"invalid role", FileUser{Username: "bob", Accounts: []string{"ACME"}, Roles: []string{"workers"}}, "secret"},
+		{"empty password", FileUser{Username: "bob", Accounts: []string{"ACME"}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := store.Add(tt.user, tt.password); err == nil {
+				t.Error("Add() expected error")
+			}
+		})
+	}
+
+	err := store.Add(FileUser{Username: "alice", Accounts: []string{"ACME"}}, "other")
+	if !errors.Is(err, ErrUserExists) {
+		t.Errorf("Add() error = %v, want %v", err, ErrUserExists)
+	}
+}
+
+func TestFileUserStore_SetPasswordAndRemove(t *testing.T) {
+	store, path := newTestFileUserStore(t, PasswordHashingConfig{Cost: 4})
+	for _, name := range []string{"bob", "alice"} {
+		if err := store.Add(FileUser{Username: name, Accounts: []string{"ACME"}}, "old"); err != nil {
+			t.Fatalf("Add(%s) error = %v", name, err)
+		}
+	}
+
+	if err := store.SetPassword("alice", "new"); err != nil {
+		t.Fatalf("SetPassword() error = %v", err)
+	}
+	fp, err := NewFileAuthenticationProvider(FileAuthenticationProviderConfig{UsersPath: path})
+	if err != nil {
+		t.Fatalf("NewFileAuthenticationProvider() error = %v", err)
+	}
+	if _, err := fp.Verify(context.Background(), AuthRequest{Account: "ACME", Token: "alice:new"}); err != nil {
+		t.Errorf("Verify() with new password error = %v", err)
+	}
+	if _, err := fp.Verify(context.Background(), AuthRequest{Account: "ACME", Token: "alice:old"}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Verify() with old password error = %v, want %v", err, ErrInvalidCredentials)
+	}
+
+	if err := store.Remove("bob"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	users, err := store.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(users) != 1 || users[0].Username != "alice" {
+		t.Errorf("List() = %+v, want only alice", users)
+	}
+
+	if err := store.Remove("bob"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Remove() error = %v, want %v", err, ErrUserNotFound)
+	}
+	if err := store.SetPassword("bob", "x"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("SetPassword() error = %v, want %v", err, ErrUserNotFound)
+	}
+}
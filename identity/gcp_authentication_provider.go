@@ -0,0 +1,255 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DefaultGcpJWKSURL is the key set Google signs identity tokens with.
+	DefaultGcpJWKSURL = "https://www.googleapis.com/oauth2/v3/certs"
+	// DefaultGcpAudience is the audience identity tokens must be issued for.
+	DefaultGcpAudience = "nauts"
+
+	// gcpIssuer is the issuer of Google identity tokens. Some tokens omit the scheme.
+	gcpIssuer = "https://accounts.google.com"
+	// gcpServiceAccountDomain is the email domain of user-managed service
+	// accounts: <name>@<project>.iam.gserviceaccount.com.
+	gcpServiceAccountDomain = ".iam.gserviceaccount.com"
+	// gcpServiceAccountPrefix prefixes service account names that map to nauts roles.
+	gcpServiceAccountPrefix = "nauts-"
+)
+
+var (
+	// ErrGCPProjectNotAllowed is returned when the service account or instance
+	// belongs to another GCP project than the configured one.
+	ErrGCPProjectNotAllowed = errors.New("gcp project not allowed")
+
+	// ErrInvalidServiceAccountFormat is returned when the service account
+	// email doesn't follow the nauts-<account>-<role>@<project>.iam.gserviceaccount.com pattern.
+	ErrInvalidServiceAccountFormat = errors.New("invalid gcp service account format: expected nauts-<account>-<role>@<project>.iam.gserviceaccount.com")
+
+	// gcpProjectIDRegex validates GCP project IDs.
+	gcpProjectIDRegex = regexp.MustCompile(`^[a-z][a-z0-9-]{4,28}[a-z0-9]$`)
+)
+
+// GcpAuthenticationProviderConfig holds configuration for GcpAuthenticationProvider.
+type GcpAuthenticationProviderConfig struct {
+	// Accounts is the list of NATS account patterns this provider manages.
+	// Patterns support wildcards in the form of "*" (all) or "prefix*".
+	Accounts []string `json:"accounts"`
+
+	// Project is the GCP project ID whose service accounts may authenticate.
+	// REQUIRED: Wildcards are NOT allowed.
+	Project string `json:"project"`
+
+	// Audience is the audience identity tokens must be issued for (default: "nauts").
+	Audience string `json:"audience,omitempty"`
+
+	// JWKSURL is the URL of Google's JSON Web Key Set (default: DefaultGcpJWKSURL).
+	JWKSURL string `json:"jwksUrl,omitempty"`
+	// JWKSRefreshInterval is how often JWKS keys are refreshed (default: 1h).
+	JWKSRefreshInterval time.Duration `json:"jwksRefreshInterval,omitempty"`
+
+	// HTTPClient fetches the JWKS (default: 10s timeout).
+	HTTPClient *http.Client `json:"-"`
+}
+
+// GcpAuthenticationProvider implements AuthenticationProvider using Google-signed
+// identity tokens: service account ID tokens and Compute Engine instance
+// identity tokens.
+//
+// Service account names must follow the convention nauts-<account>-<role>
+// (e.g., nauts-app-worker@my-project.iam.gserviceaccount.com). The provider
+// extracts the NATS account and role from the service account email.
+type GcpAuthenticationProvider struct {
+	project            string
+	audience           string
+	keys               *jwksKeySet
+	manageableAccounts []string
+}
+
+// gcpIdentity is the identity asserted by a verified token.
+type gcpIdentity struct {
+	Email   string
+	Subject string
+	Project string
+	// Compute Engine instance identity, empty for service account ID tokens.
+	InstanceID   string
+	InstanceName string
+	Zone         string
+}
+
+// NewGcpAuthenticationProvider creates a new GcpAuthenticationProvider.
+// Signing keys are fetched in the background; call Stop to end the refresh.
+func NewGcpAuthenticationProvider(cfg GcpAuthenticationProviderConfig) (*GcpAuthenticationProvider, error) {
+	// Validate project is provided (REQUIRED)
+	if cfg.Project == "" {
+		return nil, errors.New("project is required")
+	}
+
+	// Validate no wildcards in project
+	if strings.Contains(cfg.Project, "*") {
+		return nil, fmt.Errorf("project must not contain wildcards: %s", cfg.Project)
+	}
+
+	// Validate project format
+	if !gcpProjectIDRegex.MatchString(cfg.Project) {
+		return nil, fmt.Errorf("invalid gcp project ID format: %s", cfg.Project)
+	}
+
+	audience := cfg.Audience
+	if audience == "" {
+		audience = DefaultGcpAudience
+	}
+	jwksURL := cfg.JWKSURL
+	if jwksURL == "" {
+		jwksURL = DefaultGcpJWKSURL
+	}
+
+	p := &GcpAuthenticationProvider{
+		project:            cfg.Project,
+		audience:           audience,
+		keys:               newJWKSKeySet(gcpIssuer, jwksURL, cfg.HTTPClient, cfg.JWKSRefreshInterval),
+		manageableAccounts: append([]string(nil), cfg.Accounts...),
+	}
+	p.keys.start()
+	return p, nil
+}
+
+// Stop stops the background JWKS refresh.
+func (p *GcpAuthenticationProvider) Stop() error {
+	p.keys.Stop()
+	return nil
+}
+
+// ManageableAccounts returns the list of account patterns this provider can manage.
+func (p *GcpAuthenticationProvider) ManageableAccounts() []string {
+	return append([]string(nil), p.manageableAccounts...)
+}
+
+// Verify validates the identity token and returns the user.
+func (p *GcpAuthenticationProvider) Verify(ctx context.Context, req AuthRequest) (*User, error) {
+	if req.Token == "" {
+		return nil, fmt.Errorf("%w: missing identity token", ErrInvalidCredentials)
+	}
+
+	// 1. Verify the token signature, issuer, audience, and expiry
+	id, err := p.verifyToken(ctx, req.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Validate the GCP project matches the configured project
+	if id.Project != p.project {
+		return nil, fmt.Errorf("%w: expected %s, got %s", ErrGCPProjectNotAllowed, p.project, id.Project)
+	}
+
+	// 3. Validate and extract role from the service account name
+	role, err := roleFromGcpServiceAccount(id.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	// 4. Validate AuthRequest.Account matches extracted account
+	if req.Account != role.Account {
+		return nil, fmt.Errorf("%w: requested %s but service account specifies %s",
+			ErrInvalidAccount, req.Account, role.Account)
+	}
+
+	// 5. Construct User
+	attributes := map[string]string{
+		"gcp_project":         id.Project,
+		"gcp_service_account": id.Email,
+	}
+	if id.Subject != "" {
+		attributes["gcp_subject"] = id.Subject
+	}
+	if id.InstanceID != "" {
+		attributes["gcp_instance_id"] = id.InstanceID
+		attributes["gcp_instance_name"] = id.InstanceName
+		attributes["gcp_zone"] = id.Zone
+	}
+	return &User{
+		ID:         id.Email,
+		Roles:      []Role{role},
+		Attributes: attributes,
+	}, nil
+}
+
+// verifyToken verifies a Google identity token and extracts the identity.
+func (p *GcpAuthenticationProvider) verifyToken(ctx context.Context, tokenString string) (*gcpIdentity, error) {
+	token, err := verifyJWT(ctx, tokenString, nil, p.keys,
+		jwt.WithAudience(p.audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidTokenType
+	}
+
+	iss, _ := claims["iss"].(string)
+	if iss != gcpIssuer && "https://"+iss != gcpIssuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidCredentials, iss)
+	}
+	email, _ := claims["email"].(string)
+	if email == "" {
+		return nil, fmt.Errorf("%w: token has no email claim (request it with format=full or includeEmail)", ErrInvalidCredentials)
+	}
+	if verified, _ := claims["email_verified"].(bool); !verified {
+		return nil, fmt.Errorf("%w: email %s is not verified", ErrInvalidCredentials, email)
+	}
+
+	id := &gcpIdentity{Email: email}
+	id.Subject, _ = claims["sub"].(string)
+	name, domain, _ := strings.Cut(email, "@")
+	if project, ok := strings.CutSuffix(domain, gcpServiceAccountDomain); ok && name != "" {
+		id.Project = project
+	}
+
+	// Instance identity tokens (format=full) describe the VM, whose project
+	// must match the service account's.
+	if google, ok := claims["google"].(map[string]any); ok {
+		if gce, ok := google["compute_engine"].(map[string]any); ok {
+			project, _ := gce["project_id"].(string)
+			if project != id.Project {
+				return nil, fmt.Errorf("%w: instance project %s does not match service account %s", ErrGCPProjectNotAllowed, project, email)
+			}
+			id.InstanceID, _ = gce["instance_id"].(string)
+			id.InstanceName, _ = gce["instance_name"].(string)
+			id.Zone, _ = gce["zone"].(string)
+		}
+	}
+	return id, nil
+}
+
+// roleFromGcpServiceAccount parses service account emails of the form
+// nauts-<account>-<role>@<project>.iam.gserviceaccount.com. The account is
+// the first hyphen-separated segment; the role is the rest and may contain
+// hyphens.
+func roleFromGcpServiceAccount(email string) (Role, error) {
+	name, _, _ := strings.Cut(email, "@")
+	rest, ok := strings.CutPrefix(name, gcpServiceAccountPrefix)
+	if !ok {
+		return Role{}, fmt.Errorf("%w: %s", ErrInvalidServiceAccountFormat, email)
+	}
+	account, roleName, ok := strings.Cut(rest, "-")
+	if !ok || account == "" || roleName == "" {
+		return Role{}, fmt.Errorf("%w: %s", ErrInvalidServiceAccountFormat, email)
+	}
+	if !natsIdentifierRegex.MatchString(account) || !natsIdentifierRegex.MatchString(roleName) {
+		return Role{}, fmt.Errorf("%w: %s", ErrInvalidServiceAccountFormat, email)
+	}
+	return Role{Account: account, Name: roleName}, nil
+}
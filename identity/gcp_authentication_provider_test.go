@@ -0,0 +1,178 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func signGcpIdentityToken(t *testing.T, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	t.Helper()
+	base := jwt.MapClaims{
+		"iss":            "https://accounts.google.com",
+		"aud":            "nauts",
+		"sub":            "1234567890",
+		"email":          "nauts-app-worker@my-project.iam.gserviceaccount.com",
+		"email_verified": true,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range claims {
+		if v == nil {
+			delete(base, k)
+			continue
+		}
+		base[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, base)
+	token.Header["kid"] = "k1"
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return s
+}
+
+func newGcpTestProvider(t *testing.T) (*GcpAuthenticationProvider, *rsa.PrivateKey) {
+	t.Helper()
+	idp := newTestIdP(t)
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	idp.setKeys(http.StatusOK, rsaJWK("k1", &key.PublicKey))
+
+	p, err := NewGcpAuthenticationProvider(GcpAuthenticationProviderConfig{
+		Accounts: []string{"app"},
+		Project:  "my-project",
+		JWKSURL:  idp.URL + "/keys",
+	})
+	if err != nil {
+		t.Fatalf("NewGcpAuthenticationProvider() error = %v", err)
+	}
+	_ = p.Stop()
+	return p, key
+}
+
+func TestGcpAuthenticationProvider_Verify(t *testing.T) {
+	p, key := newGcpTestProvider(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		account string
+		claims  jwt.MapClaims
+		wantErr error
+	}{
+		{name: "service account token", account: "app"},
+		{name: "issuer without scheme", account: "app", claims: jwt.MapClaims{"iss": "accounts.google.com"}},
+		{name: "role with hyphens", account: "app", claims: jwt.MapClaims{"email": "nauts-app-read-only@my-project.iam.gserviceaccount.com"}},
+		{name: "missing token", account: "app", wantErr: ErrInvalidCredentials},
+		{name: "wrong audience", account: "app", claims: jwt.MapClaims{"aud": "https://example.com"}, wantErr: ErrInvalidCredentials},
+		{name: "wrong issuer", account: "app", claims: jwt.MapClaims{"iss": "https://other.example.com"}, wantErr: ErrInvalidCredentials},
+		{name: "expired", account: "app", claims: jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}, wantErr: ErrInvalidCredentials},
+		{name: "no email", account: "app", claims: jwt.MapClaims{"email": nil}, wantErr: ErrInvalidCredentials},
+		{name: "unverified email", account: "app", claims: jwt.MapClaims{"email_verified": false}, wantErr: ErrInvalidCredentials},
+		{name: "other project", account: "app", claims: jwt.MapClaims{"email": "nauts-app-worker@other-project.iam.gserviceaccount.com"}, wantErr: ErrGCPProjectNotAllowed},
+		{name: "user account", account: "app", claims: jwt.MapClaims{"email": "alice@example.com"}, wantErr: ErrGCPProjectNotAllowed},
+		{name: "not a nauts service account", account: "app", claims: jwt.MapClaims{"email": "worker@my-project.iam.gserviceaccount.com"}, wantErr: ErrInvalidServiceAccountFormat},
+		{name: "missing role", account: "app", claims: jwt.MapClaims{"email": "nauts-app@my-project.iam.gserviceaccount.com"}, wantErr: ErrInvalidServiceAccountFormat},
+		{name: "account mismatch", account: "other", wantErr: ErrInvalidAccount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := ""
+			if tt.name != "missing token" {
+				token = signGcpIdentityToken(t, key, tt.claims)
+			}
+			user, err := p.Verify(ctx, AuthRequest{Account: tt.account, Token: token})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if user.ID == "" || len(user.Roles) != 1 || user.Roles[0].Account != "app" {
+				t.Errorf("Verify() = %+v", user)
+			}
+			if user.Attributes["gcp_project"] != "my-project" || user.Attributes["gcp_subject"] != "1234567890" {
+				t.Errorf("user.Attributes = %v", user.Attributes)
+			}
+		})
+	}
+}
+
+func TestGcpAuthenticationProvider_InstanceIdentity(t *testing.T) {
+	p, key := newGcpTestProvider(t)
+	ctx := context.Background()
+
+	instance := func(project string) jwt.MapClaims {
+		return jwt.MapClaims{"google": map[string]any{"compute_engine": map[string]any{
+			"project_id":    project,
+			"instance_id":   "42",
+			"instance_name": "worker-0",
+			"zone":          "europe-west1-b",
+		}}}
+	}
+
+	user, err := p.Verify(ctx, AuthRequest{Account: "app", Token: signGcpIdentityToken(t, key, instance("my-project"))})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if user.Roles[0] != (Role{Account: "app", Name: "worker"}) {
+		t.Errorf("user.Roles = %v", user.Roles)
+	}
+	if user.Attributes["gcp_instance_name"] != "worker-0" || user.Attributes["gcp_zone"] != "europe-west1-b" {
+		t.Errorf("user.Attributes = %v", user.Attributes)
+	}
+
+	// A service account of the allowed project attached to a VM in another project.
+	if _, err := p.Verify(ctx, AuthRequest{Account: "app", Token: signGcpIdentityToken(t, key, instance("other-project"))}); !errors.Is(err, ErrGCPProjectNotAllowed) {
+		t.Errorf("Verify() error = %v, want ErrGCPProjectNotAllowed", err)
+	}
+}
+
+func TestNewGcpAuthenticationProvider_Validation(t *testing.T) {
+	tests := []struct {
+		name    string
+		project string
+	}{
+		{"missing project", ""},
+		{"wildcard project", "my-*"},
+		{"invalid project", "My_Project"},
+		{"short project", "abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewGcpAuthenticationProvider(GcpAuthenticationProviderConfig{Project: tt.project}); err == nil {
+				t.Error("NewGcpAuthenticationProvider() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestRoleFromGcpServiceAccount(t *testing.T) {
+	tests := []struct {
+		email   string
+		want    Role
+		wantErr bool
+	}{
+		{"nauts-app-worker@p.iam.gserviceaccount.com", Role{Account: "app", Name: "worker"}, false},
+		{"nauts-APP-read-only@p.iam.gserviceaccount.com", Role{Account: "APP", Name: "read-only"}, false},
+		{"nauts-app@p.iam.gserviceaccount.com", Role{}, true},
+		{"nauts--worker@p.iam.gserviceaccount.com", Role{}, true},
+		{"other-app-worker@p.iam.gserviceaccount.com", Role{}, true},
+	}
+	for _, tt := range tests {
+		got, err := roleFromGcpServiceAccount(tt.email)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("roleFromGcpServiceAccount(%q) = %v, %v, want %v", tt.email, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+// Package identitytest provides a conformance test suite for
+// identity.AuthenticationProvider implementations.
+//
+// Providers built outside nauts can run the suite from their own tests to
+// check that they follow the contract the AuthController relies on:
+//
+//	func TestConformance(t *testing.T) {
+//		p := newMyProvider(t)
+//		identitytest.RunProviderTests(t, p,
+//			identitytest.WithValidRequest(identity.AuthRequest{Account: "APP", Token: validToken}),
+//			identitytest.WithRejectedRequest(identity.AuthRequest{Account: "APP", Token: expiredToken}, identity.ErrInvalidCredentials),
+//		)
+//	}
+package identitytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/msimon/nauts/identity"
+)
+
+// ContractErrors are the sentinel errors an AuthenticationProvider may return
+// for a rejected request. Providers may wrap them and add detail, but
+// errors.Is must match one of them so the AuthController can tell bad
+// credentials from outages.
+var ContractErrors = []error{
+	identity.ErrInvalidCredentials,
+	identity.ErrUserNotFound,
+	identity.ErrInvalidTokenType,
+	identity.ErrInvalidAccount,
+	identity.ErrProviderUnavailable,
+}
+
+// concurrentVerifies is the number of parallel Verify calls per valid request.
+const concurrentVerifies = 8
+
+// Option configures RunProviderTests.
+type Option func(*suite)
+
+type rejectedRequest struct {
+	req     identity.AuthRequest
+	wantErr error
+}
+
+type suite struct {
+	valid    []identity.AuthRequest
+	rejected []rejectedRequest
+}
+
+// WithValidRequest adds a request the provider must accept. Without valid
+// requests, only the rejection paths of the contract are exercised.
+func WithValidRequest(req identity.AuthRequest) Option {
+	return func(s *suite) {
+		s.valid = append(s.valid, req)
+	}
+}
+
+// WithRejectedRequest adds a request the provider must reject with an error
+// matching wantErr (errors.Is), e.g. an expired token with
+// identity.ErrInvalidCredentials.
+func WithRejectedRequest(req identity.AuthRequest, wantErr error) Option {
+	return func(s *suite) {
+		s.rejected = append(s.rejected, rejectedRequest{req: req, wantErr: wantErr})
+	}
+}
+
+// RunProviderTests runs the conformance suite against p as subtests of t:
+//
+//   - ManageableAccounts returns stable, well-formed patterns ("*", "prefix*"
+//     or literal account names).
+//   - Malformed tokens are rejected with a nil user and an error matching one
+//     of ContractErrors.
+//   - Valid requests target a manageable account and yield a user with an ID,
+//     well-formed roles and attributes. Verify is deterministic, safe for
+//     concurrent use, and returns users the caller may modify without
+//     affecting later results.
+//   - Rejected requests fail with the expected error and a nil user.
+func RunProviderTests(t *testing.T, p identity.AuthenticationProvider, opts ...Option) {
+	t.Helper()
+
+	s := &suite{}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	t.Run("ManageableAccounts", func(t *testing.T) {
+		testManageableAccounts(t, p)
+	})
+	t.Run("MalformedTokens", func(t *testing.T) {
+		testMalformedTokens(t, p)
+	})
+	for i, req := range s.valid {
+		t.Run("Valid/"+requestName(i, req), func(t *testing.T) {
+			testValidRequest(t, p, req)
+		})
+	}
+	for i, r := range s.rejected {
+		t.Run("Rejected/"+requestName(i, r.req), func(t *testing.T) {
+			testRejectedRequest(t, p, r)
+		})
+	}
+}
+
+func testManageableAccounts(t *testing.T, p identity.AuthenticationProvider) {
+	patterns := p.ManageableAccounts()
+	if len(patterns) == 0 {
+		t.Fatal("ManageableAccounts() returned no patterns; the provider can never be selected")
+	}
+	for _, pattern := range patterns {
+		if pattern == "" {
+			t.Error("ManageableAccounts() contains an empty pattern")
+			continue
+		}
+		if i := strings.Index(pattern, "*"); i >= 0 && i != len(pattern)-1 {
+			t.Errorf("pattern %q: \"*\" is only supported as the last character", pattern)
+		}
+	}
+	if again := p.ManageableAccounts(); !reflect.DeepEqual(patterns, again) {
+		t.Errorf("ManageableAccounts() is not stable: %v, then %v", patterns, again)
+	}
+}
+
+func testMalformedTokens(t *testing.T, p identity.AuthenticationProvider) {
+	account := probeAccount(p.ManageableAccounts())
+	tokens := map[string]string{
+		"empty":   "",
+		"garbage": "not a token",
+		"json":    `{"token":"x"}`,
+	}
+	for name, token := range tokens {
+		t.Run(name, func(t *testing.T) {
+			user, err := p.Verify(context.Background(), identity.AuthRequest{Account: account, Token: token})
+			if err == nil {
+				t.Fatalf("Verify() accepted a malformed token: %+v", user)
+			}
+			if user != nil {
+				t.Errorf("Verify() returned user %+v together with error %v", user, err)
+			}
+			if !isContractError(err) {
+				t.Errorf("Verify() error %q does not match any of ContractErrors", err)
+			}
+		})
+	}
+}
+
+func testValidRequest(t *testing.T, p identity.AuthenticationProvider, req identity.AuthRequest) {
+	if !identity.MatchesAccount(p.ManageableAccounts(), req.Account) {
+		t.Fatalf("account %q is not matched by ManageableAccounts() %v", req.Account, p.ManageableAccounts())
+	}
+
+	user, err := p.Verify(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if user == nil {
+		t.Fatal("Verify() returned a nil user without error")
+	}
+	if user.ID == "" {
+		t.Error("user ID is empty")
+	}
+	for _, role := range user.Roles {
+		parsed, err := identity.ParseRoleID(role.String())
+		if err != nil || parsed != role {
+			t.Errorf("role %+v is not a well-formed <account>.<role>", role)
+		}
+	}
+	for k := range user.Attributes {
+		if k == "" {
+			t.Error("attributes contain an empty key")
+		}
+	}
+
+	want := cloneUser(user)
+
+	// The caller owns the returned user.
+	for k := range user.Attributes {
+		user.Attributes[k] = "modified"
+	}
+	if user.Attributes != nil {
+		user.Attributes["identitytest-added"] = "x"
+	}
+	for i := range user.Roles {
+		user.Roles[i].Name = "modified"
+	}
+
+	again, err := p.Verify(context.Background(), req)
+	if err != nil {
+		t.Fatalf("second Verify() error = %v", err)
+	}
+	if !reflect.DeepEqual(again, want) {
+		t.Errorf("second Verify() = %+v, want %+v (results must not share state with earlier users)", again, want)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, concurrentVerifies)
+	for i := 0; i < concurrentVerifies; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := p.Verify(context.Background(), req); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent Verify() error = %v", err)
+	}
+}
+
+func testRejectedRequest(t *testing.T, p identity.AuthenticationProvider, r rejectedRequest) {
+	user, err := p.Verify(context.Background(), r.req)
+	if err == nil {
+		t.Fatalf("Verify() accepted the request: %+v", user)
+	}
+	if user != nil {
+		t.Errorf("Verify() returned user %+v together with error %v", user, err)
+	}
+	if !errors.Is(err, r.wantErr) {
+		t.Errorf("Verify() error = %v, want %v", err, r.wantErr)
+	}
+}
+
+// probeAccount returns an account matched by the first pattern.
+func probeAccount(patterns []string) string {
+	if len(patterns) == 0 {
+		return "identitytest"
+	}
+	if prefix, ok := strings.CutSuffix(patterns[0], "*"); ok {
+		return prefix + "identitytest"
+	}
+	return patterns[0]
+}
+
+func isContractError(err error) bool {
+	for _, sentinel := range ContractErrors {
+		if errors.Is(err, sentinel) {
+			return true
+		}
+	}
+	return false
+}
+
+func cloneUser(u *identity.User) *identity.User {
+	c := &identity.User{ID: u.ID}
+	if u.Roles != nil {
+		c.Roles = append([]identity.Role(nil), u.Roles...)
+	}
+	if u.Attributes != nil {
+		c.Attributes = make(map[string]string, len(u.Attributes))
+		for k, v := range u.Attributes {
+			c.Attributes[k] = v
+		}
+	}
+	return c
+}
+
+func requestName(i int, req identity.AuthRequest) string {
+	return fmt.Sprintf("%d_%s", i, req.Account)
+}
@@ -0,0 +1,99 @@
+package identitytest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/msimon/nauts/identity"
+)
+
+func TestFileAuthenticationProvider_Conformance(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hashing password: %v", err)
+	}
+	usersFile := filepath.Join(t.TempDir(), "users.json")
+	content := `{
+  "users": {
+    "alice": {
+      "accounts": ["ACME"],
+      "roles": ["ACME.workers"],
+      "passwordHash": "` + string(hash) + `",
+      "attributes": {"department": "engineering"}
+    }
+  }
+}`
+	if err := os.WriteFile(usersFile, []byte(content), 0644); err != nil {
+		t.Fatalf("writing users file: %v", err)
+	}
+	p, err := identity.NewFileAuthenticationProvider(identity.FileAuthenticationProviderConfig{
+		UsersPath: usersFile,
+		Accounts:  []string{"ACME"},
+	})
+	if err != nil {
+		t.Fatalf("creating provider: %v", err)
+	}
+
+	RunProviderTests(t, p,
+		WithValidRequest(identity.AuthRequest{Account: "ACME", Token: "alice:secret123"}),
+		WithRejectedRequest(identity.AuthRequest{Account: "ACME", Token: "alice:wrong"}, identity.ErrInvalidCredentials),
+		WithRejectedRequest(identity.AuthRequest{Account: "ACME", Token: "mallory:secret123"}, identity.ErrUserNotFound),
+		WithRejectedRequest(identity.AuthRequest{Account: "OTHER", Token: "alice:secret123"}, identity.ErrInvalidAccount),
+	)
+}
+
+func TestJwtAuthenticationProvider_Conformance(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating RSA key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("marshaling public key: %v", err)
+	}
+	publicKey := base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	p, err := identity.NewJwtAuthenticationProvider(identity.JwtAuthenticationProviderConfig{
+		Accounts:  []string{"tenant-*"},
+		Issuer:    "https://auth.example.com",
+		PublicKey: publicKey,
+	})
+	if err != nil {
+		t.Fatalf("creating provider: %v", err)
+	}
+
+	sign := func(claims jwt.MapClaims) string {
+		t.Helper()
+		token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+		if err != nil {
+			t.Fatalf("signing JWT: %v", err)
+		}
+		return token
+	}
+	roles := map[string]any{"nauts": map[string]any{"roles": []any{"tenant-a.admin"}}}
+
+	RunProviderTests(t, p,
+		WithValidRequest(identity.AuthRequest{Account: "tenant-a", Token: sign(jwt.MapClaims{
+			"iss":             "https://auth.example.com",
+			"sub":             "user-123",
+			"exp":             time.Now().Add(time.Hour).Unix(),
+			"resource_access": roles,
+		})}),
+		WithRejectedRequest(identity.AuthRequest{Account: "tenant-a", Token: sign(jwt.MapClaims{
+			"iss":             "https://auth.example.com",
+			"sub":             "user-123",
+			"exp":             time.Now().Add(-time.Hour).Unix(),
+			"resource_access": roles,
+		})}, identity.ErrInvalidCredentials),
+	)
+}
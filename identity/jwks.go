@@ -0,0 +1,325 @@
+package identity
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/msimon/nauts/depstats"
+)
+
+const (
+	// DefaultJWKSRefreshInterval is how often signing keys are refreshed in the background.
+	DefaultJWKSRefreshInterval = time.Hour
+	// jwksMinRefreshInterval rate-limits refreshes triggered by unknown key ids.
+	jwksMinRefreshInterval = 10 * time.Second
+	// jwksRetryInterval is the background retry delay after a failed refresh.
+	jwksRetryInterval = 30 * time.Second
+	// jwksFetchTimeout bounds a background refresh.
+	jwksFetchTimeout = 30 * time.Second
+	// jwksMaxResponseBytes bounds discovery and JWKS response bodies.
+	jwksMaxResponseBytes = 1 << 20
+)
+
+// ErrUnknownSigningKey is returned when no signing key matches the token's key id.
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+// jwksKeySet caches the signing keys of a JWKS endpoint, keyed by key id.
+//
+// Keys are refreshed in the background and on demand when a token references
+// an unknown key id, so rotated keys are picked up without a restart. A failed
+// refresh keeps the previous keys.
+type jwksKeySet struct {
+	issuer          string
+	jwksURL         string // empty until resolved when discovery is used
+	client          *http.Client
+	refreshInterval time.Duration
+	now             func() time.Time
+
+	mu   sync.RWMutex
+	keys map[string]any
+
+	refreshMu   sync.Mutex
+	lastAttempt time.Time
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// newJWKSKeySet creates a key set for jwksURL, or for the JWKS URL announced
+// in the OpenID Connect discovery document of issuer if jwksURL is empty.
+func newJWKSKeySet(issuer, jwksURL string, client *http.Client, refreshInterval time.Duration) *jwksKeySet {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	client = depstats.Client(client, depstats.DependencyJWKS, "")
+	if refreshInterval <= 0 {
+		refreshInterval = DefaultJWKSRefreshInterval
+	}
+	return &jwksKeySet{
+		issuer:          issuer,
+		jwksURL:         jwksURL,
+		client:          client,
+		refreshInterval: refreshInterval,
+		now:             time.Now,
+		keys:            make(map[string]any),
+		stop:            make(chan struct{}),
+		done:            make(chan struct{}),
+	}
+}
+
+// start fetches the keys and keeps refreshing them until Stop is called.
+// Startup does not fail if the issuer is unreachable; Verify reports
+// ErrProviderUnavailable until the first refresh succeeds.
+func (s *jwksKeySet) start() {
+	go func() {
+		defer close(s.done)
+		for {
+			wait := s.refreshInterval
+			ctx, cancel := context.WithTimeout(context.Background(), jwksFetchTimeout)
+			if err := s.refresh(ctx); err != nil {
+				wait = min(jwksRetryInterval, s.refreshInterval)
+			}
+			cancel()
+
+			select {
+			case <-s.stop:
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+}
+
+// Stop stops the background refresh.
+func (s *jwksKeySet) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+		<-s.done
+	})
+}
+
+// key returns the signing key for kid. An empty kid matches if the set holds
+// exactly one key.
+func (s *jwksKeySet) key(ctx context.Context, kid string) (any, error) {
+	if key, ok := s.lookup(kid); ok {
+		return key, nil
+	}
+
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+	// Another request may have refreshed the keys while we waited.
+	if key, ok := s.lookup(kid); ok {
+		return key, nil
+	}
+	if s.now().Sub(s.lastAttempt) < jwksMinRefreshInterval {
+		if s.empty() {
+			return nil, fmt.Errorf("%w: no signing keys loaded", ErrProviderUnavailable)
+		}
+		return nil, fmt.Errorf("%w: kid %q", ErrUnknownSigningKey, kid)
+	}
+	if err := s.refreshLocked(ctx); err != nil {
+		return nil, err
+	}
+	if key, ok := s.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: kid %q", ErrUnknownSigningKey, kid)
+}
+
+func (s *jwksKeySet) lookup(kid string) (any, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if kid == "" {
+		if len(s.keys) != 1 {
+			return nil, false
+		}
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+func (s *jwksKeySet) empty() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.keys) == 0
+}
+
+// refresh fetches the current key set.
+func (s *jwksKeySet) refresh(ctx context.Context) error {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+	return s.refreshLocked(ctx)
+}
+
+func (s *jwksKeySet) refreshLocked(ctx context.Context) error {
+	s.lastAttempt = s.now()
+	keys, err := s.fetch(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: refreshing signing keys: %v", ErrProviderUnavailable, err)
+	}
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+	return nil
+}
+
+// fetch downloads the key set, resolving the JWKS URL first if needed.
+func (s *jwksKeySet) fetch(ctx context.Context) (map[string]any, error) {
+	if s.jwksURL == "" {
+		jwksURL, err := s.discover(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s.jwksURL = jwksURL
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := s.getJSON(ctx, s.jwksURL, &set); err != nil {
+		return nil, fmt.Errorf("fetching jwks: %w", err)
+	}
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			// Skip unsupported keys (e.g., symmetric keys).
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("jwks at %s contains no usable signing keys", s.jwksURL)
+	}
+	return keys, nil
+}
+
+// discover resolves the JWKS URL from the OpenID Connect discovery document.
+func (s *jwksKeySet) discover(ctx context.Context) (string, error) {
+	var doc struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	url := strings.TrimSuffix(s.issuer, "/") + "/.well-known/openid-configuration"
+	if err := s.getJSON(ctx, url, &doc); err != nil {
+		return "", fmt.Errorf("fetching openid configuration: %w", err)
+	}
+	if doc.Issuer != s.issuer {
+		return "", fmt.Errorf("openid configuration issuer %q does not match %q", doc.Issuer, s.issuer)
+	}
+	if doc.JWKSURI == "" {
+		return "", errors.New("openid configuration has no jwks_uri")
+	}
+	return doc.JWKSURI, nil
+}
+
+// getJSON decodes the JSON document at url into v.
+func (s *jwksKeySet) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, jwksMaxResponseBytes))
+	if err != nil {
+		return fmt.Errorf("reading response: %w", err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("decoding %s: %w", url, err)
+	}
+	return nil
+}
+
+// jsonWebKey is a public key in JWK format (RFC 7517).
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// publicKey returns the *rsa.PublicKey or *ecdsa.PublicKey of k.
+func (k jsonWebKey) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil || len(n) == 0 {
+			return nil, errors.New("invalid rsa modulus")
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid rsa exponent")
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		var ecdhCurve ecdh.Curve
+		switch k.Crv {
+		case "P-256":
+			curve, ecdhCurve = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, ecdhCurve = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, ecdhCurve = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		size := (curve.Params().BitSize + 7) / 8
+		if errX != nil || errY != nil || len(x) != size || len(y) != size {
+			return nil, errors.New("invalid ec coordinates")
+		}
+		// Reject points that are not on the curve.
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := ecdhCurve.NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("invalid ec point: %w", err)
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
@@ -0,0 +1,201 @@
+package identity
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testIdP serves an OpenID Connect discovery document and a JWKS.
+type testIdP struct {
+	*httptest.Server
+	mu     sync.Mutex
+	keys   []jsonWebKey
+	status int
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	idp := &testIdP{status: http.StatusOK}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"issuer": idp.URL, "jwks_uri": idp.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		if idp.status != http.StatusOK {
+			w.WriteHeader(idp.status)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": idp.keys})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func (idp *testIdP) setKeys(status int, keys ...jsonWebKey) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.status = status
+	idp.keys = keys
+}
+
+func rsaJWK(kid string, pub *rsa.PublicKey) jsonWebKey {
+	return jsonWebKey{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+func signWithKid(t *testing.T, method jwt.SigningMethod, key any, kid, issuer string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, jwt.MapClaims{
+		"iss": issuer,
+		"sub": "user-123",
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"resource_access": map[string]any{
+			"nauts": map[string]any{"roles": []any{"APP.admin"}},
+		},
+	})
+	token.Header["kid"] = kid
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("signing JWT: %v", err)
+	}
+	return s
+}
+
+// newJWKSTestProvider creates a provider and stops its background refresh
+// after the initial fetch, so tests control refreshes deterministically.
+func newJWKSTestProvider(t *testing.T, cfg JwtAuthenticationProviderConfig) *JwtAuthenticationProvider {
+	t.Helper()
+	p, err := NewJwtAuthenticationProvider(cfg)
+	if err != nil {
+		t.Fatalf("NewJwtAuthenticationProvider() error = %v", err)
+	}
+	_ = p.Stop()
+	return p
+}
+
+func TestJwtAuthenticationProvider_DiscoveryAndRotation(t *testing.T) {
+	idp := newTestIdP(t)
+	key1, _ := rsa.GenerateKey(rand.Reader, 2048)
+	key2, _ := rsa.GenerateKey(rand.Reader, 2048)
+	idp.setKeys(http.StatusOK, rsaJWK("k1", &key1.PublicKey))
+
+	p := newJWKSTestProvider(t, JwtAuthenticationProviderConfig{
+		Accounts:  []string{"*"},
+		Issuer:    idp.URL,
+		Discovery: true,
+	})
+	ctx := context.Background()
+	now := time.Now()
+	p.issuers[idp.URL].keys.now = func() time.Time { return now }
+
+	token1 := signWithKid(t, jwt.SigningMethodRS256, key1, "k1", idp.URL)
+	if _, err := p.Verify(ctx, AuthRequest{Token: token1}); err != nil {
+		t.Fatalf("Verify() with k1 error = %v", err)
+	}
+
+	// The IdP rotates to k2. Unknown key ids are rate-limited ...
+	idp.setKeys(http.StatusOK, rsaJWK("k2", &key2.PublicKey))
+	token2 := signWithKid(t, jwt.SigningMethodRS256, key2, "k2", idp.URL)
+	if _, err := p.Verify(ctx, AuthRequest{Token: token2}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Verify() with k2 within rate limit error = %v, want ErrInvalidCredentials", err)
+	}
+
+	// ... and trigger a refresh once the rate limit has passed.
+	now = now.Add(jwksMinRefreshInterval)
+	if _, err := p.Verify(ctx, AuthRequest{Token: token2}); err != nil {
+		t.Fatalf("Verify() with k2 after refresh error = %v", err)
+	}
+	if _, err := p.Verify(ctx, AuthRequest{Token: token1}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Verify() with removed k1 error = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestJwtAuthenticationProvider_JWKSUnavailable(t *testing.T) {
+	idp := newTestIdP(t)
+	idp.setKeys(http.StatusServiceUnavailable)
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	p := newJWKSTestProvider(t, JwtAuthenticationProviderConfig{
+		Accounts: []string{"*"},
+		Issuer:   "https://auth.example.com",
+		JWKSURL:  idp.URL + "/keys",
+	})
+
+	token := signWithKid(t, jwt.SigningMethodRS256, key, "k1", "https://auth.example.com")
+	_, err := p.Verify(context.Background(), AuthRequest{Token: token})
+	if !errors.Is(err, ErrProviderUnavailable) {
+		t.Errorf("Verify() error = %v, want ErrProviderUnavailable", err)
+	}
+}
+
+func TestJwtAuthenticationProvider_JWKSECKey(t *testing.T) {
+	idp := newTestIdP(t)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	idp.setKeys(http.StatusOK,
+		jsonWebKey{Kty: "oct", Kid: "hmac"},
+		jsonWebKey{
+			Kty: "EC",
+			Kid: "ec",
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+			Y:   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+		},
+	)
+
+	p := newJWKSTestProvider(t, JwtAuthenticationProviderConfig{
+		Accounts: []string{"*"},
+		Issuer:   "https://auth.example.com",
+		JWKSURL:  idp.URL + "/keys",
+	})
+
+	// A token without kid matches the only usable key.
+	token := signWithKid(t, jwt.SigningMethodES256, key, "", "https://auth.example.com")
+	user, err := p.Verify(context.Background(), AuthRequest{Token: token})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if user.ID != "user-123" {
+		t.Errorf("user.ID = %q, want user-123", user.ID)
+	}
+}
+
+func TestNewJwtAuthenticationProvider_KeySource(t *testing.T) {
+	_, publicKey := generateTestKeyPair(t)
+	tests := []struct {
+		name string
+		cfg  JwtAuthenticationProviderConfig
+	}{
+		{"none", JwtAuthenticationProviderConfig{Issuer: "https://auth.example.com"}},
+		{"public key and jwks", JwtAuthenticationProviderConfig{Issuer: "https://auth.example.com", PublicKey: publicKey, JWKSURL: "https://auth.example.com/keys"}},
+		{"jwks and discovery", JwtAuthenticationProviderConfig{Issuer: "https://auth.example.com", JWKSURL: "https://auth.example.com/keys", Discovery: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewJwtAuthenticationProvider(tt.cfg); err == nil {
+				t.Error("NewJwtAuthenticationProvider() succeeded, want error")
+			}
+		})
+	}
+}
@@ -9,14 +9,16 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
 // JwtAuthenticationProvider errors.
 var (
-	// ErrNoRolesFound is returned when no valid roles are found in the JWT.
+	// ErrNoRolesFound is returned when no valid roles and no groups are found in the JWT.
 	ErrNoRolesFound = errors.New("no valid roles found in token")
 )
 
@@ -26,12 +28,47 @@ type JwtAuthenticationProviderConfig struct {
 	// Patterns support wildcards in the form of "*" (all) or "prefix*".
 	Accounts []string `json:"accounts"`
 	// Issuer is the expected JWT issuer (iss claim).
+	// Mutually exclusive with Issuers.
 	Issuer string `json:"issuer"`
 	// PublicKey is the PEM-encoded public key for JWT signature verification (base64-encoded PEM block).
-	PublicKey string `json:"publicKey"`
+	// Exactly one of PublicKey, JWKSURL, and Discovery must be set.
+	PublicKey string `json:"publicKey,omitempty"`
+	// JWKSURL is the URL of the issuer's JSON Web Key Set. Keys are selected
+	// by the token's "kid" header and refreshed periodically.
+	JWKSURL string `json:"jwksUrl,omitempty"`
+	// Discovery reads the JWKS URL from the issuer's OpenID Connect discovery
+	// document (<issuer>/.well-known/openid-configuration).
+	Discovery bool `json:"discovery,omitempty"`
+	// JWKSRefreshInterval is how often JWKS keys are refreshed (default: 1h).
+	// Unknown key ids trigger an earlier refresh.
+	JWKSRefreshInterval time.Duration `json:"jwksRefreshInterval,omitempty"`
+	// Audience, if set, must be contained in the token's aud claim.
+	Audience string `json:"audience,omitempty"`
+	// Issuers configures several trusted issuers, each with its own keys and
+	// audience. The token's iss claim selects the issuer. Mutually exclusive
+	// with Issuer, PublicKey, JWKSURL, Discovery, JWKSRefreshInterval, and
+	// Audience.
+	Issuers []JwtIssuerConfig `json:"issuers,omitempty"`
+	// HTTPClient fetches the discovery document and JWKS (default: 10s timeout).
+	HTTPClient *http.Client `json:"-"`
 	// RolesClaimPath is the path to roles in JWT claims (dot-separated).
 	// Default: "resource_access.nauts.roles"
 	RolesClaimPath string `json:"rolesClaimPath,omitempty"`
+	// GroupsClaimPath is the path to groups in JWT claims (dot-separated,
+	// e.g. "groups"), read into User.Groups for a RoleMapper. Default: none.
+	GroupsClaimPath string `json:"groupsClaimPath,omitempty"`
+}
+
+// JwtIssuerConfig configures one trusted issuer of a JwtAuthenticationProvider.
+// The fields have the meaning of the equally named fields of
+// JwtAuthenticationProviderConfig.
+type JwtIssuerConfig struct {
+	Issuer              string        `json:"issuer"`
+	PublicKey           string        `json:"publicKey,omitempty"`
+	JWKSURL             string        `json:"jwksUrl,omitempty"`
+	Discovery           bool          `json:"discovery,omitempty"`
+	JWKSRefreshInterval time.Duration `json:"jwksRefreshInterval,omitempty"`
+	Audience            string        `json:"audience,omitempty"`
 }
 
 // JwtAuthenticationProvider implements AuthenticationProvider using external JWTs.
@@ -40,20 +77,54 @@ type JwtAuthenticationProviderConfig struct {
 // Roles in the JWT must follow the format "<account>.<role>" (e.g., "tenant-a.admin").
 // Account manageability validation and role filtering are performed by AuthController.
 type JwtAuthenticationProvider struct {
-	issuer             string
-	publicKey          any
+	issuers            map[string]*jwtIssuer // by iss claim
 	rolesClaimPath     []string
+	groupsClaimPath    []string // nil if groups are not read
 	manageableAccounts []string
 }
 
+// jwtIssuer holds the verification keys of a trusted issuer.
+type jwtIssuer struct {
+	publicKey any         // static key, nil if keys is set
+	keys      *jwksKeySet // JWKS keys, nil if publicKey is set
+	audience  string
+}
+
 // NewJwtAuthenticationProvider creates a new JwtAuthenticationProvider from the given configuration.
 func NewJwtAuthenticationProvider(cfg JwtAuthenticationProviderConfig) (*JwtAuthenticationProvider, error) {
-	if strings.TrimSpace(cfg.Issuer) == "" {
-		return nil, fmt.Errorf("issuer is required")
+	issuers := cfg.Issuers
+	if len(issuers) == 0 {
+		issuers = []JwtIssuerConfig{{
+			Issuer:              cfg.Issuer,
+			PublicKey:           cfg.PublicKey,
+			JWKSURL:             cfg.JWKSURL,
+			Discovery:           cfg.Discovery,
+			JWKSRefreshInterval: cfg.JWKSRefreshInterval,
+			Audience:            cfg.Audience,
+		}}
+	} else if cfg.Issuer != "" || cfg.PublicKey != "" || cfg.JWKSURL != "" || cfg.Discovery || cfg.JWKSRefreshInterval != 0 || cfg.Audience != "" {
+		return nil, fmt.Errorf("issuers is mutually exclusive with issuer, publicKey, jwksUrl, discovery, jwksRefreshInterval, and audience")
 	}
-	pubKey, err := parsePublicKey(cfg.PublicKey)
-	if err != nil {
-		return nil, fmt.Errorf("parsing public key: %w", err)
+
+	byIssuer := make(map[string]*jwtIssuer, len(issuers))
+	for i, ic := range issuers {
+		if strings.TrimSpace(ic.Issuer) == "" {
+			if len(cfg.Issuers) > 0 {
+				return nil, fmt.Errorf("issuers[%d]: issuer is required", i)
+			}
+			return nil, fmt.Errorf("issuer is required")
+		}
+		if _, ok := byIssuer[ic.Issuer]; ok {
+			return nil, fmt.Errorf("duplicate issuer %q", ic.Issuer)
+		}
+		iss, err := newJwtIssuer(ic)
+		if err != nil {
+			if len(cfg.Issuers) > 0 {
+				return nil, fmt.Errorf("issuer %q: %w", ic.Issuer, err)
+			}
+			return nil, err
+		}
+		byIssuer[ic.Issuer] = iss
 	}
 
 	rolesPath := cfg.RolesClaimPath
@@ -62,14 +133,55 @@ func NewJwtAuthenticationProvider(cfg JwtAuthenticationProviderConfig) (*JwtAuth
 	}
 
 	provider := &JwtAuthenticationProvider{
-		issuer:             cfg.Issuer,
-		publicKey:          pubKey,
+		issuers:            byIssuer,
 		rolesClaimPath:     strings.Split(rolesPath, "."),
 		manageableAccounts: append([]string(nil), cfg.Accounts...),
 	}
+	if cfg.GroupsClaimPath != "" {
+		provider.groupsClaimPath = strings.Split(cfg.GroupsClaimPath, ".")
+	}
+	for _, ic := range issuers {
+		if iss := byIssuer[ic.Issuer]; iss.publicKey == nil {
+			iss.keys = newJWKSKeySet(ic.Issuer, ic.JWKSURL, cfg.HTTPClient, ic.JWKSRefreshInterval)
+			iss.keys.start()
+		}
+	}
 	return provider, nil
 }
 
+// newJwtIssuer checks the key source of an issuer and parses its static key.
+// JWKS key sets are started by the caller once all issuers are valid.
+func newJwtIssuer(cfg JwtIssuerConfig) (*jwtIssuer, error) {
+	sources := 0
+	for _, set := range []bool{cfg.PublicKey != "", cfg.JWKSURL != "", cfg.Discovery} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, fmt.Errorf("exactly one of publicKey, jwksUrl, and discovery is required")
+	}
+	iss := &jwtIssuer{audience: cfg.Audience}
+	if cfg.PublicKey != "" {
+		pubKey, err := parsePublicKey(cfg.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("parsing public key: %w", err)
+		}
+		iss.publicKey = pubKey
+	}
+	return iss, nil
+}
+
+// Stop stops the background JWKS refreshes. It is a no-op for static keys.
+func (p *JwtAuthenticationProvider) Stop() error {
+	for _, iss := range p.issuers {
+		if iss.keys != nil {
+			iss.keys.Stop()
+		}
+	}
+	return nil
+}
+
 func (p *JwtAuthenticationProvider) ManageableAccounts() []string {
 	return append([]string(nil), p.manageableAccounts...)
 }
@@ -102,8 +214,8 @@ func parsePublicKey(pemDataB64 string) (any, error) {
 // Verify validates the JWT and returns the user.
 //
 // Role filtering and account manageability validation are performed by AuthController.
-func (p *JwtAuthenticationProvider) Verify(_ context.Context, req AuthRequest) (*User, error) {
-	token, err := p.parseAndVerifyJWT(req.Token)
+func (p *JwtAuthenticationProvider) Verify(ctx context.Context, req AuthRequest) (*User, error) {
+	token, err := p.parseAndVerifyJWT(ctx, req.Token)
 	if err != nil {
 		return nil, err
 	}
@@ -118,18 +230,19 @@ func (p *JwtAuthenticationProvider) Verify(_ context.Context, req AuthRequest) (
 		userID = "unknown"
 	}
 
-	issuer, _ := claims["iss"].(string)
-	if issuer != p.issuer {
-		return nil, ErrInvalidCredentials
+	var groups []string
+	if p.groupsClaimPath != nil {
+		// Tokens without the groups claim may still carry roles.
+		groups, _ = extractRoles(claims, p.groupsClaimPath)
 	}
 
 	rawRoles, err := extractRoles(claims, p.rolesClaimPath)
-	if err != nil {
+	if err != nil && len(groups) == 0 {
 		return nil, err
 	}
 
 	parsedRoles := parseJWTAccountRoles(rawRoles)
-	if len(parsedRoles) == 0 {
+	if len(parsedRoles) == 0 && len(groups) == 0 {
 		return nil, ErrNoRolesFound
 	}
 
@@ -139,13 +252,49 @@ func (p *JwtAuthenticationProvider) Verify(_ context.Context, req AuthRequest) (
 		ID:         userID,
 		Roles:      parsedRoles,
 		Attributes: attributes,
+		Groups:     groups,
 	}, nil
 }
 
-// parseAndVerifyJWT parses the JWT and verifies the signature.
-func (p *JwtAuthenticationProvider) parseAndVerifyJWT(tokenString string) (*jwt.Token, error) {
+// parseAndVerifyJWT selects the issuer by the token's iss claim, then parses
+// the JWT and verifies the signature with that issuer's keys, as well as the
+// issuer's audience if configured.
+//
+// With JWKS, an unreachable issuer yields ErrProviderUnavailable rather than
+// ErrInvalidCredentials, so outages are not reported as bad credentials.
+func (p *JwtAuthenticationProvider) parseAndVerifyJWT(ctx context.Context, tokenString string) (*jwt.Token, error) {
+	// The claims are not trusted until the signature is verified below; the
+	// issuer only selects the keys to verify with.
+	unverified, _, err := jwt.NewParser().ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	issuer, _ := unverified.Claims.(jwt.MapClaims)["iss"].(string)
+	iss, ok := p.issuers[issuer]
+	if !ok {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidCredentials, issuer)
+	}
+	opts := []jwt.ParserOption{jwt.WithIssuer(issuer)}
+	if iss.audience != "" {
+		opts = append(opts, jwt.WithAudience(iss.audience))
+	}
+	return verifyJWT(ctx, tokenString, iss.publicKey, iss.keys, opts...)
+}
+
+// verifyJWT parses tokenString and verifies its signature with staticKey, or
+// with the key selected by the token's "kid" header if keys is set.
+func verifyJWT(ctx context.Context, tokenString string, staticKey any, keys *jwksKeySet, opts ...jwt.ParserOption) (*jwt.Token, error) {
+	var keyErr error
 	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (any, error) {
-		switch p.publicKey.(type) {
+		key := staticKey
+		if keys != nil {
+			kid, _ := t.Header["kid"].(string)
+			key, keyErr = keys.key(ctx, kid)
+			if keyErr != nil {
+				return nil, keyErr
+			}
+		}
+		switch key.(type) {
 		case *rsa.PublicKey:
 			if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
 				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
@@ -155,8 +304,11 @@ func (p *JwtAuthenticationProvider) parseAndVerifyJWT(tokenString string) (*jwt.
 				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
 			}
 		}
-		return p.publicKey, nil
-	})
+		return key, nil
+	}, opts...)
+	if errors.Is(keyErr, ErrProviderUnavailable) {
+		return nil, keyErr
+	}
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
 	}
@@ -166,7 +318,7 @@ func (p *JwtAuthenticationProvider) parseAndVerifyJWT(tokenString string) (*jwt.
 	return token, nil
 }
 
-// extractRoles extracts roles from JWT claims at the given path.
+// extractRoles extracts roles (or groups) from JWT claims at the given path.
 func extractRoles(claims jwt.MapClaims, rolesClaimPath []string) ([]string, error) {
 	var current any = map[string]any(claims)
 	for i, key := range rolesClaimPath {
@@ -8,6 +8,8 @@ import (
 	"encoding/base64"
 	"encoding/pem"
 	"errors"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -298,6 +300,168 @@ func TestJwtAuthenticationProvider_Verify_InvalidSignature(t *testing.T) {
 	}
 }
 
+func TestJwtAuthenticationProvider_Verify_Audience(t *testing.T) {
+	privateKey, publicKeyPEM := generateTestKeyPair(t)
+
+	provider, err := NewJwtAuthenticationProvider(JwtAuthenticationProviderConfig{
+		Accounts:  []string{"*"},
+		Issuer:    "https://auth.example.com",
+		PublicKey: publicKeyPEM,
+		Audience:  "nauts",
+	})
+	if err != nil {
+		t.Fatalf("creating provider: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		aud     any // nil omits the claim
+		wantErr bool
+	}{
+		{name: "matching audience", aud: "nauts"},
+		{name: "audience list", aud: []string{"billing", "nauts"}},
+		{name: "other audience", aud: "billing", wantErr: true},
+		{name: "missing audience", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := jwt.MapClaims{
+				"iss": "https://auth.example.com",
+				"sub": "user-123",
+				"exp": time.Now().Add(time.Hour).Unix(),
+				"resource_access": map[string]any{
+					"nauts": map[string]any{"roles": []any{"account.admin"}},
+				},
+			}
+			if tt.aud != nil {
+				claims["aud"] = tt.aud
+			}
+			_, err := provider.Verify(context.Background(), AuthRequest{Token: createTestJWT(t, privateKey, claims)})
+			if tt.wantErr && !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("Verify() error = %v, want %v", err, ErrInvalidCredentials)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Verify() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestJwtAuthenticationProvider_MultipleIssuers(t *testing.T) {
+	keyA, publicKeyA := generateTestKeyPair(t)
+	keyB, publicKeyB := generateTestKeyPair(t)
+
+	provider, err := NewJwtAuthenticationProvider(JwtAuthenticationProviderConfig{
+		Accounts: []string{"*"},
+		Issuers: []JwtIssuerConfig{
+			{Issuer: "https://a.example.com", PublicKey: publicKeyA},
+			{Issuer: "https://b.example.com", PublicKey: publicKeyB, Audience: "nauts"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("creating provider: %v", err)
+	}
+
+	roles := map[string]any{"nauts": map[string]any{"roles": []any{"account.admin"}}}
+	exp := time.Now().Add(time.Hour).Unix()
+	tests := []struct {
+		name    string
+		key     *rsa.PrivateKey
+		claims  jwt.MapClaims
+		wantErr bool
+	}{
+		{
+			name:   "issuer a",
+			key:    keyA,
+			claims: jwt.MapClaims{"iss": "https://a.example.com", "sub": "alice", "exp": exp, "resource_access": roles},
+		},
+		{
+			name:   "issuer b with audience",
+			key:    keyB,
+			claims: jwt.MapClaims{"iss": "https://b.example.com", "aud": []string{"other", "nauts"}, "sub": "bob", "exp": exp, "resource_access": roles},
+		},
+		{
+			name:    "issuer b signed with key of issuer a",
+			key:     keyA,
+			claims:  jwt.MapClaims{"iss": "https://b.example.com", "aud": "nauts", "sub": "mallory", "exp": exp, "resource_access": roles},
+			wantErr: true,
+		},
+		{
+			name:    "issuer b without audience",
+			key:     keyB,
+			claims:  jwt.MapClaims{"iss": "https://b.example.com", "sub": "bob", "exp": exp, "resource_access": roles},
+			wantErr: true,
+		},
+		{
+			name:    "unknown issuer",
+			key:     keyA,
+			claims:  jwt.MapClaims{"iss": "https://c.example.com", "sub": "carol", "exp": exp, "resource_access": roles},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := provider.Verify(context.Background(), AuthRequest{Token: createTestJWT(t, tt.key, tt.claims)})
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidCredentials) {
+					t.Errorf("Verify() error = %v, want %v", err, ErrInvalidCredentials)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if user.ID != tt.claims["sub"] {
+				t.Errorf("user.ID = %q, want %q", user.ID, tt.claims["sub"])
+			}
+		})
+	}
+}
+
+func TestNewJwtAuthenticationProvider_IssuersErrors(t *testing.T) {
+	_, publicKey := generateTestKeyPair(t)
+	tests := []struct {
+		name    string
+		cfg     JwtAuthenticationProviderConfig
+		wantErr string
+	}{
+		{
+			name: "issuers and issuer",
+			cfg: JwtAuthenticationProviderConfig{
+				Issuer:  "https://a.example.com",
+				Issuers: []JwtIssuerConfig{{Issuer: "https://b.example.com", PublicKey: publicKey}},
+			},
+			wantErr: "issuers is mutually exclusive",
+		},
+		{
+			name: "duplicate issuer",
+			cfg: JwtAuthenticationProviderConfig{Issuers: []JwtIssuerConfig{
+				{Issuer: "https://a.example.com", PublicKey: publicKey},
+				{Issuer: "https://a.example.com", PublicKey: publicKey},
+			}},
+			wantErr: `duplicate issuer "https://a.example.com"`,
+		},
+		{
+			name:    "issuer without key",
+			cfg:     JwtAuthenticationProviderConfig{Issuers: []JwtIssuerConfig{{Issuer: "https://a.example.com"}}},
+			wantErr: `issuer "https://a.example.com": exactly one of publicKey, jwksUrl, and discovery is required`,
+		},
+		{
+			name:    "missing issuer",
+			cfg:     JwtAuthenticationProviderConfig{Issuers: []JwtIssuerConfig{{PublicKey: publicKey}}},
+			wantErr: "issuers[0]: issuer is required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewJwtAuthenticationProvider(tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewJwtAuthenticationProvider() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestJwtAuthenticationProvider_CustomRolesPath(t *testing.T) {
 	privateKey, publicKeyPEM := generateTestKeyPair(t)
 
@@ -330,6 +494,45 @@ func TestJwtAuthenticationProvider_CustomRolesPath(t *testing.T) {
 	}
 }
 
+func TestJwtAuthenticationProvider_GroupsClaimPath(t *testing.T) {
+	privateKey, publicKeyPEM := generateTestKeyPair(t)
+
+	provider, err := NewJwtAuthenticationProvider(JwtAuthenticationProviderConfig{
+		Accounts:        []string{"*"},
+		Issuer:          "https://auth.example.com",
+		PublicKey:       publicKeyPEM,
+		GroupsClaimPath: "groups",
+	})
+	if err != nil {
+		t.Fatalf("creating provider: %v", err)
+	}
+
+	// Groups without nauts roles are enough to verify the token.
+	tokenString := createTestJWT(t, privateKey, jwt.MapClaims{
+		"iss":    "https://auth.example.com",
+		"sub":    "user-123",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"groups": []any{"eng-platform", "everyone"},
+	})
+	user, err := provider.Verify(context.Background(), AuthRequest{Account: "APP", Token: tokenString})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if len(user.Roles) != 0 || !slices.Equal(user.Groups, []string{"eng-platform", "everyone"}) {
+		t.Errorf("Verify() roles = %v, groups = %v", user.Roles, user.Groups)
+	}
+
+	// Without roles and groups, the token is still rejected.
+	tokenString = createTestJWT(t, privateKey, jwt.MapClaims{
+		"iss": "https://auth.example.com",
+		"sub": "user-123",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	if _, err := provider.Verify(context.Background(), AuthRequest{Token: tokenString}); !errors.Is(err, ErrNoRolesFound) {
+		t.Errorf("Verify() error = %v, want %v", err, ErrNoRolesFound)
+	}
+}
+
 func TestParseJWTAccountRoles(t *testing.T) {
 	tests := []struct {
 		name  string
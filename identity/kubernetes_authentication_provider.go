@@ -0,0 +1,487 @@
+package identity
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/msimon/nauts/depstats"
+)
+
+const (
+	// KubernetesVerificationTokenReview verifies tokens with the TokenReview API.
+	KubernetesVerificationTokenReview = "tokenReview"
+	// KubernetesVerificationJWKS verifies tokens locally with the issuer's public keys.
+	KubernetesVerificationJWKS = "jwks"
+
+	// DefaultKubernetesAPIServer is the in-cluster address of the Kubernetes API server.
+	DefaultKubernetesAPIServer = "https://kubernetes.default.svc"
+	// DefaultKubernetesTokenPath is the in-cluster service account token of nauts itself.
+	DefaultKubernetesTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	// DefaultKubernetesCAPath is the in-cluster CA bundle of the API server.
+	DefaultKubernetesCAPath = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	// DefaultKubernetesAudience is the audience projected tokens must be issued for.
+	DefaultKubernetesAudience = "nauts"
+
+	// KubernetesRolesAnnotation lists the nauts roles of a service account as
+	// comma-separated "<account>.<role>" entries.
+	KubernetesRolesAnnotation = "nauts.io/roles"
+
+	// kubernetesServiceAccountPrefix prefixes service account user names.
+	kubernetesServiceAccountPrefix = "system:serviceaccount:"
+	// kubernetesMaxResponseBytes bounds API server response bodies.
+	kubernetesMaxResponseBytes = 1 << 20
+)
+
+// ErrNoServiceAccountRoles is returned when a service account maps to no nauts role.
+var ErrNoServiceAccountRoles = errors.New("service account has no nauts roles")
+
+// KubernetesAuthenticationProviderConfig holds configuration for KubernetesAuthenticationProvider.
+type KubernetesAuthenticationProviderConfig struct {
+	// Accounts is the list of NATS account patterns this provider manages.
+	// Patterns support wildcards in the form of "*" (all) or "prefix*".
+	Accounts []string `json:"accounts"`
+
+	// Verification selects how tokens are verified: "tokenReview" (default)
+	// asks the API server, "jwks" verifies signatures with the issuer's keys.
+	Verification string `json:"verification,omitempty"`
+
+	// Audience is the audience tokens must be issued for (default: "nauts").
+	// Pods request it with a projected service account token volume.
+	Audience string `json:"audience,omitempty"`
+
+	// APIServer is the Kubernetes API server URL (default: in-cluster address).
+	// It is used for TokenReview and for reading annotations.
+	APIServer string `json:"apiServer,omitempty"`
+	// TokenPath is the bearer token nauts presents to the API server
+	// (default: its own in-cluster service account token). It is re-read per
+	// request, so rotated tokens are picked up.
+	TokenPath string `json:"tokenPath,omitempty"`
+	// CAPath is the CA bundle of the API server (default: in-cluster CA if present).
+	CAPath string `json:"caPath,omitempty"`
+
+	// Issuer is the service account token issuer (iss claim).
+	// REQUIRED for "jwks" verification.
+	Issuer string `json:"issuer,omitempty"`
+	// JWKSURL is the URL of the issuer's JSON Web Key Set. If empty, it is read
+	// from the issuer's OpenID Connect discovery document.
+	JWKSURL string `json:"jwksUrl,omitempty"`
+	// JWKSRefreshInterval is how often JWKS keys are refreshed (default: 1h).
+	JWKSRefreshInterval time.Duration `json:"jwksRefreshInterval,omitempty"`
+
+	// Annotations reads roles from the KubernetesRolesAnnotation of the service
+	// account instead of its name. Requires "get" on serviceaccounts.
+	Annotations bool `json:"annotations,omitempty"`
+
+	// HTTPClient is used for API server requests (default: 5s timeout, CAPath
+	// trusted) and JWKS requests.
+	HTTPClient *http.Client `json:"-"`
+}
+
+// KubernetesAuthenticationProvider implements AuthenticationProvider using
+// Kubernetes service account tokens.
+//
+// By default, roles follow the service account naming convention
+// nauts.<account>.<role> (e.g., "nauts.app.worker"). With annotations enabled,
+// roles are read from the nauts.io/roles annotation of the service account
+// instead, which allows several roles and account names that are not valid
+// Kubernetes names.
+type KubernetesAuthenticationProvider struct {
+	audience           string
+	issuer             string
+	tokenReview        bool
+	annotations        bool
+	api                *kubernetesAPI // nil if neither TokenReview nor annotations are used
+	keys               *jwksKeySet    // nil for TokenReview
+	manageableAccounts []string
+}
+
+// serviceAccount identifies the service account a token was issued to.
+type serviceAccount struct {
+	Namespace string
+	Name      string
+	UID       string
+	Pod       string
+}
+
+// NewKubernetesAuthenticationProvider creates a new KubernetesAuthenticationProvider.
+func NewKubernetesAuthenticationProvider(cfg KubernetesAuthenticationProviderConfig) (*KubernetesAuthenticationProvider, error) {
+	verification := cfg.Verification
+	if verification == "" {
+		verification = KubernetesVerificationTokenReview
+	}
+	if verification != KubernetesVerificationTokenReview && verification != KubernetesVerificationJWKS {
+		return nil, fmt.Errorf("unsupported verification %q (expected %s or %s)", verification, KubernetesVerificationTokenReview, KubernetesVerificationJWKS)
+	}
+	if verification == KubernetesVerificationJWKS && strings.TrimSpace(cfg.Issuer) == "" {
+		return nil, errors.New("issuer is required for jwks verification")
+	}
+	audience := cfg.Audience
+	if audience == "" {
+		audience = DefaultKubernetesAudience
+	}
+
+	p := &KubernetesAuthenticationProvider{
+		audience:           audience,
+		issuer:             cfg.Issuer,
+		tokenReview:        verification == KubernetesVerificationTokenReview,
+		annotations:        cfg.Annotations,
+		manageableAccounts: append([]string(nil), cfg.Accounts...),
+	}
+	if p.tokenReview || p.annotations {
+		api, err := newKubernetesAPI(cfg)
+		if err != nil {
+			return nil, err
+		}
+		p.api = api
+	}
+	if !p.tokenReview {
+		p.keys = newJWKSKeySet(cfg.Issuer, cfg.JWKSURL, cfg.HTTPClient, cfg.JWKSRefreshInterval)
+		p.keys.start()
+	}
+	return p, nil
+}
+
+// Stop stops the background JWKS refresh. It is a no-op for TokenReview.
+func (p *KubernetesAuthenticationProvider) Stop() error {
+	if p.keys != nil {
+		p.keys.Stop()
+	}
+	return nil
+}
+
+// ManageableAccounts returns the list of account patterns this provider can manage.
+func (p *KubernetesAuthenticationProvider) ManageableAccounts() []string {
+	return append([]string(nil), p.manageableAccounts...)
+}
+
+// Verify validates the service account token and returns the user.
+func (p *KubernetesAuthenticationProvider) Verify(ctx context.Context, req AuthRequest) (*User, error) {
+	if req.Token == "" {
+		return nil, fmt.Errorf("%w: missing service account token", ErrInvalidCredentials)
+	}
+
+	// 1. Verify the token and identify the service account
+	var sa *serviceAccount
+	var err error
+	if p.tokenReview {
+		sa, err = p.api.reviewToken(ctx, req.Token, p.audience)
+	} else {
+		sa, err = p.verifyWithKeys(ctx, req.Token)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Map the service account to roles
+	var roles []Role
+	if p.annotations {
+		roles, err = p.api.annotatedRoles(ctx, sa)
+		if err != nil {
+			return nil, err
+		}
+	} else if role, ok := roleFromServiceAccountName(sa.Name); ok {
+		roles = []Role{role}
+	}
+	if len(roles) == 0 {
+		return nil, fmt.Errorf("%w: %s/%s", ErrNoServiceAccountRoles, sa.Namespace, sa.Name)
+	}
+
+	// 3. Validate AuthRequest.Account matches a role of the service account
+	if !hasRoleInAccount(roles, req.Account) {
+		return nil, fmt.Errorf("%w: service account %s/%s has no role in account %s",
+			ErrInvalidAccount, sa.Namespace, sa.Name, req.Account)
+	}
+
+	// 4. Construct User
+	attributes := map[string]string{
+		"k8s_namespace":      sa.Namespace,
+		"k8s_serviceaccount": sa.Name,
+	}
+	if sa.UID != "" {
+		attributes["k8s_uid"] = sa.UID
+	}
+	if sa.Pod != "" {
+		attributes["k8s_pod"] = sa.Pod
+	}
+	return &User{
+		ID:         kubernetesServiceAccountPrefix + sa.Namespace + ":" + sa.Name,
+		Roles:      roles,
+		Attributes: attributes,
+	}, nil
+}
+
+// verifyWithKeys verifies a service account token with the issuer's keys.
+func (p *KubernetesAuthenticationProvider) verifyWithKeys(ctx context.Context, tokenString string) (*serviceAccount, error) {
+	token, err := verifyJWT(ctx, tokenString, nil, p.keys,
+		jwt.WithIssuer(p.issuer),
+		jwt.WithAudience(p.audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidTokenType
+	}
+
+	var k8s struct {
+		Namespace      string `json:"namespace"`
+		ServiceAccount struct {
+			Name string `json:"name"`
+			UID  string `json:"uid"`
+		} `json:"serviceaccount"`
+		Pod struct {
+			Name string `json:"name"`
+		} `json:"pod"`
+	}
+	raw, _ := json.Marshal(claims["kubernetes.io"])
+	if err := json.Unmarshal(raw, &k8s); err != nil || k8s.Namespace == "" || k8s.ServiceAccount.Name == "" {
+		return nil, fmt.Errorf("%w: not a service account token", ErrInvalidCredentials)
+	}
+	sub, _ := claims["sub"].(string)
+	if sub != kubernetesServiceAccountPrefix+k8s.Namespace+":"+k8s.ServiceAccount.Name {
+		return nil, fmt.Errorf("%w: subject %q does not match service account", ErrInvalidCredentials, sub)
+	}
+	return &serviceAccount{
+		Namespace: k8s.Namespace,
+		Name:      k8s.ServiceAccount.Name,
+		UID:       k8s.ServiceAccount.UID,
+		Pod:       k8s.Pod.Name,
+	}, nil
+}
+
+// roleFromServiceAccountName parses service account names of the form
+// nauts.<account>.<role>.
+func roleFromServiceAccountName(name string) (Role, bool) {
+	parts := strings.Split(name, ".")
+	if len(parts) != 3 || parts[0] != "nauts" {
+		return Role{}, false
+	}
+	role := Role{Account: parts[1], Name: parts[2]}
+	if !natsIdentifierRegex.MatchString(role.Account) || !natsIdentifierRegex.MatchString(role.Name) {
+		return Role{}, false
+	}
+	return role, true
+}
+
+// parseRolesAnnotation parses comma-separated "<account>.<role>" entries.
+// Invalid entries are skipped.
+func parseRolesAnnotation(value string) []Role {
+	var roles []Role
+	for _, entry := range strings.Split(value, ",") {
+		role, err := ParseRoleID(strings.TrimSpace(entry))
+		if err != nil {
+			continue
+		}
+		roles = append(roles, role)
+	}
+	return roles
+}
+
+func hasRoleInAccount(roles []Role, account string) bool {
+	for _, r := range roles {
+		if r.Account == account {
+			return true
+		}
+	}
+	return false
+}
+
+// kubernetesAPI is a minimal client for the Kubernetes API server.
+type kubernetesAPI struct {
+	server    string
+	tokenPath string
+	client    *http.Client
+}
+
+func newKubernetesAPI(cfg KubernetesAuthenticationProviderConfig) (*kubernetesAPI, error) {
+	server := cfg.APIServer
+	if server == "" {
+		server = DefaultKubernetesAPIServer
+	}
+	if u, err := url.Parse(server); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("apiServer must be an http(s) URL: %s", server)
+	}
+	tokenPath := cfg.TokenPath
+	if tokenPath == "" {
+		tokenPath = DefaultKubernetesTokenPath
+	}
+
+	client := cfg.HTTPClient
+	if client == nil {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+		caPath := cfg.CAPath
+		if caPath == "" {
+			if _, err := os.Stat(DefaultKubernetesCAPath); err == nil {
+				caPath = DefaultKubernetesCAPath
+			}
+		}
+		if caPath != "" {
+			pem, err := os.ReadFile(caPath)
+			if err != nil {
+				return nil, fmt.Errorf("reading CA bundle: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in %s", caPath)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		client = &http.Client{
+			Timeout:   5 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		}
+	}
+
+	return &kubernetesAPI{
+		server:    strings.TrimSuffix(server, "/"),
+		tokenPath: tokenPath,
+		client:    depstats.Client(client, depstats.DependencyKubernetes, ""),
+	}, nil
+}
+
+// tokenReview is the subset of authentication.k8s.io/v1 TokenReview used by nauts.
+type tokenReview struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Spec       struct {
+		Token     string   `json:"token"`
+		Audiences []string `json:"audiences,omitempty"`
+	} `json:"spec"`
+	Status struct {
+		Authenticated bool `json:"authenticated"`
+		User          struct {
+			Username string              `json:"username"`
+			UID      string              `json:"uid"`
+			Extra    map[string][]string `json:"extra"`
+		} `json:"user"`
+		Audiences []string `json:"audiences"`
+		Error     string   `json:"error"`
+	} `json:"status"`
+}
+
+// reviewToken verifies token with the TokenReview API.
+func (a *kubernetesAPI) reviewToken(ctx context.Context, token, audience string) (*serviceAccount, error) {
+	review := tokenReview{APIVersion: "authentication.k8s.io/v1", Kind: "TokenReview"}
+	review.Spec.Token = token
+	review.Spec.Audiences = []string{audience}
+
+	var result tokenReview
+	if _, err := a.do(ctx, http.MethodPost, "/apis/authentication.k8s.io/v1/tokenreviews", review, &result); err != nil {
+		return nil, err
+	}
+	if !result.Status.Authenticated {
+		if result.Status.Error != "" {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidCredentials, result.Status.Error)
+		}
+		return nil, ErrInvalidCredentials
+	}
+	if !containsString(result.Status.Audiences, audience) {
+		return nil, fmt.Errorf("%w: token not issued for audience %q", ErrInvalidCredentials, audience)
+	}
+
+	username := result.Status.User.Username
+	rest, isServiceAccount := strings.CutPrefix(username, kubernetesServiceAccountPrefix)
+	namespace, name, ok := strings.Cut(rest, ":")
+	if !isServiceAccount || !ok || namespace == "" || name == "" {
+		return nil, fmt.Errorf("%w: %q is not a service account", ErrInvalidCredentials, username)
+	}
+	sa := &serviceAccount{Namespace: namespace, Name: name, UID: result.Status.User.UID}
+	if pods := result.Status.User.Extra["authentication.kubernetes.io/pod-name"]; len(pods) > 0 {
+		sa.Pod = pods[0]
+	}
+	return sa, nil
+}
+
+// annotatedRoles reads the roles annotation of the service account.
+func (a *kubernetesAPI) annotatedRoles(ctx context.Context, sa *serviceAccount) ([]Role, error) {
+	var obj struct {
+		Metadata struct {
+			UID         string            `json:"uid"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}
+	path := "/api/v1/namespaces/" + url.PathEscape(sa.Namespace) + "/serviceaccounts/" + url.PathEscape(sa.Name)
+	status, err := a.do(ctx, http.MethodGet, path, nil, &obj)
+	if status == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: service account %s/%s not found", ErrInvalidCredentials, sa.Namespace, sa.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// A service account recreated under the same name must not inherit tokens.
+	if sa.UID != "" && obj.Metadata.UID != sa.UID {
+		return nil, fmt.Errorf("%w: service account %s/%s was recreated", ErrInvalidCredentials, sa.Namespace, sa.Name)
+	}
+	return parseRolesAnnotation(obj.Metadata.Annotations[KubernetesRolesAnnotation]), nil
+}
+
+// do sends a request to the API server and decodes the JSON response into out.
+// Failures that say nothing about the presented token are reported as
+// ErrProviderUnavailable. The HTTP status is returned if a response was received.
+func (a *kubernetesAPI) do(ctx context.Context, method, path string, in, out any) (int, error) {
+	bearer, err := os.ReadFile(a.tokenPath)
+	if err != nil {
+		return 0, fmt.Errorf("%w: reading api server token: %w", ErrProviderUnavailable, err)
+	}
+
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return 0, fmt.Errorf("encoding request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.server+path, body)
+	if err != nil {
+		return 0, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(bearer)))
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%w: calling api server: %w", ErrProviderUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, kubernetesMaxResponseBytes))
+	if err != nil {
+		return resp.StatusCode, fmt.Errorf("%w: reading api server response: %w", ErrProviderUnavailable, err)
+	}
+	// 401 and 403 refer to the credentials of nauts, not of the client.
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return resp.StatusCode, fmt.Errorf("%w: api server returned HTTP %d for %s", ErrProviderUnavailable, resp.StatusCode, path)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return resp.StatusCode, fmt.Errorf("%w: decoding api server response: %w", ErrProviderUnavailable, err)
+	}
+	return resp.StatusCode, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
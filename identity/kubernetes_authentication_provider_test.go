@@ -0,0 +1,267 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testAPIServer fakes the TokenReview and ServiceAccount endpoints of a
+// Kubernetes API server.
+type testAPIServer struct {
+	*httptest.Server
+	// tokens maps valid tokens to service account user names.
+	tokens map[string]string
+	// annotations maps "<namespace>/<name>" to the roles annotation.
+	annotations map[string]string
+	status      int
+	bearer      string
+}
+
+func newTestAPIServer(t *testing.T) *testAPIServer {
+	t.Helper()
+	api := &testAPIServer{
+		tokens:      map[string]string{},
+		annotations: map[string]string{},
+		status:      http.StatusOK,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /apis/authentication.k8s.io/v1/tokenreviews", func(w http.ResponseWriter, r *http.Request) {
+		api.bearer = r.Header.Get("Authorization")
+		if api.status != http.StatusOK {
+			w.WriteHeader(api.status)
+			return
+		}
+		var review tokenReview
+		_ = json.NewDecoder(r.Body).Decode(&review)
+		if username, ok := api.tokens[review.Spec.Token]; ok {
+			review.Status.Authenticated = true
+			review.Status.User.Username = username
+			review.Status.User.UID = "uid-" + username
+			review.Status.User.Extra = map[string][]string{"authentication.kubernetes.io/pod-name": {"worker-0"}}
+			review.Status.Audiences = review.Spec.Audiences
+		} else {
+			review.Status.Error = "token is invalid"
+		}
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(review)
+	})
+	mux.HandleFunc("GET /api/v1/namespaces/{ns}/serviceaccounts/{name}", func(w http.ResponseWriter, r *http.Request) {
+		key := r.PathValue("ns") + "/" + r.PathValue("name")
+		value, ok := api.annotations[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"metadata": map[string]any{
+			"uid":         "uid-system:serviceaccount:" + r.PathValue("ns") + ":" + r.PathValue("name"),
+			"annotations": map[string]string{KubernetesRolesAnnotation: value},
+		}})
+	})
+	api.Server = httptest.NewServer(mux)
+	t.Cleanup(api.Close)
+	return api
+}
+
+func writeTokenFile(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("nauts-token\n"), 0600); err != nil {
+		t.Fatalf("writing token: %v", err)
+	}
+	return path
+}
+
+func TestKubernetesAuthenticationProvider_TokenReview(t *testing.T) {
+	api := newTestAPIServer(t)
+	api.tokens["good"] = "system:serviceaccount:orders:nauts.app.worker"
+	api.tokens["unmapped"] = "system:serviceaccount:orders:default"
+	api.tokens["user"] = "alice"
+
+	p, err := NewKubernetesAuthenticationProvider(KubernetesAuthenticationProviderConfig{
+		Accounts:  []string{"app"},
+		APIServer: api.URL,
+		TokenPath: writeTokenFile(t),
+	})
+	if err != nil {
+		t.Fatalf("NewKubernetesAuthenticationProvider() error = %v", err)
+	}
+	ctx := context.Background()
+
+	user, err := p.Verify(ctx, AuthRequest{Account: "app", Token: "good"})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if user.ID != "system:serviceaccount:orders:nauts.app.worker" {
+		t.Errorf("user.ID = %q", user.ID)
+	}
+	if len(user.Roles) != 1 || user.Roles[0] != (Role{Account: "app", Name: "worker"}) {
+		t.Errorf("user.Roles = %v, want [app.worker]", user.Roles)
+	}
+	if user.Attributes["k8s_namespace"] != "orders" || user.Attributes["k8s_pod"] != "worker-0" {
+		t.Errorf("user.Attributes = %v", user.Attributes)
+	}
+	if api.bearer != "Bearer nauts-token" {
+		t.Errorf("Authorization = %q, want the token file contents", api.bearer)
+	}
+
+	tests := []struct {
+		name    string
+		req     AuthRequest
+		wantErr error
+	}{
+		{"invalid token", AuthRequest{Account: "app", Token: "bad"}, ErrInvalidCredentials},
+		{"empty token", AuthRequest{Account: "app"}, ErrInvalidCredentials},
+		{"not a service account", AuthRequest{Account: "app", Token: "user"}, ErrInvalidCredentials},
+		{"no naming convention", AuthRequest{Account: "app", Token: "unmapped"}, ErrNoServiceAccountRoles},
+		{"other account", AuthRequest{Account: "OTHER", Token: "good"}, ErrInvalidAccount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := p.Verify(ctx, tt.req); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	api.status = http.StatusServiceUnavailable
+	if _, err := p.Verify(ctx, AuthRequest{Account: "app", Token: "good"}); !errors.Is(err, ErrProviderUnavailable) {
+		t.Errorf("Verify() with unavailable API server error = %v, want ErrProviderUnavailable", err)
+	}
+}
+
+func TestKubernetesAuthenticationProvider_Annotations(t *testing.T) {
+	api := newTestAPIServer(t)
+	api.tokens["good"] = "system:serviceaccount:orders:processor"
+	api.tokens["deleted"] = "system:serviceaccount:orders:gone"
+	api.annotations["orders/processor"] = "APP.worker, APP.reader,invalid"
+
+	p, err := NewKubernetesAuthenticationProvider(KubernetesAuthenticationProviderConfig{
+		Accounts:    []string{"APP"},
+		APIServer:   api.URL,
+		TokenPath:   writeTokenFile(t),
+		Annotations: true,
+	})
+	if err != nil {
+		t.Fatalf("NewKubernetesAuthenticationProvider() error = %v", err)
+	}
+
+	user, err := p.Verify(context.Background(), AuthRequest{Account: "APP", Token: "good"})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	want := []Role{{Account: "APP", Name: "worker"}, {Account: "APP", Name: "reader"}}
+	if len(user.Roles) != len(want) || user.Roles[0] != want[0] || user.Roles[1] != want[1] {
+		t.Errorf("user.Roles = %v, want %v", user.Roles, want)
+	}
+
+	if _, err := p.Verify(context.Background(), AuthRequest{Account: "APP", Token: "deleted"}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Verify() for deleted service account error = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func signServiceAccountToken(t *testing.T, key *rsa.PrivateKey, issuer, audience, namespace, name string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": issuer,
+		"aud": []string{audience},
+		"sub": "system:serviceaccount:" + namespace + ":" + name,
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"kubernetes.io": map[string]any{
+			"namespace":      namespace,
+			"serviceaccount": map[string]any{"name": name, "uid": "sa-uid"},
+			"pod":            map[string]any{"name": "worker-0", "uid": "pod-uid"},
+		},
+	})
+	token.Header["kid"] = "k1"
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return s
+}
+
+func TestKubernetesAuthenticationProvider_JWKS(t *testing.T) {
+	idp := newTestIdP(t)
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	idp.setKeys(http.StatusOK, rsaJWK("k1", &key.PublicKey))
+
+	p, err := NewKubernetesAuthenticationProvider(KubernetesAuthenticationProviderConfig{
+		Accounts:     []string{"app"},
+		Verification: KubernetesVerificationJWKS,
+		Issuer:       idp.URL,
+	})
+	if err != nil {
+		t.Fatalf("NewKubernetesAuthenticationProvider() error = %v", err)
+	}
+	_ = p.Stop()
+	ctx := context.Background()
+
+	token := signServiceAccountToken(t, key, idp.URL, "nauts", "orders", "nauts.app.worker")
+	user, err := p.Verify(ctx, AuthRequest{Account: "app", Token: token})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if user.Attributes["k8s_uid"] != "sa-uid" || user.Attributes["k8s_pod"] != "worker-0" {
+		t.Errorf("user.Attributes = %v", user.Attributes)
+	}
+
+	wrongAudience := signServiceAccountToken(t, key, idp.URL, "https://kubernetes.default.svc", "orders", "nauts.app.worker")
+	if _, err := p.Verify(ctx, AuthRequest{Account: "app", Token: wrongAudience}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Verify() with wrong audience error = %v, want ErrInvalidCredentials", err)
+	}
+	wrongIssuer := signServiceAccountToken(t, key, "https://other.example.com", "nauts", "orders", "nauts.app.worker")
+	if _, err := p.Verify(ctx, AuthRequest{Account: "app", Token: wrongIssuer}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Verify() with wrong issuer error = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestNewKubernetesAuthenticationProvider_Validation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  KubernetesAuthenticationProviderConfig
+	}{
+		{"unknown verification", KubernetesAuthenticationProviderConfig{Verification: "oidc"}},
+		{"jwks without issuer", KubernetesAuthenticationProviderConfig{Verification: KubernetesVerificationJWKS}},
+		{"invalid api server", KubernetesAuthenticationProviderConfig{APIServer: "kubernetes.default.svc"}},
+		{"missing ca", KubernetesAuthenticationProviderConfig{CAPath: "/nonexistent/ca.crt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewKubernetesAuthenticationProvider(tt.cfg); err == nil {
+				t.Error("NewKubernetesAuthenticationProvider() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestRoleFromServiceAccountName(t *testing.T) {
+	tests := []struct {
+		name string
+		want Role
+		ok   bool
+	}{
+		{"nauts.app.worker", Role{Account: "app", Name: "worker"}, true},
+		{"nauts.APP.worker", Role{Account: "APP", Name: "worker"}, true},
+		{"default", Role{}, false},
+		{"nauts.app", Role{}, false},
+		{"other.app.worker", Role{}, false},
+		{"nauts.app.worker.extra", Role{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := roleFromServiceAccountName(tt.name)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("roleFromServiceAccountName(%q) = %v, %v, want %v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
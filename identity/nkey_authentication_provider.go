@@ -0,0 +1,170 @@
+package identity
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/nats-io/nkeys"
+
+	"github.com/msimon/nauts/strictjson"
+)
+
+// NkeyIdentity is the identity of a user nkey.
+type NkeyIdentity struct {
+	// ID is the user ID. Empty uses the public key.
+	ID         string            `json:"id,omitempty"`
+	Accounts   []string          `json:"accounts"`
+	Roles      []string          `json:"roles"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// NkeyIdentityStore looks up the identity of a user public key, e.g. in a
+// NATS KV bucket. GetIdentity returns ErrUserNotFound for unknown keys.
+type NkeyIdentityStore interface {
+	GetIdentity(ctx context.Context, publicKey string) (*NkeyIdentity, error)
+}
+
+// nkeysFile represents the keys JSON file structure.
+type nkeysFile struct {
+	Keys map[string]*NkeyIdentity `json:"keys"`
+}
+
+// NkeyAuthenticationProviderConfig holds configuration for NkeyAuthenticationProvider.
+type NkeyAuthenticationProviderConfig struct {
+	// Accounts is the list of NATS accounts this provider can manage.
+	// Patterns support wildcards in the form of "*" (all) or "prefix*".
+	Accounts []string
+	// KeysPath is the path to a JSON file mapping user public keys to
+	// identities: {"keys": {"U...": {"accounts": [...], "roles": [...]}}}.
+	KeysPath string
+	// Store looks up identities instead of KeysPath. It is stopped by Stop
+	// if it has a Stop method.
+	Store NkeyIdentityStore
+}
+
+// NkeyAuthenticationProvider implements AuthenticationProvider for clients
+// that connect with a user nkey. The token is the public key, which must
+// have signed the nonce of the connection; no secret is ever sent.
+type NkeyAuthenticationProvider struct {
+	keys               map[string]*NkeyIdentity
+	store              NkeyIdentityStore
+	manageableAccounts []string
+}
+
+// NewNkeyAuthenticationProvider creates a new NkeyAuthenticationProvider.
+// Exactly one of cfg.KeysPath and cfg.Store must be set.
+func NewNkeyAuthenticationProvider(cfg NkeyAuthenticationProviderConfig) (*NkeyAuthenticationProvider, error) {
+	if (cfg.KeysPath == "") == (cfg.Store == nil) {
+		return nil, errors.New("exactly one of keys path and store is required")
+	}
+	p := &NkeyAuthenticationProvider{
+		store:              cfg.Store,
+		manageableAccounts: append([]string(nil), cfg.Accounts...),
+	}
+	if cfg.KeysPath != "" {
+		data, err := os.ReadFile(cfg.KeysPath)
+		if err != nil {
+			return nil, err
+		}
+		var file nkeysFile
+		if err := strictjson.Unmarshal(data, &file); err != nil {
+			return nil, err
+		}
+		for key := range file.Keys {
+			if !nkeys.IsValidPublicUserKey(key) {
+				return nil, fmt.Errorf("%s is not a user public key", key)
+			}
+		}
+		p.keys = file.Keys
+	}
+	return p, nil
+}
+
+// Stop stops the identity store, if it has a Stop method.
+func (p *NkeyAuthenticationProvider) Stop() error {
+	if s, ok := p.store.(interface{ Stop() error }); ok {
+		return s.Stop()
+	}
+	return nil
+}
+
+// ManageableAccounts returns the list of account patterns this provider can manage.
+func (p *NkeyAuthenticationProvider) ManageableAccounts() []string {
+	return append([]string(nil), p.manageableAccounts...)
+}
+
+// Verify checks that the user public key in the token signed the nonce and
+// returns the user it is mapped to.
+// Returns ErrInvalidTokenType if the token is not a user public key.
+// Returns ErrInvalidCredentials if the nonce signature is missing or invalid.
+// Returns ErrUserNotFound if the key is not mapped to a user.
+// Returns ErrInvalidAccount if the requested account is not valid for the user.
+func (p *NkeyAuthenticationProvider) Verify(ctx context.Context, req AuthRequest) (*User, error) {
+	if !nkeys.IsValidPublicUserKey(req.Token) {
+		return nil, ErrInvalidTokenType
+	}
+	if req.Nonce == "" || req.SignedNonce == "" {
+		return nil, fmt.Errorf("%w: missing nonce signature", ErrInvalidCredentials)
+	}
+	// NATS clients encode the signature as raw URL base64; the server
+	// also accepts standard base64.
+	sig, err := base64.RawURLEncoding.DecodeString(req.SignedNonce)
+	if err != nil {
+		sig, err = base64.StdEncoding.DecodeString(req.SignedNonce)
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed nonce signature", ErrInvalidCredentials)
+		}
+	}
+	pub, err := nkeys.FromPublicKey(req.Token)
+	if err != nil {
+		return nil, ErrInvalidTokenType
+	}
+	if err := pub.Verify([]byte(req.Nonce), sig); err != nil {
+		return nil, fmt.Errorf("%w: invalid nonce signature", ErrInvalidCredentials)
+	}
+
+	var ident *NkeyIdentity
+	if p.store != nil {
+		ident, err = p.store.GetIdentity(ctx, req.Token)
+		if err != nil {
+			return nil, err
+		}
+	} else if ident = p.keys[req.Token]; ident == nil {
+		return nil, ErrUserNotFound
+	}
+
+	if !contains(ident.Accounts, req.Account) {
+		return nil, ErrInvalidAccount
+	}
+
+	var roles []Role
+	for _, roleID := range ident.Roles {
+		role, err := ParseRoleID(roleID)
+		if err != nil {
+			// Skip invalid role IDs
+			continue
+		}
+		roles = append(roles, role)
+	}
+
+	var attributes map[string]string
+	if len(ident.Attributes) > 0 {
+		attributes = make(map[string]string, len(ident.Attributes))
+		for k, v := range ident.Attributes {
+			attributes[k] = v
+		}
+	}
+
+	id := ident.ID
+	if id == "" {
+		id = req.Token
+	}
+	return &User{
+		ID:         id,
+		Roles:      roles,
+		Attributes: attributes,
+	}, nil
+}
@@ -0,0 +1,147 @@
+package identity
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nats-io/nkeys"
+)
+
+func TestNkeyAuthenticationProvider_Verify(t *testing.T) {
+	userKp, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatalf("creating user keypair: %v", err)
+	}
+	userPub, _ := userKp.PublicKey()
+	otherKp, _ := nkeys.CreateUser()
+	otherPub, _ := otherKp.PublicKey()
+	accountKp, _ := nkeys.CreateAccount()
+	accountPub, _ := accountKp.PublicKey()
+
+	nonce := "server-nonce"
+	sign := func(kp nkeys.KeyPair) string {
+		return base64.RawURLEncoding.EncodeToString(mustSign(t, kp, nonce))
+	}
+
+	keysPath := filepath.Join(t.TempDir(), "nkeys.json")
+	keys := `{"keys": {"` + userPub + `": {"id": "sensor-1", "accounts": ["APP"], "roles": ["APP.sensors", "invalid"], "attributes": {"site": "berlin"}}}}`
+	if err := os.WriteFile(keysPath, []byte(keys), 0600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewNkeyAuthenticationProvider(NkeyAuthenticationProviderConfig{Accounts: []string{"APP"}, KeysPath: keysPath})
+	if err != nil {
+		t.Fatalf("NewNkeyAuthenticationProvider() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		req     AuthRequest
+		wantErr error
+	}{
+		{name: "signed nonce", req: AuthRequest{Account: "APP", Token: userPub, Nonce: nonce, SignedNonce: sign(userKp)}},
+		{name: "standard base64 signature", req: AuthRequest{Account: "APP", Token: userPub, Nonce: nonce, SignedNonce: base64.StdEncoding.EncodeToString(mustSign(t, userKp, nonce))}},
+		{name: "signed by another key", req: AuthRequest{Account: "APP", Token: userPub, Nonce: nonce, SignedNonce: sign(otherKp)}, wantErr: ErrInvalidCredentials},
+		{name: "other nonce", req: AuthRequest{Account: "APP", Token: userPub, Nonce: "other", SignedNonce: sign(userKp)}, wantErr: ErrInvalidCredentials},
+		{name: "missing signature", req: AuthRequest{Account: "APP", Token: userPub, Nonce: nonce}, wantErr: ErrInvalidCredentials},
+		{name: "malformed signature", req: AuthRequest{Account: "APP", Token: userPub, Nonce: nonce, SignedNonce: "!!"}, wantErr: ErrInvalidCredentials},
+		{name: "unknown key", req: AuthRequest{Account: "APP", Token: otherPub, Nonce: nonce, SignedNonce: sign(otherKp)}, wantErr: ErrUserNotFound},
+		{name: "account key", req: AuthRequest{Account: "APP", Token: accountPub, Nonce: nonce, SignedNonce: sign(accountKp)}, wantErr: ErrInvalidTokenType},
+		{name: "password token", req: AuthRequest{Account: "APP", Token: "alice:secret"}, wantErr: ErrInvalidTokenType},
+		{name: "account not mapped", req: AuthRequest{Account: "OTHER", Token: userPub, Nonce: nonce, SignedNonce: sign(userKp)}, wantErr: ErrInvalidAccount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := p.Verify(context.Background(), tt.req)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if user.ID != "sensor-1" || len(user.Roles) != 1 || user.Roles[0] != (Role{Account: "APP", Name: "sensors"}) || user.Attributes["site"] != "berlin" {
+				t.Errorf("Verify() = %+v, want sensor-1 with role APP.sensors and site berlin", user)
+			}
+		})
+	}
+}
+
+func TestNkeyAuthenticationProvider_Store(t *testing.T) {
+	userKp, _ := nkeys.CreateUser()
+	userPub, _ := userKp.PublicKey()
+	store := &testNkeyStore{identities: map[string]*NkeyIdentity{userPub: {Accounts: []string{"APP"}}}}
+
+	p, err := NewNkeyAuthenticationProvider(NkeyAuthenticationProviderConfig{Accounts: []string{"APP"}, Store: store})
+	if err != nil {
+		t.Fatalf("NewNkeyAuthenticationProvider() error = %v", err)
+	}
+	sig := base64.RawURLEncoding.EncodeToString(mustSign(t, userKp, "nonce"))
+	user, err := p.Verify(context.Background(), AuthRequest{Account: "APP", Token: userPub, Nonce: "nonce", SignedNonce: sig})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if user.ID != userPub {
+		t.Errorf("ID = %s, want the public key", user.ID)
+	}
+
+	if err := p.Stop(); err != nil || !store.stopped {
+		t.Errorf("Stop() = %v, stopped store = %v", err, store.stopped)
+	}
+}
+
+func TestNewNkeyAuthenticationProvider_Errors(t *testing.T) {
+	dir := t.TempDir()
+	badKeys := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(badKeys, []byte(`{"keys": {"alice": {"accounts": ["APP"]}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  NkeyAuthenticationProviderConfig
+	}{
+		{name: "no source", cfg: NkeyAuthenticationProviderConfig{}},
+		{name: "both sources", cfg: NkeyAuthenticationProviderConfig{KeysPath: badKeys, Store: &testNkeyStore{}}},
+		{name: "missing file", cfg: NkeyAuthenticationProviderConfig{KeysPath: filepath.Join(dir, "missing.json")}},
+		{name: "not a user key", cfg: NkeyAuthenticationProviderConfig{KeysPath: badKeys}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewNkeyAuthenticationProvider(tt.cfg); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+type testNkeyStore struct {
+	identities map[string]*NkeyIdentity
+	stopped    bool
+}
+
+func (s *testNkeyStore) GetIdentity(_ context.Context, publicKey string) (*NkeyIdentity, error) {
+	if ident, ok := s.identities[publicKey]; ok {
+		return ident, nil
+	}
+	return nil, ErrUserNotFound
+}
+
+func (s *testNkeyStore) Stop() error {
+	s.stopped = true
+	return nil
+}
+
+func mustSign(t *testing.T, kp nkeys.KeyPair, nonce string) []byte {
+	t.Helper()
+	sig, err := kp.Sign([]byte(nonce))
+	if err != nil {
+		t.Fatalf("signing nonce: %v", err)
+	}
+	return sig
+}
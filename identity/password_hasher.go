@@ -0,0 +1,246 @@
+package identity
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms.
+const (
+	// PasswordAlgorithmBcrypt hashes passwords with bcrypt.
+	PasswordAlgorithmBcrypt = "bcrypt"
+
+	// PasswordAlgorithmArgon2id hashes passwords with Argon2id (RFC 9106).
+	PasswordAlgorithmArgon2id = "argon2id"
+)
+
+// ErrUnsupportedPasswordHash is returned when a stored hash does not match any known algorithm.
+var ErrUnsupportedPasswordHash = errors.New("unsupported password hash")
+
+// PasswordHashingConfig configures how user passwords are hashed.
+//
+// When RehashOnLogin is set, a successful login with a hash that does not
+// match the configured algorithm or cost is transparently upgraded.
+type PasswordHashingConfig struct {
+	// Algorithm is the hashing algorithm for new hashes. Default: "bcrypt".
+	Algorithm string `json:"algorithm,omitempty"`
+	// Cost is the algorithm-specific work factor: the bcrypt cost (default
+	// 10), or the number of Argon2id passes (default 3).
+	Cost int `json:"cost,omitempty"`
+	// RehashOnLogin upgrades outdated hashes after a successful login.
+	RehashOnLogin bool `json:"rehashOnLogin,omitempty"`
+}
+
+// PasswordHasher hashes and verifies passwords for a single algorithm.
+type PasswordHasher interface {
+	// Algorithm returns the algorithm name (e.g., "bcrypt").
+	Algorithm() string
+
+	// Hash returns a new hash for password using the configured parameters.
+	Hash(password string) (string, error)
+
+	// Compare verifies password against hash.
+	// Returns ErrInvalidCredentials if the password does not match.
+	Compare(hash, password string) error
+
+	// Identifies returns true if hash was produced by this algorithm.
+	Identifies(hash string) bool
+
+	// NeedsRehash returns true if hash was produced with different parameters
+	// than the configured ones.
+	NeedsRehash(hash string) bool
+}
+
+// passwordHasherFactories maps algorithm names to hasher constructors.
+// A cost of 0 selects the algorithm default.
+var passwordHasherFactories = map[string]func(cost int) (PasswordHasher, error){
+	PasswordAlgorithmBcrypt:   newBcryptHasher,
+	PasswordAlgorithmArgon2id: newArgon2idHasher,
+}
+
+// NewPasswordHasher returns the hasher for the configured algorithm.
+func NewPasswordHasher(cfg PasswordHashingConfig) (PasswordHasher, error) {
+	algorithm := strings.ToLower(strings.TrimSpace(cfg.Algorithm))
+	if algorithm == "" {
+		algorithm = PasswordAlgorithmBcrypt
+	}
+	factory, ok := passwordHasherFactories[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported password hashing algorithm: %s", cfg.Algorithm)
+	}
+	return factory(cfg.Cost)
+}
+
+// verifyPasswordHash verifies password against hash using whichever known
+// algorithm produced the hash. The configured hasher is tried first.
+func verifyPasswordHash(configured PasswordHasher, hash, password string) error {
+	if configured != nil && configured.Identifies(hash) {
+		return configured.Compare(hash, password)
+	}
+	for _, factory := range passwordHasherFactories {
+		h, err := factory(0)
+		if err != nil {
+			continue
+		}
+		if h.Identifies(hash) {
+			return h.Compare(hash, password)
+		}
+	}
+	return ErrUnsupportedPasswordHash
+}
+
+// bcryptHasher implements PasswordHasher using bcrypt.
+type bcryptHasher struct {
+	cost int
+}
+
+func newBcryptHasher(cost int) (PasswordHasher, error) {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return &bcryptHasher{cost: cost}, nil
+}
+
+func (h *bcryptHasher) Algorithm() string {
+	return PasswordAlgorithmBcrypt
+}
+
+func (h *bcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h *bcryptHasher) Compare(hash, password string) error {
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+func (h *bcryptHasher) Identifies(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (h *bcryptHasher) NeedsRehash(hash string) bool {
+	if !h.Identifies(hash) {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return true
+	}
+	return cost != h.cost
+}
+
+// Argon2id parameters other than the number of passes, as recommended by
+// RFC 9106 for memory-constrained environments.
+const (
+	argon2idMemory      = 64 * 1024 // KiB
+	argon2idParallelism = 4
+	argon2idSaltLength  = 16
+	argon2idKeyLength   = 32
+
+	defaultArgon2idPasses = 3
+	maxArgon2idPasses     = 100
+)
+
+// argon2idHasher implements PasswordHasher using Argon2id. Hashes use the
+// PHC string format: $argon2id$v=19$m=<KiB>,t=<passes>,p=<lanes>$<salt>$<key>.
+type argon2idHasher struct {
+	passes uint32
+}
+
+func newArgon2idHasher(cost int) (PasswordHasher, error) {
+	if cost == 0 {
+		cost = defaultArgon2idPasses
+	}
+	if cost < 1 || cost > maxArgon2idPasses {
+		return nil, fmt.Errorf("argon2id cost must be between 1 and %d", maxArgon2idPasses)
+	}
+	return &argon2idHasher{passes: uint32(cost)}, nil
+}
+
+// argon2idParams are the parameters of an Argon2id hash.
+type argon2idParams struct {
+	memory, passes uint32
+	parallelism    uint8
+	salt, key      []byte
+}
+
+// parseArgon2id parses a hash in PHC string format.
+func parseArgon2id(hash string) (*argon2idParams, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != PasswordAlgorithmArgon2id {
+		return nil, ErrUnsupportedPasswordHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, ErrUnsupportedPasswordHash
+	}
+	var p argon2idParams
+	// argon2.IDKey panics without passes or lanes.
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.passes, &p.parallelism); err != nil || p.passes == 0 || p.parallelism == 0 {
+		return nil, ErrUnsupportedPasswordHash
+	}
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, ErrUnsupportedPasswordHash
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(p.key) == 0 {
+		return nil, ErrUnsupportedPasswordHash
+	}
+	return &p, nil
+}
+
+func (h *argon2idHasher) Algorithm() string {
+	return PasswordAlgorithmArgon2id
+}
+
+func (h *argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2idSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.passes, argon2idMemory, argon2idParallelism, argon2idKeyLength)
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", PasswordAlgorithmArgon2id, argon2.Version,
+		argon2idMemory, h.passes, argon2idParallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *argon2idHasher) Compare(hash, password string) error {
+	p, err := parseArgon2id(hash)
+	if err != nil {
+		return ErrInvalidCredentials
+	}
+	key := argon2.IDKey([]byte(password), p.salt, p.passes, p.memory, p.parallelism, uint32(len(p.key)))
+	if subtle.ConstantTimeCompare(key, p.key) != 1 {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+func (h *argon2idHasher) Identifies(hash string) bool {
+	return strings.HasPrefix(hash, "$"+PasswordAlgorithmArgon2id+"$")
+}
+
+func (h *argon2idHasher) NeedsRehash(hash string) bool {
+	p, err := parseArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return p.memory != argon2idMemory || p.passes != h.passes || p.parallelism != argon2idParallelism ||
+		len(p.salt) != argon2idSaltLength || len(p.key) != argon2idKeyLength
+}
@@ -0,0 +1,126 @@
+package identity
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestNewPasswordHasher_Default(t *testing.T) {
+	h, err := NewPasswordHasher(PasswordHashingConfig{})
+	if err != nil {
+		t.Fatalf("NewPasswordHasher() error = %v", err)
+	}
+	if h.Algorithm() != PasswordAlgorithmBcrypt {
+		t.Errorf("Algorithm() = %q, want %q", h.Algorithm(), PasswordAlgorithmBcrypt)
+	}
+}
+
+func TestNewPasswordHasher_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  PasswordHashingConfig
+	}{
+		{"unknown algorithm", PasswordHashingConfig{Algorithm: "md5"}},
+		{"bcrypt cost too low", PasswordHashingConfig{Algorithm: "bcrypt", Cost: 1}},
+		{"bcrypt cost too high", PasswordHashingConfig{Algorithm: "bcrypt", Cost: 99}},
+		{"argon2id cost too high", PasswordHashingConfig{Algorithm: "argon2id", Cost: 101}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewPasswordHasher(tt.cfg); err == nil {
+				t.Error("NewPasswordHasher() expected error")
+			}
+		})
+	}
+}
+
+func TestBcryptHasher_HashAndCompare(t *testing.T) {
+	h, err := NewPasswordHasher(PasswordHashingConfig{Cost: bcrypt.MinCost})
+	if err != nil {
+		t.Fatalf("NewPasswordHasher() error = %v", err)
+	}
+
+	hash, err := h.Hash("secret")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	if !h.Identifies(hash) {
+		t.Errorf("Identifies(%q) = false, want true", hash)
+	}
+	if err := h.Compare(hash, "secret"); err != nil {
+		t.Errorf("Compare() error = %v", err)
+	}
+	if err := h.Compare(hash, "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Compare() error = %v, want %v", err, ErrInvalidCredentials)
+	}
+	if h.NeedsRehash(hash) {
+		t.Error("NeedsRehash() = true for hash with configured cost")
+	}
+}
+
+func TestBcryptHasher_NeedsRehash(t *testing.T) {
+	h, _ := NewPasswordHasher(PasswordHashingConfig{Cost: bcrypt.MinCost + 1})
+
+	oldHash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if !h.NeedsRehash(string(oldHash)) {
+		t.Error("NeedsRehash() = false for hash with different cost")
+	}
+	if !h.NeedsRehash("not-a-hash") {
+		t.Error("NeedsRehash() = false for unknown hash format")
+	}
+}
+
+func TestArgon2idHasher_HashAndCompare(t *testing.T) {
+	h, err := NewPasswordHasher(PasswordHashingConfig{Algorithm: PasswordAlgorithmArgon2id, Cost: 1})
+	if err != nil {
+		t.Fatalf("NewPasswordHasher() error = %v", err)
+	}
+
+	hash, err := h.Hash("secret")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	if !h.Identifies(hash) {
+		t.Errorf("Identifies(%q) = false, want true", hash)
+	}
+	if err := h.Compare(hash, "secret"); err != nil {
+		t.Errorf("Compare() error = %v", err)
+	}
+	if err := h.Compare(hash, "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Compare() error = %v, want %v", err, ErrInvalidCredentials)
+	}
+	if h.NeedsRehash(hash) {
+		t.Error("NeedsRehash() = true for hash with configured cost")
+	}
+
+	stronger, _ := NewPasswordHasher(PasswordHashingConfig{Algorithm: PasswordAlgorithmArgon2id, Cost: 2})
+	if !stronger.NeedsRehash(hash) {
+		t.Error("NeedsRehash() = false for hash with different cost")
+	}
+	bcryptHasher, _ := NewPasswordHasher(PasswordHashingConfig{Cost: bcrypt.MinCost})
+	if !bcryptHasher.NeedsRehash(hash) {
+		t.Error("NeedsRehash() = false for hash of another algorithm")
+	}
+}
+
+func TestVerifyPasswordHash_OtherAlgorithm(t *testing.T) {
+	argon2id, _ := NewPasswordHasher(PasswordHashingConfig{Algorithm: PasswordAlgorithmArgon2id, Cost: 1})
+	hash, _ := argon2id.Hash("secret")
+
+	configured, _ := NewPasswordHasher(PasswordHashingConfig{})
+	if err := verifyPasswordHash(configured, hash, "secret"); err != nil {
+		t.Errorf("verifyPasswordHash() error = %v", err)
+	}
+	if err := verifyPasswordHash(configured, "$argon2id$v=19$m=65536,t=0,p=4$c2FsdA$a2V5", "secret"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("verifyPasswordHash() error = %v, want %v for malformed hash", err, ErrInvalidCredentials)
+	}
+}
+
+func TestVerifyPasswordHash_Unsupported(t *testing.T) {
+	h, _ := NewPasswordHasher(PasswordHashingConfig{})
+	if err := verifyPasswordHash(h, "plaintext", "plaintext"); !errors.Is(err, ErrUnsupportedPasswordHash) {
+		t.Errorf("verifyPasswordHash() error = %v, want %v", err, ErrUnsupportedPasswordHash)
+	}
+}
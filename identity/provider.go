@@ -3,6 +3,8 @@ package identity
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/netip"
 )
 
 // Sentinel errors for identity operations.
@@ -18,15 +20,31 @@ var (
 
 	// ErrInvalidAccount is returned when the requested account is not valid for the user.
 	ErrInvalidAccount = errors.New("invalid account for user")
+
+	// ErrProviderUnavailable is returned when the provider cannot reach the
+	// backend it verifies credentials against (e.g., AWS STS).
+	ErrProviderUnavailable = errors.New("provider unavailable")
+
+	// ErrUnsupportedAuthRequestVersion is returned for auth requests with a
+	// version newer than AuthRequestVersion.
+	ErrUnsupportedAuthRequestVersion = errors.New("unsupported auth request version")
 )
 
+// AuthRequestVersion is the newest auth request version understood by nauts.
+// Requests without a version are treated as version 1.
+const AuthRequestVersion = 1
+
 // AuthRequest represents the parsed authentication request from the token.
 // The token is expected to be a JSON object with the following structure:
 //
-//	{ "account": "ACME", "token": "username:password", "ap": "provider-id" }
+//	{ "v": 1, "account": "ACME", "token": "username:password", "ap": "provider-id" }
 //
-// The account field is required.
+// The account field is required. Unknown fields are ignored, so later versions
+// can add optional fields that older servers skip.
 type AuthRequest struct {
+	// Version is the envelope version ("v"). 0 means the request predates
+	// versioning and is treated as version 1.
+	Version int `json:"v,omitempty"`
 	// Account is the requested account (required).
 	Account string `json:"account"`
 	// Token is the authentication token (e.g., "username:password").
@@ -34,6 +52,23 @@ type AuthRequest struct {
 	// AP is an optional authentication provider id.
 	// If set, the authentication request is routed to that provider.
 	AP string `json:"ap,omitempty"`
+	// ClientIP is the source address of the client as reported by the NATS server.
+	// It is never read from the token; the zero value means unknown.
+	ClientIP netip.Addr `json:"-"`
+	// Nonce is the nonce the NATS server sent to the client, and SignedNonce
+	// the client's signature of it with the user nkey in Token. Like
+	// ClientIP, they are never read from the token.
+	Nonce       string `json:"-"`
+	SignedNonce string `json:"-"`
+}
+
+// CheckVersion returns ErrUnsupportedAuthRequestVersion if the request uses a
+// version this server does not understand.
+func (r AuthRequest) CheckVersion() error {
+	if r.Version < 0 || r.Version > AuthRequestVersion {
+		return fmt.Errorf("%w: %d (supported: 1-%d)", ErrUnsupportedAuthRequestVersion, r.Version, AuthRequestVersion)
+	}
+	return nil
 }
 
 // AuthenticationProvider resolves user identity from an authentication request.
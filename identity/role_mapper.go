@@ -0,0 +1,136 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// RoleMapper post-processes the roles of a user verified by an
+// AuthenticationProvider, e.g. to map the groups of an enterprise directory
+// ("eng-platform") to nauts roles ("APP.workers").
+type RoleMapper interface {
+	// MapRoles returns the roles the user gets, based on its Roles and Groups.
+	MapRoles(ctx context.Context, user *User) ([]Role, error)
+}
+
+// RoleMapperFunc adapts a function to RoleMapper.
+type RoleMapperFunc func(ctx context.Context, user *User) ([]Role, error)
+
+// MapRoles implements RoleMapper.
+func (f RoleMapperFunc) MapRoles(ctx context.Context, user *User) ([]Role, error) {
+	return f(ctx, user)
+}
+
+// RoleMappingConfig configures the RoleMapper returned by NewRoleMapper.
+type RoleMappingConfig struct {
+	// Mappings maps a group or a role ID ("<account>.<role>") of the user to
+	// role IDs, e.g. {"eng-platform": ["APP.workers", "OPS.viewer"]}. A role
+	// of the user that is mapped is replaced by its mapping.
+	Mappings map[string][]string `json:"mappings"`
+
+	// DropUnmapped discards the roles of the user that are not mapped, so
+	// only mapped roles are granted. By default they are kept.
+	DropUnmapped bool `json:"dropUnmapped,omitempty"`
+}
+
+// staticRoleMapper implements RoleMapper with a fixed mapping.
+type staticRoleMapper struct {
+	mappings     map[string][]Role
+	dropUnmapped bool
+}
+
+// NewRoleMapper returns a RoleMapper that maps groups and roles as configured.
+// Mapped role IDs must be valid and must not contain wildcards.
+func NewRoleMapper(cfg RoleMappingConfig) (RoleMapper, error) {
+	if len(cfg.Mappings) == 0 {
+		return nil, fmt.Errorf("mappings must contain at least one mapping")
+	}
+	keys := make([]string, 0, len(cfg.Mappings))
+	for key := range cfg.Mappings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	m := &staticRoleMapper{mappings: make(map[string][]Role, len(cfg.Mappings)), dropUnmapped: cfg.DropUnmapped}
+	for _, key := range keys {
+		if strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("mappings: group is required")
+		}
+		roles := make([]Role, 0, len(cfg.Mappings[key]))
+		for _, roleID := range cfg.Mappings[key] {
+			role, err := ParseRoleID(roleID)
+			if err != nil {
+				return nil, fmt.Errorf("mappings[%s]: %w", key, err)
+			}
+			if role.HasWildcard() {
+				return nil, fmt.Errorf("mappings[%s]: role %q must not contain wildcards", key, roleID)
+			}
+			roles = append(roles, role)
+		}
+		m.mappings[key] = roles
+	}
+	return m, nil
+}
+
+// MapRoles implements RoleMapper. Roles are returned in the order of the
+// user's roles, followed by those of its groups, without duplicates.
+func (m *staticRoleMapper) MapRoles(_ context.Context, user *User) ([]Role, error) {
+	var roles []Role
+	add := func(rs ...Role) {
+		for _, r := range rs {
+			if !slices.Contains(roles, r) {
+				roles = append(roles, r)
+			}
+		}
+	}
+	for _, role := range user.Roles {
+		if mapped, ok := m.mappings[role.String()]; ok {
+			add(mapped...)
+		} else if !m.dropUnmapped {
+			add(role)
+		}
+	}
+	for _, group := range user.Groups {
+		add(m.mappings[group]...)
+	}
+	return roles, nil
+}
+
+// roleMappingProvider applies a RoleMapper to the users of an
+// AuthenticationProvider.
+type roleMappingProvider struct {
+	AuthenticationProvider
+	mapper RoleMapper
+}
+
+// NewRoleMappingProvider wraps p so that the roles of the users it verifies
+// are replaced by the roles mapper returns for them. The user returned by p is
+// copied, not modified.
+func NewRoleMappingProvider(p AuthenticationProvider, mapper RoleMapper) AuthenticationProvider {
+	return &roleMappingProvider{AuthenticationProvider: p, mapper: mapper}
+}
+
+func (p *roleMappingProvider) Verify(ctx context.Context, req AuthRequest) (*User, error) {
+	user, err := p.AuthenticationProvider.Verify(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := p.mapper.MapRoles(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("mapping roles of %s: %w", user.ID, err)
+	}
+	mapped := *user
+	mapped.Roles = roles
+	return &mapped, nil
+}
+
+// Stop stops the wrapped provider if it holds resources.
+func (p *roleMappingProvider) Stop() error {
+	if s, ok := p.AuthenticationProvider.(interface{ Stop() error }); ok {
+		return s.Stop()
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestNewRoleMapper(t *testing.T) {
+	mapper, err := NewRoleMapper(RoleMappingConfig{Mappings: map[string][]string{
+		"eng-platform": {"APP.workers", "OPS.viewer"},
+		"eng-all":      {"APP.workers"},
+		"APP.legacy":   {"APP.readonly"},
+	}})
+	if err != nil {
+		t.Fatalf("NewRoleMapper() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mapper RoleMapper
+		user   User
+		want   []string
+	}{
+		{
+			name: "groups",
+			user: User{Groups: []string{"eng-platform", "eng-all", "unknown"}},
+			want: []string{"APP.workers", "OPS.viewer"},
+		},
+		{
+			name: "roles are kept or replaced",
+			user: User{Roles: []Role{{Account: "APP", Name: "admin"}, {Account: "APP", Name: "legacy"}}, Groups: []string{"eng-all"}},
+			want: []string{"APP.admin", "APP.readonly", "APP.workers"},
+		},
+		{
+			name:   "unmapped roles dropped",
+			mapper: mustRoleMapper(t, RoleMappingConfig{Mappings: map[string][]string{"eng-all": {"APP.workers"}}, DropUnmapped: true}),
+			user:   User{Roles: []Role{{Account: "APP", Name: "admin"}}, Groups: []string{"eng-all"}},
+			want:   []string{"APP.workers"},
+		},
+		{
+			name: "nothing mapped",
+			user: User{Groups: []string{"unknown"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := tt.mapper
+			if m == nil {
+				m = mapper
+			}
+			roles, err := m.MapRoles(context.Background(), &tt.user)
+			if err != nil {
+				t.Fatalf("MapRoles() error = %v", err)
+			}
+			var got []string
+			for _, r := range roles {
+				got = append(got, r.String())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("MapRoles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, cfg := range []RoleMappingConfig{
+		{},
+		{Mappings: map[string][]string{" ": {"APP.workers"}}},
+		{Mappings: map[string][]string{"eng": {"workers"}}},
+		{Mappings: map[string][]string{"eng": {"APP.*"}}},
+	} {
+		if _, err := NewRoleMapper(cfg); err == nil {
+			t.Errorf("NewRoleMapper(%v) succeeded, want error", cfg.Mappings)
+		}
+	}
+}
+
+func TestRoleMappingProvider(t *testing.T) {
+	inner := &staticProvider{user: &User{ID: "alice", Roles: []Role{{Account: "APP", Name: "admin"}}, Groups: []string{"eng"}}}
+	p := NewRoleMappingProvider(inner, mustRoleMapper(t, RoleMappingConfig{Mappings: map[string][]string{"eng": {"APP.workers"}}}))
+
+	user, err := p.Verify(context.Background(), AuthRequest{Account: "APP"})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if len(user.Roles) != 2 || user.Roles[1] != (Role{Account: "APP", Name: "workers"}) {
+		t.Errorf("Verify() roles = %v", user.Roles)
+	}
+	if len(inner.user.Roles) != 1 {
+		t.Errorf("Verify() modified the provider's user: %v", inner.user.Roles)
+	}
+
+	inner.err = ErrInvalidCredentials
+	if _, err := p.Verify(context.Background(), AuthRequest{}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Verify() error = %v, want %v", err, ErrInvalidCredentials)
+	}
+
+	failing := NewRoleMappingProvider(&staticProvider{user: &User{ID: "bob"}}, RoleMapperFunc(func(context.Context, *User) ([]Role, error) {
+		return nil, ErrProviderUnavailable
+	}))
+	if _, err := failing.Verify(context.Background(), AuthRequest{}); !errors.Is(err, ErrProviderUnavailable) {
+		t.Errorf("Verify() error = %v, want %v", err, ErrProviderUnavailable)
+	}
+}
+
+func mustRoleMapper(t *testing.T, cfg RoleMappingConfig) RoleMapper {
+	t.Helper()
+	m, err := NewRoleMapper(cfg)
+	if err != nil {
+		t.Fatalf("NewRoleMapper() error = %v", err)
+	}
+	return m
+}
+
+// staticProvider verifies every request as user, or fails with err.
+type staticProvider struct {
+	user *User
+	err  error
+}
+
+func (p *staticProvider) Verify(context.Context, AuthRequest) (*User, error) {
+	return p.user, p.err
+}
+
+func (p *staticProvider) ManageableAccounts() []string {
+	return []string{"*"}
+}
@@ -12,11 +12,25 @@ type Role struct {
 	Name    string `json:"name"`    // Role name within the account
 }
 
+// String returns the role ID in the format "<account>.<role>".
+// It is the inverse of ParseRoleID.
+func (r Role) String() string {
+	return r.Account + "." + r.Name
+}
+
+// HasWildcard returns true if the account or role name contains a "*" wildcard.
+func (r Role) HasWildcard() bool {
+	return strings.Contains(r.Account, "*") || strings.Contains(r.Name, "*")
+}
+
 // User represents a user identity that can be authenticated.
 type User struct {
 	ID         string            `json:"id,omitempty"`         // user identifier (from external)
 	Roles      []Role            `json:"roles"`                // list of account-scoped roles
 	Attributes map[string]string `json:"attributes,omitempty"` // additional user attributes
+	// Groups are directory groups of the user (e.g., OIDC groups). They grant
+	// nothing by themselves; a RoleMapper maps them to roles.
+	Groups []string `json:"groups,omitempty"`
 }
 
 // ParseRoleID parses a role ID in the format "<account>.<role>" into a Role.
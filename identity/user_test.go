@@ -0,0 +1,41 @@
+package identity
+
+import "testing"
+
+func TestRole_StringRoundTrip(t *testing.T) {
+	role := Role{Account: "APP", Name: "admin"}
+	if got := role.String(); got != "APP.admin" {
+		t.Fatalf("String() = %q, want %q", got, "APP.admin")
+	}
+	parsed, err := ParseRoleID(role.String())
+	if err != nil {
+		t.Fatalf("ParseRoleID() error = %v", err)
+	}
+	if parsed != role {
+		t.Errorf("ParseRoleID(String()) = %+v, want %+v", parsed, role)
+	}
+}
+
+func TestParseRoleID_Invalid(t *testing.T) {
+	for _, id := range []string{"", "APP", ".admin", "APP."} {
+		if _, err := ParseRoleID(id); err == nil {
+			t.Errorf("ParseRoleID(%q) expected error", id)
+		}
+	}
+}
+
+func TestRole_HasWildcard(t *testing.T) {
+	tests := []struct {
+		role Role
+		want bool
+	}{
+		{Role{Account: "APP", Name: "admin"}, false},
+		{Role{Account: "*", Name: "admin"}, true},
+		{Role{Account: "APP", Name: "adm*"}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.role.HasWildcard(); got != tt.want {
+			t.Errorf("%+v.HasWildcard() = %v, want %v", tt.role, got, tt.want)
+		}
+	}
+}
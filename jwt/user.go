@@ -10,17 +10,42 @@ import (
 	"github.com/msimon/nauts/policy"
 )
 
-// IssueUserJWT creates and signs a NATS user JWT.
+// UserJWTEncoder encodes fully-populated user claims into a signed JWT.
+//
+// Implementations may add custom claim fields (e.g., tags) or enforce
+// organization-specific invariants before delegating to DefaultUserJWTEncoder.
+// Returning an error aborts issuance.
+type UserJWTEncoder interface {
+	Encode(claims *natsjwt.UserClaims, signer Signer) (string, error)
+}
+
+// UserJWTEncoderFunc adapts a function to the UserJWTEncoder interface.
+type UserJWTEncoderFunc func(claims *natsjwt.UserClaims, signer Signer) (string, error)
+
+// Encode calls f(claims, signer).
+func (f UserJWTEncoderFunc) Encode(claims *natsjwt.UserClaims, signer Signer) (string, error) {
+	return f(claims, signer)
+}
+
+// DefaultUserJWTEncoder signs the claims as-is with the given signer.
+var DefaultUserJWTEncoder UserJWTEncoder = UserJWTEncoderFunc(func(claims *natsjwt.UserClaims, signer Signer) (string, error) {
+	token, err := claims.Encode(NewSignerAdapter(signer))
+	if err != nil {
+		return "", fmt.Errorf("encoding user JWT: %w", err)
+	}
+	return token, nil
+})
+
+// NewUserClaims builds the NATS user claims issued by nauts.
 // Parameters:
 //   - userName: the name of the user (for display purposes)
 //   - userPublicKey: the public key of the user (subject of the JWT)
-//   - ttl: time-to-live for the JWT
+//   - ttl: time-to-live for the JWT (0 means no expiry)
 //   - permissions: NATS permissions to include in the JWT
-//   - issuerSigner: the account signer that issues the JWT
-//   - audienceAccount: the public key of the target account (for non-operator mode)
-//
-// Returns the signed JWT string.
-func IssueUserJWT(userName string, userPublicKey string, ttl time.Duration, permissions *policy.NatsPermissions, issuerSigner Signer, audienceAccount string, issuerAccount string) (string, error) {
+//   - limits: connection limits to include in the JWT (zero values mean no limit)
+//   - audienceAccount: the target account (for non-operator mode)
+//   - issuerAccount: the account public key when signing with a signing key (operator mode)
+func NewUserClaims(userName string, userPublicKey string, ttl time.Duration, permissions *policy.NatsPermissions, limits policy.UserLimits, audienceAccount string, issuerAccount string) *natsjwt.UserClaims {
 	claims := natsjwt.NewUserClaims(userPublicKey)
 	claims.Name = userName
 	// Set audience to the target account's public key (required for non-operator mode)
@@ -35,18 +60,31 @@ func IssueUserJWT(userName string, userPublicKey string, ttl time.Duration, perm
 	if permissions != nil {
 		claims.Permissions = permissions.ToNatsJWT()
 	}
+	limits.ApplyTo(&claims.Limits.NatsLimits)
 
 	// this is to support signing keys
 	if issuerAccount != "" {
 		claims.IssuerAccount = issuerAccount
 	}
 
-	token, err := claims.Encode(NewSignerAdapter(issuerSigner))
-	if err != nil {
-		return "", fmt.Errorf("encoding user JWT: %w", err)
-	}
+	return claims
+}
 
-	return token, nil
+// IssueUserJWT creates and signs a NATS user JWT.
+// Parameters:
+//   - userName: the name of the user (for display purposes)
+//   - userPublicKey: the public key of the user (subject of the JWT)
+//   - ttl: time-to-live for the JWT
+//   - permissions: NATS permissions to include in the JWT
+//   - limits: connection limits to include in the JWT (zero values mean no limit)
+//   - issuerSigner: the account signer that issues the JWT
+//   - audienceAccount: the public key of the target account (for non-operator mode)
+//
+// Returns the signed JWT string. The JWT carries a jti claim, set by the
+// encoding to a hash of the claims, which identifies it for revocation.
+func IssueUserJWT(userName string, userPublicKey string, ttl time.Duration, permissions *policy.NatsPermissions, limits policy.UserLimits, issuerSigner Signer, audienceAccount string, issuerAccount string) (string, error) {
+	claims := NewUserClaims(userName, userPublicKey, ttl, permissions, limits, audienceAccount, issuerAccount)
+	return DefaultUserJWTEncoder.Encode(claims, issuerSigner)
 }
 
 // SignerAdapter adapts a Signer interface to nkeys.KeyPair for JWT encoding.
@@ -43,7 +43,7 @@ func TestIssueUserJWT(t *testing.T) {
 	accountPub := accountSigner.PublicKey()
 
 	// Issue JWT
-	token, err := IssueUserJWT("alice", userPub, time.Hour, perms, accountSigner, accountPub, "my-issuer-account")
+	token, err := IssueUserJWT("alice", userPub, time.Hour, perms, policy.UserLimits{}, accountSigner, accountPub, "my-issuer-account")
 	if err != nil {
 		t.Fatalf("IssueUserJWT error: %v", err)
 	}
@@ -62,6 +62,10 @@ func TestIssueUserJWT(t *testing.T) {
 		t.Errorf("name = %q, want %q", claims.Name, "alice")
 	}
 
+	if claims.ID == "" {
+		t.Error("expected a jti claim")
+	}
+
 	if claims.Subject != userPub {
 		t.Errorf("subject = %q, want %q", claims.Subject, userPub)
 	}
@@ -115,7 +119,7 @@ func TestIssueUserJWT_NoPermissions(t *testing.T) {
 
 	accountPub := accountSigner.PublicKey()
 
-	token, err := IssueUserJWT("bob", userPub, 0, nil, accountSigner, accountPub, "")
+	token, err := IssueUserJWT("bob", userPub, 0, nil, policy.UserLimits{}, accountSigner, accountPub, "")
 	if err != nil {
 		t.Fatalf("IssueUserJWT error: %v", err)
 	}
@@ -160,7 +164,7 @@ func TestIssueUserJWT_ZeroTTL(t *testing.T) {
 
 	accountPub := accountSigner.PublicKey()
 
-	token, err := IssueUserJWT("user", userPub, 0, nil, accountSigner, accountPub, "")
+	token, err := IssueUserJWT("user", userPub, 0, nil, policy.UserLimits{}, accountSigner, accountPub, "")
 	if err != nil {
 		t.Fatalf("IssueUserJWT error: %v", err)
 	}
@@ -175,3 +179,94 @@ func TestIssueUserJWT_ZeroTTL(t *testing.T) {
 		t.Errorf("expires = %d, want 0", claims.Expires)
 	}
 }
+
+func TestIssueUserJWT_CustomEncoder(t *testing.T) {
+	accountKp, err := nkeys.CreateAccount()
+	if err != nil {
+		t.Fatalf("creating account keypair: %v", err)
+	}
+	accountSeed, err := accountKp.Seed()
+	if err != nil {
+		t.Fatalf("getting account seed: %v", err)
+	}
+	accountSigner, err := NewLocalSigner(string(accountSeed))
+	if err != nil {
+		t.Fatalf("creating account signer: %v", err)
+	}
+
+	userKp, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatalf("creating user keypair: %v", err)
+	}
+	userPub, err := userKp.PublicKey()
+	if err != nil {
+		t.Fatalf("getting user public key: %v", err)
+	}
+
+	encoder := UserJWTEncoderFunc(func(claims *natsjwt.UserClaims, signer Signer) (string, error) {
+		if claims.Name != "alice" || claims.Subject != userPub {
+			t.Errorf("claims not populated before encoding: name=%q subject=%q", claims.Name, claims.Subject)
+		}
+		claims.Tags.Add("team:payments")
+		return DefaultUserJWTEncoder.Encode(claims, signer)
+	})
+
+	claims := NewUserClaims("alice", userPub, time.Hour, nil, policy.UserLimits{}, accountSigner.PublicKey(), "")
+	token, err := encoder.Encode(claims, accountSigner)
+	if err != nil {
+		t.Fatalf("Encode error: %v", err)
+	}
+
+	decoded, err := natsjwt.DecodeUserClaims(token)
+	if err != nil {
+		t.Fatalf("decoding user claims: %v", err)
+	}
+	if !decoded.Tags.Contains("team:payments") {
+		t.Errorf("tags = %v, want team:payments", decoded.Tags)
+	}
+	if decoded.Issuer != accountSigner.PublicKey() {
+		t.Errorf("issuer = %q, want %q", decoded.Issuer, accountSigner.PublicKey())
+	}
+}
+
+func TestIssueUserJWT_Limits(t *testing.T) {
+	accountKp, err := nkeys.CreateAccount()
+	if err != nil {
+		t.Fatalf("creating account keypair: %v", err)
+	}
+	accountSeed, err := accountKp.Seed()
+	if err != nil {
+		t.Fatalf("getting account seed: %v", err)
+	}
+	accountSigner, err := NewLocalSigner(string(accountSeed))
+	if err != nil {
+		t.Fatalf("creating account signer: %v", err)
+	}
+
+	userKp, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatalf("creating user keypair: %v", err)
+	}
+	userPub, err := userKp.PublicKey()
+	if err != nil {
+		t.Fatalf("getting user public key: %v", err)
+	}
+
+	limits := policy.UserLimits{MaxPayload: 1024, MaxSubscriptions: 10}
+	token, err := IssueUserJWT("carol", userPub, 0, nil, limits, accountSigner, accountSigner.PublicKey(), "")
+	if err != nil {
+		t.Fatalf("IssueUserJWT error: %v", err)
+	}
+
+	claims, err := natsjwt.DecodeUserClaims(token)
+	if err != nil {
+		t.Fatalf("decoding user claims: %v", err)
+	}
+	if claims.Limits.Payload != 1024 || claims.Limits.Subs != 10 {
+		t.Errorf("limits = payload %d, subs %d, want 1024, 10", claims.Limits.Payload, claims.Limits.Subs)
+	}
+	// Unset limits stay unlimited.
+	if claims.Limits.Data != natsjwt.NoLimit {
+		t.Errorf("data limit = %d, want %d", claims.Limits.Data, natsjwt.NoLimit)
+	}
+}
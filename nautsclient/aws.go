@@ -0,0 +1,145 @@
+package nautsclient
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// stsRequestBody is the GetCallerIdentity request nauts replays against STS.
+// The signature covers it, so it must match the server byte for byte.
+const stsRequestBody = "Action=GetCallerIdentity&Version=2011-06-15"
+
+// stsContentType is the Content-Type header nauts sends to STS.
+const stsContentType = "application/x-www-form-urlencoded; charset=utf-8"
+
+// AWSCredentials sign STS GetCallerIdentity requests for the AWS SigV4
+// authentication provider. nauts forwards the signature to STS to learn the
+// caller's IAM role; the secret key never leaves the client.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is required for temporary credentials (assumed roles,
+	// instance profiles, ECS tasks, Lambda).
+	SessionToken string
+	// Region selects the regional STS endpoint, e.g. "us-east-1". It must
+	// match the region configured for the nauts provider, if any.
+	Region string
+
+	// Now returns the signing time. Default: time.Now.
+	Now func() time.Time
+}
+
+// AWSCredentialsFromEnv reads AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY,
+// AWS_SESSION_TOKEN, and AWS_REGION (or AWS_DEFAULT_REGION).
+func AWSCredentialsFromEnv() AWSCredentials {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	return AWSCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		Region:          region,
+	}
+}
+
+// awsSigV4Token is the credential format of the AWS SigV4 provider.
+type awsSigV4Token struct {
+	Authorization string `json:"authorization"`
+	Date          string `json:"date"`
+	SecurityToken string `json:"securityToken,omitempty"`
+}
+
+// Credential implements Credentials by signing a GetCallerIdentity request.
+// Signatures are valid for a few minutes, so build a new one per connection.
+func (c AWSCredentials) Credential() (string, error) {
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		return "", errors.New("aws access key id and secret access key are required")
+	}
+	if c.Region == "" {
+		return "", errors.New("aws region is required")
+	}
+	now := time.Now
+	if c.Now != nil {
+		now = c.Now
+	}
+
+	t := now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	scope := date + "/" + c.Region + "/sts/aws4_request"
+
+	headers := map[string]string{
+		"content-type": stsContentType,
+		"host":         "sts." + c.Region + ".amazonaws.com",
+		"x-amz-date":   amzDate,
+	}
+	if c.SessionToken != "" {
+		headers["x-amz-security-token"] = c.SessionToken
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	payloadHash := sha256.Sum256([]byte(stsRequestBody))
+
+	canonicalRequest := strings.Join([]string{
+		"POST",
+		"/",
+		"",
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+	key := sigV4SigningKey(c.SecretAccessKey, date, c.Region, "sts")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	data, err := json.Marshal(awsSigV4Token{
+		Authorization: fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+			c.AccessKeyID, scope, signedHeaders, signature),
+		Date:          amzDate,
+		SecurityToken: c.SessionToken,
+	})
+	if err != nil {
+		return "", fmt.Errorf("encoding aws credential: %w", err)
+	}
+	return string(data), nil
+}
+
+// sigV4SigningKey derives the SigV4 signing key for a date, region, and service.
+func sigV4SigningKey(secret, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,113 @@
+// Package nautsclient builds nauts auth tokens for NATS clients.
+//
+// A nauts token is a JSON envelope carrying the target account, an optional
+// authentication provider id, and a provider-specific credential:
+//
+//	nc, err := nats.Connect(url, nautsclient.Option("APP", nautsclient.Password("alice", "secret")))
+//
+// Option builds a fresh token for every connection attempt, so time-limited
+// credentials such as AWS SigV4 signatures stay valid across reconnects.
+package nautsclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/msimon/nauts/identity"
+)
+
+// Credentials produce the provider-specific credential placed in the token
+// field of the auth request.
+type Credentials interface {
+	Credential() (string, error)
+}
+
+// CredentialsFunc adapts a function to Credentials.
+type CredentialsFunc func() (string, error)
+
+// Credential implements Credentials.
+func (f CredentialsFunc) Credential() (string, error) {
+	return f()
+}
+
+// Password returns credentials for the file authentication provider.
+func Password(username, password string) Credentials {
+	return CredentialsFunc(func() (string, error) {
+		if username == "" {
+			return "", errors.New("username is required")
+		}
+		if strings.Contains(username, ":") {
+			return "", errors.New("username must not contain ':'")
+		}
+		return username + ":" + password, nil
+	})
+}
+
+// JWT returns credentials for the JWT authentication provider. The token is
+// passed through unchanged; it must be issued by an IdP nauts trusts.
+func JWT(token string) Credentials {
+	return CredentialsFunc(func() (string, error) {
+		if token == "" {
+			return "", errors.New("jwt is required")
+		}
+		return token, nil
+	})
+}
+
+// TokenOption configures the auth request envelope.
+type TokenOption func(*identity.AuthRequest)
+
+// WithProvider routes the request to the authentication provider with the
+// given id (the "ap" field). Needed when several providers manage the account.
+func WithProvider(id string) TokenOption {
+	return func(r *identity.AuthRequest) {
+		r.AP = id
+	}
+}
+
+// Token returns the JSON auth token for account.
+func Token(account string, creds Credentials, opts ...TokenOption) (string, error) {
+	if account == "" {
+		return "", errors.New("account is required")
+	}
+	if strings.Contains(account, "*") {
+		return "", errors.New("account must not contain wildcards")
+	}
+	credential, err := creds.Credential()
+	if err != nil {
+		return "", fmt.Errorf("building credential: %w", err)
+	}
+
+	req := identity.AuthRequest{
+		Version: identity.AuthRequestVersion,
+		Account: account,
+		Token:   credential,
+	}
+	for _, opt := range opts {
+		opt(&req)
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("encoding auth request: %w", err)
+	}
+	return string(data), nil
+}
+
+// Option returns a nats.Option that authenticates with a nauts token for
+// account. The token is rebuilt on every connection attempt. If it cannot be
+// built, the connection is attempted without a token and rejected by nauts;
+// use Token beforehand to surface configuration errors early.
+func Option(account string, creds Credentials, opts ...TokenOption) nats.Option {
+	return nats.TokenHandler(func() string {
+		token, err := Token(account, creds, opts...)
+		if err != nil {
+			return ""
+		}
+		return token
+	})
+}
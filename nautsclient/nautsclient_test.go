@@ -0,0 +1,113 @@
+package nautsclient
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/msimon/nauts/identity"
+)
+
+func TestToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		account string
+		creds   Credentials
+		opts    []TokenOption
+		want    identity.AuthRequest
+		wantErr bool
+	}{
+		{
+			name:    "password",
+			account: "APP",
+			creds:   Password("alice", "s3:cret"),
+			want:    identity.AuthRequest{Version: identity.AuthRequestVersion, Account: "APP", Token: "alice:s3:cret"},
+		},
+		{
+			name:    "jwt with provider",
+			account: "APP",
+			creds:   JWT("eyJhbGciOi.payload.sig"),
+			opts:    []TokenOption{WithProvider("keycloak")},
+			want:    identity.AuthRequest{Version: identity.AuthRequestVersion, Account: "APP", Token: "eyJhbGciOi.payload.sig", AP: "keycloak"},
+		},
+		{name: "missing account", creds: Password("alice", "x"), wantErr: true},
+		{name: "wildcard account", account: "*", creds: Password("alice", "x"), wantErr: true},
+		{name: "colon in username", account: "APP", creds: Password("a:b", "x"), wantErr: true},
+		{name: "empty jwt", account: "APP", creds: JWT(""), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := Token(tt.account, tt.creds, tt.opts...)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Token() = %q, want error", token)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Token() error = %v", err)
+			}
+			var got identity.AuthRequest
+			if err := json.Unmarshal([]byte(token), &got); err != nil {
+				t.Fatalf("decoding token: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Token() = %+v, want %+v", got, tt.want)
+			}
+			if err := got.CheckVersion(); err != nil {
+				t.Errorf("CheckVersion() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestSigV4SigningKey(t *testing.T) {
+	// Example from the AWS Signature Version 4 documentation.
+	key := sigV4SigningKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20150830", "us-east-1", "iam")
+	want := "c4afb1cc5771d871763a393e44b703571b55cc28424d1a5e86da6ed3c154a4b9"
+	if got := hex.EncodeToString(key); got != want {
+		t.Errorf("sigV4SigningKey() = %s, want %s", got, want)
+	}
+}
+
+func TestAWSCredentials(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 30, 0, 0, time.UTC)
+	creds := AWSCredentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		SessionToken:    "session",
+		Region:          "eu-central-1",
+		Now:             func() time.Time { return now },
+	}
+
+	credential, err := creds.Credential()
+	if err != nil {
+		t.Fatalf("Credential() error = %v", err)
+	}
+	var token awsSigV4Token
+	if err := json.Unmarshal([]byte(credential), &token); err != nil {
+		t.Fatalf("decoding credential: %v", err)
+	}
+	if token.Date != "20261016T123000Z" || token.SecurityToken != "session" {
+		t.Errorf("token = %+v", token)
+	}
+	wantPrefix := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20261016/eu-central-1/sts/aws4_request, " +
+		"SignedHeaders=content-type;host;x-amz-date;x-amz-security-token, Signature="
+	if !strings.HasPrefix(token.Authorization, wantPrefix) {
+		t.Errorf("Authorization = %q, want prefix %q", token.Authorization, wantPrefix)
+	}
+
+	// Signing is deterministic for a fixed time.
+	again, _ := creds.Credential()
+	if again != credential {
+		t.Error("Credential() is not deterministic for a fixed time")
+	}
+
+	creds.Region = ""
+	if _, err := creds.Credential(); err == nil {
+		t.Error("Credential() without region succeeded")
+	}
+}
@@ -34,11 +34,20 @@ const (
 	ActionKVManage Action = "kv.manage" // Manage buckets
 )
 
+// Object store actions
+const (
+	ActionObjRead   Action = "obj.read"   // Get objects and their info, list and watch objects
+	ActionObjWrite  Action = "obj.write"  // Put and delete objects
+	ActionObjView   Action = "obj.view"   // View bucket info
+	ActionObjManage Action = "obj.manage" // Manage buckets
+)
+
 // Action groups
 const (
 	ActionGroupNATSAll Action = "nats.*" // All nats.* actions
 	ActionGroupJSAll   Action = "js.*"   // js.manage
 	ActionGroupKVAll   Action = "kv.*"   // kv.manage
+	ActionGroupObjAll  Action = "obj.*"  // obj.manage
 )
 
 // actionRegistry maps action names to their definitions.
@@ -89,6 +98,24 @@ var actionRegistry = map[Action]*ActionDef{
 		IsAtomic: true,
 	},
 
+	// Object store actions (all require inbox for request/reply)
+	ActionObjRead: {
+		Name:     "obj.read",
+		IsAtomic: true,
+	},
+	ActionObjWrite: {
+		Name:     "obj.write",
+		IsAtomic: true,
+	},
+	ActionObjView: {
+		Name:     "obj.view",
+		IsAtomic: true,
+	},
+	ActionObjManage: {
+		Name:     "obj.manage",
+		IsAtomic: true,
+	},
+
 	// Action groups
 	ActionGroupNATSAll: {
 		Name:     "nats.*",
@@ -113,6 +140,13 @@ var actionRegistry = map[Action]*ActionDef{
 			ActionKVManage,
 		},
 	},
+	ActionGroupObjAll: {
+		Name:     "obj.*",
+		IsAtomic: false,
+		ExpandsTo: []Action{
+			ActionObjManage,
+		},
+	},
 }
 
 // Def returns the action definition, or nil if the action is not valid.
@@ -140,7 +174,8 @@ func (a Action) IsValid() bool {
 // Check if an action requires Jetstream info
 func (a Action) RequiresJetstream() bool {
 	switch a {
-	case ActionJSConsume, ActionJSManage, ActionJSView, ActionKVRead, ActionKVEdit, ActionKVView, ActionKVManage:
+	case ActionJSConsume, ActionJSManage, ActionJSView, ActionKVRead, ActionKVEdit, ActionKVView, ActionKVManage,
+		ActionObjRead, ActionObjWrite, ActionObjView, ActionObjManage:
 		return true
 	default:
 		return false
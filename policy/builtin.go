@@ -0,0 +1,155 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// BuiltinPrefix marks policy IDs of the built-in policy library. Bindings
+// reference them as "builtin:<name>" or "builtin:<name>:<arg>", e.g.
+// "builtin:kv-reader:config", with any policy provider. The prefix is
+// reserved: stored policies cannot use it.
+const BuiltinPrefix = "builtin:"
+
+// builtinAccount is the account of built-in policies; they apply to every account.
+const builtinAccount = "_global"
+
+// ErrUnknownBuiltin is returned by Builtin for IDs that do not name a
+// built-in policy or carry an invalid argument.
+var ErrUnknownBuiltin = errors.New("unknown built-in policy")
+
+// builtinArgPattern restricts arguments to a single stream or bucket name.
+var builtinArgPattern = regexp.MustCompile(`^[a-zA-Z0-9_\-]+$`)
+
+// BuiltinTemplate describes a policy of the built-in library.
+type BuiltinTemplate struct {
+	// Name is the ID part after BuiltinPrefix, e.g. "kv-reader".
+	Name string `json:"name"`
+	// Description is used as the name of the resolved policy.
+	Description string `json:"description"`
+	// Arg names the argument, e.g. "bucket" for "builtin:kv-reader:<bucket>".
+	// Empty if the template takes none.
+	Arg string `json:"arg,omitempty"`
+	// DefaultArg is used if the argument is omitted. If empty, an argument
+	// is required.
+	DefaultArg string `json:"defaultArg,omitempty"`
+
+	statements func(arg string) []Statement
+}
+
+func allowStatement(actions []Action, resources ...string) Statement {
+	return Statement{Effect: EffectAllow, Actions: actions, Resources: resources}
+}
+
+var builtinTemplates = []BuiltinTemplate{
+	{
+		Name:        "monitoring",
+		Description: "Account monitoring: connection and account statistics, read-only JetStream info",
+		statements: func(string) []Statement {
+			return []Statement{
+				allowStatement([]Action{ActionNATSPub},
+					"nats:$SYS.REQ.ACCOUNT.PING.CONNZ",
+					"nats:$SYS.REQ.ACCOUNT.PING.STATZ",
+					"nats:$SYS.REQ.SERVER.PING.CONNZ",
+					"nats:$SYS.REQ.USER.INFO",
+				),
+				allowStatement([]Action{ActionJSView}, "js:*"),
+			}
+		},
+	},
+	{
+		Name:        "user-subjects",
+		Description: "Publish and subscribe on the user's private subjects user.<user.id>.>",
+		statements: func(string) []Statement {
+			return []Statement{allowStatement([]Action{ActionNATSPub, ActionNATSSub}, "nats:user.{{ user.id }}.>")}
+		},
+	},
+	{
+		Name:        "js-viewer",
+		Description: "View stream and consumer info without reading messages",
+		Arg:         "stream",
+		DefaultArg:  "*",
+		statements: func(stream string) []Statement {
+			return []Statement{allowStatement([]Action{ActionJSView}, "js:"+stream)}
+		},
+	},
+	{
+		Name:        "js-consumer",
+		Description: "Consume messages from a stream with any consumer",
+		Arg:         "stream",
+		statements: func(stream string) []Statement {
+			return []Statement{allowStatement([]Action{ActionJSConsume}, "js:"+stream)}
+		},
+	},
+	{
+		Name:        "js-manager",
+		Description: "Manage a stream and its consumers",
+		Arg:         "stream",
+		statements: func(stream string) []Statement {
+			return []Statement{allowStatement([]Action{ActionJSManage}, "js:"+stream)}
+		},
+	},
+	{
+		Name:        "kv-reader",
+		Description: "Read and watch all keys of a KV bucket",
+		Arg:         "bucket",
+		statements: func(bucket string) []Statement {
+			return []Statement{allowStatement([]Action{ActionKVRead}, "kv:"+bucket)}
+		},
+	},
+	{
+		Name:        "kv-editor",
+		Description: "Read, write and delete all keys of a KV bucket",
+		Arg:         "bucket",
+		statements: func(bucket string) []Statement {
+			return []Statement{allowStatement([]Action{ActionKVEdit}, "kv:"+bucket)}
+		},
+	},
+}
+
+// BuiltinTemplates returns the built-in policy library sorted by name.
+func BuiltinTemplates() []BuiltinTemplate {
+	templates := append([]BuiltinTemplate(nil), builtinTemplates...)
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates
+}
+
+// IsBuiltinID reports whether id references the built-in policy library.
+func IsBuiltinID(id string) bool {
+	return strings.HasPrefix(id, BuiltinPrefix)
+}
+
+// Builtin resolves a built-in policy ID ("builtin:<name>[:<arg>]") to a
+// global policy with that ID. Returns an error wrapping ErrUnknownBuiltin if
+// the template does not exist or the argument is missing or invalid.
+func Builtin(id string) (*Policy, error) {
+	if !IsBuiltinID(id) {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBuiltin, id)
+	}
+	name, arg, hasArg := strings.Cut(strings.TrimPrefix(id, BuiltinPrefix), ":")
+
+	for _, t := range builtinTemplates {
+		if t.Name != name {
+			continue
+		}
+		switch {
+		case t.Arg == "" && hasArg:
+			return nil, fmt.Errorf("%w: %q takes no argument", ErrUnknownBuiltin, id)
+		case t.Arg == "":
+		case !hasArg && t.DefaultArg != "":
+			arg = t.DefaultArg
+		case !builtinArgPattern.MatchString(arg):
+			return nil, fmt.Errorf("%w: %q requires a %s name (%s%s:<%s>)", ErrUnknownBuiltin, id, t.Arg, BuiltinPrefix, t.Name, t.Arg)
+		}
+		return &Policy{
+			ID:         id,
+			Account:    builtinAccount,
+			Name:       t.Description,
+			Statements: t.statements(arg),
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownBuiltin, id)
+}
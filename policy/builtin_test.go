@@ -0,0 +1,75 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBuiltin(t *testing.T) {
+	tests := []struct {
+		id           string
+		wantResource string
+		wantErr      bool
+	}{
+		{id: "builtin:kv-reader:config", wantResource: "kv:config"},
+		{id: "builtin:js-consumer:ORDERS", wantResource: "js:ORDERS"},
+		{id: "builtin:js-viewer", wantResource: "js:*"},
+		{id: "builtin:js-viewer:ORDERS", wantResource: "js:ORDERS"},
+		{id: "builtin:user-subjects", wantResource: "nats:user.{{ user.id }}.>"},
+		{id: "builtin:kv-reader", wantErr: true},
+		{id: "builtin:kv-reader:", wantErr: true},
+		{id: "builtin:kv-reader:*", wantErr: true},
+		{id: "builtin:kv-reader:a.b", wantErr: true},
+		{id: "builtin:monitoring:x", wantErr: true},
+		{id: "builtin:unknown", wantErr: true},
+		{id: "kv-reader:config", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			pol, err := Builtin(tt.id)
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnknownBuiltin) {
+					t.Fatalf("Builtin() error = %v, want ErrUnknownBuiltin", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Builtin() error = %v", err)
+			}
+			if pol.ID != tt.id || pol.Account != "_global" {
+				t.Errorf("Builtin() = %s/%s, want _global/%s", pol.Account, pol.ID, tt.id)
+			}
+			if got := pol.Statements[len(pol.Statements)-1].Resources[0]; got != tt.wantResource {
+				t.Errorf("resource = %q, want %q", got, tt.wantResource)
+			}
+		})
+	}
+}
+
+func TestBuiltinTemplates_Valid(t *testing.T) {
+	for _, tmpl := range BuiltinTemplates() {
+		id := BuiltinPrefix + tmpl.Name
+		if tmpl.Arg != "" {
+			id += ":TEST"
+		}
+		t.Run(id, func(t *testing.T) {
+			pol, err := Builtin(id)
+			if err != nil {
+				t.Fatalf("Builtin() error = %v", err)
+			}
+			if pol.Name == "" || len(pol.Statements) == 0 {
+				t.Fatalf("Builtin() = %+v, want a name and statements", pol)
+			}
+			for _, stmt := range pol.Statements {
+				if err := stmt.Validate(); err != nil {
+					t.Errorf("statement %+v: %v", stmt, err)
+				}
+				for _, res := range stmt.Resources {
+					if err := ValidateResourceTemplate(res); err != nil {
+						t.Errorf("resource %q: %v", res, err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -2,25 +2,60 @@
 // This file contains the policy compilation logic.
 package policy
 
+import "time"
+
 // CompileResult contains the result of policy compilation.
 type CompileResult struct {
-	Warnings []string // Warnings generated during compilation
+	Warnings []string      // Warnings generated during compilation
+	MaxTTL   time.Duration // Smallest MaxTTL of the compiled policies (0 = no limit)
+	Limits   UserLimits    // Most restrictive limits of the compiled policies
+	// Origins records the statement behind every permission added, in
+	// compilation order. Only set by CompileExplained.
+	Origins []PermissionOrigin
+}
+
+// PermissionOrigin describes where a compiled permission came from.
+type PermissionOrigin struct {
+	Permission Permission `json:"permission"`
+	Effect     Effect     `json:"effect"`
+	// PolicyID and Statement (index in Statements) locate the statement;
+	// both are empty for implicit permissions.
+	PolicyID      string `json:"policyId,omitempty"`
+	PolicyAccount string `json:"policyAccount,omitempty"`
+	Statement     int    `json:"statement"`
+	// Resource is the resource as written in the policy, before interpolation.
+	Resource string `json:"resource,omitempty"`
+	Action   Action `json:"action,omitempty"`
+	// Implicit explains permissions granted without a matching resource,
+	// e.g. the user's inbox or $JS.API.INFO for JetStream actions.
+	Implicit string `json:"implicit,omitempty"`
 }
 
 // Compile compiles a set of policies with the given context and merges
 // the results into the provided NatsPermissions.
 //
 // The compilation process:
-// 1. For each policy statement with effect "allow"
+// 1. For each policy statement with effect "allow" or "deny"
 // 2. Expand action groups to atomic actions
 // 3. Interpolate variables in resources
 // 4. Parse and validate resources
 // 5. Map actions + resources to NATS permissions
-// 6. Merge into the result permissions
+// 6. Merge into the allow or deny sets of the result permissions
 //
 // After calling Compile, the caller should call perms.Deduplicate()
-// when all policies are compiled.
+// when all policies are compiled. Deduplicate applies deny permissions,
+// so a deny in one policy overrides an allow in any other policy.
 func Compile(policies []*Policy, ctx *PolicyContext, perms *NatsPermissions) CompileResult {
+	return compile(policies, ctx, perms, false)
+}
+
+// CompileExplained is Compile that also records the origin of every
+// permission in CompileResult.Origins, for debugging unexpected access.
+func CompileExplained(policies []*Policy, ctx *PolicyContext, perms *NatsPermissions) CompileResult {
+	return compile(policies, ctx, perms, true)
+}
+
+func compile(policies []*Policy, ctx *PolicyContext, perms *NatsPermissions, explain bool) CompileResult {
 	result := CompileResult{}
 
 	if ctx == nil {
@@ -28,11 +63,16 @@ func Compile(policies []*Policy, ctx *PolicyContext, perms *NatsPermissions) Com
 		return result
 	}
 
-	// Always grant permission to subscribe to user's personalized inbox
-	if userID := ctx.User; userID != "" {
-		// INBOX prefix is _INBOX_{{user.id}}
-		// We allow subscription to _INBOX_{{user.id}}.>
-		perms.Allow(Permission{Type: PermSub, Subject: "_INBOX_" + userID + ".>"})
+	// Grant permission to subscribe to the user's inbox (by default
+	// _INBOX_{{user.id}}.>, see ctx.Inbox)
+	inbox, ok, err := InboxPermission(ctx)
+	if err != nil {
+		result.Warnings = append(result.Warnings, "inbox skipped ("+err.Error()+")")
+	} else if ok {
+		perms.Allow(inbox)
+		if explain {
+			result.Origins = append(result.Origins, PermissionOrigin{Permission: inbox, Effect: EffectAllow, Implicit: "user inbox"})
+		}
 	}
 
 	for _, pol := range policies {
@@ -55,20 +95,57 @@ func Compile(policies []*Policy, ctx *PolicyContext, perms *NatsPermissions) Com
 			continue
 		}
 
-		policyResult := compilePolicy(pol, ctx, perms)
+		policyResult := compilePolicy(pol, ctx, perms, explain)
 		result.Warnings = append(result.Warnings, policyResult.Warnings...)
+		result.Origins = append(result.Origins, policyResult.Origins...)
+		result.MaxTTL = MinTTL(result.MaxTTL, pol.GetMaxTTL())
+		if pol.Limits != nil {
+			result.Limits = result.Limits.Restrict(*pol.Limits)
+		}
 	}
 
 	return result
 }
 
-// compilePolicy compiles a single policy with user and role context.
-func compilePolicy(pol *Policy, ctx *PolicyContext, perms *NatsPermissions) CompileResult {
+// compilePolicy compiles a single policy with user and role context. With
+// explain, the origins of the added permissions are recorded.
+func compilePolicy(pol *Policy, ctx *PolicyContext, perms *NatsPermissions, explain bool) CompileResult {
 	result := CompileResult{}
 
-	for _, stmt := range pol.Statements {
-		if stmt.Effect != EffectAllow {
-			continue // Only "allow" is supported
+	for i, stmt := range pol.Statements {
+		if !stmt.Effect.IsValid() {
+			result.Warnings = append(result.Warnings, "statement skipped (invalid effect "+string(stmt.Effect)+"): "+pol.ID)
+			continue
+		}
+
+		// Skip statements whose conditions do not hold
+		if ok, err := stmt.Conditions.Evaluate(ctx); err != nil {
+			result.Warnings = append(result.Warnings, "statement skipped ("+err.Error()+"): "+pol.ID)
+			continue
+		} else if !ok {
+			continue
+		}
+
+		// Resolve the JetStream domain of the statement
+		var domain string
+		if stmt.JSDomain != "" {
+			var err error
+			domain, err = resolveJSDomain(stmt.JSDomain, ctx)
+			if err != nil {
+				result.Warnings = append(result.Warnings, "statement skipped ("+err.Error()+"): "+pol.ID)
+				continue
+			}
+		}
+
+		// Parse the response limits of nats.service
+		var resp *Permission
+		if stmt.Response != nil {
+			limits, err := stmt.Response.parse()
+			if err != nil {
+				result.Warnings = append(result.Warnings, "statement skipped ("+err.Error()+"): "+pol.ID)
+				continue
+			}
+			resp = &limits
 		}
 
 		// Expand action groups to atomic actions
@@ -76,8 +153,13 @@ func compilePolicy(pol *Policy, ctx *PolicyContext, perms *NatsPermissions) Comp
 
 		// Process each resource
 		for _, resource := range stmt.Resources {
-			resourceResult := compileResource(resource, actions, ctx, perms)
+			var origin *PermissionOrigin
+			if explain {
+				origin = &PermissionOrigin{Effect: stmt.Effect, PolicyID: pol.ID, PolicyAccount: pol.Account, Statement: i, Resource: resource}
+			}
+			resourceResult := compileResource(resource, actions, stmt.Effect, domain, resp, ctx, perms, origin)
 			result.Warnings = append(result.Warnings, resourceResult.Warnings...)
+			result.Origins = append(result.Origins, resourceResult.Origins...)
 		}
 	}
 
@@ -85,8 +167,21 @@ func compilePolicy(pol *Policy, ctx *PolicyContext, perms *NatsPermissions) Comp
 }
 
 // compileResource compiles permissions for a single resource with the given actions.
-func compileResource(resource string, actions []Action, ctx *PolicyContext, perms *NatsPermissions) CompileResult {
+// Permissions are added to the allow or deny sets depending on effect. A
+// non-empty domain scopes the JetStream API subjects to that domain, and a
+// non-nil resp replaces the response permission of nats.service. If
+// origin is set, a copy completed with the action and permission is recorded
+// for every permission added.
+func compileResource(resource string, actions []Action, effect Effect, domain string, resp *Permission, ctx *PolicyContext, perms *NatsPermissions, origin *PermissionOrigin) CompileResult {
 	result := CompileResult{}
+	record := func(p Permission, action Action, implicit string) {
+		if origin == nil {
+			return
+		}
+		o := *origin
+		o.Permission, o.Action, o.Implicit = p, action, implicit
+		result.Origins = append(result.Origins, o)
+	}
 
 	// Interpolate variables if present
 	var resolvedResource string
@@ -110,17 +205,37 @@ func compileResource(resource string, actions []Action, ctx *PolicyContext, perm
 
 	// Map each action to permissions
 	for _, action := range actions {
-		actionPerms := MapActionToPermissions(action, n)
+		actionPerms := ScopeToJSDomain(MapActionToPermissions(action, n), domain)
+		if resp != nil {
+			for i, p := range actionPerms {
+				if p.Type == PermResp {
+					actionPerms[i] = *resp
+				}
+			}
+		}
+
+		if effect == EffectDeny {
+			// Denying an action never revokes the implicit $JS.API.INFO permission.
+			for _, p := range actionPerms {
+				perms.Deny(p)
+				record(p, action, "")
+			}
+			continue
+		}
 
-		// Implicit JetStream info permission: any effective JS action grants $JS.API.INFO.
+		// Implicit JetStream info permission: any effective JS action grants $JS.API.INFO
+		// (or $JS.<domain>.API.INFO).
 		// This is added only when the action successfully maps to at least one permission
 		// for a valid resource.
 		if len(actionPerms) > 0 && action.RequiresJetstream() {
-			perms.Allow(Permission{Type: PermPub, Subject: "$JS.API.INFO"})
+			info := Permission{Type: PermPub, Subject: JSAPIPrefix(domain) + ".INFO"}
+			perms.Allow(info)
+			record(info, action, "JetStream account info")
 		}
 
 		for _, p := range actionPerms {
 			perms.Allow(p)
+			record(p, action, "")
 		}
 	}
 
@@ -1,7 +1,10 @@
 package policy
 
 import (
+	"net/netip"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCompile_BasicPolicy(t *testing.T) {
@@ -364,13 +367,29 @@ func TestCompile_ActionGroup(t *testing.T) {
 func TestCompile_DenyEffect(t *testing.T) {
 	policies := []*Policy{
 		{
-			ID:      "deny-policy",
+			ID:      "orders",
 			Account: "ACME",
 			Statements: []Statement{
 				{
-					Effect:    Effect("deny"), // Deny is not supported, should be skipped
+					Effect:    EffectAllow,
+					Actions:   []Action{ActionNATSPub, ActionNATSSub},
+					Resources: []string{"nats:orders.>"},
+				},
+				{
+					Effect:    EffectAllow,
 					Actions:   []Action{ActionNATSPub},
-					Resources: []string{"nats:orders"},
+					Resources: []string{"nats:orders.internal.audit"},
+				},
+			},
+		},
+		{
+			ID:      "no-internal",
+			Account: "ACME",
+			Statements: []Statement{
+				{
+					Effect:    EffectDeny,
+					Actions:   []Action{ActionNATSPub},
+					Resources: []string{"nats:orders.internal.>", "nats:billing.>"},
 				},
 			},
 		},
@@ -386,13 +405,50 @@ func TestCompile_DenyEffect(t *testing.T) {
 	}
 
 	perms.Deduplicate()
-	// Should contain default inbox permission
-	if perms.IsEmpty() {
-		t.Error("expected permissions not to be empty (default inbox)")
+	// The deny overrides the explicit allow of orders.internal.audit in the same
+	// store; billing.> overlaps no allowed subject and is dropped.
+	got := perms.ToNatsJWT()
+	if !stringSliceEqual(got.Pub.Allow, []string{"orders.>"}) {
+		t.Errorf("Pub.Allow = %v, want [orders.>]", got.Pub.Allow)
 	}
-	// Pub list should be empty
-	if len(perms.PubList()) != 0 {
-		t.Errorf("expected empty pub permissions, got %v", perms.PubList())
+	if !stringSliceEqual(got.Pub.Deny, []string{"orders.internal.>"}) {
+		t.Errorf("Pub.Deny = %v, want [orders.internal.>]", got.Pub.Deny)
+	}
+	// Subscriptions are not affected by the pub deny.
+	if len(got.Sub.Deny) != 0 {
+		t.Errorf("Sub.Deny = %v, want none", got.Sub.Deny)
+	}
+}
+
+func TestCompile_DenyEverything(t *testing.T) {
+	policies := []*Policy{
+		{
+			ID:      "deny-policy",
+			Account: "ACME",
+			Statements: []Statement{
+				{
+					Effect:    EffectAllow,
+					Actions:   []Action{ActionNATSPub},
+					Resources: []string{"nats:orders"},
+				},
+				{
+					Effect:    EffectDeny,
+					Actions:   []Action{ActionNATSPub},
+					Resources: []string{"nats:>"},
+				},
+			},
+		},
+	}
+
+	ctx := &PolicyContext{User: "alice", Account: "ACME", Role: "workers"}
+	perms := NewNatsPermissions()
+	Compile(policies, ctx, perms)
+	perms.Deduplicate()
+
+	// Denying every allowed subject leaves the deny-all default.
+	got := perms.ToNatsJWT()
+	if len(got.Pub.Allow) != 0 || !stringSliceEqual(got.Pub.Deny, []string{">"}) {
+		t.Errorf("Pub = %+v, want deny all", got.Pub)
 	}
 }
 
@@ -508,3 +564,269 @@ func TestCompile_SkipsMismatchedAccount(t *testing.T) {
 		t.Fatalf("expected 2 pub permissions, got %v", pubs)
 	}
 }
+
+func TestCompile_MaxTTL(t *testing.T) {
+	stmt := []Statement{{Effect: EffectAllow, Actions: []Action{ActionNATSPub}, Resources: []string{"nats:orders"}}}
+	policies := []*Policy{
+		{ID: "no-limit", Account: "ACME", Statements: stmt},
+		{ID: "short", Account: "ACME", Statements: stmt, MaxTTL: "15m"},
+		{ID: "long", Account: "ACME", Statements: stmt, MaxTTL: "1h"},
+		{ID: "other-account", Account: "OTHER", Statements: stmt, MaxTTL: "1m"},
+	}
+
+	ctx := &PolicyContext{User: "alice", Account: "ACME"}
+	result := Compile(policies, ctx, NewNatsPermissions())
+
+	if result.MaxTTL != 15*time.Minute {
+		t.Errorf("MaxTTL = %v, want 15m (skipped policies must not count)", result.MaxTTL)
+	}
+}
+
+func TestCompile_Limits(t *testing.T) {
+	stmt := []Statement{{Effect: EffectAllow, Actions: []Action{ActionNATSPub}, Resources: []string{"nats:orders"}}}
+	policies := []*Policy{
+		{ID: "no-limit", Account: "ACME", Statements: stmt},
+		{ID: "payload", Account: "ACME", Statements: stmt, Limits: &UserLimits{MaxPayload: 4096, MaxSubscriptions: 100}},
+		{ID: "subs", Account: "ACME", Statements: stmt, Limits: &UserLimits{MaxPayload: 8192, MaxSubscriptions: 10}},
+		{ID: "other-account", Account: "OTHER", Statements: stmt, Limits: &UserLimits{MaxData: 1}},
+	}
+
+	ctx := &PolicyContext{User: "alice", Account: "ACME"}
+	result := Compile(policies, ctx, NewNatsPermissions())
+
+	want := UserLimits{MaxPayload: 4096, MaxSubscriptions: 10}
+	if result.Limits != want {
+		t.Errorf("Limits = %+v, want %+v (skipped policies must not count)", result.Limits, want)
+	}
+}
+
+func TestCompile_JSDomain(t *testing.T) {
+	policies := []*Policy{
+		{
+			ID:      "edge",
+			Account: "ACME",
+			Statements: []Statement{
+				{Effect: EffectAllow, Actions: []Action{ActionJSView}, Resources: []string{"js:ORDERS"}, JSDomain: "edge"},
+				{Effect: EffectAllow, Actions: []Action{ActionKVRead}, Resources: []string{"kv:config"}, JSDomain: "{{ user.attr.site }}"},
+				{Effect: EffectAllow, Actions: []Action{ActionJSView}, Resources: []string{"js:EVENTS"}, JSDomain: "{{ user.attr.missing }}"},
+			},
+		},
+	}
+
+	ctx := &PolicyContext{User: "alice", Account: "ACME", UserClaims: map[string]string{"site": "leaf1"}}
+	perms := NewNatsPermissions()
+	result := Compile(policies, ctx, perms)
+	perms.Deduplicate()
+
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "statement skipped") {
+		t.Errorf("warnings = %v, want the statement with the missing attribute skipped", result.Warnings)
+	}
+
+	want := map[string]bool{
+		"$JS.edge.API.INFO":                               false,
+		"$JS.edge.API.STREAM.INFO.ORDERS":                 false,
+		"$JS.leaf1.API.INFO":                              false,
+		"$JS.leaf1.API.DIRECT.GET.KV_config.$KV.config.>": false,
+	}
+	for _, p := range perms.PubList() {
+		if strings.HasPrefix(p.Subject, "$JS.API.") {
+			t.Errorf("unscoped permission %s", p.Subject)
+		}
+		if strings.Contains(p.Subject, "EVENTS") {
+			t.Errorf("permission %s of the skipped statement", p.Subject)
+		}
+		if _, ok := want[p.Subject]; ok {
+			want[p.Subject] = true
+		}
+	}
+	for subject, found := range want {
+		if !found {
+			t.Errorf("missing permission %s", subject)
+		}
+	}
+}
+
+func TestCompile_ResponseLimits(t *testing.T) {
+	policies := []*Policy{
+		{
+			ID:      "services",
+			Account: "ACME",
+			Statements: []Statement{
+				{Effect: EffectAllow, Actions: []Action{ActionNATSService}, Resources: []string{"nats:reports"}, Response: &ResponseLimits{MaxMsgs: 10, Expires: "30s"}},
+				{Effect: EffectAllow, Actions: []Action{ActionNATSService}, Resources: []string{"nats:stream"}, Response: &ResponseLimits{MaxMsgs: 3, Expires: "5m"}},
+			},
+		},
+	}
+
+	ctx := &PolicyContext{User: "alice", Account: "ACME"}
+	perms := NewNatsPermissions()
+	result := Compile(policies, ctx, perms)
+	if len(result.Warnings) != 0 {
+		t.Errorf("warnings = %v", result.Warnings)
+	}
+
+	// The most permissive of each limit wins.
+	resp := perms.ToNatsJWT().Resp
+	if resp == nil || resp.MaxMsgs != 10 || resp.Expires != 5*time.Minute {
+		t.Errorf("Resp = %+v, want MaxMsgs 10 and Expires 5m", resp)
+	}
+
+	// A statement without limits stands for the defaults of one response
+	// within two minutes.
+	policies[0].Statements = append(policies[0].Statements,
+		Statement{Effect: EffectAllow, Actions: []Action{ActionNATSService}, Resources: []string{"nats:ping"}})
+	policies[0].Statements[1].Response.Expires = "1m"
+	perms = NewNatsPermissions()
+	Compile(policies, ctx, perms)
+	resp = perms.ToNatsJWT().Resp
+	if resp == nil || resp.MaxMsgs != 10 || resp.Expires != 0 {
+		t.Errorf("Resp = %+v, want MaxMsgs 10 and the default expiry", resp)
+	}
+
+	policies[0].Statements[0].Response.Expires = "soon"
+	perms = NewNatsPermissions()
+	result = Compile(policies, ctx, perms)
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "statement skipped") {
+		t.Errorf("warnings = %v, want the statement with the invalid expiry skipped", result.Warnings)
+	}
+}
+
+func TestMinTTL(t *testing.T) {
+	tests := []struct {
+		a, b, want time.Duration
+	}{
+		{0, 0, 0},
+		{0, time.Minute, time.Minute},
+		{time.Minute, 0, time.Minute},
+		{time.Hour, time.Minute, time.Minute},
+		{time.Minute, time.Hour, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := MinTTL(tt.a, tt.b); got != tt.want {
+			t.Errorf("MinTTL(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCompileExplained(t *testing.T) {
+	policies := []*Policy{
+		{
+			ID:      "orders",
+			Account: "ACME",
+			Statements: []Statement{
+				{
+					Effect:    EffectAllow,
+					Actions:   []Action{ActionNATSPub},
+					Resources: []string{"nats:orders.{{ user.id }}"},
+				},
+				{
+					Effect:    EffectAllow,
+					Actions:   []Action{ActionJSView},
+					Resources: []string{"js:ORDERS"},
+				},
+				{
+					Effect:    EffectDeny,
+					Actions:   []Action{ActionNATSPub},
+					Resources: []string{"nats:orders.internal"},
+				},
+			},
+		},
+	}
+	ctx := &PolicyContext{User: "alice", Account: "ACME", Role: "workers"}
+
+	perms := NewNatsPermissions()
+	result := CompileExplained(policies, ctx, perms)
+
+	want := []PermissionOrigin{
+		{Permission: Permission{Type: PermSub, Subject: "_INBOX_alice.>"}, Effect: EffectAllow, Implicit: "user inbox"},
+		{Permission: Permission{Type: PermPub, Subject: "orders.alice"}, Effect: EffectAllow, PolicyID: "orders", PolicyAccount: "ACME", Statement: 0, Resource: "nats:orders.{{ user.id }}", Action: ActionNATSPub},
+		{Permission: Permission{Type: PermPub, Subject: "$JS.API.INFO"}, Effect: EffectAllow, PolicyID: "orders", PolicyAccount: "ACME", Statement: 1, Resource: "js:ORDERS", Action: ActionJSView, Implicit: "JetStream account info"},
+		{Permission: Permission{Type: PermPub, Subject: "orders.internal"}, Effect: EffectDeny, PolicyID: "orders", PolicyAccount: "ACME", Statement: 2, Resource: "nats:orders.internal", Action: ActionNATSPub},
+	}
+	for _, w := range want {
+		found := false
+		for _, o := range result.Origins {
+			if o == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("missing origin %+v", w)
+		}
+	}
+	// Every permission is explained.
+	for _, o := range result.Origins {
+		if o.Permission.Type == "" {
+			t.Errorf("origin without permission: %+v", o)
+		}
+	}
+	if n := len(perms.PubList()) + len(perms.SubList()) + len(perms.PubDenyList()); n > len(result.Origins) {
+		t.Errorf("%d permissions but only %d origins", n, len(result.Origins))
+	}
+
+	// Compile records no origins.
+	if plain := Compile(policies, ctx, NewNatsPermissions()); plain.Origins != nil {
+		t.Errorf("Compile() Origins = %v, want nil", plain.Origins)
+	}
+}
+
+func TestPermission_Matches(t *testing.T) {
+	tests := []struct {
+		perm    string
+		subject string
+		want    bool
+	}{
+		{"orders.>", "orders.eu.new", true},
+		{"orders.*", "orders.eu", true},
+		{"orders.*", "orders.eu.new", false},
+		{"orders.>", "orders.*", true},
+		{"orders.eu", "orders.*", false},
+		{"orders", "invoices", false},
+	}
+	for _, tt := range tests {
+		if got := (Permission{Type: PermPub, Subject: tt.perm}).Matches(tt.subject); got != tt.want {
+			t.Errorf("Permission{%q}.Matches(%q) = %v, want %v", tt.perm, tt.subject, got, tt.want)
+		}
+	}
+}
+
+func TestCompile_Conditions(t *testing.T) {
+	policies := []*Policy{
+		{
+			ID:      "orders",
+			Account: "ACME",
+			Statements: []Statement{
+				{Effect: EffectAllow, Actions: []Action{ActionNATSPub}, Resources: []string{"nats:orders.eng"},
+					Conditions: Conditions{CondStringEquals: {"user.attr.department": {"eng"}}}},
+				{Effect: EffectAllow, Actions: []Action{ActionNATSPub}, Resources: []string{"nats:orders.ops"},
+					Conditions: Conditions{CondStringEquals: {"user.attr.department": {"ops"}}}},
+				{Effect: EffectDeny, Actions: []Action{ActionNATSPub}, Resources: []string{"nats:orders.>"},
+					Conditions: Conditions{CondNotIPAddress: {ClientIPKey: {"10.0.0.0/8"}}}},
+				{Effect: EffectAllow, Actions: []Action{ActionNATSPub}, Resources: []string{"nats:audit"},
+					Conditions: Conditions{CondIPAddress: {ClientIPKey: {"10.0.0.0/33"}}}},
+			},
+		},
+	}
+
+	ctx := &PolicyContext{User: "alice", Account: "ACME", UserClaims: map[string]string{"department": "eng"},
+		ClientIP: netip.MustParseAddr("192.0.2.1")}
+	perms := NewNatsPermissions()
+	result := Compile(policies, ctx, perms)
+	perms.Deduplicate()
+
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "invalid condition") {
+		t.Errorf("warnings = %v, want the statement with the malformed CIDR skipped", result.Warnings)
+	}
+	if pub := perms.PubList(); len(pub) != 0 {
+		t.Errorf("pub = %v, want none for a client outside 10.0.0.0/8", pub)
+	}
+
+	ctx.ClientIP = netip.MustParseAddr("10.1.2.3")
+	perms = NewNatsPermissions()
+	Compile(policies, ctx, perms)
+	perms.Deduplicate()
+	if pub := perms.PubList(); len(pub) != 1 || pub[0].Subject != "orders.eng" {
+		t.Errorf("pub = %v, want [orders.eng] for a client inside 10.0.0.0/8", pub)
+	}
+}
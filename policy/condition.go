@@ -0,0 +1,211 @@
+// Package policy provides policy-related types and functions for nauts.
+// This file contains statement conditions (attribute-based access control).
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// ConditionOperator compares a context value with the values of a condition.
+type ConditionOperator string
+
+const (
+	CondStringEquals    ConditionOperator = "StringEquals"    // value equals one of the values
+	CondStringNotEquals ConditionOperator = "StringNotEquals" // value equals none of the values
+	CondStringLike      ConditionOperator = "StringLike"      // value matches one of the patterns (* and ?)
+	CondStringNotLike   ConditionOperator = "StringNotLike"   // value matches none of the patterns
+	CondIPAddress       ConditionOperator = "IpAddress"       // address is in one of the CIDRs
+	CondNotIPAddress    ConditionOperator = "NotIpAddress"    // address is in none of the CIDRs
+)
+
+// ClientIPKey is the condition key of the client's source address, as
+// reported by the NATS server in the auth callout.
+const ClientIPKey = "client.ip"
+
+// Conditions restrict when a statement applies, keyed by operator and then
+// by context key, e.g. {"StringEquals": {"user.attr.department": ["eng"]}}.
+// All operators and keys must match (AND); a key matches if its value
+// matches any of the listed values (OR). Negated operators (StringNotEquals,
+// StringNotLike, NotIpAddress) also match if the key has no value, the
+// others do not.
+type Conditions map[ConditionOperator]map[string]ConditionValues
+
+// ConditionValues are the values a condition key is compared with. In JSON,
+// a single value may be written as a string.
+type ConditionValues []string
+
+// UnmarshalJSON accepts a string or a list of strings.
+func (v *ConditionValues) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*v = ConditionValues{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("condition values must be a string or a list of strings")
+	}
+	*v = list
+	return nil
+}
+
+// Validate checks the operators, keys, and values of the conditions. Keys
+// are context variables (IsKnownVariable) or client.ip; IP operators only
+// accept client.ip with addresses or CIDRs.
+func (c Conditions) Validate() error {
+	for op, keys := range c {
+		if !op.isValid() {
+			return fmt.Errorf("%w: unknown operator %q", ErrInvalidCondition, op)
+		}
+		if len(keys) == 0 {
+			return fmt.Errorf("%w: %s has no keys", ErrInvalidCondition, op)
+		}
+		for key, values := range keys {
+			if len(values) == 0 {
+				return fmt.Errorf("%w: %s %s has no values", ErrInvalidCondition, op, key)
+			}
+			if !op.isIP() {
+				if key != ClientIPKey && !IsKnownVariable(key) {
+					return fmt.Errorf("%w: unknown key %q", ErrInvalidCondition, key)
+				}
+				continue
+			}
+			if key != ClientIPKey {
+				return fmt.Errorf("%w: %s only supports %s, got %q", ErrInvalidCondition, op, ClientIPKey, key)
+			}
+			for _, value := range values {
+				if _, err := parsePrefix(value); err != nil {
+					return fmt.Errorf("%w: %s %s: %v", ErrInvalidCondition, op, key, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Evaluate reports whether the conditions hold for ctx. Empty conditions
+// always hold. Returns an error if a condition cannot be evaluated, e.g. for
+// an unknown operator or a malformed pattern.
+func (c Conditions) Evaluate(ctx *PolicyContext) (bool, error) {
+	for op, keys := range c {
+		for key, values := range keys {
+			ok, err := op.evaluate(conditionValue(ctx, key), values)
+			if err != nil {
+				return false, fmt.Errorf("%w: %s %s: %v", ErrInvalidCondition, op, key, err)
+			}
+			if !ok {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// conditionValue returns the value of key in ctx, or "" if it has none.
+func conditionValue(ctx *PolicyContext, key string) string {
+	if key == ClientIPKey {
+		if ctx == nil || !ctx.ClientIP.IsValid() {
+			return ""
+		}
+		return ctx.ClientIP.String()
+	}
+	value, _ := ctx.Get(key)
+	return value
+}
+
+func (op ConditionOperator) isValid() bool {
+	switch op {
+	case CondStringEquals, CondStringNotEquals, CondStringLike, CondStringNotLike, CondIPAddress, CondNotIPAddress:
+		return true
+	}
+	return false
+}
+
+func (op ConditionOperator) isIP() bool {
+	return op == CondIPAddress || op == CondNotIPAddress
+}
+
+// evaluate compares value with values. An empty value is a missing key.
+func (op ConditionOperator) evaluate(value string, values ConditionValues) (bool, error) {
+	var negated bool
+	var match func(string) (bool, error)
+	switch op {
+	case CondStringEquals, CondStringNotEquals:
+		negated = op == CondStringNotEquals
+		match = func(v string) (bool, error) { return v == value, nil }
+	case CondStringLike, CondStringNotLike:
+		negated = op == CondStringNotLike
+		match = func(v string) (bool, error) { return globMatch(v, value), nil }
+	case CondIPAddress, CondNotIPAddress:
+		negated = op == CondNotIPAddress
+		addr, err := netip.ParseAddr(value)
+		if value != "" && err != nil {
+			return false, err
+		}
+		match = func(v string) (bool, error) {
+			prefix, err := parsePrefix(v)
+			return err == nil && prefix.Contains(addr.Unmap()), err
+		}
+	default:
+		return false, fmt.Errorf("unknown operator %q", op)
+	}
+
+	if value == "" {
+		return negated, nil
+	}
+	matched := false
+	for _, v := range values {
+		ok, err := match(v)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			matched = true
+			break
+		}
+	}
+	return matched != negated, nil
+}
+
+// globMatch reports whether s matches pattern, where * matches any sequence
+// of characters and ? a single character.
+func globMatch(pattern, s string) bool {
+	p, t := []rune(pattern), []rune(s)
+	pi, ti, star, mark := 0, 0, -1, 0
+	for ti < len(t) {
+		switch {
+		case pi < len(p) && (p[pi] == '?' || p[pi] == t[ti]):
+			pi++
+			ti++
+		case pi < len(p) && p[pi] == '*':
+			star, mark = pi, ti
+			pi++
+		case star >= 0:
+			mark++
+			pi, ti = star+1, mark
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
+
+// parsePrefix parses a CIDR or a single address.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
@@ -0,0 +1,168 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestConditions_Evaluate(t *testing.T) {
+	ctx := &PolicyContext{
+		User:       "alice",
+		Account:    "ACME",
+		Role:       "workers",
+		UserClaims: map[string]string{"department": "eng", "team": "eng-platform"},
+		ClientIP:   netip.MustParseAddr("10.1.2.3"),
+		ClientName: "billing-worker",
+		ClientLang: "go",
+	}
+
+	tests := []struct {
+		name       string
+		conditions Conditions
+		want       bool
+	}{
+		{"empty", nil, true},
+		{"equals", Conditions{CondStringEquals: {"user.attr.department": {"eng"}}}, true},
+		{"equals any value", Conditions{CondStringEquals: {"user.attr.department": {"ops", "eng"}}}, true},
+		{"equals mismatch", Conditions{CondStringEquals: {"user.attr.department": {"ops"}}}, false},
+		{"equals missing key", Conditions{CondStringEquals: {"user.attr.site": {"eng"}}}, false},
+		{"not equals", Conditions{CondStringNotEquals: {"role.id": {"admins"}}}, true},
+		{"not equals mismatch", Conditions{CondStringNotEquals: {"role.id": {"workers"}}}, false},
+		{"not equals missing key", Conditions{CondStringNotEquals: {"user.attr.site": {"eng"}}}, true},
+		{"like", Conditions{CondStringLike: {"user.attr.team": {"eng-*"}}}, true},
+		{"like mismatch", Conditions{CondStringLike: {"user.attr.team": {"ops-*"}}}, false},
+		{"not like", Conditions{CondStringNotLike: {"user.attr.team": {"ops-*"}}}, true},
+		{"ip in cidr", Conditions{CondIPAddress: {ClientIPKey: {"192.0.2.0/24", "10.0.0.0/8"}}}, true},
+		{"ip exact", Conditions{CondIPAddress: {ClientIPKey: {"10.1.2.3"}}}, true},
+		{"ip outside", Conditions{CondIPAddress: {ClientIPKey: {"192.0.2.0/24"}}}, false},
+		{"not ip", Conditions{CondNotIPAddress: {ClientIPKey: {"192.0.2.0/24"}}}, true},
+		{"client name", Conditions{CondStringLike: {"client.name": {"billing-*"}}}, true},
+		{"client lang", Conditions{CondStringEquals: {"client.lang": {"python3"}}}, false},
+		{"client host", Conditions{CondStringEquals: {"client.host": {"10.1.2.3"}}}, true},
+		{"client version missing", Conditions{CondStringNotEquals: {"client.version": {"1.0.0"}}}, true},
+		{"all must hold", Conditions{
+			CondStringEquals: {"user.attr.department": {"eng"}, "account.id": {"ACME"}},
+			CondIPAddress:    {ClientIPKey: {"192.0.2.0/24"}},
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.conditions.Evaluate(ctx)
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Evaluate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConditions_EvaluateWithoutClientIP(t *testing.T) {
+	ctx := &PolicyContext{User: "alice", Account: "ACME"}
+
+	if ok, _ := (Conditions{CondIPAddress: {ClientIPKey: {"0.0.0.0/0"}}}).Evaluate(ctx); ok {
+		t.Error("IpAddress must not hold without a client address")
+	}
+	if ok, _ := (Conditions{CondNotIPAddress: {ClientIPKey: {"10.0.0.0/8"}}}).Evaluate(ctx); !ok {
+		t.Error("NotIpAddress must hold without a client address")
+	}
+}
+
+func TestConditions_EvaluateInvalid(t *testing.T) {
+	ctx := &PolicyContext{User: "alice", ClientIP: netip.MustParseAddr("10.1.2.3")}
+
+	for _, c := range []Conditions{
+		{"StringMatches": {"user.id": {"alice"}}},
+		{CondStringEquals: {ClientIPKey: {"10.1.2.3"}}, CondIPAddress: {"user.id": {"10.0.0.0/8"}}},
+		{CondIPAddress: {ClientIPKey: {"10.0.0.0/33"}}},
+	} {
+		ok, err := c.Evaluate(ctx)
+		if ok || !errors.Is(err, ErrInvalidCondition) {
+			t.Errorf("Evaluate(%v) = %v, %v; want false, ErrInvalidCondition", c, ok, err)
+		}
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"", "", true},
+		{"*", "", true},
+		{"*", "anything/at.all", true},
+		{"eng-*", "eng-platform", true},
+		{"eng-*", "eng", false},
+		{"*-platform", "eng-platform", true},
+		{"e?g", "eng", true},
+		{"e?g", "eg", false},
+		{"a*b*c", "a-b-b-c", true},
+		{"a*b*c", "a-b-b-d", false},
+		{"arn:aws:iam::*:role/*", "arn:aws:iam::123:role/nauts-app", true},
+		{"alice", "alice2", false},
+	}
+	for _, tt := range tests {
+		if got := globMatch(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestConditions_Validate(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions Conditions
+		wantErr    bool
+	}{
+		{"nil", nil, false},
+		{"string", Conditions{CondStringEquals: {"user.attr.department": {"eng"}}}, false},
+		{"string on client ip", Conditions{CondStringLike: {ClientIPKey: {"10.*"}}}, false},
+		{"client name", Conditions{CondStringEquals: {"client.name": {"worker"}}}, false},
+		{"ip on client host", Conditions{CondIPAddress: {"client.host": {"10.0.0.0/8"}}}, true},
+		{"ip", Conditions{CondIPAddress: {ClientIPKey: {"10.0.0.0/8", "2001:db8::1"}}}, false},
+		{"unknown operator", Conditions{"StringMatches": {"user.id": {"alice"}}}, true},
+		{"unknown key", Conditions{CondStringEquals: {"user.name": {"alice"}}}, true},
+		{"no keys", Conditions{CondStringEquals: {}}, true},
+		{"no values", Conditions{CondStringEquals: {"user.id": {}}}, true},
+		{"ip on other key", Conditions{CondIPAddress: {"user.attr.ip": {"10.0.0.0/8"}}}, true},
+		{"invalid cidr", Conditions{CondNotIPAddress: {ClientIPKey: {"10.0.0.0/33"}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.conditions.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidCondition) {
+				t.Errorf("Validate() error = %v, want ErrInvalidCondition", err)
+			}
+		})
+	}
+}
+
+func TestConditions_UnmarshalJSON(t *testing.T) {
+	var stmt Statement
+	data := `{"effect":"allow","actions":["nats.sub"],"resources":["nats:orders"],
+		"conditions":{"StringEquals":{"user.attr.department":"eng"},"IpAddress":{"client.ip":["10.0.0.0/8","192.0.2.1"]}}}`
+	if err := json.Unmarshal([]byte(data), &stmt); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if got := stmt.Conditions[CondStringEquals]["user.attr.department"]; len(got) != 1 || got[0] != "eng" {
+		t.Errorf("StringEquals values = %v, want [eng]", got)
+	}
+	if got := stmt.Conditions[CondIPAddress][ClientIPKey]; len(got) != 2 {
+		t.Errorf("IpAddress values = %v, want 2 values", got)
+	}
+	if err := stmt.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	if err := json.Unmarshal([]byte(`{"conditions":{"StringEquals":{"user.id":1}}}`), &stmt); err == nil {
+		t.Error("expected an error for a non-string value")
+	}
+}
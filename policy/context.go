@@ -2,7 +2,10 @@
 // This file contains context types for variable interpolation.
 package policy
 
-import "strings"
+import (
+	"net/netip"
+	"strings"
+)
 
 // PolicyContext holds interpolation variables for policy compilation.
 //
@@ -23,6 +26,19 @@ type PolicyContext struct {
 	Role string
 	// UserClaims provides additional user claims exposed as `user.attr.<key>`.
 	UserClaims map[string]string
+	// ClientIP is the client's source address, exposed as `client.host` and
+	// to the IP operators of statement conditions as `client.ip`.
+	ClientIP netip.Addr
+	// ClientName, ClientLang, and ClientVersion are the name, library
+	// language, and library version the client sent in its CONNECT, exposed
+	// as `client.name`, `client.lang`, and `client.version`. Clients choose
+	// them freely, so they do not prove anything about the client.
+	ClientName    string
+	ClientLang    string
+	ClientVersion string
+	// Inbox is the subject the user may subscribe to for replies (see
+	// InboxPermission): "" grants DefaultInbox, InboxNone nothing.
+	Inbox string
 }
 
 // Get returns the value for a context key.
@@ -49,6 +65,17 @@ func (c *PolicyContext) Get(key string) (string, bool) {
 			return "", false
 		}
 		return c.Role, true
+	case "client.host":
+		if !c.ClientIP.IsValid() {
+			return "", false
+		}
+		return c.ClientIP.String(), true
+	case "client.name":
+		return c.ClientName, c.ClientName != ""
+	case "client.lang":
+		return c.ClientLang, c.ClientLang != ""
+	case "client.version":
+		return c.ClientVersion, c.ClientVersion != ""
 	}
 
 	const userAttrPrefix = "user.attr."
@@ -73,9 +100,14 @@ func (c *PolicyContext) Clone() *PolicyContext {
 		return nil
 	}
 	out := &PolicyContext{
-		User:    c.User,
-		Account: c.Account,
-		Role:    c.Role,
+		User:          c.User,
+		Account:       c.Account,
+		Role:          c.Role,
+		ClientIP:      c.ClientIP,
+		ClientName:    c.ClientName,
+		ClientLang:    c.ClientLang,
+		ClientVersion: c.ClientVersion,
+		Inbox:         c.Inbox,
 	}
 	if len(c.UserClaims) == 0 {
 		return out
@@ -0,0 +1,67 @@
+// Package policy provides policy-related types and functions for nauts.
+// This file contains JetStream domain scoping of permissions.
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// jsAPIPrefix is the JetStream API prefix of the local domain.
+const jsAPIPrefix = "$JS.API"
+
+// jsDomainPattern matches JetStream domain names, which form a single subject token.
+var jsDomainPattern = regexp.MustCompile(`^[a-zA-Z0-9_\-]+$`)
+
+// ValidateJSDomain checks that domain is a valid JetStream domain name.
+func ValidateJSDomain(domain string) error {
+	if !jsDomainPattern.MatchString(domain) {
+		return fmt.Errorf("%w: %q", ErrInvalidJSDomain, domain)
+	}
+	return nil
+}
+
+// JSAPIPrefix returns the JetStream API prefix for domain: "$JS.API" for
+// the empty (local) domain, "$JS.<domain>.API" otherwise.
+func JSAPIPrefix(domain string) string {
+	if domain == "" {
+		return jsAPIPrefix
+	}
+	return "$JS." + domain + ".API"
+}
+
+// ScopeToJSDomain rewrites the $JS.API subjects of perms to the API prefix
+// of domain, so that they only allow (or deny) requests to that domain.
+// Other subjects (acks, flow control, KV and stream subjects) are not
+// domain-specific and are returned unchanged.
+func ScopeToJSDomain(perms []Permission, domain string) []Permission {
+	if domain == "" {
+		return perms
+	}
+	prefix := JSAPIPrefix(domain)
+	scoped := make([]Permission, len(perms))
+	for i, p := range perms {
+		if rest, ok := strings.CutPrefix(p.Subject, jsAPIPrefix+"."); ok {
+			p.Subject = prefix + "." + rest
+		}
+		scoped[i] = p
+	}
+	return scoped
+}
+
+// resolveJSDomain interpolates a statement's jsDomain and validates the result.
+func resolveJSDomain(template string, ctx *PolicyContext) (string, error) {
+	domain := template
+	if ContainsVariables(template) {
+		interpResult := InterpolateWithContext(template, ctx)
+		if interpResult.Excluded {
+			return "", fmt.Errorf("%w: %s", ErrInvalidJSDomain, interpResult.Warning)
+		}
+		domain = interpResult.Value
+	}
+	if err := ValidateJSDomain(domain); err != nil {
+		return "", err
+	}
+	return domain, nil
+}
@@ -0,0 +1,57 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestScopeToJSDomain(t *testing.T) {
+	perms := []Permission{
+		{Type: PermPub, Subject: "$JS.API.STREAM.INFO.ORDERS"},
+		{Type: PermPub, Subject: "$JS.ACK.ORDERS.>"},
+		{Type: PermPub, Subject: "$JS.APIX"},
+		{Type: PermSub, Subject: "orders.>"},
+	}
+
+	if got := ScopeToJSDomain(perms, ""); &got[0] != &perms[0] {
+		t.Error("empty domain must return the permissions unchanged")
+	}
+
+	got := ScopeToJSDomain(perms, "hub")
+	want := []string{"$JS.hub.API.STREAM.INFO.ORDERS", "$JS.ACK.ORDERS.>", "$JS.APIX", "orders.>"}
+	for i, p := range got {
+		if p.Subject != want[i] {
+			t.Errorf("subject[%d] = %s, want %s", i, p.Subject, want[i])
+		}
+	}
+	if perms[0].Subject != "$JS.API.STREAM.INFO.ORDERS" {
+		t.Error("input permissions were modified")
+	}
+}
+
+func TestValidateJSDomainTemplate(t *testing.T) {
+	tests := []struct {
+		domain  string
+		wantErr error
+	}{
+		{"edge", nil},
+		{"leaf-1_a", nil},
+		{"{{ user.attr.site }}", nil},
+		{"site-{{ account.id }}", nil},
+		{"hub.edge", ErrInvalidJSDomain},
+		{"*", ErrInvalidJSDomain},
+		{"a b", ErrInvalidJSDomain},
+		{"{{ user.nope }}", ErrUnresolvedVariable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			err := ValidateJSDomainTemplate(tt.domain)
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("ValidateJSDomainTemplate() error = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("ValidateJSDomainTemplate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
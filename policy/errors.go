@@ -29,6 +29,12 @@ var (
 
 	// Action errors
 	ErrUnknownAction = errors.New("unknown action")
+
+	// JetStream domain errors
+	ErrInvalidJSDomain = errors.New("invalid JetStream domain")
+
+	// Condition errors
+	ErrInvalidCondition = errors.New("invalid condition")
 )
 
 // PolicyError represents an error during policy processing.
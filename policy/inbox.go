@@ -0,0 +1,98 @@
+// Package policy provides policy-related types and functions for nauts.
+// This file contains the implicit inbox permission.
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// DefaultInbox is the inbox every user may subscribe to unless configured
+// otherwise: replies to requests made with the inbox prefix _INBOX_<user id>.
+const DefaultInbox = "_INBOX_{{ user.id }}.>"
+
+// InboxNone disables the implicit inbox permission, e.g. for service users
+// that never make requests.
+const InboxNone = "none"
+
+// ValidateInboxTemplate checks an inbox as configured for an account or
+// policy: InboxNone, or a subject whose variables are known
+// (IsKnownVariable), e.g. "_INBOX.{{ user.id }}.>".
+func ValidateInboxTemplate(template string) error {
+	if template == InboxNone {
+		return nil
+	}
+	for _, m := range variablePattern.FindAllStringSubmatch(template, -1) {
+		if !IsKnownVariable(m[1]) {
+			return NewInterpolationError(template, m[1], "", "unknown variable", ErrUnresolvedVariable)
+		}
+	}
+	resolved := variablePattern.ReplaceAllString(template, templatePlaceholder)
+	if strings.Contains(resolved, "{{") || strings.Contains(resolved, "}}") {
+		return NewInterpolationError(template, "", "", "malformed variable", ErrUnresolvedVariable)
+	}
+	if strings.Contains(resolved, ":") {
+		return fmt.Errorf("inbox %q must be a subject, not a resource", template)
+	}
+	_, err := ParseAndValidateResource("nats:" + resolved)
+	return err
+}
+
+// ResolveInbox returns the inbox of a user holding policies: InboxNone if
+// one of them disables the inbox, else the inbox of the first policy that
+// sets one, else def. Policies setting different inboxes yield a warning.
+func ResolveInbox(def string, policies []*Policy) (string, []string) {
+	inbox := ""
+	var warnings []string
+	for _, pol := range policies {
+		if pol == nil || pol.Inbox == "" {
+			continue
+		}
+		if pol.Inbox == InboxNone {
+			return InboxNone, nil
+		}
+		switch {
+		case inbox == "":
+			inbox = pol.Inbox
+		case inbox != pol.Inbox:
+			warnings = append(warnings, fmt.Sprintf("inbox %q ignored, %q applies: %s", pol.Inbox, inbox, pol.ID))
+		}
+	}
+	if inbox == "" {
+		inbox = def
+	}
+	return inbox, warnings
+}
+
+// InboxPermission returns the implicit subscribe permission of the user's
+// inbox, ctx.Inbox (default DefaultInbox). ok is false if the context has no
+// user or the inbox is InboxNone. Variables are replaced by their values as
+// they are, so user IDs with dots span several tokens; values with
+// wildcards or whitespace are rejected.
+func InboxPermission(ctx *PolicyContext) (perm Permission, ok bool, err error) {
+	if ctx == nil || ctx.User == "" || ctx.Inbox == InboxNone {
+		return Permission{}, false, nil
+	}
+	template := ctx.Inbox
+	if template == "" {
+		template = DefaultInbox
+	}
+
+	var resolveErr error
+	subject := variablePattern.ReplaceAllStringFunc(template, func(m string) string {
+		name := variablePattern.FindStringSubmatch(m)[1]
+		value, found := ctx.Get(name)
+		switch {
+		case !found:
+			resolveErr = fmt.Errorf("unresolved variable: %s", name)
+		case strings.ContainsAny(value, "*>") || strings.ContainsFunc(value, unicode.IsSpace):
+			resolveErr = fmt.Errorf("invalid value for %s: %s", name, value)
+		}
+		return value
+	})
+	if resolveErr != nil {
+		return Permission{}, false, resolveErr
+	}
+	return Permission{Type: PermSub, Subject: subject}, true, nil
+}
@@ -0,0 +1,91 @@
+package policy
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestValidateInboxTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		wantErr  bool
+	}{
+		{template: InboxNone},
+		{template: DefaultInbox},
+		{template: "_INBOX.{{ user.id }}.>"},
+		{template: "_R_.{{ account.id }}.{{ user.attr.team }}.>"},
+		{template: "_INBOX.{{ user.unknown }}.>", wantErr: true},
+		{template: "_INBOX.{{ user.id }.>", wantErr: true},
+		{template: "js:ORDERS", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			err := ValidateInboxTemplate(tt.template)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateInboxTemplate(%q) error = %v, wantErr %v", tt.template, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResolveInbox(t *testing.T) {
+	custom := &Policy{ID: "custom", Inbox: "_INBOX.{{ user.id }}.>"}
+	other := &Policy{ID: "other", Inbox: "_R_.{{ user.id }}.>"}
+	none := &Policy{ID: "locked", Inbox: InboxNone}
+	plain := &Policy{ID: "plain"}
+
+	tests := []struct {
+		name         string
+		policies     []*Policy
+		want         string
+		wantWarnings int
+	}{
+		{name: "default", policies: []*Policy{plain, nil}, want: DefaultInbox},
+		{name: "policy", policies: []*Policy{plain, custom, custom}, want: custom.Inbox},
+		{name: "conflict", policies: []*Policy{custom, other}, want: custom.Inbox, wantWarnings: 1},
+		{name: "none wins", policies: []*Policy{custom, other, none}, want: InboxNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, warnings := ResolveInbox(DefaultInbox, tt.policies)
+			if got != tt.want || len(warnings) != tt.wantWarnings {
+				t.Errorf("ResolveInbox() = %q, %q; want %q with %d warnings", got, warnings, tt.want, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestInboxPermission(t *testing.T) {
+	tests := []struct {
+		name    string
+		ctx     *PolicyContext
+		want    string
+		wantOK  bool
+		wantErr bool
+	}{
+		{name: "default", ctx: &PolicyContext{User: "alice"}, want: "_INBOX_alice.>", wantOK: true},
+		{name: "template", ctx: &PolicyContext{User: "alice", Account: "ACME", Inbox: "_R_.{{ account.id }}.{{ user.id }}.>"}, want: "_R_.ACME.alice.>", wantOK: true},
+		{name: "none", ctx: &PolicyContext{User: "alice", Inbox: InboxNone}},
+		{name: "no user", ctx: &PolicyContext{}},
+		{name: "wildcard value", ctx: &PolicyContext{User: "a*"}, wantErr: true},
+		{name: "unresolved", ctx: &PolicyContext{User: "alice", Inbox: "{{ user.attr.queue }}.>"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			perm, ok, err := InboxPermission(tt.ctx)
+			if (err != nil) != tt.wantErr || ok != tt.wantOK {
+				t.Fatalf("InboxPermission() ok = %v, error = %v; want ok %v, wantErr %v", ok, err, tt.wantOK, tt.wantErr)
+			}
+			if ok && (perm.Type != PermSub || perm.Subject != tt.want) {
+				t.Errorf("InboxPermission() = %+v, want sub %q", perm, tt.want)
+			}
+		})
+	}
+
+	// Compile grants the context's inbox.
+	ps := NewNatsPermissions()
+	Compile([]*Policy{{ID: "p"}}, &PolicyContext{User: "alice", Inbox: "_INBOX.{{ user.id }}.>"}, ps)
+	if !slices.ContainsFunc(ps.SubList(), func(p Permission) bool { return p.Subject == "_INBOX.alice.>" }) {
+		t.Errorf("Compile() sub = %v, want _INBOX.alice.>", ps.SubList())
+	}
+}
@@ -110,3 +110,51 @@ func sanitizeValue(value string) error {
 
 	return nil
 }
+
+// templatePlaceholder replaces variables when a resource template is checked
+// without a user. It is a valid interpolated value.
+const templatePlaceholder = "x"
+
+// IsKnownVariable reports whether name can be resolved from a PolicyContext:
+// user.id, account.id, role.id, user.attr.<key>, client.host, client.name,
+// client.lang, or client.version. Attributes and client details may still be
+// missing for individual users.
+func IsKnownVariable(name string) bool {
+	switch name {
+	case "user.id", "account.id", "role.id",
+		"client.host", "client.name", "client.lang", "client.version":
+		return true
+	}
+	attr, ok := strings.CutPrefix(name, "user.attr.")
+	return ok && attr != ""
+}
+
+// ValidateResourceTemplate checks a resource as written in a policy, before
+// interpolation: every variable must be known (IsKnownVariable), no "{{" or
+// "}}" may remain outside a variable, and the resource with variables
+// replaced by a placeholder must pass ParseAndValidateResource.
+func ValidateResourceTemplate(template string) error {
+	for _, m := range variablePattern.FindAllStringSubmatch(template, -1) {
+		if !IsKnownVariable(m[1]) {
+			return NewInterpolationError(template, m[1], "", "unknown variable", ErrUnresolvedVariable)
+		}
+	}
+	resolved := variablePattern.ReplaceAllString(template, templatePlaceholder)
+	if strings.Contains(resolved, "{{") || strings.Contains(resolved, "}}") {
+		return NewInterpolationError(template, "", "", "malformed variable", ErrUnresolvedVariable)
+	}
+	_, err := ParseAndValidateResource(resolved)
+	return err
+}
+
+// ValidateJSDomainTemplate checks a statement's jsDomain as written in a
+// policy: variables must be known (IsKnownVariable), and the domain with
+// variables replaced by a placeholder must be a valid domain name.
+func ValidateJSDomainTemplate(template string) error {
+	for _, m := range variablePattern.FindAllStringSubmatch(template, -1) {
+		if !IsKnownVariable(m[1]) {
+			return NewInterpolationError(template, m[1], "", "unknown variable", ErrUnresolvedVariable)
+		}
+	}
+	return ValidateJSDomain(variablePattern.ReplaceAllString(template, templatePlaceholder))
+}
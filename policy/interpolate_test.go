@@ -1,6 +1,10 @@
 package policy
 
-import "testing"
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
 
 func TestInterpolateWithContext(t *testing.T) {
 	ctx := &PolicyContext{
@@ -186,6 +190,34 @@ func TestInterpolateWithContext(t *testing.T) {
 			wantExcl:   true,
 			wantReason: "unresolved variable: user.id",
 		},
+
+		// Client variables
+		{
+			name:      "client.name",
+			template:  "nats:telemetry.{{ client.lang }}.{{ client.name }}",
+			ctx:       &PolicyContext{ClientName: "sensor-7", ClientLang: "go"},
+			wantValue: "nats:telemetry.go.sensor-7",
+		},
+		{
+			name:      "client.host",
+			template:  "nats:hosts.{{ client.host }}",
+			ctx:       &PolicyContext{ClientIP: netip.MustParseAddr("10.1.2.3")},
+			wantValue: "nats:hosts.10.1.2.3",
+		},
+		{
+			name:       "client.host unknown",
+			template:   "nats:hosts.{{ client.host }}",
+			ctx:        &PolicyContext{},
+			wantExcl:   true,
+			wantReason: "unresolved variable: client.host",
+		},
+		{
+			name:       "client.name with spaces",
+			template:   "nats:apps.{{ client.name }}",
+			ctx:        &PolicyContext{ClientName: "my app"},
+			wantExcl:   true,
+			wantReason: "invalid value for client.name: my app",
+		},
 	}
 
 	for _, tt := range tests {
@@ -233,3 +265,39 @@ func TestContainsVariables(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateResourceTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		wantErr  error
+	}{
+		{"nats:orders.>", nil},
+		{"nats:user.{{ user.id }}.>", nil},
+		{"kv:{{ account.id }}_config:{{ user.attr.team }}.>", nil},
+		{"nats:role.{{role.id}}", nil},
+		{"nats:apps.{{ client.name }}.{{ client.version }}", nil},
+		{"nats:client.{{ client.id }}", ErrUnresolvedVariable},
+		{"nats:user.{{ user.name }}", ErrUnresolvedVariable},
+		{"nats:user.{{ user.attr. }}", ErrUnresolvedVariable},
+		{"nats:user.{{ user.id }", ErrUnresolvedVariable},
+		{"nats:user.{{ user-id }}", ErrUnresolvedVariable},
+		{"nats:orders.>.x", ErrInvalidWildcard},
+		{"queue:orders", ErrUnknownResourceType},
+		{"nats:", ErrInvalidResource},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			err := ValidateResourceTemplate(tt.template)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("ValidateResourceTemplate() error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ValidateResourceTemplate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// Package policy provides policy-related types and functions for nauts.
+// This file contains the connection limits of policies.
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+
+	"github.com/msimon/nauts/units"
+)
+
+// UserLimits throttle the connections of users granted a policy. Zero values
+// mean no limit.
+type UserLimits struct {
+	MaxPayload       int64 `json:"maxPayload,omitempty"`       // maximum message payload in bytes
+	MaxSubscriptions int64 `json:"maxSubscriptions,omitempty"` // maximum number of subscriptions
+	MaxData          int64 `json:"maxData,omitempty"`          // maximum number of bytes the connection may send
+}
+
+// UnmarshalJSON accepts maxPayload and maxData as numbers or size strings
+// (e.g. "1MiB", see units.ParseSize).
+func (l *UserLimits) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		MaxPayload       units.Size `json:"maxPayload"`
+		MaxSubscriptions int64      `json:"maxSubscriptions"`
+		MaxData          units.Size `json:"maxData"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	payload, err := raw.MaxPayload.Bytes()
+	if err != nil {
+		return fmt.Errorf("invalid limits.maxPayload: %w", err)
+	}
+	maxData, err := raw.MaxData.Bytes()
+	if err != nil {
+		return fmt.Errorf("invalid limits.maxData: %w", err)
+	}
+	*l = UserLimits{MaxPayload: payload, MaxSubscriptions: raw.MaxSubscriptions, MaxData: maxData}
+	return nil
+}
+
+// Validate checks that no limit is negative.
+func (l *UserLimits) Validate() error {
+	switch {
+	case l.MaxPayload < 0:
+		return fmt.Errorf("maxPayload must not be negative: %d", l.MaxPayload)
+	case l.MaxSubscriptions < 0:
+		return fmt.Errorf("maxSubscriptions must not be negative: %d", l.MaxSubscriptions)
+	case l.MaxData < 0:
+		return fmt.Errorf("maxData must not be negative: %d", l.MaxData)
+	}
+	return nil
+}
+
+// IsZero reports whether no limit is set.
+func (l UserLimits) IsZero() bool {
+	return l == UserLimits{}
+}
+
+// Restrict returns the most restrictive combination of l and o: each limit is
+// the smaller of the two, treating 0 as "no limit".
+func (l UserLimits) Restrict(o UserLimits) UserLimits {
+	return UserLimits{
+		MaxPayload:       minLimit(l.MaxPayload, o.MaxPayload),
+		MaxSubscriptions: minLimit(l.MaxSubscriptions, o.MaxSubscriptions),
+		MaxData:          minLimit(l.MaxData, o.MaxData),
+	}
+}
+
+// ApplyTo sets the limits on NATS user limits. Limits that are not set are
+// left unchanged (unlimited by default).
+func (l UserLimits) ApplyTo(limits *natsjwt.NatsLimits) {
+	if l.MaxPayload > 0 {
+		limits.Payload = l.MaxPayload
+	}
+	if l.MaxSubscriptions > 0 {
+		limits.Subs = l.MaxSubscriptions
+	}
+	if l.MaxData > 0 {
+		limits.Data = l.MaxData
+	}
+}
+
+// minLimit returns the smaller of two limits, treating 0 as "no limit".
+func minLimit(a, b int64) int64 {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
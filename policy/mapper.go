@@ -2,6 +2,8 @@
 // This file contains action-to-permission mapping logic.
 package policy
 
+import "encoding/base64"
+
 // MapActionToPermissions converts an action + NRN to NATS permissions.
 // Returns a list of permissions that should be granted.
 func MapActionToPermissions(action Action, n *Resource) []Permission {
@@ -32,6 +34,16 @@ func MapActionToPermissions(action Action, n *Resource) []Permission {
 	case ActionKVManage:
 		return mapKVManage(n)
 
+	// Object store actions
+	case ActionObjRead:
+		return mapObjRead(n)
+	case ActionObjWrite:
+		return mapObjWrite(n)
+	case ActionObjView:
+		return mapObjView(n)
+	case ActionObjManage:
+		return mapObjManage(n)
+
 	default:
 		return []Permission{}
 	}
@@ -281,3 +293,107 @@ func mapKVManage(n *Resource) []Permission {
 
 	return perms
 }
+
+// === Object Store ===
+
+// objMetaToken returns the last token of the meta subject of object, which
+// is the base64 encoded object name, or ">" for all objects.
+func objMetaToken(object string) string {
+	if object == "" || object == "*" || object == ">" {
+		return ">"
+	}
+	return base64.URLEncoding.EncodeToString([]byte(object))
+}
+
+// mapObjRead: obj.read
+func mapObjRead(n *Resource) []Permission {
+	if n.Type != ResourceTypeObj {
+		return []Permission{}
+	}
+
+	bucket := n.Identifier
+	meta := objMetaToken(n.SubIdentifier)
+
+	// Chunks are stored under random IDs, so reading them cannot be
+	// restricted to the chunks of one object. Clients without direct get
+	// look up metadata with STREAM.MSG.GET, which is not scoped to a subject
+	// either.
+	return []Permission{
+		{Type: PermPub, Subject: "$JS.API.STREAM.INFO.OBJ_" + bucket},
+		{Type: PermPub, Subject: "$JS.API.DIRECT.GET.OBJ_" + bucket + ".$O." + bucket + ".M." + meta},
+		{Type: PermPub, Subject: "$JS.API.STREAM.MSG.GET.OBJ_" + bucket},
+		{Type: PermPub, Subject: "$JS.API.CONSUMER.CREATE.OBJ_" + bucket},
+		{Type: PermPub, Subject: "$JS.API.CONSUMER.CREATE.OBJ_" + bucket + ".>"},
+		{Type: PermPub, Subject: "$JS.FC.OBJ_" + bucket + ".>"},
+	}
+}
+
+// mapObjWrite: obj.write
+func mapObjWrite(n *Resource) []Permission {
+	if n.Type != ResourceTypeObj {
+		return []Permission{}
+	}
+
+	// obj.write includes all obj.read permissions, as puts look up the
+	// current object to purge its chunks
+	perms := mapObjRead(n)
+	bucket := n.Identifier
+
+	perms = append(perms,
+		Permission{Type: PermPub, Subject: "$O." + bucket + ".C.>"},
+		Permission{Type: PermPub, Subject: "$O." + bucket + ".M." + objMetaToken(n.SubIdentifier)},
+		Permission{Type: PermPub, Subject: "$JS.API.STREAM.PURGE.OBJ_" + bucket},
+	)
+	return perms
+}
+
+// mapObjView: obj.view
+func mapObjView(n *Resource) []Permission {
+	if n.Type != ResourceTypeObj {
+		return []Permission{}
+	}
+
+	bucket := n.Identifier
+	if bucket == "" {
+		bucket = "*"
+	}
+
+	if bucket != "*" {
+		return []Permission{
+			{Type: PermPub, Subject: "$JS.API.STREAM.INFO.OBJ_" + bucket},
+		}
+	}
+
+	return []Permission{
+		{Type: PermPub, Subject: "$JS.API.STREAM.LIST"},
+		{Type: PermPub, Subject: "$JS.API.STREAM.INFO.*"},
+	}
+}
+
+// mapObjManage: obj.manage
+func mapObjManage(n *Resource) []Permission {
+	if n.Type != ResourceTypeObj {
+		return []Permission{}
+	}
+
+	// obj.manage includes all obj.read permissions
+	perms := mapObjRead(n)
+	bucket := n.Identifier
+	if bucket == "" {
+		bucket = "*"
+	}
+
+	if bucket != "*" {
+		perms = append(perms, Permission{Type: PermPub, Subject: "$JS.API.STREAM.*.OBJ_" + bucket})
+	}
+
+	if bucket == "*" {
+		perms = append(perms,
+			Permission{Type: PermPub, Subject: "$JS.API.STREAM.LIST"},
+			Permission{Type: PermPub, Subject: "$JS.API.STREAM.INFO.*"},
+			Permission{Type: PermPub, Subject: "$JS.API.STREAM.*.*"},
+		)
+	}
+
+	return perms
+}
@@ -372,6 +372,137 @@ func TestMapActionToPermissions_KV(t *testing.T) {
 	}
 }
 
+func TestMapActionToPermissions_Obj(t *testing.T) {
+	tests := []struct {
+		name   string
+		action Action
+		nrnStr string
+		want   []Permission
+	}{
+		{
+			name:   "obj.read specific object",
+			action: ActionObjRead,
+			nrnStr: "obj:files:report.pdf",
+			want: []Permission{
+				{Type: PermPub, Subject: "$JS.API.STREAM.INFO.OBJ_files"},
+				{Type: PermPub, Subject: "$JS.API.DIRECT.GET.OBJ_files.$O.files.M.cmVwb3J0LnBkZg=="},
+				{Type: PermPub, Subject: "$JS.API.STREAM.MSG.GET.OBJ_files"},
+				{Type: PermPub, Subject: "$JS.API.CONSUMER.CREATE.OBJ_files"},
+				{Type: PermPub, Subject: "$JS.API.CONSUMER.CREATE.OBJ_files.>"},
+				{Type: PermPub, Subject: "$JS.FC.OBJ_files.>"},
+			},
+		},
+		{
+			name:   "obj.read bucket only",
+			action: ActionObjRead,
+			nrnStr: "obj:files",
+			want: []Permission{
+				{Type: PermPub, Subject: "$JS.API.STREAM.INFO.OBJ_files"},
+				{Type: PermPub, Subject: "$JS.API.DIRECT.GET.OBJ_files.$O.files.M.>"},
+				{Type: PermPub, Subject: "$JS.API.STREAM.MSG.GET.OBJ_files"},
+				{Type: PermPub, Subject: "$JS.API.CONSUMER.CREATE.OBJ_files"},
+				{Type: PermPub, Subject: "$JS.API.CONSUMER.CREATE.OBJ_files.>"},
+				{Type: PermPub, Subject: "$JS.FC.OBJ_files.>"},
+			},
+		},
+		{
+			name:   "obj.write specific object",
+			action: ActionObjWrite,
+			nrnStr: "obj:files:report.pdf",
+			want: []Permission{
+				{Type: PermPub, Subject: "$JS.API.STREAM.INFO.OBJ_files"},
+				{Type: PermPub, Subject: "$JS.API.DIRECT.GET.OBJ_files.$O.files.M.cmVwb3J0LnBkZg=="},
+				{Type: PermPub, Subject: "$JS.API.STREAM.MSG.GET.OBJ_files"},
+				{Type: PermPub, Subject: "$JS.API.CONSUMER.CREATE.OBJ_files"},
+				{Type: PermPub, Subject: "$JS.API.CONSUMER.CREATE.OBJ_files.>"},
+				{Type: PermPub, Subject: "$JS.FC.OBJ_files.>"},
+				{Type: PermPub, Subject: "$O.files.C.>"},
+				{Type: PermPub, Subject: "$O.files.M.cmVwb3J0LnBkZg=="},
+				{Type: PermPub, Subject: "$JS.API.STREAM.PURGE.OBJ_files"},
+			},
+		},
+		{
+			name:   "obj.write object wildcard",
+			action: ActionObjWrite,
+			nrnStr: "obj:files:*",
+			want: []Permission{
+				{Type: PermPub, Subject: "$JS.API.STREAM.INFO.OBJ_files"},
+				{Type: PermPub, Subject: "$JS.API.DIRECT.GET.OBJ_files.$O.files.M.>"},
+				{Type: PermPub, Subject: "$JS.API.STREAM.MSG.GET.OBJ_files"},
+				{Type: PermPub, Subject: "$JS.API.CONSUMER.CREATE.OBJ_files"},
+				{Type: PermPub, Subject: "$JS.API.CONSUMER.CREATE.OBJ_files.>"},
+				{Type: PermPub, Subject: "$JS.FC.OBJ_files.>"},
+				{Type: PermPub, Subject: "$O.files.C.>"},
+				{Type: PermPub, Subject: "$O.files.M.>"},
+				{Type: PermPub, Subject: "$JS.API.STREAM.PURGE.OBJ_files"},
+			},
+		},
+		{
+			name:   "obj.view specific bucket",
+			action: ActionObjView,
+			nrnStr: "obj:files",
+			want: []Permission{
+				{Type: PermPub, Subject: "$JS.API.STREAM.INFO.OBJ_files"},
+			},
+		},
+		{
+			name:   "obj.view wildcard bucket",
+			action: ActionObjView,
+			nrnStr: "obj:*",
+			want: []Permission{
+				{Type: PermPub, Subject: "$JS.API.STREAM.LIST"},
+				{Type: PermPub, Subject: "$JS.API.STREAM.INFO.*"},
+			},
+		},
+		{
+			name:   "obj.manage specific bucket",
+			action: ActionObjManage,
+			nrnStr: "obj:files",
+			want: []Permission{
+				// obj.read permissions
+				{Type: PermPub, Subject: "$JS.API.STREAM.INFO.OBJ_files"},
+				{Type: PermPub, Subject: "$JS.API.DIRECT.GET.OBJ_files.$O.files.M.>"},
+				{Type: PermPub, Subject: "$JS.API.STREAM.MSG.GET.OBJ_files"},
+				{Type: PermPub, Subject: "$JS.API.CONSUMER.CREATE.OBJ_files"},
+				{Type: PermPub, Subject: "$JS.API.CONSUMER.CREATE.OBJ_files.>"},
+				{Type: PermPub, Subject: "$JS.FC.OBJ_files.>"},
+				// obj.manage additional permissions
+				{Type: PermPub, Subject: "$JS.API.STREAM.*.OBJ_files"},
+			},
+		},
+		{
+			name:   "obj.read wrong type",
+			action: ActionObjRead,
+			nrnStr: "kv:config",
+			want:   []Permission{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := ParseResource(tt.nrnStr)
+			if err != nil {
+				t.Fatalf("Failed to parse Resource: %v", err)
+			}
+
+			got := MapActionToPermissions(tt.action, n)
+
+			if len(got) != len(tt.want) {
+				t.Errorf("MapActionToPermissions() got %d permissions, want %d", len(got), len(tt.want))
+				for i, p := range got {
+					t.Logf("  got[%d]: %+v", i, p)
+				}
+				return
+			}
+			for i, w := range tt.want {
+				if got[i].Type != w.Type || got[i].Subject != w.Subject || got[i].Queue != w.Queue {
+					t.Errorf("MapActionToPermissions()[%d] = %+v, want %+v", i, got[i], w)
+				}
+			}
+		})
+	}
+}
+
 func TestMapActionToPermissions_UnknownAction(t *testing.T) {
 	n, _ := ParseResource("nats:orders")
 	got := MapActionToPermissions(Action("unknown"), n)
@@ -0,0 +1,171 @@
+// Package policy provides policy-related types and functions for nauts.
+// This file contains the subject ownership registry.
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SubjectClaim reserves subject prefixes of an account for a team. A prefix
+// covers the subject itself and all subjects below it, e.g. "orders" covers
+// "orders" and "orders.>"; a trailing ".>" may be written out.
+type SubjectClaim struct {
+	Account  string   `json:"account"`
+	Team     string   `json:"team"`
+	Prefixes []string `json:"prefixes"`
+}
+
+// SubjectOwnership is a registry of subject prefix claims. Policies name their
+// team with Policy.Team; Check reports the allow statements of a policy that
+// reach into a prefix claimed by another team.
+//
+// Within an account, a more specific claim takes precedence: if team "orders"
+// claims "orders" and team "audit" claims "orders.audit", policies of "audit"
+// may grant "orders.audit.>" but not "orders.>".
+type SubjectOwnership struct {
+	claims []ownershipClaim
+}
+
+type ownershipClaim struct {
+	account string
+	team    string
+	prefix  string // without a trailing ".>"
+}
+
+// OwnershipViolation is an allow statement of a policy that grants subjects
+// claimed by another team.
+type OwnershipViolation struct {
+	// Statement is the index of the statement in Policy.Statements.
+	Statement int `json:"statement"`
+	// Resource is the resource as written in the policy.
+	Resource string `json:"resource"`
+	// Account, Team and Prefix identify the claim.
+	Account string `json:"account"`
+	Team    string `json:"team"`
+	Prefix  string `json:"prefix"`
+}
+
+func (v OwnershipViolation) String() string {
+	return fmt.Sprintf("statement %d: resource %q reaches into %q owned by team %s", v.Statement, v.Resource, v.Prefix, v.Team)
+}
+
+// NewSubjectOwnership validates claims and builds the registry. A prefix must
+// be a literal subject and must not be claimed by two teams of an account.
+func NewSubjectOwnership(claims []SubjectClaim) (*SubjectOwnership, error) {
+	o := &SubjectOwnership{}
+	owners := make(map[string]string) // account + prefix -> team
+	for i, c := range claims {
+		if strings.TrimSpace(c.Account) == "" {
+			return nil, fmt.Errorf("claim %d: account is required", i)
+		}
+		if strings.TrimSpace(c.Team) == "" {
+			return nil, fmt.Errorf("claim %d: team is required", i)
+		}
+		if len(c.Prefixes) == 0 {
+			return nil, fmt.Errorf("claim %d: at least one prefix is required", i)
+		}
+		for _, p := range c.Prefixes {
+			prefix := strings.TrimSuffix(p, ".>")
+			if prefix == "" || strings.ContainsAny(prefix, "*> \t") || strings.Contains(prefix, "..") ||
+				strings.HasPrefix(prefix, ".") || strings.HasSuffix(prefix, ".") {
+				return nil, fmt.Errorf("claim %d: invalid prefix %q (must be a literal subject)", i, p)
+			}
+			key := c.Account + " " + prefix
+			if team, ok := owners[key]; ok && team != c.Team {
+				return nil, fmt.Errorf("prefix %q of account %s is claimed by teams %s and %s", prefix, c.Account, team, c.Team)
+			}
+			owners[key] = c.Team
+			o.claims = append(o.claims, ownershipClaim{account: c.Account, team: c.Team, prefix: prefix})
+		}
+	}
+	sort.SliceStable(o.claims, func(i, j int) bool {
+		a, b := o.claims[i], o.claims[j]
+		if a.account != b.account {
+			return a.account < b.account
+		}
+		return a.prefix < b.prefix
+	})
+	return o, nil
+}
+
+// Check returns the allow statements of pol whose subject resources overlap
+// a prefix claimed by a team other than pol.Team. Policies without a team
+// overlap every claim. Global policies are checked against the claims of all
+// accounts. Template variables may expand to any token, so a resource such
+// as "nats:orders.{{ user.id }}" is checked as "orders.*". Deny statements
+// and JetStream, KV and object store resources are not checked.
+func (o *SubjectOwnership) Check(pol *Policy) []OwnershipViolation {
+	if o == nil || pol == nil || len(o.claims) == 0 {
+		return nil
+	}
+	var violations []OwnershipViolation
+	for i, stmt := range pol.Statements {
+		if stmt.Effect != EffectAllow {
+			continue
+		}
+		for _, res := range stmt.Resources {
+			subject, ok := ownershipSubject(res)
+			if !ok {
+				continue
+			}
+			for _, c := range o.claims {
+				if c.team == pol.Team || (pol.Account != c.account && pol.Account != "_global") {
+					continue
+				}
+				if !subjectsOverlap(subject, c.prefix) && !subjectsOverlap(subject, c.prefix+".>") {
+					continue
+				}
+				if o.ownsWithin(c, pol.Team, subject) {
+					continue
+				}
+				violations = append(violations, OwnershipViolation{
+					Statement: i, Resource: res, Account: c.account, Team: c.team, Prefix: c.prefix,
+				})
+			}
+		}
+	}
+	return violations
+}
+
+// ownsWithin reports whether team holds a claim more specific than c that
+// covers subject, so that the subject belongs to team rather than c.team.
+func (o *SubjectOwnership) ownsWithin(c ownershipClaim, team, subject string) bool {
+	if team == "" {
+		return false
+	}
+	for _, own := range o.claims {
+		if own.team == team && own.account == c.account && own.prefix != c.prefix &&
+			prefixCovers(c.prefix, own.prefix) && prefixCovers(own.prefix, subject) {
+			return true
+		}
+	}
+	return false
+}
+
+// prefixCovers reports whether every subject matching subject lies in the
+// space of prefix.
+func prefixCovers(prefix, subject string) bool {
+	return subject == prefix || Permission{Subject: prefix + ".>"}.Matches(subject)
+}
+
+// ownershipSubject returns the subject of a NATS subject resource with every
+// token holding a template variable replaced by "*".
+func ownershipSubject(resource string) (string, bool) {
+	rest, ok := strings.CutPrefix(resource, string(ResourceTypeNATS)+":")
+	if !ok {
+		return "", false
+	}
+	// Variable names may contain dots; replace them before splitting.
+	const placeholder = "\x00"
+	rest = variablePattern.ReplaceAllString(rest, placeholder)
+	subject, _, _ := strings.Cut(rest, ":")
+	tokens := strings.Split(subject, ".")
+	for i, t := range tokens {
+		if strings.Contains(t, placeholder) {
+			tokens[i] = "*"
+		}
+	}
+	return strings.Join(tokens, "."), subject != ""
+}
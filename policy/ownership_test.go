@@ -0,0 +1,104 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewSubjectOwnership_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		claims  []SubjectClaim
+		wantErr string
+	}{
+		{"missing account", []SubjectClaim{{Team: "a", Prefixes: []string{"orders"}}}, "claim 0: account is required"},
+		{"missing team", []SubjectClaim{{Account: "APP", Prefixes: []string{"orders"}}}, "claim 0: team is required"},
+		{"no prefixes", []SubjectClaim{{Account: "APP", Team: "a"}}, "claim 0: at least one prefix is required"},
+		{"wildcard prefix", []SubjectClaim{{Account: "APP", Team: "a", Prefixes: []string{"orders.*"}}}, `invalid prefix "orders.*"`},
+		{"empty token", []SubjectClaim{{Account: "APP", Team: "a", Prefixes: []string{"orders..eu"}}}, `invalid prefix "orders..eu"`},
+		{
+			"claimed twice",
+			[]SubjectClaim{
+				{Account: "APP", Team: "a", Prefixes: []string{"orders"}},
+				{Account: "APP", Team: "b", Prefixes: []string{"orders.>"}},
+			},
+			`prefix "orders" of account APP is claimed by teams a and b`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSubjectOwnership(tt.claims)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewSubjectOwnership() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// The same prefix in different accounts or twice for one team is fine.
+	if _, err := NewSubjectOwnership([]SubjectClaim{
+		{Account: "APP", Team: "a", Prefixes: []string{"orders", "orders.>"}},
+		{Account: "OTHER", Team: "b", Prefixes: []string{"orders"}},
+	}); err != nil {
+		t.Errorf("NewSubjectOwnership() error = %v", err)
+	}
+}
+
+func TestSubjectOwnership_Check(t *testing.T) {
+	o, err := NewSubjectOwnership([]SubjectClaim{
+		{Account: "APP", Team: "orders", Prefixes: []string{"orders.>"}},
+		{Account: "APP", Team: "audit", Prefixes: []string{"orders.audit", "audit"}},
+		{Account: "OTHER", Team: "billing", Prefixes: []string{"billing"}},
+	})
+	if err != nil {
+		t.Fatalf("NewSubjectOwnership() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		account  string
+		team     string
+		effect   Effect
+		resource string
+		want     []string // teams of the violated claims
+	}{
+		{name: "own prefix", account: "APP", team: "orders", resource: "nats:orders.eu.>"},
+		{name: "unclaimed subject", account: "APP", team: "orders", resource: "nats:public.>"},
+		{name: "foreign prefix", account: "APP", team: "orders", resource: "nats:audit.log", want: []string{"audit"}},
+		{name: "nested foreign claim", account: "APP", team: "orders", resource: "nats:orders.>", want: []string{"audit"}},
+		{name: "nested own claim", account: "APP", team: "audit", resource: "nats:orders.audit.>"},
+		{name: "outside nested own claim", account: "APP", team: "audit", resource: "nats:orders.*", want: []string{"orders"}},
+		{name: "full wildcard", account: "APP", team: "orders", resource: "nats:>", want: []string{"audit", "audit"}},
+		{name: "no team", account: "APP", resource: "nats:orders.eu", want: []string{"orders"}},
+		{name: "variable token", account: "APP", team: "orders", resource: "nats:{{ user.id }}.log", want: []string{"audit"}},
+		{name: "queue resource", account: "APP", team: "orders", resource: "nats:audit.log:workers", want: []string{"audit"}},
+		{name: "deny statement", account: "APP", team: "orders", effect: EffectDeny, resource: "nats:audit.>"},
+		{name: "stream resource", account: "APP", team: "orders", resource: "js:audit"},
+		{name: "other account", account: "APP", team: "orders", resource: "nats:billing.>"},
+		{name: "global policy", account: "_global", team: "orders", resource: "nats:billing.>", want: []string{"billing"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			effect := tt.effect
+			if effect == "" {
+				effect = EffectAllow
+			}
+			pol := &Policy{ID: "p", Account: tt.account, Team: tt.team, Statements: []Statement{
+				{Effect: effect, Actions: []Action{ActionNATSPub}, Resources: []string{tt.resource}},
+			}}
+			var got []string
+			for _, v := range o.Check(pol) {
+				if v.Resource != tt.resource || v.Statement != 0 {
+					t.Errorf("violation = %+v, want resource %q in statement 0", v, tt.resource)
+				}
+				got = append(got, v.Team)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Check() teams = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if v := (*SubjectOwnership)(nil).Check(&Policy{}); v != nil {
+		t.Errorf("nil registry Check() = %v, want nil", v)
+	}
+}
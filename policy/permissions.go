@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	natsjwt "github.com/nats-io/jwt/v2"
 )
@@ -25,6 +26,10 @@ type Permission struct {
 	Type    PermissionType `json:"type"`
 	Subject string         `json:"subject"`
 	Queue   string         `json:"queue,omitempty"` // Only for SUB permissions
+	// MaxMsgs and Expires limit the responses of RESP permissions; zero keeps
+	// the NATS defaults (one response within two minutes).
+	MaxMsgs int           `json:"maxMsgs,omitempty"`
+	Expires time.Duration `json:"expires,omitempty"`
 }
 
 func (p Permission) String() string {
@@ -34,15 +39,18 @@ func (p Permission) String() string {
 	return p.Subject
 }
 
-// PermissionSet holds a set of allowed subjects with wildcard-aware deduplication.
+// PermissionSet holds sets of allowed and denied subjects with wildcard-aware
+// deduplication. Denied subjects take precedence over allowed subjects.
 type PermissionSet struct {
 	allow map[Permission]struct{}
+	deny  map[Permission]struct{}
 }
 
 // NewPermissionSet creates a new empty PermissionSet.
 func NewPermissionSet() *PermissionSet {
 	return &PermissionSet{
 		allow: make(map[Permission]struct{}),
+		deny:  make(map[Permission]struct{}),
 	}
 }
 
@@ -54,13 +62,27 @@ func (ps *PermissionSet) Add(p Permission) {
 	ps.allow[p] = struct{}{}
 }
 
+// AddDeny adds a subject to the deny set.
+func (ps *PermissionSet) AddDeny(p Permission) {
+	if ps.deny == nil {
+		ps.deny = make(map[Permission]struct{})
+	}
+	ps.deny[p] = struct{}{}
+}
+
 // AllowList returns the allow set as a sorted slice.
 func (ps *PermissionSet) AllowList() []Permission {
-	if ps.allow == nil {
-		return []Permission{}
-	}
-	result := make([]Permission, 0, len(ps.allow))
-	for s := range ps.allow {
+	return sortedPermissions(ps.allow)
+}
+
+// DenyList returns the deny set as a sorted slice.
+func (ps *PermissionSet) DenyList() []Permission {
+	return sortedPermissions(ps.deny)
+}
+
+func sortedPermissions(set map[Permission]struct{}) []Permission {
+	result := make([]Permission, 0, len(set))
+	for s := range set {
 		result = append(result, s)
 	}
 	// Sort by Subject, then Queue
@@ -74,8 +96,39 @@ func (ps *PermissionSet) AllowList() []Permission {
 }
 
 // Deduplicate removes subjects that are covered by wildcards.
+//
+// Deny overrides allow: allowed subjects covered by a denied subject are
+// removed, and denied subjects that overlap no remaining allowed subject are
+// dropped, since NATS denies those anyway.
 func (ps *PermissionSet) Deduplicate() {
-	ps.allow = deduplicateWithWildcards(ps.allow)
+	deny := deduplicateWithWildcards(ps.deny)
+	allow := make(map[Permission]struct{}, len(ps.allow))
+	for perm := range deduplicateWithWildcards(ps.allow) {
+		denied := false
+		for d := range deny {
+			if isCoveredBy(perm, d) {
+				denied = true
+				break
+			}
+		}
+		if !denied {
+			allow[perm] = struct{}{}
+		}
+	}
+	for d := range deny {
+		overlaps := false
+		for perm := range allow {
+			if subjectsOverlap(perm.Subject, d.Subject) {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			delete(deny, d)
+		}
+	}
+	ps.allow = allow
+	ps.deny = deny
 }
 
 // IsEmpty returns true if the permission set has no allowed subjects.
@@ -84,9 +137,16 @@ func (ps *PermissionSet) IsEmpty() bool {
 }
 
 func (ps *PermissionSet) String() string {
-	allowList := ps.AllowList()
-	strs := make([]string, len(allowList))
-	for i, perm := range allowList {
+	str := joinPermissions(ps.AllowList())
+	if len(ps.deny) > 0 {
+		str += " (deny: " + joinPermissions(ps.DenyList()) + ")"
+	}
+	return str
+}
+
+func joinPermissions(perms []Permission) string {
+	strs := make([]string, len(perms))
+	for i, perm := range perms {
 		strs[i] = perm.String()
 	}
 	return strings.Join(strs, ", ")
@@ -94,14 +154,16 @@ func (ps *PermissionSet) String() string {
 
 type permissionSetJSON struct {
 	Allow []Permission `json:"allow"`
+	Deny  []Permission `json:"deny,omitempty"`
 }
 
-// MarshalJSON encodes the permission set as a JSON object with an allow list.
+// MarshalJSON encodes the permission set as a JSON object with an allow list
+// and, if subjects are denied, a deny list.
 func (ps *PermissionSet) MarshalJSON() ([]byte, error) {
 	if ps == nil {
 		return json.Marshal(permissionSetJSON{Allow: []Permission{}})
 	}
-	return json.Marshal(permissionSetJSON{Allow: ps.AllowList()})
+	return json.Marshal(permissionSetJSON{Allow: ps.AllowList(), Deny: ps.DenyList()})
 }
 
 // NatsPermissions holds compiled NATS permissions.
@@ -109,6 +171,10 @@ type NatsPermissions struct {
 	Pub            *PermissionSet `json:"pub"`
 	Sub            *PermissionSet `json:"sub"`
 	AllowResponses bool           `json:"AllowResponses"` // If true, sets Resp permissions
+	// ResponseMaxMsgs and ResponseExpires limit the responses if
+	// AllowResponses is set; zero keeps the NATS defaults.
+	ResponseMaxMsgs int           `json:"ResponseMaxMsgs,omitempty"`
+	ResponseExpires time.Duration `json:"ResponseExpires,omitempty"`
 }
 
 // NewNatsPermissions creates an empty NatsPermissions struct.
@@ -126,17 +192,7 @@ func (p *NatsPermissions) Clone() *NatsPermissions {
 		return nil
 	}
 	clone := NewNatsPermissions()
-	clone.AllowResponses = p.AllowResponses
-	if p.Pub != nil {
-		for perm := range p.Pub.allow {
-			clone.Pub.Add(perm)
-		}
-	}
-	if p.Sub != nil {
-		for perm := range p.Sub.allow {
-			clone.Sub.Add(perm)
-		}
-	}
+	clone.Merge(p)
 	return clone
 }
 
@@ -148,7 +204,52 @@ func (p *NatsPermissions) Allow(perm Permission) {
 	case PermSub:
 		p.Sub.Add(perm)
 	case PermResp:
+		p.allowResponses(perm.MaxMsgs, perm.Expires)
+	}
+}
+
+// allowResponses allows responses with the given limits. If responses are
+// already allowed, the more permissive of each limit is kept, like the union
+// of subjects.
+func (p *NatsPermissions) allowResponses(maxMsgs int, expires time.Duration) {
+	if !p.AllowResponses {
 		p.AllowResponses = true
+		p.ResponseMaxMsgs = maxMsgs
+		p.ResponseExpires = expires
+		return
+	}
+	if p.ResponseMaxMsgs != -1 && (maxMsgs == -1 || effectiveMaxMsgs(maxMsgs) > effectiveMaxMsgs(p.ResponseMaxMsgs)) {
+		p.ResponseMaxMsgs = maxMsgs
+	}
+	if effectiveExpires(expires) > effectiveExpires(p.ResponseExpires) {
+		p.ResponseExpires = expires
+	}
+}
+
+// effectiveMaxMsgs and effectiveExpires apply the NATS defaults for zero
+// response limits.
+func effectiveMaxMsgs(n int) int {
+	if n == 0 {
+		return 1
+	}
+	return n
+}
+
+func effectiveExpires(d time.Duration) time.Duration {
+	if d == 0 {
+		return 2 * time.Minute
+	}
+	return d
+}
+
+// Deny adds a permission to the appropriate deny set. Response permissions
+// cannot be scoped to subjects and are ignored.
+func (p *NatsPermissions) Deny(perm Permission) {
+	switch perm.Type {
+	case PermPub:
+		p.Pub.AddDeny(perm)
+	case PermSub:
+		p.Sub.AddDeny(perm)
 	}
 }
 
@@ -162,18 +263,25 @@ func (p *NatsPermissions) Merge(other *NatsPermissions) {
 		for s := range other.Pub.allow {
 			p.Pub.Add(s)
 		}
+		for s := range other.Pub.deny {
+			p.Pub.AddDeny(s)
+		}
 	}
 	if other.Sub != nil {
 		for s := range other.Sub.allow {
 			p.Sub.Add(s)
 		}
+		for s := range other.Sub.deny {
+			p.Sub.AddDeny(s)
+		}
 	}
 	if other.AllowResponses {
-		p.AllowResponses = true
+		p.allowResponses(other.ResponseMaxMsgs, other.ResponseExpires)
 	}
 }
 
-// Deduplicate removes duplicate permissions using wildcard-aware deduplication.
+// Deduplicate removes duplicate permissions using wildcard-aware deduplication
+// and applies deny permissions to the allowed subjects.
 func (p *NatsPermissions) Deduplicate() {
 	p.Pub.Deduplicate()
 	p.Sub.Deduplicate()
@@ -194,9 +302,21 @@ func (p *NatsPermissions) SubList() []Permission {
 	return p.Sub.AllowList()
 }
 
+// PubDenyList returns the list of denied publish subjects.
+func (p *NatsPermissions) PubDenyList() []Permission {
+	return p.Pub.DenyList()
+}
+
+// SubDenyList returns the list of denied subscribe subjects.
+func (p *NatsPermissions) SubDenyList() []Permission {
+	return p.Sub.DenyList()
+}
+
 // ToNatsJWT converts policy.NatsPermissions to natsjwt.Permissions.
 // When no permissions are granted, we explicitly deny all to prevent
 // NATS default behavior of allowing everything when permissions are unset.
+// Denied subjects are only emitted alongside an allow list, where NATS
+// applies them as exceptions (e.g., allow "orders.>" but deny "orders.internal.>").
 // Note: NATS JWTs do not support queue group restrictions.
 // Subscriptions allowed with a queue group will be allowed as regular subscriptions.
 func (p *NatsPermissions) ToNatsJWT() natsjwt.Permissions {
@@ -210,6 +330,7 @@ func (p *NatsPermissions) ToNatsJWT() natsjwt.Permissions {
 		}
 		sort.Strings(strList)
 		natsPerms.Pub.Allow = strList
+		natsPerms.Pub.Deny = permissionStrings(p.PubDenyList())
 	} else {
 		// No publish permissions means deny all
 		natsPerms.Pub.Deny = []string{">"}
@@ -225,19 +346,37 @@ func (p *NatsPermissions) ToNatsJWT() natsjwt.Permissions {
 
 		sort.Strings(strList)
 		natsPerms.Sub.Allow = strList
+		natsPerms.Sub.Deny = permissionStrings(p.SubDenyList())
 	} else {
 		// No subscribe permissions means deny all
 		natsPerms.Sub.Deny = []string{">"}
 	}
 
 	if p.AllowResponses {
-		// Set empty response permission to allow responses (MaxMsgs and Expires default to 0/nil which means unlimited/default)
-		natsPerms.Resp = &natsjwt.ResponsePermission{}
+		// Zero MaxMsgs and Expires make the server apply its defaults
+		// (one response within two minutes).
+		natsPerms.Resp = &natsjwt.ResponsePermission{
+			MaxMsgs: p.ResponseMaxMsgs,
+			Expires: p.ResponseExpires,
+		}
 	}
 
 	return natsPerms
 }
 
+// permissionStrings returns the sorted subjects of perms, or nil if perms is empty.
+func permissionStrings(perms []Permission) []string {
+	if len(perms) == 0 {
+		return nil
+	}
+	strList := make([]string, 0, len(perms))
+	for _, perm := range perms {
+		strList = append(strList, perm.String())
+	}
+	sort.Strings(strList)
+	return strList
+}
+
 // deduplicateWithWildcards removes subjects that are covered by wildcard patterns.
 // NATS wildcard rules:
 //   - `*` matches a single token
@@ -275,17 +414,24 @@ func deduplicateWithWildcards(permissions map[Permission]struct{}) map[Permissio
 	return result
 }
 
+// Matches reports whether the permission's subject covers subject, which may
+// contain wildcards. Queue groups are ignored.
+func (p Permission) Matches(subject string) bool {
+	return subjectCoveredBy(subject, p.Subject)
+}
+
 // isCoveredBy returns true if subject is covered by pattern.
-// This handles both concrete subjects and wildcard patterns, considering queues.
-// TODO: this does not handle wildcards in queue names
+// This handles both concrete subjects and wildcard patterns, considering
+// queues: queue names are matched like subjects, so "orders workers.*"
+// covers "orders workers.eu".
 func isCoveredBy(subject, pattern Permission) bool {
 	// If only subject has queue but not pattern, return match result ignoring queue.
 	// This covers the case where a general subscription (no queue) covers a queue subscription.
 	if subject.Queue != "" && pattern.Queue == "" {
 		// Proceed to check subject match
 	} else if subject.Queue != "" && pattern.Queue != "" {
-		// If both have queues, they must match
-		if subject.Queue != pattern.Queue {
+		// If both have queues, the pattern's queue must cover the subject's
+		if !subjectCoveredBy(subject.Queue, pattern.Queue) {
 			return false
 		}
 	} else if subject.Queue == "" && pattern.Queue != "" {
@@ -293,13 +439,18 @@ func isCoveredBy(subject, pattern Permission) bool {
 		return false
 	}
 
-	// Standard subject check
-	if subject.Subject == pattern.Subject {
+	return subjectCoveredBy(subject.Subject, pattern.Subject)
+}
+
+// subjectCoveredBy returns true if subject, which may contain wildcards, is
+// covered by pattern.
+func subjectCoveredBy(subject, pattern string) bool {
+	if subject == pattern {
 		return true
 	}
 
-	subjectTokens := strings.Split(subject.Subject, ".")
-	patternTokens := strings.Split(pattern.Subject, ".")
+	subjectTokens := strings.Split(subject, ".")
+	patternTokens := strings.Split(pattern, ".")
 
 	// Special case: if subject ends with ">" (multi-token wildcard),
 	// it can only be covered by a pattern that also ends with ">"
@@ -390,6 +541,21 @@ func matchTokens(subject, pattern []string) bool {
 	return si == len(subject)
 }
 
+// subjectsOverlap returns true if some concrete subject matches both a and b.
+func subjectsOverlap(a, b string) bool {
+	at := strings.Split(a, ".")
+	bt := strings.Split(b, ".")
+	for i := 0; i < len(at) && i < len(bt); i++ {
+		if at[i] == ">" || bt[i] == ">" {
+			return true
+		}
+		if at[i] != "*" && bt[i] != "*" && at[i] != bt[i] {
+			return false
+		}
+	}
+	return len(at) == len(bt)
+}
+
 func (p *NatsPermissions) String() string {
 	pub := p.Pub.String()
 	sub := p.Sub.String()
@@ -4,6 +4,7 @@ import (
 	"reflect"
 	"sort"
 	"testing"
+	"time"
 )
 
 func TestIsCoveredBy(t *testing.T) {
@@ -50,6 +51,11 @@ func TestIsCoveredBy(t *testing.T) {
 		{"both queue - match", Permission{Subject: "foo", Queue: "q1"}, Permission{Subject: "foo", Queue: "q1"}, true},
 		{"both queue - diff queue", Permission{Subject: "foo", Queue: "q1"}, Permission{Subject: "foo", Queue: "q2"}, false},
 		{"both queue - same queue subject mismatch", Permission{Subject: "foo", Queue: "q1"}, Permission{Subject: "bar", Queue: "q1"}, false},
+		{"both queue - wildcard queue", Permission{Subject: "orders", Queue: "workers.eu"}, Permission{Subject: "orders", Queue: "workers.*"}, true},
+		{"both queue - full wildcard queue", Permission{Subject: "orders.new", Queue: "workers.eu.a"}, Permission{Subject: "orders.>", Queue: "workers.>"}, true},
+		{"both queue - wildcard queue covered", Permission{Subject: "orders", Queue: "workers.*"}, Permission{Subject: "orders", Queue: "workers.>"}, true},
+		{"both queue - wildcard queue mismatch", Permission{Subject: "orders", Queue: "billing.eu"}, Permission{Subject: "orders", Queue: "workers.*"}, false},
+		{"both queue - wildcard queue does not cover broader", Permission{Subject: "orders", Queue: "workers.>"}, Permission{Subject: "orders", Queue: "workers.*"}, false},
 
 		// - if only pattern has a queue, return false.
 		{"pattern queue only - subject match", Permission{Subject: "foo"}, Permission{Subject: "foo", Queue: "q1"}, false},
@@ -101,6 +107,11 @@ func TestDeduplicateWithWildcards(t *testing.T) {
 			input:  []Permission{{Subject: "foo", Queue: "q1"}, {Subject: "foo", Queue: "q2"}}, // distinct queues
 			expect: []Permission{{Subject: "foo", Queue: "q1"}, {Subject: "foo", Queue: "q2"}},
 		},
+		{
+			name:   "queue logic wildcard queue",
+			input:  []Permission{{Subject: "orders", Queue: "workers.eu"}, {Subject: "orders", Queue: "workers.*"}, {Subject: "orders", Queue: "billing"}},
+			expect: []Permission{{Subject: "orders", Queue: "billing"}, {Subject: "orders", Queue: "workers.*"}},
+		},
 		{
 			name:   "queue logic pattern queue",
 			input:  []Permission{{Subject: "foo"}, {Subject: "foo", Queue: "q1"}}, // foo covers foo q1
@@ -207,6 +218,27 @@ func TestNatsPermissions_Merge(t *testing.T) {
 	}
 }
 
+func TestNatsPermissions_ResponseLimits(t *testing.T) {
+	p := NewNatsPermissions()
+	p.Allow(Permission{Type: PermResp, MaxMsgs: 5, Expires: 10 * time.Second})
+	clone := p.Clone()
+	if clone.ResponseMaxMsgs != 5 || clone.ResponseExpires != 10*time.Second {
+		t.Errorf("Clone() limits = %d, %v", clone.ResponseMaxMsgs, clone.ResponseExpires)
+	}
+
+	p.Allow(Permission{Type: PermResp, MaxMsgs: -1})
+	if p.ResponseMaxMsgs != -1 || p.ResponseExpires != 0 {
+		t.Errorf("limits = %d, %v, want unlimited responses within the default expiry", p.ResponseMaxMsgs, p.ResponseExpires)
+	}
+
+	other := NewNatsPermissions()
+	other.Allow(Permission{Type: PermResp, MaxMsgs: 2, Expires: time.Hour})
+	p.Merge(other)
+	if p.ResponseMaxMsgs != -1 || p.ResponseExpires != time.Hour {
+		t.Errorf("Merge() limits = %d, %v, want -1, 1h", p.ResponseMaxMsgs, p.ResponseExpires)
+	}
+}
+
 func TestNatsPermissions_DeduplicateWithWildcards(t *testing.T) {
 	p := NewNatsPermissions()
 
@@ -312,6 +344,21 @@ func TestToNatsJWT(t *testing.T) {
 			wantSubAllow: []string{"bar q2", "foo"},
 			wantSubDeny:  nil,
 		},
+		{
+			name: "deny is emitted as an exception to the allow list",
+			perms: func() *NatsPermissions {
+				p := NewNatsPermissions()
+				p.Allow(Permission{Type: PermSub, Subject: "orders.>"})
+				p.Deny(Permission{Type: PermSub, Subject: "orders.internal.>"})
+				p.Deny(Permission{Type: PermSub, Subject: "orders.internal.audit"})
+				p.Deny(Permission{Type: PermPub, Subject: "orders.>"})
+				return p
+			}(),
+			wantPubAllow: nil,
+			wantPubDeny:  []string{">"},
+			wantSubAllow: []string{"orders.>"},
+			wantSubDeny:  []string{"orders.internal.>"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -349,3 +396,46 @@ func stringSliceEqual(a, b []string) bool {
 	}
 	return true
 }
+
+func TestPermissionSet_DeduplicateDeny(t *testing.T) {
+	ps := NewPermissionSet()
+	for _, subject := range []string{"orders.>", "orders.internal.audit", "orders.*.created", "metrics"} {
+		ps.Add(Permission{Type: PermSub, Subject: subject})
+	}
+	ps.Add(Permission{Type: PermSub, Subject: "jobs", Queue: "workers"})
+	for _, subject := range []string{"orders.internal.>", "orders.*", "metrics.>", "jobs"} {
+		ps.AddDeny(Permission{Type: PermSub, Subject: subject})
+	}
+
+	ps.Deduplicate()
+
+	wantAllow := []Permission{{Type: PermSub, Subject: "metrics"}, {Type: PermSub, Subject: "orders.>"}}
+	if got := ps.AllowList(); !reflect.DeepEqual(got, wantAllow) {
+		t.Errorf("AllowList() = %v, want %v", got, wantAllow)
+	}
+	// metrics.> does not match metrics itself and is dropped.
+	wantDeny := []Permission{{Type: PermSub, Subject: "orders.*"}, {Type: PermSub, Subject: "orders.internal.>"}}
+	if got := ps.DenyList(); !reflect.DeepEqual(got, wantDeny) {
+		t.Errorf("DenyList() = %v, want %v", got, wantDeny)
+	}
+}
+
+func TestSubjectsOverlap(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"orders.>", "orders.internal.>", true},
+		{"orders.*", "orders.internal.>", false},
+		{"orders.*", "orders.internal.audit", false},
+		{"orders.*.created", "orders.internal.*", true},
+		{"metrics", "metrics.>", false},
+		{"a.b", "a.c", false},
+		{">", "x", true},
+	}
+	for _, tt := range tests {
+		if got := subjectsOverlap(tt.a, tt.b); got != tt.want {
+			t.Errorf("subjectsOverlap(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -1,6 +1,12 @@
 package policy
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/msimon/nauts/units"
+)
 
 // Effect represents the effect of a policy statement.
 type Effect string
@@ -8,28 +14,43 @@ type Effect string
 const (
 	// EffectAllow grants the specified permissions.
 	EffectAllow Effect = "allow"
-	// EffectDeny explicitly denies the specified permissions (not implemented).
-	// EffectDeny Effect = "deny"
+	// EffectDeny denies the specified permissions, overriding any allow.
+	EffectDeny Effect = "deny"
 )
 
 // Statement represents a permission statement within a policy.
 type Statement struct {
-	Effect    Effect   `json:"effect"`    // allow or deny
-	Actions   []Action `json:"actions"`   // list of actions to allow/deny
-	Resources []string `json:"resources"` // list of NRN patterns
+	Effect     Effect          `json:"effect"`               // allow or deny
+	Actions    []Action        `json:"actions"`              // list of actions to allow/deny
+	Resources  []string        `json:"resources"`            // list of NRN patterns
+	JSDomain   string          `json:"jsDomain,omitempty"`   // optional JetStream domain: scopes js.*, kv.* and obj.* API subjects to $JS.<domain>.API
+	Conditions Conditions      `json:"conditions,omitempty"` // optional conditions: the statement only applies if all hold
+	Response   *ResponseLimits `json:"response,omitempty"`   // optional limits for the responses allowed by nats.service
+}
+
+// ResponseLimits bound the responses a service granted nats.service may send
+// to each request it receives. Zero values keep the NATS defaults of one
+// response within two minutes.
+type ResponseLimits struct {
+	MaxMsgs int    `json:"maxMsgs,omitempty"` // responses per request; -1 for unlimited
+	Expires string `json:"expires,omitempty"` // time to respond after the request (e.g., "30s")
 }
 
 // Policy represents a collection of permission statements.
 type Policy struct {
-	ID         string      `json:"id"`         // unique identifier
-	Account    string      `json:"account"`    // NATS account ID this policy applies to (or "*" for global)
-	Name       string      `json:"name"`       // human-readable name
-	Statements []Statement `json:"statements"` // list of permission statements
+	ID         string      `json:"id"`               // unique identifier
+	Account    string      `json:"account"`          // NATS account ID this policy applies to (or "*" for global)
+	Name       string      `json:"name"`             // human-readable name
+	Statements []Statement `json:"statements"`       // list of permission statements
+	MaxTTL     string      `json:"maxTTL,omitempty"` // optional maximum session TTL for users granted this policy (e.g., "15m")
+	Limits     *UserLimits `json:"limits,omitempty"` // optional connection limits for users granted this policy
+	Team       string      `json:"team,omitempty"`   // optional owning team, checked against the subject ownership registry
+	Inbox      string      `json:"inbox,omitempty"`  // optional inbox of users granted this policy (e.g., "_INBOX.{{ user.id }}.>"), or "none"
 }
 
 // IsValid checks if the effect is a valid effect type.
 func (e Effect) IsValid() bool {
-	return e == EffectAllow
+	return e == EffectAllow || e == EffectDeny
 }
 
 // Validate validates a policy for correctness.
@@ -37,12 +58,28 @@ func (p *Policy) Validate() error {
 	if p.ID == "" {
 		return &ValidationError{Field: "id", Message: "policy ID is required"}
 	}
+	if IsBuiltinID(p.ID) {
+		return &ValidationError{Field: "id", Message: "the " + BuiltinPrefix + " prefix is reserved for built-in policies"}
+	}
 	if strings.TrimSpace(p.Account) == "" {
 		return &ValidationError{Field: "account", Message: "policy account is required"}
 	}
 	if len(p.Statements) == 0 {
 		return &ValidationError{Field: "statements", Message: "policy must have at least one statement"}
 	}
+	if _, err := ParseMaxTTL(p.MaxTTL); err != nil {
+		return &ValidationError{Field: "maxTTL", Message: err.Error()}
+	}
+	if p.Inbox != "" {
+		if err := ValidateInboxTemplate(p.Inbox); err != nil {
+			return &ValidationError{Field: "inbox", Message: err.Error()}
+		}
+	}
+	if p.Limits != nil {
+		if err := p.Limits.Validate(); err != nil {
+			return &ValidationError{Field: "limits", Message: err.Error()}
+		}
+	}
 	for i, stmt := range p.Statements {
 		if err := stmt.Validate(); err != nil {
 			return &ValidationError{Field: "statements", Index: i, Message: err.Error()}
@@ -51,6 +88,80 @@ func (p *Policy) Validate() error {
 	return nil
 }
 
+// GetMaxTTL returns the policy's maximum session TTL, or 0 if none is set.
+func (p *Policy) GetMaxTTL() time.Duration {
+	d, err := ParseMaxTTL(p.MaxTTL)
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+// UsesUserContext reports whether compiling the policy depends on the user
+// or its connection: a resource or jsDomain references a user.* or client.*
+// variable, or a condition tests a user.* or client.* key. Other policies
+// compile to the same permissions for every user of an account and role.
+func (p *Policy) UsesUserContext() bool {
+	for _, stmt := range p.Statements {
+		for _, res := range stmt.Resources {
+			if referencesUserContext(res) {
+				return true
+			}
+		}
+		if referencesUserContext(stmt.JSDomain) {
+			return true
+		}
+		for _, keys := range stmt.Conditions {
+			for key := range keys {
+				if isUserContextVariable(key) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// referencesUserContext reports whether template contains a user.* or
+// client.* variable.
+func referencesUserContext(template string) bool {
+	for _, m := range variablePattern.FindAllStringSubmatch(template, -1) {
+		if isUserContextVariable(m[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUserContextVariable reports whether name is a user.* or client.* key.
+func isUserContextVariable(name string) bool {
+	return strings.HasPrefix(name, "user.") || strings.HasPrefix(name, "client.")
+}
+
+// ParseMaxTTL parses a maximum TTL duration string (e.g., "15m" or "1d").
+// An empty string means no limit and returns 0. The duration must be positive.
+func ParseMaxTTL(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := units.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("duration must be positive: %q", s)
+	}
+	return d, nil
+}
+
+// MinTTL returns the smaller of two TTLs, treating 0 as "no limit".
+func MinTTL(a, b time.Duration) time.Duration {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
 // Validate validates a statement for correctness.
 func (s *Statement) Validate() error {
 	if !s.Effect.IsValid() {
@@ -67,5 +178,57 @@ func (s *Statement) Validate() error {
 	if len(s.Resources) == 0 {
 		return &ValidationError{Field: "resources", Message: "statement must have at least one resource"}
 	}
+	if s.JSDomain != "" {
+		if err := ValidateJSDomainTemplate(s.JSDomain); err != nil {
+			return &ValidationError{Field: "jsDomain", Message: err.Error()}
+		}
+	}
+	if err := s.Conditions.Validate(); err != nil {
+		return &ValidationError{Field: "conditions", Message: err.Error()}
+	}
+	if s.Response != nil {
+		if err := s.validateResponse(); err != nil {
+			return &ValidationError{Field: "response", Message: err.Error()}
+		}
+	}
 	return nil
 }
+
+// validateResponse checks that response limits are valid and that the
+// statement allows nats.service, the only action they apply to.
+func (s *Statement) validateResponse() error {
+	if s.Effect != EffectAllow {
+		return fmt.Errorf("response limits only apply to allow statements")
+	}
+	hasService := false
+	for _, action := range ResolveActions(s.Actions) {
+		if action == ActionNATSService {
+			hasService = true
+			break
+		}
+	}
+	if !hasService {
+		return fmt.Errorf("response limits require the %s action", ActionNATSService)
+	}
+	_, err := s.Response.parse()
+	return err
+}
+
+// parse returns the limits as a response permission.
+func (r *ResponseLimits) parse() (Permission, error) {
+	perm := Permission{Type: PermResp, MaxMsgs: r.MaxMsgs}
+	if r.MaxMsgs < -1 {
+		return perm, fmt.Errorf("maxMsgs must be -1 (unlimited) or more: %d", r.MaxMsgs)
+	}
+	if r.Expires != "" {
+		d, err := units.ParseDuration(r.Expires)
+		if err != nil {
+			return perm, fmt.Errorf("invalid expires: %w", err)
+		}
+		if d <= 0 {
+			return perm, fmt.Errorf("expires must be positive: %q", r.Expires)
+		}
+		perm.Expires = d
+	}
+	return perm, nil
+}
@@ -2,6 +2,7 @@ package policy
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 )
 
@@ -27,6 +28,46 @@ func TestPolicy_Validate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "valid maxTTL",
+			policy: Policy{
+				ID:         "test-policy",
+				Account:    "APP",
+				MaxTTL:     "15m",
+				Statements: []Statement{{Effect: EffectAllow, Actions: []Action{ActionNATSPub}, Resources: []string{"nats:orders"}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid maxTTL",
+			policy: Policy{
+				ID:         "test-policy",
+				Account:    "APP",
+				MaxTTL:     "soon",
+				Statements: []Statement{{Effect: EffectAllow, Actions: []Action{ActionNATSPub}, Resources: []string{"nats:orders"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "non-positive maxTTL",
+			policy: Policy{
+				ID:         "test-policy",
+				Account:    "APP",
+				MaxTTL:     "0s",
+				Statements: []Statement{{Effect: EffectAllow, Actions: []Action{ActionNATSPub}, Resources: []string{"nats:orders"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative limit",
+			policy: Policy{
+				ID:         "test-policy",
+				Account:    "APP",
+				Limits:     &UserLimits{MaxPayload: -1},
+				Statements: []Statement{{Effect: EffectAllow, Actions: []Action{ActionNATSPub}, Resources: []string{"nats:orders"}}},
+			},
+			wantErr: true,
+		},
 		{
 			name: "missing account",
 			policy: Policy{
@@ -42,6 +83,22 @@ func TestPolicy_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "reserved builtin ID",
+			policy: Policy{
+				ID:      "builtin:kv-reader:config",
+				Account: "APP",
+				Name:    "Test Policy",
+				Statements: []Statement{
+					{
+						Effect:    EffectAllow,
+						Actions:   []Action{ActionKVRead},
+						Resources: []string{"kv:config"},
+					},
+				},
+			},
+			wantErr: true,
+		},
 		{
 			name: "missing ID",
 			policy: Policy{
@@ -75,7 +132,7 @@ func TestPolicy_Validate(t *testing.T) {
 				Name:    "Test Policy",
 				Statements: []Statement{
 					{
-						Effect:    Effect("deny"),
+						Effect:    Effect("block"),
 						Actions:   []Action{ActionNATSPub},
 						Resources: []string{"nats:orders"},
 					},
@@ -115,6 +172,42 @@ func TestPolicy_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "valid response limits",
+			policy: Policy{
+				ID:         "test-policy",
+				Account:    "APP",
+				Statements: []Statement{{Effect: EffectAllow, Actions: []Action{ActionGroupNATSAll}, Resources: []string{"nats:svc"}, Response: &ResponseLimits{MaxMsgs: -1, Expires: "30s"}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "response limits without nats.service",
+			policy: Policy{
+				ID:         "test-policy",
+				Account:    "APP",
+				Statements: []Statement{{Effect: EffectAllow, Actions: []Action{ActionNATSSub}, Resources: []string{"nats:svc"}, Response: &ResponseLimits{MaxMsgs: 5}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "response limits on deny statement",
+			policy: Policy{
+				ID:         "test-policy",
+				Account:    "APP",
+				Statements: []Statement{{Effect: EffectDeny, Actions: []Action{ActionNATSService}, Resources: []string{"nats:svc"}, Response: &ResponseLimits{MaxMsgs: 5}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid response limits",
+			policy: Policy{
+				ID:         "test-policy",
+				Account:    "APP",
+				Statements: []Statement{{Effect: EffectAllow, Actions: []Action{ActionNATSService}, Resources: []string{"nats:svc"}, Response: &ResponseLimits{MaxMsgs: -2, Expires: "-1s"}}},
+			},
+			wantErr: true,
+		},
 		{
 			name: "missing resources",
 			policy: Policy{
@@ -149,7 +242,8 @@ func TestEffect_IsValid(t *testing.T) {
 		want   bool
 	}{
 		{EffectAllow, true},
-		{Effect("deny"), false},
+		{EffectDeny, true},
+		{Effect("block"), false},
 		{Effect(""), false},
 		{Effect("allow"), true},
 		{Effect("ALLOW"), false},
@@ -207,3 +301,46 @@ func TestPolicy_JSON(t *testing.T) {
 		t.Errorf("Actions length mismatch: got %d, want 2", len(parsed.Statements[0].Actions))
 	}
 }
+
+func TestUserLimits_UnmarshalJSON(t *testing.T) {
+	var l UserLimits
+	if err := json.Unmarshal([]byte(`{"maxPayload": "1MiB", "maxSubscriptions": 10, "maxData": 5000}`), &l); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	want := UserLimits{MaxPayload: 1 << 20, MaxSubscriptions: 10, MaxData: 5000}
+	if l != want {
+		t.Errorf("limits = %+v, want %+v", l, want)
+	}
+
+	err := json.Unmarshal([]byte(`{"maxData": "1PB"}`), &l)
+	if err == nil || !strings.Contains(err.Error(), "limits.maxData") {
+		t.Errorf("Unmarshal() error = %v, want error naming limits.maxData", err)
+	}
+}
+
+func TestPolicy_UsesUserContext(t *testing.T) {
+	tests := []struct {
+		name string
+		stmt Statement
+		want bool
+	}{
+		{name: "literal", stmt: Statement{Resources: []string{"nats:orders.>"}}},
+		{name: "account and role", stmt: Statement{Resources: []string{"nats:{{ account.id }}.{{ role.id }}.>"}}},
+		{name: "user id", stmt: Statement{Resources: []string{"nats:users.{{ user.id }}.>"}}, want: true},
+		{name: "user attribute", stmt: Statement{Resources: []string{"nats:{{user.attr.team}}.>"}}, want: true},
+		{name: "jsDomain", stmt: Statement{JSDomain: "{{ user.attr.region }}"}, want: true},
+		{name: "role condition", stmt: Statement{Conditions: Conditions{CondStringEquals: {"role.id": {"admin"}}}}},
+		{name: "user condition", stmt: Statement{Conditions: Conditions{CondStringLike: {"user.attr.team": {"eng*"}}}}, want: true},
+		{name: "client ip condition", stmt: Statement{Conditions: Conditions{CondIPAddress: {ClientIPKey: {"10.0.0.0/8"}}}}, want: true},
+		{name: "client variable", stmt: Statement{Resources: []string{"nats:apps.{{ client.name }}.>"}}, want: true},
+		{name: "client condition", stmt: Statement{Conditions: Conditions{CondStringEquals: {"client.lang": {"go"}}}}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Policy{Statements: []Statement{tt.stmt}}
+			if got := p.UsesUserContext(); got != tt.want {
+				t.Errorf("UsesUserContext() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -7,7 +7,7 @@ import (
 )
 
 // ResourceType represents the type of a NATS resource.
-// Basic types are "nats", "js", "kv". Full types include subidentifier variants.
+// Basic types are "nats", "js", "kv", "obj". Full types include subidentifier variants.
 type ResourceType string
 
 // Basic resource types (without subidentifier)
@@ -15,6 +15,7 @@ const (
 	ResourceTypeNATS ResourceType = "nats"
 	ResourceTypeJS   ResourceType = "js"
 	ResourceTypeKV   ResourceType = "kv"
+	ResourceTypeObj  ResourceType = "obj"
 )
 
 // Full resource types (including subidentifier variants)
@@ -30,12 +31,16 @@ const (
 	// KV resources
 	ResourceTypeKVBucket      ResourceType = "kv:bucket"       // kv:<bucket>
 	ResourceTypeKVBucketEntry ResourceType = "kv:bucket:entry" // kv:<bucket>:<key>
+
+	// Object store resources
+	ResourceTypeObjBucket       ResourceType = "obj:bucket"        // obj:<bucket>
+	ResourceTypeObjBucketObject ResourceType = "obj:bucket:object" // obj:<bucket>:<object>
 )
 
-// IsValid checks if the type is a valid resource type (nats, js, kv).
+// IsValid checks if the type is a valid resource type (nats, js, kv, obj).
 func (t ResourceType) IsValid() bool {
 	switch t {
-	case ResourceTypeNATS, ResourceTypeJS, ResourceTypeKV:
+	case ResourceTypeNATS, ResourceTypeJS, ResourceTypeKV, ResourceTypeObj:
 		return true
 	default:
 		return false
@@ -44,9 +49,9 @@ func (t ResourceType) IsValid() bool {
 
 // Resource represents a parsed NATS Resource Name.
 type Resource struct {
-	Type          ResourceType // The basic resource type (nats, js, kv)
+	Type          ResourceType // The basic resource type (nats, js, kv, obj)
 	Identifier    string       // Primary identifier (subject, stream, bucket)
-	SubIdentifier string       // Optional sub-identifier (queue, consumer, key)
+	SubIdentifier string       // Optional sub-identifier (queue, consumer, key, object)
 	Raw           string       // Original raw resource string
 }
 
@@ -82,6 +87,11 @@ func (n *Resource) FullType() ResourceType {
 			return ResourceTypeKVBucketEntry
 		}
 		return ResourceTypeKVBucket
+	case ResourceTypeObj:
+		if n.SubIdentifier != "" {
+			return ResourceTypeObjBucketObject
+		}
+		return ResourceTypeObjBucket
 	default:
 		return n.Type
 	}
@@ -102,6 +112,11 @@ func (n *Resource) IsBucket() bool {
 	return n.Type == ResourceTypeKV
 }
 
+// IsObjectStore returns true if this is an object store bucket resource.
+func (n *Resource) IsObjectStore() bool {
+	return n.Type == ResourceTypeObj
+}
+
 // ParseResource parses a string into an NRN.
 // It validates the format but does not validate wildcards.
 // Use ParseAndValidateResource for full validation.
@@ -174,6 +189,7 @@ func MustParseResource(s string) *Resource {
 //   - nats: * and > allowed in subject; * only in queue
 //   - js: * only in stream and consumer; no >
 //   - kv: * in bucket and key; > only in key
+//   - obj: * in bucket; object is a literal name, or * or > for all objects
 func ValidateResource(n *Resource) error {
 	switch n.Type {
 	case ResourceTypeNATS:
@@ -182,6 +198,8 @@ func ValidateResource(n *Resource) error {
 		return validateJSResource(n)
 	case ResourceTypeKV:
 		return validateKVResource(n)
+	case ResourceTypeObj:
+		return validateObjResource(n)
 	default:
 		return NewResourceError(n.Raw, "unknown type", ErrUnknownResourceType)
 	}
@@ -247,6 +265,24 @@ func validateKVResource(n *Resource) error {
 	return nil
 }
 
+// validateObjResource validates object store bucket/object NRNs.
+// Rules:
+//   - Bucket: only * wildcard allowed (no >)
+//   - Object: a literal name, or * or > for all objects. Object names are
+//     base64 encoded in subjects, so partial wildcards cannot be matched.
+func validateObjResource(n *Resource) error {
+	// Bucket can only have *
+	if err := validateWildcards(n.Identifier, true, false); err != nil {
+		return NewResourceError(n.Raw, "invalid bucket: "+err.Error(), ErrInvalidWildcard)
+	}
+
+	if obj := n.SubIdentifier; obj != "" && obj != "*" && obj != ">" && !ContainsVariables(obj) && strings.ContainsAny(obj, "*>") {
+		return NewResourceError(n.Raw, "invalid object: wildcards must be the entire object name", ErrInvalidWildcard)
+	}
+
+	return nil
+}
+
 // validateWildcards checks if a value contains valid wildcards.
 func validateWildcards(value string, allowStar, allowGT bool) error {
 	// Skip validation for template variables - they will be validated after interpolation
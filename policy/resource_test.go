@@ -92,6 +92,28 @@ func TestParseResource(t *testing.T) {
 			wantSubID:        "app.>",
 		},
 
+		// Valid Obj NRNs
+		{
+			name:             "obj bucket only",
+			input:            "obj:files",
+			wantResourceType: ResourceTypeObj,
+			wantID:           "files",
+		},
+		{
+			name:             "obj bucket with object",
+			input:            "obj:files:report.pdf",
+			wantResourceType: ResourceTypeObj,
+			wantID:           "files",
+			wantSubID:        "report.pdf",
+		},
+		{
+			name:             "obj star bucket and object",
+			input:            "obj:*:*",
+			wantResourceType: ResourceTypeObj,
+			wantID:           "*",
+			wantSubID:        "*",
+		},
+
 		// Template variables
 		{
 			name:             "nats with template variable",
@@ -107,6 +129,14 @@ func TestParseResource(t *testing.T) {
 			wantSubID:        "{{ user.id }}.settings",
 		},
 
+		{
+			name:             "obj with template in object",
+			input:            "obj:uploads:{{ user.id }}.png",
+			wantResourceType: ResourceTypeObj,
+			wantID:           "uploads",
+			wantSubID:        "{{ user.id }}.png",
+		},
+
 		// Invalid NRNs
 		{
 			name:            "empty string",
@@ -250,6 +280,7 @@ func TestResourceType_IsValid(t *testing.T) {
 		{ResourceTypeNATS, true},
 		{ResourceTypeJS, true},
 		{ResourceTypeKV, true},
+		{ResourceTypeObj, true},
 		{ResourceType("unknown"), false},
 		{ResourceType(""), false},
 	}
@@ -296,6 +327,10 @@ func TestResource_FullType(t *testing.T) {
 		// KV
 		{"kv bucket only", "kv:config", ResourceTypeKVBucket},
 		{"kv bucket with key", "kv:config:app.settings", ResourceTypeKVBucketEntry},
+
+		// Object Store
+		{"obj bucket only", "obj:files", ResourceTypeObjBucket},
+		{"obj bucket with object", "obj:files:report.pdf", ResourceTypeObjBucketObject},
 	}
 
 	for _, tt := range tests {
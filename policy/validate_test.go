@@ -45,10 +45,23 @@ func TestValidateResource(t *testing.T) {
 		// Invalid KV NRNs
 		{"kv bucket with gt", "kv:config.>", true},
 
+		// Valid Obj NRNs
+		{"obj bucket only", "obj:files", false},
+		{"obj star bucket", "obj:*", false},
+		{"obj bucket object", "obj:files:report.pdf", false},
+		{"obj star object", "obj:files:*", false},
+		{"obj gt object", "obj:files:>", false},
+
+		// Invalid Obj NRNs
+		{"obj bucket with gt", "obj:files.>", true},
+		{"obj partial object wildcard", "obj:files:reports/*", true},
+		{"obj object with gt suffix", "obj:files:reports.>", true},
+
 		// Template variables - should pass validation (validated after interpolation)
 		{"nats template", "nats:user.{{ user.id }}", false},
 		{"js template", "js:{{ stream.name }}", false},
 		{"kv template", "kv:{{ bucket }}:{{ key }}", false},
+		{"obj template", "obj:uploads:{{ user.id }}.png", false},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,137 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+
+	"github.com/msimon/nauts/policy"
+)
+
+// LintRuleJetStreamDisabled: a policy grants JetStream actions in an account
+// without JetStream, where they have no effect.
+const LintRuleJetStreamDisabled = "jetstream-disabled"
+
+// AccountLimits are the limits of an account relevant to the permissions
+// nauts grants, as set in the account JWT (operator mode) or configured
+// (static mode).
+type AccountLimits struct {
+	// MaxConnections is the maximum number of client connections; -1 means
+	// unlimited. Defaults to -1 if omitted in the configuration.
+	MaxConnections int64 `json:"maxConnections"`
+
+	// JetStream reports whether JetStream is enabled for the account.
+	JetStream bool `json:"jetStream"`
+
+	// JetStreamTiers lists the tiers of tiered JetStream limits (e.g. "R1",
+	// "R3"), sorted. Empty if JetStream is disabled or limited globally.
+	JetStreamTiers []string `json:"jetStreamTiers,omitempty"`
+}
+
+// UnmarshalJSON decodes limits, defaulting MaxConnections to unlimited.
+func (l *AccountLimits) UnmarshalJSON(data []byte) error {
+	type plain AccountLimits
+	p := plain{MaxConnections: -1}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	*l = AccountLimits(p)
+	return nil
+}
+
+// accountLimitsFromClaims returns the limits of an account JWT.
+func accountLimitsFromClaims(claims *natsjwt.AccountClaims) *AccountLimits {
+	limits := &AccountLimits{
+		MaxConnections: claims.Limits.Conn,
+		JetStream:      claims.Limits.IsJSEnabled(),
+	}
+	for tier := range claims.Limits.JetStreamTieredLimits {
+		limits.JetStreamTiers = append(limits.JetStreamTiers, tier)
+	}
+	sort.Strings(limits.JetStreamTiers)
+	return limits
+}
+
+// loadAccountJWT reads the account JWT at path and checks that it belongs to
+// the account with the given public key.
+func loadAccountJWT(path, publicKey string) (*natsjwt.AccountClaims, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading account JWT: %w", err)
+	}
+	claims, err := natsjwt.DecodeAccountClaims(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("decoding account JWT %s: %w", path, err)
+	}
+	if claims.Subject != publicKey {
+		return nil, fmt.Errorf("account JWT %s is for %s, not %s", path, claims.Subject, publicKey)
+	}
+	return claims, nil
+}
+
+// JetStreamActions returns the JetStream actions allowed by the statements of
+// pol, sorted. Action groups are expanded.
+func JetStreamActions(pol *policy.Policy) []policy.Action {
+	seen := make(map[policy.Action]struct{})
+	var actions []policy.Action
+	for _, stmt := range pol.Statements {
+		if stmt.Effect != policy.EffectAllow {
+			continue
+		}
+		for _, action := range policy.ResolveActions(stmt.Actions) {
+			if _, ok := seen[action]; ok || !action.RequiresJetstream() {
+				continue
+			}
+			seen[action] = struct{}{}
+			actions = append(actions, action)
+		}
+	}
+	sort.Slice(actions, func(i, j int) bool { return actions[i] < actions[j] })
+	return actions
+}
+
+// LintAccountLimits checks policies against the limits of their accounts and
+// reports JetStream actions granted in accounts without JetStream. Global
+// policies and accounts with unknown limits are skipped.
+func LintAccountLimits(ctx context.Context, accounts AccountProvider, policies []*policy.Policy) ([]LintFinding, error) {
+	findings := []LintFinding{}
+	for _, p := range policies {
+		if p == nil || p.Account == globalAccountPrefix {
+			continue
+		}
+		limits, err := accounts.GetAccountLimits(ctx, p.Account)
+		if errors.Is(err, ErrAccountNotFound) {
+			// Policies of unknown accounts are never compiled.
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("getting limits of account %s: %w", p.Account, err)
+		}
+		if limits == nil || limits.JetStream {
+			continue
+		}
+		if actions := JetStreamActions(p); len(actions) > 0 {
+			findings = append(findings, LintFinding{
+				Rule: LintRuleJetStreamDisabled, Level: LintWarning, Type: DiffEntryPolicy, Account: p.Account, Name: p.ID,
+				Message: fmt.Sprintf("account has JetStream disabled; %s have no effect", joinActions(actions)),
+			})
+		}
+	}
+	sortLintFindings(findings)
+	return findings, nil
+}
+
+// joinActions returns actions as a comma-separated list.
+func joinActions(actions []policy.Action) string {
+	names := make([]string, len(actions))
+	for i, a := range actions {
+		names[i] = string(a)
+	}
+	return strings.Join(names, ", ")
+}
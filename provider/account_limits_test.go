@@ -0,0 +1,75 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/msimon/nauts/policy"
+)
+
+func TestAccountLimits_UnmarshalJSON(t *testing.T) {
+	var limits AccountLimits
+	if err := json.Unmarshal([]byte(`{"jetStream": true}`), &limits); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if limits.MaxConnections != -1 || !limits.JetStream {
+		t.Errorf("limits = %+v, want unlimited connections with JetStream", limits)
+	}
+}
+
+func TestStaticAccountProvider_GetAccountLimits(t *testing.T) {
+	accountKeyPath := filepath.Join(t.TempDir(), "account.nk")
+	if err := os.WriteFile(accountKeyPath, []byte("SAANJIBNEKGCRUWJCPIWUXFBFJLR36FJTFKGBGKAT7AQXH2LVFNQWZJMQU"), 0600); err != nil {
+		t.Fatalf("failed to write account key: %v", err)
+	}
+	cfg := StaticAccountProviderConfig{
+		PublicKey:      "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA",
+		PrivateKeyPath: accountKeyPath,
+		Accounts:       []string{"APP", "JS"},
+		Limits:         map[string]AccountLimits{"APP": {MaxConnections: 10}},
+	}
+	p, err := NewStaticAccountProvider(cfg)
+	if err != nil {
+		t.Fatalf("NewStaticAccountProvider() error = %v", err)
+	}
+	ctx := context.Background()
+
+	limits, err := p.GetAccountLimits(ctx, "APP")
+	if err != nil || limits == nil || limits.MaxConnections != 10 || limits.JetStream {
+		t.Errorf("GetAccountLimits(APP) = %+v, %v", limits, err)
+	}
+	if limits, err := p.GetAccountLimits(ctx, "JS"); err != nil || limits != nil {
+		t.Errorf("GetAccountLimits(JS) = %+v, %v, want nil", limits, err)
+	}
+	if _, err := p.GetAccountLimits(ctx, "OTHER"); !errors.Is(err, ErrAccountNotFound) {
+		t.Errorf("GetAccountLimits(OTHER) error = %v, want ErrAccountNotFound", err)
+	}
+
+	cfg.Limits = map[string]AccountLimits{"OTHER": {}}
+	if _, err := NewStaticAccountProvider(cfg); err == nil {
+		t.Error("NewStaticAccountProvider() with limits of unknown account: expected error")
+	}
+
+	policies := []*policy.Policy{
+		{ID: "js", Account: "APP", Statements: []policy.Statement{{
+			Effect: policy.EffectAllow, Actions: []policy.Action{policy.ActionGroupJSAll}, Resources: []string{"js:ORDERS"},
+		}}},
+		{ID: "pub", Account: "APP", Statements: []policy.Statement{{
+			Effect: policy.EffectAllow, Actions: []policy.Action{policy.ActionNATSPub}, Resources: []string{"nats:foo"},
+		}}},
+		{ID: "js", Account: "JS", Statements: []policy.Statement{{
+			Effect: policy.EffectAllow, Actions: []policy.Action{policy.ActionJSView}, Resources: []string{"js:ORDERS"},
+		}}},
+	}
+	findings, err := LintAccountLimits(ctx, p, policies)
+	if err != nil {
+		t.Fatalf("LintAccountLimits() error = %v", err)
+	}
+	if len(findings) != 1 || findings[0].Rule != LintRuleJetStreamDisabled || findings[0].Account != "APP" || findings[0].Name != "js" {
+		t.Errorf("LintAccountLimits() = %v, want one %s finding for APP.js", findings, LintRuleJetStreamDisabled)
+	}
+}
@@ -0,0 +1,277 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+
+	"github.com/msimon/nauts/jwt"
+)
+
+// AccountManager is implemented by account providers that maintain the
+// account JWTs, so they do not have to be created and updated manually.
+type AccountManager interface {
+	// ManagedAccounts returns the names of the accounts whose JWT is
+	// managed, sorted.
+	ManagedAccounts() []string
+
+	// EncodeAccountJWT returns the JWT of a managed account, signed by the
+	// operator. current is the account JWT known to the servers, or empty if
+	// there is none; its settings not managed by nauts (e.g. limits,
+	// authorization, revocations) are kept. changed is false if current
+	// already has the managed settings. Returns ErrAccountNotFound if the
+	// account does not exist or is not managed.
+	EncodeAccountJWT(ctx context.Context, name, current string) (token string, changed bool, err error)
+}
+
+// AccountManageConfig lets nauts generate the account JWTs and push them to
+// the account resolver of the NATS servers.
+type AccountManageConfig struct {
+	// OperatorSigningKeyPath is the path to an operator signing key seed
+	// (.nk file) or a vault:// reference (see VaultScheme) that signs the
+	// account JWTs.
+	OperatorSigningKeyPath string `json:"operatorSigningKeyPath"`
+
+	// SystemCredentials is the path to the credentials file of a system
+	// account user, used to look up and update account JWTs.
+	SystemCredentials string `json:"systemCredentials"`
+}
+
+// AccountClaimsConfig describes the managed settings of an account JWT. The
+// signing key of the account is always added to its signing keys.
+type AccountClaimsConfig struct {
+	// SigningKeys are additional public account signing keys, e.g. of
+	// other services issuing users in the account.
+	SigningKeys []string `json:"signingKeys,omitempty"`
+
+	// Exports are the streams and services the account exports. They replace
+	// the exports of the current JWT.
+	Exports []AccountExportConfig `json:"exports,omitempty"`
+
+	// Imports are the streams and services the account imports. They replace
+	// the imports of the current JWT.
+	Imports []AccountImportConfig `json:"imports,omitempty"`
+}
+
+// AccountExportConfig describes a stream or service export.
+type AccountExportConfig struct {
+	Name    string `json:"name,omitempty"`
+	Subject string `json:"subject"`
+	// Type is "stream" or "service".
+	Type string `json:"type"`
+	// TokenRequired restricts the export to accounts with an activation token.
+	TokenRequired bool `json:"tokenRequired,omitempty"`
+}
+
+// AccountImportConfig describes a stream or service import.
+type AccountImportConfig struct {
+	Name string `json:"name,omitempty"`
+	// Account is the exporting account, by name of a configured account or
+	// by public key.
+	Account string `json:"account"`
+	// Subject is the subject exported by Account.
+	Subject string `json:"subject"`
+	// LocalSubject optionally maps the subject into this account.
+	LocalSubject string `json:"localSubject,omitempty"`
+	// Type is "stream" or "service".
+	Type string `json:"type"`
+	// Token is the activation token of a private export.
+	Token string `json:"token,omitempty"`
+}
+
+// exportType parses the type of an export or import.
+func exportType(s string) (natsjwt.ExportType, error) {
+	switch s {
+	case "stream":
+		return natsjwt.Stream, nil
+	case "service":
+		return natsjwt.Service, nil
+	default:
+		return natsjwt.Unknown, fmt.Errorf("invalid type %q (must be 'stream' or 'service')", s)
+	}
+}
+
+// ManagedAccounts returns the names of the accounts with claims, if the
+// provider manages account JWTs.
+func (p *OperatorAccountProvider) ManagedAccounts() []string {
+	if p.operatorSigner == nil {
+		return nil
+	}
+	names := make([]string, 0, len(p.claims))
+	for name := range p.claims {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// EncodeAccountJWT implements AccountManager.
+func (p *OperatorAccountProvider) EncodeAccountJWT(ctx context.Context, name, current string) (string, bool, error) {
+	account, ok := p.accounts[name]
+	cfg, managed := p.claims[name]
+	if !ok || !managed || p.operatorSigner == nil {
+		return "", false, fmt.Errorf("%w: %s", ErrAccountNotFound, name)
+	}
+
+	var claims *natsjwt.AccountClaims
+	if current == "" {
+		claims = natsjwt.NewAccountClaims(account.PublicKey())
+		claims.Name = name
+	} else {
+		var err error
+		claims, err = natsjwt.DecodeAccountClaims(current)
+		if err != nil {
+			return "", false, fmt.Errorf("decoding account JWT: %w", err)
+		}
+		if claims.Subject != account.PublicKey() {
+			return "", false, fmt.Errorf("account JWT is for %s, not %s", claims.Subject, account.PublicKey())
+		}
+	}
+
+	changed, err := p.applyAccountClaims(claims, account, cfg)
+	if err != nil {
+		return "", false, err
+	}
+	if current != "" && !changed {
+		return current, false, nil
+	}
+
+	var vr natsjwt.ValidationResults
+	claims.Validate(&vr)
+	if errs := vr.Errors(); len(errs) > 0 {
+		return "", false, fmt.Errorf("invalid account JWT: %w", errs[0])
+	}
+	token, err := claims.Encode(jwt.NewSignerAdapter(p.operatorSigner))
+	if err != nil {
+		return "", false, fmt.Errorf("encoding account JWT: %w", err)
+	}
+	return token, true, nil
+}
+
+// applyAccountClaims sets the managed settings of cfg on claims and reports
+// whether they changed.
+func (p *OperatorAccountProvider) applyAccountClaims(claims *natsjwt.AccountClaims, account *Account, cfg AccountClaimsConfig) (bool, error) {
+	changed := false
+	if claims.SigningKeys == nil {
+		claims.SigningKeys = natsjwt.SigningKeys{}
+	}
+	keys := append([]string{account.Signer().PublicKey()}, cfg.SigningKeys...)
+	for _, key := range keys {
+		if key == account.PublicKey() || claims.SigningKeys.Contains(key) {
+			continue
+		}
+		claims.SigningKeys.Add(key)
+		changed = true
+	}
+
+	var exports natsjwt.Exports
+	for i, e := range cfg.Exports {
+		typ, err := exportType(e.Type)
+		if err != nil {
+			return false, fmt.Errorf("exports[%d]: %w", i, err)
+		}
+		exports = append(exports, &natsjwt.Export{
+			Name:         e.Name,
+			Subject:      natsjwt.Subject(e.Subject),
+			Type:         typ,
+			TokenReq:     e.TokenRequired,
+			ResponseType: responseType(typ),
+		})
+	}
+	var imports natsjwt.Imports
+	for i, imp := range cfg.Imports {
+		typ, err := exportType(imp.Type)
+		if err != nil {
+			return false, fmt.Errorf("imports[%d]: %w", i, err)
+		}
+		issuer := imp.Account
+		if other, ok := p.accounts[issuer]; ok {
+			issuer = other.PublicKey()
+		}
+		imports = append(imports, &natsjwt.Import{
+			Name:         imp.Name,
+			Subject:      natsjwt.Subject(imp.Subject),
+			Account:      issuer,
+			LocalSubject: natsjwt.RenamingSubject(imp.LocalSubject),
+			Type:         typ,
+			Token:        imp.Token,
+		})
+	}
+	if !sameJSON(claims.Exports, exports) {
+		claims.Exports = exports
+		changed = true
+	}
+	if !sameJSON(claims.Imports, imports) {
+		claims.Imports = imports
+		changed = true
+	}
+	return changed, nil
+}
+
+// responseType returns the response type of an export: services respond
+// with a single message, as with nsc.
+func responseType(typ natsjwt.ExportType) natsjwt.ResponseType {
+	if typ == natsjwt.Service {
+		return natsjwt.ResponseTypeSingleton
+	}
+	return ""
+}
+
+// sameJSON reports whether a and b encode to the same JSON, treating empty
+// lists as equal.
+func sameJSON[T any](a, b []T) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
+
+// loadOperatorSigner loads the operator signing key of cfg.
+func loadOperatorSigner(keys *keyLoader, cfg *AccountManageConfig) (jwt.Signer, error) {
+	if cfg.OperatorSigningKeyPath == "" {
+		return nil, fmt.Errorf("operatorSigningKeyPath is required")
+	}
+	signer, err := keys.load(cfg.OperatorSigningKeyPath, nkeys.PrefixByteOperator)
+	if err != nil {
+		return nil, fmt.Errorf("loading operator signing key: %w", err)
+	}
+	if !strings.HasPrefix(signer.PublicKey(), "O") {
+		return nil, fmt.Errorf("operatorSigningKeyPath must contain an operator key")
+	}
+	return signer, nil
+}
+
+// validateAccountClaims checks the claims configuration of an account.
+func validateAccountClaims(cfg AccountClaimsConfig) error {
+	for i, key := range cfg.SigningKeys {
+		if !strings.HasPrefix(key, "A") {
+			return fmt.Errorf("signingKeys[%d] must be an account public key: %q", i, key)
+		}
+	}
+	for i, e := range cfg.Exports {
+		if e.Subject == "" {
+			return fmt.Errorf("exports[%d].subject is required", i)
+		}
+		if _, err := exportType(e.Type); err != nil {
+			return fmt.Errorf("exports[%d]: %w", i, err)
+		}
+	}
+	for i, imp := range cfg.Imports {
+		if imp.Subject == "" || imp.Account == "" {
+			return fmt.Errorf("imports[%d] requires subject and account", i)
+		}
+		if _, err := exportType(imp.Type); err != nil {
+			return fmt.Errorf("imports[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+var _ AccountManager = (*OperatorAccountProvider)(nil)
@@ -0,0 +1,154 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	natsjwt "github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+)
+
+// writeSeed creates a key pair with create, writes its seed to dir/name, and
+// returns the path and public key.
+func writeSeed(t *testing.T, dir, name string, create func() (nkeys.KeyPair, error)) (string, string) {
+	t.Helper()
+	kp, err := create()
+	if err != nil {
+		t.Fatalf("creating key pair: %v", err)
+	}
+	seed, err := kp.Seed()
+	if err != nil {
+		t.Fatalf("getting seed: %v", err)
+	}
+	pub, err := kp.PublicKey()
+	if err != nil {
+		t.Fatalf("getting public key: %v", err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, seed, 0600); err != nil {
+		t.Fatalf("writing %s: %v", path, err)
+	}
+	return path, pub
+}
+
+func TestOperatorAccountProvider_EncodeAccountJWT(t *testing.T) {
+	dir := t.TempDir()
+	operatorPath, operatorPub := writeSeed(t, dir, "operator.nk", nkeys.CreateOperator)
+	_, appPub := writeSeed(t, dir, "app.nk", nkeys.CreateAccount)
+	appSigningPath, appSigningPub := writeSeed(t, dir, "app-signing.nk", nkeys.CreateAccount)
+	_, sharedPub := writeSeed(t, dir, "shared.nk", nkeys.CreateAccount)
+	sharedSigningPath, _ := writeSeed(t, dir, "shared-signing.nk", nkeys.CreateAccount)
+
+	p, err := NewOperatorAccountProvider(OperatorAccountProviderConfig{
+		Accounts: map[string]AccountSigningConfig{
+			"APP": {
+				PublicKey:      appPub,
+				SigningKeyPath: appSigningPath,
+				Claims: &AccountClaimsConfig{
+					Imports: []AccountImportConfig{{Account: "SHARED", Subject: "rates.>", Type: "stream"}},
+				},
+			},
+			"SHARED": {PublicKey: sharedPub, SigningKeyPath: sharedSigningPath},
+		},
+		Manage: &AccountManageConfig{OperatorSigningKeyPath: operatorPath, SystemCredentials: "sys.creds"},
+	})
+	if err != nil {
+		t.Fatalf("NewOperatorAccountProvider() error = %v", err)
+	}
+	if got := p.ManagedAccounts(); len(got) != 1 || got[0] != "APP" {
+		t.Fatalf("ManagedAccounts() = %v, want [APP]", got)
+	}
+	ctx := context.Background()
+
+	token, changed, err := p.EncodeAccountJWT(ctx, "APP", "")
+	if err != nil || !changed {
+		t.Fatalf("EncodeAccountJWT(new) = changed %v, error %v", changed, err)
+	}
+	claims, err := natsjwt.DecodeAccountClaims(token)
+	if err != nil {
+		t.Fatalf("decoding account JWT: %v", err)
+	}
+	if claims.Subject != appPub || claims.Issuer != operatorPub || claims.Name != "APP" {
+		t.Errorf("claims subject %s, issuer %s, name %s", claims.Subject, claims.Issuer, claims.Name)
+	}
+	if !claims.SigningKeys.Contains(appSigningPub) {
+		t.Errorf("signing keys = %v, want %s", claims.SigningKeys.Keys(), appSigningPub)
+	}
+	if len(claims.Imports) != 1 || claims.Imports[0].Account != sharedPub {
+		t.Errorf("imports = %+v, want stream import from %s", claims.Imports, sharedPub)
+	}
+
+	// Unmanaged settings of the current JWT are kept; an up-to-date JWT is
+	// not re-signed.
+	claims.Limits.Conn = 5
+	current, err := claims.Encode(mustKeyPair(t, operatorPath))
+	if err != nil {
+		t.Fatalf("encoding current JWT: %v", err)
+	}
+	if token, changed, err := p.EncodeAccountJWT(ctx, "APP", current); err != nil || changed || token != current {
+		t.Errorf("EncodeAccountJWT(current) = changed %v, error %v, want unchanged", changed, err)
+	}
+
+	claims.Imports = nil
+	current, err = claims.Encode(mustKeyPair(t, operatorPath))
+	if err != nil {
+		t.Fatalf("encoding current JWT: %v", err)
+	}
+	token, changed, err = p.EncodeAccountJWT(ctx, "APP", current)
+	if err != nil || !changed {
+		t.Fatalf("EncodeAccountJWT(outdated) = changed %v, error %v", changed, err)
+	}
+	updated, err := natsjwt.DecodeAccountClaims(token)
+	if err != nil {
+		t.Fatalf("decoding account JWT: %v", err)
+	}
+	if updated.Limits.Conn != 5 || len(updated.Imports) != 1 {
+		t.Errorf("updated claims: conn limit %d, %d imports, want 5, 1", updated.Limits.Conn, len(updated.Imports))
+	}
+
+	if _, _, err := p.EncodeAccountJWT(ctx, "SHARED", ""); !errors.Is(err, ErrAccountNotFound) {
+		t.Errorf("EncodeAccountJWT(unmanaged) error = %v, want ErrAccountNotFound", err)
+	}
+}
+
+func TestNewOperatorAccountProvider_InvalidClaims(t *testing.T) {
+	dir := t.TempDir()
+	operatorPath, _ := writeSeed(t, dir, "operator.nk", nkeys.CreateOperator)
+	accountPath, accountPub := writeSeed(t, dir, "account.nk", nkeys.CreateAccount)
+
+	cfg := OperatorAccountProviderConfig{
+		Accounts: map[string]AccountSigningConfig{
+			"APP": {
+				PublicKey:      accountPub,
+				SigningKeyPath: accountPath,
+				Claims:         &AccountClaimsConfig{Exports: []AccountExportConfig{{Subject: "orders.>", Type: "queue"}}},
+			},
+		},
+		Manage: &AccountManageConfig{OperatorSigningKeyPath: operatorPath},
+	}
+	if _, err := NewOperatorAccountProvider(cfg); err == nil {
+		t.Error("expected error for invalid export type")
+	}
+
+	cfg.Accounts["APP"] = AccountSigningConfig{PublicKey: accountPub, SigningKeyPath: accountPath}
+	cfg.Manage.OperatorSigningKeyPath = accountPath
+	if _, err := NewOperatorAccountProvider(cfg); err == nil {
+		t.Error("expected error for non-operator signing key")
+	}
+}
+
+func mustKeyPair(t *testing.T, path string) nkeys.KeyPair {
+	t.Helper()
+	seed, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	kp, err := nkeys.FromSeed(seed)
+	if err != nil {
+		t.Fatalf("parsing seed: %v", err)
+	}
+	return kp
+}
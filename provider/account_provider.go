@@ -13,6 +13,10 @@ type AccountProvider interface {
 	// ListAccounts returns all accounts.
 	ListAccounts(ctx context.Context) ([]*Account, error)
 
+	// GetAccountLimits returns the limits of an account, or nil if they are
+	// unknown. Returns ErrAccountNotFound if the account does not exist.
+	GetAccountLimits(ctx context.Context, name string) (*AccountLimits, error)
+
 	// IsOperatorMode returns true if this provider operates in NATS operator mode.
 	// In operator mode, the auth service runs in the AUTH account but authenticates
 	// users across all accounts using account signing keys. The auth callout response
@@ -1,31 +1,130 @@
 package provider
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 	"sync"
 	"time"
 )
 
+// DefaultCacheMaxEntries is the default size bound of the sharded cache and
+// of the local tier of the Redis cache.
+const DefaultCacheMaxEntries = 100000
+
+// cache stores the values read by a policy provider for a TTL. It is safe
+// for concurrent use.
+type cache interface {
+	// get returns the cached value for the key, or nil if not present or expired.
+	get(key string) any
+	// put stores a value in the cache with the configured TTL.
+	put(key string, value any)
+	// invalidate removes a single entry from the cache.
+	invalidate(key string)
+	// invalidatePrefix removes all entries whose key starts with the given prefix.
+	invalidatePrefix(prefix string)
+	// clear removes all entries from the cache.
+	clear()
+	// generation returns a counter incremented by every invalidation, so that
+	// results derived from cached entries can be invalidated with them.
+	generation() uint64
+	// close releases the resources of the cache.
+	close() error
+}
+
+// CacheConfig selects the cache backend of a policy provider.
+type CacheConfig struct {
+	// Type is the backend:
+	//   - "memory" (default): a map behind a single lock
+	//   - "sharded": a lock-striped map bounded to MaxEntries, for high
+	//     request rates
+	//   - "redis": entries and invalidations shared by all replicas through
+	//     Redis, with a local sharded tier
+	Type string `json:"type,omitempty"`
+
+	// MaxEntries bounds the sharded cache and the local tier of the Redis
+	// cache; the least recently used entries are evicted first.
+	// Default: 100000 (DefaultCacheMaxEntries).
+	MaxEntries int `json:"maxEntries,omitempty"`
+
+	// Redis configures the Redis backend. Required when Type is "redis".
+	Redis *RedisCacheConfig `json:"redis,omitempty"`
+}
+
+// Validate checks the configuration. A nil configuration is valid.
+func (c *CacheConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.MaxEntries < 0 {
+		return errors.New("maxEntries must not be negative")
+	}
+	switch c.Type {
+	case "", "memory", "sharded":
+		return nil
+	case "redis":
+		if c.Redis == nil {
+			return errors.New("redis configuration is required when type is 'redis'")
+		}
+		if err := c.Redis.Validate(); err != nil {
+			return fmt.Errorf("redis: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported cache type: %s", c.Type)
+	}
+}
+
+// getMaxEntries returns MaxEntries, defaulting to DefaultCacheMaxEntries.
+func (c *CacheConfig) getMaxEntries() int {
+	if c == nil || c.MaxEntries == 0 {
+		return DefaultCacheMaxEntries
+	}
+	return c.MaxEntries
+}
+
+// newProviderCache creates the cache selected by cfg. The Redis backend keeps
+// its keys under prefix unless the configuration sets one, and stores values
+// as JSON, which decode turns back into the value cached under key.
+func newProviderCache(cfg *CacheConfig, ttl time.Duration, prefix string, decode func(key string, data []byte) (any, error)) (cache, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("cache: %w", err)
+	}
+	if cfg == nil {
+		return newMemoryCache(ttl), nil
+	}
+	switch cfg.Type {
+	case "sharded":
+		return newShardedCache(ttl, cfg.getMaxEntries()), nil
+	case "redis":
+		return newRedisCache(*cfg.Redis, ttl, cfg.getMaxEntries(), prefix, decode)
+	default:
+		return newMemoryCache(ttl), nil
+	}
+}
+
 type cacheEntry struct {
 	value     any
 	expiresAt time.Time
 }
 
-type cache struct {
+// memoryCache is the default cache: an unbounded map behind a single lock.
+type memoryCache struct {
 	mu      sync.RWMutex
 	entries map[string]*cacheEntry
 	ttl     time.Duration
+	// gen is incremented by every invalidation.
+	gen uint64
 }
 
-func newCache(ttl time.Duration) *cache {
-	return &cache{
+func newMemoryCache(ttl time.Duration) *memoryCache {
+	return &memoryCache{
 		entries: make(map[string]*cacheEntry),
 		ttl:     ttl,
 	}
 }
 
-// get returns the cached value for the key, or nil if not present or expired.
-func (c *cache) get(key string) any {
+func (c *memoryCache) get(key string) any {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
@@ -39,8 +138,7 @@ func (c *cache) get(key string) any {
 	return entry.value
 }
 
-// put stores a value in the cache with the configured TTL.
-func (c *cache) put(key string, value any) {
+func (c *memoryCache) put(key string, value any) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -50,16 +148,15 @@ func (c *cache) put(key string, value any) {
 	}
 }
 
-// invalidate removes a single entry from the cache.
-func (c *cache) invalidate(key string) {
+func (c *memoryCache) invalidate(key string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	delete(c.entries, key)
+	c.gen++
 }
 
-// invalidatePrefix removes all entries whose key starts with the given prefix.
-func (c *cache) invalidatePrefix(prefix string) {
+func (c *memoryCache) invalidatePrefix(prefix string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -68,12 +165,25 @@ func (c *cache) invalidatePrefix(prefix string) {
 			delete(c.entries, k)
 		}
 	}
+	c.gen++
 }
 
-// clear removes all entries from the cache.
-func (c *cache) clear() {
+func (c *memoryCache) clear() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	c.entries = make(map[string]*cacheEntry)
+	c.gen++
+}
+
+func (c *memoryCache) generation() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.gen
+}
+
+func (c *memoryCache) close() error {
+	c.clear()
+	return nil
 }
@@ -0,0 +1,304 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redisErrorLogInterval limits how often Redis errors are logged, so that an
+// outage does not log on every request.
+const redisErrorLogInterval = 30 * time.Second
+
+// redisCache shares the cache of a policy provider between replicas. Entries
+// are stored as JSON in Redis under the configured prefix, with the cache TTL
+// as expiry, and every invalidation is published on the channel
+// <prefix>invalidate, so that the local tier of every replica drops the
+// entry and bumps its generation.
+//
+// Redis is an optimization: if it is unreachable, reads fall back to the
+// local tier and the provider's backing store, and errors are logged.
+type redisCache struct {
+	local   *shardedCache
+	client  *redisClient
+	cfg     RedisCacheConfig
+	prefix  string
+	channel string
+	ttl     time.Duration
+	decode  func(key string, data []byte) (any, error)
+
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	sub     *redisConn // invalidation subscription
+	lastLog time.Time
+}
+
+// Invalidation messages published on the channel.
+const (
+	redisInvalidateKey    = "key:"
+	redisInvalidatePrefix = "prefix:"
+	redisInvalidateAll    = "all"
+)
+
+func newRedisCache(cfg RedisCacheConfig, ttl time.Duration, maxEntries int, prefix string, decode func(key string, data []byte) (any, error)) (*redisCache, error) {
+	if cfg.Prefix != "" {
+		prefix = cfg.Prefix
+	}
+	c := &redisCache{
+		local:   newShardedCache(ttl, maxEntries),
+		client:  newRedisClient(cfg),
+		cfg:     cfg,
+		prefix:  prefix,
+		channel: prefix + "invalidate",
+		ttl:     ttl,
+		decode:  decode,
+		done:    make(chan struct{}),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if _, err := c.client.do(ctx, "PING"); err != nil {
+		c.client.close()
+		return nil, err
+	}
+	sub, err := c.subscribe(ctx)
+	if err != nil {
+		c.client.close()
+		return nil, err
+	}
+	c.sub = sub
+	c.wg.Add(1)
+	go c.subscribeLoop(sub)
+	return c, nil
+}
+
+func (c *redisCache) get(key string) any {
+	if v := c.local.get(key); v != nil {
+		return v
+	}
+	reply, err := c.client.do(context.Background(), "GET", c.prefix+key)
+	if err != nil {
+		c.logError("reading %s: %v", key, err)
+		return nil
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil
+	}
+	v, err := c.decode(key, data)
+	if err != nil {
+		c.logError("decoding %s: %v", key, err)
+		return nil
+	}
+	c.local.put(key, v)
+	return v
+}
+
+func (c *redisCache) put(key string, value any) {
+	c.local.put(key, value)
+	data, err := json.Marshal(value)
+	if err != nil {
+		c.logError("encoding %s: %v", key, err)
+		return
+	}
+	ttl := max(c.ttl.Milliseconds(), 1)
+	if _, err := c.client.do(context.Background(), "SET", c.prefix+key, string(data), "PX", fmt.Sprint(ttl)); err != nil {
+		c.logError("writing %s: %v", key, err)
+	}
+}
+
+func (c *redisCache) invalidate(key string) {
+	c.local.invalidate(key)
+	ctx := context.Background()
+	if _, err := c.client.do(ctx, "DEL", c.prefix+key); err != nil {
+		c.logError("deleting %s: %v", key, err)
+	}
+	c.publish(ctx, redisInvalidateKey+key)
+}
+
+func (c *redisCache) invalidatePrefix(prefix string) {
+	c.local.invalidatePrefix(prefix)
+	ctx := context.Background()
+	c.deleteMatching(ctx, prefix)
+	c.publish(ctx, redisInvalidatePrefix+prefix)
+}
+
+func (c *redisCache) clear() {
+	c.local.clear()
+	ctx := context.Background()
+	c.deleteMatching(ctx, "")
+	c.publish(ctx, redisInvalidateAll)
+}
+
+func (c *redisCache) generation() uint64 {
+	return c.local.generation()
+}
+
+// close ends the invalidation subscription and closes the connections. The
+// shared entries are kept for the other replicas.
+func (c *redisCache) close() error {
+	close(c.done)
+	c.mu.Lock()
+	if c.sub != nil {
+		c.sub.close()
+	}
+	c.mu.Unlock()
+	c.wg.Wait()
+	c.client.close()
+	c.local.clear()
+	return nil
+}
+
+// deleteMatching deletes the shared entries whose key starts with prefix.
+func (c *redisCache) deleteMatching(ctx context.Context, prefix string) {
+	pattern := redisGlobEscape(c.prefix+prefix) + "*"
+	cursor := "0"
+	for {
+		reply, err := c.client.do(ctx, "SCAN", cursor, "MATCH", pattern, "COUNT", "500")
+		if err != nil {
+			c.logError("scanning %s: %v", pattern, err)
+			return
+		}
+		items, ok := reply.([]any)
+		if !ok || len(items) != 2 {
+			c.logError("scanning %s: unexpected reply %v", pattern, reply)
+			return
+		}
+		next, _ := items[0].([]byte)
+		keys, _ := items[1].([]any)
+		if len(keys) > 0 {
+			args := []string{"DEL"}
+			for _, k := range keys {
+				if b, ok := k.([]byte); ok {
+					args = append(args, string(b))
+				}
+			}
+			if len(args) > 1 {
+				if _, err := c.client.do(ctx, args...); err != nil {
+					c.logError("deleting %s: %v", pattern, err)
+				}
+			}
+		}
+		if cursor = string(next); cursor == "0" || cursor == "" {
+			return
+		}
+	}
+}
+
+func (c *redisCache) publish(ctx context.Context, msg string) {
+	if _, err := c.client.do(ctx, "PUBLISH", c.channel, msg); err != nil {
+		c.logError("publishing invalidation: %v", err)
+	}
+}
+
+// subscribe opens a connection subscribed to the invalidation channel.
+func (c *redisCache) subscribe(ctx context.Context) (*redisConn, error) {
+	conn, err := dialRedis(ctx, c.cfg)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.do("SUBSCRIBE", c.channel); err != nil {
+		conn.close()
+		return nil, fmt.Errorf("subscribing to %s: %w", c.channel, err)
+	}
+	return conn, nil
+}
+
+// subscribeLoop applies the invalidations of other replicas to the local
+// tier. After the subscription was interrupted, it resubscribes with
+// exponential backoff and clears the local tier, since invalidations may have
+// been missed.
+func (c *redisCache) subscribeLoop(sub *redisConn) {
+	defer c.wg.Done()
+	backoff := time.Second
+	const maxBackoff = 30 * time.Second
+
+	for {
+		for {
+			reply, err := sub.read()
+			if err != nil {
+				break
+			}
+			if msg, ok := reply.([]any); ok && len(msg) == 3 && string(asBytes(msg[0])) == "message" {
+				c.apply(string(asBytes(msg[2])))
+			}
+		}
+		sub.close()
+
+		for {
+			select {
+			case <-c.done:
+				return
+			case <-time.After(backoff):
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+			next, err := c.subscribe(ctx)
+			cancel()
+			if err != nil {
+				c.logError("resubscribing to %s: %v", c.channel, err)
+				backoff = min(backoff*2, maxBackoff)
+				continue
+			}
+			c.mu.Lock()
+			select {
+			case <-c.done:
+				c.mu.Unlock()
+				next.close()
+				return
+			default:
+			}
+			c.sub = next
+			c.mu.Unlock()
+			sub = next
+			backoff = time.Second
+			c.local.clear()
+			break
+		}
+	}
+}
+
+// apply applies an invalidation message to the local tier.
+func (c *redisCache) apply(msg string) {
+	switch {
+	case msg == redisInvalidateAll:
+		c.local.clear()
+	case strings.HasPrefix(msg, redisInvalidateKey):
+		c.local.invalidate(strings.TrimPrefix(msg, redisInvalidateKey))
+	case strings.HasPrefix(msg, redisInvalidatePrefix):
+		c.local.invalidatePrefix(strings.TrimPrefix(msg, redisInvalidatePrefix))
+	}
+}
+
+// logError logs a Redis error at most once per redisErrorLogInterval.
+func (c *redisCache) logError(format string, args ...any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.lastLog) < redisErrorLogInterval {
+		return
+	}
+	c.lastLog = time.Now()
+	log.Printf("redis cache: "+format, args...)
+}
+
+func asBytes(v any) []byte {
+	b, _ := v.([]byte)
+	return b
+}
+
+// redisGlobEscape escapes the glob characters of a SCAN MATCH pattern.
+func redisGlobEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
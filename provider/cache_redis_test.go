@@ -0,0 +1,256 @@
+package provider
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/msimon/nauts/policy"
+)
+
+// fakeRedis serves the RESP commands used by redisCache.
+type fakeRedis struct {
+	ln net.Listener
+
+	mu          sync.Mutex
+	data        map[string]string
+	subscribers map[string][]net.Conn
+	conns       []net.Conn
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	f := &fakeRedis{ln: ln, data: make(map[string]string), subscribers: make(map[string][]net.Conn)}
+	go f.serve()
+	t.Cleanup(f.close)
+	return f
+}
+
+func (f *fakeRedis) addr() string { return f.ln.Addr().String() }
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.conns = append(f.conns, conn)
+		f.mu.Unlock()
+		go f.handle(conn)
+	}
+}
+
+// dropConnections closes all client connections, as a Redis restart would.
+func (f *fakeRedis) dropConnections() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range f.conns {
+		_ = c.Close()
+	}
+	f.conns = nil
+	f.subscribers = make(map[string][]net.Conn)
+}
+
+func (f *fakeRedis) close() {
+	_ = f.ln.Close()
+	f.dropConnections()
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readRESPCommand(r)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		reply := f.exec(conn, args)
+		f.mu.Unlock()
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) exec(conn net.Conn, args []string) string {
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "AUTH":
+		if args[len(args)-1] != "secret" {
+			return "-WRONGPASS invalid password\r\n"
+		}
+		return "+OK\r\n"
+	case "SELECT":
+		return "+OK\r\n"
+	case "GET":
+		v, ok := f.data[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return respBulk(v)
+	case "SET":
+		f.data[args[1]] = args[2]
+		return "+OK\r\n"
+	case "DEL":
+		n := 0
+		for _, k := range args[1:] {
+			if _, ok := f.data[k]; ok {
+				delete(f.data, k)
+				n++
+			}
+		}
+		return ":" + strconv.Itoa(n) + "\r\n"
+	case "SCAN":
+		// Only trailing-* patterns with escaped characters are used.
+		prefix := strings.TrimSuffix(args[3], "*")
+		prefix = strings.NewReplacer(`\*`, "*", `\?`, "?", `\[`, "[", `\]`, "]", `\\`, `\`).Replace(prefix)
+		var keys []string
+		for k := range f.data {
+			if strings.HasPrefix(k, prefix) {
+				keys = append(keys, respBulk(k))
+			}
+		}
+		return "*2\r\n" + respBulk("0") + "*" + strconv.Itoa(len(keys)) + "\r\n" + strings.Join(keys, "")
+	case "PUBLISH":
+		subs := f.subscribers[args[1]]
+		msg := "*3\r\n" + respBulk("message") + respBulk(args[1]) + respBulk(args[2])
+		for _, s := range subs {
+			_, _ = io.WriteString(s, msg)
+		}
+		return ":" + strconv.Itoa(len(subs)) + "\r\n"
+	case "SUBSCRIBE":
+		f.subscribers[args[1]] = append(f.subscribers[args[1]], conn)
+		return "*3\r\n" + respBulk("subscribe") + respBulk(args[1]) + ":1\r\n"
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func respBulk(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+func newTestRedisCache(t *testing.T, f *fakeRedis) *redisCache {
+	t.Helper()
+	c, err := newRedisCache(RedisCacheConfig{Address: f.addr(), Password: "secret", DB: 1}, time.Minute, 1000, "nauts:test:", decodeKVCacheEntry)
+	if err != nil {
+		t.Fatalf("newRedisCache() error = %v", err)
+	}
+	t.Cleanup(func() { _ = c.close() })
+	return c
+}
+
+// eventually polls cond for up to a second.
+func eventually(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	for range 100 {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error(msg)
+}
+
+func TestRedisCache_SharedBetweenReplicas(t *testing.T) {
+	f := newFakeRedis(t)
+	a := newTestRedisCache(t, f)
+	b := newTestRedisCache(t, f)
+
+	pol := &policy.Policy{ID: "read", Account: "APP", Name: "Read"}
+	a.put("APP.policy.read", pol)
+	got, ok := b.get("APP.policy.read").(*policy.Policy)
+	if !ok || got.ID != "read" || got.Name != "Read" {
+		t.Fatalf("replica b get() = %#v, want the policy put by replica a", b.get("APP.policy.read"))
+	}
+	a.put("APP.binding.readers", &Binding{Role: "readers", Account: "APP", Policies: []string{"read"}})
+	if binding, ok := b.get("APP.binding.readers").(*Binding); !ok || binding.Role != "readers" {
+		t.Fatalf("replica b get() = %#v, want the binding put by replica a", b.get("APP.binding.readers"))
+	}
+
+	gen := b.generation()
+	a.invalidate("APP.policy.read")
+	eventually(t, func() bool { return b.generation() != gen }, "replica b did not receive the invalidation")
+	if v := b.get("APP.policy.read"); v != nil {
+		t.Errorf("replica b get() after invalidation = %v, want nil", v)
+	}
+
+	a.invalidatePrefix("APP.")
+	eventually(t, func() bool { return b.get("APP.binding.readers") == nil }, "replica b kept the binding after invalidatePrefix")
+}
+
+func TestRedisCache_Outage(t *testing.T) {
+	f := newFakeRedis(t)
+	c := newTestRedisCache(t, f)
+	c.put("APP.policy.read", &policy.Policy{ID: "read"})
+
+	_ = f.ln.Close()
+	f.dropConnections()
+
+	// The local tier keeps serving; Redis errors are not fatal.
+	if v := c.get("APP.policy.read"); v == nil {
+		t.Error("get() during outage lost the local entry")
+	}
+	if v := c.get("APP.policy.missing"); v != nil {
+		t.Errorf("get(missing) during outage = %v, want nil", v)
+	}
+	c.invalidate("APP.policy.read")
+	if v := c.get("APP.policy.read"); v != nil {
+		t.Errorf("get() after invalidation during outage = %v, want nil", v)
+	}
+}
+
+func TestNewRedisCache_Errors(t *testing.T) {
+	f := newFakeRedis(t)
+	if _, err := newRedisCache(RedisCacheConfig{Address: f.addr(), Password: "wrong"}, time.Minute, 1000, "nauts:", decodeKVCacheEntry); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("newRedisCache() with a wrong password error = %v, want WRONGPASS", err)
+	}
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := ln.Addr().String()
+	_ = ln.Close()
+	if _, err := newRedisCache(RedisCacheConfig{Address: addr}, time.Minute, 1000, "nauts:", decodeKVCacheEntry); err == nil {
+		t.Error("newRedisCache() without a server: expected error")
+	}
+}
+
+func TestRedisGlobEscape(t *testing.T) {
+	if got, want := redisGlobEscape(`nauts:a*b?[c]\`), `nauts:a\*b\?\[c\]\\`; got != want {
+		t.Errorf("redisGlobEscape() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,151 @@
+package provider
+
+import (
+	"hash/maphash"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// cacheShards is the number of independently locked shards of the
+	// sharded cache. Must be a power of two.
+	cacheShards = 64
+	// cacheEvictionSamples is the number of entries sampled to find one to
+	// evict from a full shard.
+	cacheEvictionSamples = 5
+)
+
+// shardedCache is a cache for high request rates in the style of Ristretto:
+// keys are spread over lock-striped shards, reads take a shared lock and
+// record their access without a write lock, and full shards evict the least
+// recently used of a few sampled entries (preferring expired ones) instead of
+// maintaining an exact LRU list.
+type shardedCache struct {
+	ttl         time.Duration
+	maxPerShard int
+	seed        maphash.Seed
+	shards      [cacheShards]cacheShard
+	gen         atomic.Uint64
+}
+
+type cacheShard struct {
+	mu      sync.RWMutex
+	entries map[string]*shardedEntry
+}
+
+type shardedEntry struct {
+	value     any
+	expiresAt int64        // unix nanoseconds
+	lastUsed  atomic.Int64 // unix nanoseconds
+}
+
+func newShardedCache(ttl time.Duration, maxEntries int) *shardedCache {
+	c := &shardedCache{
+		ttl:         ttl,
+		maxPerShard: max(1, maxEntries/cacheShards),
+		seed:        maphash.MakeSeed(),
+	}
+	for i := range c.shards {
+		c.shards[i].entries = make(map[string]*shardedEntry)
+	}
+	return c
+}
+
+func (c *shardedCache) shard(key string) *cacheShard {
+	return &c.shards[maphash.String(c.seed, key)&(cacheShards-1)]
+}
+
+func (c *shardedCache) get(key string) any {
+	s := c.shard(key)
+	s.mu.RLock()
+	e, ok := s.entries[key]
+	s.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	now := time.Now().UnixNano()
+	if now > e.expiresAt {
+		return nil
+	}
+	e.lastUsed.Store(now)
+	return e.value
+}
+
+func (c *shardedCache) put(key string, value any) {
+	now := time.Now()
+	e := &shardedEntry{value: value, expiresAt: now.Add(c.ttl).UnixNano()}
+	e.lastUsed.Store(now.UnixNano())
+
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[key]; !ok && len(s.entries) >= c.maxPerShard {
+		s.evict(now.UnixNano())
+	}
+	s.entries[key] = e
+}
+
+// evict removes an expired entry or the least recently used of a sample of
+// entries. Go randomizes map iteration, so the sample is random. The caller
+// must hold s.mu.
+func (s *cacheShard) evict(now int64) {
+	var victim string
+	oldest := int64(0)
+	n := 0
+	for k, e := range s.entries {
+		if now > e.expiresAt {
+			victim = k
+			break
+		}
+		if used := e.lastUsed.Load(); n == 0 || used < oldest {
+			victim, oldest = k, used
+		}
+		if n++; n == cacheEvictionSamples {
+			break
+		}
+	}
+	delete(s.entries, victim)
+}
+
+func (c *shardedCache) invalidate(key string) {
+	s := c.shard(key)
+	s.mu.Lock()
+	delete(s.entries, key)
+	s.mu.Unlock()
+	c.gen.Add(1)
+}
+
+func (c *shardedCache) invalidatePrefix(prefix string) {
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		for k := range s.entries {
+			if strings.HasPrefix(k, prefix) {
+				delete(s.entries, k)
+			}
+		}
+		s.mu.Unlock()
+	}
+	c.gen.Add(1)
+}
+
+func (c *shardedCache) clear() {
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		s.entries = make(map[string]*shardedEntry)
+		s.mu.Unlock()
+	}
+	c.gen.Add(1)
+}
+
+func (c *shardedCache) generation() uint64 {
+	return c.gen.Load()
+}
+
+func (c *shardedCache) close() error {
+	c.clear()
+	return nil
+}
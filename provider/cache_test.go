@@ -2,20 +2,21 @@ package provider
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 )
 
 func TestCache_GetMiss(t *testing.T) {
-	c := newCache(time.Minute)
+	c := newMemoryCache(time.Minute)
 	if got := c.get("missing"); got != nil {
 		t.Errorf("get(missing) = %v, want nil", got)
 	}
 }
 
 func TestCache_PutAndGet(t *testing.T) {
-	c := newCache(time.Minute)
+	c := newMemoryCache(time.Minute)
 	c.put("key1", "value1")
 
 	got := c.get("key1")
@@ -25,7 +26,7 @@ func TestCache_PutAndGet(t *testing.T) {
 }
 
 func TestCache_Expiry(t *testing.T) {
-	c := newCache(10 * time.Millisecond)
+	c := newMemoryCache(10 * time.Millisecond)
 	c.put("key1", "value1")
 
 	// Should be available immediately
@@ -42,7 +43,7 @@ func TestCache_Expiry(t *testing.T) {
 }
 
 func TestCache_Invalidate(t *testing.T) {
-	c := newCache(time.Minute)
+	c := newMemoryCache(time.Minute)
 	c.put("key1", "value1")
 	c.put("key2", "value2")
 
@@ -57,7 +58,7 @@ func TestCache_Invalidate(t *testing.T) {
 }
 
 func TestCache_InvalidatePrefix(t *testing.T) {
-	c := newCache(time.Minute)
+	c := newMemoryCache(time.Minute)
 	c.put("APP.policy.read", "p1")
 	c.put("APP.policy.write", "p2")
 	c.put("APP.binding.admin", "b1")
@@ -80,7 +81,7 @@ func TestCache_InvalidatePrefix(t *testing.T) {
 }
 
 func TestCache_Clear(t *testing.T) {
-	c := newCache(time.Minute)
+	c := newMemoryCache(time.Minute)
 	c.put("key1", "value1")
 	c.put("key2", "value2")
 
@@ -95,7 +96,7 @@ func TestCache_Clear(t *testing.T) {
 }
 
 func TestCache_Concurrency(t *testing.T) {
-	c := newCache(time.Minute)
+	c := newMemoryCache(time.Minute)
 	var wg sync.WaitGroup
 
 	// Concurrent writers
@@ -132,7 +133,7 @@ func TestCache_Concurrency(t *testing.T) {
 }
 
 func TestCache_OverwriteValue(t *testing.T) {
-	c := newCache(time.Minute)
+	c := newMemoryCache(time.Minute)
 	c.put("key1", "old")
 	c.put("key1", "new")
 
@@ -140,3 +141,101 @@ func TestCache_OverwriteValue(t *testing.T) {
 		t.Errorf("get(key1) after overwrite = %v, want %q", got, "new")
 	}
 }
+
+func TestCache_Generation(t *testing.T) {
+	c := newMemoryCache(time.Minute)
+	c.put("key1", "value1")
+	gen := c.generation()
+	if c.get("key1"); c.generation() != gen {
+		t.Fatal("generation changed on get/put")
+	}
+
+	c.invalidate("key1")
+	if c.generation() == gen {
+		t.Error("generation unchanged after invalidate")
+	}
+	gen = c.generation()
+	c.invalidatePrefix("key")
+	if c.generation() == gen {
+		t.Error("generation unchanged after invalidatePrefix")
+	}
+	gen = c.generation()
+	c.clear()
+	if c.generation() == gen {
+		t.Error("generation unchanged after clear")
+	}
+}
+
+func TestShardedCache(t *testing.T) {
+	c := newShardedCache(time.Minute, 1000)
+	c.put("a.policy.1", "p1")
+	c.put("a.policy.2", "p2")
+	c.put("b.policy.1", "p3")
+	if got := c.get("a.policy.1"); got != "p1" {
+		t.Errorf("get(a.policy.1) = %v, want p1", got)
+	}
+
+	gen := c.generation()
+	c.invalidatePrefix("a.")
+	if c.get("a.policy.1") != nil || c.get("a.policy.2") != nil || c.get("b.policy.1") != "p3" {
+		t.Error("invalidatePrefix(a.) removed the wrong entries")
+	}
+	c.invalidate("b.policy.1")
+	if c.get("b.policy.1") != nil {
+		t.Error("get(b.policy.1) after invalidate != nil")
+	}
+	if c.generation() != gen+2 {
+		t.Errorf("generation = %d, want %d", c.generation(), gen+2)
+	}
+}
+
+func TestShardedCache_Expiry(t *testing.T) {
+	c := newShardedCache(10*time.Millisecond, 1000)
+	c.put("key1", "value1")
+	time.Sleep(20 * time.Millisecond)
+	if got := c.get("key1"); got != nil {
+		t.Errorf("get(key1) after expiry = %v, want nil", got)
+	}
+}
+
+func TestShardedCache_Eviction(t *testing.T) {
+	const maxEntries = cacheShards * 4
+	c := newShardedCache(time.Minute, maxEntries)
+	c.put("hot", "value")
+	for i := range maxEntries * 10 {
+		c.put(fmt.Sprintf("key-%d", i), i)
+		c.get("hot")
+	}
+
+	n := 0
+	for i := range c.shards {
+		n += len(c.shards[i].entries)
+	}
+	if n > maxEntries {
+		t.Errorf("entries = %d, want at most %d", n, maxEntries)
+	}
+	if c.get("hot") != "value" {
+		t.Error("recently used entry was evicted")
+	}
+}
+
+func TestCacheConfig_Validate(t *testing.T) {
+	tests := []struct {
+		cfg     *CacheConfig
+		wantErr string
+	}{
+		{cfg: nil},
+		{cfg: &CacheConfig{Type: "sharded", MaxEntries: 1000}},
+		{cfg: &CacheConfig{Type: "redis", Redis: &RedisCacheConfig{Address: "redis:6379"}}},
+		{cfg: &CacheConfig{Type: "lru"}, wantErr: "unsupported cache type"},
+		{cfg: &CacheConfig{MaxEntries: -1}, wantErr: "maxEntries must not be negative"},
+		{cfg: &CacheConfig{Type: "redis"}, wantErr: "redis configuration is required"},
+		{cfg: &CacheConfig{Type: "redis", Redis: &RedisCacheConfig{Address: "redis"}}, wantErr: "redis: invalid address"},
+	}
+	for _, tt := range tests {
+		err := tt.cfg.Validate()
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("Validate(%+v) error = %v, want %q", tt.cfg, err, tt.wantErr)
+		}
+	}
+}
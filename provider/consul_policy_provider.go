@@ -0,0 +1,759 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/msimon/nauts/depstats"
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/policy"
+	"github.com/msimon/nauts/units"
+)
+
+const (
+	// DefaultConsulPrefix is the default key prefix of policies and bindings in Consul KV.
+	DefaultConsulPrefix = "nauts/"
+
+	// defaultConsulAddress is the address of the local Consul agent.
+	defaultConsulAddress = "http://127.0.0.1:8500"
+
+	// defaultConsulWaitTime is the default duration of blocking queries.
+	defaultConsulWaitTime = 5 * time.Minute
+
+	// maxConsulWaitTime is the longest blocking query Consul accepts.
+	maxConsulWaitTime = 10 * time.Minute
+
+	// consulRequestTimeout bounds each request to Consul except blocking queries.
+	consulRequestTimeout = 10 * time.Second
+)
+
+// ConsulPolicyProviderConfig holds configuration for ConsulPolicyProvider.
+// Empty connection fields fall back to the environment variables used by
+// the Consul CLI.
+type ConsulPolicyProviderConfig struct {
+	// Address is the Consul HTTP API URL. Default: $CONSUL_HTTP_ADDR, or
+	// "http://127.0.0.1:8500".
+	Address string `json:"address,omitempty"`
+
+	// TokenFile is the path to a file containing the ACL token. Default:
+	// $CONSUL_HTTP_TOKEN.
+	TokenFile string `json:"tokenFile,omitempty"`
+
+	// Datacenter is the datacenter to query. Default: the agent's.
+	Datacenter string `json:"datacenter,omitempty"`
+
+	// CACertFile is the path to a PEM CA bundle for the Consul server.
+	// Default: $CONSUL_CACERT.
+	CACertFile string `json:"caCertFile,omitempty"`
+
+	// Prefix is the key prefix under which policies and bindings are stored,
+	// with the keys of NatsPolicyProvider (e.g. "nauts/APP.policy.reader").
+	// Default: "nauts/".
+	Prefix string `json:"prefix,omitempty"`
+
+	// WaitTime is how long a blocking query watching the prefix waits for a
+	// change, as a duration string (at most "10m"). Default: "5m".
+	WaitTime string `json:"waitTime,omitempty"`
+
+	// CacheTTL is how long cached entries remain valid, as a duration string (e.g., "30s", "1m").
+	// Default: "30s".
+	CacheTTL string `json:"cacheTtl,omitempty"`
+
+	// Cache selects the cache backend. Nil uses an in-memory cache.
+	Cache *CacheConfig `json:"cache,omitempty"`
+}
+
+// GetCacheTTL returns the cache TTL as a time.Duration, defaulting to 30s.
+func (c *ConsulPolicyProviderConfig) GetCacheTTL() time.Duration {
+	if c.CacheTTL == "" {
+		return defaultCacheTTL
+	}
+	d, err := units.ParseDuration(c.CacheTTL)
+	if err != nil || d <= 0 {
+		return defaultCacheTTL
+	}
+	return d
+}
+
+// GetWaitTime returns the blocking query duration, defaulting to 5m.
+func (c *ConsulPolicyProviderConfig) GetWaitTime() time.Duration {
+	if c.WaitTime == "" {
+		return defaultConsulWaitTime
+	}
+	d, err := units.ParseDuration(c.WaitTime)
+	if err != nil || d <= 0 {
+		return defaultConsulWaitTime
+	}
+	return d
+}
+
+// GetPrefix returns the key prefix, defaulting to DefaultConsulPrefix. A
+// non-empty prefix always ends with "/".
+func (c *ConsulPolicyProviderConfig) GetPrefix() string {
+	if c.Prefix == "" {
+		return DefaultConsulPrefix
+	}
+	return strings.TrimSuffix(c.Prefix, "/") + "/"
+}
+
+// Validate checks the address, prefix, and durations of the configuration.
+func (c *ConsulPolicyProviderConfig) Validate() error {
+	if c.Address != "" {
+		if _, err := consulAddress(c.Address); err != nil {
+			return err
+		}
+	}
+	if strings.HasPrefix(c.Prefix, "/") {
+		return fmt.Errorf("prefix %q must not start with /", c.Prefix)
+	}
+	if c.WaitTime != "" {
+		if d, err := units.ParseDuration(c.WaitTime); err != nil || d <= 0 || d > maxConsulWaitTime {
+			return fmt.Errorf("invalid waitTime %q (must be positive and at most %s)", c.WaitTime, maxConsulWaitTime)
+		}
+	}
+	if c.CacheTTL != "" {
+		if d, err := units.ParseDuration(c.CacheTTL); err != nil || d <= 0 {
+			return fmt.Errorf("invalid cacheTtl %q", c.CacheTTL)
+		}
+	}
+	if err := c.Cache.Validate(); err != nil {
+		return fmt.Errorf("cache: %w", err)
+	}
+	return nil
+}
+
+// ConsulPolicyProvider implements PolicyStore using Consul KV. Keys below
+// the prefix follow the schema of NatsPolicyProvider:
+// <account>.policy.<id> and <account>.binding.<role>, with global policies
+// under the account "_global". Reads are cached; a blocking query on the
+// prefix invalidates the entries of changed keys.
+type ConsulPolicyProvider struct {
+	client *consulClient
+	prefix string
+	wait   time.Duration
+	cache  cache
+
+	cancel    context.CancelFunc
+	watchDone chan struct{}
+}
+
+// NewConsulPolicyProvider creates a ConsulPolicyProvider from the given
+// configuration and starts watching the prefix. It fails if Consul is
+// unreachable.
+func NewConsulPolicyProvider(cfg ConsulPolicyProviderConfig) (*ConsulPolicyProvider, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("consul policy provider: %w", err)
+	}
+	client, err := newConsulClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("consul policy provider: %w", err)
+	}
+
+	prefix := cfg.GetPrefix()
+	c, err := newProviderCache(cfg.Cache, cfg.GetCacheTTL(), "nauts:consul:"+prefix, decodeKVCacheEntry)
+	if err != nil {
+		return nil, fmt.Errorf("consul policy provider: %w", err)
+	}
+	p := &ConsulPolicyProvider{
+		client: client,
+		prefix: prefix,
+		wait:   cfg.GetWaitTime(),
+		cache:  c,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), consulRequestTimeout)
+	defer cancel()
+	index, modified, err := p.client.modifyIndexes(ctx, prefix, 0, 0)
+	if err != nil {
+		_ = c.close()
+		return nil, fmt.Errorf("consul policy provider: reading prefix %q: %w", prefix, err)
+	}
+
+	watchCtx, stop := context.WithCancel(context.Background())
+	p.cancel = stop
+	p.watchDone = make(chan struct{})
+	go p.watch(watchCtx, index, modified)
+	return p, nil
+}
+
+// Stop stops watching the prefix and closes the cache.
+func (p *ConsulPolicyProvider) Stop() error {
+	if p.cancel != nil {
+		p.cancel()
+		<-p.watchDone
+		p.cancel = nil
+	}
+	return p.cache.close()
+}
+
+// GetPolicy retrieves a policy by account and ID from Consul KV.
+// IDs starting with "builtin:" resolve to the built-in policy library.
+func (p *ConsulPolicyProvider) GetPolicy(ctx context.Context, account string, id string) (*policy.Policy, error) {
+	if policy.IsBuiltinID(id) {
+		return builtinPolicy(id)
+	}
+	key := kvPolicyKey(account, id)
+
+	if cached := p.cache.get(key); cached != nil {
+		return cached.(*policy.Policy), nil
+	}
+
+	data, err := p.client.get(ctx, p.prefix+key)
+	if err != nil {
+		if errors.Is(err, errConsulKeyNotFound) {
+			return nil, ErrPolicyNotFound
+		}
+		return nil, fmt.Errorf("fetching policy %s: %w", key, err)
+	}
+
+	var pol policy.Policy
+	if err := json.Unmarshal(data, &pol); err != nil {
+		return nil, fmt.Errorf("decoding policy %s: %w", key, err)
+	}
+	if err := pol.Validate(); err != nil {
+		return nil, fmt.Errorf("validating policy %s: %w", key, err)
+	}
+
+	p.cache.put(key, &pol)
+	return &pol, nil
+}
+
+// GetPoliciesForRole returns all policies attached to a role, including the
+// policies of the roles it inherits. Policy IDs prefixed with "_global:" are
+// looked up as global policies.
+func (p *ConsulPolicyProvider) GetPoliciesForRole(ctx context.Context, role identity.Role) ([]*policy.Policy, error) {
+	role.Name = strings.TrimSpace(role.Name)
+	if role.Name == "" {
+		return nil, ErrRoleNotFound
+	}
+	role.Account = strings.TrimSpace(role.Account)
+	if role.Account == "" {
+		return nil, ErrRoleNotFound
+	}
+
+	b, err := p.getBinding(ctx, role)
+	if err != nil {
+		return nil, err
+	}
+
+	policyIDs, err := bindingPolicyIDs(ctx, b, p.getBinding)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*policy.Policy, 0, len(policyIDs))
+	for _, id := range policyIDs {
+		policyAccount := role.Account
+		if strings.HasPrefix(id, globalAccountPrefix+":") {
+			id = strings.TrimPrefix(id, globalAccountPrefix+":")
+			policyAccount = globalAccountPrefix
+		}
+		pol, err := p.GetPolicy(ctx, policyAccount, id)
+		if err != nil {
+			if errors.Is(err, ErrPolicyNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		result = append(result, pol)
+	}
+	return result, nil
+}
+
+// GetPolicies returns all policies for the given account plus global policies, sorted by ID.
+func (p *ConsulPolicyProvider) GetPolicies(ctx context.Context, account string) ([]*policy.Policy, error) {
+	account = strings.TrimSpace(account)
+
+	keys, err := p.keys(ctx, account+".policy.")
+	if err != nil {
+		return nil, fmt.Errorf("listing policy keys: %w", err)
+	}
+	if account != globalAccountPrefix {
+		global, err := p.keys(ctx, globalAccountPrefix+".policy.")
+		if err != nil {
+			return nil, fmt.Errorf("listing policy keys: %w", err)
+		}
+		keys = append(keys, global...)
+	}
+
+	result, err := p.policies(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+// getBinding fetches a binding from the cache or Consul KV.
+func (p *ConsulPolicyProvider) getBinding(ctx context.Context, role identity.Role) (*Binding, error) {
+	key := kvBindingKey(role)
+
+	if cached := p.cache.get(key); cached != nil {
+		return cached.(*Binding), nil
+	}
+
+	data, err := p.client.get(ctx, p.prefix+key)
+	if err != nil {
+		if errors.Is(err, errConsulKeyNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, fmt.Errorf("fetching binding %s: %w", key, err)
+	}
+
+	var b Binding
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("decoding binding %s: %w", key, err)
+	}
+
+	p.cache.put(key, &b)
+	return &b, nil
+}
+
+// GetBinding retrieves the binding for an account-scoped role.
+func (p *ConsulPolicyProvider) GetBinding(ctx context.Context, role identity.Role) (*Binding, error) {
+	return p.getBinding(ctx, role)
+}
+
+// GetBindings returns all bindings for the given account, sorted by role.
+func (p *ConsulPolicyProvider) GetBindings(ctx context.Context, account string) ([]*Binding, error) {
+	keys, err := p.keys(ctx, strings.TrimSpace(account)+".binding.")
+	if err != nil {
+		return nil, fmt.Errorf("listing binding keys: %w", err)
+	}
+	return p.bindings(ctx, keys)
+}
+
+// ListPolicies returns the policies of all accounts, sorted by account and ID.
+func (p *ConsulPolicyProvider) ListPolicies(ctx context.Context) ([]*policy.Policy, error) {
+	keys, err := p.keys(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("listing policy keys: %w", err)
+	}
+	return p.policies(ctx, keys)
+}
+
+// ListBindings returns the bindings of all accounts, sorted by account and role.
+func (p *ConsulPolicyProvider) ListBindings(ctx context.Context) ([]*Binding, error) {
+	keys, err := p.keys(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("listing binding keys: %w", err)
+	}
+	return p.bindings(ctx, keys)
+}
+
+// keys returns the sorted keys below the prefix starting with start, without
+// the prefix.
+func (p *ConsulPolicyProvider) keys(ctx context.Context, start string) ([]string, error) {
+	keys, err := p.client.keys(ctx, p.prefix+start)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, strings.TrimPrefix(key, p.prefix))
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// policies fetches the policies of the policy keys among keys.
+func (p *ConsulPolicyProvider) policies(ctx context.Context, keys []string) ([]*policy.Policy, error) {
+	var result []*policy.Policy
+	for _, key := range keys {
+		acc, id, ok := parsePolicyKey(key)
+		if !ok {
+			continue
+		}
+		pol, err := p.GetPolicy(ctx, acc, id)
+		if err != nil {
+			if errors.Is(err, ErrPolicyNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		result = append(result, pol)
+	}
+	return result, nil
+}
+
+// bindings fetches the bindings of the binding keys among keys.
+func (p *ConsulPolicyProvider) bindings(ctx context.Context, keys []string) ([]*Binding, error) {
+	var result []*Binding
+	for _, key := range keys {
+		role, ok := parseBindingKey(key)
+		if !ok {
+			continue
+		}
+		b, err := p.getBinding(ctx, role)
+		if err != nil {
+			if errors.Is(err, ErrRoleNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		result = append(result, b)
+	}
+	return result, nil
+}
+
+// CheckHealth implements PolicyHealthChecker by asking Consul for its leader.
+func (p *ConsulPolicyProvider) CheckHealth(ctx context.Context) error {
+	if err := p.client.leader(ctx); err != nil {
+		return fmt.Errorf("consul unreachable: %w", err)
+	}
+	return nil
+}
+
+// PolicyVersion implements PolicyVersioner. The version changes with every
+// change seen by the blocking query and every write through the provider.
+func (p *ConsulPolicyProvider) PolicyVersion() uint64 {
+	return p.cache.generation()
+}
+
+// PutPolicy creates or replaces a policy in Consul KV.
+// Global policies (account "*" or "_global") are stored under the "_global" prefix.
+func (p *ConsulPolicyProvider) PutPolicy(ctx context.Context, pol *policy.Policy) error {
+	if pol == nil {
+		return errors.New("policy is nil")
+	}
+	if err := pol.Validate(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(pol)
+	if err != nil {
+		return fmt.Errorf("encoding policy %s: %w", pol.ID, err)
+	}
+
+	key := kvPolicyKey(kvAccount(pol.Account), pol.ID)
+	if err := p.client.put(ctx, p.prefix+key, data); err != nil {
+		return fmt.Errorf("putting policy %s: %w", key, err)
+	}
+	p.cache.invalidate(key)
+	return nil
+}
+
+// DeletePolicy removes a policy from Consul KV.
+func (p *ConsulPolicyProvider) DeletePolicy(ctx context.Context, account string, id string) error {
+	key := kvPolicyKey(kvAccount(account), id)
+	if err := p.client.delete(ctx, p.prefix+key); err != nil {
+		return fmt.Errorf("deleting policy %s: %w", key, err)
+	}
+	p.cache.invalidate(key)
+	return nil
+}
+
+// PutBinding creates or replaces a binding in Consul KV.
+func (p *ConsulPolicyProvider) PutBinding(ctx context.Context, b *Binding) error {
+	if b == nil {
+		return errors.New("binding is nil")
+	}
+	if err := b.Validate(); err != nil {
+		return err
+	}
+	if _, err := bindingPolicyIDs(ctx, b, lookupWithBinding(p.getBinding, b)); err != nil {
+		return err
+	}
+	data, err := json.Marshal(b)
+	if err != nil {
+		return fmt.Errorf("encoding binding %s: %w", b.IdentityRole(), err)
+	}
+
+	key := kvBindingKey(b.IdentityRole())
+	if err := p.client.put(ctx, p.prefix+key, data); err != nil {
+		return fmt.Errorf("putting binding %s: %w", key, err)
+	}
+	p.cache.invalidate(key)
+	return nil
+}
+
+// DeleteBinding removes a binding from Consul KV.
+func (p *ConsulPolicyProvider) DeleteBinding(ctx context.Context, role identity.Role) error {
+	key := kvBindingKey(role)
+	if err := p.client.delete(ctx, p.prefix+key); err != nil {
+		return fmt.Errorf("deleting binding %s: %w", key, err)
+	}
+	p.cache.invalidate(key)
+	return nil
+}
+
+// watch runs blocking queries on the prefix until ctx is cancelled and
+// invalidates the cache entries of keys whose modify index changed. After a
+// failed query, or if Consul reset its index, the whole cache is cleared,
+// since changes may have been missed.
+func (p *ConsulPolicyProvider) watch(ctx context.Context, index uint64, modified map[string]uint64) {
+	defer close(p.watchDone)
+	backoff := defaultWatchBackoff
+	reset := false
+	for {
+		next, current, err := p.client.modifyIndexes(ctx, p.prefix, index, p.wait)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("consul policy provider: watching prefix %q failed: %v", p.prefix, err)
+			reset = true
+			timer := time.NewTimer(jitter(backoff))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			backoff = min(backoff*2, defaultMaxWatchBackoff)
+			continue
+		}
+		backoff = defaultWatchBackoff
+
+		if reset || next < index {
+			p.cache.clear()
+			reset = false
+		} else {
+			for key, i := range current {
+				if modified[key] != i {
+					p.cache.invalidate(strings.TrimPrefix(key, p.prefix))
+				}
+			}
+			for key := range modified {
+				if _, ok := current[key]; !ok {
+					p.cache.invalidate(strings.TrimPrefix(key, p.prefix))
+				}
+			}
+		}
+		// Consul indexes are positive; 0 would make the next query return at once.
+		index = max(next, 1)
+		modified = current
+	}
+}
+
+// errConsulKeyNotFound is returned when a Consul key does not exist.
+var errConsulKeyNotFound = errors.New("key not found in consul")
+
+// consulClient reads and writes Consul KV through the HTTP API.
+type consulClient struct {
+	address    string
+	token      string
+	datacenter string
+	http       *http.Client
+	// blocking runs blocking queries, which are not recorded in depstats
+	// since they take up to the wait time by design.
+	blocking *http.Client
+}
+
+func newConsulClient(cfg ConsulPolicyProviderConfig) (*consulClient, error) {
+	address, err := consulAddress(firstNonEmpty(cfg.Address, os.Getenv("CONSUL_HTTP_ADDR"), defaultConsulAddress))
+	if err != nil {
+		return nil, err
+	}
+	token := os.Getenv("CONSUL_HTTP_TOKEN")
+	if cfg.TokenFile != "" {
+		data, err := os.ReadFile(cfg.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading consul token file: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caFile := firstNonEmpty(cfg.CACertFile, os.Getenv("CONSUL_CACERT")); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading consul CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("consul CA file %s contains no certificates", caFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	// Consul adds up to wait/16 of jitter to blocking queries.
+	wait := cfg.GetWaitTime()
+	return &consulClient{
+		address:    address,
+		token:      token,
+		datacenter: cfg.Datacenter,
+		// Request paths name policies; the address identifies the endpoint.
+		http:     depstats.Client(&http.Client{Transport: transport, Timeout: consulRequestTimeout}, depstats.DependencyConsul, address),
+		blocking: &http.Client{Transport: transport, Timeout: wait + wait/16 + consulRequestTimeout},
+	}, nil
+}
+
+// consulAddress returns the URL of a Consul address without trailing
+// slash. Addresses without scheme, as CONSUL_HTTP_ADDR is often given, use
+// http.
+func consulAddress(address string) (string, error) {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", fmt.Errorf("invalid consul address: %w", err)
+	}
+	if u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("invalid consul address %q", address)
+	}
+	return strings.TrimRight(address, "/"), nil
+}
+
+// do sends a request to the Consul API and returns the response body and
+// the X-Consul-Index header. A 404 response returns errConsulKeyNotFound
+// with the index.
+func (c *consulClient) do(ctx context.Context, client *http.Client, method, path string, query url.Values, body []byte) ([]byte, uint64, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	if c.datacenter != "" {
+		query.Set("dc", c.datacenter)
+	}
+	u := c.address + "/v1/" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, 0, err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("consul request %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return nil, 0, fmt.Errorf("reading consul response: %w", err)
+	}
+	index, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, index, errConsulKeyNotFound
+	}
+	if resp.StatusCode >= 300 {
+		if msg := strings.TrimSpace(string(data)); msg != "" {
+			return nil, 0, fmt.Errorf("consul request %s %s: %s: %s", method, path, resp.Status, msg)
+		}
+		return nil, 0, fmt.Errorf("consul request %s %s: %s", method, path, resp.Status)
+	}
+	return data, index, nil
+}
+
+// kvPath returns the API path of a key, with each segment escaped.
+func kvPath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return "kv/" + strings.Join(segments, "/")
+}
+
+// get returns the raw value of key.
+func (c *consulClient) get(ctx context.Context, key string) ([]byte, error) {
+	data, _, err := c.do(ctx, c.http, http.MethodGet, kvPath(key), url.Values{"raw": {""}}, nil)
+	return data, err
+}
+
+// keys returns the keys starting with prefix. No keys is not an error.
+func (c *consulClient) keys(ctx context.Context, prefix string) ([]string, error) {
+	data, _, err := c.do(ctx, c.http, http.MethodGet, kvPath(prefix), url.Values{"keys": {""}}, nil)
+	if errors.Is(err, errConsulKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("decoding consul keys: %w", err)
+	}
+	return keys, nil
+}
+
+// modifyIndexes returns the index of prefix and the modify index of every
+// key below it. With a positive index, it blocks until the index changes or
+// wait elapsed.
+func (c *consulClient) modifyIndexes(ctx context.Context, prefix string, index uint64, wait time.Duration) (uint64, map[string]uint64, error) {
+	query := url.Values{"recurse": {""}}
+	client := c.http
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", strconv.FormatInt(wait.Milliseconds(), 10)+"ms")
+		client = c.blocking
+	}
+	data, next, err := c.do(ctx, client, http.MethodGet, kvPath(prefix), query, nil)
+	if errors.Is(err, errConsulKeyNotFound) {
+		return next, map[string]uint64{}, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	var entries []struct {
+		Key         string `json:"Key"`
+		ModifyIndex uint64 `json:"ModifyIndex"`
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return 0, nil, fmt.Errorf("decoding consul entries: %w", err)
+	}
+	modified := make(map[string]uint64, len(entries))
+	for _, e := range entries {
+		modified[e.Key] = e.ModifyIndex
+	}
+	return next, modified, nil
+}
+
+// put sets key to value.
+func (c *consulClient) put(ctx context.Context, key string, value []byte) error {
+	data, _, err := c.do(ctx, c.http, http.MethodPut, kvPath(key), nil, value)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(data)) != "true" {
+		return fmt.Errorf("consul rejected the write of %s", key)
+	}
+	return nil
+}
+
+// delete removes key. Deleting a missing key is not an error.
+func (c *consulClient) delete(ctx context.Context, key string) error {
+	_, _, err := c.do(ctx, c.http, http.MethodDelete, kvPath(key), nil, nil)
+	if errors.Is(err, errConsulKeyNotFound) {
+		return nil
+	}
+	return err
+}
+
+// leader returns an error if Consul is unreachable or has no leader.
+func (c *consulClient) leader(ctx context.Context) error {
+	data, _, err := c.do(ctx, c.http, http.MethodGet, "status/leader", nil, nil)
+	if err != nil {
+		return err
+	}
+	var leader string
+	if err := json.Unmarshal(data, &leader); err != nil {
+		return fmt.Errorf("decoding consul leader: %w", err)
+	}
+	if leader == "" {
+		return errors.New("no cluster leader")
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/policy"
+)
+
+// fakeConsul implements the parts of the Consul KV HTTP API used by
+// ConsulPolicyProvider, including blocking queries.
+type fakeConsul struct {
+	mu       sync.Mutex
+	index    uint64
+	values   map[string][]byte
+	modified map[string]uint64
+	changed  chan struct{} // closed and replaced on every write
+	token    string
+}
+
+func newFakeConsul(t *testing.T) (*fakeConsul, *httptest.Server) {
+	t.Helper()
+	f := &fakeConsul{index: 1, values: map[string][]byte{}, modified: map[string]uint64{}, changed: make(chan struct{})}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+// set writes a key directly, like another Consul client would.
+func (f *fakeConsul) set(key string, value []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.index++
+	if value == nil {
+		delete(f.values, key)
+		delete(f.modified, key)
+	} else {
+		f.values[key] = value
+		f.modified[key] = f.index
+	}
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.token != "" && r.Header.Get("X-Consul-Token") != f.token {
+		http.Error(w, "ACL not found", http.StatusForbidden)
+		return
+	}
+	if r.URL.Path == "/v1/status/leader" {
+		_, _ = io.WriteString(w, `"10.0.0.1:8300"`)
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/v1/kv/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	query := r.URL.Query()
+
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		f.set(key, data)
+		_, _ = io.WriteString(w, "true")
+		return
+	case http.MethodDelete:
+		f.set(key, nil)
+		_, _ = io.WriteString(w, "true")
+		return
+	}
+
+	f.mu.Lock()
+	if index, _ := strconv.ParseUint(query.Get("index"), 10, 64); index > 0 && index >= f.index {
+		changed := f.changed
+		f.mu.Unlock()
+		wait, _ := time.ParseDuration(query.Get("wait"))
+		select {
+		case <-changed:
+		case <-time.After(wait):
+		case <-r.Context().Done():
+			return
+		}
+		f.mu.Lock()
+	}
+	defer f.mu.Unlock()
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+
+	if query.Has("raw") {
+		value, ok := f.values[key]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(value)
+		return
+	}
+	type entry struct {
+		Key         string
+		ModifyIndex uint64
+	}
+	var keys []string
+	var entries []entry
+	for k, i := range f.modified {
+		if strings.HasPrefix(k, key) {
+			keys = append(keys, k)
+			entries = append(entries, entry{k, i})
+		}
+	}
+	if len(keys) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	sort.Strings(keys)
+	if query.Has("keys") {
+		_ = json.NewEncoder(w).Encode(keys)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(entries)
+}
+
+func newTestConsulPolicyProvider(t *testing.T, srv *httptest.Server) *ConsulPolicyProvider {
+	t.Helper()
+	p, err := NewConsulPolicyProvider(ConsulPolicyProviderConfig{Address: srv.URL, Prefix: "nauts/test", WaitTime: "1s"})
+	if err != nil {
+		t.Fatalf("NewConsulPolicyProvider() error = %v", err)
+	}
+	t.Cleanup(func() { _ = p.Stop() })
+	return p
+}
+
+func TestConsulPolicyProvider_ReadWrite(t *testing.T) {
+	fake, srv := newFakeConsul(t)
+	p := newTestConsulPolicyProvider(t, srv)
+	ctx := context.Background()
+
+	policies := []*policy.Policy{
+		{ID: "reader", Account: "APP", Name: "Reader", Statements: []policy.Statement{
+			{Effect: policy.EffectAllow, Actions: []policy.Action{policy.ActionNATSSub}, Resources: []string{"nats:app.>"}},
+		}},
+		{ID: "base", Account: "*", Name: "Base", Statements: []policy.Statement{
+			{Effect: policy.EffectAllow, Actions: []policy.Action{policy.ActionNATSPub}, Resources: []string{"nats:base"}},
+		}},
+	}
+	for _, pol := range policies {
+		if err := p.PutPolicy(ctx, pol); err != nil {
+			t.Fatalf("PutPolicy(%s) error = %v", pol.ID, err)
+		}
+	}
+	bindings := []*Binding{
+		{Role: "viewer", Account: "APP", Policies: []string{"reader", "_global:base", "missing"}},
+		{Role: "editor", Account: "APP", Inherits: []string{"viewer"}},
+	}
+	for _, b := range bindings {
+		if err := p.PutBinding(ctx, b); err != nil {
+			t.Fatalf("PutBinding(%s) error = %v", b.Role, err)
+		}
+	}
+	if _, ok := fake.values["nauts/test/APP.policy.reader"]; !ok {
+		t.Errorf("keys = %v, want the key schema of the NATS provider below the prefix", fake.modified)
+	}
+	if _, ok := fake.values["nauts/test/_global.policy.base"]; !ok {
+		t.Error("global policy not stored under _global")
+	}
+
+	got, err := p.GetPoliciesForRole(ctx, identity.Role{Account: "APP", Name: "editor"})
+	if err != nil {
+		t.Fatalf("GetPoliciesForRole() error = %v", err)
+	}
+	if len(got) != 2 || got[0].ID != "base" || got[1].ID != "reader" {
+		t.Errorf("GetPoliciesForRole() = %v, want base and reader", got)
+	}
+	if _, err := p.GetPoliciesForRole(ctx, identity.Role{Account: "APP", Name: "admin"}); !errors.Is(err, ErrRoleNotFound) {
+		t.Errorf("GetPoliciesForRole(admin) error = %v, want ErrRoleNotFound", err)
+	}
+	if _, err := p.GetPolicy(ctx, "APP", "missing"); !errors.Is(err, ErrPolicyNotFound) {
+		t.Errorf("GetPolicy(missing) error = %v, want ErrPolicyNotFound", err)
+	}
+
+	all, err := p.GetPolicies(ctx, "APP")
+	if err != nil || len(all) != 2 {
+		t.Errorf("GetPolicies(APP) = %v, %v; want 2 policies", all, err)
+	}
+	listed, err := p.ListPolicies(ctx)
+	if err != nil || len(listed) != 2 {
+		t.Errorf("ListPolicies() = %v, %v; want 2 policies", listed, err)
+	}
+	appBindings, err := p.GetBindings(ctx, "APP")
+	if err != nil || len(appBindings) != 2 || appBindings[0].Role != "editor" {
+		t.Errorf("GetBindings(APP) = %v, %v; want editor and viewer", appBindings, err)
+	}
+
+	// A cycle is rejected before it is written.
+	cycle := &Binding{Role: "viewer", Account: "APP", Inherits: []string{"editor"}}
+	if err := p.PutBinding(ctx, cycle); !errors.Is(err, ErrRoleInheritanceCycle) {
+		t.Errorf("PutBinding(cycle) error = %v, want ErrRoleInheritanceCycle", err)
+	}
+
+	if err := p.DeletePolicy(ctx, "*", "base"); err != nil {
+		t.Fatalf("DeletePolicy() error = %v", err)
+	}
+	if err := p.DeletePolicy(ctx, "*", "base"); err != nil {
+		t.Errorf("DeletePolicy(missing) error = %v", err)
+	}
+	if err := p.DeleteBinding(ctx, identity.Role{Account: "APP", Name: "editor"}); err != nil {
+		t.Fatalf("DeleteBinding() error = %v", err)
+	}
+	if _, err := p.GetBinding(ctx, identity.Role{Account: "APP", Name: "editor"}); !errors.Is(err, ErrRoleNotFound) {
+		t.Errorf("GetBinding(deleted) error = %v, want ErrRoleNotFound", err)
+	}
+	if err := p.CheckHealth(ctx); err != nil {
+		t.Errorf("CheckHealth() error = %v", err)
+	}
+}
+
+func TestConsulPolicyProvider_WatchInvalidatesCache(t *testing.T) {
+	fake, srv := newFakeConsul(t)
+	p := newTestConsulPolicyProvider(t, srv)
+	ctx := context.Background()
+
+	write := func(subject string) {
+		data, _ := json.Marshal(&policy.Policy{ID: "reader", Account: "APP", Name: "Reader", Statements: []policy.Statement{
+			{Effect: policy.EffectAllow, Actions: []policy.Action{policy.ActionNATSSub}, Resources: []string{"nats:" + subject}},
+		}})
+		fake.set("nauts/test/APP.policy.reader", data)
+	}
+	write("one")
+	// Let the watcher see the first write before caching the policy.
+	waitForVersion(t, p, 0)
+	pol, err := p.GetPolicy(ctx, "APP", "reader")
+	if err != nil || pol.Statements[0].Resources[0] != "nats:one" {
+		t.Fatalf("GetPolicy() = %v, %v", pol, err)
+	}
+
+	version := p.PolicyVersion()
+	write("two")
+	waitForVersion(t, p, version)
+	pol, err = p.GetPolicy(ctx, "APP", "reader")
+	if err != nil || pol.Statements[0].Resources[0] != "nats:two" {
+		t.Errorf("GetPolicy() after a direct write = %v, %v; want the new policy", pol, err)
+	}
+
+	version = p.PolicyVersion()
+	fake.set("nauts/test/APP.policy.reader", nil)
+	waitForVersion(t, p, version)
+	if _, err := p.GetPolicy(ctx, "APP", "reader"); !errors.Is(err, ErrPolicyNotFound) {
+		t.Errorf("GetPolicy() after a direct delete error = %v, want ErrPolicyNotFound", err)
+	}
+}
+
+// waitForVersion waits until the policy version of p differs from version.
+func waitForVersion(t *testing.T, p *ConsulPolicyProvider, version uint64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for p.PolicyVersion() == version {
+		if time.Now().After(deadline) {
+			t.Fatal("the watcher did not invalidate the cache")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestConsulPolicyProvider_Token(t *testing.T) {
+	fake, srv := newFakeConsul(t)
+	fake.token = "secret"
+	if _, err := NewConsulPolicyProvider(ConsulPolicyProviderConfig{Address: srv.URL}); err == nil {
+		t.Error("NewConsulPolicyProvider() without token succeeded")
+	}
+	t.Setenv("CONSUL_HTTP_TOKEN", "secret")
+	p, err := NewConsulPolicyProvider(ConsulPolicyProviderConfig{Address: srv.URL})
+	if err != nil {
+		t.Fatalf("NewConsulPolicyProvider() error = %v", err)
+	}
+	_ = p.Stop()
+}
+
+func TestConsulPolicyProviderConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     ConsulPolicyProviderConfig
+		wantErr bool
+	}{
+		{"empty", ConsulPolicyProviderConfig{}, false},
+		{"full", ConsulPolicyProviderConfig{Address: "https://consul:8501", Prefix: "nauts/prod/", WaitTime: "10m", CacheTTL: "1m"}, false},
+		{"invalid address", ConsulPolicyProviderConfig{Address: "consul:8500 x"}, true},
+		{"absolute prefix", ConsulPolicyProviderConfig{Prefix: "/nauts"}, true},
+		{"wait too long", ConsulPolicyProviderConfig{WaitTime: "11m"}, true},
+		{"invalid cache ttl", ConsulPolicyProviderConfig{CacheTTL: "soon"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if got := (&ConsulPolicyProviderConfig{}).GetPrefix(); got != DefaultConsulPrefix {
+		t.Errorf("GetPrefix() = %q, want %q", got, DefaultConsulPrefix)
+	}
+	if got := (&ConsulPolicyProviderConfig{Prefix: "nauts/prod"}).GetPrefix(); got != "nauts/prod/" {
+		t.Errorf("GetPrefix() = %q, want nauts/prod/", got)
+	}
+}
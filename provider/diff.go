@@ -0,0 +1,205 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/msimon/nauts/policy"
+)
+
+// DiffKind classifies a difference between two policy stores.
+type DiffKind string
+
+const (
+	// DiffMissing means the entry exists in the source but not in the target.
+	DiffMissing DiffKind = "missing"
+	// DiffExtra means the entry exists in the target but not in the source.
+	DiffExtra DiffKind = "extra"
+	// DiffChanged means the entry exists in both stores with different content.
+	DiffChanged DiffKind = "changed"
+)
+
+// Entry types reported in a DiffEntry.
+const (
+	DiffEntryPolicy  = "policy"
+	DiffEntryBinding = "binding"
+)
+
+// DiffEntry describes a single policy or binding that differs between two stores.
+type DiffEntry struct {
+	Kind DiffKind `json:"kind"`
+	// Type is "policy" or "binding".
+	Type    string `json:"type"`
+	Account string `json:"account"`
+	// Name is the policy ID or the binding role.
+	Name string `json:"name"`
+
+	SourcePolicy  *policy.Policy `json:"sourcePolicy,omitempty"`
+	TargetPolicy  *policy.Policy `json:"targetPolicy,omitempty"`
+	SourceBinding *Binding       `json:"sourceBinding,omitempty"`
+	TargetBinding *Binding       `json:"targetBinding,omitempty"`
+}
+
+func (e DiffEntry) String() string {
+	return fmt.Sprintf("%s %s %s.%s", e.Kind, e.Type, e.Account, e.Name)
+}
+
+// StoreDiff is the result of comparing two policy stores.
+type StoreDiff struct {
+	Entries []DiffEntry `json:"entries"`
+}
+
+// IsEmpty returns true if both stores have the same contents.
+func (d *StoreDiff) IsEmpty() bool {
+	return len(d.Entries) == 0
+}
+
+// DiffPolicyStores compares the policies and bindings of source and target.
+//
+// Entries are keyed by (account, id) for policies and (account, role) for bindings.
+// The global account is normalized ("*" and "_global" are equivalent), and binding
+// policy lists are compared as sets. Entries are sorted by type, account, and name.
+func DiffPolicyStores(ctx context.Context, source, target PolicyStore) (*StoreDiff, error) {
+	diff := &StoreDiff{Entries: []DiffEntry{}}
+
+	srcPolicies, err := policiesByKey(ctx, source)
+	if err != nil {
+		return nil, fmt.Errorf("listing source policies: %w", err)
+	}
+	dstPolicies, err := policiesByKey(ctx, target)
+	if err != nil {
+		return nil, fmt.Errorf("listing target policies: %w", err)
+	}
+	for key, src := range srcPolicies {
+		dst, ok := dstPolicies[key]
+		switch {
+		case !ok:
+			diff.Entries = append(diff.Entries, DiffEntry{Kind: DiffMissing, Type: DiffEntryPolicy, Account: key.account, Name: key.name, SourcePolicy: src})
+		case !policiesEqual(src, dst):
+			diff.Entries = append(diff.Entries, DiffEntry{Kind: DiffChanged, Type: DiffEntryPolicy, Account: key.account, Name: key.name, SourcePolicy: src, TargetPolicy: dst})
+		}
+	}
+	for key, dst := range dstPolicies {
+		if _, ok := srcPolicies[key]; !ok {
+			diff.Entries = append(diff.Entries, DiffEntry{Kind: DiffExtra, Type: DiffEntryPolicy, Account: key.account, Name: key.name, TargetPolicy: dst})
+		}
+	}
+
+	srcBindings, err := bindingsByKey(ctx, source)
+	if err != nil {
+		return nil, fmt.Errorf("listing source bindings: %w", err)
+	}
+	dstBindings, err := bindingsByKey(ctx, target)
+	if err != nil {
+		return nil, fmt.Errorf("listing target bindings: %w", err)
+	}
+	for key, src := range srcBindings {
+		dst, ok := dstBindings[key]
+		switch {
+		case !ok:
+			diff.Entries = append(diff.Entries, DiffEntry{Kind: DiffMissing, Type: DiffEntryBinding, Account: key.account, Name: key.name, SourceBinding: src})
+		case !bindingsEqual(src, dst):
+			diff.Entries = append(diff.Entries, DiffEntry{Kind: DiffChanged, Type: DiffEntryBinding, Account: key.account, Name: key.name, SourceBinding: src, TargetBinding: dst})
+		}
+	}
+	for key, dst := range dstBindings {
+		if _, ok := srcBindings[key]; !ok {
+			diff.Entries = append(diff.Entries, DiffEntry{Kind: DiffExtra, Type: DiffEntryBinding, Account: key.account, Name: key.name, TargetBinding: dst})
+		}
+	}
+
+	sort.Slice(diff.Entries, func(i, j int) bool {
+		a, b := diff.Entries[i], diff.Entries[j]
+		if a.Type != b.Type {
+			return a.Type > b.Type // policies before bindings
+		}
+		if a.Account != b.Account {
+			return a.Account < b.Account
+		}
+		return a.Name < b.Name
+	})
+	return diff, nil
+}
+
+type storeKey struct {
+	account string
+	name    string
+}
+
+func policiesByKey(ctx context.Context, store PolicyStore) (map[storeKey]*policy.Policy, error) {
+	policies, err := store.ListPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[storeKey]*policy.Policy, len(policies))
+	for _, p := range policies {
+		if p == nil {
+			continue
+		}
+		result[storeKey{account: kvAccount(p.Account), name: p.ID}] = p
+	}
+	return result, nil
+}
+
+func bindingsByKey(ctx context.Context, store PolicyStore) (map[storeKey]*Binding, error) {
+	bindings, err := store.ListBindings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[storeKey]*Binding, len(bindings))
+	for _, b := range bindings {
+		if b == nil {
+			continue
+		}
+		result[storeKey{account: b.Account, name: b.Role}] = b
+	}
+	return result, nil
+}
+
+// policiesEqual compares two policies by content, treating "*" and "_global" as the same account.
+func policiesEqual(a, b *policy.Policy) bool {
+	ca, cb := *a, *b
+	ca.Account = kvAccount(ca.Account)
+	cb.Account = kvAccount(cb.Account)
+	ja, errA := json.Marshal(ca)
+	jb, errB := json.Marshal(cb)
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
+
+// bindingsEqual compares two bindings, treating the policy and inherited
+// role lists as sets.
+func bindingsEqual(a, b *Binding) bool {
+	if a.Account != b.Account || a.Role != b.Role || a.TTL != b.TTL || a.MaxTTL != b.MaxTTL {
+		return false
+	}
+	if !expiresAtEqual(a.ExpiresAt, b.ExpiresAt) {
+		return false
+	}
+	return policySetKey(a.Policies) == policySetKey(b.Policies) && policySetKey(a.Inherits) == policySetKey(b.Inherits)
+}
+
+// expiresAtEqual compares two optional expiration times by instant, so that
+// the same time in different zones is equal.
+func expiresAtEqual(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func policySetKey(ids []string) string {
+	set := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+	sorted := make([]string, 0, len(set))
+	for id := range set {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+	data, _ := json.Marshal(sorted)
+	return string(data)
+}
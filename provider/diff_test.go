@@ -0,0 +1,132 @@
+package provider
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/msimon/nauts/policy"
+)
+
+func newTestFileStore(t *testing.T, policies, bindings string) *FilePolicyProvider {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := FilePolicyProviderConfig{
+		PoliciesPath: filepath.Join(dir, "policies.json"),
+		BindingsPath: filepath.Join(dir, "bindings.json"),
+	}
+	if err := os.WriteFile(cfg.PoliciesPath, []byte(policies), 0644); err != nil {
+		t.Fatalf("writing policies: %v", err)
+	}
+	if err := os.WriteFile(cfg.BindingsPath, []byte(bindings), 0644); err != nil {
+		t.Fatalf("writing bindings: %v", err)
+	}
+	fp, err := NewFilePolicyProvider(cfg)
+	if err != nil {
+		t.Fatalf("NewFilePolicyProvider() error = %v", err)
+	}
+	return fp
+}
+
+func TestDiffPolicyStores(t *testing.T) {
+	source := newTestFileStore(t, `[
+		{"id": "same", "account": "APP", "name": "same", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:a"]}]},
+		{"id": "changed", "account": "APP", "name": "changed", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:a"]}]},
+		{"id": "missing", "account": "APP", "name": "missing", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:a"]}]},
+		{"id": "base", "account": "*", "name": "base", "statements": [{"effect": "allow", "actions": ["nats.sub"], "resources": ["nats:_INBOX.>"]}]}
+	]`, `[
+		{"role": "admin", "account": "APP", "policies": ["same", "changed"]},
+		{"role": "reader", "account": "APP", "policies": ["same"]}
+	]`)
+	target := newTestFileStore(t, `[
+		{"id": "same", "account": "APP", "name": "same", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:a"]}]},
+		{"id": "changed", "account": "APP", "name": "changed", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:b"]}]},
+		{"id": "extra", "account": "APP", "name": "extra", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:a"]}]},
+		{"id": "base", "account": "_global", "name": "base", "statements": [{"effect": "allow", "actions": ["nats.sub"], "resources": ["nats:_INBOX.>"]}]}
+	]`, `[
+		{"role": "admin", "account": "APP", "policies": ["changed", "same", "same"]},
+		{"role": "reader", "account": "APP", "policies": ["extra"]},
+		{"role": "ops", "account": "APP", "policies": ["same"]}
+	]`)
+
+	diff, err := DiffPolicyStores(context.Background(), source, target)
+	if err != nil {
+		t.Fatalf("DiffPolicyStores() error = %v", err)
+	}
+
+	want := []string{
+		"changed policy APP.changed",
+		"extra policy APP.extra",
+		"missing policy APP.missing",
+		"extra binding APP.ops",
+		"changed binding APP.reader",
+	}
+	if len(diff.Entries) != len(want) {
+		t.Fatalf("got %d entries %v, want %d", len(diff.Entries), diff.Entries, len(want))
+	}
+	for i, w := range want {
+		if got := diff.Entries[i].String(); got != w {
+			t.Errorf("entry[%d] = %q, want %q", i, got, w)
+		}
+	}
+
+	changed := diff.Entries[0]
+	if changed.SourcePolicy == nil || changed.TargetPolicy == nil {
+		t.Errorf("changed entry should carry both sides: %+v", changed)
+	}
+}
+
+func TestDiffPolicyStores_Identical(t *testing.T) {
+	policies := `[{"id": "p1", "account": "APP", "name": "p1", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:a"]}]}]`
+	bindings := `[{"role": "admin", "account": "APP", "policies": ["p1"]}]`
+
+	diff, err := DiffPolicyStores(context.Background(), newTestFileStore(t, policies, bindings), newTestFileStore(t, policies, bindings))
+	if err != nil {
+		t.Fatalf("DiffPolicyStores() error = %v", err)
+	}
+	if !diff.IsEmpty() {
+		t.Errorf("expected empty diff, got %v", diff.Entries)
+	}
+}
+
+func TestDiffPolicyStores_BindingExpiry(t *testing.T) {
+	policies := `[{"id": "p1", "account": "APP", "name": "p1", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:a"]}]}]`
+	source := newTestFileStore(t, policies, `[
+		{"role": "added", "account": "APP", "policies": ["p1"], "expiresAt": "2030-01-01T00:00:00Z"},
+		{"role": "changed", "account": "APP", "policies": ["p1"], "expiresAt": "2030-01-01T00:00:00Z"},
+		{"role": "removed", "account": "APP", "policies": ["p1"]},
+		{"role": "same", "account": "APP", "policies": ["p1"], "expiresAt": "2030-01-01T00:00:00Z"}
+	]`)
+	target := newTestFileStore(t, policies, `[
+		{"role": "added", "account": "APP", "policies": ["p1"]},
+		{"role": "changed", "account": "APP", "policies": ["p1"], "expiresAt": "2031-01-01T00:00:00Z"},
+		{"role": "removed", "account": "APP", "policies": ["p1"], "expiresAt": "2030-01-01T00:00:00Z"},
+		{"role": "same", "account": "APP", "policies": ["p1"], "expiresAt": "2030-01-01T01:00:00+01:00"}
+	]`)
+
+	diff, err := DiffPolicyStores(context.Background(), source, target)
+	if err != nil {
+		t.Fatalf("DiffPolicyStores() error = %v", err)
+	}
+	want := []string{"changed binding APP.added", "changed binding APP.changed", "changed binding APP.removed"}
+	if len(diff.Entries) != len(want) {
+		t.Fatalf("got %d entries %v, want %d", len(diff.Entries), diff.Entries, len(want))
+	}
+	for i, w := range want {
+		if got := diff.Entries[i].String(); got != w {
+			t.Errorf("entry[%d] = %q, want %q", i, got, w)
+		}
+	}
+}
+
+func TestPoliciesEqual_GlobalAccount(t *testing.T) {
+	a := &policy.Policy{ID: "p", Account: "*", Name: "p"}
+	b := &policy.Policy{ID: "p", Account: "_global", Name: "p"}
+	if !policiesEqual(a, b) {
+		t.Error("policies with '*' and '_global' account should be equal")
+	}
+	if a.Account != "*" {
+		t.Error("policiesEqual must not modify its arguments")
+	}
+}
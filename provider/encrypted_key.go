@@ -0,0 +1,132 @@
+package provider
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// KeyPassphraseEnv is the environment variable holding the passphrase of
+// encrypted seed files.
+const KeyPassphraseEnv = "NAUTS_KEY_PASSPHRASE"
+
+// encryptedSeedType is the PEM block type of encrypted seed files.
+const encryptedSeedType = "NAUTS ENCRYPTED SEED"
+
+// Argon2id parameters deriving the AES-256 key of encrypted seeds from the
+// passphrase. Decryption reads them from the file, so they can be raised
+// without breaking existing files.
+const (
+	seedKDFMemory      = 64 * 1024 // KiB
+	seedKDFPasses      = 3
+	seedKDFParallelism = 4
+	seedKDFSaltLength  = 16
+)
+
+// ErrEncryptedSeed is returned for encrypted seeds that cannot be decrypted,
+// because the passphrase is missing or wrong or the file is corrupt.
+var ErrEncryptedSeed = errors.New("cannot decrypt encrypted seed")
+
+// EncryptSeed encrypts an nkey seed with AES-256-GCM under a key derived from
+// passphrase with Argon2id. The result is a PEM block that seed files may
+// hold instead of the plain seed.
+func EncryptSeed(seed, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase is required")
+	}
+	salt := make([]byte, seedKDFSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("generating salt: %w", err)
+	}
+	params := fmt.Sprintf("m=%d,t=%d,p=%d", seedKDFMemory, seedKDFPasses, seedKDFParallelism)
+	aead, err := seedCipher(passphrase, salt, seedKDFMemory, seedKDFPasses, seedKDFParallelism)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generating nonce: %w", err)
+	}
+	block := &pem.Block{
+		Type: encryptedSeedType,
+		Headers: map[string]string{
+			"KDF":        "argon2id",
+			"KDF-Params": params,
+			"Salt":       base64.RawStdEncoding.EncodeToString(salt),
+		},
+	}
+	// The KDF parameters are authenticated, so they cannot be altered.
+	block.Bytes = aead.Seal(nonce, nonce, bytes.TrimSpace(seed), []byte(params))
+	return pem.EncodeToMemory(block), nil
+}
+
+// IsEncryptedSeed reports whether data is a seed encrypted by EncryptSeed.
+func IsEncryptedSeed(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN "+encryptedSeedType+"-----"))
+}
+
+// DecryptSeed decrypts a seed encrypted by EncryptSeed with passphrase.
+func DecryptSeed(data, passphrase []byte) ([]byte, error) {
+	block, _ := pem.Decode(bytes.TrimSpace(data))
+	if block == nil || block.Type != encryptedSeedType {
+		return nil, fmt.Errorf("%w: not an encrypted seed", ErrEncryptedSeed)
+	}
+	if block.Headers["KDF"] != "argon2id" {
+		return nil, fmt.Errorf("%w: unsupported KDF %q", ErrEncryptedSeed, block.Headers["KDF"])
+	}
+	params := block.Headers["KDF-Params"]
+	var memory, passes uint32
+	var parallelism uint8
+	// argon2.IDKey panics without passes or lanes.
+	if _, err := fmt.Sscanf(params, "m=%d,t=%d,p=%d", &memory, &passes, &parallelism); err != nil || passes == 0 || parallelism == 0 {
+		return nil, fmt.Errorf("%w: invalid KDF parameters %q", ErrEncryptedSeed, params)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(block.Headers["Salt"])
+	if err != nil || len(salt) == 0 {
+		return nil, fmt.Errorf("%w: invalid salt", ErrEncryptedSeed)
+	}
+	aead, err := seedCipher(passphrase, salt, memory, passes, parallelism)
+	if err != nil {
+		return nil, err
+	}
+	if len(block.Bytes) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: truncated ciphertext", ErrEncryptedSeed)
+	}
+	nonce, ciphertext := block.Bytes[:aead.NonceSize()], block.Bytes[aead.NonceSize():]
+	seed, err := aead.Open(nil, nonce, ciphertext, []byte(params))
+	if err != nil {
+		return nil, fmt.Errorf("%w: wrong passphrase or corrupt file", ErrEncryptedSeed)
+	}
+	return seed, nil
+}
+
+// ResolveSeed returns data unchanged unless it is an encrypted seed, which is
+// decrypted with the passphrase from $NAUTS_KEY_PASSPHRASE.
+func ResolveSeed(data []byte) ([]byte, error) {
+	if !IsEncryptedSeed(data) {
+		return data, nil
+	}
+	passphrase := os.Getenv(KeyPassphraseEnv)
+	if passphrase == "" {
+		return nil, fmt.Errorf("%w: %s is not set", ErrEncryptedSeed, KeyPassphraseEnv)
+	}
+	return DecryptSeed(data, []byte(passphrase))
+}
+
+// seedCipher returns the AES-256-GCM cipher keyed by passphrase.
+func seedCipher(passphrase, salt []byte, memory, passes uint32, parallelism uint8) (cipher.AEAD, error) {
+	key := argon2.IDKey(passphrase, salt, passes, memory, parallelism, 32)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
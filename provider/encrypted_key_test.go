@@ -0,0 +1,94 @@
+package provider
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptSeed_RoundTrip(t *testing.T) {
+	seed := "SAANJIBNEKGCRUWJCPIWUXFBFJLR36FJTFKGBGKAT7AQXH2LVFNQWZJMQU"
+	encrypted, err := EncryptSeed([]byte(seed+"\n"), []byte("secret"))
+	if err != nil {
+		t.Fatalf("EncryptSeed() error = %v", err)
+	}
+	if !IsEncryptedSeed(encrypted) {
+		t.Fatal("IsEncryptedSeed() = false for an encrypted seed")
+	}
+	if IsEncryptedSeed([]byte(seed)) {
+		t.Fatal("IsEncryptedSeed() = true for a plain seed")
+	}
+
+	got, err := DecryptSeed(encrypted, []byte("secret"))
+	if err != nil {
+		t.Fatalf("DecryptSeed() error = %v", err)
+	}
+	if string(got) != seed {
+		t.Errorf("DecryptSeed() = %q, want %q", got, seed)
+	}
+
+	if _, err := DecryptSeed(encrypted, []byte("wrong")); !errors.Is(err, ErrEncryptedSeed) {
+		t.Errorf("DecryptSeed() with wrong passphrase error = %v, want ErrEncryptedSeed", err)
+	}
+	if _, err := EncryptSeed([]byte(seed), nil); err == nil {
+		t.Error("EncryptSeed() without passphrase succeeded")
+	}
+}
+
+func TestResolveSeed(t *testing.T) {
+	seed := "SAANJIBNEKGCRUWJCPIWUXFBFJLR36FJTFKGBGKAT7AQXH2LVFNQWZJMQU"
+	encrypted, err := EncryptSeed([]byte(seed), []byte("secret"))
+	if err != nil {
+		t.Fatalf("EncryptSeed() error = %v", err)
+	}
+
+	t.Run("plain seed is unchanged", func(t *testing.T) {
+		got, err := ResolveSeed([]byte(seed))
+		if err != nil || string(got) != seed {
+			t.Errorf("ResolveSeed() = %q, %v", got, err)
+		}
+	})
+
+	t.Run("passphrase not set", func(t *testing.T) {
+		t.Setenv(KeyPassphraseEnv, "")
+		if _, err := ResolveSeed(encrypted); !errors.Is(err, ErrEncryptedSeed) {
+			t.Errorf("ResolveSeed() error = %v, want ErrEncryptedSeed", err)
+		}
+	})
+
+	t.Run("decrypted with passphrase from env", func(t *testing.T) {
+		t.Setenv(KeyPassphraseEnv, "secret")
+		got, err := ResolveSeed(encrypted)
+		if err != nil || string(got) != seed {
+			t.Errorf("ResolveSeed() = %q, %v", got, err)
+		}
+	})
+}
+
+func TestNewStaticAccountProvider_EncryptedKey(t *testing.T) {
+	seed := "SAANJIBNEKGCRUWJCPIWUXFBFJLR36FJTFKGBGKAT7AQXH2LVFNQWZJMQU"
+	encrypted, err := EncryptSeed([]byte(seed), []byte("secret"))
+	if err != nil {
+		t.Fatalf("EncryptSeed() error = %v", err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "account.nk.enc")
+	if err := os.WriteFile(keyPath, encrypted, 0600); err != nil {
+		t.Fatalf("writing key: %v", err)
+	}
+	cfg := StaticAccountProviderConfig{
+		PublicKey:      "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA",
+		PrivateKeyPath: keyPath,
+		Accounts:       []string{"test-account"},
+	}
+
+	t.Setenv(KeyPassphraseEnv, "wrong")
+	if _, err := NewStaticAccountProvider(cfg); !errors.Is(err, ErrEncryptedSeed) {
+		t.Fatalf("NewStaticAccountProvider() with wrong passphrase error = %v, want ErrEncryptedSeed", err)
+	}
+
+	t.Setenv(KeyPassphraseEnv, "secret")
+	if _, err := NewStaticAccountProvider(cfg); err != nil {
+		t.Fatalf("NewStaticAccountProvider() error = %v", err)
+	}
+}
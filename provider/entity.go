@@ -1,6 +1,17 @@
 package provider
 
-import "github.com/msimon/nauts/jwt"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/jwt"
+	"github.com/msimon/nauts/policy"
+)
 
 // Account represents a NATS account entity.
 type Account struct {
@@ -23,3 +34,155 @@ func (a *Account) PublicKey() string {
 func (a *Account) Signer() jwt.Signer {
 	return a.signer
 }
+
+// Binding represents a collection of policies attached to a role in an account.
+type Binding struct {
+	Role     string   `json:"role"`
+	Account  string   `json:"account"`
+	Policies []string `json:"policies"`
+	// Inherits optionally names roles of the same account whose policies
+	// this role includes (e.g., admin inherits readonly), transitively.
+	Inherits []string `json:"inherits,omitempty"`
+	// TTL optionally replaces the server's default session TTL for users
+	// holding this role (e.g., "24h" for service roles). With several
+	// overrides, the smallest applies.
+	TTL string `json:"ttl,omitempty"`
+	// MaxTTL optionally caps the session TTL of users holding this role (e.g., "15m").
+	MaxTTL string `json:"maxTTL,omitempty"`
+	// ExpiresAt optionally ends a temporary role grant (e.g., incident
+	// access): after it, the binding no longer contributes policies, and
+	// sessions granted before are capped to end by then.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Expired reports whether the binding has an expiry at or before now.
+func (b *Binding) Expired(now time.Time) bool {
+	return b.ExpiresAt != nil && !now.Before(*b.ExpiresAt)
+}
+
+// GetTTL returns the binding's session TTL override, or 0 if none is set.
+func (b *Binding) GetTTL() time.Duration {
+	d, err := policy.ParseMaxTTL(b.TTL)
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+// GetMaxTTL returns the binding's maximum session TTL, or 0 if none is set.
+func (b *Binding) GetMaxTTL() time.Duration {
+	d, err := policy.ParseMaxTTL(b.MaxTTL)
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+// IdentityRole returns the account-scoped role this binding applies to.
+func (b *Binding) IdentityRole() identity.Role {
+	return identity.Role{Account: b.Account, Name: b.Role}
+}
+
+type roleValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *roleValidationError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// Validate validates a binding for correctness.
+func (b *Binding) Validate() error {
+	if b.Role == "" {
+		return &roleValidationError{Field: "role", Message: "role is required"}
+	}
+	if b.Account == "" {
+		return &roleValidationError{Field: "account", Message: "binding account is required"}
+	}
+	for _, role := range b.Inherits {
+		switch strings.TrimSpace(role) {
+		case "":
+			return &roleValidationError{Field: "inherits", Message: "inherited role is required"}
+		case b.Role:
+			return &roleValidationError{Field: "inherits", Message: "role cannot inherit itself"}
+		}
+	}
+	if _, err := policy.ParseMaxTTL(b.TTL); err != nil {
+		return &roleValidationError{Field: "ttl", Message: err.Error()}
+	}
+	if _, err := policy.ParseMaxTTL(b.MaxTTL); err != nil {
+		return &roleValidationError{Field: "maxTTL", Message: err.Error()}
+	}
+	return nil
+}
+
+// bindingLookup returns the binding of a role, or ErrRoleNotFound.
+type bindingLookup func(ctx context.Context, role identity.Role) (*Binding, error)
+
+// bindingPolicyIDs returns the policy IDs of b and of the roles it inherits,
+// transitively, deduplicated and sorted. Inherited roles are looked up in b's
+// account; missing and expired ones contribute no policies, like missing
+// policies. A role inheriting itself is an ErrRoleInheritanceCycle.
+func bindingPolicyIDs(ctx context.Context, b *Binding, lookup bindingLookup) ([]string, error) {
+	now := time.Now()
+	seen := make(map[string]struct{})
+	// visiting holds the roles on the current path, done the resolved ones.
+	visiting := make(map[string]bool)
+	done := make(map[string]bool)
+
+	var visit func(b *Binding, path []string) error
+	visit = func(b *Binding, path []string) error {
+		visiting[b.Role] = true
+		path = append(path, b.Role)
+		for _, id := range b.Policies {
+			if id = strings.TrimSpace(id); id != "" {
+				seen[id] = struct{}{}
+			}
+		}
+		for _, name := range b.Inherits {
+			name = strings.TrimSpace(name)
+			if visiting[name] {
+				return fmt.Errorf("%w: %s.%s", ErrRoleInheritanceCycle, b.Account, strings.Join(append(path, name), " -> "))
+			}
+			if done[name] {
+				continue
+			}
+			inherited, err := lookup(ctx, identity.Role{Account: b.Account, Name: name})
+			if errors.Is(err, ErrRoleNotFound) || (err == nil && inherited.Expired(now)) {
+				done[name] = true
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("getting inherited role %s.%s: %w", b.Account, name, err)
+			}
+			if err := visit(inherited, path); err != nil {
+				return err
+			}
+		}
+		visiting[b.Role] = false
+		done[b.Role] = true
+		return nil
+	}
+	if err := visit(b, nil); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// lookupWithBinding returns lookup with b in place of the stored binding of
+// its role, to check a binding for cycles before it is written.
+func lookupWithBinding(lookup bindingLookup, b *Binding) bindingLookup {
+	return func(ctx context.Context, role identity.Role) (*Binding, error) {
+		if role == b.IdentityRole() {
+			return b, nil
+		}
+		return lookup(ctx, role)
+	}
+}
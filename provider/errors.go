@@ -11,4 +11,8 @@ var (
 
 	// ErrRoleNotFound is returned when a role cannot be found.
 	ErrRoleNotFound = errors.New("role not found")
+
+	// ErrRoleInheritanceCycle is returned when a role inherits itself,
+	// directly or through other roles.
+	ErrRoleInheritanceCycle = errors.New("role inheritance cycle")
 )
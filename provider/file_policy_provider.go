@@ -5,18 +5,26 @@ import (
 	"encoding/json"
 	"errors"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/msimon/nauts/identity"
 	"github.com/msimon/nauts/policy"
+	"github.com/msimon/nauts/strictjson"
 )
 
-// FilePolicyProvider implements PolicyProvider using a JSON file.
+// FilePolicyProvider implements PolicyStore using JSON files.
 // Data is loaded once during initialization and cached in memory.
+// Writes update the in-memory state and rewrite the corresponding file.
 type FilePolicyProvider struct {
-	policies map[string]*policy.Policy
-	bindings map[string]*binding
+	mu           sync.RWMutex
+	policies     map[string]*policy.Policy
+	bindings     map[string]*Binding
+	policiesPath string
+	bindingsPath string
+	version      uint64 // incremented by every write
 }
 
 // FilePolicyProviderConfig holds configuration for FilePolicyProvider.
@@ -27,44 +35,17 @@ type FilePolicyProviderConfig struct {
 	BindingsPath string `json:"bindingsPath"`
 }
 
-// binding represents a collection of policies attached to a role in an account.
-//
-// This struct exists to support FilePolicyProvider's role->policy mapping.
-// It is not used by the rest of the system.
-type binding struct {
-	Role     string   `json:"role"`
-	Account  string   `json:"account"`
-	Policies []string `json:"policies"`
-}
-
-type roleValidationError struct {
-	Field   string
-	Message string
-}
-
-func (e *roleValidationError) Error() string {
-	return e.Field + ": " + e.Message
-}
-
-func (b *binding) Validate() error {
-	if b.Role == "" {
-		return &roleValidationError{Field: "role", Message: "role is required"}
-	}
-	if b.Account == "" {
-		return &roleValidationError{Field: "account", Message: "binding account is required"}
-	}
-	return nil
-}
-
-func bindingKey(account string, role string) string {
-	return account + "." + role
+func bindingKey(role identity.Role) string {
+	return role.String()
 }
 
 // NewFilePolicyProvider creates a new FilePolicyProvider from the given configuration.
 func NewFilePolicyProvider(cfg FilePolicyProviderConfig) (*FilePolicyProvider, error) {
 	fp := &FilePolicyProvider{
-		policies: make(map[string]*policy.Policy),
-		bindings: make(map[string]*binding),
+		policies:     make(map[string]*policy.Policy),
+		bindings:     make(map[string]*Binding),
+		policiesPath: cfg.PoliciesPath,
+		bindingsPath: cfg.BindingsPath,
 	}
 
 	// Load policies
@@ -90,8 +71,8 @@ func (fp *FilePolicyProvider) loadBindings(path string) error {
 		return err
 	}
 
-	var bindings []*binding
-	if err := json.Unmarshal(data, &bindings); err != nil {
+	var bindings []*Binding
+	if err := strictjson.Unmarshal(data, &bindings); err != nil {
 		return err
 	}
 
@@ -99,7 +80,12 @@ func (fp *FilePolicyProvider) loadBindings(path string) error {
 		if err := b.Validate(); err != nil {
 			return err
 		}
-		fp.bindings[bindingKey(b.Account, b.Role)] = b
+		fp.bindings[bindingKey(b.IdentityRole())] = b
+	}
+	for _, b := range bindings {
+		if _, err := bindingPolicyIDs(context.Background(), b, fp.binding); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -113,7 +99,7 @@ func (fp *FilePolicyProvider) loadPolicies(path string) error {
 	}
 
 	var policies []*policy.Policy
-	if err := json.Unmarshal(data, &policies); err != nil {
+	if err := strictjson.Unmarshal(data, &policies); err != nil {
 		return err
 	}
 
@@ -129,13 +115,20 @@ func (fp *FilePolicyProvider) loadPolicies(path string) error {
 
 // GetPolicy retrieves a policy by account and ID.
 // If the id starts with "_global:", the prefix is stripped before lookup.
+// IDs starting with "builtin:" resolve to the built-in policy library.
 // The account parameter is accepted for interface compliance but not used for lookup
 // in the file provider, since policy IDs are unique across the flat map.
 func (fp *FilePolicyProvider) GetPolicy(_ context.Context, _ string, id string) (*policy.Policy, error) {
+	if policy.IsBuiltinID(id) {
+		return builtinPolicy(id)
+	}
 	if strings.HasPrefix(id, "_global:") {
 		id = strings.TrimPrefix(id, "_global:")
 	}
 
+	fp.mu.RLock()
+	defer fp.mu.RUnlock()
+
 	p, ok := fp.policies[id]
 	if !ok {
 		return nil, ErrPolicyNotFound
@@ -143,6 +136,8 @@ func (fp *FilePolicyProvider) GetPolicy(_ context.Context, _ string, id string)
 	return p, nil
 }
 
+// GetPoliciesForRole returns the policies of a role's binding and of the
+// roles it inherits. Missing policies and inherited roles are skipped.
 func (fp *FilePolicyProvider) GetPoliciesForRole(ctx context.Context, role identity.Role) ([]*policy.Policy, error) {
 	role.Name = strings.TrimSpace(role.Name)
 	if role.Name == "" {
@@ -153,31 +148,21 @@ func (fp *FilePolicyProvider) GetPoliciesForRole(ctx context.Context, role ident
 		return nil, ErrRoleNotFound
 	}
 
-	b := fp.bindings[bindingKey(role.Account, role.Name)]
+	fp.mu.RLock()
+	b := fp.bindings[bindingKey(role)]
+	var policyIDs []string
+	var err error
+	if b != nil {
+		policyIDs, err = bindingPolicyIDs(ctx, b, fp.binding)
+	}
+	fp.mu.RUnlock()
 	if b == nil {
 		return nil, ErrRoleNotFound
 	}
-
-	policyIDs := make([]string, 0, 8)
-	seen := make(map[string]struct{})
-	addPolicyID := func(id string) {
-		id = strings.TrimSpace(id)
-		if id == "" {
-			return
-		}
-		if _, ok := seen[id]; ok {
-			return
-		}
-		seen[id] = struct{}{}
-		policyIDs = append(policyIDs, id)
-	}
-
-	for _, id := range b.Policies {
-		addPolicyID(id)
+	if err != nil {
+		return nil, err
 	}
 
-	sort.Strings(policyIDs)
-
 	result := make([]*policy.Policy, 0, len(policyIDs))
 	for _, id := range policyIDs {
 		p, err := fp.GetPolicy(ctx, role.Account, id)
@@ -200,6 +185,9 @@ func (fp *FilePolicyProvider) GetPoliciesForRole(ctx context.Context, role ident
 func (fp *FilePolicyProvider) GetPolicies(_ context.Context, account string) ([]*policy.Policy, error) {
 	account = strings.TrimSpace(account)
 
+	fp.mu.RLock()
+	defer fp.mu.RUnlock()
+
 	result := make([]*policy.Policy, 0, len(fp.policies))
 	for _, p := range fp.policies {
 		if p == nil {
@@ -215,3 +203,235 @@ func (fp *FilePolicyProvider) GetPolicies(_ context.Context, account string) ([]
 	})
 	return result, nil
 }
+
+// GetBinding retrieves the binding for an account-scoped role.
+func (fp *FilePolicyProvider) GetBinding(_ context.Context, role identity.Role) (*Binding, error) {
+	fp.mu.RLock()
+	defer fp.mu.RUnlock()
+	return fp.binding(context.Background(), role)
+}
+
+// binding is a bindingLookup of the loaded bindings. The caller must hold fp.mu.
+func (fp *FilePolicyProvider) binding(_ context.Context, role identity.Role) (*Binding, error) {
+	b, ok := fp.bindings[bindingKey(role)]
+	if !ok {
+		return nil, ErrRoleNotFound
+	}
+	return b, nil
+}
+
+// GetBindings returns all bindings for the given account, sorted by role.
+func (fp *FilePolicyProvider) GetBindings(_ context.Context, account string) ([]*Binding, error) {
+	account = strings.TrimSpace(account)
+
+	fp.mu.RLock()
+	defer fp.mu.RUnlock()
+
+	result := make([]*Binding, 0)
+	for _, b := range fp.bindings {
+		if b.Account == account {
+			result = append(result, b)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Role < result[j].Role
+	})
+	return result, nil
+}
+
+// ListPolicies returns the policies of all accounts, sorted by ID.
+func (fp *FilePolicyProvider) ListPolicies(_ context.Context) ([]*policy.Policy, error) {
+	fp.mu.RLock()
+	defer fp.mu.RUnlock()
+
+	result := make([]*policy.Policy, 0, len(fp.policies))
+	for _, p := range fp.policies {
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+// ListBindings returns the bindings of all accounts, sorted by account and role.
+func (fp *FilePolicyProvider) ListBindings(_ context.Context) ([]*Binding, error) {
+	fp.mu.RLock()
+	defer fp.mu.RUnlock()
+
+	result := make([]*Binding, 0, len(fp.bindings))
+	for _, b := range fp.bindings {
+		result = append(result, b)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return bindingKey(result[i].IdentityRole()) < bindingKey(result[j].IdentityRole())
+	})
+	return result, nil
+}
+
+// PolicyVersion implements PolicyVersioner.
+func (fp *FilePolicyProvider) PolicyVersion() uint64 {
+	fp.mu.RLock()
+	defer fp.mu.RUnlock()
+	return fp.version
+}
+
+// PutPolicy creates or replaces a policy and rewrites the policies file.
+func (fp *FilePolicyProvider) PutPolicy(_ context.Context, pol *policy.Policy) error {
+	if pol == nil {
+		return errors.New("policy is nil")
+	}
+	if err := pol.Validate(); err != nil {
+		return err
+	}
+
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	fp.version++
+
+	previous, existed := fp.policies[pol.ID]
+	fp.policies[pol.ID] = pol
+	if err := fp.savePolicies(); err != nil {
+		if existed {
+			fp.policies[pol.ID] = previous
+		} else {
+			delete(fp.policies, pol.ID)
+		}
+		return err
+	}
+	return nil
+}
+
+// DeletePolicy removes a policy of the given account and rewrites the policies file.
+func (fp *FilePolicyProvider) DeletePolicy(_ context.Context, account string, id string) error {
+	id = strings.TrimPrefix(id, "_global:")
+
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	fp.version++
+
+	previous, ok := fp.policies[id]
+	if !ok || previous.Account != account {
+		return nil
+	}
+	delete(fp.policies, id)
+	if err := fp.savePolicies(); err != nil {
+		fp.policies[id] = previous
+		return err
+	}
+	return nil
+}
+
+// PutBinding creates or replaces a binding and rewrites the bindings file.
+func (fp *FilePolicyProvider) PutBinding(_ context.Context, b *Binding) error {
+	if b == nil {
+		return errors.New("binding is nil")
+	}
+	if err := b.Validate(); err != nil {
+		return err
+	}
+
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	if _, err := bindingPolicyIDs(context.Background(), b, lookupWithBinding(fp.binding, b)); err != nil {
+		return err
+	}
+	fp.version++
+
+	key := bindingKey(b.IdentityRole())
+	previous, existed := fp.bindings[key]
+	fp.bindings[key] = b
+	if err := fp.saveBindings(); err != nil {
+		if existed {
+			fp.bindings[key] = previous
+		} else {
+			delete(fp.bindings, key)
+		}
+		return err
+	}
+	return nil
+}
+
+// DeleteBinding removes a binding and rewrites the bindings file.
+func (fp *FilePolicyProvider) DeleteBinding(_ context.Context, role identity.Role) error {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	fp.version++
+
+	key := bindingKey(role)
+	previous, ok := fp.bindings[key]
+	if !ok {
+		return nil
+	}
+	delete(fp.bindings, key)
+	if err := fp.saveBindings(); err != nil {
+		fp.bindings[key] = previous
+		return err
+	}
+	return nil
+}
+
+// savePolicies writes all policies to the policies file, sorted by ID.
+// The caller must hold fp.mu.
+func (fp *FilePolicyProvider) savePolicies() error {
+	if fp.policiesPath == "" {
+		return nil
+	}
+	policies := make([]*policy.Policy, 0, len(fp.policies))
+	for _, p := range fp.policies {
+		policies = append(policies, p)
+	}
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].ID < policies[j].ID
+	})
+	return writeJSONFile(fp.policiesPath, policies)
+}
+
+// saveBindings writes all bindings to the bindings file, sorted by account and role.
+// The caller must hold fp.mu.
+func (fp *FilePolicyProvider) saveBindings() error {
+	if fp.bindingsPath == "" {
+		return nil
+	}
+	bindings := make([]*Binding, 0, len(fp.bindings))
+	for _, b := range fp.bindings {
+		bindings = append(bindings, b)
+	}
+	sort.Slice(bindings, func(i, j int) bool {
+		return bindingKey(bindings[i].IdentityRole()) < bindingKey(bindings[j].IdentityRole())
+	})
+	return writeJSONFile(fp.bindingsPath, bindings)
+}
+
+// writeJSONFile atomically replaces path with the indented JSON encoding of v.
+func writeJSONFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -3,8 +3,10 @@ package provider
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 
 	"github.com/msimon/nauts/identity"
@@ -177,6 +179,97 @@ func TestFilePolicyProvider_GetPoliciesForRole_GlobalPolicy(t *testing.T) {
 	}
 }
 
+func TestFilePolicyProvider_GetPoliciesForRole_Inherits(t *testing.T) {
+	fp := newTestFileStore(t, `[
+		{"id": "app-read", "account": "APP", "name": "read", "statements": [{"effect": "allow", "actions": ["nats.sub"], "resources": ["nats:a"]}]},
+		{"id": "app-write", "account": "APP", "name": "write", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:a"]}]},
+		{"id": "app-admin", "account": "APP", "name": "admin", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:admin"]}]},
+		{"id": "app-audit", "account": "APP", "name": "audit", "statements": [{"effect": "allow", "actions": ["nats.sub"], "resources": ["nats:audit"]}]}
+	]`, `[
+		{"role": "readonly", "account": "APP", "policies": ["app-read"]},
+		{"role": "editor", "account": "APP", "policies": ["app-write", "app-read"], "inherits": ["readonly"]},
+		{"role": "auditor", "account": "APP", "policies": ["app-audit"], "expiresAt": "2020-01-01T00:00:00Z"},
+		{"role": "admin", "account": "APP", "policies": ["app-admin"], "inherits": ["editor", "readonly", "auditor", "ghost"]}
+	]`)
+	ctx := context.Background()
+
+	policies, err := fp.GetPoliciesForRole(ctx, identity.Role{Account: "APP", Name: "admin"})
+	if err != nil {
+		t.Fatalf("GetPoliciesForRole() error = %v", err)
+	}
+	var ids []string
+	for _, p := range policies {
+		ids = append(ids, p.ID)
+	}
+	// Expired and missing inherited roles contribute nothing.
+	if want := []string{"app-admin", "app-read", "app-write"}; !slices.Equal(ids, want) {
+		t.Errorf("GetPoliciesForRole() = %v, want %v", ids, want)
+	}
+
+	// A cycle is rejected on write and leaves the stored binding unchanged.
+	err = fp.PutBinding(ctx, &Binding{Role: "readonly", Account: "APP", Policies: []string{"app-read"}, Inherits: []string{"admin"}})
+	if !errors.Is(err, ErrRoleInheritanceCycle) {
+		t.Fatalf("PutBinding() error = %v, want ErrRoleInheritanceCycle", err)
+	}
+	if _, err := fp.GetPoliciesForRole(ctx, identity.Role{Account: "APP", Name: "readonly"}); err != nil {
+		t.Errorf("GetPoliciesForRole() after rejected write error = %v", err)
+	}
+
+	// A cycle in the bindings file fails loading.
+	dir := t.TempDir()
+	bindingsPath := filepath.Join(dir, "bindings.json")
+	if err := os.WriteFile(bindingsPath, []byte(`[
+		{"role": "a", "account": "APP", "policies": [], "inherits": ["b"]},
+		{"role": "b", "account": "APP", "policies": [], "inherits": ["a"]}
+	]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFilePolicyProvider(FilePolicyProviderConfig{BindingsPath: bindingsPath}); !errors.Is(err, ErrRoleInheritanceCycle) {
+		t.Errorf("NewFilePolicyProvider() error = %v, want ErrRoleInheritanceCycle", err)
+	}
+}
+
+func TestFilePolicyProvider_GetPoliciesForRole_BuiltinPolicy(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	policiesPath := filepath.Join(tmpDir, "policies.json")
+	if err := os.WriteFile(policiesPath, []byte(`[]`), 0644); err != nil {
+		t.Fatalf("failed to write policies file: %v", err)
+	}
+	bindingsContent := `[
+  {
+    "role": "reader",
+    "account": "APP",
+    "policies": ["builtin:kv-reader:config", "builtin:unknown", "builtin:kv-reader"]
+  }
+]`
+	bindingsPath := filepath.Join(tmpDir, "bindings.json")
+	if err := os.WriteFile(bindingsPath, []byte(bindingsContent), 0644); err != nil {
+		t.Fatalf("failed to write bindings file: %v", err)
+	}
+
+	fp, err := NewFilePolicyProvider(FilePolicyProviderConfig{
+		PoliciesPath: policiesPath,
+		BindingsPath: bindingsPath,
+	})
+	if err != nil {
+		t.Fatalf("NewFilePolicyProvider() error = %v", err)
+	}
+
+	ctx := context.Background()
+	policies, err := fp.GetPoliciesForRole(ctx, identity.Role{Account: "APP", Name: "reader"})
+	if err != nil {
+		t.Fatalf("GetPoliciesForRole() error = %v", err)
+	}
+	if len(policies) != 1 || policies[0].ID != "builtin:kv-reader:config" || policies[0].Account != "_global" {
+		t.Fatalf("GetPoliciesForRole() = %+v, want the resolved builtin:kv-reader:config", policies)
+	}
+
+	if _, err := fp.GetPolicy(ctx, "APP", "builtin:unknown"); !errors.Is(err, ErrPolicyNotFound) {
+		t.Errorf("GetPolicy(builtin:unknown) error = %v, want ErrPolicyNotFound", err)
+	}
+}
+
 func TestFilePolicyProvider_GetPolicy_NotFound(t *testing.T) {
 	fp := &FilePolicyProvider{
 		policies: make(map[string]*policy.Policy),
@@ -208,7 +301,7 @@ func TestNewFilePolicyProvider_EmptyConfig(t *testing.T) {
 func TestFilePolicyProvider_GetPoliciesForRole_NotFound(t *testing.T) {
 	fp := &FilePolicyProvider{
 		policies: make(map[string]*policy.Policy),
-		bindings: make(map[string]*binding),
+		bindings: make(map[string]*Binding),
 	}
 
 	ctx := context.Background()
@@ -261,12 +354,12 @@ func TestNewFilePolicyProvider_InvalidPolicy(t *testing.T) {
 func TestBinding_Validate(t *testing.T) {
 	tests := []struct {
 		name    string
-		binding binding
+		binding Binding
 		wantErr bool
 	}{
 		{
 			name: "valid binding",
-			binding: binding{
+			binding: Binding{
 				Role:     "test-role",
 				Account:  "APP",
 				Policies: []string{"policy-1"},
@@ -275,15 +368,78 @@ func TestBinding_Validate(t *testing.T) {
 		},
 		{
 			name: "valid binding without policies",
-			binding: binding{
+			binding: Binding{
 				Role:    "test-role",
 				Account: "APP",
 			},
 			wantErr: false,
 		},
+		{
+			name: "valid maxTTL",
+			binding: Binding{
+				Role:    "admin",
+				Account: "APP",
+				MaxTTL:  "15m",
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid maxTTL",
+			binding: Binding{
+				Role:    "admin",
+				Account: "APP",
+				MaxTTL:  "-5m",
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid ttl",
+			binding: Binding{
+				Role:    "service",
+				Account: "APP",
+				TTL:     "24h",
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid ttl",
+			binding: Binding{
+				Role:    "service",
+				Account: "APP",
+				TTL:     "forever",
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid inherits",
+			binding: Binding{
+				Role:     "admin",
+				Account:  "APP",
+				Inherits: []string{"readonly"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "inherits itself",
+			binding: Binding{
+				Role:     "admin",
+				Account:  "APP",
+				Inherits: []string{"admin"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "empty inherited role",
+			binding: Binding{
+				Role:     "admin",
+				Account:  "APP",
+				Inherits: []string{" "},
+			},
+			wantErr: true,
+		},
 		{
 			name: "missing role",
-			binding: binding{
+			binding: Binding{
 				Account:  "APP",
 				Policies: []string{"policy-1"},
 			},
@@ -291,7 +447,7 @@ func TestBinding_Validate(t *testing.T) {
 		},
 		{
 			name: "missing account",
-			binding: binding{
+			binding: Binding{
 				Role:     "test-role",
 				Policies: []string{"policy-1"},
 			},
@@ -310,13 +466,13 @@ func TestBinding_Validate(t *testing.T) {
 }
 
 func TestBindingKey(t *testing.T) {
-	if got := bindingKey("APP", "admin"); got != "APP.admin" {
+	if got := bindingKey(identity.Role{Account: "APP", Name: "admin"}); got != "APP.admin" {
 		t.Errorf("bindingKey() = %v, want %v", got, "APP.admin")
 	}
 }
 
 func TestBinding_JSON(t *testing.T) {
-	b := binding{
+	b := Binding{
 		Role:     "test-role",
 		Account:  "APP",
 		Policies: []string{"policy-1", "policy-2"},
@@ -327,7 +483,7 @@ func TestBinding_JSON(t *testing.T) {
 		t.Fatalf("Marshal error: %v", err)
 	}
 
-	var parsed binding
+	var parsed Binding
 	if err := json.Unmarshal(data, &parsed); err != nil {
 		t.Fatalf("Unmarshal error: %v", err)
 	}
@@ -342,3 +498,81 @@ func TestBinding_JSON(t *testing.T) {
 		t.Errorf("Policies length mismatch: got %d, want 2", len(parsed.Policies))
 	}
 }
+
+func TestFilePolicyProvider_Writes(t *testing.T) {
+	dir := t.TempDir()
+	cfg := FilePolicyProviderConfig{
+		PoliciesPath: filepath.Join(dir, "policies.json"),
+		BindingsPath: filepath.Join(dir, "bindings.json"),
+	}
+	if err := os.WriteFile(cfg.PoliciesPath, []byte("[]"), 0644); err != nil {
+		t.Fatalf("writing policies: %v", err)
+	}
+	if err := os.WriteFile(cfg.BindingsPath, []byte("[]"), 0644); err != nil {
+		t.Fatalf("writing bindings: %v", err)
+	}
+
+	fp, err := NewFilePolicyProvider(cfg)
+	if err != nil {
+		t.Fatalf("NewFilePolicyProvider() error = %v", err)
+	}
+	ctx := context.Background()
+
+	pol := &policy.Policy{
+		ID:      "p1",
+		Account: "APP",
+		Name:    "p1",
+		Statements: []policy.Statement{
+			{Effect: policy.EffectAllow, Actions: []policy.Action{policy.ActionNATSPub}, Resources: []string{"nats:foo"}},
+		},
+	}
+	if err := fp.PutPolicy(ctx, pol); err != nil {
+		t.Fatalf("PutPolicy() error = %v", err)
+	}
+	if err := fp.PutBinding(ctx, &Binding{Account: "APP", Role: "admin", Policies: []string{"p1"}}); err != nil {
+		t.Fatalf("PutBinding() error = %v", err)
+	}
+	if err := fp.PutPolicy(ctx, &policy.Policy{ID: "invalid"}); err == nil {
+		t.Error("PutPolicy() expected validation error")
+	}
+
+	// Changes are persisted and visible to a new provider.
+	reloaded, err := NewFilePolicyProvider(cfg)
+	if err != nil {
+		t.Fatalf("reloading: %v", err)
+	}
+	policies, err := reloaded.GetPoliciesForRole(ctx, identity.Role{Account: "APP", Name: "admin"})
+	if err != nil || len(policies) != 1 || policies[0].ID != "p1" {
+		t.Fatalf("GetPoliciesForRole() = %v, %v; want [p1]", policies, err)
+	}
+	bindings, err := reloaded.GetBindings(ctx, "APP")
+	if err != nil || len(bindings) != 1 {
+		t.Fatalf("GetBindings() = %v, %v; want 1 binding", bindings, err)
+	}
+
+	// Deleting a policy of another account is a no-op.
+	if err := fp.DeletePolicy(ctx, "OTHER", "p1"); err != nil {
+		t.Fatalf("DeletePolicy(OTHER) error = %v", err)
+	}
+	if _, err := fp.GetPolicy(ctx, "APP", "p1"); err != nil {
+		t.Errorf("policy deleted by foreign account: %v", err)
+	}
+
+	if err := fp.DeletePolicy(ctx, "APP", "p1"); err != nil {
+		t.Fatalf("DeletePolicy() error = %v", err)
+	}
+	if err := fp.DeleteBinding(ctx, identity.Role{Account: "APP", Name: "admin"}); err != nil {
+		t.Fatalf("DeleteBinding() error = %v", err)
+	}
+	if _, err := fp.GetBinding(ctx, identity.Role{Account: "APP", Name: "admin"}); !errors.Is(err, ErrRoleNotFound) {
+		t.Errorf("GetBinding() after delete error = %v, want %v", err, ErrRoleNotFound)
+	}
+
+	reloaded, err = NewFilePolicyProvider(cfg)
+	if err != nil {
+		t.Fatalf("reloading: %v", err)
+	}
+	if all, _ := reloaded.GetPolicies(ctx, "APP"); len(all) != 0 {
+		t.Errorf("GetPolicies() after delete = %v, want empty", all)
+	}
+}
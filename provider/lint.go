@@ -0,0 +1,328 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/policy"
+	"github.com/msimon/nauts/strictjson"
+)
+
+// LintLevel is the severity of a lint finding.
+type LintLevel string
+
+const (
+	// LintError means users holding the role do not get the intended permissions.
+	LintError LintLevel = "error"
+	// LintWarning means the store contains dead or suspicious entries.
+	LintWarning LintLevel = "warning"
+)
+
+// Lint rules reported in a LintFinding.
+const (
+	// LintRuleMissingPolicy: a binding references a policy that does not exist.
+	LintRuleMissingPolicy = "missing-policy"
+	// LintRuleAccountMismatch: a binding references a policy of another account,
+	// which is skipped at compile time.
+	LintRuleAccountMismatch = "policy-account-mismatch"
+	// LintRuleMissingRole: a binding inherits a role that has no binding.
+	LintRuleMissingRole = "missing-role"
+	// LintRuleInheritanceCycle: a role inherits itself through other roles,
+	// so GetPoliciesForRole fails for it.
+	LintRuleInheritanceCycle = "inheritance-cycle"
+	// LintRuleEmptyBinding: a binding references no policies and inherits no roles.
+	LintRuleEmptyBinding = "empty-binding"
+	// LintRuleExpiredBinding: a binding is past its expiresAt and grants nothing.
+	LintRuleExpiredBinding = "expired-binding"
+	// LintRuleUnusedPolicy: no binding references the policy.
+	LintRuleUnusedPolicy = "unused-policy"
+	// LintRuleInvalidPolicy: a policy fails validation and cannot be loaded.
+	LintRuleInvalidPolicy = "invalid-policy"
+	// LintRuleDuplicatePolicy: a policy ID appears more than once; the last
+	// entry wins.
+	LintRuleDuplicatePolicy = "duplicate-policy"
+	// LintRuleInvalidBinding: a binding fails validation and cannot be loaded.
+	LintRuleInvalidBinding = "invalid-binding"
+	// LintRuleDuplicateBinding: a role appears more than once in an account;
+	// the last entry wins.
+	LintRuleDuplicateBinding = "duplicate-binding"
+	// LintRuleInvalidResource: a resource does not parse or breaks the
+	// wildcard rules, and is skipped at compile time.
+	LintRuleInvalidResource = "invalid-resource"
+	// LintRuleUnresolvedVariable: a resource uses an unknown or malformed
+	// template variable and is skipped at compile time.
+	LintRuleUnresolvedVariable = "unresolved-variable"
+	// LintRuleForeignSubject: a policy grants subjects claimed by another team
+	// in the subject ownership registry.
+	LintRuleForeignSubject = "foreign-subject"
+)
+
+// LintFinding describes a problem with a single policy or binding.
+type LintFinding struct {
+	Rule  string    `json:"rule"`
+	Level LintLevel `json:"level"`
+	// Type is "policy" or "binding".
+	Type    string `json:"type"`
+	Account string `json:"account"`
+	// Name is the policy ID or the binding role.
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+func (f LintFinding) String() string {
+	return fmt.Sprintf("%s %s %s.%s: %s (%s)", f.Level, f.Type, f.Account, f.Name, f.Message, f.Rule)
+}
+
+// LintPolicyStore checks the bindings of store against its policies.
+//
+// Policy references are resolved with GetPolicy, so lookup semantics (such as
+// the "_global:" prefix) match what GetPoliciesForRole uses at authentication
+// time. A referenced policy must belong to the binding's account or to
+// "_global"; other policies are skipped by policy.Compile. Findings are sorted
+// by type, account, name, and rule.
+func LintPolicyStore(ctx context.Context, store PolicyStore) ([]LintFinding, error) {
+	findings := []LintFinding{}
+
+	bindings, err := store.ListBindings(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing bindings: %w", err)
+	}
+	used := make(map[storeKey]struct{})
+	for _, b := range bindings {
+		if b == nil {
+			continue
+		}
+		binding := func(rule string, level LintLevel, format string, args ...any) {
+			findings = append(findings, LintFinding{
+				Rule: rule, Level: level, Type: DiffEntryBinding, Account: b.Account, Name: b.Role,
+				Message: fmt.Sprintf(format, args...),
+			})
+		}
+
+		ids := 0
+		for _, id := range b.Policies {
+			id = strings.TrimSpace(id)
+			if id == "" {
+				continue
+			}
+			ids++
+			pol, err := store.GetPolicy(ctx, b.Account, id)
+			if errors.Is(err, ErrPolicyNotFound) {
+				binding(LintRuleMissingPolicy, LintError, "policy %q does not exist", id)
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("getting policy %s for binding %s.%s: %w", id, b.Account, b.Role, err)
+			}
+			used[storeKey{account: kvAccount(pol.Account), name: pol.ID}] = struct{}{}
+			if pol.Account != globalAccountPrefix && pol.Account != b.Account {
+				binding(LintRuleAccountMismatch, LintError, "policy %q belongs to account %q and is ignored", id, pol.Account)
+			}
+		}
+		for _, name := range b.Inherits {
+			name = strings.TrimSpace(name)
+			ids++
+			_, err := store.GetBinding(ctx, identity.Role{Account: b.Account, Name: name})
+			if errors.Is(err, ErrRoleNotFound) {
+				binding(LintRuleMissingRole, LintError, "inherited role %q does not exist", name)
+			} else if err != nil {
+				return nil, fmt.Errorf("getting inherited role %s for binding %s.%s: %w", name, b.Account, b.Role, err)
+			}
+		}
+		if _, err := bindingPolicyIDs(ctx, b, store.GetBinding); errors.Is(err, ErrRoleInheritanceCycle) {
+			binding(LintRuleInheritanceCycle, LintError, "%v", err)
+		} else if err != nil {
+			return nil, fmt.Errorf("resolving inherited roles of binding %s.%s: %w", b.Account, b.Role, err)
+		}
+		if ids == 0 {
+			binding(LintRuleEmptyBinding, LintWarning, "binding grants no policies")
+		}
+		if b.Expired(time.Now()) {
+			binding(LintRuleExpiredBinding, LintWarning, "binding expired at %s and grants no policies", b.ExpiresAt.Format(time.RFC3339))
+		}
+	}
+
+	policies, err := store.ListPolicies(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing policies: %w", err)
+	}
+	for _, p := range policies {
+		if p == nil {
+			continue
+		}
+		if _, ok := used[storeKey{account: kvAccount(p.Account), name: p.ID}]; ok {
+			continue
+		}
+		findings = append(findings, LintFinding{
+			Rule: LintRuleUnusedPolicy, Level: LintWarning, Type: DiffEntryPolicy, Account: p.Account, Name: p.ID,
+			Message: "no binding references this policy",
+		})
+	}
+
+	sortLintFindings(findings)
+	return findings, nil
+}
+
+// LintPolicyResources checks the resources of policies as written, before
+// interpolation (see policy.ValidateResourceTemplate). Such resources are
+// skipped when permissions are compiled, so users silently miss them.
+func LintPolicyResources(policies []*policy.Policy) []LintFinding {
+	findings := []LintFinding{}
+	for _, p := range policies {
+		if p == nil {
+			continue
+		}
+		for i, stmt := range p.Statements {
+			for _, res := range stmt.Resources {
+				err := policy.ValidateResourceTemplate(res)
+				if err == nil {
+					continue
+				}
+				rule := LintRuleInvalidResource
+				if errors.Is(err, policy.ErrUnresolvedVariable) {
+					rule = LintRuleUnresolvedVariable
+				}
+				findings = append(findings, LintFinding{
+					Rule: rule, Level: LintError, Type: DiffEntryPolicy, Account: p.Account, Name: p.ID,
+					Message: fmt.Sprintf("statement %d: resource %q: %v", i, res, err),
+				})
+			}
+		}
+	}
+	sortLintFindings(findings)
+	return findings
+}
+
+// LintSubjectOwnership checks policies against the subject ownership
+// registry (see policy.SubjectOwnership.Check). Grants by a policy of another
+// team are errors; grants by a policy without a team are warnings, so that
+// the registry can be introduced before all policies name their team.
+func LintSubjectOwnership(policies []*policy.Policy, ownership *policy.SubjectOwnership) []LintFinding {
+	findings := []LintFinding{}
+	for _, p := range policies {
+		if p == nil {
+			continue
+		}
+		level := LintError
+		if p.Team == "" {
+			level = LintWarning
+		}
+		for _, v := range ownership.Check(p) {
+			findings = append(findings, LintFinding{
+				Rule: LintRuleForeignSubject, Level: level, Type: DiffEntryPolicy, Account: p.Account, Name: p.ID,
+				Message: v.String(),
+			})
+		}
+	}
+	sortLintFindings(findings)
+	return findings
+}
+
+// LintPolicyFiles checks the policies and bindings files of a
+// FilePolicyProvider entry by entry. Unlike NewFilePolicyProvider, which stops
+// at the first invalid entry and keeps the last of duplicate entries, it
+// reports every invalid and duplicate entry. Empty paths are skipped. An error
+// is returned if a file cannot be read or is not a JSON array.
+func LintPolicyFiles(policiesPath, bindingsPath string) ([]LintFinding, error) {
+	findings := []LintFinding{}
+
+	if policiesPath != "" {
+		var policies []*policy.Policy
+		if err := readJSONFile(policiesPath, &policies); err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool, len(policies))
+		for i, p := range policies {
+			if p == nil {
+				continue
+			}
+			name := p.ID
+			if name == "" {
+				name = fmt.Sprintf("#%d", i)
+			}
+			if err := p.Validate(); err != nil {
+				findings = append(findings, LintFinding{
+					Rule: LintRuleInvalidPolicy, Level: LintError, Type: DiffEntryPolicy, Account: p.Account, Name: name,
+					Message: err.Error(),
+				})
+				continue
+			}
+			if seen[p.ID] {
+				findings = append(findings, LintFinding{
+					Rule: LintRuleDuplicatePolicy, Level: LintError, Type: DiffEntryPolicy, Account: p.Account, Name: p.ID,
+					Message: fmt.Sprintf("policy ID %q is defined more than once (entry %d replaces an earlier one)", p.ID, i),
+				})
+			}
+			seen[p.ID] = true
+		}
+	}
+
+	if bindingsPath != "" {
+		var bindings []*Binding
+		if err := readJSONFile(bindingsPath, &bindings); err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool, len(bindings))
+		for i, b := range bindings {
+			if b == nil {
+				continue
+			}
+			name := b.Role
+			if name == "" {
+				name = fmt.Sprintf("#%d", i)
+			}
+			if err := b.Validate(); err != nil {
+				findings = append(findings, LintFinding{
+					Rule: LintRuleInvalidBinding, Level: LintError, Type: DiffEntryBinding, Account: b.Account, Name: name,
+					Message: err.Error(),
+				})
+				continue
+			}
+			key := bindingKey(b.IdentityRole())
+			if seen[key] {
+				findings = append(findings, LintFinding{
+					Rule: LintRuleDuplicateBinding, Level: LintError, Type: DiffEntryBinding, Account: b.Account, Name: b.Role,
+					Message: fmt.Sprintf("role is bound more than once (entry %d replaces an earlier one)", i),
+				})
+			}
+			seen[key] = true
+		}
+	}
+
+	sortLintFindings(findings)
+	return findings, nil
+}
+
+func readJSONFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := strictjson.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return nil
+}
+
+// sortLintFindings sorts findings by type, account, name, and rule.
+func sortLintFindings(findings []LintFinding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Account != b.Account {
+			return a.Account < b.Account
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Rule < b.Rule
+	})
+}
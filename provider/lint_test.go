@@ -0,0 +1,153 @@
+package provider
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/msimon/nauts/policy"
+)
+
+func TestLintPolicyStore(t *testing.T) {
+	store := newTestFileStore(t, `[
+		{"id": "app-pub", "account": "APP", "name": "app-pub", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:a"]}]},
+		{"id": "other-pub", "account": "OTHER", "name": "other-pub", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:a"]}]},
+		{"id": "base", "account": "_global", "name": "base", "statements": [{"effect": "allow", "actions": ["nats.sub"], "resources": ["nats:_INBOX.>"]}]},
+		{"id": "orphan", "account": "APP", "name": "orphan", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:a"]}]}
+	]`, `[
+		{"role": "writer", "account": "APP", "policies": ["app-pub", "_global:base", "builtin:kv-reader:config"]},
+		{"role": "broken", "account": "APP", "policies": ["gone", "other-pub", "builtin:kv-reader"]},
+		{"role": "idle", "account": "APP", "policies": [" "]},
+		{"role": "contractor", "account": "APP", "policies": ["app-pub"], "expiresAt": "2020-01-01T00:00:00Z"},
+		{"role": "editor", "account": "APP", "policies": [], "inherits": ["writer", "ghost"]}
+	]`)
+
+	findings, err := LintPolicyStore(context.Background(), store)
+	if err != nil {
+		t.Fatalf("LintPolicyStore() error = %v", err)
+	}
+
+	want := []struct {
+		rule  string
+		level LintLevel
+		name  string
+	}{
+		{LintRuleMissingPolicy, LintError, "broken"},
+		{LintRuleMissingPolicy, LintError, "broken"},
+		{LintRuleAccountMismatch, LintError, "broken"},
+		{LintRuleExpiredBinding, LintWarning, "contractor"},
+		{LintRuleMissingRole, LintError, "editor"},
+		{LintRuleEmptyBinding, LintWarning, "idle"},
+		{LintRuleUnusedPolicy, LintWarning, "orphan"},
+	}
+	if len(findings) != len(want) {
+		t.Fatalf("LintPolicyStore() = %v, want %d findings", findings, len(want))
+	}
+	for i, w := range want {
+		f := findings[i]
+		if f.Rule != w.rule || f.Level != w.level || f.Name != w.name {
+			t.Errorf("finding %d = %s, want %s %s for %s", i, f, w.level, w.rule, w.name)
+		}
+	}
+}
+
+func TestLintPolicyFiles(t *testing.T) {
+	dir := t.TempDir()
+	policiesPath := filepath.Join(dir, "policies.json")
+	bindingsPath := filepath.Join(dir, "bindings.json")
+	writeFile(t, policiesPath, `[
+		{"id": "a", "account": "APP", "name": "a", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:a"]}]},
+		{"id": "a", "account": "APP", "name": "a2", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:b"]}]},
+		{"id": "b", "account": "APP", "name": "b", "statements": []}
+	]`)
+	writeFile(t, bindingsPath, `[
+		{"role": "writer", "account": "APP", "policies": ["a"]},
+		{"role": "writer", "account": "APP", "policies": ["b"]},
+		{"role": "", "account": "APP", "policies": ["a"]}
+	]`)
+
+	findings, err := LintPolicyFiles(policiesPath, bindingsPath)
+	if err != nil {
+		t.Fatalf("LintPolicyFiles() error = %v", err)
+	}
+	want := []struct {
+		rule string
+		name string
+	}{
+		{LintRuleInvalidBinding, "#2"},
+		{LintRuleDuplicateBinding, "writer"},
+		{LintRuleDuplicatePolicy, "a"},
+		{LintRuleInvalidPolicy, "b"},
+	}
+	if len(findings) != len(want) {
+		t.Fatalf("LintPolicyFiles() = %v, want %d findings", findings, len(want))
+	}
+	for i, w := range want {
+		if f := findings[i]; f.Rule != w.rule || f.Name != w.name || f.Level != LintError {
+			t.Errorf("finding %d = %s, want error %s for %s", i, f, w.rule, w.name)
+		}
+	}
+
+	writeFile(t, policiesPath, `{"id": "a"}`)
+	if _, err := LintPolicyFiles(policiesPath, ""); err == nil {
+		t.Error("LintPolicyFiles() expected error for a non-array file")
+	}
+}
+
+func TestLintPolicyResources(t *testing.T) {
+	policies := []*policy.Policy{{
+		ID: "p", Account: "APP",
+		Statements: []policy.Statement{{
+			Effect:    policy.EffectAllow,
+			Actions:   []policy.Action{"nats.pub"},
+			Resources: []string{"nats:ok.{{ user.id }}", "nats:{{ user.email }}", "nats:a.>.b"},
+		}},
+	}}
+
+	findings := LintPolicyResources(policies)
+	if len(findings) != 2 {
+		t.Fatalf("LintPolicyResources() = %v, want 2 findings", findings)
+	}
+	if findings[0].Rule != LintRuleInvalidResource || findings[1].Rule != LintRuleUnresolvedVariable {
+		t.Errorf("rules = %s, %s, want %s, %s", findings[0].Rule, findings[1].Rule, LintRuleInvalidResource, LintRuleUnresolvedVariable)
+	}
+}
+
+func TestLintSubjectOwnership(t *testing.T) {
+	ownership, err := policy.NewSubjectOwnership([]policy.SubjectClaim{
+		{Account: "APP", Team: "orders", Prefixes: []string{"orders"}},
+		{Account: "APP", Team: "billing", Prefixes: []string{"billing"}},
+	})
+	if err != nil {
+		t.Fatalf("NewSubjectOwnership() error = %v", err)
+	}
+	grant := func(id, team, resource string) *policy.Policy {
+		return &policy.Policy{ID: id, Account: "APP", Team: team, Statements: []policy.Statement{{
+			Effect: policy.EffectAllow, Actions: []policy.Action{"nats.sub"}, Resources: []string{resource},
+		}}}
+	}
+	policies := []*policy.Policy{
+		grant("own", "orders", "nats:orders.>"),
+		grant("foreign", "orders", "nats:billing.invoices"),
+		grant("teamless", "", "nats:orders.created"),
+	}
+
+	findings := LintSubjectOwnership(policies, ownership)
+	if len(findings) != 2 {
+		t.Fatalf("LintSubjectOwnership() = %v, want 2 findings", findings)
+	}
+	if f := findings[0]; f.Name != "foreign" || f.Level != LintError || f.Rule != LintRuleForeignSubject {
+		t.Errorf("findings[0] = %v, want foreign-subject error for policy foreign", f)
+	}
+	if f := findings[1]; f.Name != "teamless" || f.Level != LintWarning {
+		t.Errorf("findings[1] = %v, want warning for policy teamless", f)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("writing %s: %v", path, err)
+	}
+}
@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/msimon/nauts/policy"
+)
+
+// Recommended settings of the policy bucket.
+const (
+	// DefaultPolicyBucketHistory keeps the previous revisions of each policy
+	// and binding, so that a bad change can be inspected and reverted.
+	DefaultPolicyBucketHistory = 10
+	// DefaultPolicyBucketMaxValueSize bounds a single policy or binding.
+	DefaultPolicyBucketMaxValueSize = 1 << 20
+)
+
+// PolicyBucketOptions configures BootstrapNatsPolicyBucket. Zero values use
+// the recommended settings.
+type PolicyBucketOptions struct {
+	// History is the number of revisions kept per key (1-64).
+	History uint8
+	// MaxValueSize is the maximum size of a policy or binding in bytes.
+	MaxValueSize int32
+	// Replicas is the number of stream replicas in a cluster.
+	Replicas int
+}
+
+// BootstrapNatsPolicyBucket creates the bucket of cfg with the recommended
+// settings, or updates an existing bucket to them, and returns its status.
+// It connects with the credentials of cfg, which therefore must be allowed
+// to manage the bucket.
+func BootstrapNatsPolicyBucket(ctx context.Context, cfg NatsPolicyProviderConfig, opts PolicyBucketOptions) (jetstream.KeyValueStatus, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("bucket is required")
+	}
+	if opts.History == 0 {
+		opts.History = DefaultPolicyBucketHistory
+	}
+	if opts.History > jetstream.KeyValueMaxHistory {
+		return nil, fmt.Errorf("history must be at most %d", jetstream.KeyValueMaxHistory)
+	}
+	if opts.MaxValueSize == 0 {
+		opts.MaxValueSize = DefaultPolicyBucketMaxValueSize
+	}
+
+	nc, err := connectPolicyNats(cfg, "nauts-kv-bootstrap")
+	if err != nil {
+		return nil, err
+	}
+	defer nc.Close()
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return nil, fmt.Errorf("creating jetstream context: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:       cfg.Bucket,
+		Description:  "nauts policies and role bindings",
+		History:      opts.History,
+		MaxValueSize: opts.MaxValueSize,
+		Replicas:     opts.Replicas,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating bucket %q: %w", cfg.Bucket, err)
+	}
+	return kv.Status(ctx)
+}
+
+// PolicyBucketAccessPolicy returns the minimal policy for the nauts service
+// account to use bucket: kv.read to serve and watch policies and bindings,
+// and unless readOnly kv.edit to write them (account apply, binding
+// approvals).
+func PolicyBucketAccessPolicy(account, bucket string, readOnly bool) *policy.Policy {
+	actions := []policy.Action{policy.ActionKVRead}
+	if !readOnly {
+		actions = append(actions, policy.ActionKVEdit)
+	}
+	return &policy.Policy{
+		ID:      "nauts-policy-bucket",
+		Account: account,
+		Name:    "nauts access to the policy bucket " + bucket,
+		Statements: []policy.Statement{{
+			Effect:    policy.EffectAllow,
+			Actions:   actions,
+			Resources: []string{"kv:" + bucket},
+		}},
+	}
+}
@@ -0,0 +1,90 @@
+package provider
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/msimon/nauts/policy"
+)
+
+func TestPolicyBucketAccessPolicy(t *testing.T) {
+	put := policy.Permission{Type: policy.PermPub, Subject: "$KV.nauts-policies.>"}
+	watch := policy.Permission{Type: policy.PermSub, Subject: "$KV.nauts-policies.>"}
+
+	tests := []struct {
+		name     string
+		readOnly bool
+		wantPut  bool
+	}{
+		{"read and write", false, true},
+		{"read only", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol := PolicyBucketAccessPolicy("AUTH", "nauts-policies", tt.readOnly)
+			if err := pol.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			perms := policy.NewNatsPermissions()
+			policy.Compile([]*policy.Policy{pol}, &policy.PolicyContext{Account: "AUTH"}, perms)
+			perms.Deduplicate()
+
+			if !slices.Contains(perms.SubList(), watch) {
+				t.Errorf("sub permissions %v lack %s", perms.SubList(), watch)
+			}
+			if got := slices.Contains(perms.PubList(), put); got != tt.wantPut {
+				t.Errorf("pub %s granted = %v, want %v", put, got, tt.wantPut)
+			}
+		})
+	}
+}
+
+func TestBootstrapNatsPolicyBucket(t *testing.T) {
+	srv := startTestNatsServer(t)
+	cfg := NatsPolicyProviderConfig{Bucket: "test-bootstrap", NatsURL: srv.url()}
+	ctx := context.Background()
+
+	status, err := BootstrapNatsPolicyBucket(ctx, cfg, PolicyBucketOptions{})
+	if err != nil {
+		t.Fatalf("BootstrapNatsPolicyBucket() error = %v", err)
+	}
+	if status.History() != DefaultPolicyBucketHistory {
+		t.Errorf("History() = %d, want %d", status.History(), DefaultPolicyBucketHistory)
+	}
+
+	// Bootstrapping again updates the settings of the existing bucket.
+	if _, err := BootstrapNatsPolicyBucket(ctx, cfg, PolicyBucketOptions{History: 3, MaxValueSize: 4096}); err != nil {
+		t.Fatalf("BootstrapNatsPolicyBucket() again error = %v", err)
+	}
+	nc, err := nats.Connect(srv.url())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	js, _ := jetstream.New(nc)
+	kv, err := js.KeyValue(ctx, cfg.Bucket)
+	if err != nil {
+		t.Fatalf("opening bucket: %v", err)
+	}
+	stream, err := js.Stream(ctx, "KV_"+cfg.Bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stream.CachedInfo().Config.MaxMsgSize; got != 4096 {
+		t.Errorf("MaxMsgSize = %d, want 4096", got)
+	}
+	if _, err := kv.Put(ctx, "APP.policy.p1", []byte("{}")); err != nil {
+		t.Errorf("Put() error = %v", err)
+	}
+}
+
+func TestBootstrapNatsPolicyBucket_InvalidHistory(t *testing.T) {
+	_, err := BootstrapNatsPolicyBucket(context.Background(), NatsPolicyProviderConfig{Bucket: "b"}, PolicyBucketOptions{History: 65})
+	if err == nil {
+		t.Fatal("expected error for history above 64")
+	}
+}
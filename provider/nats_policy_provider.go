@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"os"
 	"sort"
 	"strings"
@@ -16,6 +15,7 @@ import (
 
 	"github.com/msimon/nauts/identity"
 	"github.com/msimon/nauts/policy"
+	"github.com/msimon/nauts/units"
 )
 
 const (
@@ -45,6 +45,15 @@ type NatsPolicyProviderConfig struct {
 	// CacheTTL is how long cached entries remain valid, as a duration string (e.g., "30s", "1m").
 	// Default: "30s".
 	CacheTTL string `json:"cacheTtl,omitempty"`
+
+	// Cache selects the cache backend. Nil uses an in-memory cache.
+	Cache *CacheConfig `json:"cache,omitempty"`
+
+	// Revision pins the provider to the policies and bindings as of a bucket
+	// revision, given as a revision label (see SetRevisionLabel) or number.
+	// A pinned provider rejects writes and ignores later changes until it
+	// is re-created. Requires a bucket that keeps history.
+	Revision string `json:"revision,omitempty"`
 }
 
 // GetCacheTTL returns the cache TTL as a time.Duration, defaulting to 30s.
@@ -52,21 +61,24 @@ func (c *NatsPolicyProviderConfig) GetCacheTTL() time.Duration {
 	if c.CacheTTL == "" {
 		return defaultCacheTTL
 	}
-	d, err := time.ParseDuration(c.CacheTTL)
+	d, err := units.ParseDuration(c.CacheTTL)
 	if err != nil || d <= 0 {
 		return defaultCacheTTL
 	}
 	return d
 }
 
-// NatsPolicyProvider implements PolicyProvider using a NATS KV bucket.
+// NatsPolicyProvider implements PolicyStore using a NATS KV bucket.
 type NatsPolicyProvider struct {
 	nc      *nats.Conn
 	kv      jetstream.KeyValue
-	cache   *cache
+	cache   cache
 	config  NatsPolicyProviderConfig
-	watcher jetstream.KeyWatcher
-	done    chan struct{}
+	watcher *kvWatchLoop
+
+	// snapshot holds the values of all keys as of the pinned revision; nil
+	// if the provider is not pinned.
+	snapshot map[string][]byte
 }
 
 // NewNatsPolicyProvider creates a new NatsPolicyProvider from the given configuration.
@@ -75,34 +87,9 @@ func NewNatsPolicyProvider(cfg NatsPolicyProviderConfig) (*NatsPolicyProvider, e
 	if cfg.Bucket == "" {
 		return nil, fmt.Errorf("nats policy provider: bucket is required")
 	}
-	if cfg.NatsURL == "" {
-		cfg.NatsURL = nats.DefaultURL
-	}
-	if url := os.Getenv("NATS_URL"); url != "" {
-		cfg.NatsURL = url
-	}
-	if cfg.NatsCredentials != "" && cfg.NatsNkey != "" {
-		return nil, fmt.Errorf("nats policy provider: natsCredentials and natsNkey are mutually exclusive")
-	}
-
-	// Build NATS options
-	opts := []nats.Option{
-		nats.Name("nauts-policy-provider"),
-	}
-	if cfg.NatsCredentials != "" {
-		opts = append(opts, nats.UserCredentials(cfg.NatsCredentials))
-	} else if cfg.NatsNkey != "" {
-		opt, err := nats.NkeyOptionFromSeed(cfg.NatsNkey)
-		if err != nil {
-			return nil, fmt.Errorf("nats policy provider: loading nkey from %s: %w", cfg.NatsNkey, err)
-		}
-		opts = append(opts, opt)
-	}
-
-	// Connect to NATS
-	nc, err := nats.Connect(cfg.NatsURL, opts...)
+	nc, err := connectPolicyNats(cfg, "nauts-policy-provider")
 	if err != nil {
-		return nil, fmt.Errorf("nats policy provider: connecting to NATS: %w", err)
+		return nil, fmt.Errorf("nats policy provider: %w", err)
 	}
 
 	// Obtain JetStream context and open KV bucket
@@ -121,13 +108,38 @@ func NewNatsPolicyProvider(cfg NatsPolicyProviderConfig) (*NatsPolicyProvider, e
 	p := &NatsPolicyProvider{
 		nc:     nc,
 		kv:     kv,
-		cache:  newCache(cfg.GetCacheTTL()),
 		config: cfg,
-		done:   make(chan struct{}),
+	}
+
+	// Pinned providers read from a snapshot that never changes, so they need
+	// no watcher, and cache under their own prefix, apart from unpinned
+	// replicas sharing a Redis cache.
+	cachePrefix := "nauts:" + cfg.Bucket + ":"
+	if cfg.Revision != "" {
+		revision, err := p.resolveRevision(context.Background(), cfg.Revision)
+		if err == nil {
+			p.snapshot, err = p.loadSnapshot(context.Background(), revision)
+		}
+		if err != nil {
+			nc.Close()
+			return nil, fmt.Errorf("nats policy provider: pinning revision %q: %w", cfg.Revision, err)
+		}
+		cachePrefix = fmt.Sprintf("nauts:%s@%d:", cfg.Bucket, revision)
+	}
+
+	c, err := newProviderCache(cfg.Cache, cfg.GetCacheTTL(), cachePrefix, decodeKVCacheEntry)
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("nats policy provider: %w", err)
+	}
+	p.cache = c
+	if p.snapshot != nil {
+		return p, nil
 	}
 
 	// Start watcher
 	if err := p.startWatcher(); err != nil {
+		_ = c.close()
 		nc.Close()
 		return nil, fmt.Errorf("nats policy provider: starting watcher: %w", err)
 	}
@@ -135,19 +147,21 @@ func NewNatsPolicyProvider(cfg NatsPolicyProviderConfig) (*NatsPolicyProvider, e
 	return p, nil
 }
 
-// Stop stops the KV watcher, closes the NATS connection, and clears the cache.
+// Stop stops the KV watcher, closes the NATS connection, and closes the cache.
 func (p *NatsPolicyProvider) Stop() error {
-	close(p.done)
 	if p.watcher != nil {
-		_ = p.watcher.Stop()
+		p.watcher.stop()
 	}
 	p.nc.Close()
-	p.cache.clear()
-	return nil
+	return p.cache.close()
 }
 
 // GetPolicy retrieves a policy by account and ID from the KV bucket.
+// IDs starting with "builtin:" resolve to the built-in policy library.
 func (p *NatsPolicyProvider) GetPolicy(ctx context.Context, account string, id string) (*policy.Policy, error) {
+	if policy.IsBuiltinID(id) {
+		return builtinPolicy(id)
+	}
 	key := kvPolicyKey(account, id)
 
 	// Check cache
@@ -156,7 +170,7 @@ func (p *NatsPolicyProvider) GetPolicy(ctx context.Context, account string, id s
 	}
 
 	// Fetch from KV
-	entry, err := p.kv.Get(ctx, key)
+	value, err := p.get(ctx, key)
 	if err != nil {
 		if errors.Is(err, jetstream.ErrKeyNotFound) {
 			return nil, ErrPolicyNotFound
@@ -165,7 +179,7 @@ func (p *NatsPolicyProvider) GetPolicy(ctx context.Context, account string, id s
 	}
 
 	var pol policy.Policy
-	if err := json.Unmarshal(entry.Value(), &pol); err != nil {
+	if err := json.Unmarshal(value, &pol); err != nil {
 		return nil, fmt.Errorf("decoding policy %s: %w", key, err)
 	}
 	if err := pol.Validate(); err != nil {
@@ -176,7 +190,8 @@ func (p *NatsPolicyProvider) GetPolicy(ctx context.Context, account string, id s
 	return &pol, nil
 }
 
-// GetPoliciesForRole returns all policies attached to a role.
+// GetPoliciesForRole returns all policies attached to a role, including the
+// policies of the roles it inherits.
 // If the id starts with "_global:", the prefix is stripped and the policy
 // is looked up as a global policy (account="_global").
 func (p *NatsPolicyProvider) GetPoliciesForRole(ctx context.Context, role identity.Role) ([]*policy.Policy, error) {
@@ -189,26 +204,16 @@ func (p *NatsPolicyProvider) GetPoliciesForRole(ctx context.Context, role identi
 		return nil, ErrRoleNotFound
 	}
 
-	b, err := p.getBinding(ctx, role.Account, role.Name)
+	b, err := p.getBinding(ctx, role)
 	if err != nil {
 		return nil, err
 	}
 
-	// Deduplicate and sort policy IDs
-	policyIDs := make([]string, 0, len(b.Policies))
-	seen := make(map[string]struct{})
-	for _, id := range b.Policies {
-		id = strings.TrimSpace(id)
-		if id == "" {
-			continue
-		}
-		if _, ok := seen[id]; ok {
-			continue
-		}
-		seen[id] = struct{}{}
-		policyIDs = append(policyIDs, id)
+	// Policy IDs of the binding and its inherited roles, deduplicated and sorted
+	policyIDs, err := bindingPolicyIDs(ctx, b, p.getBinding)
+	if err != nil {
+		return nil, err
 	}
-	sort.Strings(policyIDs)
 
 	result := make([]*policy.Policy, 0, len(policyIDs))
 	for _, id := range policyIDs {
@@ -241,16 +246,13 @@ func (p *NatsPolicyProvider) GetPolicies(ctx context.Context, account string) ([
 		filters = append(filters, globalAccountPrefix+".policy.>")
 	}
 
-	lister, err := p.kv.ListKeysFiltered(ctx, filters...)
+	keys, err := p.listKeys(ctx, filters...)
 	if err != nil {
-		if errors.Is(err, jetstream.ErrNoKeysFound) {
-			return nil, nil
-		}
 		return nil, fmt.Errorf("listing policy keys: %w", err)
 	}
 
 	var result []*policy.Policy
-	for key := range lister.Keys() {
+	for _, key := range keys {
 		acc, id, ok := parsePolicyKey(key)
 		if !ok {
 			continue
@@ -272,16 +274,16 @@ func (p *NatsPolicyProvider) GetPolicies(ctx context.Context, account string) ([
 }
 
 // getBinding fetches a binding from the cache or KV bucket.
-func (p *NatsPolicyProvider) getBinding(ctx context.Context, account, role string) (*binding, error) {
-	key := kvBindingKey(account, role)
+func (p *NatsPolicyProvider) getBinding(ctx context.Context, role identity.Role) (*Binding, error) {
+	key := kvBindingKey(role)
 
 	// Check cache
 	if cached := p.cache.get(key); cached != nil {
-		return cached.(*binding), nil
+		return cached.(*Binding), nil
 	}
 
 	// Fetch from KV
-	entry, err := p.kv.Get(ctx, key)
+	value, err := p.get(ctx, key)
 	if err != nil {
 		if errors.Is(err, jetstream.ErrKeyNotFound) {
 			return nil, ErrRoleNotFound
@@ -289,8 +291,8 @@ func (p *NatsPolicyProvider) getBinding(ctx context.Context, account, role strin
 		return nil, fmt.Errorf("fetching binding %s: %w", key, err)
 	}
 
-	var b binding
-	if err := json.Unmarshal(entry.Value(), &b); err != nil {
+	var b Binding
+	if err := json.Unmarshal(value, &b); err != nil {
 		return nil, fmt.Errorf("decoding binding %s: %w", key, err)
 	}
 
@@ -298,64 +300,287 @@ func (p *NatsPolicyProvider) getBinding(ctx context.Context, account, role strin
 	return &b, nil
 }
 
-// startWatcher creates a KV watcher on the entire bucket for cache invalidation.
-func (p *NatsPolicyProvider) startWatcher() error {
-	watcher, err := p.kv.WatchAll(context.Background(), jetstream.UpdatesOnly())
+// GetBinding retrieves the binding for an account-scoped role.
+func (p *NatsPolicyProvider) GetBinding(ctx context.Context, role identity.Role) (*Binding, error) {
+	return p.getBinding(ctx, role)
+}
+
+// GetBindings returns all bindings for the given account, sorted by role.
+func (p *NatsPolicyProvider) GetBindings(ctx context.Context, account string) ([]*Binding, error) {
+	account = strings.TrimSpace(account)
+
+	keys, err := p.listKeys(ctx, account+".binding.>")
 	if err != nil {
-		return fmt.Errorf("creating watcher: %w", err)
+		return nil, fmt.Errorf("listing binding keys: %w", err)
 	}
-	p.watcher = watcher
 
-	go p.watchLoop()
-	return nil
+	var result []*Binding
+	for _, key := range keys {
+		role, ok := parseBindingKey(key)
+		if !ok {
+			continue
+		}
+		b, err := p.getBinding(ctx, role)
+		if err != nil {
+			if errors.Is(err, ErrRoleNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		result = append(result, b)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Role < result[j].Role
+	})
+	return result, nil
 }
 
-// watchLoop processes watcher updates and invalidates cache entries.
-func (p *NatsPolicyProvider) watchLoop() {
-	backoff := time.Second
-	const maxBackoff = 30 * time.Second
-
-	for {
-		updates := p.watcher.Updates()
-		for {
-			select {
-			case <-p.done:
-				return
-			case entry, ok := <-updates:
-				if !ok {
-					// Channel closed — try to reconnect
-					goto reconnect
-				}
-				if entry != nil {
-					p.cache.invalidate(entry.Key())
-				}
+// ListPolicies returns the policies of all accounts, sorted by account and ID.
+func (p *NatsPolicyProvider) ListPolicies(ctx context.Context) ([]*policy.Policy, error) {
+	keys, err := p.listKeys(ctx, "*.policy.>")
+	if err != nil {
+		return nil, fmt.Errorf("listing policy keys: %w", err)
+	}
+	sort.Strings(keys)
+
+	var result []*policy.Policy
+	for _, key := range keys {
+		acc, id, ok := parsePolicyKey(key)
+		if !ok {
+			continue
+		}
+		pol, err := p.GetPolicy(ctx, acc, id)
+		if err != nil {
+			if errors.Is(err, ErrPolicyNotFound) {
+				continue
 			}
+			return nil, err
 		}
+		result = append(result, pol)
+	}
+	return result, nil
+}
+
+// ListBindings returns the bindings of all accounts, sorted by account and role.
+func (p *NatsPolicyProvider) ListBindings(ctx context.Context) ([]*Binding, error) {
+	keys, err := p.listKeys(ctx, "*.binding.>")
+	if err != nil {
+		return nil, fmt.Errorf("listing binding keys: %w", err)
+	}
+	sort.Strings(keys)
 
-	reconnect:
-		// Attempt to re-establish the watcher with exponential backoff
-		for {
-			select {
-			case <-p.done:
-				return
-			case <-time.After(backoff):
+	var result []*Binding
+	for _, key := range keys {
+		role, ok := parseBindingKey(key)
+		if !ok {
+			continue
+		}
+		b, err := p.getBinding(ctx, role)
+		if err != nil {
+			if errors.Is(err, ErrRoleNotFound) {
+				continue
 			}
+			return nil, err
+		}
+		result = append(result, b)
+	}
+	return result, nil
+}
+
+// CheckHealth implements PolicyHealthChecker by reading the bucket status.
+func (p *NatsPolicyProvider) CheckHealth(ctx context.Context) error {
+	if _, err := p.kv.Status(ctx); err != nil {
+		return fmt.Errorf("bucket %q unreachable: %w", p.config.Bucket, err)
+	}
+	return nil
+}
+
+// PolicyVersion implements PolicyVersioner. The version changes with every
+// update seen by the KV watcher and every write through the provider.
+func (p *NatsPolicyProvider) PolicyVersion() uint64 {
+	return p.cache.generation()
+}
+
+// PutPolicy creates or replaces a policy in the KV bucket.
+// Global policies (account "*" or "_global") are stored under the "_global" prefix.
+func (p *NatsPolicyProvider) PutPolicy(ctx context.Context, pol *policy.Policy) error {
+	if err := p.checkWritable(); err != nil {
+		return err
+	}
+	if pol == nil {
+		return errors.New("policy is nil")
+	}
+	if err := pol.Validate(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(pol)
+	if err != nil {
+		return fmt.Errorf("encoding policy %s: %w", pol.ID, err)
+	}
+
+	key := kvPolicyKey(kvAccount(pol.Account), pol.ID)
+	if _, err := p.kv.Put(ctx, key, data); err != nil {
+		return fmt.Errorf("putting policy %s: %w", key, err)
+	}
+	p.cache.invalidate(key)
+	return nil
+}
+
+// DeletePolicy removes a policy from the KV bucket.
+func (p *NatsPolicyProvider) DeletePolicy(ctx context.Context, account string, id string) error {
+	if err := p.checkWritable(); err != nil {
+		return err
+	}
+	key := kvPolicyKey(kvAccount(account), id)
+	if err := p.kv.Delete(ctx, key); err != nil && !errors.Is(err, jetstream.ErrKeyNotFound) {
+		return fmt.Errorf("deleting policy %s: %w", key, err)
+	}
+	p.cache.invalidate(key)
+	return nil
+}
 
-			watcher, err := p.kv.WatchAll(context.Background(), jetstream.UpdatesOnly())
-			if err != nil {
-				log.Printf("nats policy provider: watcher reconnect failed: %v", err)
-				backoff *= 2
-				if backoff > maxBackoff {
-					backoff = maxBackoff
+// PutBinding creates or replaces a binding in the KV bucket.
+func (p *NatsPolicyProvider) PutBinding(ctx context.Context, b *Binding) error {
+	if err := p.checkWritable(); err != nil {
+		return err
+	}
+	if b == nil {
+		return errors.New("binding is nil")
+	}
+	if err := b.Validate(); err != nil {
+		return err
+	}
+	if _, err := bindingPolicyIDs(ctx, b, lookupWithBinding(p.getBinding, b)); err != nil {
+		return err
+	}
+	data, err := json.Marshal(b)
+	if err != nil {
+		return fmt.Errorf("encoding binding %s: %w", b.IdentityRole(), err)
+	}
+
+	key := kvBindingKey(b.IdentityRole())
+	if _, err := p.kv.Put(ctx, key, data); err != nil {
+		return fmt.Errorf("putting binding %s: %w", key, err)
+	}
+	p.cache.invalidate(key)
+	return nil
+}
+
+// DeleteBinding removes a binding from the KV bucket.
+func (p *NatsPolicyProvider) DeleteBinding(ctx context.Context, role identity.Role) error {
+	if err := p.checkWritable(); err != nil {
+		return err
+	}
+	key := kvBindingKey(role)
+	if err := p.kv.Delete(ctx, key); err != nil && !errors.Is(err, jetstream.ErrKeyNotFound) {
+		return fmt.Errorf("deleting binding %s: %w", key, err)
+	}
+	p.cache.invalidate(key)
+	return nil
+}
+
+// get returns the value of key, from the snapshot if the provider is pinned.
+// Missing keys return jetstream.ErrKeyNotFound.
+func (p *NatsPolicyProvider) get(ctx context.Context, key string) ([]byte, error) {
+	if p.snapshot != nil {
+		value, ok := p.snapshot[key]
+		if !ok {
+			return nil, jetstream.ErrKeyNotFound
+		}
+		return value, nil
+	}
+	entry, err := p.kv.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return entry.Value(), nil
+}
+
+// listKeys returns the keys matching any of filters, from the snapshot if
+// the provider is pinned.
+func (p *NatsPolicyProvider) listKeys(ctx context.Context, filters ...string) ([]string, error) {
+	var keys []string
+	if p.snapshot != nil {
+		for key := range p.snapshot {
+			for _, filter := range filters {
+				if kvKeyMatches(key, filter) {
+					keys = append(keys, key)
+					break
 				}
-				continue
 			}
+		}
+		return keys, nil
+	}
+	lister, err := p.kv.ListKeysFiltered(ctx, filters...)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrNoKeysFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for key := range lister.Keys() {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// startWatcher watches the entire bucket for cache invalidation. The cache
+// is cleared whenever the watcher is re-created.
+func (p *NatsPolicyProvider) startWatcher() error {
+	p.watcher = newKVWatchLoop(func(ctx context.Context) (jetstream.KeyWatcher, error) {
+		return p.kv.WatchAll(ctx, jetstream.UpdatesOnly())
+	}, p.cache.invalidate, p.cache.clear)
+	if err := p.watcher.start(); err != nil {
+		return fmt.Errorf("creating watcher: %w", err)
+	}
+	return nil
+}
+
+// connectPolicyNats connects to the NATS server of cfg with its credentials.
+func connectPolicyNats(cfg NatsPolicyProviderConfig, name string) (*nats.Conn, error) {
+	if cfg.NatsURL == "" {
+		cfg.NatsURL = nats.DefaultURL
+	}
+	if url := os.Getenv("NATS_URL"); url != "" {
+		cfg.NatsURL = url
+	}
+	if cfg.NatsCredentials != "" && cfg.NatsNkey != "" {
+		return nil, fmt.Errorf("natsCredentials and natsNkey are mutually exclusive")
+	}
 
-			p.watcher = watcher
-			backoff = time.Second
-			break
+	opts := []nats.Option{nats.Name(name)}
+	if cfg.NatsCredentials != "" {
+		opts = append(opts, nats.UserCredentials(cfg.NatsCredentials))
+	} else if cfg.NatsNkey != "" {
+		opt, err := nats.NkeyOptionFromSeed(cfg.NatsNkey)
+		if err != nil {
+			return nil, fmt.Errorf("loading nkey from %s: %w", cfg.NatsNkey, err)
 		}
+		opts = append(opts, opt)
+	}
+
+	nc, err := nats.Connect(cfg.NatsURL, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to NATS: %w", err)
 	}
+	return nc, nil
+}
+
+// decodeKVCacheEntry decodes a cache entry shared through Redis, keyed by
+// its KV key.
+func decodeKVCacheEntry(key string, data []byte) (any, error) {
+	switch {
+	case strings.Contains(key, ".policy."):
+		var pol policy.Policy
+		err := json.Unmarshal(data, &pol)
+		return &pol, err
+	case strings.Contains(key, ".binding."):
+		var b Binding
+		err := json.Unmarshal(data, &b)
+		return &b, err
+	}
+	return nil, fmt.Errorf("unknown cache key %q", key)
 }
 
 // kvPolicyKey builds the KV key for a policy.
@@ -365,8 +590,28 @@ func kvPolicyKey(account string, id string) string {
 }
 
 // kvBindingKey builds the KV key for a binding.
-func kvBindingKey(account string, role string) string {
-	return account + ".binding." + role
+func kvBindingKey(role identity.Role) string {
+	return role.Account + ".binding." + role.Name
+}
+
+// kvAccount maps a policy account to its KV key prefix.
+// The global account "*" is stored under "_global".
+func kvAccount(account string) string {
+	if account == "*" {
+		return globalAccountPrefix
+	}
+	return account
+}
+
+// parseBindingKey extracts the account-scoped role from a KV key.
+// Returns (Role{}, false) if the key does not match the expected pattern.
+func parseBindingKey(key string) (identity.Role, bool) {
+	// Expected format: <account>.binding.<role>
+	parts := strings.SplitN(key, ".", 3)
+	if len(parts) != 3 || parts[1] != "binding" || parts[2] == "" {
+		return identity.Role{}, false
+	}
+	return identity.Role{Account: parts[0], Name: parts[2]}, true
 }
 
 // parsePolicyKey extracts account and policy ID from a KV key.
@@ -48,13 +48,33 @@ func TestKvBindingKey(t *testing.T) {
 		{"_global", "default", "_global.binding.default"},
 	}
 	for _, tt := range tests {
-		got := kvBindingKey(tt.account, tt.role)
+		got := kvBindingKey(identity.Role{Account: tt.account, Name: tt.role})
 		if got != tt.want {
 			t.Errorf("kvBindingKey(%q, %q) = %q, want %q", tt.account, tt.role, got, tt.want)
 		}
 	}
 }
 
+func TestParseBindingKey(t *testing.T) {
+	tests := []struct {
+		key         string
+		wantAccount string
+		wantRole    string
+		wantOK      bool
+	}{
+		{"APP.binding.admin", "APP", "admin", true},
+		{"_global.binding.default", "_global", "default", true},
+		{"APP.policy.read", "", "", false},
+		{"APP.binding.", "", "", false},
+	}
+	for _, tt := range tests {
+		role, ok := parseBindingKey(tt.key)
+		if ok != tt.wantOK || role.Account != tt.wantAccount || role.Name != tt.wantRole {
+			t.Errorf("parseBindingKey(%q) = (%q, %q, %v), want (%q, %q, %v)", tt.key, role.Account, role.Name, ok, tt.wantAccount, tt.wantRole, tt.wantOK)
+		}
+	}
+}
+
 func TestParsePolicyKey(t *testing.T) {
 	tests := []struct {
 		key         string
@@ -192,13 +212,13 @@ func seedPolicy(t *testing.T, kv jetstream.KeyValue, account, id string, pol *po
 	}
 }
 
-func seedBinding(t *testing.T, kv jetstream.KeyValue, account, role string, b *binding) {
+func seedBinding(t *testing.T, kv jetstream.KeyValue, account, role string, b *Binding) {
 	t.Helper()
 	data, err := json.Marshal(b)
 	if err != nil {
 		t.Fatalf("marshaling binding: %v", err)
 	}
-	key := kvBindingKey(account, role)
+	key := kvBindingKey(identity.Role{Account: account, Name: role})
 	if _, err := kv.Put(context.Background(), key, data); err != nil {
 		t.Fatalf("putting binding %s: %v", key, err)
 	}
@@ -315,7 +335,7 @@ func TestNatsPolicyProvider_GetPoliciesForRole(t *testing.T) {
 	})
 
 	// Seed binding
-	seedBinding(t, kv, "APP", "admin", &binding{
+	seedBinding(t, kv, "APP", "admin", &Binding{
 		Role:     "admin",
 		Account:  "APP",
 		Policies: []string{"read-access", "write-access"},
@@ -349,6 +369,54 @@ func TestNatsPolicyProvider_GetPoliciesForRole(t *testing.T) {
 	}
 }
 
+func TestNatsPolicyProvider_GetPoliciesForRole_Inherits(t *testing.T) {
+	srv := startTestNatsServer(t)
+	bucket := "test-get-policies-for-role-inherits"
+	kv := createTestBucket(t, srv.url(), bucket)
+
+	for _, id := range []string{"read-access", "write-access"} {
+		seedPolicy(t, kv, "APP", id, &policy.Policy{
+			ID:      id,
+			Account: "APP",
+			Name:    id,
+			Statements: []policy.Statement{
+				{Effect: "allow", Actions: []policy.Action{"nats.sub"}, Resources: []string{"nats:public.>"}},
+			},
+		})
+	}
+	seedBinding(t, kv, "APP", "readonly", &Binding{Role: "readonly", Account: "APP", Policies: []string{"read-access"}})
+	seedBinding(t, kv, "APP", "admin", &Binding{Role: "admin", Account: "APP", Policies: []string{"write-access"}, Inherits: []string{"readonly"}})
+	// A cycle written around the provider.
+	seedBinding(t, kv, "APP", "a", &Binding{Role: "a", Account: "APP", Inherits: []string{"b"}})
+	seedBinding(t, kv, "APP", "b", &Binding{Role: "b", Account: "APP", Inherits: []string{"a"}})
+
+	provider, err := NewNatsPolicyProvider(NatsPolicyProviderConfig{
+		Bucket:  bucket,
+		NatsURL: srv.url(),
+	})
+	if err != nil {
+		t.Fatalf("creating provider: %v", err)
+	}
+	defer provider.Stop()
+	ctx := context.Background()
+
+	policies, err := provider.GetPoliciesForRole(ctx, identity.Role{Account: "APP", Name: "admin"})
+	if err != nil {
+		t.Fatalf("GetPoliciesForRole() error = %v", err)
+	}
+	if len(policies) != 2 || policies[0].ID != "read-access" || policies[1].ID != "write-access" {
+		t.Errorf("GetPoliciesForRole() = %v, want read-access and write-access", policies)
+	}
+
+	if _, err := provider.GetPoliciesForRole(ctx, identity.Role{Account: "APP", Name: "a"}); !errors.Is(err, ErrRoleInheritanceCycle) {
+		t.Errorf("GetPoliciesForRole() error = %v, want ErrRoleInheritanceCycle", err)
+	}
+	err = provider.PutBinding(ctx, &Binding{Role: "readonly", Account: "APP", Inherits: []string{"admin"}})
+	if !errors.Is(err, ErrRoleInheritanceCycle) {
+		t.Errorf("PutBinding() error = %v, want ErrRoleInheritanceCycle", err)
+	}
+}
+
 func TestNatsPolicyProvider_GetPoliciesForRole_NotFound(t *testing.T) {
 	srv := startTestNatsServer(t)
 	bucket := "test-role-not-found"
@@ -378,7 +446,7 @@ func TestNatsPolicyProvider_GetPoliciesForRole_MissingPolicy(t *testing.T) {
 	kv := createTestBucket(t, srv.url(), bucket)
 
 	// Seed binding referencing a policy that doesn't exist
-	seedBinding(t, kv, "APP", "broken", &binding{
+	seedBinding(t, kv, "APP", "broken", &Binding{
 		Role:     "broken",
 		Account:  "APP",
 		Policies: []string{"nonexistent-policy"},
@@ -592,7 +660,7 @@ func TestNatsPolicyProvider_GetPoliciesForRole_GlobalPolicy(t *testing.T) {
 	})
 
 	// Seed a binding that references both an account policy and a global policy via _global: prefix
-	seedBinding(t, kv, "APP", "mixed", &binding{
+	seedBinding(t, kv, "APP", "mixed", &Binding{
 		Role:     "mixed",
 		Account:  "APP",
 		Policies: []string{"app-read", "_global:base-permissions"},
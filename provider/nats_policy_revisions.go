@@ -0,0 +1,377 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/policy"
+)
+
+// revisionLabelPrefix is the KV key prefix of revision labels.
+const revisionLabelPrefix = "_labels."
+
+var (
+	// ErrRevisionNotFound is returned for revisions that do not exist or are
+	// no longer kept by the bucket.
+	ErrRevisionNotFound = errors.New("revision not found")
+
+	// ErrPinnedRevision is returned for writes to a provider pinned to a
+	// revision.
+	ErrPinnedRevision = errors.New("policy store is pinned to a revision")
+)
+
+// revisionLabelPattern restricts label names to a single KV key token. Names
+// must not be numbers, which NatsPolicyProviderConfig.Revision reads as
+// revisions.
+var revisionLabelPattern = regexp.MustCompile(`^[A-Za-z0-9_-]*[A-Za-z_-][A-Za-z0-9_-]*$`)
+
+// PolicyRevision is a revision of a policy or binding kept in the KV bucket.
+type PolicyRevision struct {
+	// Revision is the bucket revision (stream sequence) of the write.
+	Revision uint64    `json:"revision"`
+	Created  time.Time `json:"created"`
+	// Deleted marks a deletion; Policy and Binding are nil then.
+	Deleted bool           `json:"deleted,omitempty"`
+	Policy  *policy.Policy `json:"policy,omitempty"`
+	Binding *Binding       `json:"binding,omitempty"`
+}
+
+// RevisionLabel names a bucket revision, so that providers can be pinned to
+// it with NatsPolicyProviderConfig.Revision.
+type RevisionLabel struct {
+	Name     string    `json:"name"`
+	Revision uint64    `json:"revision"`
+	Created  time.Time `json:"created"`
+}
+
+// ListPolicyRevisions returns the kept revisions of a policy, oldest first.
+func (p *NatsPolicyProvider) ListPolicyRevisions(ctx context.Context, account string, id string) ([]PolicyRevision, error) {
+	entries, err := p.history(ctx, kvPolicyKey(kvAccount(account), id))
+	if err != nil {
+		return nil, err
+	}
+	revisions := make([]PolicyRevision, 0, len(entries))
+	for _, e := range entries {
+		rev := PolicyRevision{Revision: e.Revision(), Created: e.Created(), Deleted: e.Operation() != jetstream.KeyValuePut}
+		if !rev.Deleted {
+			if rev.Policy, err = decodePolicyRevision(e); err != nil {
+				return nil, err
+			}
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, nil
+}
+
+// ListBindingRevisions returns the kept revisions of a binding, oldest first.
+func (p *NatsPolicyProvider) ListBindingRevisions(ctx context.Context, role identity.Role) ([]PolicyRevision, error) {
+	entries, err := p.history(ctx, kvBindingKey(role))
+	if err != nil {
+		return nil, err
+	}
+	revisions := make([]PolicyRevision, 0, len(entries))
+	for _, e := range entries {
+		rev := PolicyRevision{Revision: e.Revision(), Created: e.Created(), Deleted: e.Operation() != jetstream.KeyValuePut}
+		if !rev.Deleted {
+			if rev.Binding, err = decodeBindingRevision(e); err != nil {
+				return nil, err
+			}
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, nil
+}
+
+// GetPolicyRevision returns a policy as written at revision. It returns
+// ErrRevisionNotFound if the revision is not a write of the policy.
+func (p *NatsPolicyProvider) GetPolicyRevision(ctx context.Context, account string, id string, revision uint64) (*policy.Policy, error) {
+	entry, err := p.revision(ctx, kvPolicyKey(kvAccount(account), id), revision)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Operation() != jetstream.KeyValuePut {
+		return nil, fmt.Errorf("%w: revision %d deletes the policy", ErrRevisionNotFound, revision)
+	}
+	return decodePolicyRevision(entry)
+}
+
+// GetBindingRevision returns a binding as written at revision. It returns
+// ErrRevisionNotFound if the revision is not a write of the binding.
+func (p *NatsPolicyProvider) GetBindingRevision(ctx context.Context, role identity.Role, revision uint64) (*Binding, error) {
+	entry, err := p.revision(ctx, kvBindingKey(role), revision)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Operation() != jetstream.KeyValuePut {
+		return nil, fmt.Errorf("%w: revision %d deletes the binding", ErrRevisionNotFound, revision)
+	}
+	return decodeBindingRevision(entry)
+}
+
+// RollbackPolicy restores a policy to its state at revision by writing it
+// again, or deleting it if revision deleted it. The rollback is itself a new
+// revision, so it can be rolled back in turn.
+func (p *NatsPolicyProvider) RollbackPolicy(ctx context.Context, account string, id string, revision uint64) error {
+	if err := p.checkWritable(); err != nil {
+		return err
+	}
+	entry, err := p.revision(ctx, kvPolicyKey(kvAccount(account), id), revision)
+	if err != nil {
+		return err
+	}
+	if entry.Operation() != jetstream.KeyValuePut {
+		return p.DeletePolicy(ctx, account, id)
+	}
+	pol, err := decodePolicyRevision(entry)
+	if err != nil {
+		return err
+	}
+	return p.PutPolicy(ctx, pol)
+}
+
+// RollbackBinding restores a binding to its state at revision, like
+// RollbackPolicy.
+func (p *NatsPolicyProvider) RollbackBinding(ctx context.Context, role identity.Role, revision uint64) error {
+	if err := p.checkWritable(); err != nil {
+		return err
+	}
+	entry, err := p.revision(ctx, kvBindingKey(role), revision)
+	if err != nil {
+		return err
+	}
+	if entry.Operation() != jetstream.KeyValuePut {
+		return p.DeleteBinding(ctx, role)
+	}
+	b, err := decodeBindingRevision(entry)
+	if err != nil {
+		return err
+	}
+	return p.PutBinding(ctx, b)
+}
+
+// SetRevisionLabel names a bucket revision, or the current one if revision
+// is 0, and returns the labeled revision. Existing labels are moved.
+func (p *NatsPolicyProvider) SetRevisionLabel(ctx context.Context, name string, revision uint64) (uint64, error) {
+	if err := p.checkWritable(); err != nil {
+		return 0, err
+	}
+	if !revisionLabelPattern.MatchString(name) {
+		return 0, fmt.Errorf("invalid revision label %q: use letters, digits, '-' and '_', not only digits", name)
+	}
+	current, err := p.currentRevision(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if revision == 0 {
+		revision = current
+	}
+	if revision > current {
+		return 0, fmt.Errorf("%w: revision %d is newer than the bucket (%d)", ErrRevisionNotFound, revision, current)
+	}
+	data, err := json.Marshal(RevisionLabel{Name: name, Revision: revision, Created: time.Now().UTC()})
+	if err != nil {
+		return 0, fmt.Errorf("encoding revision label %s: %w", name, err)
+	}
+	if _, err := p.kv.Put(ctx, revisionLabelPrefix+name, data); err != nil {
+		return 0, fmt.Errorf("putting revision label %s: %w", name, err)
+	}
+	return revision, nil
+}
+
+// RevisionLabels returns the revision labels of the bucket, sorted by name.
+func (p *NatsPolicyProvider) RevisionLabels(ctx context.Context) ([]RevisionLabel, error) {
+	lister, err := p.kv.ListKeysFiltered(ctx, revisionLabelPrefix+"*")
+	if err != nil {
+		if errors.Is(err, jetstream.ErrNoKeysFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("listing revision labels: %w", err)
+	}
+	var labels []RevisionLabel
+	for key := range lister.Keys() {
+		label, err := p.revisionLabel(ctx, strings.TrimPrefix(key, revisionLabelPrefix))
+		if err != nil {
+			if errors.Is(err, ErrRevisionNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		labels = append(labels, *label)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].Name < labels[j].Name
+	})
+	return labels, nil
+}
+
+// revisionLabel reads the label name.
+func (p *NatsPolicyProvider) revisionLabel(ctx context.Context, name string) (*RevisionLabel, error) {
+	entry, err := p.kv.Get(ctx, revisionLabelPrefix+name)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrKeyNotFound) {
+			return nil, fmt.Errorf("%w: no revision label %q", ErrRevisionNotFound, name)
+		}
+		return nil, fmt.Errorf("fetching revision label %s: %w", name, err)
+	}
+	var label RevisionLabel
+	if err := json.Unmarshal(entry.Value(), &label); err != nil {
+		return nil, fmt.Errorf("decoding revision label %s: %w", name, err)
+	}
+	return &label, nil
+}
+
+// resolveRevision returns the bucket revision that ref, a revision number
+// or label name, refers to.
+func (p *NatsPolicyProvider) resolveRevision(ctx context.Context, ref string) (uint64, error) {
+	if revision, err := strconv.ParseUint(ref, 10, 64); err == nil {
+		return revision, nil
+	}
+	label, err := p.revisionLabel(ctx, ref)
+	if err != nil {
+		return 0, err
+	}
+	return label.Revision, nil
+}
+
+// currentRevision returns the revision of the latest write to the bucket.
+func (p *NatsPolicyProvider) currentRevision(ctx context.Context) (uint64, error) {
+	status, err := p.kv.Status(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("reading bucket status: %w", err)
+	}
+	s, ok := status.(*jetstream.KeyValueBucketStatus)
+	if !ok {
+		return 0, fmt.Errorf("bucket %q does not report its revision", p.config.Bucket)
+	}
+	return s.StreamInfo().State.LastSeq, nil
+}
+
+// loadSnapshot reads the value of every key as of revision. It fails if the
+// bucket may have discarded a value needed for that, since it keeps only a
+// limited number of revisions per key.
+func (p *NatsPolicyProvider) loadSnapshot(ctx context.Context, revision uint64) (map[string][]byte, error) {
+	status, err := p.kv.Status(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading bucket status: %w", err)
+	}
+	limit := status.History()
+	if limit < 2 {
+		return nil, fmt.Errorf("bucket %q keeps no history; pinning a revision requires history > 1", p.config.Bucket)
+	}
+
+	watcher, err := p.kv.WatchAll(ctx, jetstream.IncludeHistory())
+	if err != nil {
+		return nil, fmt.Errorf("reading bucket history: %w", err)
+	}
+	defer watcher.Stop()
+
+	type keyHistory struct {
+		entries int64
+		first   uint64
+		value   jetstream.KeyValueEntry
+	}
+	keys := make(map[string]*keyHistory)
+	for entry := range watcher.Updates() {
+		if entry == nil {
+			break
+		}
+		h := keys[entry.Key()]
+		if h == nil {
+			h = &keyHistory{first: entry.Revision()}
+			keys[entry.Key()] = h
+		}
+		h.entries++
+		if entry.Revision() <= revision {
+			h.value = entry
+		}
+	}
+
+	snapshot := make(map[string][]byte, len(keys))
+	for key, h := range keys {
+		// A key whose kept revisions all follow the pinned one and fill the
+		// history may have had an older value that was discarded.
+		if h.value == nil && h.entries >= limit && h.first > revision {
+			return nil, fmt.Errorf("%w: %s no longer keeps revision %d", ErrRevisionNotFound, key, revision)
+		}
+		if h.value != nil && h.value.Operation() == jetstream.KeyValuePut {
+			snapshot[key] = h.value.Value()
+		}
+	}
+	return snapshot, nil
+}
+
+// checkWritable rejects writes to a pinned provider.
+func (p *NatsPolicyProvider) checkWritable() error {
+	if p.snapshot != nil {
+		return fmt.Errorf("%w %q", ErrPinnedRevision, p.config.Revision)
+	}
+	return nil
+}
+
+// history returns the kept entries of key, oldest first.
+func (p *NatsPolicyProvider) history(ctx context.Context, key string) ([]jetstream.KeyValueEntry, error) {
+	entries, err := p.kv.History(ctx, key)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrKeyNotFound) {
+			return nil, fmt.Errorf("%w: no revisions of %s", ErrRevisionNotFound, key)
+		}
+		return nil, fmt.Errorf("reading history of %s: %w", key, err)
+	}
+	return entries, nil
+}
+
+// revision returns the kept entry of key at revision.
+func (p *NatsPolicyProvider) revision(ctx context.Context, key string, revision uint64) (jetstream.KeyValueEntry, error) {
+	entries, err := p.history(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.Revision() == revision {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s has no revision %d", ErrRevisionNotFound, key, revision)
+}
+
+func decodePolicyRevision(entry jetstream.KeyValueEntry) (*policy.Policy, error) {
+	var pol policy.Policy
+	if err := json.Unmarshal(entry.Value(), &pol); err != nil {
+		return nil, fmt.Errorf("decoding policy %s at revision %d: %w", entry.Key(), entry.Revision(), err)
+	}
+	return &pol, nil
+}
+
+func decodeBindingRevision(entry jetstream.KeyValueEntry) (*Binding, error) {
+	var b Binding
+	if err := json.Unmarshal(entry.Value(), &b); err != nil {
+		return nil, fmt.Errorf("decoding binding %s at revision %d: %w", entry.Key(), entry.Revision(), err)
+	}
+	return &b, nil
+}
+
+// kvKeyMatches reports whether key matches filter, a KV key pattern with the
+// wildcards "*" and ">".
+func kvKeyMatches(key, filter string) bool {
+	keyTokens := strings.Split(key, ".")
+	filterTokens := strings.Split(filter, ".")
+	for i, f := range filterTokens {
+		if f == ">" {
+			return len(keyTokens) > i
+		}
+		if i >= len(keyTokens) || (f != "*" && f != keyTokens[i]) {
+			return false
+		}
+	}
+	return len(keyTokens) == len(filterTokens)
+}
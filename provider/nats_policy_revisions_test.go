@@ -0,0 +1,208 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/policy"
+)
+
+func TestKvKeyMatches(t *testing.T) {
+	tests := []struct {
+		key, filter string
+		want        bool
+	}{
+		{"APP.policy.read", "APP.policy.>", true},
+		{"APP.policy.read", "*.policy.>", true},
+		{"APP.binding.read", "*.policy.>", false},
+		{"APP.policy", "APP.policy.>", false},
+		{"_labels.v1", "_labels.*", true},
+		{"_labels.v1.x", "_labels.*", false},
+	}
+	for _, tt := range tests {
+		if got := kvKeyMatches(tt.key, tt.filter); got != tt.want {
+			t.Errorf("kvKeyMatches(%q, %q) = %v, want %v", tt.key, tt.filter, got, tt.want)
+		}
+	}
+}
+
+// createTestHistoryBucket creates a bucket keeping history revisions per key.
+func createTestHistoryBucket(t *testing.T, url, bucket string, history uint8) jetstream.KeyValue {
+	t.Helper()
+
+	nc, err := nats.Connect(url)
+	if err != nil {
+		t.Fatalf("connecting for bucket creation: %v", err)
+	}
+	t.Cleanup(func() { nc.Close() })
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatalf("creating jetstream context: %v", err)
+	}
+	kv, err := js.CreateKeyValue(context.Background(), jetstream.KeyValueConfig{Bucket: bucket, History: history})
+	if err != nil {
+		t.Fatalf("creating bucket %q: %v", bucket, err)
+	}
+	return kv
+}
+
+func revisionTestPolicy(name string) *policy.Policy {
+	return &policy.Policy{
+		ID: "orders", Account: "APP", Name: name,
+		Statements: []policy.Statement{{Effect: "allow", Actions: []policy.Action{"nats.sub"}, Resources: []string{"nats:orders.>"}}},
+	}
+}
+
+func TestNatsPolicyProvider_Revisions(t *testing.T) {
+	srv := startTestNatsServer(t)
+	bucket := "test-revisions"
+	createTestHistoryBucket(t, srv.url(), bucket, 10)
+
+	p, err := NewNatsPolicyProvider(NatsPolicyProviderConfig{Bucket: bucket, NatsURL: srv.url()})
+	if err != nil {
+		t.Fatalf("creating provider: %v", err)
+	}
+	defer p.Stop()
+	ctx := context.Background()
+
+	for _, name := range []string{"v1", "v2"} {
+		if err := p.PutPolicy(ctx, revisionTestPolicy(name)); err != nil {
+			t.Fatalf("PutPolicy(%s) error = %v", name, err)
+		}
+	}
+	if err := p.DeletePolicy(ctx, "APP", "orders"); err != nil {
+		t.Fatalf("DeletePolicy() error = %v", err)
+	}
+
+	revisions, err := p.ListPolicyRevisions(ctx, "APP", "orders")
+	if err != nil {
+		t.Fatalf("ListPolicyRevisions() error = %v", err)
+	}
+	if len(revisions) != 3 || revisions[0].Policy.Name != "v1" || revisions[1].Policy.Name != "v2" || !revisions[2].Deleted {
+		t.Fatalf("ListPolicyRevisions() = %+v", revisions)
+	}
+
+	pol, err := p.GetPolicyRevision(ctx, "APP", "orders", revisions[0].Revision)
+	if err != nil || pol.Name != "v1" {
+		t.Errorf("GetPolicyRevision() = %v, %v, want v1", pol, err)
+	}
+	if _, err := p.GetPolicyRevision(ctx, "APP", "orders", revisions[2].Revision); !errors.Is(err, ErrRevisionNotFound) {
+		t.Errorf("GetPolicyRevision(deletion) error = %v, want ErrRevisionNotFound", err)
+	}
+	if _, err := p.GetPolicyRevision(ctx, "APP", "orders", 999); !errors.Is(err, ErrRevisionNotFound) {
+		t.Errorf("GetPolicyRevision(999) error = %v, want ErrRevisionNotFound", err)
+	}
+
+	if err := p.RollbackPolicy(ctx, "APP", "orders", revisions[0].Revision); err != nil {
+		t.Fatalf("RollbackPolicy() error = %v", err)
+	}
+	if pol, err := p.GetPolicy(ctx, "APP", "orders"); err != nil || pol.Name != "v1" {
+		t.Errorf("GetPolicy() after rollback = %v, %v, want v1", pol, err)
+	}
+	if err := p.RollbackPolicy(ctx, "APP", "orders", revisions[2].Revision); err != nil {
+		t.Fatalf("RollbackPolicy(deletion) error = %v", err)
+	}
+	if _, err := p.GetPolicy(ctx, "APP", "orders"); !errors.Is(err, ErrPolicyNotFound) {
+		t.Errorf("GetPolicy() after rollback to deletion error = %v, want ErrPolicyNotFound", err)
+	}
+
+	role := identity.Role{Account: "APP", Name: "workers"}
+	if err := p.PutBinding(ctx, &Binding{Role: "workers", Account: "APP", Policies: []string{"a"}}); err != nil {
+		t.Fatalf("PutBinding() error = %v", err)
+	}
+	if err := p.PutBinding(ctx, &Binding{Role: "workers", Account: "APP", Policies: []string{"b"}}); err != nil {
+		t.Fatalf("PutBinding() error = %v", err)
+	}
+	bindingRevisions, err := p.ListBindingRevisions(ctx, role)
+	if err != nil || len(bindingRevisions) != 2 {
+		t.Fatalf("ListBindingRevisions() = %+v, %v", bindingRevisions, err)
+	}
+	if err := p.RollbackBinding(ctx, role, bindingRevisions[0].Revision); err != nil {
+		t.Fatalf("RollbackBinding() error = %v", err)
+	}
+	if b, err := p.GetBinding(ctx, role); err != nil || b.Policies[0] != "a" {
+		t.Errorf("GetBinding() after rollback = %+v, %v", b, err)
+	}
+}
+
+func TestNatsPolicyProvider_PinnedRevision(t *testing.T) {
+	srv := startTestNatsServer(t)
+	bucket := "test-pinned-revision"
+	createTestHistoryBucket(t, srv.url(), bucket, 10)
+	cfg := NatsPolicyProviderConfig{Bucket: bucket, NatsURL: srv.url()}
+
+	p, err := NewNatsPolicyProvider(cfg)
+	if err != nil {
+		t.Fatalf("creating provider: %v", err)
+	}
+	defer p.Stop()
+	ctx := context.Background()
+
+	if err := p.PutPolicy(ctx, revisionTestPolicy("good")); err != nil {
+		t.Fatalf("PutPolicy() error = %v", err)
+	}
+	if err := p.PutBinding(ctx, &Binding{Role: "workers", Account: "APP", Policies: []string{"orders"}}); err != nil {
+		t.Fatalf("PutBinding() error = %v", err)
+	}
+	labeled, err := p.SetRevisionLabel(ctx, "stable", 0)
+	if err != nil {
+		t.Fatalf("SetRevisionLabel() error = %v", err)
+	}
+	if _, err := p.SetRevisionLabel(ctx, "123", 0); err == nil {
+		t.Error("SetRevisionLabel(numeric name) expected error")
+	}
+
+	// A bad push after the label: the policy changes and the binding is deleted.
+	if err := p.PutPolicy(ctx, revisionTestPolicy("bad")); err != nil {
+		t.Fatalf("PutPolicy() error = %v", err)
+	}
+	if err := p.DeleteBinding(ctx, identity.Role{Account: "APP", Name: "workers"}); err != nil {
+		t.Fatalf("DeleteBinding() error = %v", err)
+	}
+
+	labels, err := p.RevisionLabels(ctx)
+	if err != nil || len(labels) != 1 || labels[0].Name != "stable" || labels[0].Revision != labeled {
+		t.Fatalf("RevisionLabels() = %+v, %v", labels, err)
+	}
+
+	pinnedCfg := cfg
+	pinnedCfg.Revision = "stable"
+	pinned, err := NewNatsPolicyProvider(pinnedCfg)
+	if err != nil {
+		t.Fatalf("creating pinned provider: %v", err)
+	}
+	defer pinned.Stop()
+
+	policies, err := pinned.GetPoliciesForRole(ctx, identity.Role{Account: "APP", Name: "workers"})
+	if err != nil || len(policies) != 1 || policies[0].Name != "good" {
+		t.Fatalf("pinned GetPoliciesForRole() = %+v, %v, want the labeled policy", policies, err)
+	}
+	if bindings, err := pinned.ListBindings(ctx); err != nil || len(bindings) != 1 {
+		t.Errorf("pinned ListBindings() = %+v, %v", bindings, err)
+	}
+	if err := pinned.PutPolicy(ctx, revisionTestPolicy("other")); !errors.Is(err, ErrPinnedRevision) {
+		t.Errorf("pinned PutPolicy() error = %v, want ErrPinnedRevision", err)
+	}
+
+	pinnedCfg.Revision = "missing"
+	if _, err := NewNatsPolicyProvider(pinnedCfg); !errors.Is(err, ErrRevisionNotFound) {
+		t.Errorf("unknown label error = %v, want ErrRevisionNotFound", err)
+	}
+}
+
+func TestNatsPolicyProvider_PinnedRevision_NoHistory(t *testing.T) {
+	srv := startTestNatsServer(t)
+	bucket := "test-pinned-no-history"
+	createTestBucket(t, srv.url(), bucket)
+
+	_, err := NewNatsPolicyProvider(NatsPolicyProviderConfig{Bucket: bucket, NatsURL: srv.url(), Revision: "1"})
+	if err == nil {
+		t.Fatal("expected error for a bucket without history")
+	}
+}
@@ -0,0 +1,144 @@
+package provider
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	// defaultWatchBackoff is the initial delay before re-creating a watcher
+	// whose updates channel closed.
+	defaultWatchBackoff = time.Second
+
+	// defaultMaxWatchBackoff caps the delay between failed attempts.
+	defaultMaxWatchBackoff = 30 * time.Second
+)
+
+// watchFactory creates a KV watcher. It must give up when ctx is cancelled.
+type watchFactory func(ctx context.Context) (jetstream.KeyWatcher, error)
+
+// kvWatchLoop keeps a KV watcher running until it is stopped. It calls
+// onUpdate with the key of every update, and onReset whenever the watcher
+// had to be re-created, since updates may have been missed in between.
+//
+// The current watcher is owned by the loop goroutine: it is only created,
+// replaced, and stopped there, so it needs no locking.
+type kvWatchLoop struct {
+	watch    watchFactory
+	onUpdate func(key string)
+	onReset  func()
+
+	backoff    time.Duration
+	maxBackoff time.Duration
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newKVWatchLoop(watch watchFactory, onUpdate func(string), onReset func()) *kvWatchLoop {
+	return &kvWatchLoop{
+		watch:      watch,
+		onUpdate:   onUpdate,
+		onReset:    onReset,
+		backoff:    defaultWatchBackoff,
+		maxBackoff: defaultMaxWatchBackoff,
+	}
+}
+
+// start creates the first watcher, returning its error, and runs the loop
+// in a goroutine.
+func (l *kvWatchLoop) start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	watcher, err := l.watch(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+	l.cancel = cancel
+	l.done = make(chan struct{})
+	go l.run(ctx, watcher)
+	return nil
+}
+
+// stop cancels the loop and waits until it has stopped its watcher. It is
+// safe to call more than once.
+func (l *kvWatchLoop) stop() {
+	if l.cancel == nil {
+		return
+	}
+	l.cancel()
+	<-l.done
+}
+
+func (l *kvWatchLoop) run(ctx context.Context, watcher jetstream.KeyWatcher) {
+	defer close(l.done)
+	for {
+		l.drain(ctx, watcher)
+		_ = watcher.Stop()
+		if ctx.Err() != nil {
+			return
+		}
+
+		watcher = l.rewatch(ctx)
+		if watcher == nil {
+			return
+		}
+		l.onReset()
+	}
+}
+
+// drain delivers updates until the channel closes or ctx is cancelled.
+func (l *kvWatchLoop) drain(ctx context.Context, watcher jetstream.KeyWatcher) {
+	updates := watcher.Updates()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case entry, ok := <-updates:
+			if !ok {
+				return
+			}
+			if entry != nil {
+				l.onUpdate(entry.Key())
+			}
+		}
+	}
+}
+
+// rewatch re-creates the watcher with jittered exponential backoff. It
+// returns nil once ctx is cancelled.
+func (l *kvWatchLoop) rewatch(ctx context.Context) jetstream.KeyWatcher {
+	backoff := l.backoff
+	for {
+		timer := time.NewTimer(jitter(backoff))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+
+		watcher, err := l.watch(ctx)
+		if err == nil {
+			return watcher
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		log.Printf("nats policy provider: watcher reconnect failed: %v", err)
+		backoff = min(backoff*2, l.maxBackoff)
+	}
+}
+
+// jitter returns a random duration in [d/2, 3d/2), so that providers that
+// lost their watchers at the same time do not retry in lockstep.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d)
+}
@@ -0,0 +1,203 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// fakeWatcher is a KeyWatcher whose updates are sent by the test.
+type fakeWatcher struct {
+	updates chan jetstream.KeyValueEntry
+	stopped atomic.Bool
+}
+
+func newFakeWatcher() *fakeWatcher {
+	return &fakeWatcher{updates: make(chan jetstream.KeyValueEntry)}
+}
+
+func (w *fakeWatcher) Updates() <-chan jetstream.KeyValueEntry { return w.updates }
+
+func (w *fakeWatcher) Stop() error {
+	w.stopped.Store(true)
+	return nil
+}
+
+type fakeEntry struct {
+	jetstream.KeyValueEntry
+	key string
+}
+
+func (e fakeEntry) Key() string { return e.key }
+
+// fakeWatchFactory hands out the watchers sent on next, or fails while err
+// is set.
+type fakeWatchFactory struct {
+	next  chan *fakeWatcher
+	calls atomic.Int32
+	mu    sync.Mutex
+	err   error
+}
+
+func (f *fakeWatchFactory) watch(ctx context.Context) (jetstream.KeyWatcher, error) {
+	f.calls.Add(1)
+	f.mu.Lock()
+	err := f.err
+	f.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case w := <-f.next:
+		return w, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (f *fakeWatchFactory) setErr(err error) {
+	f.mu.Lock()
+	f.err = err
+	f.mu.Unlock()
+}
+
+// watchRecorder records the callbacks of a kvWatchLoop.
+type watchRecorder struct {
+	keys   chan string
+	resets chan struct{}
+}
+
+func newWatchRecorder() *watchRecorder {
+	return &watchRecorder{keys: make(chan string, 10), resets: make(chan struct{}, 10)}
+}
+
+func (r *watchRecorder) loop(f *fakeWatchFactory) *kvWatchLoop {
+	l := newKVWatchLoop(f.watch, func(key string) { r.keys <- key }, func() { r.resets <- struct{}{} })
+	l.backoff = time.Millisecond
+	l.maxBackoff = 4 * time.Millisecond
+	return l
+}
+
+func receive[T any](t *testing.T, ch <-chan T, what string) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+		var zero T
+		return zero
+	}
+}
+
+func TestKVWatchLoop_UpdatesAndReconnect(t *testing.T) {
+	f := &fakeWatchFactory{next: make(chan *fakeWatcher, 1)}
+	r := newWatchRecorder()
+	l := r.loop(f)
+
+	first := newFakeWatcher()
+	f.next <- first
+	if err := l.start(); err != nil {
+		t.Fatalf("start() error = %v", err)
+	}
+	defer l.stop()
+
+	first.updates <- fakeEntry{key: "APP.policy.p1"}
+	if got := receive(t, r.keys, "update"); got != "APP.policy.p1" {
+		t.Errorf("onUpdate(%q), want APP.policy.p1", got)
+	}
+
+	// A closed channel re-creates the watcher, retrying failures, and resets
+	// the cache once the new watcher is up.
+	f.setErr(errors.New("no responders"))
+	close(first.updates)
+	for f.calls.Load() < 4 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-r.resets:
+		t.Fatal("onReset called before a watcher was re-created")
+	default:
+	}
+	second := newFakeWatcher()
+	f.next <- second
+	f.setErr(nil)
+	receive(t, r.resets, "reset")
+	if !first.stopped.Load() {
+		t.Error("closed watcher was not stopped")
+	}
+
+	second.updates <- fakeEntry{key: "APP.binding.r1"}
+	if got := receive(t, r.keys, "update"); got != "APP.binding.r1" {
+		t.Errorf("onUpdate(%q), want APP.binding.r1", got)
+	}
+
+	l.stop()
+	if !second.stopped.Load() {
+		t.Error("stop() did not stop the current watcher")
+	}
+}
+
+func TestKVWatchLoop_StopCancelsReconnect(t *testing.T) {
+	tests := []struct {
+		name string
+		// failing makes the factory fail, so stop happens during backoff;
+		// otherwise it blocks in the factory until ctx is cancelled.
+		failing bool
+	}{
+		{"during backoff", true},
+		{"during watch", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeWatchFactory{next: make(chan *fakeWatcher, 1)}
+			l := newWatchRecorder().loop(f)
+
+			first := newFakeWatcher()
+			f.next <- first
+			if err := l.start(); err != nil {
+				t.Fatalf("start() error = %v", err)
+			}
+			if tt.failing {
+				f.setErr(errors.New("no responders"))
+			}
+			close(first.updates)
+			for f.calls.Load() < 2 {
+				time.Sleep(time.Millisecond)
+			}
+
+			stopped := make(chan struct{})
+			go func() {
+				l.stop()
+				close(stopped)
+			}()
+			receive(t, stopped, "stop")
+			l.stop() // idempotent
+		})
+	}
+}
+
+func TestKVWatchLoop_StartError(t *testing.T) {
+	f := &fakeWatchFactory{err: errors.New("bucket not found")}
+	l := newWatchRecorder().loop(f)
+	if err := l.start(); err == nil {
+		t.Fatal("start() succeeded with a failing factory")
+	}
+	l.stop() // no loop to stop
+}
+
+func TestJitter(t *testing.T) {
+	for range 100 {
+		if got := jitter(time.Second); got < 500*time.Millisecond || got >= 1500*time.Millisecond {
+			t.Fatalf("jitter(1s) = %v, want within [500ms, 1.5s)", got)
+		}
+	}
+	if got := jitter(0); got != 0 {
+		t.Errorf("jitter(0) = %v, want 0", got)
+	}
+}
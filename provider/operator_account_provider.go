@@ -3,6 +3,10 @@ package provider
 import (
 	"context"
 	"fmt"
+
+	"github.com/nats-io/nkeys"
+
+	"github.com/msimon/nauts/jwt"
 )
 
 // OperatorAccountProvider implements AccountProvider for NATS operator mode.
@@ -10,12 +14,28 @@ import (
 // users across all accounts using account signing keys.
 type OperatorAccountProvider struct {
 	accounts map[string]*Account
+	limits   map[string]*AccountLimits
+
+	// operatorSigner signs the account JWTs of the accounts in claims; nil
+	// if account JWTs are not managed.
+	operatorSigner jwt.Signer
+	claims         map[string]AccountClaimsConfig
+	keys           *keyLoader
 }
 
 // OperatorAccountProviderConfig holds configuration for the OperatorAccountProvider.
 type OperatorAccountProviderConfig struct {
 	// Accounts maps account names to their signing configuration.
 	Accounts map[string]AccountSigningConfig `json:"accounts"`
+
+	// Manage optionally lets nauts generate the JWTs of the accounts with
+	// claims and push them to the account resolver. Nil leaves the account
+	// JWTs to be maintained manually.
+	Manage *AccountManageConfig `json:"manage,omitempty"`
+
+	// Vault configures the connection for key paths that are vault://
+	// references. Nil uses the VAULT_* environment variables.
+	Vault *VaultConfig `json:"vault,omitempty"`
 }
 
 // AccountSigningConfig holds the signing configuration for an account.
@@ -23,18 +43,43 @@ type AccountSigningConfig struct {
 	// PublicKey is the account's public key (starts with 'A').
 	PublicKey string `json:"publicKey"`
 
-	// SigningKeyPath is the path to the account signing key file (.nk file).
+	// SigningKeyPath is the path to the account signing key file (.nk file)
+	// or a vault:// reference (see VaultScheme).
 	SigningKeyPath string `json:"signingKeyPath"`
+
+	// JWTPath is the optional path to the account JWT (e.g. exported with
+	// `nsc describe account --raw`). Its limits are used to warn about
+	// permissions the account cannot use.
+	JWTPath string `json:"jwtPath,omitempty"`
+
+	// Claims optionally describes the account JWT generated by nauts. Only
+	// used with manage.
+	Claims *AccountClaimsConfig `json:"claims,omitempty"`
 }
 
 // NewOperatorAccountProvider creates a new OperatorAccountProvider from configuration.
-func NewOperatorAccountProvider(cfg OperatorAccountProviderConfig) (*OperatorAccountProvider, error) {
+func NewOperatorAccountProvider(cfg OperatorAccountProviderConfig) (_ *OperatorAccountProvider, err error) {
 	if len(cfg.Accounts) == 0 {
 		return nil, fmt.Errorf("at least one account is required")
 	}
 
 	provider := &OperatorAccountProvider{
 		accounts: make(map[string]*Account),
+		limits:   make(map[string]*AccountLimits),
+		claims:   make(map[string]AccountClaimsConfig),
+		keys:     &keyLoader{vaultConfig: cfg.Vault},
+	}
+	defer func() {
+		if err != nil {
+			_ = provider.keys.stop()
+		}
+	}()
+	if cfg.Manage != nil {
+		signer, err := loadOperatorSigner(provider.keys, cfg.Manage)
+		if err != nil {
+			return nil, fmt.Errorf("manage: %w", err)
+		}
+		provider.operatorSigner = signer
 	}
 
 	for name, accCfg := range cfg.Accounts {
@@ -48,7 +93,7 @@ func NewOperatorAccountProvider(cfg OperatorAccountProviderConfig) (*OperatorAcc
 			return nil, fmt.Errorf("signingKeyPath is required for account %s", name)
 		}
 
-		signer, err := loadSignerFromFile(accCfg.SigningKeyPath)
+		signer, err := provider.keys.load(accCfg.SigningKeyPath, nkeys.PrefixByteAccount)
 		if err != nil {
 			return nil, fmt.Errorf("loading signer for account %s: %w", name, err)
 		}
@@ -58,6 +103,21 @@ func NewOperatorAccountProvider(cfg OperatorAccountProviderConfig) (*OperatorAcc
 			publicKey: accCfg.PublicKey,
 			signer:    signer,
 		}
+
+		if accCfg.JWTPath != "" {
+			claims, err := loadAccountJWT(accCfg.JWTPath, accCfg.PublicKey)
+			if err != nil {
+				return nil, fmt.Errorf("loading JWT for account %s: %w", name, err)
+			}
+			provider.limits[name] = accountLimitsFromClaims(claims)
+		}
+
+		if accCfg.Claims != nil {
+			if err := validateAccountClaims(*accCfg.Claims); err != nil {
+				return nil, fmt.Errorf("claims of account %s: %w", name, err)
+			}
+			provider.claims[name] = *accCfg.Claims
+		}
 	}
 
 	return provider, nil
@@ -81,6 +141,20 @@ func (p *OperatorAccountProvider) ListAccounts(ctx context.Context) ([]*Account,
 	return accounts, nil
 }
 
+// GetAccountLimits returns the limits of the account JWT, or nil if the
+// account has no jwtPath.
+func (p *OperatorAccountProvider) GetAccountLimits(ctx context.Context, name string) (*AccountLimits, error) {
+	if _, ok := p.accounts[name]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAccountNotFound, name)
+	}
+	return p.limits[name], nil
+}
+
+// Stop ends the Vault token renewal of Transit signing keys, if any.
+func (p *OperatorAccountProvider) Stop() error {
+	return p.keys.stop()
+}
+
 // IsOperatorMode returns true as this provider operates in NATS operator mode.
 func (p *OperatorAccountProvider) IsOperatorMode() bool {
 	return true
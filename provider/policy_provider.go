@@ -2,6 +2,7 @@ package provider
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/msimon/nauts/identity"
 	"github.com/msimon/nauts/policy"
@@ -15,6 +16,8 @@ type PolicyProvider interface {
 
 	// GetPoliciesForRole returns all policies attached to a role for the given account.
 	// Implementations may support both global roles (role.Account="*") and account-local roles.
+	// The policies of roles the binding inherits (Binding.Inherits) are included,
+	// transitively; inheritance cycles are reported as ErrRoleInheritanceCycle.
 	// Returns ErrRoleNotFound if no role definition exists for the role.
 	GetPoliciesForRole(ctx context.Context, role identity.Role) ([]*policy.Policy, error)
 
@@ -23,3 +26,65 @@ type PolicyProvider interface {
 	// in addition to account-local policies (policy.Account == account).
 	GetPolicies(ctx context.Context, account string) ([]*policy.Policy, error)
 }
+
+// BindingProvider is optionally implemented by policy providers that expose
+// role bindings, e.g. to read binding-level settings such as MaxTTL.
+type BindingProvider interface {
+	// GetBinding retrieves the binding for an account-scoped role.
+	// Returns ErrRoleNotFound if the binding does not exist.
+	GetBinding(ctx context.Context, role identity.Role) (*Binding, error)
+}
+
+// PolicyVersioner is optionally implemented by policy providers that detect
+// changes to their policies and bindings, so that results derived from them
+// can be cached until the next change.
+type PolicyVersioner interface {
+	// PolicyVersion returns a counter that changes whenever a policy or
+	// binding may have changed.
+	PolicyVersion() uint64
+}
+
+// PolicyHealthChecker is optionally implemented by policy providers that
+// read from an external store, to report whether it is reachable.
+type PolicyHealthChecker interface {
+	// CheckHealth returns an error if policies cannot currently be read.
+	CheckHealth(ctx context.Context) error
+}
+
+// PolicyStore is a PolicyProvider that also supports managing policies and bindings.
+type PolicyStore interface {
+	PolicyProvider
+	BindingProvider
+
+	// GetBindings returns all bindings for the given account.
+	GetBindings(ctx context.Context, account string) ([]*Binding, error)
+
+	// ListPolicies returns the policies of all accounts, including global policies.
+	ListPolicies(ctx context.Context) ([]*policy.Policy, error)
+
+	// ListBindings returns the bindings of all accounts.
+	ListBindings(ctx context.Context) ([]*Binding, error)
+
+	// PutPolicy creates or replaces a policy.
+	PutPolicy(ctx context.Context, pol *policy.Policy) error
+
+	// DeletePolicy removes a policy. Deleting a missing policy is not an error.
+	DeletePolicy(ctx context.Context, account string, id string) error
+
+	// PutBinding creates or replaces a binding.
+	PutBinding(ctx context.Context, b *Binding) error
+
+	// DeleteBinding removes a binding. Deleting a missing binding is not an error.
+	DeleteBinding(ctx context.Context, role identity.Role) error
+}
+
+// builtinPolicy resolves an ID of the built-in policy library (see
+// policy.Builtin). Unknown templates and invalid arguments are reported as
+// ErrPolicyNotFound, like a missing stored policy.
+func builtinPolicy(id string) (*policy.Policy, error) {
+	pol, err := policy.Builtin(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPolicyNotFound, err)
+	}
+	return pol, nil
+}
@@ -0,0 +1,231 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ReconcileOptions controls how a target store is brought in line with a source.
+type ReconcileOptions struct {
+	// DryRun computes the drift without writing to the target.
+	DryRun bool
+	// Prune deletes policies and bindings that exist only in the target.
+	Prune bool
+}
+
+// ReconcileResult reports the outcome of a single reconciliation.
+type ReconcileResult struct {
+	// Diff is the drift found before applying changes.
+	Diff *StoreDiff `json:"diff"`
+	// Applied is the number of entries written to or deleted from the target.
+	Applied int `json:"applied"`
+	// DryRun is true if no changes were written.
+	DryRun bool `json:"dryRun"`
+}
+
+// ReconcilePolicyStores makes target match source.
+//
+// Missing and changed entries are written to the target; extra entries are
+// deleted only if opts.Prune is set. Policies are written before the bindings
+// that reference them, and bindings are deleted before policies.
+// On error, the result contains the number of changes applied so far.
+func ReconcilePolicyStores(ctx context.Context, source, target PolicyStore, opts ReconcileOptions) (*ReconcileResult, error) {
+	diff, err := DiffPolicyStores(ctx, source, target)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ReconcileResult{Diff: diff, DryRun: opts.DryRun}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	// Writes: entries are sorted with policies before bindings.
+	for _, e := range diff.Entries {
+		if e.Kind == DiffExtra {
+			continue
+		}
+		var err error
+		if e.Type == DiffEntryPolicy {
+			err = target.PutPolicy(ctx, e.SourcePolicy)
+		} else {
+			err = target.PutBinding(ctx, e.SourceBinding)
+		}
+		if err != nil {
+			return result, fmt.Errorf("writing %s %s.%s: %w", e.Type, e.Account, e.Name, err)
+		}
+		result.Applied++
+	}
+
+	if !opts.Prune {
+		return result, nil
+	}
+
+	// Deletes: bindings first so no binding references a removed policy.
+	for i := len(diff.Entries) - 1; i >= 0; i-- {
+		e := diff.Entries[i]
+		if e.Kind != DiffExtra {
+			continue
+		}
+		var err error
+		if e.Type == DiffEntryPolicy {
+			err = target.DeletePolicy(ctx, e.TargetPolicy.Account, e.TargetPolicy.ID)
+		} else {
+			err = target.DeleteBinding(ctx, e.TargetBinding.IdentityRole())
+		}
+		if err != nil {
+			return result, fmt.Errorf("deleting %s %s.%s: %w", e.Type, e.Account, e.Name, err)
+		}
+		result.Applied++
+	}
+
+	return result, nil
+}
+
+// ReconcileStatus summarizes the state of a Reconciler.
+type ReconcileStatus struct {
+	// Runs is the number of completed reconciliation attempts.
+	Runs int `json:"runs"`
+	// LastRun is the time of the last attempt.
+	LastRun time.Time `json:"lastRun"`
+	// LastSuccess is the time of the last attempt without error.
+	LastSuccess time.Time `json:"lastSuccess,omitempty"`
+	// InSync is true if the last attempt found no drift or corrected all of it.
+	InSync bool `json:"inSync"`
+	// Drift is the number of differences found by the last attempt.
+	Drift int `json:"drift"`
+	// Applied is the number of changes written by the last attempt.
+	Applied int `json:"applied"`
+	// DryRun is true if the reconciler does not write to the target.
+	DryRun bool `json:"dryRun"`
+	// LastError is the error of the last attempt, if any.
+	LastError string `json:"lastError,omitempty"`
+}
+
+// ReconcilerConfig holds configuration for a Reconciler.
+type ReconcilerConfig struct {
+	// OpenSource opens the source of truth. It is called on every run so that
+	// file-based sources pick up changes (e.g., from a git checkout).
+	// Stores implementing Stop() are stopped after each run.
+	OpenSource func() (PolicyStore, error)
+	// Target is the store kept in sync with the source.
+	Target PolicyStore
+	// Interval between runs. Default: 30s.
+	Interval time.Duration
+	// Options are applied on every run.
+	Options ReconcileOptions
+	// OnStatus is called after every run with the updated status. Optional.
+	OnStatus func(ReconcileStatus)
+}
+
+// Reconciler periodically reconciles a target policy store against a source.
+type Reconciler struct {
+	cfg ReconcilerConfig
+
+	mu     sync.RWMutex
+	status ReconcileStatus
+}
+
+// NewReconciler creates a Reconciler.
+func NewReconciler(cfg ReconcilerConfig) (*Reconciler, error) {
+	if cfg.OpenSource == nil {
+		return nil, errors.New("reconciler: source is required")
+	}
+	if cfg.Target == nil {
+		return nil, errors.New("reconciler: target is required")
+	}
+	if cfg.Interval < 0 {
+		return nil, errors.New("reconciler: interval must not be negative")
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = 30 * time.Second
+	}
+	return &Reconciler{
+		cfg:    cfg,
+		status: ReconcileStatus{DryRun: cfg.Options.DryRun},
+	}, nil
+}
+
+// Status returns a snapshot of the reconciler status.
+func (r *Reconciler) Status() ReconcileStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.status
+}
+
+// RunOnce performs a single reconciliation and updates the status.
+func (r *Reconciler) RunOnce(ctx context.Context) (*ReconcileResult, error) {
+	result, err := r.reconcile(ctx)
+
+	r.mu.Lock()
+	r.status.Runs++
+	r.status.LastRun = time.Now()
+	r.status.LastError = ""
+	r.status.Drift = 0
+	r.status.Applied = 0
+	if result != nil {
+		r.status.Drift = len(result.Diff.Entries)
+		r.status.Applied = result.Applied
+	}
+	if err != nil {
+		r.status.LastError = err.Error()
+		r.status.InSync = false
+	} else {
+		r.status.LastSuccess = r.status.LastRun
+		r.status.InSync = result.Diff.IsEmpty() || r.corrected(result)
+	}
+	status := r.status
+	r.mu.Unlock()
+
+	if r.cfg.OnStatus != nil {
+		r.cfg.OnStatus(status)
+	}
+	return result, err
+}
+
+// corrected returns true if every drift entry was applied to the target.
+func (r *Reconciler) corrected(result *ReconcileResult) bool {
+	if result.DryRun {
+		return false
+	}
+	for _, e := range result.Diff.Entries {
+		if e.Kind == DiffExtra && !r.cfg.Options.Prune {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Reconciler) reconcile(ctx context.Context) (*ReconcileResult, error) {
+	source, err := r.cfg.OpenSource()
+	if err != nil {
+		return nil, fmt.Errorf("opening source: %w", err)
+	}
+	if s, ok := source.(interface{ Stop() error }); ok {
+		defer s.Stop()
+	}
+	return ReconcilePolicyStores(ctx, source, r.cfg.Target, r.cfg.Options)
+}
+
+// Run reconciles immediately and then every interval until ctx is cancelled.
+// Errors of individual runs are logged and reported in the status; they do not stop the loop.
+func (r *Reconciler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("reconciler: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
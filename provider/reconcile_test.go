@@ -0,0 +1,151 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/msimon/nauts/identity"
+)
+
+const (
+	reconcileSourcePolicies = `[
+		{"id": "p1", "account": "APP", "name": "p1", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:a"]}]},
+		{"id": "p2", "account": "APP", "name": "p2", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:b"]}]}
+	]`
+	reconcileSourceBindings = `[{"role": "admin", "account": "APP", "policies": ["p1", "p2"]}]`
+
+	reconcileTargetPolicies = `[
+		{"id": "p1", "account": "APP", "name": "p1", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:changed"]}]},
+		{"id": "stale", "account": "APP", "name": "stale", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:a"]}]}
+	]`
+	reconcileTargetBindings = `[{"role": "old", "account": "APP", "policies": ["stale"]}]`
+)
+
+func TestReconcilePolicyStores(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		opts        ReconcileOptions
+		wantApplied int
+		wantDrift   int // remaining after reconcile
+	}{
+		{name: "dry run", opts: ReconcileOptions{DryRun: true}, wantApplied: 0, wantDrift: 5},
+		{name: "without prune", opts: ReconcileOptions{}, wantApplied: 3, wantDrift: 2},
+		{name: "with prune", opts: ReconcileOptions{Prune: true}, wantApplied: 5, wantDrift: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newTestFileStore(t, reconcileSourcePolicies, reconcileSourceBindings)
+			target := newTestFileStore(t, reconcileTargetPolicies, reconcileTargetBindings)
+
+			result, err := ReconcilePolicyStores(ctx, source, target, tt.opts)
+			if err != nil {
+				t.Fatalf("ReconcilePolicyStores() error = %v", err)
+			}
+			if len(result.Diff.Entries) != 5 {
+				t.Errorf("drift = %v, want 5 entries", result.Diff.Entries)
+			}
+			if result.Applied != tt.wantApplied {
+				t.Errorf("Applied = %d, want %d", result.Applied, tt.wantApplied)
+			}
+
+			remaining, err := DiffPolicyStores(ctx, source, target)
+			if err != nil {
+				t.Fatalf("DiffPolicyStores() error = %v", err)
+			}
+			if len(remaining.Entries) != tt.wantDrift {
+				t.Errorf("remaining drift = %v, want %d entries", remaining.Entries, tt.wantDrift)
+			}
+		})
+	}
+}
+
+func TestReconcilePolicyStores_BindingExpiry(t *testing.T) {
+	ctx := context.Background()
+	policies := `[{"id": "p1", "account": "APP", "name": "p1", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:a"]}]}]`
+	source := newTestFileStore(t, policies, `[{"role": "oncall", "account": "APP", "policies": ["p1"], "expiresAt": "2030-01-01T00:00:00Z"}]`)
+	target := newTestFileStore(t, policies, `[{"role": "oncall", "account": "APP", "policies": ["p1"]}]`)
+
+	result, err := ReconcilePolicyStores(ctx, source, target, ReconcileOptions{})
+	if err != nil {
+		t.Fatalf("ReconcilePolicyStores() error = %v", err)
+	}
+	if result.Applied != 1 {
+		t.Errorf("Applied = %d, want 1", result.Applied)
+	}
+	b, err := target.GetBinding(ctx, identity.Role{Account: "APP", Name: "oncall"})
+	if err != nil {
+		t.Fatalf("GetBinding() error = %v", err)
+	}
+	if b.ExpiresAt == nil || !b.ExpiresAt.Equal(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("target ExpiresAt = %v, want the source expiry", b.ExpiresAt)
+	}
+}
+
+func TestReconciler_RunOnce(t *testing.T) {
+	ctx := context.Background()
+	target := newTestFileStore(t, reconcileTargetPolicies, reconcileTargetBindings)
+
+	var reported []ReconcileStatus
+	openErr := errors.New("checkout unavailable")
+	failing := true
+	r, err := NewReconciler(ReconcilerConfig{
+		OpenSource: func() (PolicyStore, error) {
+			if failing {
+				return nil, openErr
+			}
+			return newTestFileStore(t, reconcileSourcePolicies, reconcileSourceBindings), nil
+		},
+		Target:   target,
+		Options:  ReconcileOptions{Prune: true},
+		OnStatus: func(s ReconcileStatus) { reported = append(reported, s) },
+	})
+	if err != nil {
+		t.Fatalf("NewReconciler() error = %v", err)
+	}
+
+	if _, err := r.RunOnce(ctx); !errors.Is(err, openErr) {
+		t.Fatalf("RunOnce() error = %v, want %v", err, openErr)
+	}
+	if s := r.Status(); s.InSync || s.LastError == "" || !s.LastSuccess.IsZero() {
+		t.Errorf("status after failure = %+v", s)
+	}
+
+	failing = false
+	if _, err := r.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+	s := r.Status()
+	if !s.InSync || s.Drift != 5 || s.Applied != 5 || s.Runs != 2 || s.LastError != "" {
+		t.Errorf("status after correction = %+v", s)
+	}
+
+	if _, err := r.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+	if s := r.Status(); !s.InSync || s.Drift != 0 {
+		t.Errorf("status after no-op run = %+v", s)
+	}
+	if len(reported) != 3 {
+		t.Errorf("OnStatus called %d times, want 3", len(reported))
+	}
+}
+
+func TestNewReconciler_Validation(t *testing.T) {
+	target := newTestFileStore(t, "[]", "[]")
+	open := func() (PolicyStore, error) { return target, nil }
+
+	if _, err := NewReconciler(ReconcilerConfig{Target: target}); err == nil {
+		t.Error("expected error without source")
+	}
+	if _, err := NewReconciler(ReconcilerConfig{OpenSource: open}); err == nil {
+		t.Error("expected error without target")
+	}
+	if _, err := NewReconciler(ReconcilerConfig{OpenSource: open, Target: target, Interval: -1}); err == nil {
+		t.Error("expected error for negative interval")
+	}
+}
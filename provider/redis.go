@@ -0,0 +1,234 @@
+package provider
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// redisTimeout bounds every Redis command, including connecting.
+	redisTimeout = 2 * time.Second
+	// redisMaxIdleConns is the number of idle connections kept for reuse.
+	redisMaxIdleConns = 8
+)
+
+// RedisCacheConfig configures the connection to Redis.
+type RedisCacheConfig struct {
+	// Address is the host:port of the Redis server.
+	Address string `json:"address"`
+
+	// Username and Password authenticate the connection (AUTH). Use a
+	// secret:// reference to keep the password out of the configuration.
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	// DB is the database number. Default: 0.
+	DB int `json:"db,omitempty"`
+
+	// TLS connects with TLS, verifying the server against the system roots.
+	TLS bool `json:"tls,omitempty"`
+
+	// Prefix namespaces the keys and the invalidation channel. Replicas
+	// sharing a cache must use the same prefix. Default: derived from the
+	// bucket or table names.
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// Validate checks the configuration.
+func (c *RedisCacheConfig) Validate() error {
+	if c.Address == "" {
+		return errors.New("address is required")
+	}
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return fmt.Errorf("invalid address %q: %w", c.Address, err)
+	}
+	if c.DB < 0 {
+		return errors.New("db must not be negative")
+	}
+	return nil
+}
+
+// redisError is an error reply of the Redis server.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// redisClient runs Redis commands on a small pool of connections. It speaks
+// the RESP2 protocol.
+type redisClient struct {
+	cfg  RedisCacheConfig
+	idle chan *redisConn
+}
+
+func newRedisClient(cfg RedisCacheConfig) *redisClient {
+	return &redisClient{cfg: cfg, idle: make(chan *redisConn, redisMaxIdleConns)}
+}
+
+// do runs a command and returns its reply: a string for simple strings,
+// []byte or nil for bulk strings, int64 for integers, and []any for arrays.
+// Error replies are returned as redisError.
+func (c *redisClient) do(ctx context.Context, args ...string) (any, error) {
+	var conn *redisConn
+	select {
+	case conn = <-c.idle:
+	default:
+		var err error
+		if conn, err = dialRedis(ctx, c.cfg); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := conn.do(args...)
+	if err != nil && !isRedisError(err) {
+		// The connection is in an unknown state.
+		conn.close()
+		return nil, err
+	}
+	select {
+	case c.idle <- conn:
+	default:
+		conn.close()
+	}
+	return reply, err
+}
+
+// close closes the idle connections.
+func (c *redisClient) close() {
+	for {
+		select {
+		case conn := <-c.idle:
+			conn.close()
+		default:
+			return
+		}
+	}
+}
+
+// redisConn is a single connection to Redis.
+type redisConn struct {
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// dialRedis connects to Redis, authenticates, and selects the database.
+func dialRedis(ctx context.Context, cfg RedisCacheConfig) (*redisConn, error) {
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+	var conn net.Conn
+	var err error
+	if cfg.TLS {
+		host, _, _ := net.SplitHostPort(cfg.Address)
+		d := &tls.Dialer{Config: &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}}
+		conn, err = d.DialContext(ctx, "tcp", cfg.Address)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", cfg.Address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connecting to redis at %s: %w", cfg.Address, err)
+	}
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+	if cfg.Password != "" {
+		args := []string{"AUTH", cfg.Password}
+		if cfg.Username != "" {
+			args = []string{"AUTH", cfg.Username, cfg.Password}
+		}
+		if _, err := c.do(args...); err != nil {
+			c.close()
+			return nil, fmt.Errorf("authenticating to redis: %w", err)
+		}
+	}
+	if cfg.DB != 0 {
+		if _, err := c.do("SELECT", strconv.Itoa(cfg.DB)); err != nil {
+			c.close()
+			return nil, fmt.Errorf("selecting redis db %d: %w", cfg.DB, err)
+		}
+	}
+	return c, nil
+}
+
+// do sends a command and reads its reply within redisTimeout.
+func (c *redisConn) do(args ...string) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_ = c.conn.SetDeadline(time.Now().Add(redisTimeout))
+	defer c.conn.SetDeadline(time.Time{})
+	if err := c.send(args...); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+// send writes a command as an array of bulk strings.
+func (c *redisConn) send(args ...string) error {
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return c.w.Flush()
+}
+
+// read reads a reply (see redisClient.do).
+func (c *redisConn) read() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, n)
+		for i := range items {
+			var err error
+			// Errors inside arrays are values, e.g. in EXEC replies.
+			if items[i], err = c.read(); err != nil && !isRedisError(err) {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+func (c *redisConn) close() {
+	_ = c.conn.Close()
+}
+
+func isRedisError(err error) bool {
+	var rerr redisError
+	return errors.As(err, &rerr)
+}
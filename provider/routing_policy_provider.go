@@ -0,0 +1,196 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/policy"
+)
+
+// PolicyRoute assigns the accounts matching Accounts to Store.
+type PolicyRoute struct {
+	// Accounts lists account names and patterns ("*", "prefix*"), matched
+	// as by identity.MatchesAccount.
+	Accounts []string
+	Store    PolicyStore
+}
+
+// RoutingPolicyProvider is a PolicyStore that serves each account from the
+// store of the first route matching it, and all other accounts from a
+// default store, so that tenants can own their policy storage. Every
+// lookup, including the global policies an account sees, is answered by the
+// account's store alone. Global policies ("*" or "_global") are listed and
+// written like the policies of the account "*", usually from and to the
+// default store.
+type RoutingPolicyProvider struct {
+	routes   []PolicyRoute
+	fallback PolicyStore
+}
+
+// NewRoutingPolicyProvider creates a provider routing accounts to the stores
+// of routes, in order, and unmatched accounts to fallback.
+func NewRoutingPolicyProvider(routes []PolicyRoute, fallback PolicyStore) (*RoutingPolicyProvider, error) {
+	if fallback == nil {
+		return nil, errors.New("default policy store is required")
+	}
+	for i, r := range routes {
+		if len(r.Accounts) == 0 {
+			return nil, fmt.Errorf("route %d: at least one account is required", i)
+		}
+		if r.Store == nil {
+			return nil, fmt.Errorf("route %d: store is required", i)
+		}
+	}
+	return &RoutingPolicyProvider{routes: routes, fallback: fallback}, nil
+}
+
+// store returns the store serving account.
+func (p *RoutingPolicyProvider) store(account string) PolicyStore {
+	if account == "_global" {
+		account = "*"
+	}
+	for _, r := range p.routes {
+		if identity.MatchesAccount(r.Accounts, account) {
+			return r.Store
+		}
+	}
+	return p.fallback
+}
+
+// stores returns the distinct stores, the default store first.
+func (p *RoutingPolicyProvider) stores() []PolicyStore {
+	stores := []PolicyStore{p.fallback}
+	for _, r := range p.routes {
+		seen := false
+		for _, s := range stores {
+			if s == r.Store {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			stores = append(stores, r.Store)
+		}
+	}
+	return stores
+}
+
+// GetPolicy retrieves a policy from the store of account.
+func (p *RoutingPolicyProvider) GetPolicy(ctx context.Context, account string, id string) (*policy.Policy, error) {
+	return p.store(account).GetPolicy(ctx, account, id)
+}
+
+// GetPoliciesForRole returns the policies of role from the store of its account.
+func (p *RoutingPolicyProvider) GetPoliciesForRole(ctx context.Context, role identity.Role) ([]*policy.Policy, error) {
+	return p.store(role.Account).GetPoliciesForRole(ctx, role)
+}
+
+// GetPolicies returns the policies of account from its store.
+func (p *RoutingPolicyProvider) GetPolicies(ctx context.Context, account string) ([]*policy.Policy, error) {
+	return p.store(account).GetPolicies(ctx, account)
+}
+
+// GetBinding retrieves the binding of role from the store of its account.
+func (p *RoutingPolicyProvider) GetBinding(ctx context.Context, role identity.Role) (*Binding, error) {
+	return p.store(role.Account).GetBinding(ctx, role)
+}
+
+// GetBindings returns the bindings of account from its store.
+func (p *RoutingPolicyProvider) GetBindings(ctx context.Context, account string) ([]*Binding, error) {
+	return p.store(account).GetBindings(ctx, account)
+}
+
+// ListPolicies returns the policies of all stores. Each store contributes
+// only the policies of the accounts routed to it.
+func (p *RoutingPolicyProvider) ListPolicies(ctx context.Context) ([]*policy.Policy, error) {
+	var result []*policy.Policy
+	for _, s := range p.stores() {
+		policies, err := s.ListPolicies(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, pol := range policies {
+			if p.store(pol.Account) == s {
+				result = append(result, pol)
+			}
+		}
+	}
+	return result, nil
+}
+
+// ListBindings returns the bindings of all stores. Each store contributes
+// only the bindings of the accounts routed to it.
+func (p *RoutingPolicyProvider) ListBindings(ctx context.Context) ([]*Binding, error) {
+	var result []*Binding
+	for _, s := range p.stores() {
+		bindings, err := s.ListBindings(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range bindings {
+			if p.store(b.Account) == s {
+				result = append(result, b)
+			}
+		}
+	}
+	return result, nil
+}
+
+// PutPolicy writes pol to the store of its account.
+func (p *RoutingPolicyProvider) PutPolicy(ctx context.Context, pol *policy.Policy) error {
+	return p.store(pol.Account).PutPolicy(ctx, pol)
+}
+
+// DeletePolicy removes a policy from the store of account.
+func (p *RoutingPolicyProvider) DeletePolicy(ctx context.Context, account string, id string) error {
+	return p.store(account).DeletePolicy(ctx, account, id)
+}
+
+// PutBinding writes b to the store of its account.
+func (p *RoutingPolicyProvider) PutBinding(ctx context.Context, b *Binding) error {
+	return p.store(b.Account).PutBinding(ctx, b)
+}
+
+// DeleteBinding removes the binding of role from the store of its account.
+func (p *RoutingPolicyProvider) DeleteBinding(ctx context.Context, role identity.Role) error {
+	return p.store(role.Account).DeleteBinding(ctx, role)
+}
+
+// PolicyVersion implements PolicyVersioner. The version is the sum of the
+// versions of the stores, so it changes whenever one of them changes. Stores
+// that do not implement PolicyVersioner contribute nothing.
+func (p *RoutingPolicyProvider) PolicyVersion() uint64 {
+	var version uint64
+	for _, s := range p.stores() {
+		if v, ok := s.(PolicyVersioner); ok {
+			version += v.PolicyVersion()
+		}
+	}
+	return version
+}
+
+// CheckHealth implements PolicyHealthChecker by checking every store that
+// implements it.
+func (p *RoutingPolicyProvider) CheckHealth(ctx context.Context) error {
+	for _, s := range p.stores() {
+		if hc, ok := s.(PolicyHealthChecker); ok {
+			if err := hc.CheckHealth(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Stop stops every store that holds resources.
+func (p *RoutingPolicyProvider) Stop() error {
+	var errs []error
+	for _, s := range p.stores() {
+		if st, ok := s.(interface{ Stop() error }); ok {
+			errs = append(errs, st.Stop())
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,109 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/policy"
+)
+
+func TestRoutingPolicyProvider(t *testing.T) {
+	ctx := context.Background()
+	corp := newTestFileStore(t, `[
+		{"id": "corp-base", "account": "*", "name": "corp-base", "statements": [{"effect": "allow", "actions": ["nats.sub"], "resources": ["nats:corp.>"]}]},
+		{"id": "corp-app", "account": "CORP-A", "name": "corp-app", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:a"]}]},
+		{"id": "stray", "account": "APP", "name": "stray", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:a"]}]}
+	]`, `[
+		{"role": "dev", "account": "CORP-A", "policies": ["corp-app", "corp-base"]}
+	]`)
+	fallback := newTestFileStore(t, `[
+		{"id": "base", "account": "*", "name": "base", "statements": [{"effect": "allow", "actions": ["nats.sub"], "resources": ["nats:_INBOX.>"]}]},
+		{"id": "app", "account": "APP", "name": "app", "statements": [{"effect": "allow", "actions": ["nats.pub"], "resources": ["nats:b"]}]}
+	]`, `[
+		{"role": "dev", "account": "APP", "policies": ["app", "base"]}
+	]`)
+
+	p, err := NewRoutingPolicyProvider([]PolicyRoute{{Accounts: []string{"CORP*"}, Store: corp}}, fallback)
+	if err != nil {
+		t.Fatalf("NewRoutingPolicyProvider() error = %v", err)
+	}
+
+	policyIDs := func(policies []*policy.Policy) []string {
+		var ids []string
+		for _, pol := range policies {
+			ids = append(ids, pol.ID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+
+	got, err := p.GetPoliciesForRole(ctx, identity.Role{Account: "CORP-A", Name: "dev"})
+	if err != nil {
+		t.Fatalf("GetPoliciesForRole(CORP-A.dev) error = %v", err)
+	}
+	if ids := policyIDs(got); !slices.Equal(ids, []string{"corp-app", "corp-base"}) {
+		t.Errorf("GetPoliciesForRole(CORP-A.dev) = %v, want the policies of the routed store", ids)
+	}
+	got, err = p.GetPoliciesForRole(ctx, identity.Role{Account: "APP", Name: "dev"})
+	if err != nil {
+		t.Fatalf("GetPoliciesForRole(APP.dev) error = %v", err)
+	}
+	if ids := policyIDs(got); !slices.Equal(ids, []string{"app", "base"}) {
+		t.Errorf("GetPoliciesForRole(APP.dev) = %v, want the policies of the default store", ids)
+	}
+	if _, err := p.GetPoliciesForRole(ctx, identity.Role{Account: "CORP-B", Name: "dev"}); !errors.Is(err, ErrRoleNotFound) {
+		t.Errorf("GetPoliciesForRole(CORP-B.dev) error = %v, want ErrRoleNotFound", err)
+	}
+
+	// Each store lists only the accounts routed to it; global policies come
+	// from the default store.
+	all, err := p.ListPolicies(ctx)
+	if err != nil {
+		t.Fatalf("ListPolicies() error = %v", err)
+	}
+	if ids := policyIDs(all); !slices.Equal(ids, []string{"app", "base", "corp-app"}) {
+		t.Errorf("ListPolicies() = %v", ids)
+	}
+	bindings, err := p.ListBindings(ctx)
+	if err != nil {
+		t.Fatalf("ListBindings() error = %v", err)
+	}
+	if len(bindings) != 2 {
+		t.Errorf("ListBindings() returned %d bindings, want 2", len(bindings))
+	}
+
+	// Writes go to the store of the account.
+	if err := p.PutBinding(ctx, &Binding{Role: "ops", Account: "CORP-B", Policies: []string{"corp-base"}}); err != nil {
+		t.Fatalf("PutBinding() error = %v", err)
+	}
+	if _, err := corp.GetBinding(ctx, identity.Role{Account: "CORP-B", Name: "ops"}); err != nil {
+		t.Errorf("binding of CORP-B not written to the routed store: %v", err)
+	}
+	if _, err := fallback.GetBinding(ctx, identity.Role{Account: "CORP-B", Name: "ops"}); !errors.Is(err, ErrRoleNotFound) {
+		t.Errorf("binding of CORP-B written to the default store")
+	}
+
+	before := p.PolicyVersion()
+	if err := p.DeleteBinding(ctx, identity.Role{Account: "CORP-B", Name: "ops"}); err != nil {
+		t.Fatalf("DeleteBinding() error = %v", err)
+	}
+	if p.PolicyVersion() == before {
+		t.Error("PolicyVersion() unchanged after a change to a routed store")
+	}
+}
+
+func TestNewRoutingPolicyProvider_Invalid(t *testing.T) {
+	store := newTestFileStore(t, `[]`, `[]`)
+	if _, err := NewRoutingPolicyProvider(nil, nil); err == nil {
+		t.Error("expected error without default store")
+	}
+	if _, err := NewRoutingPolicyProvider([]PolicyRoute{{Store: store}}, store); err == nil {
+		t.Error("expected error for route without accounts")
+	}
+	if _, err := NewRoutingPolicyProvider([]PolicyRoute{{Accounts: []string{"A"}}}, store); err == nil {
+		t.Error("expected error for route without store")
+	}
+}
@@ -0,0 +1,627 @@
+package provider
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	// Registers the "pgx" database/sql driver.
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/policy"
+	"github.com/msimon/nauts/units"
+)
+
+const (
+	// DefaultSQLPoliciesTable is the default name of the policies table.
+	DefaultSQLPoliciesTable = "nauts_policies"
+
+	// DefaultSQLBindingsTable is the default name of the bindings table.
+	DefaultSQLBindingsTable = "nauts_bindings"
+
+	defaultSQLMaxOpenConns    = 10
+	defaultSQLMaxIdleConns    = 2
+	defaultSQLConnMaxLifetime = 30 * time.Minute
+	sqlConnectTimeout         = 5 * time.Second
+)
+
+// sqlIdentifierPattern matches table names, optionally schema-qualified.
+var sqlIdentifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// quoteSQLTable quotes a table name, optionally schema-qualified, for use in
+// a query.
+func quoteSQLTable(name string) string {
+	return pgx.Identifier(strings.Split(name, ".")).Sanitize()
+}
+
+// SQLPolicyProviderConfig holds configuration for SQLPolicyProvider.
+//
+// The provider expects two tables (names configurable):
+//
+//	CREATE TABLE nauts_policies (
+//	    account  TEXT  NOT NULL,  -- "*" for global policies
+//	    id       TEXT  NOT NULL,
+//	    document JSONB NOT NULL,  -- the policy as in policies.json
+//	    PRIMARY KEY (account, id)
+//	);
+//	CREATE TABLE nauts_bindings (
+//	    account  TEXT  NOT NULL,
+//	    role     TEXT  NOT NULL,
+//	    policies JSONB NOT NULL,  -- array of policy IDs
+//	    ttl      TEXT  NOT NULL DEFAULT '',
+//	    max_ttl  TEXT  NOT NULL DEFAULT '',
+//	    expires_at TIMESTAMPTZ,       -- NULL for permanent bindings
+//	    PRIMARY KEY (account, role)
+//	);
+type SQLPolicyProviderConfig struct {
+	// DSN is the PostgreSQL connection string (URL or key=value form).
+	// Mutually exclusive with DSNFile. The standard PG* environment
+	// variables (e.g., PGPASSWORD) fill in unset parameters.
+	DSN string `json:"dsn,omitempty"`
+
+	// DSNFile is the path to a file containing the connection string, which
+	// keeps the database password out of the configuration file.
+	DSNFile string `json:"dsnFile,omitempty"`
+
+	// PoliciesTable is the name of the policies table, optionally
+	// schema-qualified. Names are quoted, so they are case-sensitive.
+	// Default: "nauts_policies".
+	PoliciesTable string `json:"policiesTable,omitempty"`
+
+	// BindingsTable is the name of the bindings table, like PoliciesTable.
+	// Default: "nauts_bindings".
+	BindingsTable string `json:"bindingsTable,omitempty"`
+
+	// MaxOpenConns limits the connections in the pool. Default: 10.
+	MaxOpenConns int `json:"maxOpenConns,omitempty"`
+
+	// MaxIdleConns is the number of idle connections kept in the pool. Default: 2.
+	MaxIdleConns int `json:"maxIdleConns,omitempty"`
+
+	// ConnMaxLifetime is how long a connection is reused, as a duration
+	// string (e.g., "30m"). Default: "30m".
+	ConnMaxLifetime string `json:"connMaxLifetime,omitempty"`
+
+	// CacheTTL is how long cached entries remain valid, as a duration string (e.g., "30s", "1m").
+	// Default: "30s".
+	CacheTTL string `json:"cacheTtl,omitempty"`
+
+	// Cache selects the cache backend. Nil uses an in-memory cache. With a
+	// Redis cache, writes through any replica invalidate the caches of all.
+	Cache *CacheConfig `json:"cache,omitempty"`
+}
+
+// GetCacheTTL returns the cache TTL as a time.Duration, defaulting to 30s.
+func (c *SQLPolicyProviderConfig) GetCacheTTL() time.Duration {
+	if c.CacheTTL == "" {
+		return defaultCacheTTL
+	}
+	d, err := units.ParseDuration(c.CacheTTL)
+	if err != nil || d <= 0 {
+		return defaultCacheTTL
+	}
+	return d
+}
+
+// Validate checks the table names and durations of the configuration.
+// The connection string is checked when connecting.
+func (c *SQLPolicyProviderConfig) Validate() error {
+	if c.DSN != "" && c.DSNFile != "" {
+		return errors.New("dsn and dsnFile are mutually exclusive")
+	}
+	for _, table := range []string{c.PoliciesTable, c.BindingsTable} {
+		if table != "" && !sqlIdentifierPattern.MatchString(table) {
+			return fmt.Errorf("invalid table name %q", table)
+		}
+	}
+	if c.MaxOpenConns < 0 || c.MaxIdleConns < 0 {
+		return errors.New("maxOpenConns and maxIdleConns must not be negative")
+	}
+	if c.ConnMaxLifetime != "" {
+		if d, err := units.ParseDuration(c.ConnMaxLifetime); err != nil || d <= 0 {
+			return fmt.Errorf("invalid connMaxLifetime %q", c.ConnMaxLifetime)
+		}
+	}
+	if c.CacheTTL != "" {
+		if d, err := units.ParseDuration(c.CacheTTL); err != nil || d <= 0 {
+			return fmt.Errorf("invalid cacheTtl %q", c.CacheTTL)
+		}
+	}
+	if err := c.Cache.Validate(); err != nil {
+		return fmt.Errorf("cache: %w", err)
+	}
+	return nil
+}
+
+// SQLPolicyProvider implements PolicyStore using PostgreSQL tables.
+// Queries are prepared once and run on a connection pool; reads are cached
+// for CacheTTL. Writes through the provider invalidate its cache, but changes
+// made directly in the database become visible only when entries expire.
+type SQLPolicyProvider struct {
+	db     *sql.DB
+	ownsDB bool
+	cache  cache
+
+	getPolicy     *sql.Stmt
+	getPolicies   *sql.Stmt
+	listPolicies  *sql.Stmt
+	putPolicy     *sql.Stmt
+	deletePolicy  *sql.Stmt
+	getBinding    *sql.Stmt
+	getBindings   *sql.Stmt
+	listBindings  *sql.Stmt
+	putBinding    *sql.Stmt
+	deleteBinding *sql.Stmt
+	stmts         []*sql.Stmt
+}
+
+// NewSQLPolicyProvider connects to PostgreSQL and prepares the queries.
+// The tables must already exist.
+func NewSQLPolicyProvider(cfg SQLPolicyProviderConfig) (*SQLPolicyProvider, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("sql policy provider: %w", err)
+	}
+	dsn := cfg.DSN
+	if cfg.DSNFile != "" {
+		data, err := os.ReadFile(cfg.DSNFile)
+		if err != nil {
+			return nil, fmt.Errorf("sql policy provider: reading dsn file: %w", err)
+		}
+		dsn = strings.TrimSpace(string(data))
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("sql policy provider: opening database: %w", err)
+	}
+	db.SetMaxOpenConns(defaultSQLMaxOpenConns)
+	if cfg.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	db.SetMaxIdleConns(defaultSQLMaxIdleConns)
+	if cfg.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	lifetime := defaultSQLConnMaxLifetime
+	if cfg.ConnMaxLifetime != "" {
+		lifetime, _ = units.ParseDuration(cfg.ConnMaxLifetime)
+	}
+	db.SetConnMaxLifetime(lifetime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), sqlConnectTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("sql policy provider: connecting to database: %w", err)
+	}
+
+	p, err := NewSQLPolicyProviderWithDB(ctx, db, cfg)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	p.ownsDB = true
+	return p, nil
+}
+
+// NewSQLPolicyProviderWithDB creates a SQLPolicyProvider on an existing
+// connection pool, for embedders managing their own *sql.DB. The DSN and pool
+// settings of cfg are ignored, and Stop does not close db. Queries use
+// PostgreSQL syntax.
+func NewSQLPolicyProviderWithDB(ctx context.Context, db *sql.DB, cfg SQLPolicyProviderConfig) (*SQLPolicyProvider, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("sql policy provider: %w", err)
+	}
+	policies := cfg.PoliciesTable
+	if policies == "" {
+		policies = DefaultSQLPoliciesTable
+	}
+	bindings := cfg.BindingsTable
+	if bindings == "" {
+		bindings = DefaultSQLBindingsTable
+	}
+
+	c, err := newProviderCache(cfg.Cache, cfg.GetCacheTTL(), "nauts:"+policies+":", decodeSQLCacheEntry)
+	if err != nil {
+		return nil, fmt.Errorf("sql policy provider: %w", err)
+	}
+	p := &SQLPolicyProvider{
+		db:    db,
+		cache: c,
+	}
+	// Table names are validated, and quoted nonetheless.
+	policies, bindings = quoteSQLTable(policies), quoteSQLTable(bindings)
+	statements := []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&p.getPolicy, "SELECT document FROM " + policies + " WHERE account = $1 AND id = $2"},
+		{&p.getPolicies, "SELECT account, id, document FROM " + policies + " WHERE account = $1 OR account = '*' ORDER BY id"},
+		{&p.listPolicies, "SELECT account, id, document FROM " + policies + " ORDER BY account, id"},
+		{&p.putPolicy, "INSERT INTO " + policies + " (account, id, document) VALUES ($1, $2, $3) " +
+			"ON CONFLICT (account, id) DO UPDATE SET document = EXCLUDED.document"},
+		{&p.deletePolicy, "DELETE FROM " + policies + " WHERE account = $1 AND id = $2"},
+		{&p.getBinding, "SELECT account, role, policies, ttl, max_ttl, expires_at FROM " + bindings + " WHERE account = $1 AND role = $2"},
+		{&p.getBindings, "SELECT account, role, policies, ttl, max_ttl, expires_at FROM " + bindings + " WHERE account = $1 ORDER BY role"},
+		{&p.listBindings, "SELECT account, role, policies, ttl, max_ttl, expires_at FROM " + bindings + " ORDER BY account, role"},
+		{&p.putBinding, "INSERT INTO " + bindings + " (account, role, policies, ttl, max_ttl, expires_at) VALUES ($1, $2, $3, $4, $5, $6) " +
+			"ON CONFLICT (account, role) DO UPDATE SET policies = EXCLUDED.policies, ttl = EXCLUDED.ttl, max_ttl = EXCLUDED.max_ttl, expires_at = EXCLUDED.expires_at"},
+		{&p.deleteBinding, "DELETE FROM " + bindings + " WHERE account = $1 AND role = $2"},
+	}
+	for _, s := range statements {
+		stmt, err := db.PrepareContext(ctx, s.query)
+		if err != nil {
+			p.closeStmts()
+			_ = c.close()
+			return nil, fmt.Errorf("sql policy provider: preparing %q: %w", s.query, err)
+		}
+		*s.stmt = stmt
+		p.stmts = append(p.stmts, stmt)
+	}
+	return p, nil
+}
+
+// Stop closes the prepared statements, the connection pool if the provider
+// opened it, and the cache.
+func (p *SQLPolicyProvider) Stop() error {
+	p.closeStmts()
+	_ = p.cache.close()
+	if p.ownsDB {
+		return p.db.Close()
+	}
+	return nil
+}
+
+func (p *SQLPolicyProvider) closeStmts() {
+	for _, stmt := range p.stmts {
+		_ = stmt.Close()
+	}
+	p.stmts = nil
+}
+
+// GetPolicy retrieves a policy by account and ID.
+// If the id starts with "_global:", the policy is looked up as a global policy.
+// IDs starting with "builtin:" resolve to the built-in policy library.
+func (p *SQLPolicyProvider) GetPolicy(ctx context.Context, account string, id string) (*policy.Policy, error) {
+	if policy.IsBuiltinID(id) {
+		return builtinPolicy(id)
+	}
+	account, id = sqlPolicyKey(account, id)
+	key := "policy:" + account + ":" + id
+	if cached := p.cache.get(key); cached != nil {
+		return cached.(*policy.Policy), nil
+	}
+
+	var document []byte
+	err := p.getPolicy.QueryRowContext(ctx, account, id).Scan(&document)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPolicyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fetching policy %s/%s: %w", account, id, err)
+	}
+	pol, err := decodeSQLPolicy(account, id, document)
+	if err != nil {
+		return nil, err
+	}
+
+	p.cache.put(key, pol)
+	return pol, nil
+}
+
+// GetPoliciesForRole returns all policies attached to a role. Policy IDs of
+// the binding are looked up in the role's account, or as global policies if
+// prefixed with "_global:".
+func (p *SQLPolicyProvider) GetPoliciesForRole(ctx context.Context, role identity.Role) ([]*policy.Policy, error) {
+	role.Name = strings.TrimSpace(role.Name)
+	if role.Name == "" {
+		return nil, ErrRoleNotFound
+	}
+	role.Account = strings.TrimSpace(role.Account)
+	if role.Account == "" {
+		return nil, ErrRoleNotFound
+	}
+
+	b, err := p.GetBinding(ctx, role)
+	if err != nil {
+		return nil, err
+	}
+
+	policyIDs := make([]string, 0, len(b.Policies))
+	seen := make(map[string]struct{})
+	for _, id := range b.Policies {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		policyIDs = append(policyIDs, id)
+	}
+	sort.Strings(policyIDs)
+
+	result := make([]*policy.Policy, 0, len(policyIDs))
+	for _, id := range policyIDs {
+		pol, err := p.GetPolicy(ctx, role.Account, id)
+		if err != nil {
+			if errors.Is(err, ErrPolicyNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		result = append(result, pol)
+	}
+	return result, nil
+}
+
+// GetPolicies returns all policies for the given account plus global policies, sorted by ID.
+func (p *SQLPolicyProvider) GetPolicies(ctx context.Context, account string) ([]*policy.Policy, error) {
+	account = strings.TrimSpace(account)
+	key := "policies:" + account
+	if cached := p.cache.get(key); cached != nil {
+		return cached.([]*policy.Policy), nil
+	}
+
+	result, err := p.queryPolicies(ctx, p.getPolicies, account)
+	if err != nil {
+		return nil, err
+	}
+	p.cache.put(key, result)
+	return result, nil
+}
+
+// ListPolicies returns the policies of all accounts, sorted by account and ID.
+func (p *SQLPolicyProvider) ListPolicies(ctx context.Context) ([]*policy.Policy, error) {
+	return p.queryPolicies(ctx, p.listPolicies)
+}
+
+func (p *SQLPolicyProvider) queryPolicies(ctx context.Context, stmt *sql.Stmt, args ...any) ([]*policy.Policy, error) {
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying policies: %w", err)
+	}
+	defer rows.Close()
+
+	var result []*policy.Policy
+	for rows.Next() {
+		var account, id string
+		var document []byte
+		if err := rows.Scan(&account, &id, &document); err != nil {
+			return nil, fmt.Errorf("reading policy row: %w", err)
+		}
+		pol, err := decodeSQLPolicy(account, id, document)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, pol)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("querying policies: %w", err)
+	}
+	return result, nil
+}
+
+// GetBinding retrieves the binding for an account-scoped role.
+func (p *SQLPolicyProvider) GetBinding(ctx context.Context, role identity.Role) (*Binding, error) {
+	key := "binding:" + role.Account + ":" + role.Name
+	if cached := p.cache.get(key); cached != nil {
+		return cached.(*Binding), nil
+	}
+
+	b, err := scanSQLBinding(p.getBinding.QueryRowContext(ctx, role.Account, role.Name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRoleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fetching binding %s: %w", role, err)
+	}
+
+	p.cache.put(key, b)
+	return b, nil
+}
+
+// GetBindings returns all bindings for the given account, sorted by role.
+func (p *SQLPolicyProvider) GetBindings(ctx context.Context, account string) ([]*Binding, error) {
+	return p.queryBindings(ctx, p.getBindings, strings.TrimSpace(account))
+}
+
+// ListBindings returns the bindings of all accounts, sorted by account and role.
+func (p *SQLPolicyProvider) ListBindings(ctx context.Context) ([]*Binding, error) {
+	return p.queryBindings(ctx, p.listBindings)
+}
+
+func (p *SQLPolicyProvider) queryBindings(ctx context.Context, stmt *sql.Stmt, args ...any) ([]*Binding, error) {
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying bindings: %w", err)
+	}
+	defer rows.Close()
+
+	var result []*Binding
+	for rows.Next() {
+		b, err := scanSQLBinding(rows)
+		if err != nil {
+			return nil, fmt.Errorf("reading binding row: %w", err)
+		}
+		result = append(result, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("querying bindings: %w", err)
+	}
+	return result, nil
+}
+
+// CheckHealth implements PolicyHealthChecker by pinging the database.
+func (p *SQLPolicyProvider) CheckHealth(ctx context.Context) error {
+	if err := p.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("database unreachable: %w", err)
+	}
+	return nil
+}
+
+// PolicyVersion implements PolicyVersioner. The version changes with every
+// write through the provider; direct database changes are not detected.
+func (p *SQLPolicyProvider) PolicyVersion() uint64 {
+	return p.cache.generation()
+}
+
+// PutPolicy creates or replaces a policy.
+// Global policies (account "*" or "_global") are stored with account "*".
+func (p *SQLPolicyProvider) PutPolicy(ctx context.Context, pol *policy.Policy) error {
+	if pol == nil {
+		return errors.New("policy is nil")
+	}
+	if err := pol.Validate(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(pol)
+	if err != nil {
+		return fmt.Errorf("encoding policy %s: %w", pol.ID, err)
+	}
+
+	account, id := sqlPolicyKey(pol.Account, pol.ID)
+	if _, err := p.putPolicy.ExecContext(ctx, account, id, data); err != nil {
+		return fmt.Errorf("putting policy %s/%s: %w", account, id, err)
+	}
+	p.invalidatePolicy(account, id)
+	return nil
+}
+
+// DeletePolicy removes a policy. Deleting a missing policy is not an error.
+func (p *SQLPolicyProvider) DeletePolicy(ctx context.Context, account string, id string) error {
+	account, id = sqlPolicyKey(account, id)
+	if _, err := p.deletePolicy.ExecContext(ctx, account, id); err != nil {
+		return fmt.Errorf("deleting policy %s/%s: %w", account, id, err)
+	}
+	p.invalidatePolicy(account, id)
+	return nil
+}
+
+// PutBinding creates or replaces a binding.
+func (p *SQLPolicyProvider) PutBinding(ctx context.Context, b *Binding) error {
+	if b == nil {
+		return errors.New("binding is nil")
+	}
+	if err := b.Validate(); err != nil {
+		return err
+	}
+	if len(b.Inherits) > 0 {
+		return fmt.Errorf("binding %s: inherits is not supported by the SQL policy provider", b.IdentityRole())
+	}
+	policies := b.Policies
+	if policies == nil {
+		policies = []string{}
+	}
+	data, err := json.Marshal(policies)
+	if err != nil {
+		return fmt.Errorf("encoding binding %s: %w", b.IdentityRole(), err)
+	}
+
+	var expiresAt sql.NullTime
+	if b.ExpiresAt != nil {
+		expiresAt = sql.NullTime{Time: *b.ExpiresAt, Valid: true}
+	}
+	if _, err := p.putBinding.ExecContext(ctx, b.Account, b.Role, data, b.TTL, b.MaxTTL, expiresAt); err != nil {
+		return fmt.Errorf("putting binding %s: %w", b.IdentityRole(), err)
+	}
+	p.cache.invalidate("binding:" + b.Account + ":" + b.Role)
+	return nil
+}
+
+// DeleteBinding removes a binding. Deleting a missing binding is not an error.
+func (p *SQLPolicyProvider) DeleteBinding(ctx context.Context, role identity.Role) error {
+	if _, err := p.deleteBinding.ExecContext(ctx, role.Account, role.Name); err != nil {
+		return fmt.Errorf("deleting binding %s: %w", role, err)
+	}
+	p.cache.invalidate("binding:" + role.Account + ":" + role.Name)
+	return nil
+}
+
+// invalidatePolicy removes a policy and the policy lists containing it from
+// the cache. Global policies appear in the list of every account.
+func (p *SQLPolicyProvider) invalidatePolicy(account, id string) {
+	p.cache.invalidate("policy:" + account + ":" + id)
+	if account == "*" {
+		p.cache.invalidatePrefix("policies:")
+	} else {
+		p.cache.invalidate("policies:" + account)
+	}
+}
+
+// decodeSQLCacheEntry decodes a cache entry shared through Redis.
+func decodeSQLCacheEntry(key string, data []byte) (any, error) {
+	switch {
+	case strings.HasPrefix(key, "policy:"):
+		var pol policy.Policy
+		err := json.Unmarshal(data, &pol)
+		return &pol, err
+	case strings.HasPrefix(key, "policies:"):
+		var policies []*policy.Policy
+		err := json.Unmarshal(data, &policies)
+		return policies, err
+	case strings.HasPrefix(key, "binding:"):
+		var b Binding
+		err := json.Unmarshal(data, &b)
+		return &b, err
+	}
+	return nil, fmt.Errorf("unknown cache key %q", key)
+}
+
+// sqlPolicyKey maps a policy account and ID to the key columns of the
+// policies table. Global policies, addressed with account "*" or "_global" or
+// an ID prefixed with "_global:", are stored with account "*".
+func sqlPolicyKey(account, id string) (string, string) {
+	if strings.HasPrefix(id, globalAccountPrefix+":") {
+		return "*", strings.TrimPrefix(id, globalAccountPrefix+":")
+	}
+	if account == globalAccountPrefix {
+		return "*", id
+	}
+	return account, id
+}
+
+// decodeSQLPolicy decodes a policy document. The account and ID columns take
+// precedence over the fields of the document.
+func decodeSQLPolicy(account, id string, document []byte) (*policy.Policy, error) {
+	var pol policy.Policy
+	if err := json.Unmarshal(document, &pol); err != nil {
+		return nil, fmt.Errorf("decoding policy %s/%s: %w", account, id, err)
+	}
+	pol.Account = account
+	pol.ID = id
+	if err := pol.Validate(); err != nil {
+		return nil, fmt.Errorf("validating policy %s/%s: %w", account, id, err)
+	}
+	return &pol, nil
+}
+
+// scanSQLBinding reads a binding from a row of (account, role, policies, ttl, max_ttl, expires_at).
+func scanSQLBinding(row interface{ Scan(dest ...any) error }) (*Binding, error) {
+	var b Binding
+	var policies []byte
+	var ttl, maxTTL sql.NullString
+	var expiresAt sql.NullTime
+	if err := row.Scan(&b.Account, &b.Role, &policies, &ttl, &maxTTL, &expiresAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(policies, &b.Policies); err != nil {
+		return nil, fmt.Errorf("decoding policies of binding %s.%s: %w", b.Account, b.Role, err)
+	}
+	b.TTL = ttl.String
+	b.MaxTTL = maxTTL.String
+	if expiresAt.Valid {
+		b.ExpiresAt = &expiresAt.Time
+	}
+	return &b, nil
+}
@@ -0,0 +1,328 @@
+package provider
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/msimon/nauts/identity"
+	"github.com/msimon/nauts/policy"
+)
+
+// fakeSQLDB is an in-memory stand-in for the two tables, served through a
+// database/sql driver that understands exactly the queries of SQLPolicyProvider.
+type fakeSQLDB struct {
+	mu       sync.Mutex
+	policies map[[2]string][]byte
+	bindings map[[2]string][4]any // policies JSON, ttl, max_ttl, expires_at
+	queries  int
+	prepared []string
+}
+
+var (
+	fakeSQLDBs  = map[string]*fakeSQLDB{}
+	fakeSQLMu   sync.Mutex
+	fakeSQLOnce sync.Once
+)
+
+type fakeSQLDriver struct{}
+
+func (fakeSQLDriver) Open(name string) (driver.Conn, error) {
+	fakeSQLMu.Lock()
+	defer fakeSQLMu.Unlock()
+	return &fakeSQLConn{db: fakeSQLDBs[name]}, nil
+}
+
+type fakeSQLConn struct{ db *fakeSQLDB }
+
+func (c *fakeSQLConn) Prepare(query string) (driver.Stmt, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.prepared = append(c.db.prepared, query)
+	return &fakeSQLStmt{db: c.db, query: query}, nil
+}
+func (c *fakeSQLConn) Close() error              { return nil }
+func (c *fakeSQLConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+type fakeSQLStmt struct {
+	db    *fakeSQLDB
+	query string
+}
+
+func (s *fakeSQLStmt) Close() error  { return nil }
+func (s *fakeSQLStmt) NumInput() int { return -1 }
+
+func (s *fakeSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	key := [2]string{args[0].(string), args[1].(string)}
+	switch {
+	case strings.HasPrefix(s.query, "INSERT") && strings.Contains(s.query, "document"):
+		s.db.policies[key] = args[2].([]byte)
+	case strings.HasPrefix(s.query, "INSERT"):
+		s.db.bindings[key] = [4]any{args[2], args[3], args[4], args[5]}
+	case strings.HasPrefix(s.query, "DELETE") && strings.Contains(s.query, "AND id"):
+		delete(s.db.policies, key)
+	case strings.HasPrefix(s.query, "DELETE"):
+		delete(s.db.bindings, key)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	s.db.queries++
+
+	var rows [][]driver.Value
+	if strings.Contains(s.query, "document") {
+		for k, doc := range s.db.policies {
+			if matchFakeRow(s.query, k, args, "id") {
+				rows = append(rows, []driver.Value{k[0], k[1], doc})
+			}
+		}
+		if strings.HasPrefix(s.query, "SELECT document") {
+			for i := range rows {
+				rows[i] = rows[i][2:]
+			}
+		}
+	} else {
+		for k, b := range s.db.bindings {
+			if matchFakeRow(s.query, k, args, "role") {
+				rows = append(rows, []driver.Value{k[0], k[1], b[0], b[1], b[2], b[3]})
+			}
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if len(rows[i]) < 2 {
+			return false
+		}
+		return rows[i][0].(string)+"\x00"+rows[i][1].(string) < rows[j][0].(string)+"\x00"+rows[j][1].(string)
+	})
+	columns := 6
+	switch {
+	case strings.HasPrefix(s.query, "SELECT document"):
+		columns = 1
+	case strings.Contains(s.query, "document"):
+		columns = 3
+	}
+	return &fakeSQLRows{columns: columns, rows: rows}, nil
+}
+
+// matchFakeRow evaluates the WHERE clause of a provider query for a row key.
+func matchFakeRow(query string, key [2]string, args []driver.Value, second string) bool {
+	switch {
+	case strings.Contains(query, "AND "+second+" = $2"):
+		return key[0] == args[0].(string) && key[1] == args[1].(string)
+	case strings.Contains(query, "OR account = '*'"):
+		return key[0] == args[0].(string) || key[0] == "*"
+	case strings.Contains(query, "WHERE account = $1"):
+		return key[0] == args[0].(string)
+	default:
+		return true
+	}
+}
+
+type fakeSQLRows struct {
+	columns int
+	rows    [][]driver.Value
+	pos     int
+}
+
+func (r *fakeSQLRows) Columns() []string { return make([]string, r.columns) }
+func (r *fakeSQLRows) Close() error      { return nil }
+func (r *fakeSQLRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.pos])
+	r.pos++
+	return nil
+}
+
+func newTestSQLPolicyProvider(t *testing.T, cfg SQLPolicyProviderConfig) (*SQLPolicyProvider, *fakeSQLDB) {
+	t.Helper()
+	fakeSQLOnce.Do(func() { sql.Register("nauts-fake", fakeSQLDriver{}) })
+	fake := &fakeSQLDB{policies: map[[2]string][]byte{}, bindings: map[[2]string][4]any{}}
+	fakeSQLMu.Lock()
+	fakeSQLDBs[t.Name()] = fake
+	fakeSQLMu.Unlock()
+
+	db, err := sql.Open("nauts-fake", t.Name())
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	p, err := NewSQLPolicyProviderWithDB(context.Background(), db, cfg)
+	if err != nil {
+		t.Fatalf("NewSQLPolicyProviderWithDB() error = %v", err)
+	}
+	t.Cleanup(func() { _ = p.Stop() })
+	return p, fake
+}
+
+func TestSQLPolicyProvider_ReadWrite(t *testing.T) {
+	p, fake := newTestSQLPolicyProvider(t, SQLPolicyProviderConfig{})
+	ctx := context.Background()
+
+	stmt := policy.Statement{Effect: policy.EffectAllow, Actions: []policy.Action{policy.ActionNATSPub}, Resources: []string{"nats:orders"}}
+	for _, pol := range []*policy.Policy{
+		{ID: "orders", Account: "APP", Name: "Orders", Statements: []policy.Statement{stmt}},
+		{ID: "base", Account: "*", Name: "Base", Statements: []policy.Statement{stmt}},
+		{ID: "other", Account: "OTHER", Name: "Other", Statements: []policy.Statement{stmt}},
+	} {
+		if err := p.PutPolicy(ctx, pol); err != nil {
+			t.Fatalf("PutPolicy(%s) error = %v", pol.ID, err)
+		}
+	}
+	expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := p.PutBinding(ctx, &Binding{Role: "worker", Account: "APP", Policies: []string{"orders", "_global:base", "missing"}, TTL: "8h", MaxTTL: "15m", ExpiresAt: &expiresAt}); err != nil {
+		t.Fatalf("PutBinding() error = %v", err)
+	}
+	if err := p.PutBinding(ctx, &Binding{Role: "admin", Account: "APP", Inherits: []string{"worker"}}); err == nil {
+		t.Error("PutBinding() with inherits succeeded, want unsupported")
+	}
+
+	got, err := p.GetPoliciesForRole(ctx, identity.Role{Account: "APP", Name: "worker"})
+	if err != nil {
+		t.Fatalf("GetPoliciesForRole() error = %v", err)
+	}
+	if len(got) != 2 || got[0].ID != "base" || got[0].Account != "*" || got[1].ID != "orders" {
+		t.Errorf("GetPoliciesForRole() = %v, want base (global) and orders", got)
+	}
+	b, err := p.GetBinding(ctx, identity.Role{Account: "APP", Name: "worker"})
+	if err != nil || b.TTL != "8h" || b.MaxTTL != "15m" || b.ExpiresAt == nil || !b.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("GetBinding() = %+v, %v", b, err)
+	}
+
+	policies, err := p.GetPolicies(ctx, "APP")
+	if err != nil {
+		t.Fatalf("GetPolicies() error = %v", err)
+	}
+	if len(policies) != 2 {
+		t.Errorf("GetPolicies(APP) = %d policies, want orders and base", len(policies))
+	}
+	all, _ := p.ListPolicies(ctx)
+	if len(all) != 3 {
+		t.Errorf("ListPolicies() = %d policies, want 3", len(all))
+	}
+	bindings, _ := p.GetBindings(ctx, "APP")
+	if len(bindings) != 1 {
+		t.Errorf("GetBindings(APP) = %d bindings, want 1", len(bindings))
+	}
+
+	if _, err := p.GetPoliciesForRole(ctx, identity.Role{Account: "APP", Name: "unknown"}); !errors.Is(err, ErrRoleNotFound) {
+		t.Errorf("GetPoliciesForRole(unknown) error = %v, want ErrRoleNotFound", err)
+	}
+	if _, err := p.GetPolicy(ctx, "APP", "missing"); !errors.Is(err, ErrPolicyNotFound) {
+		t.Errorf("GetPolicy(missing) error = %v, want ErrPolicyNotFound", err)
+	}
+
+	// Cached reads do not query the database.
+	before := fake.queries
+	if _, err := p.GetPoliciesForRole(ctx, identity.Role{Account: "APP", Name: "worker"}); err != nil {
+		t.Fatalf("GetPoliciesForRole() error = %v", err)
+	}
+	if _, err := p.GetPolicies(ctx, "APP"); err != nil {
+		t.Fatalf("GetPolicies() error = %v", err)
+	}
+	if queries := fake.queries - before; queries != 1 {
+		t.Errorf("cached reads ran %d queries, want 1 (the uncached missing policy)", queries)
+	}
+
+	// Writes invalidate the cache; deleting a global policy affects every account list.
+	if err := p.DeletePolicy(ctx, "*", "base"); err != nil {
+		t.Fatalf("DeletePolicy() error = %v", err)
+	}
+	if policies, _ := p.GetPolicies(ctx, "APP"); len(policies) != 1 {
+		t.Errorf("GetPolicies(APP) after delete = %d policies, want 1", len(policies))
+	}
+	if err := p.DeleteBinding(ctx, identity.Role{Account: "APP", Name: "worker"}); err != nil {
+		t.Fatalf("DeleteBinding() error = %v", err)
+	}
+	if _, err := p.GetBinding(ctx, identity.Role{Account: "APP", Name: "worker"}); !errors.Is(err, ErrRoleNotFound) {
+		t.Errorf("GetBinding() after delete error = %v, want ErrRoleNotFound", err)
+	}
+}
+
+func TestSQLPolicyProvider_DocumentColumnsTakePrecedence(t *testing.T) {
+	p, fake := newTestSQLPolicyProvider(t, SQLPolicyProviderConfig{PoliciesTable: "auth.policies", BindingsTable: "auth.bindings"})
+	fake.policies[[2]string{"APP", "orders"}] = []byte(`{"id":"x","account":"y","statements":[{"effect":"allow","actions":["nats.sub"],"resources":["nats:orders"]}]}`)
+	fake.policies[[2]string{"APP", "broken"}] = []byte(`{"statements":[]}`)
+
+	pol, err := p.GetPolicy(context.Background(), "APP", "orders")
+	if err != nil {
+		t.Fatalf("GetPolicy() error = %v", err)
+	}
+	if pol.ID != "orders" || pol.Account != "APP" {
+		t.Errorf("policy = %s/%s, want APP/orders from the key columns", pol.Account, pol.ID)
+	}
+	if _, err := p.GetPolicy(context.Background(), "APP", "broken"); err == nil || errors.Is(err, ErrPolicyNotFound) {
+		t.Errorf("GetPolicy(broken) error = %v, want validation error", err)
+	}
+	for _, q := range fake.prepared {
+		if !strings.Contains(q, `"auth"."policies"`) && !strings.Contains(q, `"auth"."bindings"`) {
+			t.Errorf("query %q does not use the configured tables", q)
+		}
+	}
+}
+
+func TestSQLPolicyProviderConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     SQLPolicyProviderConfig
+		wantErr bool
+	}{
+		{"defaults", SQLPolicyProviderConfig{DSN: "postgres://localhost/nauts"}, false},
+		{"schema-qualified tables", SQLPolicyProviderConfig{PoliciesTable: "auth.policies", BindingsTable: "bindings"}, false},
+		{"dsn and dsnFile", SQLPolicyProviderConfig{DSN: "x", DSNFile: "y"}, true},
+		{"injected table name", SQLPolicyProviderConfig{PoliciesTable: "policies; DROP TABLE x"}, true},
+		{"negative pool size", SQLPolicyProviderConfig{MaxOpenConns: -1}, true},
+		{"invalid lifetime", SQLPolicyProviderConfig{ConnMaxLifetime: "forever"}, true},
+		{"invalid cache ttl", SQLPolicyProviderConfig{CacheTTL: "-1s"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSQLPolicyKey(t *testing.T) {
+	tests := []struct {
+		account, id         string
+		wantAccount, wantID string
+	}{
+		{"APP", "orders", "APP", "orders"},
+		{"APP", "_global:base", "*", "base"},
+		{"_global", "base", "*", "base"},
+		{"*", "base", "*", "base"},
+	}
+	for _, tt := range tests {
+		account, id := sqlPolicyKey(tt.account, tt.id)
+		if account != tt.wantAccount || id != tt.wantID {
+			t.Errorf("sqlPolicyKey(%q, %q) = %q, %q, want %q, %q", tt.account, tt.id, account, id, tt.wantAccount, tt.wantID)
+		}
+	}
+}
+
+func TestQuoteSQLTable(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"nauts_policies", `"nauts_policies"`},
+		{"auth.Policies", `"auth"."Policies"`},
+	}
+	for _, tt := range tests {
+		if got := quoteSQLTable(tt.name); got != tt.want {
+			t.Errorf("quoteSQLTable(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
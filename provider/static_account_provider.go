@@ -4,69 +4,240 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
+	"sync"
+
+	"github.com/nats-io/nkeys"
 
 	"github.com/msimon/nauts/jwt"
 )
 
 // StaticAccountProvider implements AccountProvider using a static configuration.
 type StaticAccountProvider struct {
-	accounts map[string]*Account
+	names  []string
+	limits map[string]AccountLimits
+	keys   *keyLoader
+
+	// signingKeys are the configured keys in order; mu guards the active key
+	// and the accounts signed with it.
+	signingKeys []staticSigningKey
+	mu          sync.RWMutex
+	activeKey   string
+	accounts    map[string]*Account
+}
+
+// staticSigningKey is a loaded signing key.
+type staticSigningKey struct {
+	id        string
+	publicKey string
+	signer    jwt.Signer
+}
+
+// SigningKeyInfo describes a configured account signing key.
+type SigningKeyInfo struct {
+	ID        string `json:"id"`
+	PublicKey string `json:"publicKey"`
+	Active    bool   `json:"active"`
 }
 
 // StaticAccountProviderConfig holds configuration for the StaticAccountProvider.
 type StaticAccountProviderConfig struct {
-	// PublicKey is the public key used for all accounts.
-	PublicKey string `json:"publicKey"`
+	// PublicKey is the public key used for all accounts. Not used with
+	// SigningKeys.
+	PublicKey string `json:"publicKey,omitempty"`
 
-	// PrivateKeyPath is the path to the nkey seed file used for all accounts.
-	PrivateKeyPath string `json:"privateKeyPath"`
+	// PrivateKeyPath is the path to the nkey seed file used for all accounts,
+	// or a vault:// reference (see VaultScheme). Not used with SigningKeys.
+	PrivateKeyPath string `json:"privateKeyPath,omitempty"`
+
+	// SigningKeys optionally configures several keys instead of PublicKey
+	// and PrivateKeyPath, so keys can be rotated: JWTs are signed with the
+	// key ActiveKey, the others stay loaded for RotateSigningKey and are
+	// listed by SigningKeys.
+	SigningKeys []StaticSigningKeyConfig `json:"signingKeys,omitempty"`
+
+	// ActiveKey is the ID of the signing key in use. Default: the first of
+	// SigningKeys.
+	ActiveKey string `json:"activeKey,omitempty"`
 
 	// Accounts is the list of account names.
 	Accounts []string `json:"accounts"`
+
+	// Limits optionally describes the limits set for accounts in the
+	// nats-server configuration, keyed by account name (e.g.,
+	// {"APP": {"jetStream": false}}).
+	Limits map[string]AccountLimits `json:"limits,omitempty"`
+
+	// Vault configures the connection if privateKeyPath is a vault://
+	// reference. Nil uses the VAULT_* environment variables.
+	Vault *VaultConfig `json:"vault,omitempty"`
 }
 
-// NewStaticAccountProvider creates a new StaticAccountProvider from configuration.
-func NewStaticAccountProvider(cfg StaticAccountProviderConfig) (*StaticAccountProvider, error) {
-	if len(cfg.Accounts) == 0 {
-		return nil, fmt.Errorf("at least one account is required")
+// StaticSigningKeyConfig is one of the signing keys of a
+// StaticAccountProvider.
+type StaticSigningKeyConfig struct {
+	// ID names the key for ActiveKey and RotateSigningKey (e.g., "2026-10").
+	ID string `json:"id"`
+
+	// PublicKey is the account public key of the key (starts with 'A').
+	PublicKey string `json:"publicKey"`
+
+	// PrivateKeyPath is the path to the nkey seed file or a vault://
+	// reference (see VaultScheme).
+	PrivateKeyPath string `json:"privateKeyPath"`
+}
+
+// Validate checks the signing key configuration: either publicKey and
+// privateKeyPath, or signingKeys with unique IDs and an activeKey among them.
+func (cfg *StaticAccountProviderConfig) Validate() error {
+	if len(cfg.SigningKeys) == 0 {
+		if cfg.ActiveKey != "" {
+			return fmt.Errorf("activeKey requires signingKeys")
+		}
+		if cfg.PublicKey == "" {
+			return fmt.Errorf("publicKey is required")
+		}
+		if cfg.PrivateKeyPath == "" {
+			return fmt.Errorf("privateKeyPath is required")
+		}
+		return nil
 	}
-	if cfg.PublicKey == "" {
-		return nil, fmt.Errorf("publicKey is required")
+	if cfg.PublicKey != "" || cfg.PrivateKeyPath != "" {
+		return fmt.Errorf("publicKey and privateKeyPath cannot be combined with signingKeys")
 	}
-	if cfg.PrivateKeyPath == "" {
-		return nil, fmt.Errorf("privateKeyPath is required")
+	ids := make(map[string]bool, len(cfg.SigningKeys))
+	for i, k := range cfg.SigningKeys {
+		if k.ID == "" {
+			return fmt.Errorf("signingKeys[%d].id is required", i)
+		}
+		if ids[k.ID] {
+			return fmt.Errorf("signingKeys[%d]: duplicate id %s", i, k.ID)
+		}
+		ids[k.ID] = true
+		if k.PublicKey == "" || k.PrivateKeyPath == "" {
+			return fmt.Errorf("signingKeys[%s]: publicKey and privateKeyPath are required", k.ID)
+		}
 	}
-
-	signer, err := loadSignerFromFile(cfg.PrivateKeyPath)
-	if err != nil {
-		return nil, fmt.Errorf("loading signer: %w", err)
+	if cfg.ActiveKey != "" && !ids[cfg.ActiveKey] {
+		return fmt.Errorf("activeKey %s is not one of signingKeys", cfg.ActiveKey)
 	}
+	return nil
+}
 
-	provider := &StaticAccountProvider{
-		accounts: make(map[string]*Account),
+// signingKeyConfigs returns the configured keys, with publicKey and
+// privateKeyPath as a single key, and the ID of the active key.
+func (cfg *StaticAccountProviderConfig) signingKeyConfigs() ([]StaticSigningKeyConfig, string) {
+	if len(cfg.SigningKeys) == 0 {
+		return []StaticSigningKeyConfig{{PublicKey: cfg.PublicKey, PrivateKeyPath: cfg.PrivateKeyPath}}, ""
+	}
+	active := cfg.ActiveKey
+	if active == "" {
+		active = cfg.SigningKeys[0].ID
 	}
+	return cfg.SigningKeys, active
+}
 
+// NewStaticAccountProvider creates a new StaticAccountProvider from configuration.
+func NewStaticAccountProvider(cfg StaticAccountProviderConfig) (_ *StaticAccountProvider, err error) {
+	if len(cfg.Accounts) == 0 {
+		return nil, fmt.Errorf("at least one account is required")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
 	for _, name := range cfg.Accounts {
 		if name == "" {
 			return nil, fmt.Errorf("account name cannot be empty")
 		}
+	}
+	for name := range cfg.Limits {
+		if !slices.Contains(cfg.Accounts, name) {
+			return nil, fmt.Errorf("limits configured for unknown account %s", name)
+		}
+	}
 
-		provider.accounts[name] = &Account{
-			name:      name,
-			publicKey: cfg.PublicKey,
-			signer:    signer,
+	keys := &keyLoader{vaultConfig: cfg.Vault}
+	defer func() {
+		if err != nil {
+			_ = keys.stop()
 		}
+	}()
+
+	provider := &StaticAccountProvider{
+		names:  cfg.Accounts,
+		limits: cfg.Limits,
+		keys:   keys,
+	}
+	keyConfigs, active := cfg.signingKeyConfigs()
+	for _, k := range keyConfigs {
+		signer, err := keys.load(k.PrivateKeyPath, nkeys.PrefixByteAccount)
+		if err != nil {
+			if k.ID != "" {
+				return nil, fmt.Errorf("loading signer %s: %w", k.ID, err)
+			}
+			return nil, fmt.Errorf("loading signer: %w", err)
+		}
+		// A mismatch would only surface when rotating to the key, as
+		// rejected JWTs.
+		if k.ID != "" && signer.PublicKey() != k.PublicKey {
+			return nil, fmt.Errorf("signingKeys[%s]: private key belongs to %s, not publicKey %s", k.ID, signer.PublicKey(), k.PublicKey)
+		}
+		provider.signingKeys = append(provider.signingKeys, staticSigningKey{id: k.ID, publicKey: k.PublicKey, signer: signer})
+	}
+	if err := provider.RotateSigningKey(active); err != nil {
+		return nil, err
 	}
 
 	return provider, nil
 }
 
+// RotateSigningKey makes the signing key with the given ID active: JWTs
+// issued afterwards are signed with it and accounts report its public key.
+// The NATS servers must accept the key as auth callout issuer. It fails for
+// IDs that are not configured.
+func (p *StaticAccountProvider) RotateSigningKey(id string) error {
+	i := slices.IndexFunc(p.signingKeys, func(k staticSigningKey) bool { return k.id == id })
+	if i < 0 {
+		return fmt.Errorf("unknown signing key %q", id)
+	}
+	key := p.signingKeys[i]
+
+	accounts := make(map[string]*Account, len(p.names))
+	for _, name := range p.names {
+		accounts[name] = &Account{name: name, publicKey: key.publicKey, signer: key.signer}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.activeKey = id
+	p.accounts = accounts
+	return nil
+}
+
+// SigningKeys lists the configured signing keys in configuration order. A
+// provider configured with publicKey and privateKeyPath has one key with an
+// empty ID.
+func (p *StaticAccountProvider) SigningKeys() []SigningKeyInfo {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	infos := make([]SigningKeyInfo, 0, len(p.signingKeys))
+	for _, k := range p.signingKeys {
+		infos = append(infos, SigningKeyInfo{ID: k.id, PublicKey: k.publicKey, Active: k.id == p.activeKey})
+	}
+	return infos
+}
+
+// loadSignerFromFile loads the seed in path, decrypting it if it was
+// encrypted with EncryptSeed.
 func loadSignerFromFile(path string) (*jwt.LocalSigner, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("reading key file: %w", err)
 	}
+	if data, err = ResolveSeed(data); err != nil {
+		return nil, fmt.Errorf("key file %s: %w", path, err)
+	}
 
 	seed := strings.TrimSpace(string(data))
 	return jwt.NewLocalSigner(seed)
@@ -74,7 +245,9 @@ func loadSignerFromFile(path string) (*jwt.LocalSigner, error) {
 
 // GetAccount retrieves an account by name.
 func (p *StaticAccountProvider) GetAccount(ctx context.Context, name string) (*Account, error) {
+	p.mu.RLock()
 	account, ok := p.accounts[name]
+	p.mu.RUnlock()
 	if !ok {
 		return nil, fmt.Errorf("%w: %s", ErrAccountNotFound, name)
 	}
@@ -83,6 +256,8 @@ func (p *StaticAccountProvider) GetAccount(ctx context.Context, name string) (*A
 
 // ListAccounts returns all accounts.
 func (p *StaticAccountProvider) ListAccounts(ctx context.Context) ([]*Account, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 	accounts := make([]*Account, 0, len(p.accounts))
 	for _, account := range p.accounts {
 		accounts = append(accounts, account)
@@ -90,6 +265,24 @@ func (p *StaticAccountProvider) ListAccounts(ctx context.Context) ([]*Account, e
 	return accounts, nil
 }
 
+// GetAccountLimits returns the configured limits of an account, or nil if
+// none are configured.
+func (p *StaticAccountProvider) GetAccountLimits(ctx context.Context, name string) (*AccountLimits, error) {
+	if !slices.Contains(p.names, name) {
+		return nil, fmt.Errorf("%w: %s", ErrAccountNotFound, name)
+	}
+	limits, ok := p.limits[name]
+	if !ok {
+		return nil, nil
+	}
+	return &limits, nil
+}
+
+// Stop ends the Vault token renewal of a Transit signing key, if any.
+func (p *StaticAccountProvider) Stop() error {
+	return p.keys.stop()
+}
+
 // IsOperatorMode returns false as StaticAccountProvider does not operate in operator mode.
 func (p *StaticAccountProvider) IsOperatorMode() bool {
 	return false
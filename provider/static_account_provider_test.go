@@ -5,6 +5,8 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/nats-io/nkeys"
 )
 
 func TestNewStaticAccountProvider(t *testing.T) {
@@ -211,6 +213,71 @@ func TestStaticAccountProvider_IsOperatorMode(t *testing.T) {
 	}
 }
 
+func TestStaticAccountProvider_RotateSigningKey(t *testing.T) {
+	tmpDir := t.TempDir()
+	var keys []StaticSigningKeyConfig
+	for _, id := range []string{"old", "new"} {
+		kp, err := nkeys.CreateAccount()
+		if err != nil {
+			t.Fatal(err)
+		}
+		seed, _ := kp.Seed()
+		pub, _ := kp.PublicKey()
+		path := filepath.Join(tmpDir, id+".nk")
+		if err := os.WriteFile(path, seed, 0600); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, StaticSigningKeyConfig{ID: id, PublicKey: pub, PrivateKeyPath: path})
+	}
+
+	provider, err := NewStaticAccountProvider(StaticAccountProviderConfig{
+		SigningKeys: keys,
+		Accounts:    []string{"APP"},
+	})
+	if err != nil {
+		t.Fatalf("NewStaticAccountProvider() error = %v", err)
+	}
+	account, _ := provider.GetAccount(context.Background(), "APP")
+	if account.PublicKey() != keys[0].PublicKey || account.Signer().PublicKey() != keys[0].PublicKey {
+		t.Errorf("default active key = %s, want the first key %s", account.PublicKey(), keys[0].PublicKey)
+	}
+
+	if err := provider.RotateSigningKey("new"); err != nil {
+		t.Fatalf("RotateSigningKey() error = %v", err)
+	}
+	account, _ = provider.GetAccount(context.Background(), "APP")
+	if account.Signer().PublicKey() != keys[1].PublicKey {
+		t.Errorf("signer after rotation = %s, want %s", account.Signer().PublicKey(), keys[1].PublicKey)
+	}
+	infos := provider.SigningKeys()
+	if len(infos) != 2 || infos[0].Active || !infos[1].Active || infos[0].PublicKey != keys[0].PublicKey {
+		t.Errorf("SigningKeys() = %+v", infos)
+	}
+	if err := provider.RotateSigningKey("missing"); err == nil {
+		t.Error("RotateSigningKey() of an unknown key succeeded")
+	}
+
+	tests := []struct {
+		name   string
+		cfg    StaticAccountProviderConfig
+		errMsg string
+	}{
+		{"active key", StaticAccountProviderConfig{SigningKeys: keys, ActiveKey: "other"}, "activeKey other is not one of signingKeys"},
+		{"duplicate id", StaticAccountProviderConfig{SigningKeys: []StaticSigningKeyConfig{keys[0], keys[0]}}, "duplicate id old"},
+		{"combined", StaticAccountProviderConfig{SigningKeys: keys, PublicKey: keys[0].PublicKey}, "cannot be combined"},
+		{"mismatch", StaticAccountProviderConfig{SigningKeys: []StaticSigningKeyConfig{{ID: "x", PublicKey: keys[0].PublicKey, PrivateKeyPath: keys[1].PrivateKeyPath}}}, "not publicKey"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Accounts = []string{"APP"}
+			_, err := NewStaticAccountProvider(tt.cfg)
+			if err == nil || !contains(err.Error(), tt.errMsg) {
+				t.Errorf("NewStaticAccountProvider() error = %v, want %q", err, tt.errMsg)
+			}
+		})
+	}
+}
+
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > 0 && containsHelper(s, substr))
 }
@@ -0,0 +1,445 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nkeys"
+
+	"github.com/msimon/nauts/depstats"
+	"github.com/msimon/nauts/jwt"
+)
+
+// VaultScheme prefixes key references resolved from HashiCorp Vault. Key
+// paths of the account providers (e.g. signingKeyPath) accept:
+//
+//   - vault://kv/<mount>/<path>#<field> is a field of a KV v2 secret holding
+//     an nkey seed; the field defaults to "seed"
+//   - vault://transit/<mount>/<key> is an ed25519 Transit key; signing
+//     happens in Vault, so the private key never leaves it
+const VaultScheme = "vault://"
+
+// vaultRequestTimeout bounds each request to Vault.
+const vaultRequestTimeout = 10 * time.Second
+
+// minVaultRenewInterval bounds how often the token is renewed.
+const minVaultRenewInterval = 10 * time.Second
+
+// VaultConfig configures the connection to HashiCorp Vault. Empty fields fall
+// back to the environment variables used by the Vault CLI.
+type VaultConfig struct {
+	// Address is the Vault URL. Default: $VAULT_ADDR.
+	Address string `json:"address,omitempty"`
+
+	// TokenFile is the path to a file containing the Vault token. Default:
+	// $VAULT_TOKEN. Renewable tokens are renewed in the background.
+	TokenFile string `json:"tokenFile,omitempty" secret:"file"`
+
+	// Namespace is the Vault Enterprise namespace. Default: $VAULT_NAMESPACE.
+	Namespace string `json:"namespace,omitempty"`
+
+	// CACertFile is the path to a PEM CA bundle for the Vault server.
+	// Default: $VAULT_CACERT.
+	CACertFile string `json:"caCertFile,omitempty"`
+}
+
+// VaultClient reads secrets and signs with Transit keys through the Vault
+// HTTP API.
+type VaultClient struct {
+	address   string
+	namespace string
+	token     string
+	http      *http.Client
+
+	renewOnce sync.Once
+	stopOnce  sync.Once
+	stop      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewVaultClient creates a client for cfg.
+func NewVaultClient(cfg VaultConfig) (*VaultClient, error) {
+	address := firstNonEmpty(cfg.Address, os.Getenv("VAULT_ADDR"))
+	if address == "" {
+		return nil, errors.New("vault address is required (address or VAULT_ADDR)")
+	}
+	if _, err := url.ParseRequestURI(address); err != nil {
+		return nil, fmt.Errorf("invalid vault address: %w", err)
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if cfg.TokenFile != "" {
+		data, err := os.ReadFile(cfg.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading vault token file: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token == "" {
+		return nil, errors.New("vault token is required (tokenFile or VAULT_TOKEN)")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caFile := firstNonEmpty(cfg.CACertFile, os.Getenv("VAULT_CACERT")); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading vault CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("vault CA file %s contains no certificates", caFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	return &VaultClient{
+		address:   strings.TrimRight(address, "/"),
+		namespace: firstNonEmpty(cfg.Namespace, os.Getenv("VAULT_NAMESPACE")),
+		token:     token,
+		// Request paths name secrets; the address identifies the endpoint.
+		http: depstats.Client(&http.Client{Transport: transport, Timeout: vaultRequestTimeout}, depstats.DependencyVault, strings.TrimRight(address, "/")),
+		stop: make(chan struct{}),
+	}, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// do sends a request to the Vault API and decodes the response into out.
+// A 404 response returns ErrVaultNotFound.
+func (c *VaultClient) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.address+"/v1/"+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", c.token)
+	if c.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault request %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("reading vault response: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrVaultNotFound, path)
+	}
+	if resp.StatusCode >= 300 {
+		var errResp struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.Unmarshal(data, &errResp)
+		if len(errResp.Errors) > 0 {
+			return fmt.Errorf("vault request %s %s: %s: %s", method, path, resp.Status, strings.Join(errResp.Errors, "; "))
+		}
+		return fmt.Errorf("vault request %s %s: %s", method, path, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decoding vault response: %w", err)
+	}
+	return nil
+}
+
+// ErrVaultNotFound is returned when a Vault secret, directory, or key does
+// not exist.
+var ErrVaultNotFound = errors.New("not found in vault")
+
+// ReadKV returns the data of the KV v2 secret at path in mount.
+func (c *VaultClient) ReadKV(ctx context.Context, mount, path string) (map[string]any, error) {
+	var resp struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, mount+"/data/"+strings.Trim(path, "/"), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Data.Data, nil
+}
+
+// ListKV returns the names of the KV v2 secrets in the directory path of
+// mount. Subdirectories end with "/". A missing directory is empty.
+func (c *VaultClient) ListKV(ctx context.Context, mount, path string) ([]string, error) {
+	var resp struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}
+	err := c.do(ctx, "LIST", mount+"/metadata/"+strings.Trim(path, "/"), nil, &resp)
+	if errors.Is(err, ErrVaultNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data.Keys, nil
+}
+
+// vaultRef is a parsed vault:// reference.
+type vaultRef struct {
+	engine string // "kv" or "transit"
+	mount  string
+	path   string // secret path or transit key name
+	field  string // kv only
+}
+
+func parseVaultRef(ref string) (vaultRef, error) {
+	rest, ok := strings.CutPrefix(ref, VaultScheme)
+	if !ok {
+		return vaultRef{}, fmt.Errorf("invalid vault reference %q", ref)
+	}
+	rest, field, _ := strings.Cut(rest, "#")
+	parts := strings.SplitN(rest, "/", 3)
+	if len(parts) != 3 || parts[1] == "" || strings.Trim(parts[2], "/") == "" {
+		return vaultRef{}, fmt.Errorf("invalid vault reference %q (must be vault://kv/<mount>/<path>#<field> or vault://transit/<mount>/<key>)", ref)
+	}
+	r := vaultRef{engine: parts[0], mount: parts[1], path: strings.Trim(parts[2], "/"), field: field}
+	switch r.engine {
+	case "kv":
+		if r.field == "" {
+			r.field = "seed"
+		}
+	case "transit":
+		if field != "" {
+			return vaultRef{}, fmt.Errorf("invalid vault reference %q: transit keys have no field", ref)
+		}
+	default:
+		return vaultRef{}, fmt.Errorf("unsupported vault engine %q in %q (must be kv or transit)", r.engine, ref)
+	}
+	return r, nil
+}
+
+// ReadSecret returns the trimmed string value of a vault://kv reference.
+func (c *VaultClient) ReadSecret(ctx context.Context, ref string) (string, error) {
+	r, err := parseVaultRef(ref)
+	if err != nil {
+		return "", err
+	}
+	if r.engine != "kv" {
+		return "", fmt.Errorf("%s: only vault://kv references hold secrets", ref)
+	}
+	data, err := c.ReadKV(ctx, r.mount, r.path)
+	if err != nil {
+		return "", err
+	}
+	value, _ := data[r.field].(string)
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", fmt.Errorf("%s: field %q is missing or empty", ref, r.field)
+	}
+	return value, nil
+}
+
+// Signer returns a signer for a vault:// reference: a local signer for the
+// seed of a KV secret, or a signer that signs with a Transit key in Vault.
+// prefix is the nkey type of Transit keys (e.g. nkeys.PrefixByteAccount),
+// whose public key is encoded with it.
+func (c *VaultClient) Signer(ctx context.Context, ref string, prefix nkeys.PrefixByte) (jwt.Signer, error) {
+	r, err := parseVaultRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	if r.engine == "kv" {
+		seed, err := c.ReadSecret(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		return jwt.NewLocalSigner(seed)
+	}
+
+	var resp struct {
+		Data struct {
+			Type          string `json:"type"`
+			LatestVersion int    `json:"latest_version"`
+			Keys          map[string]struct {
+				PublicKey string `json:"public_key"`
+			} `json:"keys"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, r.mount+"/keys/"+r.path, nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Data.Type != "ed25519" {
+		return nil, fmt.Errorf("%s: transit key type is %q, must be ed25519", ref, resp.Data.Type)
+	}
+	raw, err := base64.StdEncoding.DecodeString(resp.Data.Keys[fmt.Sprint(resp.Data.LatestVersion)].PublicKey)
+	if err != nil || len(raw) != 32 {
+		return nil, fmt.Errorf("%s: invalid transit public key", ref)
+	}
+	public, err := nkeys.Encode(prefix, raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: encoding public key: %w", ref, err)
+	}
+	c.startRenewal()
+	return &vaultTransitSigner{client: c, mount: r.mount, key: r.path, publicKey: string(public)}, nil
+}
+
+// vaultTransitSigner signs with a Vault Transit key.
+type vaultTransitSigner struct {
+	client    *VaultClient
+	mount     string
+	key       string
+	publicKey string
+}
+
+func (s *vaultTransitSigner) PublicKey() string {
+	return s.publicKey
+}
+
+func (s *vaultTransitSigner) Sign(data []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), vaultRequestTimeout)
+	defer cancel()
+	var resp struct {
+		Data struct {
+			Signature string `json:"signature"`
+		} `json:"data"`
+	}
+	body := map[string]string{"input": base64.StdEncoding.EncodeToString(data)}
+	if err := s.client.do(ctx, http.MethodPost, s.mount+"/sign/"+s.key, body, &resp); err != nil {
+		return nil, fmt.Errorf("signing with vault transit key %s: %w", s.key, err)
+	}
+	// Signatures are "vault:v<version>:<base64>".
+	i := strings.LastIndexByte(resp.Data.Signature, ':')
+	sig, err := base64.StdEncoding.DecodeString(resp.Data.Signature[i+1:])
+	if err != nil {
+		return nil, fmt.Errorf("decoding vault signature: %w", err)
+	}
+	return sig, nil
+}
+
+// startRenewal renews the token in the background if it is renewable. It is
+// called once the client is used beyond startup (Transit signing, account
+// refreshes).
+func (c *VaultClient) startRenewal() {
+	c.renewOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), vaultRequestTimeout)
+		defer cancel()
+		var resp struct {
+			Data struct {
+				TTL       int  `json:"ttl"`
+				Renewable bool `json:"renewable"`
+			} `json:"data"`
+		}
+		if err := c.do(ctx, http.MethodGet, "auth/token/lookup-self", nil, &resp); err != nil {
+			log.Printf("vault: looking up token: %v", err)
+			return
+		}
+		if !resp.Data.Renewable || resp.Data.TTL <= 0 {
+			return
+		}
+		c.wg.Add(1)
+		go c.renewLoop(time.Duration(resp.Data.TTL) * time.Second)
+	})
+}
+
+func (c *VaultClient) renewLoop(ttl time.Duration) {
+	defer c.wg.Done()
+	for {
+		wait := max(ttl/2, minVaultRenewInterval)
+		select {
+		case <-c.stop:
+			return
+		case <-time.After(wait):
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), vaultRequestTimeout)
+		var resp struct {
+			Auth struct {
+				LeaseDuration int  `json:"lease_duration"`
+				Renewable     bool `json:"renewable"`
+			} `json:"auth"`
+		}
+		err := c.do(ctx, http.MethodPost, "auth/token/renew-self", map[string]any{}, &resp)
+		cancel()
+		if err != nil {
+			// Retry before the token expires.
+			log.Printf("vault: renewing token: %v", err)
+			ttl = wait
+			continue
+		}
+		if !resp.Auth.Renewable || resp.Auth.LeaseDuration <= 0 {
+			return
+		}
+		ttl = time.Duration(resp.Auth.LeaseDuration) * time.Second
+	}
+}
+
+// Stop ends the token renewal.
+func (c *VaultClient) Stop() error {
+	c.stopOnce.Do(func() { close(c.stop) })
+	c.wg.Wait()
+	return nil
+}
+
+// keyLoader loads the signing keys of an account provider configuration from
+// seed files or Vault. The Vault client is created on first use.
+type keyLoader struct {
+	vaultConfig *VaultConfig
+	vault       *VaultClient
+}
+
+// load returns the signer for path, a seed file, plain or encrypted with
+// EncryptSeed, or a vault:// reference. prefix is the expected nkey type of Transit keys.
+func (l *keyLoader) load(path string, prefix nkeys.PrefixByte) (jwt.Signer, error) {
+	if !strings.HasPrefix(path, VaultScheme) {
+		return loadSignerFromFile(path)
+	}
+	if l.vault == nil {
+		cfg := VaultConfig{}
+		if l.vaultConfig != nil {
+			cfg = *l.vaultConfig
+		}
+		client, err := NewVaultClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+		l.vault = client
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), vaultRequestTimeout)
+	defer cancel()
+	return l.vault.Signer(ctx, path, prefix)
+}
+
+// stop ends the token renewal of the Vault client, if any.
+func (l *keyLoader) stop() error {
+	if l == nil || l.vault == nil {
+		return nil
+	}
+	return l.vault.Stop()
+}
@@ -0,0 +1,227 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nkeys"
+
+	"github.com/msimon/nauts/jwt"
+	"github.com/msimon/nauts/units"
+)
+
+// DefaultVaultAccountCacheTTL is the default time the accounts read from
+// Vault are cached.
+const DefaultVaultAccountCacheTTL = 5 * time.Minute
+
+// VaultAccountProvider implements AccountProvider in operator mode with the
+// accounts stored in HashiCorp Vault, so that signing keys never live on
+// disk. Every KV v2 secret in a directory is an account named after the
+// secret, with the fields:
+//
+//   - publicKey: the account public key
+//   - signingKey: an account signing key seed, or a vault://transit
+//     reference to an ed25519 Transit key (see VaultScheme)
+//
+// Accounts are re-read after the cache TTL; if Vault is unreachable, the
+// cached accounts stay in use.
+type VaultAccountProvider struct {
+	client   *VaultClient
+	mount    string
+	path     string
+	cacheTTL time.Duration
+
+	mu       sync.Mutex
+	accounts map[string]*vaultAccount
+	loadedAt time.Time
+}
+
+// vaultAccount is an account with the secret fields it was created from, so
+// that unchanged accounts keep their signer across refreshes.
+type vaultAccount struct {
+	account    *Account
+	signingKey string
+}
+
+// VaultAccountProviderConfig holds configuration for the VaultAccountProvider.
+type VaultAccountProviderConfig struct {
+	// Vault configures the connection to Vault.
+	Vault VaultConfig `json:"vault"`
+
+	// Mount is the KV v2 mount. Default: "secret".
+	Mount string `json:"mount,omitempty"`
+
+	// Path is the directory of the account secrets (e.g. "nauts/accounts").
+	Path string `json:"path"`
+
+	// CacheTTL is how long accounts are cached as a duration string.
+	// Default: "5m".
+	CacheTTL string `json:"cacheTtl,omitempty"`
+}
+
+// Validate checks the configuration.
+func (c *VaultAccountProviderConfig) Validate() error {
+	if strings.Trim(c.Path, "/") == "" {
+		return errors.New("path is required")
+	}
+	if c.CacheTTL != "" {
+		d, err := units.ParseDuration(c.CacheTTL)
+		if err != nil {
+			return fmt.Errorf("invalid cacheTtl: %w", err)
+		}
+		if d <= 0 {
+			return errors.New("cacheTtl must be positive")
+		}
+	}
+	return nil
+}
+
+// NewVaultAccountProvider creates a VaultAccountProvider and reads the
+// accounts from Vault.
+func NewVaultAccountProvider(cfg VaultAccountProviderConfig) (*VaultAccountProvider, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	client, err := NewVaultClient(cfg.Vault)
+	if err != nil {
+		return nil, err
+	}
+	p := &VaultAccountProvider{
+		client:   client,
+		mount:    firstNonEmpty(cfg.Mount, "secret"),
+		path:     strings.Trim(cfg.Path, "/"),
+		cacheTTL: DefaultVaultAccountCacheTTL,
+		accounts: make(map[string]*vaultAccount),
+	}
+	if cfg.CacheTTL != "" {
+		p.cacheTTL, _ = units.ParseDuration(cfg.CacheTTL)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), vaultRequestTimeout)
+	defer cancel()
+	if err := p.load(ctx); err != nil {
+		_ = client.Stop()
+		return nil, err
+	}
+	if len(p.accounts) == 0 {
+		_ = client.Stop()
+		return nil, fmt.Errorf("no accounts found in vault at %s/%s", p.mount, p.path)
+	}
+	client.startRenewal()
+	return p, nil
+}
+
+// load reads the accounts from Vault. Must be called with p.mu held or
+// before p is shared.
+func (p *VaultAccountProvider) load(ctx context.Context) error {
+	names, err := p.client.ListKV(ctx, p.mount, p.path)
+	if err != nil {
+		return fmt.Errorf("listing accounts: %w", err)
+	}
+	accounts := make(map[string]*vaultAccount, len(names))
+	for _, name := range names {
+		if strings.HasSuffix(name, "/") {
+			continue
+		}
+		data, err := p.client.ReadKV(ctx, p.mount, p.path+"/"+name)
+		if err != nil {
+			return fmt.Errorf("reading account %s: %w", name, err)
+		}
+		publicKey, _ := data["publicKey"].(string)
+		signingKey, _ := data["signingKey"].(string)
+		publicKey, signingKey = strings.TrimSpace(publicKey), strings.TrimSpace(signingKey)
+		if !nkeys.IsValidPublicAccountKey(publicKey) {
+			return fmt.Errorf("account %s: publicKey must be an account public key", name)
+		}
+		if signingKey == "" {
+			return fmt.Errorf("account %s: signingKey is required", name)
+		}
+		if old, ok := p.accounts[name]; ok && old.account.publicKey == publicKey && old.signingKey == signingKey {
+			accounts[name] = old
+			continue
+		}
+		acc, err := p.newAccount(ctx, name, publicKey, signingKey)
+		if err != nil {
+			return fmt.Errorf("account %s: %w", name, err)
+		}
+		accounts[name] = acc
+	}
+	p.accounts = accounts
+	p.loadedAt = time.Now()
+	return nil
+}
+
+func (p *VaultAccountProvider) newAccount(ctx context.Context, name, publicKey, signingKey string) (*vaultAccount, error) {
+	var signer jwt.Signer
+	var err error
+	if strings.HasPrefix(signingKey, VaultScheme) {
+		signer, err = p.client.Signer(ctx, signingKey, nkeys.PrefixByteAccount)
+	} else {
+		signer, err = jwt.NewLocalSigner(signingKey)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading signing key: %w", err)
+	}
+	acc := &Account{name: name, publicKey: publicKey, signer: signer}
+	return &vaultAccount{account: acc, signingKey: signingKey}, nil
+}
+
+// refresh re-reads the accounts once the cache expired. Failures are
+// logged and the cached accounts are kept.
+func (p *VaultAccountProvider) refresh(ctx context.Context) {
+	if time.Since(p.loadedAt) < p.cacheTTL {
+		return
+	}
+	if err := p.load(ctx); err != nil {
+		log.Printf("vault account provider: refreshing accounts: %v (using cached accounts)", err)
+		// Retry after the next cache period rather than on every request.
+		p.loadedAt = time.Now()
+	}
+}
+
+// GetAccount retrieves an account by name.
+func (p *VaultAccountProvider) GetAccount(ctx context.Context, name string) (*Account, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.refresh(ctx)
+	acc, ok := p.accounts[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAccountNotFound, name)
+	}
+	return acc.account, nil
+}
+
+// ListAccounts returns all accounts.
+func (p *VaultAccountProvider) ListAccounts(ctx context.Context) ([]*Account, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.refresh(ctx)
+	accounts := make([]*Account, 0, len(p.accounts))
+	for _, acc := range p.accounts {
+		accounts = append(accounts, acc.account)
+	}
+	return accounts, nil
+}
+
+// GetAccountLimits returns nil: account limits are not stored in Vault.
+func (p *VaultAccountProvider) GetAccountLimits(ctx context.Context, name string) (*AccountLimits, error) {
+	if _, err := p.GetAccount(ctx, name); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// IsOperatorMode returns true: every account has its own signing key.
+func (p *VaultAccountProvider) IsOperatorMode() bool {
+	return true
+}
+
+// Stop ends the Vault token renewal.
+func (p *VaultAccountProvider) Stop() error {
+	return p.client.Stop()
+}
@@ -0,0 +1,295 @@
+package provider
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nkeys"
+)
+
+// fakeVault serves the KV v2, Transit, and token endpoints used by
+// VaultClient.
+type fakeVault struct {
+	mu      sync.Mutex
+	secrets map[string]map[string]any // "<mount>/<path>" -> data
+	transit map[string]ed25519.PrivateKey
+	down    bool
+}
+
+func newFakeVault(t *testing.T) (*fakeVault, *httptest.Server) {
+	t.Helper()
+	f := &fakeVault{secrets: make(map[string]map[string]any), transit: make(map[string]ed25519.PrivateKey)}
+	srv := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeVault) set(path string, data map[string]any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.secrets[path] = data
+}
+
+func (f *fakeVault) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		http.Error(w, `{"errors":["sealed"]}`, http.StatusServiceUnavailable)
+		return
+	}
+	if r.Header.Get("X-Vault-Token") != "test-token" {
+		http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	reply := func(v any) { _ = json.NewEncoder(w).Encode(v) }
+	switch {
+	case path == "auth/token/lookup-self":
+		reply(map[string]any{"data": map[string]any{"ttl": 3600, "renewable": true}})
+	case path == "auth/token/renew-self":
+		reply(map[string]any{"auth": map[string]any{"lease_duration": 3600, "renewable": true}})
+	case r.Method == "LIST":
+		mount, dir, _ := strings.Cut(path, "/metadata/")
+		var keys []string
+		for p := range f.secrets {
+			if name, ok := strings.CutPrefix(p, mount+"/"+dir+"/"); ok && !strings.Contains(name, "/") {
+				keys = append(keys, name)
+			}
+		}
+		if len(keys) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		reply(map[string]any{"data": map[string]any{"keys": keys}})
+	case strings.Contains(path, "/data/"):
+		mount, secret, _ := strings.Cut(path, "/data/")
+		data, ok := f.secrets[mount+"/"+secret]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		reply(map[string]any{"data": map[string]any{"data": data}})
+	case strings.Contains(path, "/keys/"):
+		_, name, _ := strings.Cut(path, "/keys/")
+		key, ok := f.transit[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		public := base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+		reply(map[string]any{"data": map[string]any{
+			"type":           "ed25519",
+			"latest_version": 1,
+			"keys":           map[string]any{"1": map[string]any{"public_key": public}},
+		}})
+	case strings.Contains(path, "/sign/"):
+		_, name, _ := strings.Cut(path, "/sign/")
+		var req struct {
+			Input string `json:"input"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		input, _ := base64.StdEncoding.DecodeString(req.Input)
+		sig := ed25519.Sign(f.transit[name], input)
+		reply(map[string]any{"data": map[string]any{"signature": "vault:v1:" + base64.StdEncoding.EncodeToString(sig)}})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newTestVaultClient(t *testing.T, srv *httptest.Server) *VaultClient {
+	t.Helper()
+	t.Setenv("VAULT_TOKEN", "test-token")
+	client, err := NewVaultClient(VaultConfig{Address: srv.URL})
+	if err != nil {
+		t.Fatalf("NewVaultClient() error = %v", err)
+	}
+	t.Cleanup(func() { _ = client.Stop() })
+	return client
+}
+
+func TestParseVaultRef(t *testing.T) {
+	tests := []struct {
+		ref     string
+		want    vaultRef
+		wantErr bool
+	}{
+		{ref: "vault://kv/secret/nauts/auth", want: vaultRef{engine: "kv", mount: "secret", path: "nauts/auth", field: "seed"}},
+		{ref: "vault://kv/secret/nauts/auth#xkey", want: vaultRef{engine: "kv", mount: "secret", path: "nauts/auth", field: "xkey"}},
+		{ref: "vault://transit/transit/auth-signing", want: vaultRef{engine: "transit", mount: "transit", path: "auth-signing"}},
+		{ref: "vault://transit/transit/auth-signing#seed", wantErr: true},
+		{ref: "vault://kv/secret", wantErr: true},
+		{ref: "vault://pki/pki/cert", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseVaultRef(tt.ref)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseVaultRef(%q) = %+v, %v, want %+v (error %v)", tt.ref, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestVaultClient_Signer(t *testing.T) {
+	fake, srv := newFakeVault(t)
+	client := newTestVaultClient(t, srv)
+	ctx := context.Background()
+
+	kp, _ := nkeys.CreateAccount()
+	seed, _ := kp.Seed()
+	fake.set("secret/nauts/app", map[string]any{"seed": string(seed)})
+	_, fake.transit["auth-signing"], _ = ed25519.GenerateKey(nil)
+
+	t.Run("kv seed", func(t *testing.T) {
+		signer, err := client.Signer(ctx, "vault://kv/secret/nauts/app", nkeys.PrefixByteAccount)
+		if err != nil {
+			t.Fatalf("Signer() error = %v", err)
+		}
+		want, _ := kp.PublicKey()
+		if signer.PublicKey() != want {
+			t.Errorf("PublicKey() = %s, want %s", signer.PublicKey(), want)
+		}
+	})
+
+	t.Run("transit key", func(t *testing.T) {
+		signer, err := client.Signer(ctx, "vault://transit/transit/auth-signing", nkeys.PrefixByteAccount)
+		if err != nil {
+			t.Fatalf("Signer() error = %v", err)
+		}
+		if !nkeys.IsValidPublicAccountKey(signer.PublicKey()) {
+			t.Fatalf("PublicKey() = %s, want an account key", signer.PublicKey())
+		}
+		sig, err := signer.Sign([]byte("claims"))
+		if err != nil {
+			t.Fatalf("Sign() error = %v", err)
+		}
+		pub, _ := nkeys.FromPublicKey(signer.PublicKey())
+		if err := pub.Verify([]byte("claims"), sig); err != nil {
+			t.Errorf("Verify() error = %v", err)
+		}
+	})
+
+	t.Run("missing secret", func(t *testing.T) {
+		if _, err := client.Signer(ctx, "vault://kv/secret/nauts/missing", nkeys.PrefixByteAccount); err == nil {
+			t.Error("Signer() expected error")
+		}
+	})
+}
+
+func TestOperatorAccountProvider_VaultKey(t *testing.T) {
+	fake, srv := newFakeVault(t)
+	t.Setenv("VAULT_TOKEN", "test-token")
+	kp, _ := nkeys.CreateAccount()
+	seed, _ := kp.Seed()
+	fake.set("secret/nauts/auth", map[string]any{"signingKey": string(seed)})
+
+	p, err := NewOperatorAccountProvider(OperatorAccountProviderConfig{
+		Accounts: map[string]AccountSigningConfig{
+			"AUTH": {PublicKey: "AAUTH", SigningKeyPath: "vault://kv/secret/nauts/auth#signingKey"},
+		},
+		Vault: &VaultConfig{Address: srv.URL},
+	})
+	if err != nil {
+		t.Fatalf("NewOperatorAccountProvider() error = %v", err)
+	}
+	defer p.Stop()
+	acc, err := p.GetAccount(context.Background(), "AUTH")
+	if err != nil {
+		t.Fatalf("GetAccount() error = %v", err)
+	}
+	if want, _ := kp.PublicKey(); acc.Signer().PublicKey() != want {
+		t.Errorf("signer public key = %s, want %s", acc.Signer().PublicKey(), want)
+	}
+}
+
+func TestVaultAccountProvider(t *testing.T) {
+	fake, srv := newFakeVault(t)
+	t.Setenv("VAULT_TOKEN", "test-token")
+
+	authKp, _ := nkeys.CreateAccount()
+	authPub, _ := authKp.PublicKey()
+	signKp, _ := nkeys.CreateAccount()
+	signSeed, _ := signKp.Seed()
+	fake.set("secret/nauts/accounts/AUTH", map[string]any{"publicKey": authPub, "signingKey": string(signSeed)})
+	_, fake.transit["app"], _ = ed25519.GenerateKey(nil)
+	appKp, _ := nkeys.CreateAccount()
+	appPub, _ := appKp.PublicKey()
+	fake.set("secret/nauts/accounts/APP", map[string]any{"publicKey": appPub, "signingKey": "vault://transit/transit/app"})
+
+	p, err := NewVaultAccountProvider(VaultAccountProviderConfig{
+		Vault:    VaultConfig{Address: srv.URL},
+		Path:     "nauts/accounts",
+		CacheTTL: "1h",
+	})
+	if err != nil {
+		t.Fatalf("NewVaultAccountProvider() error = %v", err)
+	}
+	defer p.Stop()
+	ctx := context.Background()
+
+	accounts, err := p.ListAccounts(ctx)
+	if err != nil || len(accounts) != 2 {
+		t.Fatalf("ListAccounts() = %d accounts, %v, want 2", len(accounts), err)
+	}
+	auth, err := p.GetAccount(ctx, "AUTH")
+	if err != nil {
+		t.Fatalf("GetAccount(AUTH) error = %v", err)
+	}
+	if want, _ := signKp.PublicKey(); auth.PublicKey() != authPub || auth.Signer().PublicKey() != want {
+		t.Errorf("AUTH keys = %s, %s", auth.PublicKey(), auth.Signer().PublicKey())
+	}
+	if !p.IsOperatorMode() {
+		t.Error("IsOperatorMode() = false")
+	}
+
+	appBefore, _ := p.GetAccount(ctx, "APP")
+
+	// New accounts appear after the cache TTL; outages keep cached accounts.
+	fake.set("secret/nauts/accounts/NEW", map[string]any{"publicKey": appPub, "signingKey": string(signSeed)})
+	if _, err := p.GetAccount(ctx, "NEW"); err == nil {
+		t.Error("GetAccount(NEW) before cache expiry: expected error")
+	}
+	p.mu.Lock()
+	p.loadedAt = time.Now().Add(-2 * time.Hour)
+	p.mu.Unlock()
+	if _, err := p.GetAccount(ctx, "NEW"); err != nil {
+		t.Errorf("GetAccount(NEW) after cache expiry error = %v", err)
+	}
+	if app, _ := p.GetAccount(ctx, "APP"); app != appBefore {
+		t.Error("unchanged account APP did not keep its signer across refreshes")
+	}
+
+	fake.mu.Lock()
+	fake.down = true
+	fake.mu.Unlock()
+	p.mu.Lock()
+	p.loadedAt = time.Now().Add(-2 * time.Hour)
+	p.mu.Unlock()
+	if _, err := p.GetAccount(ctx, "AUTH"); err != nil {
+		t.Errorf("GetAccount(AUTH) during outage error = %v", err)
+	}
+}
+
+func TestVaultAccountProviderConfig_Validate(t *testing.T) {
+	tests := []struct {
+		cfg     VaultAccountProviderConfig
+		wantErr string
+	}{
+		{cfg: VaultAccountProviderConfig{Path: "nauts/accounts"}},
+		{cfg: VaultAccountProviderConfig{}, wantErr: "path is required"},
+		{cfg: VaultAccountProviderConfig{Path: "a", CacheTTL: "1x"}, wantErr: "invalid cacheTtl"},
+		{cfg: VaultAccountProviderConfig{Path: "a", CacheTTL: "0s"}, wantErr: "cacheTtl must be positive"},
+	}
+	for _, tt := range tests {
+		err := tt.cfg.Validate()
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("Validate(%+v) error = %v, want %q", tt.cfg, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package release
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// BuildOptions configures Build.
+type BuildOptions struct {
+	// Version is embedded in the binaries and used in asset names (e.g., "v1.2.0").
+	Version string
+	// Package is the main package to build (default "./cmd/nauts").
+	Package string
+	// OutDir receives the assets (default "dist").
+	OutDir string
+	// Platforms are GOOS/GOARCH pairs (default DefaultPlatforms).
+	Platforms []string
+	// SigningKey signs the checksums; its public key is embedded in the
+	// binaries to verify later updates.
+	SigningKey ed25519.PrivateKey
+	// Stderr receives the output of the go tool (default os.Stderr).
+	Stderr io.Writer
+}
+
+// Build cross-compiles the release binaries with the go tool and writes them
+// together with ChecksumsFile and SignatureFile to OutDir. It returns the
+// paths of all written files.
+//
+// The binaries are built with CGO disabled, and with main.version and
+// main.releasePublicKey set through -ldflags.
+func Build(ctx context.Context, opts BuildOptions) ([]string, error) {
+	if opts.Version == "" {
+		return nil, fmt.Errorf("version is required")
+	}
+	if opts.SigningKey == nil {
+		return nil, fmt.Errorf("signing key is required")
+	}
+	if opts.Package == "" {
+		opts.Package = "./cmd/nauts"
+	}
+	if opts.OutDir == "" {
+		opts.OutDir = "dist"
+	}
+	if len(opts.Platforms) == 0 {
+		opts.Platforms = DefaultPlatforms
+	}
+	if opts.Stderr == nil {
+		opts.Stderr = os.Stderr
+	}
+	if err := os.MkdirAll(opts.OutDir, 0755); err != nil {
+		return nil, err
+	}
+
+	ldflags := fmt.Sprintf("-s -w -X main.version=%s -X main.releasePublicKey=%s", opts.Version, PublicKey(opts.SigningKey))
+	binaries := make([]string, 0, len(opts.Platforms))
+	for _, platform := range opts.Platforms {
+		goos, goarch, ok := strings.Cut(platform, "/")
+		if !ok || goos == "" || goarch == "" {
+			return nil, fmt.Errorf("invalid platform %q (expected GOOS/GOARCH)", platform)
+		}
+		out := filepath.Join(opts.OutDir, AssetName(opts.Version, goos, goarch))
+		cmd := exec.CommandContext(ctx, "go", "build", "-trimpath", "-ldflags", ldflags, "-o", out, opts.Package)
+		cmd.Env = append(os.Environ(), "GOOS="+goos, "GOARCH="+goarch, "CGO_ENABLED=0")
+		cmd.Stdout = opts.Stderr
+		cmd.Stderr = opts.Stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("building %s: %w", platform, err)
+		}
+		binaries = append(binaries, out)
+	}
+
+	checksums, err := Checksums(binaries)
+	if err != nil {
+		return nil, err
+	}
+	checksumsPath := filepath.Join(opts.OutDir, ChecksumsFile)
+	if err := os.WriteFile(checksumsPath, checksums, 0644); err != nil {
+		return nil, err
+	}
+	signaturePath := filepath.Join(opts.OutDir, SignatureFile)
+	if err := os.WriteFile(signaturePath, Sign(opts.SigningKey, checksums), 0644); err != nil {
+		return nil, err
+	}
+	return append(binaries, checksumsPath, signaturePath), nil
+}
@@ -0,0 +1,146 @@
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultURL is the GitHub API base URL of the nauts repository.
+const DefaultURL = "https://api.github.com/repos/msimon/nauts"
+
+// maxAssetSize bounds downloads, so a misbehaving server cannot exhaust memory.
+const maxAssetSize = 256 << 20
+
+// Release is a published release and the download URLs of its assets.
+type Release struct {
+	Version string            `json:"version"`
+	Assets  map[string]string `json:"assets"`
+}
+
+// Client fetches releases from a GitHub-compatible releases API.
+type Client struct {
+	// BaseURL is the repository API URL (default DefaultURL). Mirrors must
+	// serve GET <BaseURL>/releases/latest and /releases/tags/<version> like
+	// the GitHub API.
+	BaseURL string
+	// HTTPClient is used for all requests (default: 60s timeout).
+	HTTPClient *http.Client
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return &http.Client{Timeout: 60 * time.Second}
+}
+
+func (c *Client) baseURL() string {
+	if c.BaseURL != "" {
+		return strings.TrimSuffix(c.BaseURL, "/")
+	}
+	return DefaultURL
+}
+
+// Latest returns the latest published release.
+func (c *Client) Latest(ctx context.Context) (*Release, error) {
+	return c.fetchRelease(ctx, c.baseURL()+"/releases/latest")
+}
+
+// Get returns the release with the given version tag.
+func (c *Client) Get(ctx context.Context, version string) (*Release, error) {
+	return c.fetchRelease(ctx, c.baseURL()+"/releases/tags/"+version)
+}
+
+func (c *Client) fetchRelease(ctx context.Context, url string) (*Release, error) {
+	data, err := c.get(ctx, url, "application/vnd.github+json", 1<<20)
+	if err != nil {
+		return nil, err
+	}
+	var gh struct {
+		TagName string `json:"tag_name"`
+		Assets  []struct {
+			Name string `json:"name"`
+			URL  string `json:"browser_download_url"`
+		} `json:"assets"`
+	}
+	if err := json.Unmarshal(data, &gh); err != nil {
+		return nil, fmt.Errorf("decoding release from %s: %w", url, err)
+	}
+	if gh.TagName == "" {
+		return nil, fmt.Errorf("release from %s has no tag", url)
+	}
+	rel := &Release{Version: gh.TagName, Assets: make(map[string]string, len(gh.Assets))}
+	for _, a := range gh.Assets {
+		rel.Assets[a.Name] = a.URL
+	}
+	return rel, nil
+}
+
+// Download fetches the binary for a platform from rel and verifies it: the
+// checksums file must carry a valid signature of publicKey, and the binary
+// must match its signed checksum.
+func (c *Client) Download(ctx context.Context, rel *Release, goos, goarch, publicKey string) ([]byte, error) {
+	if publicKey == "" {
+		return nil, ErrNoPublicKey
+	}
+	asset := AssetName(rel.Version, goos, goarch)
+
+	checksums, err := c.asset(ctx, rel, ChecksumsFile)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := c.asset(ctx, rel, SignatureFile)
+	if err != nil {
+		return nil, err
+	}
+	sums, err := Verify(publicKey, checksums, signature)
+	if err != nil {
+		return nil, fmt.Errorf("release %s: %w", rel.Version, err)
+	}
+
+	data, err := c.asset(ctx, rel, asset)
+	if err != nil {
+		return nil, err
+	}
+	if err := VerifyAsset(sums, asset, data); err != nil {
+		return nil, fmt.Errorf("release %s: %w", rel.Version, err)
+	}
+	return data, nil
+}
+
+func (c *Client) asset(ctx context.Context, rel *Release, name string) ([]byte, error) {
+	url, ok := rel.Assets[name]
+	if !ok {
+		return nil, fmt.Errorf("release %s has no asset %s", rel.Version, name)
+	}
+	return c.get(ctx, url, "application/octet-stream", maxAssetSize)
+}
+
+func (c *Client) get(ctx context.Context, url, accept string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", url, err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("fetching %s: response exceeds %d bytes", url, limit)
+	}
+	return data, nil
+}
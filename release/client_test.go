@@ -0,0 +1,129 @@
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestReleaseServer serves a GitHub-style release with the given assets.
+func newTestReleaseServer(t *testing.T, version string, assets map[string][]byte) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	var srv *httptest.Server
+	release := func(w http.ResponseWriter, _ *http.Request) {
+		type asset struct {
+			Name string `json:"name"`
+			URL  string `json:"browser_download_url"`
+		}
+		body := struct {
+			TagName string  `json:"tag_name"`
+			Assets  []asset `json:"assets"`
+		}{TagName: version}
+		for name := range assets {
+			body.Assets = append(body.Assets, asset{Name: name, URL: srv.URL + "/download/" + name})
+		}
+		_ = json.NewEncoder(w).Encode(body)
+	}
+	mux.HandleFunc("/releases/latest", release)
+	mux.HandleFunc("/releases/tags/"+version, release)
+	mux.HandleFunc("/download/", func(w http.ResponseWriter, r *http.Request) {
+		data, ok := assets[strings.TrimPrefix(r.URL.Path, "/download/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(data)
+	})
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestClient_Download(t *testing.T) {
+	pub, keyPath := writeKey(t)
+	priv, err := LoadPrivateKey(keyPath)
+	if err != nil {
+		t.Fatalf("LoadPrivateKey() error = %v", err)
+	}
+	asset := AssetName("v1.3.0", "linux", "amd64")
+	binary := filepath.Join(t.TempDir(), asset)
+	if err := os.WriteFile(binary, []byte("new binary"), 0755); err != nil {
+		t.Fatalf("writing binary: %v", err)
+	}
+	checksums, err := Checksums([]string{binary})
+	if err != nil {
+		t.Fatalf("Checksums() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		assets  map[string][]byte
+		wantErr error
+	}{
+		{
+			name:   "verified",
+			assets: map[string][]byte{asset: []byte("new binary"), ChecksumsFile: checksums, SignatureFile: Sign(priv, checksums)},
+		},
+		{
+			name:    "tampered binary",
+			assets:  map[string][]byte{asset: []byte("evil binary"), ChecksumsFile: checksums, SignatureFile: Sign(priv, checksums)},
+			wantErr: ErrChecksumMismatch,
+		},
+		{
+			name:    "unsigned checksums",
+			assets:  map[string][]byte{asset: []byte("evil binary"), ChecksumsFile: []byte(strings.Repeat("0", 64) + "  " + asset + "\n"), SignatureFile: Sign(priv, checksums)},
+			wantErr: ErrInvalidSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestReleaseServer(t, "v1.3.0", tt.assets)
+			client := &Client{BaseURL: srv.URL}
+
+			rel, err := client.Latest(context.Background())
+			if err != nil {
+				t.Fatalf("Latest() error = %v", err)
+			}
+			if rel.Version != "v1.3.0" {
+				t.Errorf("Version = %q, want v1.3.0", rel.Version)
+			}
+
+			data, err := client.Download(context.Background(), rel, "linux", "amd64", pub)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Download() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+			if string(data) != "new binary" {
+				t.Errorf("Download() = %q", data)
+			}
+		})
+	}
+}
+
+func TestClient_Get(t *testing.T) {
+	srv := newTestReleaseServer(t, "v1.3.0", map[string][]byte{})
+	client := &Client{BaseURL: srv.URL + "/"}
+
+	rel, err := client.Get(context.Background(), "v1.3.0")
+	if err != nil || rel.Version != "v1.3.0" {
+		t.Fatalf("Get() = %+v, %v", rel, err)
+	}
+	if _, err := client.Get(context.Background(), "v9.9.9"); err == nil {
+		t.Error("Get() of a missing release succeeded")
+	}
+	if _, err := client.Download(context.Background(), rel, "linux", "amd64", ""); !errors.Is(err, ErrNoPublicKey) {
+		t.Errorf("Download() without key error = %v, want ErrNoPublicKey", err)
+	}
+}
@@ -0,0 +1,226 @@
+// Package release builds, signs, and installs nauts release artifacts.
+//
+// A release consists of one binary per platform (see AssetName), a
+// ChecksumsFile listing their SHA-256 digests, and a SignatureFile holding an
+// Ed25519 signature of the checksums file. Binaries verify updates with the
+// public key embedded at build time, so a compromised download location
+// cannot serve a binary that was not signed with the release key.
+package release
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ChecksumsFile is the release asset listing "<sha256>  <asset>" lines.
+	ChecksumsFile = "SHA256SUMS"
+	// SignatureFile is the release asset holding the base64 Ed25519
+	// signature of ChecksumsFile.
+	SignatureFile = ChecksumsFile + ".sig"
+)
+
+// DefaultPlatforms are the GOOS/GOARCH pairs a release is built for.
+var DefaultPlatforms = []string{
+	"linux/amd64",
+	"linux/arm64",
+	"linux/arm",
+	"darwin/amd64",
+	"darwin/arm64",
+	"windows/amd64",
+}
+
+var (
+	// ErrNoPublicKey is returned when a binary was built without a release
+	// signing key and therefore cannot verify updates.
+	ErrNoPublicKey = errors.New("no release signing key embedded in this build")
+	// ErrInvalidSignature is returned when the checksums file does not match
+	// its signature.
+	ErrInvalidSignature = errors.New("invalid release signature")
+	// ErrChecksumMismatch is returned when a downloaded asset does not match
+	// the signed checksum.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+)
+
+// AssetName returns the file name of the binary for a platform, e.g.
+// "nauts_v1.2.0_linux_amd64" or "nauts_v1.2.0_windows_amd64.exe".
+func AssetName(version, goos, goarch string) string {
+	name := fmt.Sprintf("nauts_%s_%s_%s", version, goos, goarch)
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// GenerateKey creates a new Ed25519 signing key pair. Both keys are returned
+// base64-encoded; the private key is the 32-byte seed.
+func GenerateKey() (publicKey, privateKey string, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", fmt.Errorf("generating key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(pub), base64.StdEncoding.EncodeToString(priv.Seed()), nil
+}
+
+// LoadPrivateKey reads a base64-encoded private key written by GenerateKey.
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading signing key: %w", err)
+	}
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("signing key %s: expected a base64 Ed25519 seed", path)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// PublicKey returns the base64-encoded public key of a private key.
+func PublicKey(priv ed25519.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(priv.Public().(ed25519.PublicKey))
+}
+
+// Checksums returns the content of ChecksumsFile for the given files, using
+// their base names as asset names.
+func Checksums(paths []string) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		sum := sha256.Sum256(data)
+		fmt.Fprintf(&buf, "%s  %s\n", hex.EncodeToString(sum[:]), filepath.Base(path))
+	}
+	return buf.Bytes(), nil
+}
+
+// Sign returns the content of SignatureFile for a checksums file.
+func Sign(priv ed25519.PrivateKey, checksums []byte) []byte {
+	return []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, checksums)) + "\n")
+}
+
+// Verify checks the signature of a checksums file with a base64-encoded
+// public key and returns the parsed checksums by asset name.
+func Verify(publicKey string, checksums, signature []byte) (map[string]string, error) {
+	if publicKey == "" {
+		return nil, ErrNoPublicKey
+	}
+	pub, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("release public key: expected a base64 Ed25519 key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil || !ed25519.Verify(pub, checksums, sig) {
+		return nil, ErrInvalidSignature
+	}
+	return parseChecksums(checksums)
+}
+
+func parseChecksums(data []byte) (map[string]string, error) {
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 || len(fields[0]) != sha256.Size*2 {
+			return nil, fmt.Errorf("%s line %d: expected \"<sha256>  <asset>\"", ChecksumsFile, line)
+		}
+		sums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+	}
+	return sums, scanner.Err()
+}
+
+// VerifyAsset checks data against the checksum of asset.
+func VerifyAsset(sums map[string]string, asset string, data []byte) error {
+	want, ok := sums[asset]
+	if !ok {
+		return fmt.Errorf("%s lists no checksum for %s", ChecksumsFile, asset)
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return fmt.Errorf("%w: %s has sha256 %s, want %s", ErrChecksumMismatch, asset, got, want)
+	}
+	return nil
+}
+
+// IsNewer reports whether version latest is newer than current. Versions are
+// compared as vMAJOR.MINOR.PATCH; a version that does not parse (such as the
+// "dev" of local builds) is considered older than any release.
+func IsNewer(latest, current string) bool {
+	l, okL := parseVersion(latest)
+	c, okC := parseVersion(current)
+	switch {
+	case !okL:
+		return false
+	case !okC:
+		return true
+	}
+	for i := range l {
+		if l[i] != c[i] {
+			return l[i] > c[i]
+		}
+	}
+	return false
+}
+
+func parseVersion(v string) ([3]int, bool) {
+	var parts [3]int
+	v, _, _ = strings.Cut(strings.TrimPrefix(v, "v"), "-")
+	fields := strings.Split(v, ".")
+	if len(fields) != 3 {
+		return parts, false
+	}
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
+
+// ReplaceExecutable atomically replaces the file at path with data, keeping
+// its permissions. The new file is written next to path and renamed over it,
+// so a running process keeps its old image until it is restarted.
+func ReplaceExecutable(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".update-*")
+	if err != nil {
+		return fmt.Errorf("creating update file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing update file: %w", err)
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("setting permissions: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing update file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replacing %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package release
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAssetName(t *testing.T) {
+	if got := AssetName("v1.2.0", "linux", "arm64"); got != "nauts_v1.2.0_linux_arm64" {
+		t.Errorf("AssetName() = %q", got)
+	}
+	if got := AssetName("v1.2.0", "windows", "amd64"); got != "nauts_v1.2.0_windows_amd64.exe" {
+		t.Errorf("AssetName() = %q", got)
+	}
+}
+
+func writeKey(t *testing.T) (string, string) {
+	t.Helper()
+	pub, priv, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "release.key")
+	if err := os.WriteFile(path, []byte(priv+"\n"), 0600); err != nil {
+		t.Fatalf("writing key: %v", err)
+	}
+	return pub, path
+}
+
+func TestSignAndVerify(t *testing.T) {
+	pub, keyPath := writeKey(t)
+	priv, err := LoadPrivateKey(keyPath)
+	if err != nil {
+		t.Fatalf("LoadPrivateKey() error = %v", err)
+	}
+	if PublicKey(priv) != pub {
+		t.Fatalf("PublicKey() = %q, want %q", PublicKey(priv), pub)
+	}
+
+	dir := t.TempDir()
+	binary := filepath.Join(dir, AssetName("v1.0.0", "linux", "amd64"))
+	if err := os.WriteFile(binary, []byte("binary"), 0755); err != nil {
+		t.Fatalf("writing binary: %v", err)
+	}
+	checksums, err := Checksums([]string{binary})
+	if err != nil {
+		t.Fatalf("Checksums() error = %v", err)
+	}
+	sig := Sign(priv, checksums)
+
+	sums, err := Verify(pub, checksums, sig)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if err := VerifyAsset(sums, filepath.Base(binary), []byte("binary")); err != nil {
+		t.Errorf("VerifyAsset() error = %v", err)
+	}
+	if err := VerifyAsset(sums, filepath.Base(binary), []byte("tampered")); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("VerifyAsset(tampered) error = %v, want ErrChecksumMismatch", err)
+	}
+	if err := VerifyAsset(sums, "nauts_v1.0.0_darwin_arm64", []byte("binary")); err == nil {
+		t.Error("VerifyAsset(unlisted asset) succeeded")
+	}
+
+	otherPub, _ := writeKey(t)
+	tampered := append([]byte(nil), checksums...)
+	tampered[0] ^= 1
+	tests := []struct {
+		name      string
+		pub       string
+		checksums []byte
+		sig       []byte
+		want      error
+	}{
+		{"no key", "", checksums, sig, ErrNoPublicKey},
+		{"other key", otherPub, checksums, sig, ErrInvalidSignature},
+		{"tampered checksums", pub, tampered, sig, ErrInvalidSignature},
+		{"garbage signature", pub, checksums, []byte("not base64!"), ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Verify(tt.pub, tt.checksums, tt.sig); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadPrivateKey_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "release.key")
+	if err := os.WriteFile(path, []byte("c2hvcnQ=\n"), 0600); err != nil {
+		t.Fatalf("writing key: %v", err)
+	}
+	if _, err := LoadPrivateKey(path); err == nil {
+		t.Error("LoadPrivateKey() accepted a short key")
+	}
+}
+
+func TestIsNewer(t *testing.T) {
+	tests := []struct {
+		latest, current string
+		want            bool
+	}{
+		{"v1.2.0", "v1.1.9", true},
+		{"v1.10.0", "v1.9.0", true},
+		{"v2.0.0", "v1.99.99", true},
+		{"v1.2.0", "v1.2.0", false},
+		{"v1.2.0", "v1.3.0", false},
+		{"1.2.1", "v1.2.0", true},
+		{"v1.2.0", "dev", true},
+		{"latest", "v1.2.0", false},
+		{"v1.2.0-rc.1", "v1.1.0", true},
+	}
+	for _, tt := range tests {
+		if got := IsNewer(tt.latest, tt.current); got != tt.want {
+			t.Errorf("IsNewer(%q, %q) = %v, want %v", tt.latest, tt.current, got, tt.want)
+		}
+	}
+}
+
+func TestReplaceExecutable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nauts")
+	if err := os.WriteFile(path, []byte("old"), 0750); err != nil {
+		t.Fatalf("writing executable: %v", err)
+	}
+	if err := ReplaceExecutable(path, []byte("new")); err != nil {
+		t.Fatalf("ReplaceExecutable() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "new" {
+		t.Errorf("executable = %q, %v, want new", data, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0750 {
+		t.Errorf("mode = %v, %v, want 0750", info.Mode().Perm(), err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries, want only the executable", len(entries))
+	}
+}
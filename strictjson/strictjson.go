@@ -0,0 +1,159 @@
+// Package strictjson decodes JSON files written by hand, such as the nauts
+// configuration, policies, bindings, and users. Unlike encoding/json, it
+// rejects duplicate object keys, and errors report the line, column, and
+// field they occurred at.
+package strictjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Error is a decoding error located in the input.
+type Error struct {
+	// Line and Column are 1-based; Column counts bytes.
+	Line   int
+	Column int
+	// Field is the path of the offending field (e.g. "server.ttl" or
+	// "[2].statements[0].effect"); empty at the top level.
+	Field string
+	Msg   string
+	// Err is the underlying encoding/json error, if any.
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("line %d, column %d: field %q: %s", e.Line, e.Column, e.Field, e.Msg)
+	}
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Unmarshal decodes data into v like json.Unmarshal, but fails on duplicate
+// object keys and returns an *Error for syntax errors, type mismatches, and
+// duplicate keys. Errors returned by custom UnmarshalJSON methods are passed
+// through unchanged.
+func Unmarshal(data []byte, v any) error {
+	if err := checkDuplicateKeys(data); err != nil {
+		return err
+	}
+	err := json.Unmarshal(data, v)
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		// The offset is past the offending byte.
+		return newError(data, syntaxErr.Offset-1, "", syntaxErr.Error(), err)
+	case errors.As(err, &typeErr):
+		msg := fmt.Sprintf("cannot use %s as %s", typeErr.Value, typeErr.Type)
+		return newError(data, literalStart(data, typeErr.Offset), typeErr.Field, msg, err)
+	}
+	return err
+}
+
+// newError returns an *Error located at offset in data.
+func newError(data []byte, offset int64, field, msg string, err error) *Error {
+	offset = max(0, min(offset, int64(len(data))))
+	line, column := 1, 1
+	for _, b := range data[:offset] {
+		if b == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return &Error{Line: line, Column: column, Field: field, Msg: msg, Err: err}
+}
+
+// literalStart returns the start of the string, number, or literal ending at
+// offset, which json.UnmarshalTypeError reports.
+func literalStart(data []byte, offset int64) int64 {
+	if offset <= 0 || offset > int64(len(data)) {
+		return offset
+	}
+	i := offset - 1
+	if data[i] == '"' {
+		for i--; i >= 0; i-- {
+			if data[i] == '"' && (i == 0 || data[i-1] != '\\') {
+				return i
+			}
+		}
+		return offset
+	}
+	for i >= 0 && !bytes.ContainsRune([]byte(" \t\r\n:,[{"), rune(data[i])) {
+		i--
+	}
+	return i + 1
+}
+
+// checkDuplicateKeys walks the tokens of data and returns an *Error for the
+// first object key that appears twice in the same object. Syntax errors are
+// left to json.Unmarshal, which reports them with their offset.
+func checkDuplicateKeys(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	err := checkValue(dec, data, "")
+	var dup *Error
+	if errors.As(err, &dup) {
+		return dup
+	}
+	return nil
+}
+
+func checkValue(dec *json.Decoder, data []byte, path string) error {
+	tok, err := dec.Token()
+	if err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	switch tok {
+	case json.Delim('{'):
+		keys := make(map[string]struct{})
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			key, _ := tok.(string)
+			field := joinField(path, key)
+			if _, ok := keys[key]; ok {
+				// The offset is past the key; point at its opening quote.
+				start := dec.InputOffset() - int64(len(strconv.Quote(key)))
+				return newError(data, start, field, fmt.Sprintf("duplicate key %q", key), nil)
+			}
+			keys[key] = struct{}{}
+			if err := checkValue(dec, data, field); err != nil {
+				return err
+			}
+		}
+		_, err = dec.Token()
+		return err
+	case json.Delim('['):
+		for i := 0; dec.More(); i++ {
+			if err := checkValue(dec, data, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		_, err = dec.Token()
+		return err
+	}
+	return nil
+}
+
+func joinField(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,79 @@
+package strictjson
+
+import (
+	"errors"
+	"testing"
+)
+
+type testConfig struct {
+	Server struct {
+		TTL  string `json:"ttl"`
+		Port int    `json:"port"`
+	} `json:"server"`
+	Items []struct {
+		ID string `json:"id"`
+	} `json:"items"`
+}
+
+func TestUnmarshal(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantLine  int
+		wantCol   int
+		wantField string
+	}{
+		{
+			name:  "valid",
+			input: `{"server": {"ttl": "1h", "port": 4222}, "items": [{"id": "a"}]}`,
+		},
+		{
+			name:     "syntax error",
+			input:    "{\n  \"server\": {\n    \"ttl\": \"1h\",\n  }\n}",
+			wantLine: 4,
+			wantCol:  3,
+		},
+		{
+			name:      "type mismatch",
+			input:     "{\n  \"server\": {\n    \"port\": \"4222\"\n  }\n}",
+			wantLine:  3,
+			wantCol:   13,
+			wantField: "server.port",
+		},
+		{
+			name:      "duplicate key",
+			input:     "{\n  \"server\": {\"ttl\": \"1h\"},\n  \"server\": {}\n}",
+			wantLine:  3,
+			wantCol:   3,
+			wantField: "server",
+		},
+		{
+			name:      "duplicate key in array element",
+			input:     `{"items": [{"id": "a"}, {"id": "b", "id": "c"}]}`,
+			wantLine:  1,
+			wantCol:   37,
+			wantField: "items[1].id",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg testConfig
+			err := Unmarshal([]byte(tt.input), &cfg)
+			if tt.wantLine == 0 {
+				if err != nil {
+					t.Fatalf("Unmarshal() error = %v", err)
+				}
+				return
+			}
+			var serr *Error
+			if !errors.As(err, &serr) {
+				t.Fatalf("Unmarshal() error = %v, want *Error", err)
+			}
+			if serr.Line != tt.wantLine || serr.Column != tt.wantCol || serr.Field != tt.wantField {
+				t.Errorf("error at line %d, column %d, field %q (%v), want line %d, column %d, field %q",
+					serr.Line, serr.Column, serr.Field, serr, tt.wantLine, tt.wantCol, tt.wantField)
+			}
+		})
+	}
+}
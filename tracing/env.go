@@ -0,0 +1,217 @@
+package tracing
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultServiceName is the service.name resource attribute unless
+	// OTEL_SERVICE_NAME or OTEL_RESOURCE_ATTRIBUTES sets it.
+	DefaultServiceName = "nauts"
+
+	// DefaultOTLPEndpoint is the base URL of the OTLP/HTTP receiver of a
+	// local OpenTelemetry collector.
+	DefaultOTLPEndpoint = "http://localhost:4318"
+)
+
+// NewFromEnv creates a tracer from the standard OpenTelemetry environment
+// variables. It returns nil if tracing is not enabled: tracing is enabled by
+// OTEL_TRACES_EXPORTER (otlp or console) or by setting an OTLP endpoint, and
+// disabled by OTEL_SDK_DISABLED=true or OTEL_TRACES_EXPORTER=none.
+//
+// Supported variables: OTEL_SERVICE_NAME, OTEL_RESOURCE_ATTRIBUTES,
+// OTEL_TRACES_SAMPLER, OTEL_TRACES_SAMPLER_ARG, OTEL_BSP_SCHEDULE_DELAY,
+// OTEL_BSP_MAX_QUEUE_SIZE, OTEL_BSP_MAX_EXPORT_BATCH_SIZE, and
+// OTEL_EXPORTER_OTLP_{ENDPOINT,HEADERS,TIMEOUT,CERTIFICATE,PROTOCOL} with
+// their OTEL_EXPORTER_OTLP_TRACES_ variants. Only the http/json protocol is
+// supported.
+func NewFromEnv() (*Tracer, error) {
+	return newFromEnv(os.Getenv)
+}
+
+func newFromEnv(getenv func(string) string) (*Tracer, error) {
+	if strings.EqualFold(getenv("OTEL_SDK_DISABLED"), "true") {
+		return nil, nil
+	}
+	exporterName := getenv("OTEL_TRACES_EXPORTER")
+	if exporterName == "" && getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return nil, nil
+	}
+
+	var exporter Exporter
+	switch exporterName {
+	case "none":
+		return nil, nil
+	case "", "otlp":
+		e, err := otlpExporterFromEnv(getenv)
+		if err != nil {
+			return nil, err
+		}
+		exporter = e
+	case "console":
+		exporter = NewWriterExporter(os.Stderr)
+	default:
+		return nil, fmt.Errorf("OTEL_TRACES_EXPORTER: unsupported exporter %q", exporterName)
+	}
+
+	sampler, err := ParseSampler(getenv("OTEL_TRACES_SAMPLER"), getenv("OTEL_TRACES_SAMPLER_ARG"))
+	if err != nil {
+		return nil, fmt.Errorf("OTEL_TRACES_SAMPLER: %w", err)
+	}
+	resource, err := resourceFromEnv(getenv)
+	if err != nil {
+		return nil, err
+	}
+	opts := TracerOptions{
+		Resource: resource,
+		Sampler:  sampler,
+		ErrorFunc: func(err error) {
+			log.Printf("tracing: %v", err)
+		},
+	}
+	if opts.BatchDelay, err = millisFromEnv(getenv, "OTEL_BSP_SCHEDULE_DELAY"); err != nil {
+		return nil, err
+	}
+	if opts.MaxQueueSize, err = intFromEnv(getenv, "OTEL_BSP_MAX_QUEUE_SIZE"); err != nil {
+		return nil, err
+	}
+	if opts.MaxBatchSize, err = intFromEnv(getenv, "OTEL_BSP_MAX_EXPORT_BATCH_SIZE"); err != nil {
+		return nil, err
+	}
+	return NewTracer(exporter, opts), nil
+}
+
+// otlpExporterFromEnv configures the OTLP exporter. Signal-specific
+// variables take precedence; a signal-specific endpoint is used as is, while
+// /v1/traces is appended to the generic one.
+func otlpExporterFromEnv(getenv func(string) string) (*OTLPExporter, error) {
+	lookup := func(name string) (string, string) {
+		specific := "OTEL_EXPORTER_OTLP_TRACES_" + name
+		if v := getenv(specific); v != "" {
+			return v, specific
+		}
+		generic := "OTEL_EXPORTER_OTLP_" + name
+		return getenv(generic), generic
+	}
+
+	if protocol, name := lookup("PROTOCOL"); protocol != "" && protocol != "http/json" {
+		return nil, fmt.Errorf("%s: unsupported protocol %q (only http/json)", name, protocol)
+	}
+
+	endpoint, name := lookup("ENDPOINT")
+	switch {
+	case endpoint == "":
+		endpoint = DefaultOTLPEndpoint + "/v1/traces"
+	case name == "OTEL_EXPORTER_OTLP_ENDPOINT":
+		endpoint = strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+	if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%s: invalid endpoint %q", name, endpoint)
+	}
+
+	headerList, name := lookup("HEADERS")
+	headers, err := parseKeyValues(headerList)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	timeout, name := lookup("TIMEOUT")
+	if timeout != "" {
+		ms, err := strconv.Atoi(timeout)
+		if err != nil || ms <= 0 {
+			return nil, fmt.Errorf("%s: invalid timeout %q (milliseconds)", name, timeout)
+		}
+		client.Timeout = time.Duration(ms) * time.Millisecond
+	}
+	if caFile, name := lookup("CERTIFICATE"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates in %s", name, caFile)
+		}
+		client.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+		}
+	}
+	return NewOTLPExporter(endpoint, headers, client), nil
+}
+
+// resourceFromEnv returns the resource attributes of OTEL_RESOURCE_ATTRIBUTES
+// with service.name from OTEL_SERVICE_NAME, defaulting to DefaultServiceName.
+func resourceFromEnv(getenv func(string) string) ([]Attribute, error) {
+	attrs, err := parseKeyValues(getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if err != nil {
+		return nil, fmt.Errorf("OTEL_RESOURCE_ATTRIBUTES: %w", err)
+	}
+	if name := getenv("OTEL_SERVICE_NAME"); name != "" {
+		attrs["service.name"] = name
+	} else if attrs["service.name"] == "" {
+		attrs["service.name"] = DefaultServiceName
+	}
+
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	resource := make([]Attribute, 0, len(keys))
+	for _, k := range keys {
+		resource = append(resource, String(k, attrs[k]))
+	}
+	return resource, nil
+}
+
+// parseKeyValues parses a W3C baggage style list "k1=v1,k2=v2" with
+// percent-encoded values, as used by OTEL_RESOURCE_ATTRIBUTES and
+// OTEL_EXPORTER_OTLP_HEADERS.
+func parseKeyValues(s string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid entry %q (want key=value)", pair)
+		}
+		value, err := url.PathUnescape(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of %s: %w", k, err)
+		}
+		out[k] = value
+	}
+	return out, nil
+}
+
+func millisFromEnv(getenv func(string) string, name string) (time.Duration, error) {
+	ms, err := intFromEnv(getenv, name)
+	return time.Duration(ms) * time.Millisecond, err
+}
+
+func intFromEnv(getenv func(string) string, name string) (int, error) {
+	v := getenv(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%s: invalid value %q (must be a positive integer)", name, v)
+	}
+	return n, nil
+}
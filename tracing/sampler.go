@@ -0,0 +1,64 @@
+package tracing
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+// Sampler decides which traces are recorded. A nil sampler records all.
+type Sampler struct {
+	// Ratio is the fraction of root spans (or, without ParentBased, of all
+	// spans) that are recorded, based on the trace ID.
+	Ratio float64
+	// ParentBased makes child spans follow the decision of their parent.
+	ParentBased bool
+}
+
+// ParseSampler parses the OTEL_TRACES_SAMPLER name and its argument:
+// always_on, always_off, traceidratio (arg: the ratio, default 1), and their
+// parentbased_ variants. An empty name is parentbased_always_on.
+func ParseSampler(name, arg string) (*Sampler, error) {
+	switch name {
+	case "", "parentbased_always_on":
+		return &Sampler{Ratio: 1, ParentBased: true}, nil
+	case "always_on":
+		return &Sampler{Ratio: 1}, nil
+	case "always_off":
+		return &Sampler{Ratio: 0}, nil
+	case "parentbased_always_off":
+		return &Sampler{Ratio: 0, ParentBased: true}, nil
+	case "traceidratio", "parentbased_traceidratio":
+		ratio := 1.0
+		if arg != "" {
+			r, err := strconv.ParseFloat(arg, 64)
+			if err != nil || r < 0 || r > 1 {
+				return nil, fmt.Errorf("invalid sampler ratio %q (must be between 0 and 1)", arg)
+			}
+			ratio = r
+		}
+		return &Sampler{Ratio: ratio, ParentBased: name == "parentbased_traceidratio"}, nil
+	default:
+		return nil, fmt.Errorf("unsupported sampler %q", name)
+	}
+}
+
+// sample decides whether a span of the trace is recorded.
+func (s *Sampler) sample(traceID TraceID, parent *Span) bool {
+	if s == nil {
+		return true
+	}
+	if s.ParentBased && parent != nil {
+		return parent.sampled
+	}
+	if s.Ratio >= 1 {
+		return true
+	}
+	if s.Ratio <= 0 {
+		return false
+	}
+	// Like the OpenTelemetry TraceIdRatioBased sampler, compare the lower 63
+	// bits of the trace ID, so all services sample the same traces.
+	bound := uint64(s.Ratio * (1 << 63))
+	return binary.BigEndian.Uint64(traceID[8:])>>1 < bound
+}
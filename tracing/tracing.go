@@ -0,0 +1,329 @@
+// Package tracing records OpenTelemetry spans of the authentication pipeline
+// and exports them in batches, e.g. with the OTLP/HTTP JSON protocol to an
+// OpenTelemetry collector.
+//
+// Spans are started with Start on the process-wide tracer set with
+// SetDefault. Without a default tracer, Start returns a nil span whose
+// methods do nothing, so instrumented code needs no checks.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Attribute is a span attribute. Value is a string, bool, int, int64, or
+// float64.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// String returns a string attribute.
+func String(key, value string) Attribute { return Attribute{Key: key, Value: value} }
+
+// Int returns an integer attribute.
+func Int(key string, value int) Attribute { return Attribute{Key: key, Value: int64(value)} }
+
+// Bool returns a boolean attribute.
+func Bool(key string, value bool) Attribute { return Attribute{Key: key, Value: value} }
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// String returns the hex encoding of the ID.
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+// String returns the hex encoding of the ID, or "" for the zero ID.
+func (id SpanID) String() string {
+	if id == (SpanID{}) {
+		return ""
+	}
+	return hex.EncodeToString(id[:])
+}
+
+// SpanData is a finished span as handed to an Exporter.
+type SpanData struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	ParentID   SpanID
+	Name       string
+	Start      time.Time
+	End        time.Time
+	Attributes []Attribute
+	// Error is the error message if the span failed.
+	Error  string
+	Failed bool
+}
+
+// Exporter sends finished spans to a tracing backend.
+type Exporter interface {
+	Export(ctx context.Context, resource []Attribute, spans []SpanData) error
+}
+
+// Span is an operation within a trace. A nil span is valid and records nothing.
+type Span struct {
+	tracer  *Tracer
+	sampled bool
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// SetAttributes adds attributes to the span.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil || !s.sampled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Attributes = append(s.data.Attributes, attrs...)
+}
+
+// SetError marks the span as failed with err. A nil err does nothing.
+func (s *Span) SetError(err error) {
+	if s == nil || !s.sampled || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Failed = true
+	s.data.Error = err.Error()
+}
+
+// End finishes the span and queues it for export. Calls after the first
+// do nothing.
+func (s *Span) End() {
+	if s == nil || !s.sampled {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = s.tracer.now()
+	data := s.data
+	s.mu.Unlock()
+	s.tracer.enqueue(data)
+}
+
+// TraceID returns the ID of the span's trace, or "" for a nil span.
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return s.data.TraceID.String()
+}
+
+type spanKey struct{}
+
+// Start starts a span on the default tracer, as a child of the span in ctx
+// if there is one. It returns a context carrying the new span.
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	return Default().Start(ctx, name, attrs...)
+}
+
+// SpanFromContext returns the span carried by ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+var defaultTracer atomic.Pointer[Tracer]
+
+// SetDefault sets the tracer used by Start. Nil disables tracing.
+func SetDefault(t *Tracer) {
+	defaultTracer.Store(t)
+}
+
+// Default returns the tracer used by Start, or nil.
+func Default() *Tracer {
+	return defaultTracer.Load()
+}
+
+// TracerOptions configures a Tracer. Zero values use the defaults of the
+// OpenTelemetry batch span processor.
+type TracerOptions struct {
+	// Resource describes the process, e.g. service.name.
+	Resource []Attribute
+	// Sampler decides which traces are recorded. Nil records all.
+	Sampler *Sampler
+	// BatchDelay is the maximum time a span waits for export (default 5s).
+	BatchDelay time.Duration
+	// MaxQueueSize is the number of spans buffered for export; further spans
+	// are dropped (default 2048).
+	MaxQueueSize int
+	// MaxBatchSize is the maximum number of spans per export (default 512).
+	MaxBatchSize int
+	// ErrorFunc is called with export errors. Nil ignores them.
+	ErrorFunc func(error)
+}
+
+// Tracer creates spans and exports them in batches. It is safe for
+// concurrent use.
+type Tracer struct {
+	exporter Exporter
+	opts     TracerOptions
+	now      func() time.Time
+
+	queue   chan SpanData
+	flush   chan chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	dropped atomic.Uint64
+}
+
+// NewTracer creates a tracer exporting spans with exporter. Call Shutdown to
+// export the remaining spans.
+func NewTracer(exporter Exporter, opts TracerOptions) *Tracer {
+	if opts.BatchDelay <= 0 {
+		opts.BatchDelay = 5 * time.Second
+	}
+	if opts.MaxQueueSize <= 0 {
+		opts.MaxQueueSize = 2048
+	}
+	if opts.MaxBatchSize <= 0 || opts.MaxBatchSize > opts.MaxQueueSize {
+		opts.MaxBatchSize = min(512, opts.MaxQueueSize)
+	}
+	t := &Tracer{
+		exporter: exporter,
+		opts:     opts,
+		now:      time.Now,
+		queue:    make(chan SpanData, opts.MaxQueueSize),
+		flush:    make(chan chan struct{}),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// Start starts a span, as a child of the span in ctx if there is one. A nil
+// tracer returns ctx and a nil span.
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	s := &Span{tracer: t}
+	s.data.Name = name
+	if parent := SpanFromContext(ctx); parent != nil {
+		s.data.TraceID = parent.data.TraceID
+		s.data.ParentID = parent.data.SpanID
+		s.sampled = t.opts.Sampler.sample(s.data.TraceID, parent)
+	} else {
+		_, _ = rand.Read(s.data.TraceID[:])
+		s.sampled = t.opts.Sampler.sample(s.data.TraceID, nil)
+	}
+	_, _ = rand.Read(s.data.SpanID[:])
+	if s.sampled {
+		s.data.Start = t.now()
+		s.data.Attributes = append([]Attribute(nil), attrs...)
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Dropped returns the number of spans dropped because the queue was full.
+func (t *Tracer) Dropped() uint64 {
+	return t.dropped.Load()
+}
+
+func (t *Tracer) enqueue(data SpanData) {
+	select {
+	case t.queue <- data:
+	default:
+		t.dropped.Add(1)
+	}
+}
+
+// ForceFlush exports all queued spans.
+func (t *Tracer) ForceFlush(ctx context.Context) error {
+	flushed := make(chan struct{})
+	select {
+	case t.flush <- flushed:
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown exports the queued spans and stops the tracer. Spans ended
+// afterwards are dropped.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	t.once.Do(func() { close(t.stop) })
+	select {
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(t.opts.BatchDelay)
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, t.opts.MaxBatchSize)
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := t.exporter.Export(ctx, t.opts.Resource, batch)
+		cancel()
+		if err != nil && t.opts.ErrorFunc != nil {
+			t.opts.ErrorFunc(err)
+		}
+		batch = make([]SpanData, 0, t.opts.MaxBatchSize)
+	}
+	drain := func() {
+		for {
+			select {
+			case data := <-t.queue:
+				batch = append(batch, data)
+				if len(batch) == t.opts.MaxBatchSize {
+					export()
+				}
+			default:
+				export()
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case data := <-t.queue:
+			batch = append(batch, data)
+			if len(batch) == t.opts.MaxBatchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case flushed := <-t.flush:
+			drain()
+			close(flushed)
+		case <-t.stop:
+			drain()
+			return
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingExporter keeps exported spans.
+type recordingExporter struct {
+	mu       sync.Mutex
+	resource []Attribute
+	spans    []SpanData
+}
+
+func (e *recordingExporter) Export(_ context.Context, resource []Attribute, spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.resource = resource
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func TestTracer_Spans(t *testing.T) {
+	exp := &recordingExporter{}
+	tracer := NewTracer(exp, TracerOptions{Resource: []Attribute{String("service.name", "nauts")}})
+
+	ctx, root := tracer.Start(context.Background(), "root", String("a", "1"))
+	_, child := tracer.Start(ctx, "child")
+	child.SetAttributes(Int("n", 2))
+	child.SetError(errors.New("boom"))
+	child.End()
+	root.End()
+	root.End() // ended once
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if len(exp.spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(exp.spans))
+	}
+	c, r := exp.spans[0], exp.spans[1]
+	if c.Name != "child" || r.Name != "root" {
+		t.Fatalf("spans = %s, %s, want child, root", c.Name, r.Name)
+	}
+	if c.TraceID != r.TraceID || c.ParentID != r.SpanID || r.ParentID != (SpanID{}) {
+		t.Errorf("child %s/%s is not a child of root %s/%s", c.TraceID, c.ParentID, r.TraceID, r.SpanID)
+	}
+	if !c.Failed || c.Error != "boom" || r.Failed {
+		t.Errorf("status: child failed=%v %q, root failed=%v", c.Failed, c.Error, r.Failed)
+	}
+	if len(c.Attributes) != 1 || c.Attributes[0] != Int("n", 2) || r.End.Before(r.Start) {
+		t.Errorf("child attributes = %v", c.Attributes)
+	}
+
+	// Spans ended after shutdown are dropped.
+	_, late := tracer.Start(context.Background(), "late")
+	late.End()
+	if err := tracer.ForceFlush(context.Background()); err != nil {
+		t.Errorf("ForceFlush() after Shutdown error = %v", err)
+	}
+}
+
+func TestStart_WithoutDefault(t *testing.T) {
+	SetDefault(nil)
+	ctx, span := Start(context.Background(), "noop")
+	span.SetAttributes(String("k", "v"))
+	span.SetError(errors.New("ignored"))
+	span.End()
+	if span != nil || SpanFromContext(ctx) != nil || span.TraceID() != "" {
+		t.Errorf("Start() without a default tracer returned span %v", span)
+	}
+}
+
+func TestSampler(t *testing.T) {
+	off, _ := ParseSampler("parentbased_always_off", "")
+	on, _ := ParseSampler("always_on", "")
+	exp := &recordingExporter{}
+	tracer := NewTracer(exp, TracerOptions{Sampler: off})
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	_, child := tracer.Start(ctx, "child")
+	root.End()
+	child.End()
+	_ = tracer.Shutdown(context.Background())
+	if len(exp.spans) != 0 {
+		t.Errorf("exported %d spans of an unsampled trace", len(exp.spans))
+	}
+
+	if !on.sample(TraceID{}, &Span{}) {
+		t.Error("always_on ignores the parent")
+	}
+	half, err := ParseSampler("traceidratio", "0.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !half.sample(TraceID{15: 0x01}, nil) || half.sample(TraceID{8: 0xff}, nil) {
+		t.Error("traceidratio 0.5 does not sample by the lower trace ID bits")
+	}
+	for _, bad := range [][2]string{{"traceidratio", "2"}, {"jaeger_remote", ""}} {
+		if _, err := ParseSampler(bad[0], bad[1]); err == nil {
+			t.Errorf("ParseSampler(%q, %q) succeeded", bad[0], bad[1])
+		}
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body []byte
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	start := time.Unix(1700000000, 0)
+	span := SpanData{
+		TraceID: TraceID{1}, SpanID: SpanID{2}, Name: "nauts.verify",
+		Start: start, End: start.Add(time.Millisecond),
+		Attributes: []Attribute{String("nauts.provider", "file"), Int("n", 3), Bool("ok", true)},
+		Failed:     true, Error: "invalid credentials",
+	}
+	exp := NewOTLPExporter(srv.URL+"/v1/traces", map[string]string{"Authorization": "Bearer x"}, nil)
+	if err := exp.Export(context.Background(), []Attribute{String("service.name", "nauts")}, []SpanData{span}); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if header.Get("Content-Type") != "application/json" || header.Get("Authorization") != "Bearer x" {
+		t.Errorf("headers = %v", header)
+	}
+
+	var got otlpTraces
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("decoding request: %v", err)
+	}
+	s := got.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	if s.TraceID != "01000000000000000000000000000000" || s.SpanID != "0200000000000000" || s.ParentSpanID != "" {
+		t.Errorf("ids = %s/%s/%s", s.TraceID, s.SpanID, s.ParentSpanID)
+	}
+	if s.StartTimeUnixNano != "1700000000000000000" || s.EndTimeUnixNano != "1700000000001000000" {
+		t.Errorf("times = %s, %s", s.StartTimeUnixNano, s.EndTimeUnixNano)
+	}
+	if s.Status == nil || s.Status.Code != otlpStatusError || len(s.Attributes) != 3 || *s.Attributes[1].Value.IntValue != "3" {
+		t.Errorf("span = %+v", s)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+	}))
+	defer failing.Close()
+	err := NewOTLPExporter(failing.URL, nil, nil).Export(context.Background(), nil, []SpanData{span})
+	if err == nil || !strings.Contains(err.Error(), "quota exceeded") {
+		t.Errorf("Export() to failing endpoint error = %v", err)
+	}
+}
+
+func TestNewFromEnv(t *testing.T) {
+	env := func(vars map[string]string) func(string) string {
+		return func(k string) string { return vars[k] }
+	}
+
+	tests := []struct {
+		name    string
+		vars    map[string]string
+		enabled bool
+		wantErr bool
+	}{
+		{"unset", nil, false, false},
+		{"endpoint", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318"}, true, false},
+		{"console", map[string]string{"OTEL_TRACES_EXPORTER": "console"}, true, false},
+		{"none", map[string]string{"OTEL_TRACES_EXPORTER": "none", "OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318"}, false, false},
+		{"sdk disabled", map[string]string{"OTEL_SDK_DISABLED": "true", "OTEL_TRACES_EXPORTER": "otlp"}, false, false},
+		{"grpc", map[string]string{"OTEL_TRACES_EXPORTER": "otlp", "OTEL_EXPORTER_OTLP_PROTOCOL": "grpc"}, false, true},
+		{"bad endpoint", map[string]string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "collector:4318"}, false, true},
+		{"bad headers", map[string]string{"OTEL_TRACES_EXPORTER": "otlp", "OTEL_EXPORTER_OTLP_HEADERS": "novalue"}, false, true},
+		{"bad queue size", map[string]string{"OTEL_TRACES_EXPORTER": "console", "OTEL_BSP_MAX_QUEUE_SIZE": "-1"}, false, true},
+		{"unknown exporter", map[string]string{"OTEL_TRACES_EXPORTER": "zipkin"}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer, err := newFromEnv(env(tt.vars))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (tracer != nil) != tt.enabled {
+				t.Fatalf("newFromEnv() tracer = %v, want enabled %v", tracer, tt.enabled)
+			}
+			if tracer != nil {
+				_ = tracer.Shutdown(context.Background())
+			}
+		})
+	}
+
+	exp, err := otlpExporterFromEnv(env(map[string]string{
+		"OTEL_EXPORTER_OTLP_ENDPOINT": "https://collector:4318/",
+		"OTEL_EXPORTER_OTLP_HEADERS":  "api-key=a%20b, x-tenant=acme",
+		"OTEL_EXPORTER_OTLP_TIMEOUT":  "2500",
+	}))
+	if err != nil {
+		t.Fatalf("otlpExporterFromEnv() error = %v", err)
+	}
+	if exp.endpoint != "https://collector:4318/v1/traces" || exp.headers["api-key"] != "a b" || exp.headers["x-tenant"] != "acme" || exp.client.Timeout != 2500*time.Millisecond {
+		t.Errorf("exporter = %s %v %v", exp.endpoint, exp.headers, exp.client.Timeout)
+	}
+	exp, _ = otlpExporterFromEnv(env(map[string]string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://collector:4318/custom"}))
+	if exp.endpoint != "http://collector:4318/custom" {
+		t.Errorf("signal-specific endpoint = %s, want it unchanged", exp.endpoint)
+	}
+
+	resource, err := resourceFromEnv(env(map[string]string{"OTEL_RESOURCE_ATTRIBUTES": "deployment.environment=prod,service.name=ignored", "OTEL_SERVICE_NAME": "nauts-eu"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resource) != 2 || resource[0] != String("deployment.environment", "prod") || resource[1] != String("service.name", "nauts-eu") {
+		t.Errorf("resource = %v", resource)
+	}
+}
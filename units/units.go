@@ -0,0 +1,159 @@
+// Package units parses the durations and sizes written in nauts
+// configuration and policy files.
+//
+// Durations extend time.ParseDuration with days ("d", 24h) and weeks ("w",
+// 7d), e.g. "1d", "2w", or "1d12h". Sizes are byte counts written as a
+// number or with a decimal (KB, MB, GB) or binary (KiB, MiB, GiB) suffix,
+// e.g. "512KiB" or "1MB".
+package units
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// durationUnits are the units added to time.ParseDuration.
+var durationUnits = map[string]time.Duration{
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+// ParseDuration parses a duration like time.ParseDuration, additionally
+// accepting the units "d" (day) and "w" (week).
+func ParseDuration(s string) (time.Duration, error) {
+	rest := strings.TrimSpace(s)
+	if rest == "" {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	sign := time.Duration(1)
+	if rest[0] == '-' || rest[0] == '+' {
+		if rest[0] == '-' {
+			sign = -1
+		}
+		rest = rest[1:]
+	}
+	if rest == "0" {
+		return 0, nil
+	}
+
+	var total time.Duration
+	for rest != "" {
+		i := 0
+		for i < len(rest) && (rest[i] == '.' || (rest[i] >= '0' && rest[i] <= '9')) {
+			i++
+		}
+		j := i
+		for j < len(rest) && !(rest[j] == '.' || (rest[j] >= '0' && rest[j] <= '9')) {
+			j++
+		}
+		number, unit := rest[:i], rest[i:j]
+		if number == "" || unit == "" {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		var d time.Duration
+		if factor, ok := durationUnits[unit]; ok {
+			f, err := strconv.ParseFloat(number, 64)
+			if err != nil || f*float64(factor) > math.MaxInt64 {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			d = time.Duration(f * float64(factor))
+		} else {
+			var err error
+			if d, err = time.ParseDuration(rest[:j]); err != nil {
+				return 0, fmt.Errorf("invalid duration %q (units are ns, us, ms, s, m, h, d, w)", s)
+			}
+		}
+		total += d
+		if total < 0 {
+			return 0, fmt.Errorf("invalid duration %q: overflow", s)
+		}
+		rest = rest[j:]
+	}
+	return sign * total, nil
+}
+
+// sizeUnits maps lower-case size suffixes to their factor.
+var sizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"k":   1000,
+	"kb":  1000,
+	"m":   1000 * 1000,
+	"mb":  1000 * 1000,
+	"g":   1000 * 1000 * 1000,
+	"gb":  1000 * 1000 * 1000,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+}
+
+// ParseSize parses a byte count such as "1024", "64KiB", or "1.5MB".
+// Negative values (e.g. "-1" for unlimited) are returned as is; callers
+// validate the range.
+func ParseSize(s string) (int64, error) {
+	t := strings.TrimSpace(s)
+	i := 0
+	for i < len(t) && (t[i] == '-' || t[i] == '+' || t[i] == '.' || (t[i] >= '0' && t[i] <= '9')) {
+		i++
+	}
+	factor, ok := sizeUnits[strings.ToLower(strings.TrimSpace(t[i:]))]
+	if !ok || i == 0 {
+		return 0, fmt.Errorf("invalid size %q (units are B, KB, MB, GB, KiB, MiB, GiB)", s)
+	}
+	if n, err := strconv.ParseInt(t[:i], 10, 64); err == nil {
+		if n > math.MaxInt64/factor || n < math.MinInt64/factor {
+			return 0, fmt.Errorf("invalid size %q: overflow", s)
+		}
+		return n * factor, nil
+	}
+	f, err := strconv.ParseFloat(t[:i], 64)
+	if err != nil || math.Abs(f*float64(factor)) > math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(f * float64(factor)), nil
+}
+
+// Size is a byte count as written in a file: a JSON number or a size string
+// (see ParseSize). It is kept as written and parsed by Bytes, so that
+// validation errors can name the field.
+type Size string
+
+// UnmarshalJSON accepts a number or a string.
+func (s *Size) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var str string
+		if err := json.Unmarshal(data, &str); err != nil {
+			return err
+		}
+		*s = Size(str)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return &json.UnmarshalTypeError{Value: string(data), Type: reflect.TypeOf(*s)}
+	}
+	*s = Size(n)
+	return nil
+}
+
+// MarshalJSON encodes plain byte counts as numbers and sizes with a suffix
+// as strings.
+func (s Size) MarshalJSON() ([]byte, error) {
+	if n, err := strconv.ParseInt(string(s), 10, 64); err == nil {
+		return strconv.AppendInt(nil, n, 10), nil
+	}
+	return json.Marshal(string(s))
+}
+
+// Bytes returns the parsed size. An empty size is 0.
+func (s Size) Bytes() (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return ParseSize(string(s))
+}
@@ -0,0 +1,84 @@
+package units
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "15m", want: 15 * time.Minute},
+		{in: "1h30m", want: 90 * time.Minute},
+		{in: "1d", want: 24 * time.Hour},
+		{in: "2w", want: 14 * 24 * time.Hour},
+		{in: "1d12h", want: 36 * time.Hour},
+		{in: "1.5d", want: 36 * time.Hour},
+		{in: "-1d", want: -24 * time.Hour},
+		{in: "0", want: 0},
+		{in: "", wantErr: true},
+		{in: "1", wantErr: true},
+		{in: "1y", wantErr: true},
+		{in: "d", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseDuration(%q) = %v, %v, want %v (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "1024", want: 1024},
+		{in: "-1", want: -1},
+		{in: "1KB", want: 1000},
+		{in: "64KiB", want: 64 << 10},
+		{in: "1.5MiB", want: 3 << 19},
+		{in: "2 gb", want: 2_000_000_000},
+		{in: "1TB", wantErr: true},
+		{in: "MB", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestSize_JSON(t *testing.T) {
+	var v struct {
+		A Size `json:"a"`
+		B Size `json:"b"`
+		C Size `json:"c,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(`{"a": 512, "b": "1MiB"}`), &v); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	a, errA := v.A.Bytes()
+	b, errB := v.B.Bytes()
+	c, errC := v.C.Bytes()
+	if errA != nil || errB != nil || errC != nil || a != 512 || b != 1<<20 || c != 0 {
+		t.Errorf("Bytes() = %d, %d, %d (%v, %v, %v), want 512, %d, 0", a, b, c, errA, errB, errC, 1<<20)
+	}
+	out, err := json.Marshal(v)
+	if err != nil || string(out) != `{"a":512,"b":"1MiB"}` {
+		t.Errorf("Marshal() = %s, %v", out, err)
+	}
+	if err := json.Unmarshal([]byte(`{"a": true}`), &v); err == nil {
+		t.Error("Unmarshal() of a bool: expected error")
+	}
+	if _, err := Size("1XB").Bytes(); err == nil {
+		t.Error("Bytes() of an unknown unit: expected error")
+	}
+}